@@ -18,12 +18,18 @@ type fakeClient struct {
 	createContainerFunc   func(config *container.Config, hostConfig *container.HostConfig, networkingConfig *network.NetworkingConfig, containerName string) (container.ContainerCreateCreatedBody, error)
 	containerStartFunc    func(container string, options types.ContainerStartOptions) error
 	imageCreateFunc       func(parentReference string, options types.ImageCreateOptions) (io.ReadCloser, error)
+	imageTagFunc          func(image, ref string) error
 	infoFunc              func() (types.Info, error)
 	containerStatPathFunc func(container, path string) (types.ContainerPathStat, error)
 	containerCopyFromFunc func(container, srcPath string) (io.ReadCloser, types.ContainerPathStat, error)
 	logFunc               func(string, types.ContainerLogsOptions) (io.ReadCloser, error)
 	waitFunc              func(string) (<-chan container.ContainerWaitOKBody, <-chan error)
 	containerListFunc     func(types.ContainerListOptions) ([]types.Container, error)
+	containerCommitFunc   func(container string, options types.ContainerCommitOptions) (types.ContainerCommitResponse, error)
+	containerExportFunc   func(container string, options types.ContainerExportOptions) (io.ReadCloser, error)
+	imageInspectFunc      func(image string) (types.ImageInspect, []byte, error)
+	imagePrefetchFunc     func(image string, options types.ImagePrefetchOptions) (io.ReadCloser, error)
+	simplifyFetchesFunc   func(container string, options types.ContainerSimplifyFetchesOptions) (types.ContainerSimplifyFetches, error)
 	Version               string
 }
 
@@ -79,11 +85,19 @@ func (f *fakeClient) ImageCreate(ctx context.Context, parentReference string, op
 	return nil, nil
 }
 
+func (f *fakeClient) ImageTag(_ context.Context, image, ref string) error {
+	if f.imageTagFunc != nil {
+		return f.imageTagFunc(image, ref)
+	}
+	return nil
+}
+
 func (f *fakeClient) Info(_ context.Context) (types.Info, error) {
 	if f.infoFunc != nil {
 		return f.infoFunc()
 	}
-	return types.Info{}, nil
+	// the daemon supports simplified images unless a test says otherwise
+	return types.Info{Simplify: &types.SimplifyInfo{}}, nil
 }
 
 func (f *fakeClient) ContainerStatPath(_ context.Context, container, path string) (types.ContainerPathStat, error) {
@@ -124,3 +138,53 @@ func (f *fakeClient) ContainerStart(_ context.Context, container string, options
 	}
 	return nil
 }
+
+func (f *fakeClient) ContainerCommit(_ context.Context, container string, options types.ContainerCommitOptions) (types.IDResponse, error) {
+	if f.containerCommitFunc != nil {
+		response, err := f.containerCommitFunc(container, options)
+		return types.IDResponse{ID: response.ID}, err
+	}
+	return types.IDResponse{}, nil
+}
+
+func (f *fakeClient) ContainerCommitSimplified(_ context.Context, container string, options types.ContainerCommitOptions) (types.ContainerCommitResponse, error) {
+	if f.containerCommitFunc != nil {
+		return f.containerCommitFunc(container, options)
+	}
+	return types.ContainerCommitResponse{}, nil
+}
+
+func (f *fakeClient) ContainerExport(_ context.Context, container string) (io.ReadCloser, error) {
+	if f.containerExportFunc != nil {
+		return f.containerExportFunc(container, types.ContainerExportOptions{})
+	}
+	return nil, nil
+}
+
+func (f *fakeClient) ContainerExportSimplified(_ context.Context, container string, options types.ContainerExportOptions) (io.ReadCloser, error) {
+	if f.containerExportFunc != nil {
+		return f.containerExportFunc(container, options)
+	}
+	return nil, nil
+}
+
+func (f *fakeClient) ImageInspectWithRaw(_ context.Context, image string) (types.ImageInspect, []byte, error) {
+	if f.imageInspectFunc != nil {
+		return f.imageInspectFunc(image)
+	}
+	return types.ImageInspect{}, nil, nil
+}
+
+func (f *fakeClient) ImagePrefetch(_ context.Context, image string, options types.ImagePrefetchOptions) (io.ReadCloser, error) {
+	if f.imagePrefetchFunc != nil {
+		return f.imagePrefetchFunc(image, options)
+	}
+	return nil, nil
+}
+
+func (f *fakeClient) ContainerSimplifyFetches(_ context.Context, container string, options types.ContainerSimplifyFetchesOptions) (types.ContainerSimplifyFetches, error) {
+	if f.simplifyFetchesFunc != nil {
+		return f.simplifyFetchesFunc(container, options)
+	}
+	return types.ContainerSimplifyFetches{}, nil
+}
@@ -40,6 +40,9 @@ func NewContainerCommand(dockerCli command.Cli) *cobra.Command {
 		newListCommand(dockerCli),
 		newInspectCommand(dockerCli),
 		NewPruneCommand(dockerCli),
+		// 修改： 查看容器按需获取的文件
+		NewFetchLogCommand(dockerCli),
+		// 修改
 	)
 	return cmd
 }
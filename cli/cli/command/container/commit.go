@@ -6,8 +6,12 @@ import (
 
 	"github.com/docker/cli/cli"
 	"github.com/docker/cli/cli/command"
+	"github.com/docker/cli/cli/command/image"
 	"github.com/docker/cli/opts"
 	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/pkg/fileutils"
+	units "github.com/docker/go-units"
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
 
@@ -16,7 +20,16 @@ type commitOptions struct {
 	reference string
 
 	// 修改： 添加--simplify-image参数
-	simp bool
+	simp    bool
+	verbose bool
+	dryRun  bool
+	keep    opts.ListOpts
+	prune   opts.ListOpts
+	// threshold is nil unless --simplify-threshold is given
+	threshold *int
+	profile   string
+	force     bool
+	optional  bool
 	// 修改
 
 	pause   bool
@@ -38,6 +51,11 @@ func NewCommitCommand(dockerCli command.Cli) *cobra.Command {
 			if len(args) > 1 {
 				options.reference = args[1]
 			}
+			// 修改： 未指定阈值时由daemon使用拉取镜像时的阈值
+			if !cmd.Flags().Changed("simplify-threshold") {
+				options.threshold = nil
+			}
+			// 修改
 			return runCommit(dockerCli, &options)
 		},
 	}
@@ -48,6 +66,16 @@ func NewCommitCommand(dockerCli command.Cli) *cobra.Command {
 	flags.BoolVarP(&options.pause, "pause", "p", true, "Pause container during commit")
 	// 修改： 添加simplify-image参数的解析
 	flags.BoolVarP(&options.simp, "simplify-image", "s", false, "Commit as a Simplified image")
+	flags.BoolVar(&options.verbose, "verbose", false, "Print the paths pruned from a simplified image")
+	flags.BoolVar(&options.dryRun, "simplify-dry-run", false, "Show what a simplified commit would keep and prune without creating an image")
+	options.keep = opts.NewListOpts(nil)
+	flags.Var(&options.keep, "simplify-keep", "Keep files matching a gitignore-style pattern in a simplified image")
+	options.prune = opts.NewListOpts(nil)
+	flags.Var(&options.prune, "simplify-prune", "Prune files matching a gitignore-style pattern from a simplified image")
+	options.threshold = flags.Int("simplify-threshold", 0, "Keep profiled files opened in at least this percentage of the recorded runs (0-100)")
+	flags.StringVar(&options.profile, "simplify-profile", "", "Simplify with the profile read from a file instead of the container's image profile")
+	flags.BoolVar(&options.force, "force", false, "Use the --simplify-profile even if it was recorded for another image")
+	command.AddSimplifyOptionalFlag(flags, &options.optional)
 	// 修改
 	flags.StringVarP(&options.comment, "message", "m", "", "Commit message")
 	flags.StringVarP(&options.author, "author", "a", "", "Author (e.g., \"John Hannibal Smith <hannibal@a-team.com>\")")
@@ -64,6 +92,49 @@ func runCommit(dockerCli command.Cli, options *commitOptions) error {
 	name := options.container
 	reference := options.reference
 
+	// 修改： 在发送请求前检查精简提交的文件模式
+	keep, prune := options.keep.GetAll(), options.prune.GetAll()
+	if len(keep) > 0 || len(prune) > 0 {
+		if !options.simp && !options.dryRun {
+			return errors.New("--simplify-keep and --simplify-prune require --simplify-image or --simplify-dry-run")
+		}
+		if err := validateSimplifyPatterns(append(keep, prune...)); err != nil {
+			return err
+		}
+	}
+	if options.threshold != nil {
+		if !options.simp && !options.dryRun {
+			return errors.New("--simplify-threshold requires --simplify-image or --simplify-dry-run")
+		}
+		if err := validateSimplifyThreshold(*options.threshold); err != nil {
+			return err
+		}
+	}
+	var profile *types.ImageProfile
+	if options.profile != "" {
+		if !options.simp && !options.dryRun {
+			return errors.New("--simplify-profile requires --simplify-image or --simplify-dry-run")
+		}
+		var err error
+		if profile, err = image.ReadProfileFile(options.profile); err != nil {
+			return err
+		}
+	} else if options.force {
+		return errors.New("--force requires --simplify-profile")
+	}
+	if options.optional && options.dryRun {
+		return errors.New("--simplify-optional cannot be used with --simplify-dry-run")
+	}
+	// 守护进程不支持精简镜像时失败，或按--simplify-optional提交完整镜像
+	if options.simp || options.dryRun {
+		simp, err := command.SimplifySupport(ctx, dockerCli, options.optional)
+		if err != nil {
+			return err
+		}
+		options.simp = options.simp && simp != nil
+	}
+	// 修改
+
 	commitOptions := types.ContainerCommitOptions{
 		Reference: reference,
 		Comment:   options.comment,
@@ -72,16 +143,110 @@ func runCommit(dockerCli command.Cli, options *commitOptions) error {
 		Pause:     options.pause,
 
 		// 修改： 对Simp参数赋值
-		Simp: options.simp,
+		Simp:               options.simp,
+		Verbose:            options.verbose,
+		SimplifyDryRun:     options.dryRun,
+		SimplifyKeep:       keep,
+		SimplifyPrune:      prune,
+		SimplifyThreshold:  options.threshold,
+		SimplifyUseProfile: profile,
+		SimplifyForce:      options.force,
 		// 修改
 	}
 
 	// 准备发送http请求
-	response, err := dockerCli.Client().ContainerCommit(ctx, name, commitOptions)
+	// 修改： 精简提交时获取精简结果，完整提交不要求API版本
+	var (
+		response types.ContainerCommitResponse
+		err      error
+	)
+	if options.simp || options.dryRun {
+		response, err = dockerCli.Client().ContainerCommitSimplified(ctx, name, commitOptions)
+	} else {
+		var id types.IDResponse
+		id, err = dockerCli.Client().ContainerCommit(ctx, name, commitOptions)
+		response.ID = id.ID
+	}
+	// 修改
 	if err != nil {
 		return err
 	}
 
+	// 修改： 输出精简结果
+	if options.dryRun {
+		printSimplifyDryRun(dockerCli, response.Simplify)
+		return nil
+	}
+	// 修改
+
 	fmt.Fprintln(dockerCli.Out(), response.ID)
+
+	// 修改： 在ID之后输出精简结果
+	if s := response.Simplify; s != nil {
+		for _, p := range s.Pruned {
+			fmt.Fprintln(dockerCli.Err(), p)
+		}
+		fmt.Fprintln(dockerCli.Err(), simplifySummaryLine(s))
+		if s.FilesBelowThreshold > 0 {
+			fmt.Fprintf(dockerCli.Err(), "%d profiled files were pruned for being opened in too few runs\n", s.FilesBelowThreshold)
+		}
+	}
+	// 修改
+	return nil
+}
+
+// simplifySummaryLine returns the one-line summary of a simplified commit,
+// with the sizes of the full and simplified images and the profile digest
+// when the daemon reports them.
+func simplifySummaryLine(s *types.SimplifySummary) string {
+	line := fmt.Sprintf("Kept %d files, pruned %d files, saved %s", s.FilesKept, s.FilesPruned, units.HumanSize(float64(s.BytesSaved)))
+	if s.FullSize > 0 {
+		line += fmt.Sprintf(" (%s of %s)", units.HumanSize(float64(s.Size)), units.HumanSize(float64(s.FullSize)))
+	}
+	if s.Profile != "" {
+		line += ", profile " + s.Profile
+	}
+	return line
+}
+
+// printSimplifyDryRun prints the paths a simplified commit would keep and
+// prune, followed by a summary.
+func printSimplifyDryRun(dockerCli command.Cli, s *types.SimplifySummary) {
+	if s == nil {
+		return
+	}
+	for _, p := range s.Kept {
+		fmt.Fprintf(dockerCli.Out(), "keep\t%s\n", p)
+	}
+	for _, p := range s.Pruned {
+		fmt.Fprintf(dockerCli.Out(), "prune\t%s\n", p)
+	}
+	fmt.Fprintf(dockerCli.Out(), "Would keep %d files, prune %d files, save %s\n", s.FilesKept, s.FilesPruned, units.HumanSize(float64(s.BytesSaved)))
+	if s.FilesBelowThreshold > 0 {
+		fmt.Fprintf(dockerCli.Out(), "%d profiled files would be pruned for being opened in too few runs\n", s.FilesBelowThreshold)
+	}
+}
+
+// validateSimplifyThreshold checks that threshold is a percentage.
+func validateSimplifyThreshold(threshold int) error {
+	if threshold < 0 || threshold > 100 {
+		return errors.Errorf("invalid simplify threshold %d: must be between 0 and 100", threshold)
+	}
+	return nil
+}
+
+// validateSimplifyPatterns checks the syntax of the keep and prune patterns of
+// a simplified commit.
+func validateSimplifyPatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		pm, err := fileutils.NewPatternMatcher([]string{pattern})
+		if err == nil {
+			// 模式在第一次匹配时才编译
+			_, err = pm.Matches(".")
+		}
+		if err != nil {
+			return errors.Errorf("invalid simplify pattern %q: %v", pattern, err)
+		}
+	}
 	return nil
 }
@@ -0,0 +1,199 @@
+package container
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/docker/cli/internal/test"
+	"github.com/docker/docker/api/types"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+	"gotest.tools/fs"
+)
+
+func TestCommitSimplifyImageSummary(t *testing.T) {
+	testCases := []struct {
+		args           []string
+		expectVerbose  bool
+		expectedStderr string
+	}{
+		{
+			args:           []string{"-s", "c1"},
+			expectedStderr: "Kept 2 files, pruned 3 files, saved 2MB\n",
+		},
+		{
+			args:           []string{"-s", "--verbose", "c1"},
+			expectVerbose:  true,
+			expectedStderr: "/usr/bin/tool\n/usr/lib/libtool.so\n/var/cache/index\nKept 2 files, pruned 3 files, saved 2MB\n",
+		},
+	}
+	for _, tc := range testCases {
+		cli := test.NewFakeCli(&fakeClient{
+			containerCommitFunc: func(container string, options types.ContainerCommitOptions) (types.ContainerCommitResponse, error) {
+				assert.Check(t, is.Equal(container, "c1"))
+				assert.Check(t, options.Simp)
+				assert.Check(t, is.Equal(options.Verbose, tc.expectVerbose))
+				summary := &types.SimplifySummary{FilesKept: 2, FilesPruned: 3, BytesSaved: 2000000}
+				if options.Verbose {
+					summary.Pruned = []string{"/usr/bin/tool", "/usr/lib/libtool.so", "/var/cache/index"}
+				}
+				return types.ContainerCommitResponse{ID: "sha256:abc", Simplify: summary}, nil
+			},
+		})
+		cmd := NewCommitCommand(cli)
+		cmd.SetOutput(ioutil.Discard)
+		cmd.SetArgs(tc.args)
+		assert.NilError(t, cmd.Execute())
+		assert.Check(t, is.Equal(cli.OutBuffer().String(), "sha256:abc\n"))
+		assert.Check(t, is.Equal(cli.ErrBuffer().String(), tc.expectedStderr))
+	}
+}
+
+func TestCommitWithoutSimplifyImage(t *testing.T) {
+	cli := test.NewFakeCli(&fakeClient{
+		containerCommitFunc: func(container string, options types.ContainerCommitOptions) (types.ContainerCommitResponse, error) {
+			assert.Check(t, !options.Simp)
+			return types.ContainerCommitResponse{ID: "sha256:abc"}, nil
+		},
+	})
+	cmd := NewCommitCommand(cli)
+	cmd.SetOutput(ioutil.Discard)
+	cmd.SetArgs([]string{"c1"})
+	assert.NilError(t, cmd.Execute())
+	assert.Check(t, is.Equal(cli.OutBuffer().String(), "sha256:abc\n"))
+	assert.Check(t, is.Equal(cli.ErrBuffer().String(), ""))
+}
+
+func TestCommitSimplifyDryRun(t *testing.T) {
+	cli := test.NewFakeCli(&fakeClient{
+		containerCommitFunc: func(container string, options types.ContainerCommitOptions) (types.ContainerCommitResponse, error) {
+			assert.Check(t, options.SimplifyDryRun)
+			return types.ContainerCommitResponse{Simplify: &types.SimplifySummary{
+				FilesKept:   1,
+				FilesPruned: 2,
+				BytesSaved:  3000,
+				Kept:        []string{"/bin/app"},
+				Pruned:      []string{"/bin/tool", "/etc/tool.conf"},
+			}}, nil
+		},
+	})
+	cmd := NewCommitCommand(cli)
+	cmd.SetOutput(ioutil.Discard)
+	cmd.SetArgs([]string{"--simplify-dry-run", "c1", "app:simplified"})
+	assert.NilError(t, cmd.Execute())
+	assert.Check(t, is.Equal(cli.OutBuffer().String(), "keep\t/bin/app\nprune\t/bin/tool\nprune\t/etc/tool.conf\nWould keep 1 files, prune 2 files, save 3kB\n"))
+	assert.Check(t, is.Equal(cli.ErrBuffer().String(), ""))
+}
+
+func TestCommitSimplifyPatterns(t *testing.T) {
+	cli := test.NewFakeCli(&fakeClient{
+		containerCommitFunc: func(container string, options types.ContainerCommitOptions) (types.ContainerCommitResponse, error) {
+			assert.Check(t, is.DeepEqual(options.SimplifyKeep, []string{"/etc/ssl", "*.so"}))
+			assert.Check(t, is.DeepEqual(options.SimplifyPrune, []string{"/usr/share/doc"}))
+			assert.Check(t, options.SimplifyThreshold == nil)
+			return types.ContainerCommitResponse{ID: "sha256:abc", Simplify: &types.SimplifySummary{}}, nil
+		},
+	})
+	cmd := NewCommitCommand(cli)
+	cmd.SetOutput(ioutil.Discard)
+	cmd.SetArgs([]string{"-s", "--simplify-keep", "/etc/ssl", "--simplify-keep", "*.so", "--simplify-prune", "/usr/share/doc", "c1"})
+	assert.NilError(t, cmd.Execute())
+}
+
+func TestCommitSimplifyThreshold(t *testing.T) {
+	cli := test.NewFakeCli(&fakeClient{
+		containerCommitFunc: func(container string, options types.ContainerCommitOptions) (types.ContainerCommitResponse, error) {
+			assert.Assert(t, options.SimplifyThreshold != nil)
+			assert.Check(t, is.Equal(*options.SimplifyThreshold, 60))
+			return types.ContainerCommitResponse{ID: "sha256:abc", Simplify: &types.SimplifySummary{FilesKept: 2, FilesPruned: 3, BytesSaved: 2000000, FilesBelowThreshold: 1}}, nil
+		},
+	})
+	cmd := NewCommitCommand(cli)
+	cmd.SetOutput(ioutil.Discard)
+	cmd.SetArgs([]string{"-s", "--simplify-threshold", "60", "c1"})
+	assert.NilError(t, cmd.Execute())
+	assert.Check(t, is.Equal(cli.ErrBuffer().String(), "Kept 2 files, pruned 3 files, saved 2MB\n1 profiled files were pruned for being opened in too few runs\n"))
+}
+
+func TestCommitSimplifySizes(t *testing.T) {
+	cli := test.NewFakeCli(&fakeClient{
+		containerCommitFunc: func(container string, options types.ContainerCommitOptions) (types.ContainerCommitResponse, error) {
+			return types.ContainerCommitResponse{ID: "sha256:abc", Simplify: &types.SimplifySummary{
+				FilesKept:   2,
+				FilesPruned: 3,
+				BytesSaved:  2000000,
+				FullSize:    5000000,
+				Size:        3000000,
+				Profile:     "sha256:0123",
+			}}, nil
+		},
+	})
+	cmd := NewCommitCommand(cli)
+	cmd.SetOutput(ioutil.Discard)
+	cmd.SetArgs([]string{"-s", "c1"})
+	assert.NilError(t, cmd.Execute())
+	assert.Check(t, is.Equal(cli.OutBuffer().String(), "sha256:abc\n"))
+	assert.Check(t, is.Equal(cli.ErrBuffer().String(), "Kept 2 files, pruned 3 files, saved 2MB (3MB of 5MB), profile sha256:0123\n"))
+}
+
+func TestCommitSimplifyProfile(t *testing.T) {
+	dir := fs.NewDir(t, "commit", fs.WithFile("profile.json", `{"Image":"sha256:0123456789abcdef","Paths":["/bin/sh"]}`))
+	defer dir.Remove()
+
+	cli := test.NewFakeCli(&fakeClient{
+		containerCommitFunc: func(container string, options types.ContainerCommitOptions) (types.ContainerCommitResponse, error) {
+			assert.Assert(t, options.SimplifyUseProfile != nil)
+			assert.Check(t, is.DeepEqual(options.SimplifyUseProfile.Paths, []string{"/bin/sh"}))
+			assert.Check(t, options.SimplifyForce)
+			return types.ContainerCommitResponse{ID: "sha256:abc", Simplify: &types.SimplifySummary{}}, nil
+		},
+	})
+	cmd := NewCommitCommand(cli)
+	cmd.SetOutput(ioutil.Discard)
+	cmd.SetArgs([]string{"-s", "--simplify-profile", dir.Join("profile.json"), "--force", "c1"})
+	assert.NilError(t, cmd.Execute())
+}
+
+func TestCommitSimplifyPatternsInvalid(t *testing.T) {
+	testCases := []struct {
+		args          []string
+		expectedError string
+	}{
+		{
+			args:          []string{"-s", "--simplify-keep", "[", "c1"},
+			expectedError: `invalid simplify pattern "["`,
+		},
+		{
+			args:          []string{"--simplify-prune", "/usr/share/doc", "c1"},
+			expectedError: "require --simplify-image or --simplify-dry-run",
+		},
+		{
+			args:          []string{"-s", "--simplify-threshold", "101", "c1"},
+			expectedError: "invalid simplify threshold 101",
+		},
+		{
+			args:          []string{"--simplify-threshold", "50", "c1"},
+			expectedError: "--simplify-threshold requires --simplify-image or --simplify-dry-run",
+		},
+		{
+			args:          []string{"--simplify-profile", "profile.json", "c1"},
+			expectedError: "--simplify-profile requires --simplify-image or --simplify-dry-run",
+		},
+		{
+			args:          []string{"-s", "--force", "c1"},
+			expectedError: "--force requires --simplify-profile",
+		},
+	}
+	for _, tc := range testCases {
+		cli := test.NewFakeCli(&fakeClient{
+			containerCommitFunc: func(container string, options types.ContainerCommitOptions) (types.ContainerCommitResponse, error) {
+				t.Fatal("unexpected commit request")
+				return types.ContainerCommitResponse{}, nil
+			},
+		})
+		cmd := NewCommitCommand(cli)
+		cmd.SetOutput(ioutil.Discard)
+		cmd.SetArgs(tc.args)
+		assert.ErrorContains(t, cmd.Execute(), tc.expectedError)
+	}
+}
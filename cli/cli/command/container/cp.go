@@ -2,6 +2,7 @@ package container
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
@@ -155,6 +156,14 @@ func copyFromContainer(ctx context.Context, dockerCli command.Cli, copyConfig cp
 	}
 	defer content.Close()
 
+	// 修改： 复制完成后报告精简镜像中被裁剪的文件
+	defer func() {
+		if err == nil {
+			reportPrunedCopy(dockerCli.Err(), stat)
+		}
+	}()
+	// 修改
+
 	if dstPath == "-" {
 		_, err = io.Copy(dockerCli.Out(), content)
 		return err
@@ -175,6 +184,22 @@ func copyFromContainer(ctx context.Context, dockerCli command.Cli, copyConfig cp
 	return archive.CopyTo(preArchive, srcInfo, dstPath)
 }
 
+// 修改： 报告精简镜像中被裁剪的文件
+
+// reportPrunedCopy tells on w how many of the entries copied out of a
+// container were pruned from its simplified image and fetched, and how many
+// files are missing from the copy because they could not be.
+func reportPrunedCopy(w io.Writer, stat types.ContainerPathStat) {
+	if stat.Fetched > 0 {
+		fmt.Fprintf(w, "Fetched %d entries pruned from the simplified image\n", stat.Fetched)
+	}
+	if stat.Pruned > 0 {
+		fmt.Fprintf(w, "Warning: %d files pruned from the simplified image could not be fetched and are missing from the copy\n", stat.Pruned)
+	}
+}
+
+// 修改
+
 // In order to get the copy behavior right, we need to know information
 // about both the source and destination. The API is a simple tar
 // archive/extract API but we can use the stat info header about the
@@ -190,3 +190,30 @@ func TestSplitCpArg(t *testing.T) {
 		})
 	}
 }
+
+func TestRunCopyFromSimplifiedContainer(t *testing.T) {
+	testCases := []struct {
+		stat        types.ContainerPathStat
+		expectedErr string
+	}{
+		{
+			stat:        types.ContainerPathStat{Fetched: 12},
+			expectedErr: "Fetched 12 entries pruned from the simplified image\n",
+		},
+		{
+			stat:        types.ContainerPathStat{Pruned: 3},
+			expectedErr: "Warning: 3 files pruned from the simplified image could not be fetched and are missing from the copy\n",
+		},
+	}
+	for _, tc := range testCases {
+		fakeClient := &fakeClient{
+			containerCopyFromFunc: func(container, srcPath string) (io.ReadCloser, types.ContainerPathStat, error) {
+				return ioutil.NopCloser(strings.NewReader("the tar content")), tc.stat, nil
+			},
+		}
+		cli := test.NewFakeCli(fakeClient)
+		assert.NilError(t, runCopy(cli, copyOptions{source: "container:/usr/share/doc", destination: "-"}))
+		assert.Check(t, is.Equal("the tar content", cli.OutBuffer().String()))
+		assert.Check(t, is.Equal(tc.expectedErr, cli.ErrBuffer().String()))
+	}
+}
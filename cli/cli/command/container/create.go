@@ -9,12 +9,14 @@ import (
 	"github.com/docker/cli/cli"
 	"github.com/docker/cli/cli/command"
 	"github.com/docker/cli/cli/command/image"
+	"github.com/docker/cli/cli/trust"
 	"github.com/docker/distribution/reference"
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
 	apiclient "github.com/docker/docker/client"
 	"github.com/docker/docker/pkg/jsonmessage"
 	"github.com/docker/docker/registry"
+	digest "github.com/opencontainers/go-digest"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
@@ -24,6 +26,10 @@ type createOptions struct {
 	name      string
 	platform  string
 	untrusted bool
+	// 修改： 添加精简镜像选项，run与create共用
+	simp             bool
+	simplifyOptional bool
+	// 修改
 }
 
 // NewCreateCommand creates a new cobra.Command for `docker create`
@@ -48,6 +54,10 @@ func NewCreateCommand(dockerCli command.Cli) *cobra.Command {
 	flags.SetInterspersed(false)
 
 	flags.StringVar(&opts.name, "name", "", "Assign a name to the container")
+	// 修改： 添加精简镜像选项
+	flags.BoolVarP(&opts.simp, "simplify-image", "s", false, "Start the container on a simplified image")
+	command.AddSimplifyOptionalFlag(flags, &opts.simplifyOptional)
+	// 修改
 
 	// Add an explicit help that doesn't have a `-h` to prevent the conflict
 	// with hostname
@@ -65,6 +75,13 @@ func runCreate(dockerCli command.Cli, flags *pflag.FlagSet, opts *createOptions,
 		reportError(dockerCli.Err(), "create", err.Error(), true)
 		return cli.StatusError{StatusCode: 125}
 	}
+	// 修改： 守护进程不支持精简镜像时失败，或按--simplify-optional不精简
+	if opts.simp {
+		if opts.simp, err = checkSimplifySupport(context.Background(), dockerCli, opts.simplifyOptional); err != nil {
+			return err
+		}
+	}
+	// 修改
 	response, err := createContainer(context.Background(), dockerCli, containerConfig, opts)
 	if err != nil {
 		return err
@@ -73,7 +90,24 @@ func runCreate(dockerCli command.Cli, flags *pflag.FlagSet, opts *createOptions,
 	return nil
 }
 
-func pullImage(ctx context.Context, dockerCli command.Cli, image string, platform string, out io.Writer) error {
+// 修改： 内容信任时精简拉取签名验证过的摘要
+
+// pullSimplify holds the simplification options of the pull of the image of
+// a container.
+type pullSimplify struct {
+	simp bool
+	// trusted only uses the profile signed along with the image, and
+	// records signedDigest as the provenance of the simplified image.
+	trusted       bool
+	signedProfile *trust.SimplifyProfile
+	signedDigest  digest.Digest
+}
+
+// 修改
+
+// 修改： 添加simp参数，docker run -s在本地没有镜像时拉取精简镜像
+func pullImage(ctx context.Context, dockerCli command.Cli, image string, platform string, simp pullSimplify, out io.Writer) error {
+	// 修改
 	ref, err := reference.ParseNormalizedNamed(image)
 	if err != nil {
 		return err
@@ -94,6 +128,14 @@ func pullImage(ctx context.Context, dockerCli command.Cli, image string, platfor
 	options := types.ImageCreateOptions{
 		RegistryAuth: encodedAuth,
 		Platform:     platform,
+		// 修改： 内容信任只使用签名的profile
+		Simp:                 simp.simp,
+		SimplifyTrusted:      simp.trusted,
+		SimplifySignedDigest: simp.signedDigest.String(),
+		// 修改
+	}
+	if simp.signedProfile != nil {
+		options.SimplifySignedProfile = simp.signedProfile.Digest.String()
 	}
 
 	responseBody, err := dockerCli.Client().ImageCreate(ctx, image, options)
@@ -169,6 +211,9 @@ func createContainer(ctx context.Context, dockerCli command.Cli, containerConfig
 		trustedRef reference.Canonical
 		namedRef   reference.Named
 	)
+	// 修改： 内容信任时精简拉取签名验证过的摘要
+	simp := pullSimplify{simp: opts.simp, trusted: !opts.untrusted}
+	// 修改
 
 	containerIDFile, err := newCIDFile(hostConfig.ContainerIDFile)
 	if err != nil {
@@ -185,14 +230,21 @@ func createContainer(ctx context.Context, dockerCli command.Cli, containerConfig
 
 		if taggedRef, ok := namedRef.(reference.NamedTagged); ok && !opts.untrusted {
 			var err error
-			trustedRef, err = image.TrustedReference(ctx, dockerCli, taggedRef, nil)
+			// 修改： 随镜像签名的profile
+			trustedRef, simp.signedProfile, err = image.TrustedSimplifyReference(ctx, dockerCli, taggedRef, nil)
+			// 修改
 			if err != nil {
 				return nil, err
 			}
 			config.Image = reference.FamiliarString(trustedRef)
+			simp.signedDigest = trustedRef.Digest()
 		}
 	}
 
+	// 修改： 将精简镜像选项记录到HostConfig中，供之后的docker start使用
+	hostConfig.SimplifyImage = opts.simp
+	// 修改
+
 	//create the container
 	response, err := dockerCli.Client().ContainerCreate(ctx, config, hostConfig, networkingConfig, opts.name)
 
@@ -202,7 +254,7 @@ func createContainer(ctx context.Context, dockerCli command.Cli, containerConfig
 			fmt.Fprintf(stderr, "Unable to find image '%s' locally\n", reference.FamiliarString(namedRef))
 
 			// we don't want to write to stdout anything apart from container.ID
-			if err := pullImage(ctx, dockerCli, config.Image, opts.platform, stderr); err != nil {
+			if err := pullImage(ctx, dockerCli, config.Image, opts.platform, simp, stderr); err != nil {
 				return nil, err
 			}
 			if taggedRef, ok := namedRef.(reference.NamedTagged); ok && trustedRef != nil {
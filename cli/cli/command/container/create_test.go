@@ -2,6 +2,7 @@ package container
 
 import (
 	"context"
+	"crypto/sha256"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -10,13 +11,17 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/docker/cli/cli/trust"
 	"github.com/docker/cli/internal/test"
 	"github.com/docker/cli/internal/test/notary"
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/network"
 	"github.com/google/go-cmp/cmp"
+	digest "github.com/opencontainers/go-digest"
 	"github.com/pkg/errors"
+	"github.com/theupdateframework/notary/client"
+	"github.com/theupdateframework/notary/tuf/data"
 	"gotest.tools/assert"
 	is "gotest.tools/assert/cmp"
 	"gotest.tools/fs"
@@ -121,6 +126,109 @@ func TestCreateContainerPullsImageIfMissing(t *testing.T) {
 	assert.Check(t, is.Contains(stderr, "Unable to find image 'does-not-exist-locally:latest' locally"))
 }
 
+func TestCreateContainerPullsSimplifiedImageIfMissing(t *testing.T) {
+	var pulledSimp bool
+	responseCounter := 0
+	client := &fakeClient{
+		createContainerFunc: func(
+			config *container.Config,
+			hostConfig *container.HostConfig,
+			networkingConfig *network.NetworkingConfig,
+			containerName string,
+		) (container.ContainerCreateCreatedBody, error) {
+			defer func() { responseCounter++ }()
+			if responseCounter == 0 {
+				return container.ContainerCreateCreatedBody{}, fakeNotFound{}
+			}
+			return container.ContainerCreateCreatedBody{ID: "abcdef"}, nil
+		},
+		imageCreateFunc: func(parentReference string, options types.ImageCreateOptions) (io.ReadCloser, error) {
+			pulledSimp = options.Simp
+			return ioutil.NopCloser(strings.NewReader("")), nil
+		},
+		infoFunc: func() (types.Info, error) {
+			return types.Info{IndexServerAddress: "http://indexserver"}, nil
+		},
+	}
+	cli := test.NewFakeCli(client)
+	config := &containerConfig{
+		Config:     &container.Config{Image: "does-not-exist-locally"},
+		HostConfig: &container.HostConfig{},
+	}
+	_, err := createContainer(context.Background(), cli, config, &createOptions{
+		untrusted: true,
+		simp:      true,
+	})
+	assert.NilError(t, err)
+	assert.Check(t, pulledSimp)
+	assert.Check(t, config.HostConfig.SimplifyImage)
+}
+
+// signedNotaryRepository serves a single signed target for every tag.
+type signedNotaryRepository struct {
+	client.Repository
+	target client.Target
+}
+
+func (r signedNotaryRepository) GetTargetByName(name string, roles ...data.RoleName) (*client.TargetWithRole, error) {
+	return &client.TargetWithRole{Target: r.target, Role: data.CanonicalTargetsRole}, nil
+}
+
+func TestCreateContainerPullsSignedSimplifiedImage(t *testing.T) {
+	sum := sha256.Sum256([]byte("red"))
+	dgst := digest.NewDigestFromBytes(digest.SHA256, sum[:])
+	profile := digest.FromString(`{"paths":["/bin/sh"]}`)
+	target := client.Target{Name: "red", Hashes: data.Hashes{"sha256": sum[:]}}
+	assert.NilError(t, trust.SetSimplifyProfile(&target, trust.SimplifyProfile{Digest: profile, Size: 22}))
+	var (
+		pulledRef string
+		pulled    types.ImageCreateOptions
+	)
+	responseCounter := 0
+	cli := test.NewFakeCli(&fakeClient{
+		createContainerFunc: func(
+			config *container.Config,
+			hostConfig *container.HostConfig,
+			networkingConfig *network.NetworkingConfig,
+			containerName string,
+		) (container.ContainerCreateCreatedBody, error) {
+			defer func() { responseCounter++ }()
+			if responseCounter == 0 {
+				return container.ContainerCreateCreatedBody{}, fakeNotFound{}
+			}
+			return container.ContainerCreateCreatedBody{ID: "abcdef"}, nil
+		},
+		imageCreateFunc: func(parentReference string, options types.ImageCreateOptions) (io.ReadCloser, error) {
+			pulledRef, pulled = parentReference, options
+			return ioutil.NopCloser(strings.NewReader("")), nil
+		},
+		imageTagFunc: func(image, ref string) error {
+			assert.Check(t, is.Equal(image, "image@"+dgst.String()))
+			assert.Check(t, is.Equal(ref, "image:red"))
+			return nil
+		},
+		infoFunc: func() (types.Info, error) {
+			return types.Info{IndexServerAddress: "http://indexserver"}, nil
+		},
+	}, test.EnableContentTrust)
+	cli.SetNotaryClient(func(imgRefAndAuth trust.ImageRefAndAuth, actions []string) (client.Repository, error) {
+		repo, err := notary.GetLoadedNotaryRepository(imgRefAndAuth, actions)
+		return signedNotaryRepository{Repository: repo, target: target}, err
+	})
+	config := &containerConfig{
+		Config:     &container.Config{Image: "image:red"},
+		HostConfig: &container.HostConfig{},
+	}
+	_, err := createContainer(context.Background(), cli, config, &createOptions{simp: true})
+	assert.NilError(t, err)
+	// the digest verified against the signature is simplified, not the tag
+	assert.Check(t, is.Equal(pulledRef, "image@"+dgst.String()))
+	assert.Check(t, pulled.Simp)
+	assert.Check(t, pulled.SimplifyTrusted)
+	assert.Check(t, is.Equal(pulled.SimplifySignedDigest, dgst.String()))
+	assert.Check(t, is.Equal(pulled.SimplifySignedProfile, profile.String()))
+}
+
 func TestNewCreateCommandWithContentTrustErrors(t *testing.T) {
 	testCases := []struct {
 		name          string
@@ -166,6 +274,25 @@ func TestNewCreateCommandWithContentTrustErrors(t *testing.T) {
 	}
 }
 
+func TestNewCreateCommandSimplifyImage(t *testing.T) {
+	var simp bool
+	cli := test.NewFakeCli(&fakeClient{
+		createContainerFunc: func(_ *container.Config,
+			hostConfig *container.HostConfig,
+			_ *network.NetworkingConfig,
+			_ string,
+		) (container.ContainerCreateCreatedBody, error) {
+			simp = hostConfig.SimplifyImage
+			return container.ContainerCreateCreatedBody{ID: "id"}, nil
+		},
+	})
+	cmd := NewCreateCommand(cli)
+	cmd.SetArgs([]string{"--simplify-image", "busybox"})
+	assert.NilError(t, cmd.Execute())
+	assert.Check(t, simp)
+	assert.Check(t, is.Equal("id\n", cli.OutBuffer().String()))
+}
+
 type fakeNotFound struct{}
 
 func (f fakeNotFound) NotFound() bool { return true }
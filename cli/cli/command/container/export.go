@@ -6,6 +6,8 @@ import (
 
 	"github.com/docker/cli/cli"
 	"github.com/docker/cli/cli/command"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/pkg/jsonmessage"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
@@ -13,6 +15,9 @@ import (
 type exportOptions struct {
 	container string
 	output    string
+	// 修改： 精简容器只导出已有的文件
+	sparse bool
+	// 修改
 }
 
 // NewExportCommand creates a new `docker export` command
@@ -32,6 +37,10 @@ func NewExportCommand(dockerCli command.Cli) *cobra.Command {
 	flags := cmd.Flags()
 
 	flags.StringVarP(&opts.output, "output", "o", "", "Write to a file, instead of STDOUT")
+	// 修改： 精简容器只导出已有的文件
+	flags.BoolVar(&opts.sparse, "sparse", false, "Do not fetch the files pruned from a simplified image, list them in /.simplify-omitted instead")
+	flags.SetAnnotation("sparse", "ostype", []string{"linux"})
+	// 修改
 
 	return cmd
 }
@@ -43,7 +52,21 @@ func runExport(dockerCli command.Cli, opts exportOptions) error {
 
 	clnt := dockerCli.Client()
 
-	responseBody, err := clnt.ContainerExport(context.Background(), opts.container)
+	// 修改： 先拉取精简镜像缺失的文件，在stderr上显示进度
+	if !opts.sparse {
+		if err := prefetchExport(context.Background(), dockerCli, opts.container); err != nil {
+			return err
+		}
+	}
+
+	var responseBody io.ReadCloser
+	var err error
+	if opts.sparse {
+		responseBody, err = clnt.ContainerExportSimplified(context.Background(), opts.container, types.ContainerExportOptions{Sparse: true})
+	} else {
+		responseBody, err = clnt.ContainerExport(context.Background(), opts.container)
+	}
+	// 修改
 	if err != nil {
 		return err
 	}
@@ -56,3 +79,30 @@ func runExport(dockerCli command.Cli, opts exportOptions) error {
 
 	return command.CopyToFile(opts.output, responseBody)
 }
+
+// 修改： 导出前拉取精简镜像缺失的文件
+
+// prefetchExport fetches the files pruned from the simplified image of the
+// container before it is exported, showing the progress on stderr. The
+// daemon fetches them anyway when exporting, but without progress.
+func prefetchExport(ctx context.Context, dockerCli command.Cli, container string) error {
+	c, err := dockerCli.Client().ContainerInspect(ctx, container)
+	if err != nil {
+		return err
+	}
+	img, _, err := dockerCli.Client().ImageInspectWithRaw(ctx, c.Image)
+	if err != nil {
+		return err
+	}
+	if !img.Simplified.Enabled || img.Simplified.Materialized {
+		return nil
+	}
+	responseBody, err := dockerCli.Client().ImagePrefetch(ctx, c.Image, types.ImagePrefetchOptions{})
+	if err != nil {
+		return err
+	}
+	defer responseBody.Close()
+	return jsonmessage.DisplayJSONMessagesToStream(responseBody, command.NewOutStream(dockerCli.Err()), nil)
+}
+
+// 修改
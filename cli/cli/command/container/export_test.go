@@ -0,0 +1,70 @@
+package container
+
+import (
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/docker/cli/internal/test"
+	"github.com/docker/docker/api/types"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+	"gotest.tools/fs"
+)
+
+func TestExportSimplifiedContainer(t *testing.T) {
+	testCases := []struct {
+		args           []string
+		materialized   bool
+		expectPrefetch bool
+		expectSparse   bool
+	}{
+		{
+			args:           []string{"c1"},
+			expectPrefetch: true,
+		},
+		{
+			args:         []string{"c1"},
+			materialized: true,
+		},
+		{
+			args:         []string{"--sparse", "c1"},
+			expectSparse: true,
+		},
+	}
+	for _, tc := range testCases {
+		dir := fs.NewDir(t, "export-test")
+		defer dir.Remove()
+
+		var prefetched bool
+		cli := test.NewFakeCli(&fakeClient{
+			inspectFunc: func(container string) (types.ContainerJSON, error) {
+				return types.ContainerJSON{ContainerJSONBase: &types.ContainerJSONBase{Image: "sha256:slim"}}, nil
+			},
+			imageInspectFunc: func(image string) (types.ImageInspect, []byte, error) {
+				assert.Check(t, is.Equal(image, "sha256:slim"))
+				return types.ImageInspect{Simplified: types.ImageSimplified{Enabled: true, Materialized: tc.materialized}}, nil, nil
+			},
+			imagePrefetchFunc: func(image string, options types.ImagePrefetchOptions) (io.ReadCloser, error) {
+				prefetched = true
+				return ioutil.NopCloser(strings.NewReader(`{"status":"Prefetched 12 files, 3.4MB"}` + "\n")), nil
+			},
+			containerExportFunc: func(container string, options types.ContainerExportOptions) (io.ReadCloser, error) {
+				assert.Check(t, is.Equal(options.Sparse, tc.expectSparse))
+				return ioutil.NopCloser(strings.NewReader("rootfs")), nil
+			},
+		})
+		cmd := NewExportCommand(cli)
+		cmd.SetOutput(ioutil.Discard)
+		cmd.SetArgs(append(tc.args, "-o", dir.Join("rootfs.tar")))
+		assert.NilError(t, cmd.Execute())
+		assert.Check(t, is.Equal(prefetched, tc.expectPrefetch))
+		content, err := ioutil.ReadFile(dir.Join("rootfs.tar"))
+		assert.NilError(t, err)
+		assert.Check(t, is.Equal(string(content), "rootfs"))
+		if tc.expectPrefetch {
+			assert.Check(t, is.Equal(cli.ErrBuffer().String(), "Prefetched 12 files, 3.4MB\n"))
+		}
+	}
+}
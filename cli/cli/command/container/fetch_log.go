@@ -0,0 +1,66 @@
+package container
+
+import (
+	"context"
+
+	"github.com/docker/cli/cli"
+	"github.com/docker/cli/cli/command"
+	"github.com/docker/cli/cli/command/formatter"
+	"github.com/docker/docker/api/types"
+	"github.com/spf13/cobra"
+)
+
+// fetchLogPageSize is the number of fetches requested at a time.
+const fetchLogPageSize = 256
+
+type fetchLogOptions struct {
+	container string
+	format    string
+}
+
+// NewFetchLogCommand creates a new cobra.Command for `docker container fetch-log`
+func NewFetchLogCommand(dockerCli command.Cli) *cobra.Command {
+	var opts fetchLogOptions
+
+	cmd := &cobra.Command{
+		Use:   "fetch-log [OPTIONS] CONTAINER",
+		Short: "Show the files a container fetched on demand from its full image",
+		Args:  cli.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts.container = args[0]
+			return runFetchLog(dockerCli, opts)
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringVar(&opts.format, "format", "", "Pretty-print fetches using a Go template")
+	return cmd
+}
+
+func runFetchLog(dockerCli command.Cli, opts fetchLogOptions) error {
+	ctx := context.Background()
+
+	var fetches []types.SimplifyFetch
+	options := types.ContainerSimplifyFetchesOptions{Limit: fetchLogPageSize}
+	for {
+		page, err := dockerCli.Client().ContainerSimplifyFetches(ctx, opts.container, options)
+		if err != nil {
+			return err
+		}
+		fetches = append(fetches, page.Fetches...)
+		if !page.More || len(page.Fetches) == 0 {
+			break
+		}
+		options.After = page.Fetches[len(page.Fetches)-1].ID
+	}
+
+	format := opts.format
+	if len(format) == 0 {
+		format = formatter.TableFormatKey
+	}
+	fetchCtx := formatter.Context{
+		Output: dockerCli.Out(),
+		Format: formatter.NewSimplifyFetchFormat(format),
+	}
+	return formatter.SimplifyFetchWrite(fetchCtx, fetches)
+}
@@ -0,0 +1,51 @@
+package container
+
+import (
+	"fmt"
+	"io/ioutil"
+	"testing"
+
+	"github.com/docker/cli/internal/test"
+	"github.com/docker/docker/api/types"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+func TestFetchLogPages(t *testing.T) {
+	var requested []types.ContainerSimplifyFetchesOptions
+	cli := test.NewFakeCli(&fakeClient{
+		simplifyFetchesFunc: func(container string, options types.ContainerSimplifyFetchesOptions) (types.ContainerSimplifyFetches, error) {
+			assert.Check(t, is.Equal(container, "web"))
+			requested = append(requested, options)
+			// two pages, the second one short
+			var fetches types.ContainerSimplifyFetches
+			for id := options.After + 1; id <= 300 && len(fetches.Fetches) < options.Limit; id++ {
+				fetches.Fetches = append(fetches.Fetches, types.SimplifyFetch{ID: id, Path: fmt.Sprintf("/file%d", id), Outcome: "fetched"})
+			}
+			fetches.More = options.After+uint64(len(fetches.Fetches)) < 300
+			return fetches, nil
+		},
+	})
+	cmd := NewFetchLogCommand(cli)
+	cmd.SetArgs([]string{"--format", "{{.ID}}", "web"})
+	assert.NilError(t, cmd.Execute())
+	assert.Check(t, is.DeepEqual(requested, []types.ContainerSimplifyFetchesOptions{
+		{Limit: fetchLogPageSize},
+		{After: fetchLogPageSize, Limit: fetchLogPageSize},
+	}))
+	out := cli.OutBuffer().String()
+	assert.Check(t, is.Contains(out, "1\n2\n"))
+	assert.Check(t, is.Contains(out, "\n299\n300\n"))
+}
+
+func TestFetchLogError(t *testing.T) {
+	cli := test.NewFakeCli(&fakeClient{
+		simplifyFetchesFunc: func(container string, options types.ContainerSimplifyFetchesOptions) (types.ContainerSimplifyFetches, error) {
+			return types.ContainerSimplifyFetches{}, fmt.Errorf("no files were fetched on demand for container %s", container)
+		},
+	})
+	cmd := NewFetchLogCommand(cli)
+	cmd.SetOutput(ioutil.Discard)
+	cmd.SetArgs([]string{"web"})
+	assert.ErrorContains(t, cmd.Execute(), "no files were fetched on demand for container web")
+}
@@ -10,6 +10,7 @@ import (
 	"runtime"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/docker/cli/cli"
 	"github.com/docker/cli/cli/command"
@@ -29,8 +30,13 @@ type runOptions struct {
 	detach     bool
 	sigProxy   bool
 	detachKeys string
-	// 修改： 添加精简镜像选项
-	simp bool
+	// 修改： 添加记录访问文件、按需拉取超时、并发和离线启动选项
+	simpSet                      bool
+	simplifyRecord               bool
+	simplifyFetchTimeout         time.Duration
+	simplifyMaxConcurrentFetches int
+	simplifyOffline              bool
+	simplifyAudit                string
 	// 修改
 }
 
@@ -48,6 +54,9 @@ func NewRunCommand(dockerCli command.Cli) *cobra.Command {
 			if len(args) > 1 {
 				copts.Args = args[1:]
 			}
+			// 修改： 记录是否显式设置了--simplify-image
+			opts.simpSet = cmd.Flags().Changed("simplify-image")
+			// 修改
 			return runRun(dockerCli, cmd.Flags(), &opts, copts)
 		},
 	}
@@ -58,7 +67,18 @@ func NewRunCommand(dockerCli command.Cli) *cobra.Command {
 	// These are flags not stored in Config/HostConfig
 	flags.BoolVarP(&opts.detach, "detach", "d", false, "Run container in background and print container ID")
 	// 修改： 添加精简镜像选项
-	flags.BoolVarP(&opts.simp, "simplify-image", "s", false, "simplify image")
+	flags.BoolVarP(&opts.simp, "simplify-image", "s", false, "Start the container on a simplified image")
+	command.AddSimplifyOptionalFlag(flags, &opts.simplifyOptional)
+	flags.BoolVar(&opts.simplifyRecord, "simplify-record", false, "Record the files the container opens into a simplify profile")
+	flags.SetAnnotation("simplify-record", "ostype", []string{"linux"})
+	flags.DurationVar(&opts.simplifyFetchTimeout, "simplify-fetch-timeout", 0, "Timeout of fetching files missing from the simplified image (default as configured on the daemon)")
+	flags.SetAnnotation("simplify-fetch-timeout", "ostype", []string{"linux"})
+	flags.IntVar(&opts.simplifyMaxConcurrentFetches, "simplify-max-concurrent-fetches", 0, "Maximum number of files missing from the simplified image fetched at once (default as configured on the daemon)")
+	flags.SetAnnotation("simplify-max-concurrent-fetches", "ostype", []string{"linux"})
+	flags.BoolVar(&opts.simplifyOffline, "simplify-offline", false, "Start without fetching files missing from the simplified image, failing if files of its profile are missing")
+	flags.SetAnnotation("simplify-offline", "ostype", []string{"linux"})
+	flags.StringVar(&opts.simplifyAudit, "simplify-audit", "", "Run the full image, reporting the files opened that the simplify profile of this image would prune")
+	flags.SetAnnotation("simplify-audit", "ostype", []string{"linux"})
 	// 修改
 	flags.BoolVar(&opts.sigProxy, "sig-proxy", true, "Proxy received signals to the process")
 	flags.StringVar(&opts.name, "name", "", "Assign a name to the container")
@@ -132,6 +152,16 @@ func runContainer(dockerCli command.Cli, opts *runOptions, copts *containerOptio
 
 	warnOnOomKillDisable(*hostConfig, stderr)
 	warnOnLocalhostDNS(*hostConfig, stderr)
+	// 修改： 守护进程无法精简启动时提前警告，不支持精简镜像时失败或按--simplify-optional不精简
+	if opts.simp && opts.simplifyAudit != "" {
+		return errors.New("conflicting options: --simplify-audit runs the full image and cannot be used with --simplify-image")
+	}
+	simp, err := simplifyImageOption(context.Background(), dockerCli, opts.simpSet, opts.simp, opts.simplifyOptional)
+	if err != nil {
+		return err
+	}
+	opts.simp = simp != nil && *simp
+	// 修改
 
 	config.ArgsEscaped = false
 
@@ -204,15 +234,13 @@ func runContainer(dockerCli command.Cli, opts *runOptions, copts *containerOptio
 
 	statusChan := waitExitOrRemoved(ctx, dockerCli, createResponse.ID, copts.autoRemove)
 
-	// 修改： 添加对simplify-image的判断
-	// if opts.simp {
-	// 	fmt.Println("here")
-	// }
-	// 修改
-
 	//start the container
-	// 修改： 添加对Simp属性的赋值
-	if err := client.ContainerStart(ctx, createResponse.ID, types.ContainerStartOptions{Simp: opts.simp}); err != nil {
+	// 修改： 添加对Simp属性的赋值，与--rm、--detach、--restart同时使用时行为不变
+	startOptions := types.ContainerStartOptions{Simp: simp, SimplifyRecord: opts.simplifyRecord, SimplifyFetchTimeout: opts.simplifyFetchTimeout, SimplifyMaxConcurrentFetches: opts.simplifyMaxConcurrentFetches, SimplifyOffline: opts.simplifyOffline, SimplifyAudit: opts.simplifyAudit}
+	// 修改
+	if err := client.ContainerStart(ctx, createResponse.ID, startOptions); err != nil {
+		// 修改： 添加精简镜像错误提示
+		err = simplifyStartError(err)
 		// 修改
 		// If we have hijackedIOStreamer, we should notify
 		// hijackedIOStreamer we are going to exit and wait
@@ -7,6 +7,7 @@ import (
 
 	"github.com/docker/cli/internal/test"
 	"github.com/docker/cli/internal/test/notary"
+	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/network"
 	"gotest.tools/assert"
@@ -28,6 +29,35 @@ func TestRunLabel(t *testing.T) {
 	assert.NilError(t, cmd.Execute())
 }
 
+func TestRunSimplifyImage(t *testing.T) {
+	testCases := [][]string{
+		{"--simplify-image", "busybox"},
+		{"-s", "--rm", "busybox"},
+		{"-s", "--restart", "always", "busybox"},
+	}
+	for _, args := range testCases {
+		var startOptions types.ContainerStartOptions
+		cli := test.NewFakeCli(&fakeClient{
+			createContainerFunc: func(_ *container.Config, _ *container.HostConfig, _ *network.NetworkingConfig, _ string) (container.ContainerCreateCreatedBody, error) {
+				return container.ContainerCreateCreatedBody{
+					ID: "id",
+				}, nil
+			},
+			containerStartFunc: func(_ string, options types.ContainerStartOptions) error {
+				startOptions = options
+				return nil
+			},
+			Version: "1.36",
+		})
+		cmd := NewRunCommand(cli)
+		cmd.Flags().Set("detach", "true")
+		cmd.SetArgs(args)
+		assert.NilError(t, cmd.Execute())
+		assert.Assert(t, startOptions.Simp != nil, "args: %v", args)
+		assert.Check(t, *startOptions.Simp, "args: %v", args)
+	}
+}
+
 func TestRunCommandWithContentTrustErrors(t *testing.T) {
 	testCases := []struct {
 		name          string
@@ -6,6 +6,7 @@ import (
 	"io"
 	"net/http/httputil"
 	"strings"
+	"time"
 
 	"github.com/docker/cli/cli"
 	"github.com/docker/cli/cli/command"
@@ -20,7 +21,14 @@ type startOptions struct {
 	attach    bool
 	openStdin bool
 	// 修改： 添加simplify-image选项
-	simp bool
+	simp                         bool
+	simpSet                      bool
+	simplifyRecord               bool
+	simplifyFetchTimeout         time.Duration
+	simplifyMaxConcurrentFetches int
+	simplifyOffline              bool
+	simplifyAudit                string
+	simplifyOptional             bool
 	// 修改
 	detachKeys    string
 	checkpoint    string
@@ -39,6 +47,9 @@ func NewStartCommand(dockerCli command.Cli) *cobra.Command {
 		Args:  cli.RequiresMinArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			opts.containers = args
+			// 修改： 记录是否显式设置了--simplify-image
+			opts.simpSet = cmd.Flags().Changed("simplify-image")
+			// 修改
 			return runStart(dockerCli, &opts)
 		},
 	}
@@ -49,7 +60,18 @@ func NewStartCommand(dockerCli command.Cli) *cobra.Command {
 	flags.StringVar(&opts.detachKeys, "detach-keys", "", "Override the key sequence for detaching a container")
 
 	// 修改： 添加simplify-image选项
-	flags.BoolVarP(&opts.simp, "simplify-image", "s", false, "simplify image while using")
+	flags.BoolVarP(&opts.simp, "simplify-image", "s", false, "Start the container on a simplified image")
+	command.AddSimplifyOptionalFlag(flags, &opts.simplifyOptional)
+	flags.BoolVar(&opts.simplifyRecord, "simplify-record", false, "Record the files the container opens into a simplify profile")
+	flags.SetAnnotation("simplify-record", "ostype", []string{"linux"})
+	flags.DurationVar(&opts.simplifyFetchTimeout, "simplify-fetch-timeout", 0, "Timeout of fetching files missing from the simplified image (default as configured on the daemon)")
+	flags.SetAnnotation("simplify-fetch-timeout", "ostype", []string{"linux"})
+	flags.IntVar(&opts.simplifyMaxConcurrentFetches, "simplify-max-concurrent-fetches", 0, "Maximum number of files missing from the simplified image fetched at once (default as configured on the daemon)")
+	flags.SetAnnotation("simplify-max-concurrent-fetches", "ostype", []string{"linux"})
+	flags.BoolVar(&opts.simplifyOffline, "simplify-offline", false, "Start without fetching files missing from the simplified image, failing if files of its profile are missing")
+	flags.SetAnnotation("simplify-offline", "ostype", []string{"linux"})
+	flags.StringVar(&opts.simplifyAudit, "simplify-audit", "", "Run the full image, reporting the files opened that the simplify profile of this image would prune")
+	flags.SetAnnotation("simplify-audit", "ostype", []string{"linux"})
 	// 修改
 	flags.StringVar(&opts.checkpoint, "checkpoint", "", "Restore from this checkpoint")
 	flags.SetAnnotation("checkpoint", "experimental", nil)
@@ -65,6 +87,16 @@ func runStart(dockerCli command.Cli, opts *startOptions) error {
 	ctx, cancelFun := context.WithCancel(context.Background())
 	defer cancelFun()
 
+	// 修改： 守护进程无法精简启动时提前警告，不支持精简镜像时失败或按--simplify-optional不精简
+	if opts.simp && opts.simplifyAudit != "" {
+		return errors.New("conflicting options: --simplify-audit runs the full image and cannot be used with --simplify-image")
+	}
+	simp, err := simplifyImageOption(ctx, dockerCli, opts.simpSet, opts.simp, opts.simplifyOptional)
+	if err != nil {
+		return err
+	}
+	// 修改
+
 	if opts.attach || opts.openStdin {
 		// We're going to attach to a container.
 		// 1. Ensure we only have one container.
@@ -141,7 +173,12 @@ func runStart(dockerCli command.Cli, opts *startOptions) error {
 			CheckpointID:  opts.checkpoint,
 			CheckpointDir: opts.checkpointDir,
 			// 修改： 添加Simp属性
-			Simp: opts.simp,
+			Simp:                         simp,
+			SimplifyRecord:               opts.simplifyRecord,
+			SimplifyFetchTimeout:         opts.simplifyFetchTimeout,
+			SimplifyMaxConcurrentFetches: opts.simplifyMaxConcurrentFetches,
+			SimplifyOffline:              opts.simplifyOffline,
+			SimplifyAudit:                opts.simplifyAudit,
 			// 修改
 		}
 
@@ -153,7 +190,9 @@ func runStart(dockerCli command.Cli, opts *startOptions) error {
 				// wait container to be removed
 				<-statusChan
 			}
-			return err
+			// 修改： 添加精简镜像错误提示
+			return simplifyStartError(err)
+			// 修改
 		}
 
 		// 5. Wait for attachment to break.
@@ -182,29 +221,36 @@ func runStart(dockerCli command.Cli, opts *startOptions) error {
 			CheckpointID:  opts.checkpoint,
 			CheckpointDir: opts.checkpointDir,
 			// 修改： 添加Simp属性
-			Simp: opts.simp,
+			Simp:                         simp,
+			SimplifyRecord:               opts.simplifyRecord,
+			SimplifyFetchTimeout:         opts.simplifyFetchTimeout,
+			SimplifyMaxConcurrentFetches: opts.simplifyMaxConcurrentFetches,
+			SimplifyOffline:              opts.simplifyOffline,
+			SimplifyAudit:                opts.simplifyAudit,
 			// 修改
 		}
-		return dockerCli.Client().ContainerStart(ctx, container, startOptions)
+		// 修改： 添加精简镜像错误提示
+		return simplifyStartError(dockerCli.Client().ContainerStart(ctx, container, startOptions))
+		// 修改
 
 	} else {
 		// We're not going to attach to anything.
 		// Start as many containers as we want.
-		// 修改： 添加opts.simp参数
-		return startContainersWithoutAttachments(ctx, dockerCli, opts.containers, opts.simp)
+		// 修改： 传入精简镜像相关选项
+		return startContainersWithoutAttachments(ctx, dockerCli, opts.containers, types.ContainerStartOptions{Simp: simp, SimplifyRecord: opts.simplifyRecord, SimplifyFetchTimeout: opts.simplifyFetchTimeout, SimplifyMaxConcurrentFetches: opts.simplifyMaxConcurrentFetches, SimplifyOffline: opts.simplifyOffline, SimplifyAudit: opts.simplifyAudit})
 		// 修改
 	}
 
 	return nil
 }
 
-func startContainersWithoutAttachments(ctx context.Context, dockerCli command.Cli, containers []string, simp bool) error {
+func startContainersWithoutAttachments(ctx context.Context, dockerCli command.Cli, containers []string, startOptions types.ContainerStartOptions) error {
 	var failedContainers []string
 	for _, container := range containers {
-		// 修改： 添加simp的初始化
-		if err := dockerCli.Client().ContainerStart(ctx, container, types.ContainerStartOptions{Simp: simp}); err != nil {
+		// 修改： 添加精简镜像相关选项
+		if err := dockerCli.Client().ContainerStart(ctx, container, startOptions); err != nil {
 			// 修改
-			fmt.Fprintln(dockerCli.Err(), err)
+			fmt.Fprintln(dockerCli.Err(), simplifyStartError(err))
 			failedContainers = append(failedContainers, container)
 			continue
 		}
@@ -0,0 +1,248 @@
+package container
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/cli/internal/test"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/errdefs"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+func TestStartSimplifyImageMultipleContainers(t *testing.T) {
+	started := map[string]bool{}
+	cli := test.NewFakeCli(&fakeClient{
+		containerStartFunc: func(container string, options types.ContainerStartOptions) error {
+			if container == "c2" {
+				return fmt.Errorf("no such container: %s", container)
+			}
+			started[container] = options.Simp != nil && *options.Simp
+			return nil
+		},
+	})
+	cmd := NewStartCommand(cli)
+	cmd.SetOutput(ioutil.Discard)
+	cmd.SetArgs([]string{"-s", "c1", "c2", "c3"})
+	assert.ErrorContains(t, cmd.Execute(), "failed to start containers: c2")
+
+	assert.Check(t, is.DeepEqual(map[string]bool{"c1": true, "c3": true}, started))
+	assert.Check(t, is.Equal("c1\nc3\n", cli.OutBuffer().String()))
+	assert.Check(t, is.Contains(cli.ErrBuffer().String(), "no such container: c2"))
+}
+
+func TestStartSimplifyImageExplicit(t *testing.T) {
+	testCases := []struct {
+		args     []string
+		expected *bool
+	}{
+		{args: []string{"c1"}},
+		{args: []string{"--simplify-image=false", "c1"}, expected: boolPtr(false)},
+		{args: []string{"-s", "c1"}, expected: boolPtr(true)},
+	}
+	for _, tc := range testCases {
+		var started *types.ContainerStartOptions
+		cli := test.NewFakeCli(&fakeClient{
+			containerStartFunc: func(container string, options types.ContainerStartOptions) error {
+				started = &options
+				return nil
+			},
+		})
+		cmd := NewStartCommand(cli)
+		cmd.SetOutput(ioutil.Discard)
+		cmd.SetArgs(tc.args)
+		assert.NilError(t, cmd.Execute())
+		assert.Assert(t, started != nil)
+		assert.Check(t, is.DeepEqual(tc.expected, started.Simp), "args: %v", tc.args)
+	}
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+// codedError is an error response of the daemon with a code, as returned by
+// the client.
+type codedError struct {
+	msg  string
+	code string
+}
+
+func (e codedError) Error() string {
+	return e.msg
+}
+
+func (e codedError) ErrorCode() string {
+	return e.code
+}
+
+func TestStartSimplifyImageNotSimplified(t *testing.T) {
+	cli := test.NewFakeCli(&fakeClient{
+		containerStartFunc: func(container string, options types.ContainerStartOptions) error {
+			return errdefs.InvalidParameter(codedError{"Error response from daemon: image nginx:latest has no simplification data", types.ErrorCodeImageNotSimplified})
+		},
+	})
+	cmd := NewStartCommand(cli)
+	cmd.SetOutput(ioutil.Discard)
+	cmd.SetArgs([]string{"-s", "c1"})
+	assert.ErrorContains(t, cmd.Execute(), "failed to start containers: c1")
+	assert.Check(t, is.Contains(cli.ErrBuffer().String(), "image nginx:latest has no simplification data, re-pull with --simplify-image"))
+}
+
+func TestStartSimplifyDriverUnsupported(t *testing.T) {
+	cli := test.NewFakeCli(&fakeClient{
+		containerStartFunc: func(container string, options types.ContainerStartOptions) error {
+			return errdefs.NotImplemented(codedError{"Error response from daemon: storage driver vfs does not support simplified images (supported: overlay2)", types.ErrorCodeSimplifyNotSupported})
+		},
+	})
+	cmd := NewStartCommand(cli)
+	cmd.SetOutput(ioutil.Discard)
+	cmd.SetArgs([]string{"-s", "c1"})
+	assert.ErrorContains(t, cmd.Execute(), "failed to start containers: c1")
+	assert.Check(t, is.Contains(cli.ErrBuffer().String(), "storage driver vfs does not support simplified images (supported: overlay2): start the container without --simplify-image, or run the daemon with a supported --storage-driver"))
+}
+
+func TestStartSimplifyErrorWithoutCode(t *testing.T) {
+	// the message alone is not relied upon
+	cli := test.NewFakeCli(&fakeClient{
+		containerStartFunc: func(container string, options types.ContainerStartOptions) error {
+			return fmt.Errorf("Error response from daemon: image nginx:latest has no simplification data")
+		},
+	})
+	cmd := NewStartCommand(cli)
+	cmd.SetOutput(ioutil.Discard)
+	cmd.SetArgs([]string{"-s", "c1"})
+	assert.ErrorContains(t, cmd.Execute(), "failed to start containers: c1")
+	assert.Check(t, !strings.Contains(cli.ErrBuffer().String(), "re-pull"))
+}
+
+func TestStartSimplifyWindows(t *testing.T) {
+	cli := test.NewFakeCli(&fakeClient{
+		containerStartFunc: func(container string, options types.ContainerStartOptions) error {
+			return fmt.Errorf("Error response from daemon: image simplification is not supported on Windows")
+		},
+	})
+	cmd := NewStartCommand(cli)
+	cmd.SetOutput(ioutil.Discard)
+	cmd.SetArgs([]string{"-s", "c1"})
+	assert.ErrorContains(t, cmd.Execute(), "failed to start containers: c1")
+	assert.Check(t, is.Contains(cli.ErrBuffer().String(), "Error response from daemon: image simplification is not supported on Windows\n"))
+}
+
+func TestStartSimplifyUnsupported(t *testing.T) {
+	testCases := []struct {
+		simplify *types.SimplifyInfo
+		expected string
+	}{
+		{simplify: &types.SimplifyInfo{}},
+		{
+			simplify: &types.SimplifyInfo{Unsupported: "storage driver vfs does not support simplified images", FetchUnsupported: "overlay module has no fetch helper support"},
+			expected: "WARNING: the daemon cannot start containers on simplified images: storage driver vfs does not support simplified images\n",
+		},
+		{
+			simplify: &types.SimplifyInfo{FetchUnsupported: "overlay module has no fetch helper support"},
+			expected: "WARNING: files missing from simplified images will not be fetched on demand: overlay module has no fetch helper support\n",
+		},
+	}
+	for _, tc := range testCases {
+		cli := test.NewFakeCli(&fakeClient{
+			infoFunc: func() (types.Info, error) {
+				return types.Info{Simplify: tc.simplify}, nil
+			},
+		})
+		cmd := NewStartCommand(cli)
+		cmd.SetOutput(ioutil.Discard)
+		cmd.SetArgs([]string{"-s", "c1"})
+		assert.NilError(t, cmd.Execute())
+		assert.Check(t, is.Equal(cli.ErrBuffer().String(), tc.expected))
+	}
+
+	// the daemon is only asked when starting simplified
+	cli := test.NewFakeCli(&fakeClient{
+		infoFunc: func() (types.Info, error) {
+			return types.Info{Simplify: &types.SimplifyInfo{Unsupported: "storage driver vfs does not support simplified images"}}, nil
+		},
+	})
+	cmd := NewStartCommand(cli)
+	cmd.SetOutput(ioutil.Discard)
+	cmd.SetArgs([]string{"c1"})
+	assert.NilError(t, cmd.Execute())
+	assert.Check(t, is.Equal(cli.ErrBuffer().String(), ""))
+}
+
+func TestStartSimplifyOlderDaemon(t *testing.T) {
+	var started *types.ContainerStartOptions
+	cli := test.NewFakeCli(&fakeClient{
+		// daemons without simplification report nothing about it
+		infoFunc: func() (types.Info, error) {
+			return types.Info{}, nil
+		},
+		containerStartFunc: func(container string, options types.ContainerStartOptions) error {
+			started = &options
+			return nil
+		},
+	})
+	cmd := NewStartCommand(cli)
+	cmd.SetOutput(ioutil.Discard)
+	cmd.SetArgs([]string{"-s", "c1"})
+	assert.ErrorContains(t, cmd.Execute(), "the daemon does not support simplified images")
+	assert.Check(t, started == nil)
+
+	cmd = NewStartCommand(cli)
+	cmd.SetOutput(ioutil.Discard)
+	cmd.SetArgs([]string{"-s", "--simplify-optional", "c1"})
+	assert.NilError(t, cmd.Execute())
+	assert.Assert(t, started != nil)
+	assert.Check(t, started.Simp == nil)
+	assert.Check(t, is.Equal(cli.ErrBuffer().String(), "WARNING: the daemon does not support simplified images, going ahead without simplification\n"))
+}
+
+func TestStartSimplifyFetchOptions(t *testing.T) {
+	var started types.ContainerStartOptions
+	cli := test.NewFakeCli(&fakeClient{
+		containerStartFunc: func(container string, options types.ContainerStartOptions) error {
+			started = options
+			return nil
+		},
+	})
+	cmd := NewStartCommand(cli)
+	cmd.SetOutput(ioutil.Discard)
+	cmd.SetArgs([]string{"-s", "--simplify-fetch-timeout", "500ms", "c1"})
+	assert.NilError(t, cmd.Execute())
+	assert.Check(t, is.Equal(started.SimplifyFetchTimeout, 500*time.Millisecond))
+	assert.Check(t, !started.SimplifyOffline)
+
+	cmd = NewStartCommand(cli)
+	cmd.SetOutput(ioutil.Discard)
+	cmd.SetArgs([]string{"-s", "--simplify-offline", "c1"})
+	assert.NilError(t, cmd.Execute())
+	assert.Check(t, started.SimplifyOffline)
+}
+
+func TestStartSimplifyAudit(t *testing.T) {
+	var started *types.ContainerStartOptions
+	cli := test.NewFakeCli(&fakeClient{
+		containerStartFunc: func(container string, options types.ContainerStartOptions) error {
+			started = &options
+			return nil
+		},
+	})
+	cmd := NewStartCommand(cli)
+	cmd.SetOutput(ioutil.Discard)
+	cmd.SetArgs([]string{"--simplify-audit", "app:latest", "c1"})
+	assert.NilError(t, cmd.Execute())
+	assert.Assert(t, started != nil)
+	assert.Check(t, is.Equal(started.SimplifyAudit, "app:latest"))
+	assert.Check(t, started.Simp == nil)
+
+	started = nil
+	cmd = NewStartCommand(cli)
+	cmd.SetOutput(ioutil.Discard)
+	cmd.SetArgs([]string{"-s", "--simplify-audit", "app:latest", "c1"})
+	assert.ErrorContains(t, cmd.Execute(), "conflicting options: --simplify-audit runs the full image and cannot be used with --simplify-image")
+	assert.Check(t, started == nil)
+}
@@ -115,6 +115,16 @@ func collect(ctx context.Context, s *formatter.ContainerStats, cli client.APICli
 				mem = float64(v.MemoryStats.PrivateWorkingSet)
 			}
 			netRx, netTx := calculateNetwork(v.Networks)
+			// 修改： 精简模式下按需拉取的文件
+			var (
+				simplifyFetches      *uint64
+				simplifyFetchedBytes float64
+			)
+			if v.SimplifyStats != nil {
+				simplifyFetches = &v.SimplifyStats.Fetches
+				simplifyFetchedBytes = float64(v.SimplifyStats.FetchedBytes)
+			}
+			// 修改
 			s.SetStatistics(formatter.StatsEntry{
 				Name:             v.Name,
 				ID:               v.ID,
@@ -127,6 +137,10 @@ func collect(ctx context.Context, s *formatter.ContainerStats, cli client.APICli
 				BlockRead:        float64(blkRead),
 				BlockWrite:       float64(blkWrite),
 				PidsCurrent:      pidsStatsCurrent,
+				// 修改： 精简模式下按需拉取的文件
+				SimplifyFetches:      simplifyFetches,
+				SimplifyFetchedBytes: simplifyFetchedBytes,
+				// 修改
 			})
 			u <- nil
 			if !streamStats {
@@ -2,7 +2,9 @@ package container
 
 import (
 	"context"
+	"fmt"
 	"strconv"
+	"strings"
 
 	"github.com/docker/cli/cli/command"
 	"github.com/docker/docker/api/types"
@@ -10,9 +12,69 @@ import (
 	"github.com/docker/docker/api/types/events"
 	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/api/types/versions"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
 
+// 修改： 为精简镜像相关的启动错误添加提示
+// simplifyStartError adds an actionable hint to the error returned by the
+// daemon when a container is started in simplified mode from an image that
+// has no simplification data, or on a storage driver that cannot mount
+// simplified images.
+func simplifyStartError(err error) error {
+	if err == nil {
+		return err
+	}
+	msg := strings.TrimSuffix(err.Error(), ".")
+	switch code := client.ErrorCode(err); {
+	case errdefs.IsInvalidParameter(err) && code == types.ErrorCodeImageNotSimplified:
+		return errors.Errorf("%s, re-pull with --simplify-image", msg)
+	case errdefs.IsNotImplemented(err) && code == types.ErrorCodeSimplifyNotSupported:
+		return errors.Errorf("%s: start the container without --simplify-image, or run the daemon with a supported --storage-driver", msg)
+	}
+	return err
+}
+
+// checkSimplifySupport checks that the daemon supports simplified images,
+// for a container started with -s, as command.SimplifySupport does, and
+// returns false if it should start without simplification instead. It warns
+// if the daemon reports it cannot start containers on simplified images, or
+// fetch the files pruned from them on demand.
+func checkSimplifySupport(ctx context.Context, dockerCli command.Cli, optional bool) (bool, error) {
+	simp, err := command.SimplifySupport(ctx, dockerCli, optional)
+	if err != nil || simp == nil {
+		return false, err
+	}
+	if simp.Unsupported != "" {
+		fmt.Fprintf(dockerCli.Err(), "WARNING: the daemon cannot start containers on simplified images: %s\n", simp.Unsupported)
+	} else if simp.FetchUnsupported != "" {
+		fmt.Fprintf(dockerCli.Err(), "WARNING: files missing from simplified images will not be fetched on demand: %s\n", simp.FetchUnsupported)
+	}
+	return true, nil
+}
+
+// simplifyImageOption returns the simplify-image option a container is
+// started with, checking the daemon as checkSimplifySupport does for -s. It
+// is nil, leaving it to the daemon, if --simplify-image was not set or the
+// container starts without simplification as the daemon does not support it,
+// so that --simplify-image=false is sent to the daemon as false.
+func simplifyImageOption(ctx context.Context, dockerCli command.Cli, set, simp, optional bool) (*bool, error) {
+	if !set {
+		return nil, nil
+	}
+	if simp {
+		supported, err := checkSimplifySupport(ctx, dockerCli, optional)
+		if err != nil || !supported {
+			return nil, err
+		}
+	}
+	return &simp, nil
+}
+
+// 修改
+
 func waitExitOrRemoved(ctx context.Context, dockerCli command.Cli, containerID string, waitRemove bool) <-chan int {
 	if len(containerID) == 0 {
 		// containerID can never be empty
@@ -12,7 +12,7 @@ import (
 )
 
 const (
-	defaultDiskUsageImageTableFormat     = "table {{.Repository}}\t{{.Tag}}\t{{.ID}}\t{{.CreatedSince}} ago\t{{.VirtualSize}}\t{{.SharedSize}}\t{{.UniqueSize}}\t{{.Containers}}"
+	defaultDiskUsageImageTableFormat     = "table {{.Repository}}\t{{.Tag}}\t{{.ID}}\t{{.CreatedSince}} ago\t{{.VirtualSize}}\t{{.SharedSize}}\t{{.UniqueSize}}\t{{.SimplifySaved}}\t{{.Containers}}"
 	defaultDiskUsageContainerTableFormat = "table {{.ID}}\t{{.Image}}\t{{.Command}}\t{{.LocalVolumes}}\t{{.Size}}\t{{.RunningFor}} ago\t{{.Status}}\t{{.Names}}"
 	defaultDiskUsageVolumeTableFormat    = "table {{.Name}}\t{{.Links}}\t{{.Size}}"
 	defaultDiskUsageTableFormat          = "table {{.Type}}\t{{.TotalCount}}\t{{.Active}}\t{{.Size}}\t{{.Reclaimable}}"
@@ -33,6 +33,9 @@ UsageCount: {{.UsageCount}}
 	containersHeader  = "CONTAINERS"
 	sharedSizeHeader  = "SHARED SIZE"
 	uniqueSizeHeader  = "UNIQUE SiZE"
+	// 修改： 精简镜像节省的空间
+	simplifySavedHeader = "SIMPLIFY SAVED"
+	// 修改
 )
 
 // DiskUsageContext contains disk usage specific information required by the formatter, encapsulate a Context struct.
@@ -45,6 +48,9 @@ type DiskUsageContext struct {
 	Volumes     []*types.Volume
 	BuildCache  []*types.BuildCache
 	BuilderSize int64
+	// 修改： 精简镜像节省的空间
+	SimplifiedReclaimed int64
+	// 修改
 }
 
 func (ctx *DiskUsageContext) startSubsection(format string) (*template.Template, error) {
@@ -56,7 +62,6 @@ func (ctx *DiskUsageContext) startSubsection(format string) (*template.Template,
 	return ctx.parseFormat()
 }
 
-//
 // NewDiskUsageFormat returns a format for rendering an DiskUsageContext
 func NewDiskUsageFormat(source string) Format {
 	switch source {
@@ -126,6 +131,12 @@ func (ctx *DiskUsageContext) Write() (err error) {
 	}
 	ctx.postFormat(tmpl, &diskUsageContainersCtx)
 
+	// 修改： 汇总精简镜像节省的空间
+	if ctx.Format.IsTable() && ctx.SimplifiedReclaimed > 0 {
+		fmt.Fprintf(ctx.Output, "\nReclaimed by simplification: %s\n", units.HumanSize(float64(ctx.SimplifiedReclaimed)))
+	}
+	// 修改
+
 	return err
 }
 
@@ -164,6 +175,12 @@ func (ctx *DiskUsageContext) verboseWrite() error {
 	}
 	ctx.postFormat(tmpl, newImageContext())
 
+	// 修改： 汇总精简镜像节省的空间
+	if ctx.SimplifiedReclaimed > 0 {
+		fmt.Fprintf(ctx.Output, "\nReclaimed by simplification: %s\n", units.HumanSize(float64(ctx.SimplifiedReclaimed)))
+	}
+	// 修改
+
 	// Now containers
 	ctx.Output.Write([]byte("\nContainers space usage:\n\n"))
 	tmpl, err = ctx.startSubsection(defaultDiskUsageContainerTableFormat)
@@ -32,7 +32,7 @@ Build Cache         0                   0                   0B
 			DiskUsageContext{Verbose: true},
 			`Images space usage:
 
-REPOSITORY          TAG                 IMAGE ID            CREATED ago         SIZE                SHARED SIZE         UNIQUE SiZE         CONTAINERS
+REPOSITORY          TAG                 IMAGE ID            CREATED ago         SIZE                SHARED SIZE         UNIQUE SiZE         SIMPLIFY SAVED      CONTAINERS
 
 Containers space usage:
 
@@ -44,6 +44,23 @@ VOLUME NAME         LINKS               SIZE
 
 Build cache usage: 0B
 
+`,
+		},
+		// Space saved by simplified images
+		{
+			DiskUsageContext{
+				Context: Context{
+					Format: NewDiskUsageFormat("table"),
+				},
+				SimplifiedReclaimed: 20000,
+			},
+			`TYPE                TOTAL               ACTIVE              SIZE                RECLAIMABLE
+Images              0                   0                   0B                  0B
+Containers          0                   0                   0B                  0B
+Local Volumes       0                   0                   0B                  0B
+Build Cache         0                   0                   0B                  0B
+
+Reclaimed by simplification: 20kB
 `,
 		},
 		// Errors
@@ -13,21 +13,33 @@ import (
 const (
 	defaultHistoryTableFormat  = "table {{.ID}}\t{{.CreatedSince}}\t{{.CreatedBy}}\t{{.Size}}\t{{.Comment}}"
 	nonHumanHistoryTableFormat = "table {{.ID}}\t{{.CreatedAt}}\t{{.CreatedBy}}\t{{.Size}}\t{{.Comment}}"
+	// 修改： 精简镜像的层
+	simplifyHistoryTableFormat         = "table {{.ID}}\t{{.CreatedSince}}\t{{.CreatedBy}}\t{{.Size}}\t{{.FullSize}}\t{{.Simplified}}\t{{.Comment}}"
+	nonHumanSimplifyHistoryTableFormat = "table {{.ID}}\t{{.CreatedAt}}\t{{.CreatedBy}}\t{{.Size}}\t{{.FullSize}}\t{{.Simplified}}\t{{.Comment}}"
+	// 修改
 
 	historyIDHeader = "IMAGE"
 	createdByHeader = "CREATED BY"
 	commentHeader   = "COMMENT"
+	// 修改
+	fullSizeHeader = "FULL SIZE"
+	// 修改
 )
 
-// NewHistoryFormat returns a format for rendering an HistoryContext
-func NewHistoryFormat(source string, quiet bool, human bool) Format {
+// NewHistoryFormat returns a format for rendering an HistoryContext. With
+// simplify, the table shows the layers rewritten by simplification.
+func NewHistoryFormat(source string, quiet bool, human bool, simplify bool) Format {
 	switch source {
 	case TableFormatKey:
 		switch {
 		case quiet:
 			return defaultQuietFormat
+		case !human && simplify:
+			return nonHumanSimplifyHistoryTableFormat
 		case !human:
 			return nonHumanHistoryTableFormat
+		case simplify:
+			return simplifyHistoryTableFormat
 		default:
 			return defaultHistoryTableFormat
 		}
@@ -55,6 +67,10 @@ func HistoryWrite(ctx Context, human bool, histories []image.HistoryResponseItem
 		"CreatedBy":    createdByHeader,
 		"Size":         sizeHeader,
 		"Comment":      commentHeader,
+		// 修改
+		"FullSize":   fullSizeHeader,
+		"Simplified": simplifiedHeader,
+		// 修改
 	}
 	return ctx.Write(historyCtx, render)
 }
@@ -107,3 +123,27 @@ func (c *historyContext) Size() string {
 func (c *historyContext) Comment() string {
 	return c.h.Comment
 }
+
+// 修改： FullSize returns the size of the layer of the full image a layer
+// rewritten by simplification was derived from, or its size if it was not
+// rewritten.
+func (c *historyContext) FullSize() string {
+	size := c.h.Size
+	if c.h.Simplified {
+		if c.h.FullSize == 0 {
+			return "N/A"
+		}
+		size = c.h.FullSize
+	}
+	if c.human {
+		return units.HumanSizeWithPrecision(float64(size), 3)
+	}
+	return strconv.FormatInt(size, 10)
+}
+
+// Simplified reports whether the layer was rewritten by simplification.
+func (c *historyContext) Simplified() string {
+	return strconv.FormatBool(c.h.Simplified)
+}
+
+// 修改
@@ -202,14 +202,14 @@ imageID4            24 hours ago        /bin/bash grep
 		expected string
 	}{
 		{Context{
-			Format: NewHistoryFormat("table", false, true),
+			Format: NewHistoryFormat("table", false, true, false),
 			Trunc:  true,
 			Output: out,
 		},
 			expectedTrunc,
 		},
 		{Context{
-			Format: NewHistoryFormat("table", false, true),
+			Format: NewHistoryFormat("table", false, true, false),
 			Trunc:  false,
 			Output: out,
 		},
@@ -224,3 +224,21 @@ imageID4            24 hours ago        /bin/bash grep
 		out.Reset()
 	}
 }
+
+func TestHistoryContext_SimplifyTable(t *testing.T) {
+	out := bytes.NewBufferString("")
+	unixTime := time.Now().AddDate(0, 0, -1).Unix()
+	histories := []image.HistoryResponseItem{
+		{ID: "imageID1", Created: unixTime, CreatedBy: "/bin/sh -c apt-get install", Size: int64(2048000), Simplified: true, FullSize: int64(182964289)},
+		{ID: "imageID1", Created: unixTime, CreatedBy: "/bin/sh -c #(nop) COPY", Size: int64(1024000), Simplified: true},
+		{ID: "imageID1", Created: unixTime, CreatedBy: "/bin/sh -c #(nop) ADD", Size: int64(5120000)},
+	}
+	expected := `IMAGE               CREATED             CREATED BY                   SIZE                FULL SIZE           SIMPLIFIED          COMMENT
+imageID1            24 hours ago        /bin/sh -c apt-get install   2.05MB              183MB               true                
+imageID1            24 hours ago        /bin/sh -c #(nop) COPY       1.02MB              N/A                 true                
+imageID1            24 hours ago        /bin/sh -c #(nop) ADD        5.12MB              5.12MB              false               
+`
+	err := HistoryWrite(Context{Format: NewHistoryFormat("table", false, true, true), Output: out}, true, histories)
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(expected, out.String()))
+}
@@ -18,6 +18,9 @@ const (
 	repositoryHeader = "REPOSITORY"
 	tagHeader        = "TAG"
 	digestHeader     = "DIGEST"
+	// 修改： 添加精简镜像列
+	simplifiedHeader = "SIMPLIFIED"
+	// 修改
 )
 
 // ImageContext contains image specific information required by the formatter, encapsulate a Context struct.
@@ -195,17 +198,19 @@ type imageContext struct {
 func newImageContext() *imageContext {
 	imageCtx := imageContext{}
 	imageCtx.header = map[string]string{
-		"ID":           imageIDHeader,
-		"Repository":   repositoryHeader,
-		"Tag":          tagHeader,
-		"Digest":       digestHeader,
-		"CreatedSince": createdSinceHeader,
-		"CreatedAt":    createdAtHeader,
-		"Size":         sizeHeader,
-		"Containers":   containersHeader,
-		"VirtualSize":  sizeHeader,
-		"SharedSize":   sharedSizeHeader,
-		"UniqueSize":   uniqueSizeHeader,
+		"ID":            imageIDHeader,
+		"Repository":    repositoryHeader,
+		"Tag":           tagHeader,
+		"Digest":        digestHeader,
+		"CreatedSince":  createdSinceHeader,
+		"CreatedAt":     createdAtHeader,
+		"Size":          sizeHeader,
+		"Containers":    containersHeader,
+		"VirtualSize":   sizeHeader,
+		"SharedSize":    sharedSizeHeader,
+		"UniqueSize":    uniqueSizeHeader,
+		"Simplified":    simplifiedHeader,
+		"SimplifySaved": simplifySavedHeader,
 	}
 	return &imageCtx
 }
@@ -270,3 +275,24 @@ func (c *imageContext) UniqueSize() string {
 	}
 	return units.HumanSize(float64(c.i.VirtualSize - c.i.SharedSize))
 }
+
+// 修改： Simplified reports whether the image was pulled or committed with
+// simplification enabled.
+func (c *imageContext) Simplified() string {
+	return fmt.Sprintf("%t", c.i.Simplified)
+}
+
+// SimplifySaved returns the space a simplified image saves compared to the
+// full image it was derived from. It is only known for disk usage.
+func (c *imageContext) SimplifySaved() string {
+	if !c.i.Simplified || c.i.FullSize == 0 {
+		return "N/A"
+	}
+	saved := c.i.FullSize - c.i.MaterializedSize
+	if saved < 0 {
+		saved = 0
+	}
+	return units.HumanSize(float64(saved))
+}
+
+// 修改
@@ -0,0 +1,110 @@
+package formatter
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/pkg/stringid"
+	units "github.com/docker/go-units"
+)
+
+const (
+	defaultImageProfileTableFormat = "table {{.ID}}\t{{.Reference}}\t{{.Platform}}\t{{.Files}}\t{{.Runs}}\t{{.CreatedSince}}\t{{.Stale}}"
+
+	referenceHeader = "REFERENCE"
+	platformHeader  = "PLATFORM"
+	filesHeader     = "FILES"
+	runsHeader      = "RUNS"
+	staleHeader     = "STALE"
+)
+
+// NewImageProfileFormat returns a format for use with an image profile Context
+func NewImageProfileFormat(source string, quiet bool) Format {
+	switch source {
+	case TableFormatKey:
+		if quiet {
+			return defaultQuietFormat
+		}
+		return defaultImageProfileTableFormat
+	case RawFormatKey:
+		if quiet {
+			return `image_id: {{.ID}}`
+		}
+		return `image_id: {{.ID}}\nreference: {{.Reference}}\nplatform: {{.Platform}}\nfiles: {{.Files}}\nruns: {{.Runs}}\ncreated_at: {{.CreatedAt}}\nstale: {{.Stale}}\n`
+	}
+	return Format(source)
+}
+
+// ImageProfileWrite writes formatted image profiles using the Context
+func ImageProfileWrite(ctx Context, profiles []types.ImageProfileSummary, trunc bool) error {
+	render := func(format func(subContext subContext) error) error {
+		for _, profile := range profiles {
+			if err := format(&imageProfileContext{p: profile, trunc: trunc}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	profileCtx := imageProfileContext{}
+	profileCtx.header = map[string]string{
+		"ID":           imageIDHeader,
+		"Reference":    referenceHeader,
+		"Platform":     platformHeader,
+		"Files":        filesHeader,
+		"Runs":         runsHeader,
+		"CreatedSince": createdSinceHeader,
+		"CreatedAt":    createdAtHeader,
+		"Stale":        staleHeader,
+	}
+	return ctx.Write(&profileCtx, render)
+}
+
+type imageProfileContext struct {
+	HeaderContext
+	trunc bool
+	p     types.ImageProfileSummary
+}
+
+func (c *imageProfileContext) MarshalJSON() ([]byte, error) {
+	return marshalJSON(c)
+}
+
+func (c *imageProfileContext) ID() string {
+	if c.trunc {
+		return stringid.TruncateID(c.p.Image)
+	}
+	return c.p.Image
+}
+
+func (c *imageProfileContext) Reference() string {
+	return c.p.Reference
+}
+
+func (c *imageProfileContext) Platform() string {
+	return c.p.Platform
+}
+
+func (c *imageProfileContext) Files() string {
+	return strconv.Itoa(c.p.Files)
+}
+
+func (c *imageProfileContext) Runs() string {
+	return strconv.Itoa(c.p.Runs)
+}
+
+func (c *imageProfileContext) CreatedSince() string {
+	created, err := time.Parse(time.RFC3339Nano, c.p.Created)
+	if err != nil {
+		return ""
+	}
+	return units.HumanDuration(time.Now().UTC().Sub(created)) + " ago"
+}
+
+func (c *imageProfileContext) CreatedAt() string {
+	return c.p.Created
+}
+
+func (c *imageProfileContext) Stale() string {
+	return strconv.FormatBool(c.p.Stale)
+}
@@ -0,0 +1,55 @@
+package formatter
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"gotest.tools/assert"
+)
+
+func TestImageProfileContextFormatWrite(t *testing.T) {
+	cases := []struct {
+		context  Context
+		expected string
+	}{
+		{
+			Context{Format: NewImageProfileFormat("table {{.ID}}\t{{.Reference}}\t{{.Files}}\t{{.Stale}}", false)},
+			`IMAGE ID            REFERENCE           FILES               STALE
+0123456789ab        app:latest          12                  false
+ba9876543210                            3                   true
+`,
+		},
+		{
+			Context{Format: NewImageProfileFormat("table {{.ID}}\t{{.Platform}}", false)},
+			`IMAGE ID            PLATFORM
+0123456789ab        linux/arm64
+ba9876543210        
+`,
+		},
+		{
+			Context{Format: NewImageProfileFormat(TableFormatKey, true)},
+			`0123456789ab
+ba9876543210
+`,
+		},
+		{
+			Context{Format: NewImageProfileFormat(RawFormatKey, true)},
+			`image_id: 0123456789ab
+image_id: ba9876543210
+`,
+		},
+	}
+
+	profiles := []types.ImageProfileSummary{
+		{Image: "sha256:0123456789abcdef", Reference: "app:latest", Platform: "linux/arm64", Files: 12},
+		{Image: "sha256:ba9876543210fedc", Files: 3, Stale: true},
+	}
+	for _, testcase := range cases {
+		out := bytes.NewBufferString("")
+		testcase.context.Output = out
+		err := ImageProfileWrite(testcase.context, profiles, true)
+		assert.NilError(t, err)
+		assert.Equal(t, out.String(), testcase.expected)
+	}
+}
@@ -76,6 +76,21 @@ func TestImageContext(t *testing.T) {
 				i: types.ImageSummary{SharedSize: 5000, VirtualSize: 20000},
 			}, "15kB", ctx.UniqueSize,
 		},
+		{
+			imageContext{
+				i: types.ImageSummary{Simplified: true},
+			}, "true", ctx.Simplified,
+		},
+		{
+			imageContext{
+				i: types.ImageSummary{Simplified: true, FullSize: 30000, MaterializedSize: 10000},
+			}, "20kB", ctx.SimplifySaved,
+		},
+		{
+			imageContext{
+				i: types.ImageSummary{FullSize: 30000},
+			}, "N/A", ctx.SimplifySaved,
+		},
 	}
 
 	for _, c := range cases {
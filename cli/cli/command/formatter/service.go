@@ -88,6 +88,9 @@ ContainerSpec:
 {{- if .HasContainerInit }}
  Init:		{{ .ContainerInit }}
 {{- end -}}
+{{- if .ContainerSimplify }}
+ Simplify:	{{ .ContainerSimplify }}
+{{- end -}}
 {{- if .ContainerUser }}
  User: {{ .ContainerUser }}
 {{- end }}
@@ -383,6 +386,13 @@ func (ctx *serviceInspectContext) ContainerInit() bool {
 	return *ctx.Service.Spec.TaskTemplate.ContainerSpec.Init
 }
 
+// 修改： 显示服务容器是否以精简模式启动
+func (ctx *serviceInspectContext) ContainerSimplify() bool {
+	return ctx.Service.Spec.TaskTemplate.ContainerSpec.Simplify
+}
+
+// 修改
+
 func (ctx *serviceInspectContext) ContainerMounts() []mounttypes.Mount {
 	return ctx.Service.Spec.TaskTemplate.ContainerSpec.Mounts
 }
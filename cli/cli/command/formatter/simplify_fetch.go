@@ -0,0 +1,98 @@
+package formatter
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	units "github.com/docker/go-units"
+)
+
+const (
+	defaultSimplifyFetchTableFormat = "table {{.Time}}\t{{.Path}}\t{{.Size}}\t{{.Latency}}\t{{.Source}}\t{{.Outcome}}"
+
+	fetchIDHeader = "ID"
+	timeHeader    = "TIME"
+	latencyHeader = "LATENCY"
+	sourceHeader  = "SOURCE"
+	outcomeHeader = "OUTCOME"
+)
+
+// NewSimplifyFetchFormat returns a format for use with a simplify fetch Context
+func NewSimplifyFetchFormat(source string) Format {
+	switch source {
+	case TableFormatKey:
+		return defaultSimplifyFetchTableFormat
+	case RawFormatKey:
+		return `id: {{.ID}}\ntime: {{.Time}}\npath: {{.Path}}\nsize: {{.Size}}\nlatency: {{.Latency}}\nsource: {{.Source}}\noutcome: {{.Outcome}}\nerror: {{.Error}}\n`
+	}
+	return Format(source)
+}
+
+// SimplifyFetchWrite writes formatted files fetched on demand using the Context
+func SimplifyFetchWrite(ctx Context, fetches []types.SimplifyFetch) error {
+	render := func(format func(subContext subContext) error) error {
+		for _, fetch := range fetches {
+			if err := format(&simplifyFetchContext{f: fetch}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	fetchCtx := simplifyFetchContext{}
+	fetchCtx.header = map[string]string{
+		"ID":      fetchIDHeader,
+		"Time":    timeHeader,
+		"Path":    pathHeader,
+		"Size":    sizeHeader,
+		"Latency": latencyHeader,
+		"Source":  sourceHeader,
+		"Outcome": outcomeHeader,
+		"Error":   errorHeader,
+	}
+	return ctx.Write(&fetchCtx, render)
+}
+
+type simplifyFetchContext struct {
+	HeaderContext
+	f types.SimplifyFetch
+}
+
+func (c *simplifyFetchContext) MarshalJSON() ([]byte, error) {
+	return marshalJSON(c)
+}
+
+func (c *simplifyFetchContext) ID() string {
+	return strconv.FormatUint(c.f.ID, 10)
+}
+
+func (c *simplifyFetchContext) Time() string {
+	return c.f.Time.Local().Format(time.RFC3339Nano)
+}
+
+func (c *simplifyFetchContext) Path() string {
+	return c.f.Path
+}
+
+func (c *simplifyFetchContext) Size() string {
+	if c.f.Outcome != "fetched" {
+		return ""
+	}
+	return units.HumanSizeWithPrecision(float64(c.f.Size), 3)
+}
+
+func (c *simplifyFetchContext) Latency() string {
+	return c.f.Latency.Round(time.Microsecond).String()
+}
+
+func (c *simplifyFetchContext) Source() string {
+	return c.f.Source
+}
+
+func (c *simplifyFetchContext) Outcome() string {
+	return c.f.Outcome
+}
+
+func (c *simplifyFetchContext) Error() string {
+	return c.f.Error
+}
@@ -0,0 +1,44 @@
+package formatter
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"gotest.tools/assert"
+)
+
+func TestSimplifyFetchContextFormatWrite(t *testing.T) {
+	fetches := []types.SimplifyFetch{
+		{ID: 1, Path: "/etc/nginx/mime.types", Size: 5231, Latency: 48213456 * time.Nanosecond, Source: "image", Outcome: "fetched"},
+		{ID: 2, Path: "/etc/nginx/missing", Latency: 1500 * time.Nanosecond, Outcome: "not-found"},
+		{ID: 3, Path: "/usr/lib/libssl.so", Latency: 30 * time.Second, Outcome: "failed", Error: "giving up after 5 attempts"},
+	}
+	cases := []struct {
+		context  Context
+		expected string
+	}{
+		{
+			Context{Format: NewSimplifyFetchFormat("table {{.ID}}\t{{.Path}}\t{{.Size}}\t{{.Latency}}\t{{.Source}}\t{{.Outcome}}")},
+			`ID                  PATH                    SIZE                LATENCY             SOURCE              OUTCOME
+1                   /etc/nginx/mime.types   5.23kB              48.213ms            image               fetched
+2                   /etc/nginx/missing                          2µs                                     not-found
+3                   /usr/lib/libssl.so                          30s                                     failed
+`,
+		},
+		{
+			Context{Format: NewSimplifyFetchFormat("{{.Path}}: {{.Error}}")},
+			`/etc/nginx/mime.types: 
+/etc/nginx/missing: 
+/usr/lib/libssl.so: giving up after 5 attempts
+`,
+		},
+	}
+	for _, testcase := range cases {
+		out := bytes.NewBufferString("")
+		testcase.context.Output = out
+		assert.NilError(t, SimplifyFetchWrite(testcase.context, fetches))
+		assert.Equal(t, out.String(), testcase.expected)
+	}
+}
@@ -21,6 +21,9 @@ const (
 	winMemUseHeader = "PRIV WORKING SET"  // Used only on Windows
 	memUseHeader    = "MEM USAGE / LIMIT" // Used only on Linux
 	pidsHeader      = "PIDS"              // Used only on Linux
+	// 修改： 精简模式下按需拉取的文件
+	simplifyFetchHeader = "FETCHED"
+	// 修改
 )
 
 // StatsEntry represents represents the statistics data collected from a container
@@ -37,7 +40,11 @@ type StatsEntry struct {
 	BlockRead        float64
 	BlockWrite       float64
 	PidsCurrent      uint64 // Not used on Windows
-	IsInvalid        bool
+	// 修改： 精简模式下按需拉取的文件，未按需拉取的容器为nil
+	SimplifyFetches      *uint64
+	SimplifyFetchedBytes float64
+	// 修改
+	IsInvalid bool
 }
 
 // ContainerStats represents an entity to store containers statistics synchronously
@@ -69,6 +76,10 @@ func (cs *ContainerStats) SetErrorAndReset(err error) {
 	cs.BlockRead = 0
 	cs.BlockWrite = 0
 	cs.PidsCurrent = 0
+	// 修改： 精简模式下按需拉取的文件
+	cs.SimplifyFetches = nil
+	cs.SimplifyFetchedBytes = 0
+	// 修改
 	cs.err = err
 	cs.IsInvalid = true
 }
@@ -144,6 +155,9 @@ func ContainerStatsWrite(ctx Context, containerStats []StatsEntry, osType string
 		"NetIO":     netIOHeader,
 		"BlockIO":   blockIOHeader,
 		"PIDs":      pidsHeader,
+		// 修改： 精简模式下按需拉取的文件
+		"SimplifyFetch": simplifyFetchHeader,
+		// 修改
 	}
 	containerStatsCtx.os = osType
 	return ctx.Write(&containerStatsCtx, render)
@@ -222,3 +236,16 @@ func (c *containerStatsContext) PIDs() string {
 	}
 	return fmt.Sprintf("%d", c.s.PidsCurrent)
 }
+
+// 修改： 精简模式下按需拉取的文件
+
+// SimplifyFetch returns the number and size of the files fetched on demand
+// for a container running in simplified mode.
+func (c *containerStatsContext) SimplifyFetch() string {
+	if c.s.IsInvalid || c.s.SimplifyFetches == nil {
+		return fmt.Sprintf("--")
+	}
+	return fmt.Sprintf("%d / %s", *c.s.SimplifyFetches, units.HumanSizeWithPrecision(c.s.SimplifyFetchedBytes, 3))
+}
+
+// 修改
@@ -11,6 +11,7 @@ import (
 
 func TestContainerStatsContext(t *testing.T) {
 	containerID := stringid.GenerateRandomID()
+	fetches := uint64(42)
 
 	var ctx containerStatsContext
 	tt := []struct {
@@ -36,6 +37,9 @@ func TestContainerStatsContext(t *testing.T) {
 		{StatsEntry{PidsCurrent: 10}, "", "10", pidsHeader, ctx.PIDs},
 		{StatsEntry{PidsCurrent: 10, IsInvalid: true}, "", "--", pidsHeader, ctx.PIDs},
 		{StatsEntry{PidsCurrent: 10}, "windows", "--", pidsHeader, ctx.PIDs},
+		{StatsEntry{SimplifyFetches: &fetches, SimplifyFetchedBytes: 3145728}, "", "42 / 3.15MB", simplifyFetchHeader, ctx.SimplifyFetch},
+		{StatsEntry{SimplifyFetches: &fetches, SimplifyFetchedBytes: 3145728, IsInvalid: true}, "", "--", simplifyFetchHeader, ctx.SimplifyFetch},
+		{StatsEntry{}, "", "--", simplifyFetchHeader, ctx.SimplifyFetch},
 	}
 
 	for _, te := range tt {
@@ -16,7 +16,7 @@ import (
 type fakeClient struct {
 	client.Client
 	imageTagFunc     func(string, string) error
-	imageSaveFunc    func(images []string) (io.ReadCloser, error)
+	imageSaveFunc    func(images []string, options types.ImageSaveOptions) (io.ReadCloser, error)
 	imageRemoveFunc  func(image string, options types.ImageRemoveOptions) ([]types.ImageDeleteResponseItem, error)
 	imagePushFunc    func(ref string, options types.ImagePushOptions) (io.ReadCloser, error)
 	infoFunc         func() (types.Info, error)
@@ -28,6 +28,16 @@ type fakeClient struct {
 	imageImportFunc  func(source types.ImageImportSource, ref string, options types.ImageImportOptions) (io.ReadCloser, error)
 	imageHistoryFunc func(image string) ([]image.HistoryResponseItem, error)
 	imageBuildFunc   func(context.Context, io.Reader, types.ImageBuildOptions) (types.ImageBuildResponse, error)
+
+	imageProfileListFunc    func() ([]types.ImageProfileSummary, error)
+	imageProfileInspectFunc func(image string) (types.ImageProfile, error)
+	imageProfileRemoveFunc  func(image string) error
+	imageProfileMergeFunc   func(image string, sources []string, options types.ImageProfileMergeOptions) (types.ImageProfileSummary, error)
+	imageSimplifyFunc       func(source string, options types.ImageSimplifyOptions) (io.ReadCloser, error)
+	imageDesimplifyFunc     func(image, target string) (io.ReadCloser, error)
+	imagePrefetchFunc       func(image string, options types.ImagePrefetchOptions) (io.ReadCloser, error)
+	imagePinFunc            func(image string, options types.ImagePinOptions) (io.ReadCloser, error)
+	imageUnpinFunc          func(image string, options types.ImagePinOptions) error
 }
 
 func (cli *fakeClient) ImageTag(_ context.Context, image, ref string) error {
@@ -39,7 +49,14 @@ func (cli *fakeClient) ImageTag(_ context.Context, image, ref string) error {
 
 func (cli *fakeClient) ImageSave(_ context.Context, images []string) (io.ReadCloser, error) {
 	if cli.imageSaveFunc != nil {
-		return cli.imageSaveFunc(images)
+		return cli.imageSaveFunc(images, types.ImageSaveOptions{})
+	}
+	return ioutil.NopCloser(strings.NewReader("")), nil
+}
+
+func (cli *fakeClient) ImageSaveSimplified(_ context.Context, images []string, options types.ImageSaveOptions) (io.ReadCloser, error) {
+	if cli.imageSaveFunc != nil {
+		return cli.imageSaveFunc(images, options)
 	}
 	return ioutil.NopCloser(strings.NewReader("")), nil
 }
@@ -63,7 +80,8 @@ func (cli *fakeClient) Info(_ context.Context) (types.Info, error) {
 	if cli.infoFunc != nil {
 		return cli.infoFunc()
 	}
-	return types.Info{}, nil
+	// the daemon supports simplified images unless a test says otherwise
+	return types.Info{Simplify: &types.SimplifyInfo{}}, nil
 }
 
 func (cli *fakeClient) ImagePull(_ context.Context, ref string, options types.ImagePullOptions) (io.ReadCloser, error) {
@@ -122,3 +140,66 @@ func (cli *fakeClient) ImageBuild(ctx context.Context, context io.Reader, option
 	}
 	return types.ImageBuildResponse{Body: ioutil.NopCloser(strings.NewReader(""))}, nil
 }
+
+func (cli *fakeClient) ImageProfileList(_ context.Context) ([]types.ImageProfileSummary, error) {
+	if cli.imageProfileListFunc != nil {
+		return cli.imageProfileListFunc()
+	}
+	return nil, nil
+}
+
+func (cli *fakeClient) ImageProfileInspect(_ context.Context, image string) (types.ImageProfile, error) {
+	if cli.imageProfileInspectFunc != nil {
+		return cli.imageProfileInspectFunc(image)
+	}
+	return types.ImageProfile{}, nil
+}
+
+func (cli *fakeClient) ImageProfileRemove(_ context.Context, image string) error {
+	if cli.imageProfileRemoveFunc != nil {
+		return cli.imageProfileRemoveFunc(image)
+	}
+	return nil
+}
+
+func (cli *fakeClient) ImageProfileMerge(_ context.Context, image string, sources []string, options types.ImageProfileMergeOptions) (types.ImageProfileSummary, error) {
+	if cli.imageProfileMergeFunc != nil {
+		return cli.imageProfileMergeFunc(image, sources, options)
+	}
+	return types.ImageProfileSummary{}, nil
+}
+
+func (cli *fakeClient) ImageSimplify(_ context.Context, source string, options types.ImageSimplifyOptions) (io.ReadCloser, error) {
+	if cli.imageSimplifyFunc != nil {
+		return cli.imageSimplifyFunc(source, options)
+	}
+	return ioutil.NopCloser(strings.NewReader("")), nil
+}
+
+func (cli *fakeClient) ImageDesimplify(_ context.Context, image, target string) (io.ReadCloser, error) {
+	if cli.imageDesimplifyFunc != nil {
+		return cli.imageDesimplifyFunc(image, target)
+	}
+	return ioutil.NopCloser(strings.NewReader("")), nil
+}
+
+func (cli *fakeClient) ImagePrefetch(_ context.Context, image string, options types.ImagePrefetchOptions) (io.ReadCloser, error) {
+	if cli.imagePrefetchFunc != nil {
+		return cli.imagePrefetchFunc(image, options)
+	}
+	return ioutil.NopCloser(strings.NewReader("")), nil
+}
+
+func (cli *fakeClient) ImagePin(_ context.Context, image string, options types.ImagePinOptions) (io.ReadCloser, error) {
+	if cli.imagePinFunc != nil {
+		return cli.imagePinFunc(image, options)
+	}
+	return ioutil.NopCloser(strings.NewReader("")), nil
+}
+
+func (cli *fakeClient) ImageUnpin(_ context.Context, image string, options types.ImagePinOptions) error {
+	if cli.imageUnpinFunc != nil {
+		return cli.imageUnpinFunc(image, options)
+	}
+	return nil
+}
@@ -28,6 +28,14 @@ func NewImageCommand(dockerCli command.Cli) *cobra.Command {
 		newRemoveCommand(dockerCli),
 		newInspectCommand(dockerCli),
 		NewPruneCommand(dockerCli),
+		// 修改： 管理镜像的精简profile
+		newProfileCommand(dockerCli),
+		newSimplifyCommand(dockerCli),
+		newDesimplifyCommand(dockerCli),
+		newPrefetchCommand(dockerCli),
+		newPinCommand(dockerCli),
+		newUnpinCommand(dockerCli),
+		// 修改
 	)
 	return cmd
 }
@@ -0,0 +1,49 @@
+package image
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/docker/cli/cli"
+	"github.com/docker/cli/cli/command"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/pkg/jsonmessage"
+	"github.com/spf13/cobra"
+)
+
+func newDesimplifyCommand(dockerCli command.Cli) *cobra.Command {
+	return &cobra.Command{
+		Use:   "desimplify SIMPLIFIED[:TAG] TARGET[:TAG]",
+		Short: "Restore the full image TARGET from a simplified image",
+		Args:  cli.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runDesimplify(dockerCli, args[0], args[1])
+		},
+	}
+}
+
+func runDesimplify(dockerCli command.Cli, image, target string) error {
+	responseBody, err := dockerCli.Client().ImageDesimplify(context.Background(), image, target)
+	if err != nil {
+		return err
+	}
+	defer responseBody.Close()
+
+	var result types.ImageDesimplifyResult
+	aux := func(msg jsonmessage.JSONMessage) {
+		if err := json.Unmarshal(*msg.Aux, &result); err != nil {
+			fmt.Fprintf(dockerCli.Err(), "Failed to parse aux message: %s", err)
+		}
+	}
+	if err := jsonmessage.DisplayJSONMessagesToStream(responseBody, dockerCli.Out(), aux); err != nil {
+		return err
+	}
+	for _, diffID := range result.Downloaded {
+		fmt.Fprintf(dockerCli.Err(), "Downloaded layer %s\n", diffID)
+	}
+	if result.ID != "" {
+		fmt.Fprintln(dockerCli.Out(), result.ID)
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package image
+
+import (
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/docker/cli/internal/test"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+func TestDesimplify(t *testing.T) {
+	cli := test.NewFakeCli(&fakeClient{
+		imageDesimplifyFunc: func(image, target string) (io.ReadCloser, error) {
+			assert.Check(t, is.Equal(image, "app:slim"))
+			assert.Check(t, is.Equal(target, "app:full"))
+			return ioutil.NopCloser(strings.NewReader(`{"status":"Restored 2 layers, downloaded 1"}` + "\n" +
+				`{"aux":{"ID":"sha256:0123456789abcdef","Downloaded":["sha256:fedcba9876543210"]}}` + "\n")), nil
+		},
+	})
+	cmd := newDesimplifyCommand(cli)
+	cmd.SetArgs([]string{"app:slim", "app:full"})
+	assert.NilError(t, cmd.Execute())
+	assert.Check(t, is.Equal(cli.OutBuffer().String(), "Restored 2 layers, downloaded 1\nsha256:0123456789abcdef\n"))
+	assert.Check(t, is.Equal(cli.ErrBuffer().String(), "Downloaded layer sha256:fedcba9876543210\n"))
+}
+
+func TestDesimplifyUnreachableLayer(t *testing.T) {
+	cli := test.NewFakeCli(&fakeClient{
+		imageDesimplifyFunc: func(image, target string) (io.ReadCloser, error) {
+			return ioutil.NopCloser(strings.NewReader(`{"errorDetail":{"message":"layer sha256:fedcba9876543210 of the full image is unreachable"}}` + "\n")), nil
+		},
+	})
+	cmd := newDesimplifyCommand(cli)
+	cmd.SetArgs([]string{"app:slim", "app:full"})
+	cmd.SetOutput(ioutil.Discard)
+	assert.ErrorContains(t, cmd.Execute(), "of the full image is unreachable")
+}
@@ -16,6 +16,9 @@ type historyOptions struct {
 	quiet   bool
 	noTrunc bool
 	format  string
+	// 修改： 显示被精简改写的层
+	simplify bool
+	// 修改
 }
 
 // NewHistoryCommand creates a new `docker history` command
@@ -38,6 +41,10 @@ func NewHistoryCommand(dockerCli command.Cli) *cobra.Command {
 	flags.BoolVarP(&opts.quiet, "quiet", "q", false, "Only show numeric IDs")
 	flags.BoolVar(&opts.noTrunc, "no-trunc", false, "Don't truncate output")
 	flags.StringVar(&opts.format, "format", "", "Pretty-print images using a Go template")
+	// 修改
+	flags.BoolVar(&opts.simplify, "simplify", false, "Show the layers rewritten by simplification and the size of the layers of the full image")
+	flags.SetAnnotation("simplify", "version", []string{"1.39"})
+	// 修改
 
 	return cmd
 }
@@ -57,7 +64,7 @@ func runHistory(dockerCli command.Cli, opts historyOptions) error {
 
 	historyCtx := formatter.Context{
 		Output: dockerCli.Out(),
-		Format: formatter.NewHistoryFormat(format, opts.quiet, opts.human),
+		Format: formatter.NewHistoryFormat(format, opts.quiet, opts.human, opts.simplify),
 		Trunc:  !opts.noTrunc,
 	}
 	return formatter.HistoryWrite(historyCtx, opts.human, history)
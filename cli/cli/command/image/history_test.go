@@ -81,6 +81,20 @@ func TestNewHistoryCommandSuccess(t *testing.T) {
 				}}, nil
 			},
 		},
+		{
+			name: "simplify",
+			args: []string{"--simplify", "--human=false", "image:tag"},
+			imageHistoryFunc: func(img string) ([]image.HistoryResponseItem, error) {
+				return []image.HistoryResponseItem{{
+					ID:         "abcdef",
+					Created:    time.Date(2017, 1, 1, 12, 0, 3, 0, time.UTC).Unix(),
+					CreatedBy:  "rose",
+					Size:       1024,
+					Simplified: true,
+					FullSize:   4096,
+				}}, nil
+			},
+		},
 		{
 			name: "quiet-no-trunc",
 			args: []string{"--quiet", "--no-trunc", "image:tag"},
@@ -59,6 +59,15 @@ func TestNewInspectCommandSuccess(t *testing.T) {
 				return types.ImageInspect{ID: image}, nil, nil
 			},
 		},
+		{
+			name:       "format-simplified",
+			imageCount: 1,
+			args:       []string{"--format='{{.Simplified.Enabled}}'", "image"},
+			imageInspectFunc: func(image string) (types.ImageInspect, []byte, error) {
+				imageInspectInvocationCount++
+				return types.ImageInspect{ID: image, Simplified: types.ImageSimplified{Enabled: true}}, nil, nil
+			},
+		},
 		{
 			name:       "simple-many",
 			args:       []string{"image1", "image2"},
@@ -0,0 +1,42 @@
+package image
+
+import (
+	"context"
+
+	"github.com/docker/cli/cli"
+	"github.com/docker/cli/cli/command"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/pkg/jsonmessage"
+	"github.com/spf13/cobra"
+)
+
+type pinOptions struct {
+	image string
+	paths []string
+}
+
+func newPinCommand(dockerCli command.Cli) *cobra.Command {
+	var opts pinOptions
+
+	cmd := &cobra.Command{
+		Use:   "pin IMAGE PATH [PATH...]",
+		Short: "Keep paths of a simplified image in the fetch cache, however full the disk",
+		Args:  cli.RequiresMinArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts.image = args[0]
+			opts.paths = args[1:]
+			return runPin(dockerCli, opts)
+		},
+	}
+	return cmd
+}
+
+func runPin(dockerCli command.Cli, opts pinOptions) error {
+	responseBody, err := dockerCli.Client().ImagePin(context.Background(), opts.image, types.ImagePinOptions{Paths: opts.paths})
+	if err != nil {
+		return err
+	}
+	defer responseBody.Close()
+
+	return jsonmessage.DisplayJSONMessagesToStream(responseBody, dockerCli.Out(), nil)
+}
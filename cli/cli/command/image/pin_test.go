@@ -0,0 +1,65 @@
+package image
+
+import (
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/docker/cli/internal/test"
+	"github.com/docker/docker/api/types"
+	"github.com/pkg/errors"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+func TestPin(t *testing.T) {
+	var paths []string
+	cli := test.NewFakeCli(&fakeClient{
+		imagePinFunc: func(image string, options types.ImagePinOptions) (io.ReadCloser, error) {
+			assert.Check(t, is.Equal(image, "app:slim"))
+			paths = options.Paths
+			return ioutil.NopCloser(strings.NewReader(`{"status":"Pinned 2 paths, prefetched 3 files, 1.2MB"}` + "\n" +
+				`{"aux":{"Files":3,"Bytes":1200000}}` + "\n")), nil
+		},
+	})
+	cmd := newPinCommand(cli)
+	cmd.SetArgs([]string{"app:slim", "/usr/bin/gdb", "/usr/lib/debug"})
+	assert.NilError(t, cmd.Execute())
+	assert.Check(t, is.DeepEqual(paths, []string{"/usr/bin/gdb", "/usr/lib/debug"}))
+	assert.Check(t, is.Equal(cli.OutBuffer().String(), "Pinned 2 paths, prefetched 3 files, 1.2MB\n"))
+}
+
+func TestPinRequiresPaths(t *testing.T) {
+	cmd := newPinCommand(test.NewFakeCli(&fakeClient{}))
+	cmd.SetArgs([]string{"app:slim"})
+	cmd.SetOutput(ioutil.Discard)
+	assert.ErrorContains(t, cmd.Execute(), "requires at least 2 arguments")
+}
+
+func TestUnpin(t *testing.T) {
+	var paths []string
+	cli := test.NewFakeCli(&fakeClient{
+		imageUnpinFunc: func(image string, options types.ImagePinOptions) error {
+			assert.Check(t, is.Equal(image, "app:slim"))
+			paths = options.Paths
+			return nil
+		},
+	})
+	cmd := newUnpinCommand(cli)
+	cmd.SetArgs([]string{"app:slim", "/usr/bin/gdb"})
+	assert.NilError(t, cmd.Execute())
+	assert.Check(t, is.DeepEqual(paths, []string{"/usr/bin/gdb"}))
+}
+
+func TestUnpinNotPinned(t *testing.T) {
+	cli := test.NewFakeCli(&fakeClient{
+		imageUnpinFunc: func(image string, options types.ImagePinOptions) error {
+			return errors.New("not pinned in image app:slim: /etc")
+		},
+	})
+	cmd := newUnpinCommand(cli)
+	cmd.SetArgs([]string{"app:slim", "/etc"})
+	cmd.SetOutput(ioutil.Discard)
+	assert.ErrorContains(t, cmd.Execute(), "not pinned")
+}
@@ -0,0 +1,44 @@
+package image
+
+import (
+	"context"
+
+	"github.com/docker/cli/cli"
+	"github.com/docker/cli/cli/command"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/pkg/jsonmessage"
+	"github.com/spf13/cobra"
+)
+
+type prefetchOptions struct {
+	image string
+	paths []string
+}
+
+func newPrefetchCommand(dockerCli command.Cli) *cobra.Command {
+	var opts prefetchOptions
+
+	cmd := &cobra.Command{
+		Use:   "prefetch [OPTIONS] IMAGE",
+		Short: "Fetch the files pruned from a simplified image ahead of its containers",
+		Args:  cli.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts.image = args[0]
+			return runPrefetch(dockerCli, opts)
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringSliceVar(&opts.paths, "paths", nil, "Only fetch the files matching these globs, or inside a directory matching one")
+	return cmd
+}
+
+func runPrefetch(dockerCli command.Cli, opts prefetchOptions) error {
+	responseBody, err := dockerCli.Client().ImagePrefetch(context.Background(), opts.image, types.ImagePrefetchOptions{Paths: opts.paths})
+	if err != nil {
+		return err
+	}
+	defer responseBody.Close()
+
+	return jsonmessage.DisplayJSONMessagesToStream(responseBody, dockerCli.Out(), nil)
+}
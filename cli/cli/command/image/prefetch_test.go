@@ -0,0 +1,42 @@
+package image
+
+import (
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/docker/cli/internal/test"
+	"github.com/docker/docker/api/types"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+func TestPrefetch(t *testing.T) {
+	var paths []string
+	cli := test.NewFakeCli(&fakeClient{
+		imagePrefetchFunc: func(image string, options types.ImagePrefetchOptions) (io.ReadCloser, error) {
+			assert.Check(t, is.Equal(image, "app:slim"))
+			paths = options.Paths
+			return ioutil.NopCloser(strings.NewReader(`{"status":"Prefetched 12 files, 3.4MB"}` + "\n" +
+				`{"aux":{"Files":12,"Bytes":3400000}}` + "\n")), nil
+		},
+	})
+	cmd := newPrefetchCommand(cli)
+	cmd.SetArgs([]string{"--paths", "/usr/lib/*", "--paths", "/etc", "app:slim"})
+	assert.NilError(t, cmd.Execute())
+	assert.Check(t, is.DeepEqual(paths, []string{"/usr/lib/*", "/etc"}))
+	assert.Check(t, is.Equal(cli.OutBuffer().String(), "Prefetched 12 files, 3.4MB\n"))
+}
+
+func TestPrefetchNotSimplified(t *testing.T) {
+	cli := test.NewFakeCli(&fakeClient{
+		imagePrefetchFunc: func(image string, options types.ImagePrefetchOptions) (io.ReadCloser, error) {
+			return ioutil.NopCloser(strings.NewReader(`{"errorDetail":{"message":"image app:full is not a simplified image"}}` + "\n")), nil
+		},
+	})
+	cmd := newPrefetchCommand(cli)
+	cmd.SetArgs([]string{"app:full"})
+	cmd.SetOutput(ioutil.Discard)
+	assert.ErrorContains(t, cmd.Execute(), "is not a simplified image")
+}
@@ -0,0 +1,24 @@
+package image
+
+import (
+	"github.com/docker/cli/cli"
+	"github.com/docker/cli/cli/command"
+	"github.com/spf13/cobra"
+)
+
+// newProfileCommand returns a cobra command for `image profile` subcommands
+func newProfileCommand(dockerCli command.Cli) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "profile",
+		Short: "Manage the simplify profiles of images",
+		Args:  cli.NoArgs,
+		RunE:  command.ShowHelp(dockerCli.Err()),
+	}
+	cmd.AddCommand(
+		newProfileListCommand(dockerCli),
+		newProfileInspectCommand(dockerCli),
+		newProfileRemoveCommand(dockerCli),
+		newProfileMergeCommand(dockerCli),
+	)
+	return cmd
+}
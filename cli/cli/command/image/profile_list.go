@@ -0,0 +1,54 @@
+package image
+
+import (
+	"context"
+
+	"github.com/docker/cli/cli"
+	"github.com/docker/cli/cli/command"
+	"github.com/docker/cli/cli/command/formatter"
+	"github.com/spf13/cobra"
+)
+
+type profileListOptions struct {
+	quiet   bool
+	noTrunc bool
+	format  string
+}
+
+func newProfileListCommand(dockerCli command.Cli) *cobra.Command {
+	var opts profileListOptions
+
+	cmd := &cobra.Command{
+		Use:     "ls [OPTIONS]",
+		Aliases: []string{"list"},
+		Short:   "List the simplify profiles of images",
+		Args:    cli.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runProfileList(dockerCli, opts)
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.BoolVarP(&opts.quiet, "quiet", "q", false, "Only show image IDs")
+	flags.BoolVar(&opts.noTrunc, "no-trunc", false, "Don't truncate output")
+	flags.StringVar(&opts.format, "format", "", "Pretty-print profiles using a Go template")
+
+	return cmd
+}
+
+func runProfileList(dockerCli command.Cli, opts profileListOptions) error {
+	profiles, err := dockerCli.Client().ImageProfileList(context.Background())
+	if err != nil {
+		return err
+	}
+
+	format := opts.format
+	if len(format) == 0 {
+		format = formatter.TableFormatKey
+	}
+	profileCtx := formatter.Context{
+		Output: dockerCli.Out(),
+		Format: formatter.NewImageProfileFormat(format, opts.quiet),
+	}
+	return formatter.ImageProfileWrite(profileCtx, profiles, !opts.noTrunc)
+}
@@ -0,0 +1,41 @@
+package image
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/docker/cli/cli"
+	"github.com/docker/cli/cli/command"
+	"github.com/docker/docker/api/types"
+	"github.com/spf13/cobra"
+)
+
+type profileMergeOptions struct {
+	force bool
+}
+
+func newProfileMergeCommand(dockerCli command.Cli) *cobra.Command {
+	var opts profileMergeOptions
+
+	cmd := &cobra.Command{
+		Use:   "merge [OPTIONS] IMAGE SOURCE [SOURCE...]",
+		Short: "Merge the files recorded by containers or for images into the simplify profile of an image",
+		Args:  cli.RequiresMinArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runProfileMerge(dockerCli, args[0], args[1:], opts)
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.BoolVarP(&opts.force, "force", "f", false, "Merge profiles recorded for other images")
+	return cmd
+}
+
+func runProfileMerge(dockerCli command.Cli, image string, sources []string, opts profileMergeOptions) error {
+	summary, err := dockerCli.Client().ImageProfileMerge(context.Background(), image, sources, types.ImageProfileMergeOptions{Force: opts.force})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(dockerCli.Out(), "Merged %d runs, %d files\n", summary.Runs, summary.Files)
+	return nil
+}
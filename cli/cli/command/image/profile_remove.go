@@ -0,0 +1,42 @@
+package image
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/docker/cli/cli"
+	"github.com/docker/cli/cli/command"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+func newProfileRemoveCommand(dockerCli command.Cli) *cobra.Command {
+	return &cobra.Command{
+		Use:     "rm IMAGE [IMAGE...]",
+		Aliases: []string{"remove"},
+		Short:   "Remove the simplify profiles of one or more images",
+		Args:    cli.RequiresMinArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runProfileRemove(dockerCli, args)
+		},
+	}
+}
+
+func runProfileRemove(dockerCli command.Cli, images []string) error {
+	client := dockerCli.Client()
+	ctx := context.Background()
+
+	var errs []string
+	for _, img := range images {
+		if err := client.ImageProfileRemove(ctx, img); err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		fmt.Fprintln(dockerCli.Out(), img)
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "\n"))
+	}
+	return nil
+}
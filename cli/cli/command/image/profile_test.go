@@ -0,0 +1,86 @@
+package image
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/docker/cli/internal/test"
+	"github.com/docker/docker/api/types"
+	"github.com/pkg/errors"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+func TestProfileList(t *testing.T) {
+	cli := test.NewFakeCli(&fakeClient{
+		imageProfileListFunc: func() ([]types.ImageProfileSummary, error) {
+			return []types.ImageProfileSummary{
+				{Image: "sha256:0123456789abcdef", Reference: "app:latest", Files: 12},
+				{Image: "sha256:ba9876543210fedc", Files: 3, Stale: true},
+			}, nil
+		},
+	})
+	cmd := newProfileListCommand(cli)
+	cmd.SetArgs([]string{"--format", "{{.ID}} {{.Reference}} {{.Files}} {{.Stale}}"})
+	assert.NilError(t, cmd.Execute())
+	assert.Check(t, is.Equal(cli.OutBuffer().String(), "0123456789ab app:latest 12 false\nba9876543210  3 true\n"))
+}
+
+func TestProfileInspect(t *testing.T) {
+	cli := test.NewFakeCli(&fakeClient{
+		imageProfileInspectFunc: func(image string) (types.ImageProfile, error) {
+			if image != "app:latest" {
+				return types.ImageProfile{}, notFound{imageID: image}
+			}
+			return types.ImageProfile{Image: "sha256:0123456789abcdef", Paths: []string{"/bin/sh", "/etc/app.conf"}}, nil
+		},
+	})
+	cmd := newProfileInspectCommand(cli)
+	cmd.SetArgs([]string{"--format", "{{join .Paths \",\"}}", "app:latest"})
+	assert.NilError(t, cmd.Execute())
+	assert.Check(t, is.Equal(cli.OutBuffer().String(), "/bin/sh,/etc/app.conf\n"))
+
+	cmd = newProfileInspectCommand(cli)
+	cmd.SetArgs([]string{"other"})
+	cmd.SetOutput(ioutil.Discard)
+	assert.ErrorContains(t, cmd.Execute(), "No such image: other")
+}
+
+func TestProfileRemove(t *testing.T) {
+	var removed []string
+	cli := test.NewFakeCli(&fakeClient{
+		imageProfileRemoveFunc: func(image string) error {
+			if image == "other" {
+				return errors.New("no simplify profile for image other")
+			}
+			removed = append(removed, image)
+			return nil
+		},
+	})
+	cmd := newProfileRemoveCommand(cli)
+	cmd.SetArgs([]string{"app:latest", "other", "sha256:0123456789abcdef"})
+	cmd.SetOutput(ioutil.Discard)
+	assert.ErrorContains(t, cmd.Execute(), "no simplify profile for image other")
+	assert.Check(t, is.DeepEqual(removed, []string{"app:latest", "sha256:0123456789abcdef"}))
+	assert.Check(t, is.Equal(cli.OutBuffer().String(), "app:latest\nsha256:0123456789abcdef\n"))
+}
+
+func TestProfileMerge(t *testing.T) {
+	cli := test.NewFakeCli(&fakeClient{
+		imageProfileMergeFunc: func(image string, sources []string, options types.ImageProfileMergeOptions) (types.ImageProfileSummary, error) {
+			assert.Check(t, is.Equal(image, "app:latest"))
+			assert.Check(t, is.DeepEqual(sources, []string{"run1", "app:old"}))
+			assert.Check(t, options.Force)
+			return types.ImageProfileSummary{Image: "sha256:0123456789abcdef", Files: 42, Runs: 3}, nil
+		},
+	})
+	cmd := newProfileMergeCommand(cli)
+	cmd.SetArgs([]string{"--force", "app:latest", "run1", "app:old"})
+	assert.NilError(t, cmd.Execute())
+	assert.Check(t, is.Equal(cli.OutBuffer().String(), "Merged 3 runs, 42 files\n"))
+
+	cmd = newProfileMergeCommand(cli)
+	cmd.SetArgs([]string{"app:latest"})
+	cmd.SetOutput(ioutil.Discard)
+	assert.ErrorContains(t, cmd.Execute(), "requires at least 2 arguments")
+}
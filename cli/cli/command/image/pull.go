@@ -9,6 +9,8 @@ import (
 	"github.com/docker/cli/cli/command"
 	"github.com/docker/cli/cli/trust"
 	"github.com/docker/distribution/reference"
+	"github.com/docker/docker/api/types"
+	digest "github.com/opencontainers/go-digest"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
@@ -19,7 +21,20 @@ type PullOptions struct {
 	all    bool
 
 	// 修改：添加-s，--simplify-image标记（flag）
-	simp bool
+	simp      bool
+	threshold int
+	required  bool
+	profile   string
+	force     bool
+	optional  bool
+	// simplifyProfile is read from profile
+	simplifyProfile *types.ImageProfile
+	// signedProfile is the profile signed along with the image pulled with
+	// content trust, if any
+	signedProfile *trust.SimplifyProfile
+	// signedDigest is the digest of the image pulled with content trust,
+	// verified against its signature
+	signedDigest digest.Digest
 	// 修改
 
 	platform  string
@@ -46,6 +61,11 @@ func NewPullCommand(dockerCli command.Cli) *cobra.Command {
 
 	// 修改：添加-s，--simplify-image标记（flag）
 	flags.BoolVarP(&opts.simp, "simplify-image", "s", false, "Simplify image")
+	flags.IntVar(&opts.threshold, "simplify-threshold", 0, "Default --simplify-threshold for simplified commits of the image's containers (0-100)")
+	flags.BoolVar(&opts.required, "simplify-required", false, "Fail instead of pulling the full image if no simplification profile is found")
+	flags.StringVar(&opts.profile, "simplify-profile", "", "Simplify with the profile read from a file instead of any stored or pushed one")
+	flags.BoolVar(&opts.force, "force", false, "Use the --simplify-profile even if it was recorded for another image")
+	command.AddSimplifyOptionalFlag(flags, &opts.optional)
 	// 修改
 
 	// 设置opts中platform元素，默认为""
@@ -69,6 +89,20 @@ func RunPull(cli command.Cli, opts PullOptions) error {
 	// 没有-a参数时也没有tag参数时，补全tag参数
 	case opts.all && !reference.IsNameOnly(distributionRef):
 		return errors.New("tag can't be used with --all-tags/-a")
+	// 修改： 检查精简阈值
+	case opts.threshold != 0 && !opts.simp:
+		return errors.New("--simplify-threshold requires --simplify-image")
+	case opts.required && !opts.simp:
+		return errors.New("--simplify-required requires --simplify-image")
+	case opts.profile != "" && !opts.simp:
+		return errors.New("--simplify-profile requires --simplify-image")
+	case opts.force && opts.profile == "":
+		return errors.New("--force requires --simplify-profile")
+	case opts.optional && opts.required:
+		return errors.New("--simplify-optional cannot be used with --simplify-required")
+	case opts.threshold < 0 || opts.threshold > 100:
+		return errors.Errorf("invalid simplify threshold %d: must be between 0 and 100", opts.threshold)
+	// 修改
 	case !opts.all && reference.IsNameOnly(distributionRef):
 		distributionRef = reference.TagNameOnly(distributionRef)
 		if tagged, ok := distributionRef.(reference.Tagged); ok {
@@ -76,9 +110,31 @@ func RunPull(cli command.Cli, opts PullOptions) error {
 		}
 	}
 
+	// 修改： 发送请求前读取并检查profile
+	if opts.profile != "" {
+		if opts.simplifyProfile, err = ReadProfileFile(opts.profile); err != nil {
+			return err
+		}
+	}
+	// 修改
+
 	// 空context变量
 	ctx := context.Background()
 
+	// 修改： 守护进程不支持精简镜像时失败，或按--simplify-optional拉取完整镜像
+	if opts.simp {
+		simp, err := command.SimplifySupport(ctx, cli, opts.optional)
+		if err != nil {
+			return err
+		}
+		opts.simp = simp != nil
+		// 拉取时就提示，而不是等到启动容器时才失败
+		if simp != nil && simp.Unsupported != "" {
+			fmt.Fprintf(cli.Err(), "WARNING: the daemon cannot start containers on simplified images: %s; pull without --simplify-image to run the image on this daemon\n", simp.Unsupported)
+		}
+	}
+	// 修改
+
 	// 认证镜像信息
 	imgRefAndAuth, err := trust.GetImageReferencesAndAuth(ctx, nil, AuthResolver(cli), distributionRef.String())
 	if err != nil {
@@ -90,10 +146,12 @@ func RunPull(cli command.Cli, opts PullOptions) error {
 
 	// 镜像校验默认选择，所以一般执行else中指令
 	if !opts.untrusted && !isCanonical {
-		err = trustedPull(ctx, cli, imgRefAndAuth, opts.platform)
+		// 修改：内容信任路径同样传递精简参数
+		err = trustedPull(ctx, cli, imgRefAndAuth, opts)
+		// 修改
 	} else {
-		// 修改：添加传递opts.simp参数
-		err = imagePullPrivileged(ctx, cli, imgRefAndAuth, opts.all, opts.simp, opts.platform)
+		// 修改：添加传递精简参数
+		err = imagePullPrivileged(ctx, cli, imgRefAndAuth, opts)
 		// 修改
 	}
 
@@ -1,17 +1,23 @@
 package image
 
 import (
+	"crypto/sha256"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"strings"
 	"testing"
 
+	"github.com/docker/cli/cli/trust"
 	"github.com/docker/cli/internal/test"
 	"github.com/docker/cli/internal/test/notary"
 	"github.com/docker/docker/api/types"
+	"github.com/opencontainers/go-digest"
+	"github.com/theupdateframework/notary/client"
+	"github.com/theupdateframework/notary/tuf/data"
 	"gotest.tools/assert"
 	is "gotest.tools/assert/cmp"
+	"gotest.tools/fs"
 	"gotest.tools/golden"
 )
 
@@ -36,6 +42,41 @@ func TestNewPullCommandErrors(t *testing.T) {
 			expectedError: "tag can't be used with --all-tags/-a",
 			args:          []string{"--all-tags", "image:tag"},
 		},
+		{
+			name:          "simplify-threshold-without-simplify-image",
+			expectedError: "--simplify-threshold requires --simplify-image",
+			args:          []string{"--simplify-threshold", "50", "image:tag"},
+		},
+		{
+			name:          "simplify-required-without-simplify",
+			expectedError: "--simplify-required requires --simplify-image",
+			args:          []string{"--simplify-required", "image:tag"},
+		},
+		{
+			name:          "simplify-optional-with-simplify-required",
+			expectedError: "--simplify-optional cannot be used with --simplify-required",
+			args:          []string{"-s", "--simplify-required", "--simplify-optional", "image:tag"},
+		},
+		{
+			name:          "simplify-profile-without-simplify",
+			expectedError: "--simplify-profile requires --simplify-image",
+			args:          []string{"--simplify-profile", "profile.json", "image:tag"},
+		},
+		{
+			name:          "force-without-simplify-profile",
+			expectedError: "--force requires --simplify-profile",
+			args:          []string{"-s", "--force", "image:tag"},
+		},
+		{
+			name:          "missing-simplify-profile",
+			expectedError: "no such file or directory",
+			args:          []string{"-s", "--simplify-profile", "missing.json", "image:tag"},
+		},
+		{
+			name:          "invalid-simplify-threshold",
+			expectedError: "invalid simplify threshold 150",
+			args:          []string{"-s", "--simplify-threshold", "150", "image:tag"},
+		},
 	}
 	for _, tc := range testCases {
 		cli := test.NewFakeCli(&fakeClient{})
@@ -79,6 +120,90 @@ func TestNewPullCommandSuccess(t *testing.T) {
 	}
 }
 
+func TestNewPullCommandAllTagsSimplify(t *testing.T) {
+	var pulled bool
+	cli := test.NewFakeCli(&fakeClient{
+		imagePullFunc: func(ref string, options types.ImagePullOptions) (io.ReadCloser, error) {
+			pulled = true
+			assert.Check(t, is.Equal(ref, "image"))
+			assert.Check(t, options.All)
+			assert.Check(t, options.Simplify)
+			return ioutil.NopCloser(strings.NewReader("")), nil
+		},
+	})
+	cmd := NewPullCommand(cli)
+	cmd.SetOutput(ioutil.Discard)
+	cmd.SetArgs([]string{"-a", "-s", "image"})
+	assert.NilError(t, cmd.Execute())
+	assert.Check(t, pulled)
+}
+
+func TestNewPullCommandSimplifyProfile(t *testing.T) {
+	dir := fs.NewDir(t, "pull", fs.WithFile("profile.json", `{"Paths":["/bin/sh","/etc/app.conf"],"Counts":{"/bin/sh":2,"/etc/app.conf":1}}`))
+	defer dir.Remove()
+
+	cli := test.NewFakeCli(&fakeClient{
+		imagePullFunc: func(ref string, options types.ImagePullOptions) (io.ReadCloser, error) {
+			assert.Check(t, options.Simplify)
+			assert.Assert(t, options.SimplifyUseProfile != nil)
+			assert.Check(t, is.DeepEqual(options.SimplifyUseProfile.Paths, []string{"/bin/sh", "/etc/app.conf"}))
+			assert.Check(t, !options.SimplifyForce)
+			return ioutil.NopCloser(strings.NewReader("")), nil
+		},
+	})
+	cmd := NewPullCommand(cli)
+	cmd.SetOutput(ioutil.Discard)
+	cmd.SetArgs([]string{"-s", "--simplify-profile", dir.Join("profile.json"), "image:tag"})
+	assert.NilError(t, cmd.Execute())
+}
+
+func TestNewPullCommandSimplifyOlderDaemon(t *testing.T) {
+	var pulled *types.ImagePullOptions
+	cli := test.NewFakeCli(&fakeClient{
+		// daemons without simplification report nothing about it
+		infoFunc: func() (types.Info, error) {
+			return types.Info{}, nil
+		},
+		imagePullFunc: func(ref string, options types.ImagePullOptions) (io.ReadCloser, error) {
+			pulled = &options
+			return ioutil.NopCloser(strings.NewReader("")), nil
+		},
+	})
+	cmd := NewPullCommand(cli)
+	cmd.SetOutput(ioutil.Discard)
+	cmd.SetArgs([]string{"-s", "image:tag"})
+	assert.ErrorContains(t, cmd.Execute(), "the daemon does not support simplified images: use --simplify-optional")
+	assert.Check(t, pulled == nil)
+
+	cmd = NewPullCommand(cli)
+	cmd.SetOutput(ioutil.Discard)
+	cmd.SetArgs([]string{"-s", "--simplify-optional", "image:tag"})
+	assert.NilError(t, cmd.Execute())
+	assert.Assert(t, pulled != nil)
+	assert.Check(t, !pulled.Simplify)
+	assert.Check(t, is.Contains(cli.ErrBuffer().String(), "WARNING: the daemon does not support simplified images, going ahead without simplification"))
+}
+
+func TestNewPullCommandSimplifyUnsupported(t *testing.T) {
+	var pulled *types.ImagePullOptions
+	cli := test.NewFakeCli(&fakeClient{
+		infoFunc: func() (types.Info, error) {
+			return types.Info{Simplify: &types.SimplifyInfo{Unsupported: "storage driver vfs does not support simplified images (supported: overlay2)"}}, nil
+		},
+		imagePullFunc: func(ref string, options types.ImagePullOptions) (io.ReadCloser, error) {
+			pulled = &options
+			return ioutil.NopCloser(strings.NewReader("")), nil
+		},
+	})
+	cmd := NewPullCommand(cli)
+	cmd.SetOutput(ioutil.Discard)
+	cmd.SetArgs([]string{"-s", "image:tag"})
+	assert.NilError(t, cmd.Execute())
+	assert.Assert(t, pulled != nil)
+	assert.Check(t, pulled.Simplify)
+	assert.Check(t, is.Contains(cli.ErrBuffer().String(), "WARNING: the daemon cannot start containers on simplified images: storage driver vfs does not support simplified images (supported: overlay2); pull without --simplify-image to run the image on this daemon\n"))
+}
+
 func TestNewPullCommandWithContentTrustErrors(t *testing.T) {
 	testCases := []struct {
 		name          string
@@ -119,3 +244,90 @@ func TestNewPullCommandWithContentTrustErrors(t *testing.T) {
 		assert.ErrorContains(t, err, tc.expectedError)
 	}
 }
+
+// signedNotaryRepository serves a single signed target for every tag.
+type signedNotaryRepository struct {
+	client.Repository
+	target client.Target
+}
+
+func (r signedNotaryRepository) GetTargetByName(name string, roles ...data.RoleName) (*client.TargetWithRole, error) {
+	return &client.TargetWithRole{Target: r.target, Role: data.CanonicalTargetsRole}, nil
+}
+
+func TestNewPullCommandWithContentTrustSimplify(t *testing.T) {
+	sum := sha256.Sum256([]byte("red"))
+	dgst := digest.NewDigestFromBytes(digest.SHA256, sum[:])
+	var pulled []string
+	cli := test.NewFakeCli(&fakeClient{
+		imagePullFunc: func(ref string, options types.ImagePullOptions) (io.ReadCloser, error) {
+			assert.Check(t, options.Simplify)
+			assert.Check(t, is.Equal(options.SimplifyThreshold, 30))
+			assert.Check(t, options.SimplifyRequired)
+			pulled = append(pulled, ref)
+			return ioutil.NopCloser(strings.NewReader("")), nil
+		},
+		imageTagFunc: func(image, ref string) error {
+			assert.Check(t, is.Equal(image, "image@"+dgst.String()))
+			assert.Check(t, is.Equal(ref, "image:red"))
+			return nil
+		},
+	}, test.EnableContentTrust)
+	cli.SetNotaryClient(func(imgRefAndAuth trust.ImageRefAndAuth, actions []string) (client.Repository, error) {
+		repo, err := notary.GetLoadedNotaryRepository(imgRefAndAuth, actions)
+		return signedNotaryRepository{
+			Repository: repo,
+			target:     client.Target{Name: "red", Hashes: data.Hashes{"sha256": sum[:]}},
+		}, err
+	})
+	cmd := NewPullCommand(cli)
+	cmd.SetOutput(ioutil.Discard)
+	cmd.SetArgs([]string{"-s", "--simplify-threshold", "30", "--simplify-required", "image:red"})
+	assert.NilError(t, cmd.Execute())
+	// the digest resolved through Notary is simplified, not the tag
+	assert.Check(t, is.DeepEqual(pulled, []string{"image@" + dgst.String()}))
+}
+
+func TestNewPullCommandWithContentTrustSignedProfile(t *testing.T) {
+	sum := sha256.Sum256([]byte("red"))
+	profile := digest.FromString(`{"paths":["/bin/sh"]}`)
+	target := client.Target{Name: "red", Hashes: data.Hashes{"sha256": sum[:]}}
+	assert.NilError(t, trust.SetSimplifyProfile(&target, trust.SimplifyProfile{Digest: profile, Size: 22}))
+	var pulled types.ImagePullOptions
+	cli := test.NewFakeCli(&fakeClient{
+		imagePullFunc: func(ref string, options types.ImagePullOptions) (io.ReadCloser, error) {
+			pulled = options
+			return ioutil.NopCloser(strings.NewReader("")), nil
+		},
+	}, test.EnableContentTrust)
+	cli.SetNotaryClient(func(imgRefAndAuth trust.ImageRefAndAuth, actions []string) (client.Repository, error) {
+		repo, err := notary.GetLoadedNotaryRepository(imgRefAndAuth, actions)
+		return signedNotaryRepository{Repository: repo, target: target}, err
+	})
+	cmd := NewPullCommand(cli)
+	cmd.SetOutput(ioutil.Discard)
+	cmd.SetArgs([]string{"-s", "image:red"})
+	assert.NilError(t, cmd.Execute())
+	// only the profile signed along with the image is used
+	assert.Check(t, pulled.SimplifyTrusted)
+	assert.Check(t, is.Equal(pulled.SimplifySignedProfile, profile.String()))
+	// and the digest verified against the signature is recorded
+	assert.Check(t, is.Equal(pulled.SimplifySignedDigest, digest.NewDigestFromBytes(digest.SHA256, sum[:]).String()))
+
+	// images signed without a profile are pulled requiring none
+	target.Custom = nil
+	cmd = NewPullCommand(cli)
+	cmd.SetOutput(ioutil.Discard)
+	cmd.SetArgs([]string{"-s", "image:red"})
+	assert.NilError(t, cmd.Execute())
+	assert.Check(t, pulled.SimplifyTrusted)
+	assert.Check(t, is.Equal(pulled.SimplifySignedProfile, ""))
+
+	// without content trust the profile pushed along with the image is used
+	cmd = NewPullCommand(cli)
+	cmd.SetOutput(ioutil.Discard)
+	cmd.SetArgs([]string{"-s", "--disable-content-trust", "image:red"})
+	assert.NilError(t, cmd.Execute())
+	assert.Check(t, !pulled.SimplifyTrusted)
+	assert.Check(t, is.Equal(pulled.SimplifySignedDigest, ""))
+}
@@ -8,12 +8,18 @@ import (
 	"github.com/docker/distribution/reference"
 	"github.com/docker/docker/pkg/jsonmessage"
 	"github.com/docker/docker/registry"
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
 
 type pushOptions struct {
 	remote    string
 	untrusted bool
+
+	// 修改： 推送精简镜像的profile和可按文件下载的层
+	simplifyProfile bool
+	simplifyTOC     bool
+	// 修改
 }
 
 // NewPushCommand creates a new `docker push` command
@@ -32,6 +38,11 @@ func NewPushCommand(dockerCli command.Cli) *cobra.Command {
 
 	flags := cmd.Flags()
 
+	// 修改： 推送精简镜像的profile和可按文件下载的层
+	flags.BoolVar(&opts.simplifyProfile, "simplify-profile", false, "Push the simplify profile of the image along with it")
+	flags.BoolVar(&opts.simplifyTOC, "simplify-toc", false, "Push seekable layers so that simplified pulls download only the files they keep")
+	// 修改
+
 	command.AddTrustSigningFlags(flags, &opts.untrusted, dockerCli.ContentTrustEnabled())
 
 	return cmd
@@ -57,10 +68,15 @@ func RunPush(dockerCli command.Cli, opts pushOptions) error {
 	requestPrivilege := command.RegistryAuthenticationPrivilegedFunc(dockerCli, repoInfo.Index, "push")
 
 	if !opts.untrusted {
-		return TrustedPush(ctx, dockerCli, repoInfo, ref, authConfig, requestPrivilege)
+		// 修改： 签名推送不支持推送可按文件下载的层，profile随镜像签名
+		if opts.simplifyTOC {
+			return errors.New("--simplify-toc cannot be used with content trust")
+		}
+		return trustedPush(ctx, dockerCli, repoInfo, ref, authConfig, requestPrivilege, opts)
+		// 修改
 	}
 
-	responseBody, err := imagePushPrivileged(ctx, dockerCli, authConfig, ref, requestPrivilege)
+	responseBody, err := imagePushPrivileged(ctx, dockerCli, authConfig, ref, requestPrivilege, opts)
 	if err != nil {
 		return err
 	}
@@ -69,3 +69,52 @@ func TestNewPushCommandSuccess(t *testing.T) {
 		assert.NilError(t, cmd.Execute())
 	}
 }
+
+func TestNewPushCommandSimplifyProfile(t *testing.T) {
+	var pushed types.ImagePushOptions
+	cli := test.NewFakeCli(&fakeClient{
+		imagePushFunc: func(ref string, options types.ImagePushOptions) (io.ReadCloser, error) {
+			pushed = options
+			return ioutil.NopCloser(strings.NewReader("")), nil
+		},
+	})
+	cmd := NewPushCommand(cli)
+	cmd.SetOutput(ioutil.Discard)
+	cmd.SetArgs([]string{"--simplify-profile", "--disable-content-trust", "image:tag"})
+	assert.NilError(t, cmd.Execute())
+	assert.Assert(t, pushed.SimplifyPushProfile)
+
+	// pushed along with the image to be signed with it
+	cli = test.NewFakeCli(&fakeClient{
+		imagePushFunc: func(ref string, options types.ImagePushOptions) (io.ReadCloser, error) {
+			pushed = options
+			return nil, errors.New("push failed")
+		},
+	})
+	cmd = NewPushCommand(cli)
+	cmd.SetOutput(ioutil.Discard)
+	cmd.SetArgs([]string{"--simplify-profile", "--disable-content-trust=false", "image:tag"})
+	assert.ErrorContains(t, cmd.Execute(), "push failed")
+	assert.Assert(t, pushed.SimplifyPushProfile)
+}
+
+func TestNewPushCommandSimplifyTOC(t *testing.T) {
+	var pushed types.ImagePushOptions
+	cli := test.NewFakeCli(&fakeClient{
+		imagePushFunc: func(ref string, options types.ImagePushOptions) (io.ReadCloser, error) {
+			pushed = options
+			return ioutil.NopCloser(strings.NewReader("")), nil
+		},
+	})
+	cmd := NewPushCommand(cli)
+	cmd.SetOutput(ioutil.Discard)
+	cmd.SetArgs([]string{"--simplify-toc", "--disable-content-trust", "image:tag"})
+	assert.NilError(t, cmd.Execute())
+	assert.Assert(t, pushed.SimplifyTOC)
+	assert.Assert(t, !pushed.SimplifyPushProfile)
+
+	cmd = NewPushCommand(cli)
+	cmd.SetOutput(ioutil.Discard)
+	cmd.SetArgs([]string{"--simplify-toc", "--disable-content-trust=false", "image:tag"})
+	assert.ErrorContains(t, cmd.Execute(), "--simplify-toc cannot be used with content trust")
+}
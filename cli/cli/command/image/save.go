@@ -8,6 +8,7 @@ import (
 
 	"github.com/docker/cli/cli"
 	"github.com/docker/cli/cli/command"
+	"github.com/docker/docker/api/types"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
@@ -15,6 +16,9 @@ import (
 type saveOptions struct {
 	images []string
 	output string
+	// 修改： 精简镜像保存为精简归档
+	simplified bool
+	// 修改
 }
 
 // NewSaveCommand creates a new `docker save` command
@@ -34,6 +38,9 @@ func NewSaveCommand(dockerCli command.Cli) *cobra.Command {
 	flags := cmd.Flags()
 
 	flags.StringVarP(&opts.output, "output", "o", "", "Write to a file, instead of STDOUT")
+	// 修改： 精简镜像保存为精简归档
+	flags.BoolVar(&opts.simplified, "simplified", false, "Save simplified images as they are, instead of restoring their full images")
+	// 修改
 
 	return cmd
 }
@@ -48,7 +55,15 @@ func RunSave(dockerCli command.Cli, opts saveOptions) error {
 		return errors.Wrap(err, "failed to save image")
 	}
 
-	responseBody, err := dockerCli.Client().ImageSave(context.Background(), opts.images)
+	// 修改： 添加保存选项
+	var responseBody io.ReadCloser
+	var err error
+	if opts.simplified {
+		responseBody, err = dockerCli.Client().ImageSaveSimplified(context.Background(), opts.images, types.ImageSaveOptions{Simplified: true})
+	} else {
+		responseBody, err = dockerCli.Client().ImageSave(context.Background(), opts.images)
+	}
+	// 修改
 	if err != nil {
 		return err
 	}
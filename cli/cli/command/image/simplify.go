@@ -0,0 +1,141 @@
+package image
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path"
+
+	"github.com/docker/cli/cli"
+	"github.com/docker/cli/cli/command"
+	dockeropts "github.com/docker/cli/opts"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/pkg/jsonmessage"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+type simplifyOptions struct {
+	source      string
+	target      string
+	profile     string
+	profileFrom string
+	keep        dockeropts.ListOpts
+	prune       dockeropts.ListOpts
+	// threshold is nil unless --threshold is given
+	threshold *int
+}
+
+func newSimplifyCommand(dockerCli command.Cli) *cobra.Command {
+	var opts simplifyOptions
+
+	cmd := &cobra.Command{
+		Use:   "simplify [OPTIONS] SOURCE[:TAG] TARGET[:TAG]",
+		Short: "Create a simplified image TARGET from the files of SOURCE listed in a profile",
+		Args:  cli.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts.source = args[0]
+			opts.target = args[1]
+			if !cmd.Flags().Changed("threshold") {
+				opts.threshold = nil
+			}
+			return runSimplify(dockerCli, opts)
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringVar(&opts.profile, "profile", "", "Read the profile from a file instead of using the one stored for SOURCE")
+	flags.StringVar(&opts.profileFrom, "profile-from", "", "Use the profile stored for another image instead of the one stored for SOURCE")
+	opts.threshold = flags.Int("threshold", 0, "Keep profiled files opened in at least this percentage of the recorded runs (0-100)")
+	opts.keep = dockeropts.NewListOpts(nil)
+	flags.Var(&opts.keep, "keep", "Keep files matching a gitignore-style pattern")
+	opts.prune = dockeropts.NewListOpts(nil)
+	flags.Var(&opts.prune, "prune", "Prune files matching a gitignore-style pattern unless kept by --keep")
+	return cmd
+}
+
+func runSimplify(dockerCli command.Cli, opts simplifyOptions) error {
+	options := types.ImageSimplifyOptions{
+		Target:      opts.target,
+		ProfileFrom: opts.profileFrom,
+		Threshold:   opts.threshold,
+		Keep:        opts.keep.GetAll(),
+		Prune:       opts.prune.GetAll(),
+	}
+	if opts.profile != "" && opts.profileFrom != "" {
+		return errors.New("conflicting options: --profile and --profile-from cannot be used together")
+	}
+	if opts.threshold != nil && (*opts.threshold < 0 || *opts.threshold > 100) {
+		return errors.Errorf("invalid simplify threshold %d: must be between 0 and 100", *opts.threshold)
+	}
+	if opts.profile != "" {
+		profile, err := ReadProfileFile(opts.profile)
+		if err != nil {
+			return err
+		}
+		options.Profile = profile
+	}
+
+	responseBody, err := dockerCli.Client().ImageSimplify(context.Background(), opts.source, options)
+	if err != nil {
+		return err
+	}
+	defer responseBody.Close()
+
+	var result types.ImageSimplifyResult
+	aux := func(msg jsonmessage.JSONMessage) {
+		if err := json.Unmarshal(*msg.Aux, &result); err != nil {
+			fmt.Fprintf(dockerCli.Err(), "Failed to parse aux message: %s", err)
+		}
+	}
+	if err := jsonmessage.DisplayJSONMessagesToStream(responseBody, dockerCli.Out(), aux); err != nil {
+		return err
+	}
+	if result.ID != "" {
+		fmt.Fprintln(dockerCli.Out(), result.ID)
+	}
+	return nil
+}
+
+// ReadProfileFile reads a profile from filename, either on its own or as the
+// single element of the list printed by `docker image profile inspect`, and
+// validates it.
+func ReadProfileFile(filename string) (*types.ImageProfile, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var profile types.ImageProfile
+	if bytes.HasPrefix(bytes.TrimSpace(b), []byte("[")) {
+		var profiles []types.ImageProfile
+		if err := json.Unmarshal(b, &profiles); err != nil {
+			return nil, errors.Wrapf(err, "invalid profile file %s", filename)
+		}
+		if len(profiles) != 1 {
+			return nil, errors.Errorf("profile file %s lists %d profiles, expected one", filename, len(profiles))
+		}
+		profile = profiles[0]
+	} else if err := json.Unmarshal(b, &profile); err != nil {
+		return nil, errors.Wrapf(err, "invalid profile file %s", filename)
+	}
+	if err := validateProfile(&profile); err != nil {
+		return nil, errors.Wrapf(err, "invalid profile file %s", filename)
+	}
+	return &profile, nil
+}
+
+// validateProfile checks the profile as the daemon would: its paths must be
+// absolute, and counted if it has counts.
+func validateProfile(profile *types.ImageProfile) error {
+	for _, p := range profile.Paths {
+		if !path.IsAbs(p) {
+			return errors.Errorf("path %q is not absolute", p)
+		}
+		if profile.Counts != nil && profile.Counts[p] <= 0 {
+			return errors.Errorf("path %q has no count", p)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package image
+
+import (
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/docker/cli/internal/test"
+	"github.com/docker/docker/api/types"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+	"gotest.tools/fs"
+)
+
+func TestSimplify(t *testing.T) {
+	var options types.ImageSimplifyOptions
+	cli := test.NewFakeCli(&fakeClient{
+		imageSimplifyFunc: func(source string, opts types.ImageSimplifyOptions) (io.ReadCloser, error) {
+			assert.Check(t, is.Equal(source, "app:latest"))
+			options = opts
+			return ioutil.NopCloser(strings.NewReader(`{"status":"Kept 2 files, pruned 10 files, saved 1MB"}` + "\n" +
+				`{"aux":{"ID":"sha256:0123456789abcdef","Simplify":{"FilesKept":2,"FilesPruned":10}}}` + "\n")), nil
+		},
+	})
+	cmd := newSimplifyCommand(cli)
+	cmd.SetArgs([]string{"app:latest", "app:slim"})
+	assert.NilError(t, cmd.Execute())
+	assert.Check(t, is.Equal(options.Target, "app:slim"))
+	assert.Check(t, options.Profile == nil)
+	assert.Check(t, options.Threshold == nil)
+	assert.Check(t, is.Equal(cli.OutBuffer().String(), "Kept 2 files, pruned 10 files, saved 1MB\nsha256:0123456789abcdef\n"))
+}
+
+func TestSimplifyPatterns(t *testing.T) {
+	var options types.ImageSimplifyOptions
+	cli := test.NewFakeCli(&fakeClient{
+		imageSimplifyFunc: func(source string, opts types.ImageSimplifyOptions) (io.ReadCloser, error) {
+			options = opts
+			return ioutil.NopCloser(strings.NewReader("")), nil
+		},
+	})
+	cmd := newSimplifyCommand(cli)
+	cmd.SetArgs([]string{"--profile-from", "app:1.0", "--keep", "/etc/ssl/**", "--prune", "/usr/share/doc/**", "--prune", "*.a", "app:2.0", "app:slim"})
+	assert.NilError(t, cmd.Execute())
+	assert.Check(t, is.Equal(options.ProfileFrom, "app:1.0"))
+	assert.Check(t, is.DeepEqual(options.Keep, []string{"/etc/ssl/**"}))
+	assert.Check(t, is.DeepEqual(options.Prune, []string{"/usr/share/doc/**", "*.a"}))
+}
+
+func TestSimplifyProfileFile(t *testing.T) {
+	dir := fs.NewDir(t, "simplify",
+		fs.WithFile("single.json", `{"Paths":["/bin/sh"]}`),
+		fs.WithFile("inspect.json", `[{"Image":"sha256:0123456789abcdef","Paths":["/bin/sh","/etc/app.conf"]}]`),
+		fs.WithFile("multiple.json", `[{"Paths":["/bin/sh"]},{"Paths":["/bin/ls"]}]`),
+		fs.WithFile("relative.json", `{"Paths":["bin/sh"]}`),
+		fs.WithFile("uncounted.json", `{"Paths":["/bin/sh","/bin/ls"],"Counts":{"/bin/sh":2}}`),
+	)
+	defer dir.Remove()
+
+	for _, tc := range []struct {
+		file          string
+		args          []string
+		expectedPaths []string
+		expectedError string
+	}{
+		{file: "single.json", expectedPaths: []string{"/bin/sh"}},
+		{file: "inspect.json", args: []string{"--threshold", "50"}, expectedPaths: []string{"/bin/sh", "/etc/app.conf"}},
+		{file: "multiple.json", expectedError: "lists 2 profiles, expected one"},
+		{file: "missing.json", expectedError: "no such file or directory"},
+		{file: "relative.json", expectedError: `path "bin/sh" is not absolute`},
+		{file: "uncounted.json", expectedError: `path "/bin/ls" has no count`},
+		{file: "single.json", args: []string{"--threshold", "101"}, expectedError: "invalid simplify threshold 101"},
+		{file: "single.json", args: []string{"--profile-from", "app:1.0"}, expectedError: "--profile and --profile-from cannot be used together"},
+	} {
+		t.Run(tc.file, func(t *testing.T) {
+			var options types.ImageSimplifyOptions
+			cli := test.NewFakeCli(&fakeClient{
+				imageSimplifyFunc: func(source string, opts types.ImageSimplifyOptions) (io.ReadCloser, error) {
+					options = opts
+					return ioutil.NopCloser(strings.NewReader("")), nil
+				},
+			})
+			cmd := newSimplifyCommand(cli)
+			cmd.SetArgs(append([]string{"--profile", filepath.Join(dir.Path(), tc.file), "app", "app:slim"}, tc.args...))
+			cmd.SetOutput(ioutil.Discard)
+			if tc.expectedError != "" {
+				assert.ErrorContains(t, cmd.Execute(), tc.expectedError)
+				return
+			}
+			assert.NilError(t, cmd.Execute())
+			assert.Assert(t, options.Profile != nil)
+			assert.Check(t, is.DeepEqual(options.Profile.Paths, tc.expectedPaths))
+		})
+	}
+}
@@ -26,11 +26,22 @@ type target struct {
 	name   string
 	digest digest.Digest
 	size   int64
+	// 修改： 随镜像签名的profile
+	profile *trust.SimplifyProfile
+	// 修改
 }
 
 // TrustedPush handles content trust pushing of an image
 func TrustedPush(ctx context.Context, cli command.Cli, repoInfo *registry.RepositoryInfo, ref reference.Named, authConfig types.AuthConfig, requestPrivilege types.RequestPrivilegeFunc) error {
-	responseBody, err := imagePushPrivileged(ctx, cli, authConfig, ref, requestPrivilege)
+	// 修改： 签名推送可随镜像推送并签名profile
+	return trustedPush(ctx, cli, repoInfo, ref, authConfig, requestPrivilege, pushOptions{})
+}
+
+// trustedPush pushes the image ref and signs it, along with its simplify
+// profile if opts pushes it.
+func trustedPush(ctx context.Context, cli command.Cli, repoInfo *registry.RepositoryInfo, ref reference.Named, authConfig types.AuthConfig, requestPrivilege types.RequestPrivilegeFunc, opts pushOptions) error {
+	responseBody, err := imagePushPrivileged(ctx, cli, authConfig, ref, requestPrivilege, opts)
+	// 修改
 	if err != nil {
 		return err
 	}
@@ -68,6 +79,14 @@ func PushTrustedReference(streams command.Streams, repoInfo *registry.Repository
 				target.Name = pushResult.Tag
 				target.Hashes = data.Hashes{string(dgst.Algorithm()): h}
 				target.Length = int64(pushResult.Size)
+				// 修改： 随镜像推送的profile一并签名
+				if profile, err := digest.Parse(pushResult.SimplifyProfile); err == nil {
+					if err := trust.SetSimplifyProfile(target, trust.SimplifyProfile{Digest: profile, Size: pushResult.SimplifyProfileSize}); err != nil {
+						target = nil
+						return
+					}
+				}
+				// 修改
 			}
 		}
 	}
@@ -149,6 +168,11 @@ func PushTrustedReference(streams command.Streams, repoInfo *registry.Repository
 	}
 
 	fmt.Fprintf(streams.Out(), "Successfully signed %s:%s\n", repoInfo.Name.Name(), tag)
+	// 修改
+	if target.Custom != nil {
+		fmt.Fprintf(streams.Out(), "Signed the simplify profile of %s:%s\n", repoInfo.Name.Name(), tag)
+	}
+	// 修改
 	return nil
 }
 
@@ -166,7 +190,9 @@ func AddTargetToAllSignableRoles(repo client.Repository, target *client.Target)
 }
 
 // imagePushPrivileged push the image
-func imagePushPrivileged(ctx context.Context, cli command.Cli, authConfig types.AuthConfig, ref reference.Reference, requestPrivilege types.RequestPrivilegeFunc) (io.ReadCloser, error) {
+// 修改： 添加opts参数，推送精简镜像的profile和可按文件下载的层
+func imagePushPrivileged(ctx context.Context, cli command.Cli, authConfig types.AuthConfig, ref reference.Reference, requestPrivilege types.RequestPrivilegeFunc, opts pushOptions) (io.ReadCloser, error) {
+	// 修改
 	encodedAuth, err := command.EncodeAuthToBase64(authConfig)
 	if err != nil {
 		return nil, err
@@ -174,13 +200,20 @@ func imagePushPrivileged(ctx context.Context, cli command.Cli, authConfig types.
 	options := types.ImagePushOptions{
 		RegistryAuth:  encodedAuth,
 		PrivilegeFunc: requestPrivilege,
+		// 修改： 推送精简镜像的profile和可按文件下载的层
+		SimplifyPushProfile: opts.simplifyProfile,
+		SimplifyTOC:         opts.simplifyTOC,
+		// 修改
 	}
 
 	return cli.Client().ImagePush(ctx, reference.FamiliarString(ref), options)
 }
 
 // trustedPull handles content trust pulling of an image
-func trustedPull(ctx context.Context, cli command.Cli, imgRefAndAuth trust.ImageRefAndAuth, platform string) error {
+// 修改：添加opts参数，按Notary解析出的摘要进行精简拉取
+func trustedPull(ctx context.Context, cli command.Cli, imgRefAndAuth trust.ImageRefAndAuth, opts PullOptions) error {
+	// 修改
+
 	refs, err := getTrustedPullTargets(cli, imgRefAndAuth)
 	if err != nil {
 		return err
@@ -202,8 +235,14 @@ func trustedPull(ctx context.Context, cli command.Cli, imgRefAndAuth trust.Image
 		if err != nil {
 			return err
 		}
-		// 修改： 设置simp参数为false
-		if err := imagePullPrivileged(ctx, cli, updatedImgRefAndAuth, false, false, platform); err != nil {
+		// 修改： 传递精简参数，精简的是摘要引用而不是标签
+		pullOpts := opts
+		pullOpts.all = false
+		// 只使用随镜像签名的profile
+		pullOpts.signedProfile = r.profile
+		// 记录签名验证过的完整镜像摘要
+		pullOpts.signedDigest = r.digest
+		if err := imagePullPrivileged(ctx, cli, updatedImgRefAndAuth, pullOpts); err != nil {
 			return err
 		}
 		// 修改
@@ -270,8 +309,8 @@ func getTrustedPullTargets(cli command.Cli, imgRefAndAuth trust.ImageRefAndAuth)
 }
 
 // imagePullPrivileged pulls the image and displays it to the output
-// 修改：声明添加simp参数
-func imagePullPrivileged(ctx context.Context, cli command.Cli, imgRefAndAuth trust.ImageRefAndAuth, all bool, simp bool, platform string) error {
+// 修改：以opts声明精简参数
+func imagePullPrivileged(ctx context.Context, cli command.Cli, imgRefAndAuth trust.ImageRefAndAuth, opts PullOptions) error {
 	// 修改
 	ref := reference.FamiliarString(imgRefAndAuth.Reference())
 
@@ -285,12 +324,23 @@ func imagePullPrivileged(ctx context.Context, cli command.Cli, imgRefAndAuth tru
 	options := types.ImagePullOptions{
 		RegistryAuth:  encodedAuth,
 		PrivilegeFunc: requestPrivilege,
-		All:           all,
+		All:           opts.all,
 		// 修改： 添加Simp参数
-		Simp: simp,
+		Simplify:           opts.simp,
+		SimplifyThreshold:  opts.threshold,
+		SimplifyRequired:   opts.required,
+		SimplifyUseProfile: opts.simplifyProfile,
+		SimplifyForce:      opts.force,
+		SimplifyTrusted:    !opts.untrusted,
 		// 修改
-		Platform: platform,
+		Platform: opts.platform,
+	}
+	// 修改： 内容信任只使用签名的profile
+	if opts.signedProfile != nil {
+		options.SimplifySignedProfile = opts.signedProfile.Digest.String()
 	}
+	options.SimplifySignedDigest = opts.signedDigest.String()
+	// 修改
 	responseBody, err := cli.Client().ImagePull(ctx, ref, options)
 	if err != nil {
 		return err
@@ -302,42 +352,64 @@ func imagePullPrivileged(ctx context.Context, cli command.Cli, imgRefAndAuth tru
 
 // TrustedReference returns the canonical trusted reference for an image reference
 func TrustedReference(ctx context.Context, cli command.Cli, ref reference.NamedTagged, rs registry.Service) (reference.Canonical, error) {
+	// 修改： 签名的profile由TrustedSimplifyReference返回
+	trustedRef, _, err := TrustedSimplifyReference(ctx, cli, ref, rs)
+	return trustedRef, err
+	// 修改
+}
+
+// 修改： 精简拉取只使用随镜像签名的profile
+
+// TrustedSimplifyReference returns the canonical trusted reference for an
+// image reference, and the simplify profile signed along with the image, if
+// any.
+func TrustedSimplifyReference(ctx context.Context, cli command.Cli, ref reference.NamedTagged, rs registry.Service) (reference.Canonical, *trust.SimplifyProfile, error) {
 	imgRefAndAuth, err := trust.GetImageReferencesAndAuth(ctx, rs, AuthResolver(cli), ref.String())
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	notaryRepo, err := cli.NotaryClient(imgRefAndAuth, []string{"pull"})
 	if err != nil {
-		return nil, errors.Wrap(err, "error establishing connection to trust repository")
+		return nil, nil, errors.Wrap(err, "error establishing connection to trust repository")
 	}
 
 	t, err := notaryRepo.GetTargetByName(ref.Tag(), trust.ReleasesRole, data.CanonicalTargetsRole)
 	if err != nil {
-		return nil, trust.NotaryError(imgRefAndAuth.RepoInfo().Name.Name(), err)
+		return nil, nil, trust.NotaryError(imgRefAndAuth.RepoInfo().Name.Name(), err)
 	}
 	// Only list tags in the top level targets role or the releases delegation role - ignore
 	// all other delegation roles
 	if t.Role != trust.ReleasesRole && t.Role != data.CanonicalTargetsRole {
-		return nil, trust.NotaryError(imgRefAndAuth.RepoInfo().Name.Name(), client.ErrNoSuchTarget(ref.Tag()))
+		return nil, nil, trust.NotaryError(imgRefAndAuth.RepoInfo().Name.Name(), client.ErrNoSuchTarget(ref.Tag()))
 	}
 	r, err := convertTarget(t.Target)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 
 	}
-	return reference.WithDigest(reference.TrimNamed(ref), r.digest)
+	trustedRef, err := reference.WithDigest(reference.TrimNamed(ref), r.digest)
+	return trustedRef, r.profile, err
 }
 
+// 修改
+
 func convertTarget(t client.Target) (target, error) {
 	h, ok := t.Hashes["sha256"]
 	if !ok {
 		return target{}, errors.New("no valid hash, expecting sha256")
 	}
+	// 修改： 随镜像签名的profile
+	profile, err := trust.GetSimplifyProfile(t)
+	if err != nil {
+		return target{}, err
+	}
+	// 修改
 	return target{
-		name:   t.Name,
-		digest: digest.NewDigestFromHex("sha256", hex.EncodeToString(h)),
-		size:   t.Length,
+		name:    t.Name,
+		digest:  digest.NewDigestFromHex("sha256", hex.EncodeToString(h)),
+		size:    t.Length,
+		profile: profile,
 	}, nil
 }
 
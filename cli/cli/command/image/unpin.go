@@ -0,0 +1,22 @@
+package image
+
+import (
+	"context"
+
+	"github.com/docker/cli/cli"
+	"github.com/docker/cli/cli/command"
+	"github.com/docker/docker/api/types"
+	"github.com/spf13/cobra"
+)
+
+func newUnpinCommand(dockerCli command.Cli) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "unpin IMAGE PATH [PATH...]",
+		Short: "Let pinned paths of a simplified image be evicted from the fetch cache again",
+		Args:  cli.RequiresMinArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return dockerCli.Client().ImageUnpin(context.Background(), args[0], types.ImagePinOptions{Paths: args[1:]})
+		},
+	}
+	return cmd
+}
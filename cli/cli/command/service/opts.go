@@ -514,6 +514,10 @@ type serviceOptions struct {
 	configs     opts.ConfigOpt
 
 	isolation string
+
+	// 修改： 添加服务容器以精简模式启动的选项
+	simplifyImage bool
+	// 修改
 }
 
 func newServiceOptions() *serviceOptions {
@@ -635,6 +639,7 @@ func (options *serviceOptions) ToService(ctx context.Context, apiClient client.N
 				StopGracePeriod: options.ToStopGracePeriod(flags),
 				Healthcheck:     healthConfig,
 				Isolation:       container.Isolation(options.isolation),
+				Simplify:        options.simplifyImage,
 			},
 			Networks:      networks,
 			Resources:     resources,
@@ -807,6 +812,11 @@ func addServiceFlags(flags *pflag.FlagSet, opts *serviceOptions, defaultFlagValu
 	flags.SetAnnotation(flagStopSignal, "version", []string{"1.28"})
 	flags.StringVar(&opts.isolation, flagIsolation, "", "Service container isolation mode")
 	flags.SetAnnotation(flagIsolation, "version", []string{"1.35"})
+
+	// 修改： 添加服务容器以精简模式启动的选项
+	flags.BoolVar(&opts.simplifyImage, flagSimplifyImage, false, "Run the containers of the service on simplified images, on the nodes able to")
+	flags.SetAnnotation(flagSimplifyImage, "version", []string{"1.39"})
+	// 修改
 }
 
 const (
@@ -877,6 +887,7 @@ const (
 	flagRollbackMonitor         = "rollback-monitor"
 	flagRollbackOrder           = "rollback-order"
 	flagRollbackParallelism     = "rollback-parallelism"
+	flagSimplifyImage           = "simplify-image"
 	flagInit                    = "init"
 	flagStopGracePeriod         = "stop-grace-period"
 	flagStopSignal              = "stop-signal"
@@ -476,6 +476,16 @@ func updateService(ctx context.Context, apiClient client.NetworkAPIClient, flags
 		cspec.ReadOnly = readOnly
 	}
 
+	// 修改： 添加服务容器以精简模式启动的选项
+	if flags.Changed(flagSimplifyImage) {
+		simplify, err := flags.GetBool(flagSimplifyImage)
+		if err != nil {
+			return err
+		}
+		cspec.Simplify = simplify
+	}
+	// 修改
+
 	updateString(flagStopSignal, &cspec.StopSignal)
 
 	return nil
@@ -573,6 +573,32 @@ func TestUpdateInit(t *testing.T) {
 	assert.Check(t, is.Equal(false, *cspec.Init))
 }
 
+func TestUpdateSimplify(t *testing.T) {
+	spec := &swarm.ServiceSpec{
+		TaskTemplate: swarm.TaskSpec{
+			ContainerSpec: &swarm.ContainerSpec{},
+		},
+	}
+	cspec := spec.TaskTemplate.ContainerSpec
+
+	// Update with --simplify-image=true, changed to true
+	flags := newUpdateCommand(nil).Flags()
+	flags.Set("simplify-image", "true")
+	updateService(nil, nil, flags, spec)
+	assert.Check(t, cspec.Simplify)
+
+	// Update without --simplify-image, no change
+	flags = newUpdateCommand(nil).Flags()
+	updateService(nil, nil, flags, spec)
+	assert.Check(t, cspec.Simplify)
+
+	// Update with --simplify-image=false, changed to false
+	flags = newUpdateCommand(nil).Flags()
+	flags.Set("simplify-image", "false")
+	updateService(nil, nil, flags, spec)
+	assert.Check(t, !cspec.Simplify)
+}
+
 func TestUpdateStopSignal(t *testing.T) {
 	spec := &swarm.ServiceSpec{
 		TaskTemplate: swarm.TaskSpec{
@@ -0,0 +1,39 @@
+package command
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/docker/docker/api/types"
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+)
+
+// AddSimplifyOptionalFlag adds `simplify-optional` to a set of flags of a
+// command with `--simplify-image`.
+func AddSimplifyOptionalFlag(flags *pflag.FlagSet, target *bool) {
+	flags.BoolVar(target, "simplify-optional", false, "Go ahead without simplification if the daemon does not support simplified images")
+}
+
+// SimplifySupport asks the daemon whether it supports simplified images,
+// for a command run with `--simplify-image`, and returns what it reports
+// about them. Daemons without simplification report nothing: unless
+// optional is set, the command is then failed rather than letting the
+// daemon ignore the option, otherwise a warning is printed and nil is
+// returned, and the command should go ahead without simplification. If the
+// daemon cannot be asked, an empty info is returned and the daemon is left
+// to decide.
+func SimplifySupport(ctx context.Context, dockerCli Cli, optional bool) (*types.SimplifyInfo, error) {
+	info, err := dockerCli.Client().Info(ctx)
+	if err != nil {
+		return &types.SimplifyInfo{}, nil
+	}
+	if info.Simplify != nil {
+		return info.Simplify, nil
+	}
+	if !optional {
+		return nil, errors.New("the daemon does not support simplified images: use --simplify-optional to go ahead without simplification")
+	}
+	fmt.Fprintln(dockerCli.Err(), "WARNING: the daemon does not support simplified images, going ahead without simplification")
+	return nil, nil
+}
@@ -64,6 +64,9 @@ func runDiskUsage(dockerCli command.Cli, opts diskUsageOptions) error {
 		Containers:  du.Containers,
 		Volumes:     du.Volumes,
 		Verbose:     opts.verbose,
+		// 修改： 精简镜像节省的空间
+		SimplifiedReclaimed: du.SimplifiedReclaimed,
+		// 修改
 	}
 
 	return duCtx.Write()
@@ -204,6 +204,11 @@ func prettyPrintInfo(dockerCli command.Cli, info types.Info) error {
 	}
 
 	fmt.Fprintln(dockerCli.Out(), "Live Restore Enabled:", info.LiveRestoreEnabled)
+	// 修改： 精简镜像的配置
+	if info.Simplify != nil {
+		printSimplifyInfo(dockerCli, info.Simplify)
+	}
+	// 修改
 	fmt.Fprint(dockerCli.Out(), "\n")
 
 	// Only output these warnings if the server does not support these features
@@ -358,3 +363,40 @@ func fprintlnNonEmpty(w io.Writer, label, value string) {
 		fmt.Fprintln(w, label, value)
 	}
 }
+
+// 修改： 精简镜像的配置
+
+func printSimplifyInfo(dockerCli command.Cli, simp *types.SimplifyInfo) {
+	fmt.Fprintln(dockerCli.Out(), "Simplify:")
+	fmt.Fprintln(dockerCli.Out(), " Enabled:", simp.Enabled)
+	if len(simp.Drivers) > 0 {
+		fmt.Fprintln(dockerCli.Out(), " Drivers:", strings.Join(simp.Drivers, ", "))
+	}
+	fprintlnNonEmpty(dockerCli.Out(), " Profile Dir:", simp.ProfileDir)
+	fmt.Fprintln(dockerCli.Out(), " Image Default:", simp.ImageDefault)
+	if len(simp.Registries) > 0 {
+		fmt.Fprintln(dockerCli.Out(), " Registries:", strings.Join(simp.Registries, ", "))
+	}
+	fmt.Fprintln(dockerCli.Out(), " Cache Dir:", simp.CacheDir)
+	fmt.Fprintln(dockerCli.Out(), " Cache Size:", units.BytesSize(float64(simp.CacheSize)))
+	if simp.MaxCacheSize > 0 {
+		fmt.Fprintln(dockerCli.Out(), " Max Cache Size:", units.BytesSize(float64(simp.MaxCacheSize)))
+	}
+	fmt.Fprintln(dockerCli.Out(), " Fetches:", simp.Fetches)
+	if simp.Fetches > 0 {
+		fmt.Fprintf(dockerCli.Out(), " Cache Hit Ratio: %.1f%%\n", simp.CacheHitRatio*100)
+	}
+	fmt.Fprintln(dockerCli.Out(), " Prefetch:", simp.Prefetch)
+	if simp.PrefetchRate > 0 {
+		fmt.Fprintf(dockerCli.Out(), " Prefetch Rate: %s/s\n", units.BytesSize(float64(simp.PrefetchRate)))
+	}
+	fmt.Fprintln(dockerCli.Out(), " Offline:", simp.Offline)
+	fprintlnNonEmpty(dockerCli.Out(), " Unsupported:", simp.Unsupported)
+	fprintlnNonEmpty(dockerCli.Out(), " Fetch Unsupported:", simp.FetchUnsupported)
+	fprintlnNonEmpty(dockerCli.Out(), " Fetch Health:", simp.FetchHealth)
+	if simp.FetchRestarts > 0 {
+		fmt.Fprintf(dockerCli.Out(), " Fetch Restarts: %d (last: %s)\n", simp.FetchRestarts, simp.FetchLastError)
+	}
+}
+
+// 修改
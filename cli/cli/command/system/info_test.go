@@ -207,6 +207,32 @@ func TestPrettyPrintInfo(t *testing.T) {
 	infoWithWarningsLinux.BridgeNfIptables = false
 	infoWithWarningsLinux.BridgeNfIP6tables = false
 
+	infoWithSimplify := sampleInfoNoSwarm
+	infoWithSimplify.Simplify = &types.SimplifyInfo{
+		Enabled:       true,
+		Drivers:       []string{"overlay2"},
+		ProfileDir:    "/var/lib/docker/simplify/profiles",
+		ImageDefault:  true,
+		Registries:    []string{"registry.example.com:5000", "docker.io"},
+		CacheDir:      "/var/lib/docker/simplify/fetch",
+		CacheSize:     50 * 1024 * 1024,
+		MaxCacheSize:  10 * 1024 * 1024 * 1024,
+		Fetches:       1200,
+		CacheHitRatio: 0.75,
+		Prefetch:      true,
+		PrefetchRate:  1024 * 1024,
+		// the overlay module of the daemon lacks the fetch helper
+		FetchUnsupported: "overlay module has no fetch helper support",
+	}
+
+	infoWithSimplifyFetch := sampleInfoNoSwarm
+	simplifyFetch := *infoWithSimplify.Simplify
+	simplifyFetch.FetchUnsupported = ""
+	simplifyFetch.FetchHealth = "healthy"
+	simplifyFetch.FetchRestarts = 2
+	simplifyFetch.FetchLastError = "the overlay module no longer points at the fetch helper"
+	infoWithSimplifyFetch.Simplify = &simplifyFetch
+
 	for _, tc := range []struct {
 		dockerInfo     types.Info
 		expectedGolden string
@@ -225,6 +251,14 @@ func TestPrettyPrintInfo(t *testing.T) {
 			expectedGolden: "docker-info-no-swarm",
 			warningsGolden: "docker-info-warnings",
 		},
+		{
+			dockerInfo:     infoWithSimplify,
+			expectedGolden: "docker-info-with-simplify",
+		},
+		{
+			dockerInfo:     infoWithSimplifyFetch,
+			expectedGolden: "docker-info-with-simplify-fetch",
+		},
 	} {
 		cli := test.NewFakeCli(&fakeClient{})
 		assert.NilError(t, prettyPrintInfo(cli, tc.dockerInfo))
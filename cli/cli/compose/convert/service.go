@@ -151,6 +151,9 @@ func Service(
 				Privileges:      &privileges,
 				Isolation:       container.Isolation(service.Isolation),
 				Init:            service.Init,
+				// 修改： 添加服务容器以精简模式启动的选项
+				Simplify: service.SimplifyImage,
+				// 修改
 			},
 			LogDriver:     logDriver,
 			Resources:     resources,
@@ -433,6 +433,15 @@ func TestServiceConvertsIsolation(t *testing.T) {
 	assert.Check(t, is.Equal(container.IsolationHyperV, result.TaskTemplate.ContainerSpec.Isolation))
 }
 
+func TestServiceConvertsSimplifyImage(t *testing.T) {
+	src := composetypes.ServiceConfig{
+		SimplifyImage: true,
+	}
+	result, err := Service("1.39", Namespace{name: "foo"}, src, nil, nil, nil, nil)
+	assert.NilError(t, err)
+	assert.Check(t, result.TaskTemplate.ContainerSpec.Simplify)
+}
+
 func TestConvertServiceSecrets(t *testing.T) {
 	namespace := Namespace{name: "foo"}
 	secrets := []composetypes.ServiceSecretConfig{
@@ -12,6 +12,7 @@ import (
 	"github.com/docker/cli/cli/compose/types"
 	"github.com/google/go-cmp/cmp/cmpopts"
 	"github.com/sirupsen/logrus"
+	yaml "gopkg.in/yaml.v2"
 	"gotest.tools/assert"
 	is "gotest.tools/assert/cmp"
 )
@@ -1261,6 +1262,30 @@ secrets:
 	assert.Check(t, is.Equal("process", actual.Services[0].Isolation))
 }
 
+func TestLoadSimplifyImage(t *testing.T) {
+	config, err := loadYAML(`
+version: '3.7'
+services:
+  foo:
+    image: alpine
+    simplify_image: true`)
+	assert.NilError(t, err)
+	assert.Assert(t, is.Len(config.Services, 1))
+	assert.Check(t, config.Services[0].SimplifyImage)
+
+	actual, err := yaml.Marshal(config.Services[0])
+	assert.NilError(t, err)
+	assert.Check(t, is.Contains(string(actual), "simplify_image: true"))
+
+	_, err = loadYAML(`
+version: '3.7'
+services:
+  foo:
+    image: alpine
+    simplfy_image: true`)
+	assert.ErrorContains(t, err, "Additional property simplfy_image is not allowed")
+}
+
 func TestLoadV35InvalidIsolation(t *testing.T) {
 	// validation should be done only on the daemon side
 	actual, err := loadYAML(`
@@ -467,44 +467,45 @@ DoTuq9lAU9Q4O1xV/59X/w8AAP//zRo7vm9CAAA=
 
 	"/data/config_schema_v3.7.json": {
 		local:   "data/config_schema_v3.7.json",
-		size:    17777,
+		size:    17824,
 		modtime: 1518458244,
 		compressed: `
-H4sIAAAAAAAC/+xcS4/bOBK++1cYmrlNPwLsYBeb2x73tHvehiPQVNnmNEVyipTTTuD/vtDTEkWKlK1O
-dzAdIEi3VHzUg8WvHsr31Xqd/KrpAXKSfF4nB2PU58fHP7QU9/XTB4n7xwzJztx/+v2xfvZLcleOY1k5
-hEqxY/u0fpMe//bwj4dyeE1iTgpKIrn9A6ipnyH8WTCEcvBTcgTUTIpkc7cq3ymUCtAw0Mnndbm59boj
-aR/0ptUGmdgn1eNzNcN6nWjAI6O9Gbqt/vJ4mf+xI7uzZ+1ttnquiDGA4r/jvVWvvzyR+2//uv/fp/t/
-PqT3m99+Hbwu5Yuwq5fPYMcEM0yKbv2kozw3P527hUmWVcSED9beEa5hyLMA81Xic4jnjuyNeG7Wd/A8
-ZOcoeZEHNdhSvREz9fLL6E8DRTBhk62p3sxiy+WXYbj2GiGGW6o3Yrhe/jaGVy3T7j0mX17uy3/P1ZyT
-89Wz9PZXMTHweS5xunyOX56dQD2SzEBxeap27pZZTZCDMEknpvU62RaMZ7bUpYD/lFM89R6u199t996b
-p3o/+M1vFN17Dy/deyqFgRdTMTW9dC0CSZ8Bd4xD7AiCtaV7RMaZNqnENGPUOMdzsgV+0wyU0AOkO5R5
-cJZdWnOinRO1HjySc0NwD9GS1Yc81ezbQK5PCRMG9oDJXTd2c7bGjiYLH0z7TJd/NivHhAklKiVZNmCC
-IJJTuSNmINdu/tZJIdifBfy7ITFYgD1vhlItP/EeZaFSRbA8hdOyT6jMcyKWOppz+IiQ/OiSGJz3Zo3+
-q261wbY83KwjrNLhLgLuJuxwSkuXBdJY/zH3HK3XScGyeOL9HOJcZsN9iyLfAibnEfHokA5+36xcbyzt
-G8IEYCpIDkE7RshAGEZ4qhXQAXmrqQnNJFH+PEHYM23w5KS8cNHfWAYKRKbTOoKZ73qTDLpwZlE3kYmp
-K6WeprxUyr0l1sBUA0F6uHK8zAkTMUoFYfCkJKvd2LvzTyCOaWc3s8UA4shQirx10nFXe2/8i5IabneO
-3UXbMH7XnenNUHrJTmJOys22a688V7DD8voC7PNQQmLCU87E8/ImDi8GSXqQ2lyDnpIDEG4O9AD0eWJ4
-n2owWmoTY+QsJ/swkWBD97+VkgMRQyJFg/NoyYlp0ilThFdjzmRRVfamlft9Seqz31EME4n+M2RHwFiI
-KtUl9HLd0yFsEIxVB6RfHupQdeKMVj9xPsbErivYfmJxGIeaB1rJCS3BMYLWIYtqQod0hCAutCNiHev3
-r4po5keSUaoLphuCuNSHPeOtLA6HtmrnjGjQt4WGPS90/D3SJlxj/z451jPUO2d8IBiYqg94OXduZBOG
-wK8Zp6ohjB/6ispD9A+Ykmh+SGR18VMX+FAvPg62bHVHDXqdCG3CS8XFZ23awj1AFVvO9AGyOWNQGkkl
-jzsYzkRU/GGYiNauQnoK2ZFx2Fscu2AMAslSKfgpglIbgsEchwZaIDOnVCqzOMZ0J60uVt/lrIYbstL9
-H4mNv05iQ580Nddha20yJlKpQATPhjZSpXskFFIFyKRTFAMHmxVYhwajaTTbC8JDx8zkandlSsGY8GEv
-OMuZ/9A4rDYCr9VYzQ3RJuBZlMueiBCmA4SIyOBAcMbVUR3Mned+WkVioGHhvprvrtnIxkk/C3rZ29h4
-0Y/7UBU6GMRVNEKnEVe7owL9c3jogY4q8s1VfrxZKdJ3vrbXj0YEw6qeZtqAoKf4hbZsVAqZG3fFRV0V
-Fdn7UzHu2CT6rDbNCT+EFSGpVB7V3MhGd6W8PhcthvMHp7bnnIhjcyZYXuTJ5/UnX8QaL5lXhvZWDmgC
-0Pt871eJz+XNnjGcsuXzdLvGsBViZj+JlaqdaoLokwYbS6YbMkLNEkyTrVVWcuZthQE8ugFWGKEhGGRW
-fajFrn2IBfp9VlEMy0EW5lp4StDMB7h221mvt6Wtx0yZUI/StqCnXrWxTrsEzSQGj4DIqjpYFHhBUJxR
-okMA8YYkP0rOt4Q+p02P1BxQPoHGFUHCOXCm8xh0m2TAyekqy6kLWoTxAiElNKIk0uhKMCPx+iVz8pK2
-y1YkgXNbn1PMwLcmiOqesfFlfTLudwy1qdMQUjW/Dd3/2Zvaia0GXK4OlREDHybxYRL9DF0VG+ilzMGZ
-BFimDVAVsfWKJIdchrpAbk/5WypH0CVM8BUg34sAHNR7EICMpgNr8Fw5Y9pXqqLcbtk19pCc1SHmEuZN
-paj3EeN5bnR1pd8pgXiujI5yrV+ZyOTX+TBrAWkrTihY0OxWQWuDhAkzu1fBFotC2AGCoDB5LMc5o4m8
-0XIJeYVAsjcoGd2q/Bs+LnC6myk8Px4wCgyH2nNoza+tia7DjGmKYKBbuWteXMVbwrQVJM9NTivoqJMj
-4UVEDeSqrhFf7iBi8Nn5rVNIpy3ZAgFaTBdXVBtRQ5VKtXwdI9wqtAln0Zki+VIeNrqxKnEGDO/BdxZb
-4UlTv2/feTfusPRo9alLSN11stpEq9h7MJbbf5Ubs4uPriQaMYbQQ1S+bWba4wekL0fpeqdLa6g+PNoM
-j/az2//7s9XmM9Dgp4YVVfjLzRssNOKbjXeg/59EraNL2KnWhupDrT+LWq2mm556x8WfKYlHdwav+rWe
-bhs2meM/c/BFWN5N+UqV1qKNsKc5X/DeevhtAslOdfC/EgRcoN3RrVMrhbLqmhvtb9H9vqQdP/oyveRT
-nEbFye/DBpf6q/LNQD4WSf11TQ8obKICc9f36nZ7TfvduKfjbxi9rsq/59X/AwAA//+9o87pcUUAAA==
+H4sIAAAAAAAC/+xcS2/jOBK++1cQnLmNnTSwg11s3/a4p93zBm6BlsoyJxTJISl33A3/94Wsh/XgS7bS
+SWMSYDCJVCyyHix+VSz19xVC+FedHqAg+DPCB2Pk58fHP7Tgm/rpg1D5Y6bI3mw+/f5YP/sFr1cIYZpV
+Q1LB9zRP6jfJ8W8P/3iohtck5iShIhK7PyA19TMFf5ZUQTX4CR9BaSo43q5X1TuphARlKGj8GX1fIYRQ
+R9I+6LHVRlGe4xVCCJ0vHBDCGtSRpj0O3VJ/ebzyf+zI1mOuvcUihBCWxBhQ/L/TtSGEEP7yRDbf/rX5
+36fNPx+Szfa3XwevK/0q2NfTZ7CnnBoqeDc/7ijPzW/nbmKSZRdiwgZz7wnTMJSZg/kq1HNI5o7sjWRu
+5rfIPBTnKFhZBC3YUr2RMPX0y9hPQ6rAhF22pnozj62mX0bgOmqEBG6p3kjgevr7BF61QtvXiL+8bKr/
+ny88vfxqLr31XYQYxDybOm0xx63PTqEOTWYgmThdVm7XWU1QADe4UxNCeFdSlo21Ljj8p2Lx1HuI0Pdx
+eD+vh+8Hf7mdAiG/LO1P5YsGXsxFKP/UtQpE+gxqTxnEjiAq1x6VMapNIlSS0dRYxzOyA3YXh5SkB0j2
+ShRBLvuklkRbGbURPFJyQ1QO0ZrVhyLR9NtAr0+YcgM5KLzuxm7Po7ETZuGNOd7TCCG0XVkY4pTIhGTZ
+QAiiFDlVK6IGCm2XD+GS0z9L+HdDYlQJY76ZEnJ5xrkSpUwkUdUu9Osep6IoCF9qa86RI0Lzk0NisN+b
+Ofqvutl6D53ShOVBtnARCDfhgIMQ1qJUaWz8mLuPEMIlzeKJ8znEhciG6+ZlsQOFzxPi88r393ZlezOy
+viGUg0o4KSDoxwoy4IYSlmgJ6YC8tZTHMjgqnmMFOdVGnayUVyn6C8tAAs90IvhtoRdn0KUzi4aJjPuO
+lJpNdahUa8OjgYkGotLDjeNFQSiPMSpwo05S0DqMvbv4BPyYdH4zWw3Aj1QJXrRBOu5o741/kULD/cGx
+O2gbwdfdnt6uh5R7oQpSLbade+U4gi2e11dgX4YKEhOWMMqfl3dxeDGKJAehzS3oCR+AMHNID5A+e4b3
+qQajhTYxTk4LkoeJOB2G/50QDAgfEsk0yEcLRkxTTvER3ow58aKm7LEVeV6Ruvx3ksNEov9M0SOoWIgq
+5DX1sp3TIWwQzFX7P/jLQ52qevbo5TfGppjYdgSPn4wkjEPNA6sUJK3AsQKtQx7VpA7JBEFcaSfEOjbu
+35TRzM8ko0wXLDcEpHEtb46Xxbj+1eyMEg36vtSwF4WOv0f6hG3s371jHUOdPOMTwQCrPuBlzLqQbRgC
+v2aeKmnmjhWXCNHfYFIo80Myq2ucusKHevLz2jnouvTwoNfJ0DxRKi4/a8sW9gGy3DGqD5DNGaOEEalg
+cRvDWoiK3wyebO0mpCcVPVIGOWRBGKOAZIng7BRBqQ1RwRqHhrRU1JwSIc3iGNNetLp6fVezGi5oVO5H
+H4WNv0xhQ9NCMro/JVPkb3NyfdKpuQ2Ka5NRnggJPDyLETLJFUkhkaCosGpuEI+zUtWZxISNpjknLLQr
+TSH3N1YgjAnHhpLRgrr3mMXJI+BdDe3siM65GVFchPckFP58IiKROBA146S57OO94zhbRUKm4T3/hd+6
+WcjWSj8LqY2XsXWCJfseLHUw57vQcJ1EIAHLhfXPEdAHNrqQb28K+81MkaH2tQ+JaACBUL/arKk2wNNT
+/EQ7Ork5maP+2O3bUJHcXbmxjovfq7X//hhRuEiFdJjmTjG6I+X1pWghn+M9QpPI6Ul7C8ppURb4M/rk
+IJqhmVfOBIbMfPjfFXurwk51smdU+Xz57O/uGHZOoHntJ6PKrq9nok8a7EPx92/4HQxnVJMdCwPCyqHU
+kbDbEJoCoyhoK9TtkRnQ7/PSxdACRGluhadEmfkAd9ylhq6tMO31jc+FepRjD3rqXU7WVZqgm8TgEeDZ
+5dosCrwokIymRIcA4h13AkowtiPpc9K0VM0B5R40LokijAGjuggtvjEZI6ebPAchhPCeUFYqSEgacYPS
+2IpTI9TtUxbkJWmnvZAE9i1CCGGhMnDNCbwsJlu43RmbPVXa1FULIZu/huH/7KwExV4eXI8OmREDHy7x
+4RK9UFTnBnopd7AWAdAiXYOyjL3ewAUUItQ04sBqM24IRiZXULV7Etd95XtRgIU6Bw6KpsnAGxxHzpT2
+lS5d7vfsGnsIRusUcwn3TgWv1xETee4MdVXcqYB4IY2OCq1fKc/E1/kwawFtS0ZSGEGzexWtjSKUm9mt
+DWO1SAV7UMBT8G7Lac0IuetGaLH6vayKJ29ww3Sv8e/4FsEabnx4fjpgvfJaz2I1t7XcVqoyxOriCLqZ
+u17HVbwn+L0APzc1rWCgxkfCyogrk5uaTFy1g4jBZ+unUSGbtmQLJGgxTV9RXUcNVXVtufg9RrizaBuu
+olNJiqUibJRG0LUt/B3GznLHHWXq9x0719OGTIdVn7qC1LrT1TbaxM6Nsdz6Kb+u31tEI8aQ9BBVb5tZ
+9vgB5ctJud4a0hqqj4g2I6L97P7//ny1+Wo0+GXihSr8oecdHhrxicc7sP9PYtbJIWw1a0P1Ydafxayj
+ppueeaeXPz6NRzcSrxBC3V1Pt4wxmeXffnBlWM5Fua4qR5M2yvZLvuC59fCbB8n6Gv5fCQIu0B1pt+mo
+hNJqd/rpujuWtOMnH7IjhAk/jayE0Pdhg0v9Efr2vHaT1C15PaCwjUrMbZ+3j9tr2s/MHQ2Cw+x1Vf13
+Xv1/AKZrzYCgRQAA
 `,
 	},
 
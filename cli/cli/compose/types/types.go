@@ -144,6 +144,9 @@ type ServiceConfig struct {
 	User            string                           `yaml:",omitempty"`
 	Volumes         []ServiceVolumeConfig            `yaml:",omitempty"`
 	WorkingDir      string                           `mapstructure:"working_dir" yaml:"working_dir,omitempty"`
+	// 修改： 添加服务容器以精简模式启动的选项
+	SimplifyImage bool `mapstructure:"simplify_image" yaml:"simplify_image,omitempty"`
+	// 修改
 
 	Extras map[string]interface{} `yaml:",inline"`
 }
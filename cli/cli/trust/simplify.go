@@ -0,0 +1,51 @@
+package trust
+
+import (
+	canonicaljson "github.com/docker/go/canonical/json"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
+	"github.com/theupdateframework/notary/client"
+)
+
+// SimplifyProfile is the simplify profile pushed along with an image, signed
+// in the custom data of the target of its tag.
+type SimplifyProfile struct {
+	Digest digest.Digest `json:"digest"`
+	Size   int64         `json:"size"`
+}
+
+// targetCustom is the custom data of the target of a tag.
+type targetCustom struct {
+	SimplifyProfile *SimplifyProfile `json:"simplifyProfile,omitempty"`
+}
+
+// SetSimplifyProfile records profile in the custom data of target, so that
+// it is signed along with the image.
+func SetSimplifyProfile(target *client.Target, profile SimplifyProfile) error {
+	b, err := canonicaljson.MarshalCanonical(targetCustom{SimplifyProfile: &profile})
+	if err != nil {
+		return err
+	}
+	custom := canonicaljson.RawMessage(b)
+	target.Custom = &custom
+	return nil
+}
+
+// GetSimplifyProfile returns the simplify profile signed along with the
+// image of target, or nil if none was.
+func GetSimplifyProfile(target client.Target) (*SimplifyProfile, error) {
+	if target.Custom == nil {
+		return nil, nil
+	}
+	var custom targetCustom
+	if err := canonicaljson.Unmarshal(*target.Custom, &custom); err != nil {
+		return nil, errors.Wrapf(err, "invalid custom data of target %s", target.Name)
+	}
+	if custom.SimplifyProfile == nil {
+		return nil, nil
+	}
+	if err := custom.SimplifyProfile.Digest.Validate(); err != nil {
+		return nil, errors.Wrapf(err, "invalid simplify profile of target %s", target.Name)
+	}
+	return custom.SimplifyProfile, nil
+}
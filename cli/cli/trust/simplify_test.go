@@ -0,0 +1,35 @@
+package trust
+
+import (
+	"testing"
+
+	canonicaljson "github.com/docker/go/canonical/json"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/theupdateframework/notary/client"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+func TestSimplifyProfile(t *testing.T) {
+	target := &client.Target{Name: "latest"}
+	profile, err := GetSimplifyProfile(*target)
+	assert.NilError(t, err)
+	assert.Check(t, is.Nil(profile))
+
+	signed := SimplifyProfile{Digest: digest.FromString(`{"paths":["/bin/sh"]}`), Size: 22}
+	assert.NilError(t, SetSimplifyProfile(target, signed))
+	profile, err = GetSimplifyProfile(*target)
+	assert.NilError(t, err)
+	assert.Check(t, is.DeepEqual(profile, &signed))
+
+	custom := canonicaljson.RawMessage(`{"simplifyProfile":{"digest":"sha256:abc","size":22}}`)
+	target.Custom = &custom
+	_, err = GetSimplifyProfile(*target)
+	assert.Check(t, is.ErrorContains(err, "invalid simplify profile of target latest"))
+
+	// custom data of other tools is ignored
+	custom = canonicaljson.RawMessage(`{"other":true}`)
+	profile, err = GetSimplifyProfile(*target)
+	assert.NilError(t, err)
+	assert.Check(t, is.Nil(profile))
+}
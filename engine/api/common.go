@@ -3,7 +3,13 @@ package api // import "github.com/docker/docker/api"
 // Common constants for daemon and client.
 const (
 	// DefaultVersion of Current REST API
-	DefaultVersion = "1.38"
+	// 修改： 精简镜像相关参数需要新的API版本
+	DefaultVersion = "1.39"
+
+	// SimplifyVersion is the first version of the API the simplify
+	// parameters, such as simplify-image, are accepted by.
+	SimplifyVersion = "1.39"
+	// 修改
 
 	// NoBaseImageSpecifier is the symbol used by the FROM
 	// command to specify that no base image is to be used.
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net/http"
 
+	"github.com/docker/docker/api"
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/versions"
 	"github.com/docker/docker/errdefs"
@@ -87,6 +88,11 @@ func MakeErrorHandler(err error) http.HandlerFunc {
 			response := &types.ErrorResponse{
 				Message: err.Error(),
 			}
+			// 修改： 精简镜像相关错误的错误码，旧版本API不返回
+			if version := vars["version"]; version == "" || !versions.LessThan(version, api.SimplifyVersion) {
+				response.Code = errorCode(err)
+			}
+			// 修改
 			WriteJSON(w, statusCode, response)
 		} else {
 			http.Error(w, grpc.ErrorDesc(err), statusCode)
@@ -94,6 +100,30 @@ func MakeErrorHandler(err error) http.HandlerFunc {
 	}
 }
 
+// 修改： 精简镜像相关错误的错误码
+
+type errorCoder interface {
+	ErrorCode() string
+}
+
+// errorCode returns the code of err, or of the first of its causes that has
+// one, or "" if none has.
+func errorCode(err error) string {
+	for err != nil {
+		if e, ok := err.(errorCoder); ok {
+			return e.ErrorCode()
+		}
+		e, ok := err.(causer)
+		if !ok {
+			break
+		}
+		err = e.Cause()
+	}
+	return ""
+}
+
+// 修改
+
 // statusCodeFromGRPCError returns status code according to gRPC error
 func statusCodeFromGRPCError(err error) int {
 	switch grpc.Code(err) {
@@ -1,9 +1,14 @@
 package httputils // import "github.com/docker/docker/api/server/httputils"
 
 import (
+	"context"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
+
+	"github.com/docker/docker/api"
+	"github.com/docker/docker/api/types/versions"
 )
 
 // BoolValue transforms a form value in different formats into a boolean type.
@@ -21,6 +26,99 @@ func BoolValueOrDefault(r *http.Request, k string, d bool) bool {
 	return BoolValue(r, k)
 }
 
+// 修改： 添加对精简镜像参数的严格解析
+// StrictBoolValue parses a form value which must be one of yes/no/true/false.
+// It returns nil if the value is missing, and an error for any other value.
+func StrictBoolValue(r *http.Request, k string) (*bool, error) {
+	s := strings.ToLower(strings.TrimSpace(r.FormValue(k)))
+	var v bool
+	switch s {
+	case "":
+		return nil, nil
+	case "yes", "true":
+		v = true
+	case "no", "false":
+		v = false
+	default:
+		return nil, invalidBoolValueError{param: k, value: r.FormValue(k)}
+	}
+	return &v, nil
+}
+
+// StrictBoolValueOrDefault parses a form value as StrictBoolValue does, and
+// returns d if it is missing.
+func StrictBoolValueOrDefault(r *http.Request, k string, d bool) (bool, error) {
+	v, err := StrictBoolValue(r, k)
+	if err != nil || v == nil {
+		return d, err
+	}
+	return *v, nil
+}
+
+type invalidBoolValueError struct {
+	param string
+	value string
+}
+
+func (e invalidBoolValueError) Error() string {
+	return "invalid value for " + e.param + ": " + e.value + " (expected yes, no, true or false)"
+}
+
+func (e invalidBoolValueError) InvalidParameter() {}
+
+// CheckSimplifyVersion returns an error if the form of r has any of the
+// simplify parameters, named simplify-* or else listed in params, while the
+// API version of the request is older than the one they were introduced in.
+// The form must be parsed.
+func CheckSimplifyVersion(ctx context.Context, r *http.Request, params ...string) error {
+	version := VersionFromContext(ctx)
+	if version == "" || !versions.LessThan(version, api.SimplifyVersion) {
+		return nil
+	}
+	var found []string
+	for k := range r.Form {
+		if strings.HasPrefix(k, "simplify-") {
+			found = append(found, k)
+			continue
+		}
+		for _, p := range params {
+			if k == p {
+				found = append(found, k)
+				break
+			}
+		}
+	}
+	if len(found) == 0 {
+		return nil
+	}
+	sort.Strings(found)
+	return simplifyVersionError{param: found[0], version: version}
+}
+
+// CheckSimplifyFieldVersion returns an error if the API version of the
+// request is older than the one simplification was introduced in. It is
+// called when the simplify field of the request body named field is set.
+func CheckSimplifyFieldVersion(ctx context.Context, field string) error {
+	version := VersionFromContext(ctx)
+	if version == "" || !versions.LessThan(version, api.SimplifyVersion) {
+		return nil
+	}
+	return simplifyVersionError{param: field, version: version}
+}
+
+type simplifyVersionError struct {
+	param   string
+	version string
+}
+
+func (e simplifyVersionError) Error() string {
+	return e.param + " requires API version " + api.SimplifyVersion + ", but the request uses version " + e.version
+}
+
+func (e simplifyVersionError) InvalidParameter() {}
+
+// 修改
+
 // Int64ValueOrZero parses a form value into an int64 type.
 // It returns 0 if the parsing fails.
 func Int64ValueOrZero(r *http.Request, k string) int64 {
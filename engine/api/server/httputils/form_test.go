@@ -1,9 +1,12 @@
 package httputils // import "github.com/docker/docker/api/server/httputils"
 
 import (
+	"context"
 	"net/http"
 	"net/url"
 	"testing"
+
+	"github.com/docker/docker/errdefs"
 )
 
 func TestBoolValue(t *testing.T) {
@@ -103,3 +106,107 @@ func TestInt64ValueOrDefaultWithError(t *testing.T) {
 		t.Fatal("Expected an error.")
 	}
 }
+
+func TestStrictBoolValue(t *testing.T) {
+	cases := map[string]bool{
+		"yes":   true,
+		"YES":   true,
+		"true":  true,
+		"no":    false,
+		"false": false,
+	}
+
+	for c, e := range cases {
+		v := url.Values{}
+		v.Set("test", c)
+		r, _ := http.NewRequest("POST", "", nil)
+		r.Form = v
+
+		a, err := StrictBoolValue(r, "test")
+		if err != nil {
+			t.Fatalf("Value: %s, unexpected error: %v", c, err)
+		}
+		if a == nil || *a != e {
+			t.Fatalf("Value: %s, expected: %v, actual: %v", c, e, a)
+		}
+	}
+
+	r, _ := http.NewRequest("POST", "", nil)
+	r.Form = url.Values{}
+	if a, err := StrictBoolValue(r, "test"); err != nil || a != nil {
+		t.Fatalf("Expected nil value for missing parameter, got %v, %v", a, err)
+	}
+
+	for _, c := range []string{"1", "0", "on", "maybe"} {
+		v := url.Values{}
+		v.Set("test", c)
+		r, _ := http.NewRequest("POST", "", nil)
+		r.Form = v
+
+		_, err := StrictBoolValue(r, "test")
+		if !errdefs.IsInvalidParameter(err) {
+			t.Fatalf("Value: %s, expected invalid parameter error, got: %v", c, err)
+		}
+	}
+}
+
+func TestCheckSimplifyVersion(t *testing.T) {
+	cases := []struct {
+		version string
+		form    url.Values
+		params  []string
+		err     string
+	}{
+		{version: "1.38", form: url.Values{"checkpoint": {"c1"}}},
+		{version: "1.38", form: url.Values{"sparse": {"1"}}},
+		{version: "1.38", form: url.Values{"sparse": {"1"}}, params: []string{"sparse"}, err: "sparse requires API version 1.39, but the request uses version 1.38"},
+		{version: "1.39", form: url.Values{"sparse": {"1"}}, params: []string{"sparse"}},
+		{version: "1.38", form: url.Values{"simplify-image": {"yes"}}, err: "simplify-image requires API version 1.39, but the request uses version 1.38"},
+		{version: "1.38", form: url.Values{"simplify-threshold": {"50"}, "simplify-keep": {"/etc"}}, err: "simplify-keep requires API version 1.39, but the request uses version 1.38"},
+		{version: "1.39", form: url.Values{"simplify-image": {"yes"}}},
+	}
+
+	for _, c := range cases {
+		r, _ := http.NewRequest("POST", "", nil)
+		r.Form = c.form
+		ctx := context.WithValue(context.Background(), APIVersionKey, c.version)
+		err := CheckSimplifyVersion(ctx, r, c.params...)
+		if c.err == "" {
+			if err != nil {
+				t.Fatalf("Version: %s, form: %v, unexpected error: %v", c.version, c.form, err)
+			}
+			continue
+		}
+		if !errdefs.IsInvalidParameter(err) || err.Error() != c.err {
+			t.Fatalf("Version: %s, form: %v, expected invalid parameter error %q, got: %v", c.version, c.form, c.err, err)
+		}
+	}
+}
+
+func TestCheckSimplifyFieldVersion(t *testing.T) {
+	ctx := context.WithValue(context.Background(), APIVersionKey, "1.38")
+	err := CheckSimplifyFieldVersion(ctx, "SimplifyProfile")
+	if !errdefs.IsInvalidParameter(err) || err.Error() != "SimplifyProfile requires API version 1.39, but the request uses version 1.38" {
+		t.Fatalf("expected invalid parameter error, got: %v", err)
+	}
+	ctx = context.WithValue(context.Background(), APIVersionKey, "1.39")
+	if err := CheckSimplifyFieldVersion(ctx, "SimplifyProfile"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestStrictBoolValueOrDefault(t *testing.T) {
+	r, _ := http.NewRequest("POST", "", nil)
+	r.Form = url.Values{}
+	if v, err := StrictBoolValueOrDefault(r, "test", true); err != nil || !v {
+		t.Fatalf("Expected the default for a missing parameter, got %v, %v", v, err)
+	}
+	r.Form.Set("test", "no")
+	if v, err := StrictBoolValueOrDefault(r, "test", true); err != nil || v {
+		t.Fatalf("Expected false, got %v, %v", v, err)
+	}
+	r.Form.Set("test", "nope")
+	if _, err := StrictBoolValueOrDefault(r, "test", false); !errdefs.IsInvalidParameter(err) {
+		t.Fatalf("Expected invalid parameter error, got: %v", err)
+	}
+}
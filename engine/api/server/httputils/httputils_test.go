@@ -1,6 +1,11 @@
 package httputils // import "github.com/docker/docker/api/server/httputils"
 
-import "testing"
+import (
+	"testing"
+
+	"github.com/docker/docker/errdefs"
+	"github.com/pkg/errors"
+)
 
 // matchesContentType
 func TestJsonContentType(t *testing.T) {
@@ -16,3 +21,17 @@ func TestJsonContentType(t *testing.T) {
 		t.Fail()
 	}
 }
+
+type codedError struct{}
+
+func (codedError) Error() string     { return "coded" }
+func (codedError) ErrorCode() string { return "Coded" }
+
+func TestErrorCode(t *testing.T) {
+	if code := errorCode(errdefs.InvalidParameter(errors.Wrap(codedError{}, "wrapped"))); code != "Coded" {
+		t.Fatalf("expected the code of the cause, got %q", code)
+	}
+	if code := errorCode(errdefs.InvalidParameter(errors.New("plain"))); code != "" {
+		t.Fatalf("expected no code, got %q", code)
+	}
+}
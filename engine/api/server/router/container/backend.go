@@ -25,7 +25,9 @@ type execBackend interface {
 type copyBackend interface {
 	ContainerArchivePath(name string, path string) (content io.ReadCloser, stat *types.ContainerPathStat, err error)
 	ContainerCopy(name string, res string) (io.ReadCloser, error)
-	ContainerExport(name string, out io.Writer) error
+	// 修改： 添加导出精简容器的选项
+	ContainerExport(name string, out io.Writer, simpCfg backend.ContainerExportSimplifyConfig) error
+	// 修改
 	ContainerExtractToDir(name, path string, copyUIDGID, noOverwriteDirNonDir bool, content io.Reader) error
 	ContainerStatPath(name string, path string) (stat *types.ContainerPathStat, err error)
 }
@@ -39,8 +41,8 @@ type stateBackend interface {
 	ContainerResize(name string, height, width int) error
 	ContainerRestart(name string, seconds *int) error
 	ContainerRm(name string, config *types.ContainerRmConfig) error
-	// 修改： 添加simpString参数
-	ContainerStart(name string, hostConfig *container.HostConfig, checkpoint string, checkpointDir string, simpString string) error
+	// 修改： 添加simpCfg参数
+	ContainerStart(name string, hostConfig *container.HostConfig, checkpoint string, checkpointDir string, simpCfg backend.ContainerStartSimplifyConfig) error
 	// 修改
 	ContainerStop(name string, seconds *int) error
 	ContainerUnpause(name string) error
@@ -71,8 +73,21 @@ type systemBackend interface {
 
 type commitBackend interface {
 	CreateImageFromContainer(name string, config *backend.CreateImageConfig) (imageID string, err error)
+	// 修改： 精简提交后汇总精简结果
+	SimplifySummary(ctx context.Context, imageID string, withPaths bool) (*types.SimplifySummary, error)
+	SimplifyCommitDryRun(ctx context.Context, name string, config *backend.CreateImageConfig) (*types.SimplifySummary, error)
+	// 修改
+}
+
+// 修改： 记录容器访问的文件
+type simplifyBackend interface {
+	ContainerSimplifyRecord(name string) error
+	ContainerSimplifyProfile(name string) (*types.ContainerSimplifyProfile, error)
+	ContainerSimplifyFetches(name string, options types.ContainerSimplifyFetchesOptions) (*types.ContainerSimplifyFetches, error)
 }
 
+// 修改
+
 // Backend is all the methods that need to be implemented to provide container specific functionality.
 type Backend interface {
 	commitBackend
@@ -82,4 +97,7 @@ type Backend interface {
 	monitorBackend
 	attachBackend
 	systemBackend
+	// 修改： 记录容器访问的文件
+	simplifyBackend
+	// 修改
 }
@@ -43,6 +43,10 @@ func (r *containerRouter) initRoutes() {
 		router.NewGetRoute("/containers/{name:.*}/attach/ws", r.wsContainersAttach),
 		router.NewGetRoute("/exec/{id:.*}/json", r.getExecByID),
 		router.NewGetRoute("/containers/{name:.*}/archive", r.getContainersArchive),
+		// 修改： 获取容器的文件访问记录
+		router.NewGetRoute("/containers/{name:.*}/simplify/profile", r.getContainerSimplifyProfile),
+		router.NewGetRoute("/containers/{name:.*}/simplify/fetches", r.getContainerSimplifyFetches),
+		// 修改
 		// POST
 		router.NewPostRoute("/containers/create", r.postContainersCreate),
 		router.NewPostRoute("/containers/{name:.*}/kill", r.postContainersKill),
@@ -62,6 +66,9 @@ func (r *containerRouter) initRoutes() {
 		router.NewPostRoute("/containers/{name:.*}/update", r.postContainerUpdate),
 		router.NewPostRoute("/containers/prune", r.postContainersPrune, router.WithCancel),
 		router.NewPostRoute("/commit", r.postCommit),
+		// 修改： 开始记录容器访问的文件
+		router.NewPostRoute("/containers/{name:.*}/simplify/record", r.postContainerSimplifyRecord),
+		// 修改
 		// PUT
 		router.NewPutRoute("/containers/{name:.*}/archive", r.putContainersArchive),
 		// DELETE
@@ -1,13 +1,16 @@
 package container // import "github.com/docker/docker/api/server/router/container"
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"strconv"
 	"syscall"
+	"time"
 
 	"github.com/docker/docker/api/server/httputils"
 	"github.com/docker/docker/api/types"
@@ -28,6 +31,11 @@ func (s *containerRouter) postCommit(ctx context.Context, w http.ResponseWriter,
 	if err := httputils.ParseForm(r); err != nil {
 		return err
 	}
+	// 修改： 旧版本API的请求不接受精简参数
+	if err := httputils.CheckSimplifyVersion(ctx, r, "verbose"); err != nil {
+		return err
+	}
+	// 修改
 
 	if err := httputils.CheckForJSON(r); err != nil {
 		return err
@@ -40,10 +48,44 @@ func (s *containerRouter) postCommit(ctx context.Context, w http.ResponseWriter,
 		pause = true
 	}
 
-	config, _, _, err := s.decoder.DecodeConfig(r.Body)
+	// 修改： 请求体中可包含精简提交使用的profile
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	config, _, _, err := s.decoder.DecodeConfig(bytes.NewReader(body))
 	if err != nil && err != io.EOF { //Do not fail if body is empty.
 		return err
 	}
+	var simplifyBody struct {
+		SimplifyProfile *types.ImageProfile
+	}
+	if len(body) != 0 {
+		if err := json.Unmarshal(body, &simplifyBody); err != nil {
+			return errdefs.InvalidParameter(err)
+		}
+	}
+	if simplifyBody.SimplifyProfile != nil {
+		if err := httputils.CheckSimplifyFieldVersion(ctx, "SimplifyProfile"); err != nil {
+			return err
+		}
+	}
+	// 修改
+
+	// 修改： 严格解析精简提交的布尔参数，无效的值不能当作true
+	simp, err := httputils.StrictBoolValueOrDefault(r, "simplify-image", false)
+	if err != nil {
+		return err
+	}
+	simplifyForce, err := httputils.StrictBoolValueOrDefault(r, "simplify-force", false)
+	if err != nil {
+		return err
+	}
+	dryRun, err := httputils.StrictBoolValueOrDefault(r, "simplify-dry-run", false)
+	if err != nil {
+		return err
+	}
+	// 修改
 
 	commitCfg := &backend.CreateImageConfig{
 		Pause:   pause,
@@ -55,16 +97,49 @@ func (s *containerRouter) postCommit(ctx context.Context, w http.ResponseWriter,
 		Changes: r.Form["changes"],
 
 		// 修改： 添加Simp参数的解析
-		Simp: r.Form.Get("simplify-image"),
+		Simp:            simp,
+		SimplifyKeep:    r.Form["simplify-keep"],
+		SimplifyPrune:   r.Form["simplify-prune"],
+		SimplifyProfile: simplifyBody.SimplifyProfile,
+		SimplifyForce:   simplifyForce,
 		// 修改
 	}
 
+	// 修改： 解析精简阈值，未指定时使用拉取镜像时的阈值
+	if r.Form.Get("simplify-threshold") != "" {
+		threshold, err := strconv.Atoi(r.Form.Get("simplify-threshold"))
+		if err != nil {
+			return errdefs.InvalidParameter(errors.Wrap(err, "invalid simplify-threshold"))
+		}
+		commitCfg.SimplifyThreshold = &threshold
+	}
+	// 修改
+
+	// 修改： 精简提交的试运行只返回精简结果，不创建镜像
+	if dryRun {
+		summary, err := s.backend.SimplifyCommitDryRun(ctx, r.Form.Get("container"), commitCfg)
+		if err != nil {
+			return err
+		}
+		return httputils.WriteJSON(w, http.StatusOK, &types.ContainerCommitResponse{Simplify: summary})
+	}
+	// 修改
+
 	imgID, err := s.backend.CreateImageFromContainer(r.Form.Get("container"), commitCfg)
 	if err != nil {
 		return err
 	}
 
-	return httputils.WriteJSON(w, http.StatusCreated, &types.IDResponse{ID: imgID})
+	// 修改： 精简提交时返回精简结果
+	resp := &types.ContainerCommitResponse{ID: imgID}
+	if commitCfg.Simp {
+		resp.Simplify, err = s.backend.SimplifySummary(ctx, imgID, httputils.BoolValue(r, "verbose"))
+		if err != nil {
+			return err
+		}
+	}
+	return httputils.WriteJSON(w, http.StatusCreated, resp)
+	// 修改
 }
 
 func (s *containerRouter) getContainersJSON(ctx context.Context, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
@@ -160,7 +235,16 @@ func (s *containerRouter) getContainersLogs(ctx context.Context, w http.Response
 }
 
 func (s *containerRouter) getContainersExport(ctx context.Context, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
-	return s.backend.ContainerExport(vars["name"], w)
+	// 修改： 精简容器可只导出已有的文件
+	if err := httputils.ParseForm(r); err != nil {
+		return err
+	}
+	if err := httputils.CheckSimplifyVersion(ctx, r, "sparse"); err != nil {
+		return err
+	}
+	simpCfg := backend.ContainerExportSimplifyConfig{Sparse: httputils.BoolValue(r, "sparse")}
+	return s.backend.ContainerExport(vars["name"], w, simpCfg)
+	// 修改
 }
 
 type bodyOnStartError struct{}
@@ -205,11 +289,44 @@ func (s *containerRouter) postContainersStart(ctx context.Context, w http.Respon
 	checkpoint := r.Form.Get("checkpoint")
 	checkpointDir := r.Form.Get("checkpoint-dir")
 
-	// 修改： 添加获取simp属性
-	//var simp bool
-	simpString := r.Form.Get("simplify-image")
+	// 修改： 旧版本API的请求不接受精简参数
+	if err := httputils.CheckSimplifyVersion(ctx, r); err != nil {
+		return err
+	}
+	// 添加获取simp属性，在API边界完成类型转换
+	simp, err := httputils.StrictBoolValue(r, "simplify-image")
+	if err != nil {
+		return err
+	}
+	simpCfg := backend.ContainerStartSimplifyConfig{SimplifyImage: simp}
+	record, err := httputils.StrictBoolValue(r, "simplify-record")
+	if err != nil {
+		return err
+	}
+	simpCfg.SimplifyRecord = record != nil && *record
+	if simpCfg.SimplifyOffline, err = httputils.StrictBoolValue(r, "simplify-offline"); err != nil {
+		return err
+	}
+	if v := r.Form.Get("simplify-fetch-timeout"); v != "" {
+		timeout, err := time.ParseDuration(v)
+		if err != nil {
+			return errdefs.InvalidParameter(errors.Wrap(err, "invalid simplify-fetch-timeout"))
+		}
+		if timeout < 0 {
+			return errdefs.InvalidParameter(errors.Errorf("invalid simplify-fetch-timeout: %s", v))
+		}
+		simpCfg.SimplifyFetchTimeout = &timeout
+	}
+	if v := r.Form.Get("simplify-max-concurrent-fetches"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return errdefs.InvalidParameter(errors.Errorf("invalid simplify-max-concurrent-fetches: %s", v))
+		}
+		simpCfg.SimplifyMaxConcurrentFetches = &n
+	}
+	simpCfg.SimplifyAudit = r.Form.Get("simplify-audit")
 
-	if err := s.backend.ContainerStart(vars["name"], hostConfig, checkpoint, checkpointDir, simpString); err != nil {
+	if err := s.backend.ContainerStart(vars["name"], hostConfig, checkpoint, checkpointDir, simpCfg); err != nil {
 		// 修改
 		return err
 	}
@@ -669,3 +786,49 @@ func (s *containerRouter) postContainersPrune(ctx context.Context, w http.Respon
 	}
 	return httputils.WriteJSON(w, http.StatusOK, pruneReport)
 }
+
+// 修改： 记录容器访问的文件
+
+func (s *containerRouter) postContainerSimplifyRecord(ctx context.Context, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+	if err := s.backend.ContainerSimplifyRecord(vars["name"]); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (s *containerRouter) getContainerSimplifyProfile(ctx context.Context, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+	profile, err := s.backend.ContainerSimplifyProfile(vars["name"])
+	if err != nil {
+		return err
+	}
+	return httputils.WriteJSON(w, http.StatusOK, profile)
+}
+
+func (s *containerRouter) getContainerSimplifyFetches(ctx context.Context, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+	if err := httputils.ParseForm(r); err != nil {
+		return err
+	}
+	var options types.ContainerSimplifyFetchesOptions
+	if v := r.Form.Get("after"); v != "" {
+		after, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return errdefs.InvalidParameter(errors.Errorf("invalid after: %s", v))
+		}
+		options.After = after
+	}
+	if v := r.Form.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 0 {
+			return errdefs.InvalidParameter(errors.Errorf("invalid limit: %s", v))
+		}
+		options.Limit = limit
+	}
+	fetches, err := s.backend.ContainerSimplifyFetches(vars["name"], options)
+	if err != nil {
+		return err
+	}
+	return httputils.WriteJSON(w, http.StatusOK, fetches)
+}
+
+// 修改
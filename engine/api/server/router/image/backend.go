@@ -5,6 +5,7 @@ import (
 	"io"
 
 	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/backend"
 	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/api/types/image"
 	"github.com/docker/docker/api/types/registry"
@@ -26,16 +27,34 @@ type imageBackend interface {
 	LookupImage(name string) (*types.ImageInspect, error)
 	TagImage(imageName, repository, tag string) (string, error)
 	ImagesPrune(ctx context.Context, pruneFilters filters.Args) (*types.ImagesPruneReport, error)
+	// 修改： 管理镜像的精简profile
+	ImageProfiles() ([]*types.ImageProfileSummary, error)
+	ImageProfile(name string) (*types.ImageProfile, error)
+	ImageProfileSave(name string, profile types.ImageProfile) error
+	ImageProfileDelete(name string) error
+	ImageProfileMerge(target string, sources []string, force bool) (*types.ImageProfileSummary, error)
+	SimplifyImage(ctx context.Context, source string, options types.ImageSimplifyOptions, outStream io.Writer) error
+	DesimplifyImage(ctx context.Context, name, repository, tag string, outStream io.Writer) error
+	PrefetchImage(ctx context.Context, name string, paths []string, outStream io.Writer) error
+	PinImage(ctx context.Context, name string, paths []string, outStream io.Writer) error
+	UnpinImage(name string, paths []string) error
+	// 修改
 }
 
 type importExportBackend interface {
 	LoadImage(inTar io.ReadCloser, outStream io.Writer, quiet bool) error
 	ImportImage(src string, repository, platform string, tag string, msg string, inConfig io.ReadCloser, outStream io.Writer, changes []string) error
-	ExportImage(names []string, outStream io.Writer) error
+	// 修改： 添加精简镜像选项
+	ExportImage(names []string, outStream io.Writer, simpCfg backend.ImageSaveSimplifyConfig) error
+	// 修改
 }
 
 type registryBackend interface {
-	PullImage(ctx context.Context, image, tag string, platform *specs.Platform, metaHeaders map[string][]string, authConfig *types.AuthConfig, outStream io.Writer) error
-	PushImage(ctx context.Context, image, tag string, metaHeaders map[string][]string, authConfig *types.AuthConfig, outStream io.Writer) error
+	// 修改： 添加simpCfg参数
+	PullImage(ctx context.Context, image, tag string, platform *specs.Platform, metaHeaders map[string][]string, authConfig *types.AuthConfig, outStream io.Writer, simpCfg backend.ImagePullSimplifyConfig) error
+	// 修改
+	// 修改： 添加simpCfg参数
+	PushImage(ctx context.Context, image, tag string, metaHeaders map[string][]string, authConfig *types.AuthConfig, outStream io.Writer, simpCfg backend.ImagePushSimplifyConfig) error
+	// 修改
 	SearchRegistryForImages(ctx context.Context, filtersArgs string, term string, limit int, authConfig *types.AuthConfig, metaHeaders map[string][]string) (*registry.SearchResults, error)
 }
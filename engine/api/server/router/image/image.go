@@ -32,13 +32,29 @@ func (r *imageRouter) initRoutes() {
 		router.NewGetRoute("/images/{name:.*}/get", r.getImagesGet),
 		router.NewGetRoute("/images/{name:.*}/history", r.getImagesHistory),
 		router.NewGetRoute("/images/{name:.*}/json", r.getImagesByName),
+		// 修改： 镜像的精简profile
+		router.NewGetRoute("/images/simplify/profiles", r.getImagesSimplifyProfiles),
+		router.NewGetRoute("/images/{name:.*}/simplify/profile", r.getImagesSimplifyProfile),
+		// 修改
 		// POST
 		router.NewPostRoute("/images/load", r.postImagesLoad),
 		router.NewPostRoute("/images/create", r.postImagesCreate, router.WithCancel),
 		router.NewPostRoute("/images/{name:.*}/push", r.postImagesPush, router.WithCancel),
 		router.NewPostRoute("/images/{name:.*}/tag", r.postImagesTag),
 		router.NewPostRoute("/images/prune", r.postImagesPrune, router.WithCancel),
+		// 修改： 镜像的精简profile
+		router.NewPostRoute("/images/{name:.*}/simplify/profile", r.postImagesSimplifyProfile),
+		router.NewPostRoute("/images/{name:.*}/simplify/profile/merge", r.postImagesSimplifyProfileMerge),
+		router.NewPostRoute("/images/{name:.*}/simplify", r.postImagesSimplify, router.WithCancel),
+		router.NewPostRoute("/images/{name:.*}/desimplify", r.postImagesDesimplify, router.WithCancel),
+		router.NewPostRoute("/images/{name:.*}/prefetch", r.postImagesPrefetch, router.WithCancel),
+		router.NewPostRoute("/images/{name:.*}/simplify/pin", r.postImagesSimplifyPin, router.WithCancel),
+		router.NewPostRoute("/images/{name:.*}/simplify/unpin", r.postImagesSimplifyUnpin),
+		// 修改
 		// DELETE
+		// 修改： 必须在删除镜像的路由之前注册
+		router.NewDeleteRoute("/images/{name:.*}/simplify/profile", r.deleteImagesSimplifyProfile),
+		// 修改
 		router.NewDeleteRoute("/images/{name:.*}", r.deleteImages),
 	}
 }
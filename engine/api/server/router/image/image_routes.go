@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"io"
 	"net/http"
 	"strconv"
 	"strings"
@@ -11,6 +12,7 @@ import (
 	"github.com/containerd/containerd/platforms"
 	"github.com/docker/docker/api/server/httputils"
 	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/backend"
 	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/api/types/versions"
 	"github.com/docker/docker/errdefs"
@@ -18,6 +20,7 @@ import (
 	"github.com/docker/docker/pkg/streamformatter"
 	"github.com/docker/docker/pkg/system"
 	"github.com/docker/docker/registry"
+	"github.com/opencontainers/go-digest"
 	specs "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/pkg/errors"
 )
@@ -28,6 +31,11 @@ func (s *imageRouter) postImagesCreate(ctx context.Context, w http.ResponseWrite
 	if err := httputils.ParseForm(r); err != nil {
 		return err
 	}
+	// 修改： 旧版本API的请求不接受精简参数
+	if err := httputils.CheckSimplifyVersion(ctx, r); err != nil {
+		return err
+	}
+	// 修改
 
 	var (
 		image    = r.Form.Get("fromImage")
@@ -76,7 +84,62 @@ func (s *imageRouter) postImagesCreate(ctx context.Context, w http.ResponseWrite
 					authConfig = &types.AuthConfig{}
 				}
 			}
-			err = s.backend.PullImage(ctx, image, tag, platform, metaHeaders, authConfig, output)
+			// 修改： 添加获取simp属性
+			var simp *bool
+			simp, err = httputils.StrictBoolValue(r, "simplify-image")
+			if err != nil {
+				return err
+			}
+			simpCfg := backend.ImagePullSimplifyConfig{SimplifyImage: simp != nil && *simp, SimplifyDefault: simp == nil}
+			var threshold int64
+			threshold, err = httputils.Int64ValueOrDefault(r, "simplify-threshold", 0)
+			if err != nil {
+				return errdefs.InvalidParameter(errors.Wrap(err, "invalid simplify-threshold"))
+			}
+			simpCfg.SimplifyThreshold = int(threshold)
+			if simpCfg.SimplifyRequired, err = httputils.StrictBoolValueOrDefault(r, "simplify-required", false); err != nil {
+				return err
+			}
+			if simpCfg.SimplifyForce, err = httputils.StrictBoolValueOrDefault(r, "simplify-force", false); err != nil {
+				return err
+			}
+			if simpCfg.SimplifyTrusted, err = httputils.StrictBoolValueOrDefault(r, "simplify-trusted", false); err != nil {
+				return err
+			}
+			if signed := r.Form.Get("simplify-signed-profile"); signed != "" {
+				if _, err = digest.Parse(signed); err != nil {
+					return errdefs.InvalidParameter(errors.Wrap(err, "invalid simplify-signed-profile"))
+				}
+				simpCfg.SimplifySignedProfile = signed
+			}
+			if signed := r.Form.Get("simplify-signed-digest"); signed != "" {
+				if _, err = digest.Parse(signed); err != nil {
+					return errdefs.InvalidParameter(errors.Wrap(err, "invalid simplify-signed-digest"))
+				}
+				simpCfg.SimplifySignedDigest = signed
+			}
+			simpCfg.SimplifyProfileFrom = r.Form.Get("simplify-profile")
+			if simpCfg.SimplifyImage && r.ContentLength != 0 {
+				// 请求体为空时使用保存的或随镜像推送的profile
+				if err = httputils.CheckSimplifyFieldVersion(ctx, "profile"); err != nil {
+					return err
+				}
+				if err = httputils.CheckForJSON(r); err != nil {
+					return err
+				}
+				var profile types.ImageProfile
+				if err = json.NewDecoder(r.Body).Decode(&profile); err != nil && err != io.EOF {
+					return errdefs.InvalidParameter(err)
+				} else if err == nil {
+					simpCfg.SimplifyProfile = &profile
+				}
+				err = nil
+			}
+			if simpCfg.SimplifyProfile != nil && simpCfg.SimplifyProfileFrom != "" {
+				return errdefs.InvalidParameter(errors.New("simplify-profile cannot be used with a profile in the request body"))
+			}
+			// 修改
+			err = s.backend.PullImage(ctx, image, tag, platform, metaHeaders, authConfig, output, simpCfg)
 		} else { //import
 			src := r.Form.Get("fromSrc")
 			// 'err' MUST NOT be defined within this block, we need any error
@@ -129,12 +192,23 @@ func (s *imageRouter) postImagesPush(ctx context.Context, w http.ResponseWriter,
 	image := vars["name"]
 	tag := r.Form.Get("tag")
 
+	// 修改： 推送精简镜像的profile和可按文件下载的层
+	var simpCfg backend.ImagePushSimplifyConfig
+	var err error
+	if simpCfg.SimplifyProfile, err = httputils.StrictBoolValueOrDefault(r, "simplify-profile", false); err != nil {
+		return err
+	}
+	if simpCfg.SimplifyTOC, err = httputils.StrictBoolValueOrDefault(r, "simplify-toc", false); err != nil {
+		return err
+	}
+	// 修改
+
 	output := ioutils.NewWriteFlusher(w)
 	defer output.Close()
 
 	w.Header().Set("Content-Type", "application/json")
 
-	if err := s.backend.PushImage(ctx, image, tag, metaHeaders, authConfig, output); err != nil {
+	if err := s.backend.PushImage(ctx, image, tag, metaHeaders, authConfig, output, simpCfg); err != nil {
 		if !output.Flushed() {
 			return err
 		}
@@ -147,6 +221,11 @@ func (s *imageRouter) getImagesGet(ctx context.Context, w http.ResponseWriter, r
 	if err := httputils.ParseForm(r); err != nil {
 		return err
 	}
+	// 修改： 旧版本API的请求不接受精简参数
+	if err := httputils.CheckSimplifyVersion(ctx, r, "simplified"); err != nil {
+		return err
+	}
+	// 修改
 
 	w.Header().Set("Content-Type", "application/x-tar")
 
@@ -159,7 +238,10 @@ func (s *imageRouter) getImagesGet(ctx context.Context, w http.ResponseWriter, r
 		names = r.Form["names"]
 	}
 
-	if err := s.backend.ExportImage(names, output); err != nil {
+	// 修改： 精简镜像保存为精简归档
+	simpCfg := backend.ImageSaveSimplifyConfig{Simplified: httputils.BoolValue(r, "simplified")}
+	// 修改
+	if err := s.backend.ExportImage(names, output, simpCfg); err != nil {
 		if !output.Flushed() {
 			return err
 		}
@@ -254,6 +336,14 @@ func (s *imageRouter) getImagesHistory(ctx context.Context, w http.ResponseWrite
 		return err
 	}
 
+	// 修改： 旧版本API不返回精简镜像层的信息
+	if versions.LessThan(httputils.VersionFromContext(ctx), "1.39") {
+		for _, h := range history {
+			h.Simplified, h.FullSize = false, 0
+		}
+	}
+	// 修改
+
 	return httputils.WriteJSON(w, http.StatusOK, history)
 }
 
@@ -322,3 +412,159 @@ func (s *imageRouter) postImagesPrune(ctx context.Context, w http.ResponseWriter
 	}
 	return httputils.WriteJSON(w, http.StatusOK, pruneReport)
 }
+
+// 修改： 镜像的精简profile
+
+func (s *imageRouter) getImagesSimplifyProfiles(ctx context.Context, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+	profiles, err := s.backend.ImageProfiles()
+	if err != nil {
+		return err
+	}
+	return httputils.WriteJSON(w, http.StatusOK, profiles)
+}
+
+func (s *imageRouter) getImagesSimplifyProfile(ctx context.Context, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+	profile, err := s.backend.ImageProfile(vars["name"])
+	if err != nil {
+		return err
+	}
+	return httputils.WriteJSON(w, http.StatusOK, profile)
+}
+
+func (s *imageRouter) postImagesSimplifyProfile(ctx context.Context, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+	if err := httputils.CheckForJSON(r); err != nil {
+		return err
+	}
+	var profile types.ImageProfile
+	if err := json.NewDecoder(r.Body).Decode(&profile); err != nil {
+		if err == io.EOF {
+			return errdefs.InvalidParameter(errors.New("got EOF while reading request body"))
+		}
+		return errdefs.InvalidParameter(err)
+	}
+	if err := s.backend.ImageProfileSave(vars["name"], profile); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (s *imageRouter) postImagesSimplifyProfileMerge(ctx context.Context, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+	if err := httputils.ParseForm(r); err != nil {
+		return err
+	}
+	sources := r.Form["source"]
+	if len(sources) == 0 {
+		return errdefs.InvalidParameter(errors.New("no profiles to merge"))
+	}
+	summary, err := s.backend.ImageProfileMerge(vars["name"], sources, httputils.BoolValue(r, "force"))
+	if err != nil {
+		return err
+	}
+	return httputils.WriteJSON(w, http.StatusOK, summary)
+}
+
+func (s *imageRouter) deleteImagesSimplifyProfile(ctx context.Context, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+	if err := s.backend.ImageProfileDelete(vars["name"]); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (s *imageRouter) postImagesSimplify(ctx context.Context, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+	if err := httputils.ParseForm(r); err != nil {
+		return err
+	}
+	var options types.ImageSimplifyOptions
+	if r.ContentLength != 0 {
+		// 请求体为空时使用源镜像保存的profile，不打标签
+		if err := httputils.CheckForJSON(r); err != nil {
+			return err
+		}
+		if err := json.NewDecoder(r.Body).Decode(&options); err != nil && err != io.EOF {
+			return errdefs.InvalidParameter(err)
+		}
+	}
+
+	output := ioutils.NewWriteFlusher(w)
+	defer output.Close()
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := s.backend.SimplifyImage(ctx, vars["name"], options, output); err != nil {
+		if !output.Flushed() {
+			return err
+		}
+		output.Write(streamformatter.FormatError(err))
+	}
+	return nil
+}
+
+func (s *imageRouter) postImagesDesimplify(ctx context.Context, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+	if err := httputils.ParseForm(r); err != nil {
+		return err
+	}
+
+	output := ioutils.NewWriteFlusher(w)
+	defer output.Close()
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := s.backend.DesimplifyImage(ctx, vars["name"], r.Form.Get("repo"), r.Form.Get("tag"), output); err != nil {
+		if !output.Flushed() {
+			return err
+		}
+		output.Write(streamformatter.FormatError(err))
+	}
+	return nil
+}
+
+func (s *imageRouter) postImagesPrefetch(ctx context.Context, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+	if err := httputils.ParseForm(r); err != nil {
+		return err
+	}
+
+	output := ioutils.NewWriteFlusher(w)
+	defer output.Close()
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := s.backend.PrefetchImage(ctx, vars["name"], r.Form["paths"], output); err != nil {
+		if !output.Flushed() {
+			return err
+		}
+		output.Write(streamformatter.FormatError(err))
+	}
+	return nil
+}
+
+func (s *imageRouter) postImagesSimplifyPin(ctx context.Context, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+	if err := httputils.ParseForm(r); err != nil {
+		return err
+	}
+
+	output := ioutils.NewWriteFlusher(w)
+	defer output.Close()
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := s.backend.PinImage(ctx, vars["name"], r.Form["paths"], output); err != nil {
+		if !output.Flushed() {
+			return err
+		}
+		output.Write(streamformatter.FormatError(err))
+	}
+	return nil
+}
+
+func (s *imageRouter) postImagesSimplifyUnpin(ctx context.Context, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+	if err := httputils.ParseForm(r); err != nil {
+		return err
+	}
+	if err := s.backend.UnpinImage(vars["name"], r.Form["paths"]); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
@@ -178,6 +178,12 @@ func (sr *swarmRouter) createService(ctx context.Context, w http.ResponseWriter,
 		return err
 	}
 
+	// 修改： 旧版本API不支持精简模式的服务
+	if err := checkSimplifyService(ctx, service); err != nil {
+		return err
+	}
+	// 修改
+
 	// Get returns "" if the header does not exist
 	encodedAuth := r.Header.Get("X-Registry-Auth")
 	cliVersion := r.Header.Get("version")
@@ -207,6 +213,11 @@ func (sr *swarmRouter) updateService(ctx context.Context, w http.ResponseWriter,
 		err := fmt.Errorf("invalid service version '%s': %v", rawVersion, err)
 		return errdefs.InvalidParameter(err)
 	}
+	// 修改： 旧版本API不支持精简模式的服务
+	if err := checkSimplifyService(ctx, service); err != nil {
+		return err
+	}
+	// 修改
 
 	var flags basictypes.ServiceUpdateOptions
 
@@ -228,6 +239,20 @@ func (sr *swarmRouter) updateService(ctx context.Context, w http.ResponseWriter,
 	return httputils.WriteJSON(w, http.StatusOK, resp)
 }
 
+// 修改： 旧版本API不支持精简模式的服务
+
+// checkSimplifyService rejects services starting their containers on
+// simplified images with API versions before simplification was added.
+func checkSimplifyService(ctx context.Context, service types.ServiceSpec) error {
+	version := httputils.VersionFromContext(ctx)
+	if cs := service.TaskTemplate.ContainerSpec; cs != nil && cs.Simplify && versions.LessThan(version, "1.39") {
+		return errdefs.InvalidParameter(errors.Errorf("simplified services are not supported on the specified API version: %s", version))
+	}
+	return nil
+}
+
+// 修改
+
 func (sr *swarmRouter) removeService(ctx context.Context, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
 	if err := sr.backend.RemoveService(vars["id"]); err != nil {
 		logrus.Errorf("Error removing service %s: %v", vars["id"], err)
@@ -5,6 +5,7 @@ import (
 	"io"
 	"time"
 
+	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
 )
 
@@ -115,10 +116,117 @@ type CreateImageConfig struct {
 	Changes []string
 
 	// 修改： 添加Simp参数
-	Simp string
+	Simp bool
+	// SimplifyKeep and SimplifyPrune are patterns of files a simplified
+	// commit keeps or prunes regardless of whether they were accessed.
+	SimplifyKeep  []string
+	SimplifyPrune []string
+	// SimplifyThreshold is the percentage of the recorded runs a file of the
+	// profile must have been opened in to be kept. If nil, the threshold the
+	// image was pulled with applies.
+	SimplifyThreshold *int
+	// SimplifyProfile selects the files kept instead of the profile stored
+	// for the image, and SimplifyForce uses it even if it was recorded for
+	// another image.
+	SimplifyProfile *types.ImageProfile
+	SimplifyForce   bool
 	// 修改
 }
 
+// 修改： 添加容器启动时的精简镜像选项，替代原simpString参数
+// ContainerStartSimplifyConfig holds the simplification options for starting
+// a container.
+type ContainerStartSimplifyConfig struct {
+	// SimplifyImage overrides the option recorded on the container when not nil
+	SimplifyImage *bool
+	// SimplifyRecord records the files the container opens until it stops
+	SimplifyRecord bool
+	// SimplifyFetchTimeout overrides the timeout recorded on the container
+	// for fetching missing files when not nil, 0 meaning the daemon's
+	SimplifyFetchTimeout *time.Duration
+	// SimplifyMaxConcurrentFetches overrides the limit recorded on the
+	// container of the missing files fetched at once when not nil, 0
+	// meaning the daemon's
+	SimplifyMaxConcurrentFetches *int
+	// SimplifyOffline overrides the daemon's offline mode when not nil
+	SimplifyOffline *bool
+	// SimplifyAudit names the image whose stored profile the files the
+	// container opens are compared with, if not empty. The container runs
+	// its full image.
+	SimplifyAudit string
+}
+
+// 修改
+
+// 修改： 添加导出容器时的精简镜像选项
+// ContainerExportSimplifyConfig holds the simplification options for
+// exporting a container.
+type ContainerExportSimplifyConfig struct {
+	// Sparse exports the files of a container of a simplified image as they
+	// are, listing those missing instead of fetching them
+	Sparse bool
+}
+
+// 修改
+
+// 修改： 添加保存镜像时的精简镜像选项
+// ImageSaveSimplifyConfig holds the simplification options for saving
+// images.
+type ImageSaveSimplifyConfig struct {
+	// Simplified saves simplified images as they are, in an archive only
+	// daemons supporting simplified images load, instead of restoring
+	// their full images
+	Simplified bool
+}
+
+// 修改
+
+// 修改： 添加拉取镜像时的精简镜像选项
+// ImagePullSimplifyConfig holds the simplification options for pulling an
+// image.
+type ImagePullSimplifyConfig struct {
+	// SimplifyImage records simplification data for the pulled image
+	SimplifyImage bool
+	// SimplifyDefault applies the daemon's default instead of SimplifyImage,
+	// which was not requested
+	SimplifyDefault bool
+	// SimplifyThreshold is the default threshold for simplified commits of
+	// containers of the pulled image
+	SimplifyThreshold int
+	// SimplifyRequired fails the pull of images without a profile instead
+	// of pulling them in full
+	SimplifyRequired bool
+	// SimplifyProfile selects the files kept instead of any stored or
+	// pushed profile
+	SimplifyProfile *types.ImageProfile
+	// SimplifyProfileFrom names the image whose stored profile selects the
+	// files kept, if SimplifyProfile is nil
+	SimplifyProfileFrom string
+	// SimplifyForce uses SimplifyProfile even if it was recorded for
+	// another image
+	SimplifyForce bool
+	// SimplifyTrusted only uses a profile pushed along with the image if it
+	// is SimplifySignedProfile
+	SimplifyTrusted bool
+	// SimplifySignedProfile is the digest of the profile signed along with
+	// the image, if any
+	SimplifySignedProfile string
+	// SimplifySignedDigest is the digest the image is pulled by, verified by
+	// the client against its content trust signature
+	SimplifySignedDigest string
+}
+
+// ImagePushSimplifyConfig holds the simplification options for pushing an
+// image.
+type ImagePushSimplifyConfig struct {
+	// SimplifyProfile pushes the profile of simplified images
+	SimplifyProfile bool
+	// SimplifyTOC pushes seekable layers along with their tables of contents
+	SimplifyTOC bool
+}
+
+// 修改
+
 // CommitConfig is the configuration for creating an image as part of a build.
 type CommitConfig struct {
 	Author              string
@@ -129,4 +237,14 @@ type CommitConfig struct {
 	ContainerMountLabel string
 	ContainerOS         string
 	ParentImageID       string
+	// 修改： 精简提交时强制保留或删除的文件，以及profile中文件的保留阈值
+	SimplifyKeep      []string
+	SimplifyPrune     []string
+	SimplifyThreshold *int
+	SimplifyProfile   *types.ImageProfile
+	SimplifyForce     bool
+	// 修改
+	// 修改： 容器在精简模式下打开的文件，存储驱动不会将其复制到读写层时由daemon记录
+	SimplifyOpened []string
+	// 修改
 }
@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"io"
 	"net"
+	"time"
 
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/filters"
@@ -46,6 +47,30 @@ type ContainerCommitOptions struct {
 	Changes   []string
 	Pause     bool
 	Config    *container.Config
+
+	// 修改： 添加simp参数
+	Simp bool
+	// Verbose returns the paths pruned by a simplified commit.
+	Verbose bool
+	// SimplifyDryRun reports what a simplified commit would keep and prune
+	// without creating an image.
+	SimplifyDryRun bool
+	// SimplifyKeep and SimplifyPrune are gitignore-style patterns of files a
+	// simplified commit keeps or prunes regardless of whether they were
+	// accessed. Keep wins over prune.
+	SimplifyKeep  []string
+	SimplifyPrune []string
+	// SimplifyThreshold is the percentage of the recorded runs a file of the
+	// profile must have been opened in to be kept. If nil, the threshold the
+	// image was pulled with applies.
+	SimplifyThreshold *int
+	// SimplifyUseProfile lists the files a simplified commit keeps, instead
+	// of the profile stored for the image of the container.
+	SimplifyUseProfile *ImageProfile
+	// SimplifyForce uses SimplifyUseProfile even if it was recorded for
+	// another image.
+	SimplifyForce bool
+	// 修改
 }
 
 // ContainerExecInspect holds information returned by exec inspect.
@@ -92,7 +117,49 @@ type ContainerRemoveOptions struct {
 type ContainerStartOptions struct {
 	CheckpointID  string
 	CheckpointDir string
-}
+	// 修改： 添加simp属性
+	// Simp starts the container on its simplified image if true and on its
+	// full image if false. The daemon decides if nil.
+	Simp *bool
+	// SimplifyRecord records the files the container opens.
+	SimplifyRecord bool
+	// SimplifyFetchTimeout overrides the timeout of fetching the files
+	// missing from the simplified container if not 0.
+	SimplifyFetchTimeout time.Duration
+	// SimplifyMaxConcurrentFetches bounds the files missing from the
+	// simplified container fetched at once if not 0.
+	SimplifyMaxConcurrentFetches int
+	// SimplifyOffline starts the container without fetching the files
+	// missing from its simplified image.
+	SimplifyOffline bool
+	// SimplifyAudit names the image whose stored profile the files the
+	// container opens are compared with, reporting those a simplified image
+	// made from the profile would have pruned. The container runs its full
+	// image.
+	SimplifyAudit string
+	// 修改
+}
+
+// 修改： 添加导出容器的选项
+// ContainerExportOptions holds parameters to export containers.
+type ContainerExportOptions struct {
+	// Sparse exports the files of a container of a simplified image as
+	// they are, listing those missing instead of fetching them.
+	Sparse bool
+}
+
+// 修改
+
+// 修改： 添加保存镜像的选项
+// ImageSaveOptions holds parameters to save images.
+type ImageSaveOptions struct {
+	// Simplified saves simplified images as they are, in an archive only
+	// daemons supporting simplified images load, instead of restoring
+	// their full images.
+	Simplified bool
+}
+
+// 修改
 
 // CopyToContainerOptions holds information
 // about files to copy into a container
@@ -211,6 +278,17 @@ type ImageBuildResponse struct {
 type ImageCreateOptions struct {
 	RegistryAuth string // RegistryAuth is the base64 encoded credentials for the registry.
 	Platform     string // Platform is the target platform of the image if it needs to be pulled from the registry.
+	// 修改： 添加simp属性
+	Simp bool // Simp records simplification data for the pulled image.
+	// SimplifyThreshold is the default threshold for simplified commits of
+	// containers of the pulled image.
+	SimplifyThreshold int
+	// SimplifyTrusted, SimplifySignedProfile and SimplifySignedDigest are
+	// those of ImagePullOptions.
+	SimplifyTrusted       bool
+	SimplifySignedProfile string
+	SimplifySignedDigest  string
+	// 修改
 }
 
 // ImageImportSource holds source information for ImageImport
@@ -242,7 +320,52 @@ type ImageLoadResponse struct {
 
 // ImagePullOptions holds information to pull images.
 type ImagePullOptions struct {
-	All           bool
+	All bool
+	// 修改：添加-s，--simplify-image标记（flag）
+	// Simplify pulls the image simplified, as "docker pull -s" does. It is
+	// sent as the simplify-image parameter, along with the other fields of
+	// pulls below, which are ignored without it.
+	Simplify bool
+	// Simp is the former name of Simplify.
+	//
+	// Deprecated: use Simplify.
+	Simp bool
+	// SimplifyProfile names the image whose stored profile selects the files
+	// kept, such as an earlier version of the pulled image. It is only used
+	// by pulls, and cannot be used with SimplifyUseProfile.
+	SimplifyProfile string
+	// SimplifyThreshold is the default threshold for simplified commits of
+	// containers of the pulled image.
+	SimplifyThreshold int
+	// SimplifyRequired fails the pull of images without a profile instead
+	// of pulling them in full.
+	SimplifyRequired bool
+	// SimplifyUseProfile lists the files of the pulled image kept once
+	// simplified, instead of any profile stored for it or pushed along
+	// with it. It is only used by pulls.
+	SimplifyUseProfile *ImageProfile
+	// SimplifyForce uses SimplifyUseProfile even if it was recorded for
+	// another image. It is only used by pulls.
+	SimplifyForce bool
+	// SimplifyTrusted only uses a profile pushed along with the pulled
+	// image if it is SimplifySignedProfile, as content trust requires. It is
+	// only used by pulls.
+	SimplifyTrusted bool
+	// SimplifySignedProfile is the digest of the profile signed along with
+	// the pulled image, if any. It is only used by pulls.
+	SimplifySignedProfile string
+	// SimplifySignedDigest is the digest of the pulled image the client
+	// verified against its content trust signature, recorded as the
+	// provenance of the simplified image. It is only used by pulls.
+	SimplifySignedDigest string
+	// SimplifyPushProfile pushes the profile of a simplified image along
+	// with it. It is only used by pushes.
+	SimplifyPushProfile bool
+	// SimplifyTOC pushes seekable layers along with their tables of
+	// contents, so that pulls can download only the files they keep. It is
+	// only used by pushes.
+	SimplifyTOC bool
+	// 修改
 	RegistryAuth  string // RegistryAuth is the base64 encoded credentials for the registry
 	PrivilegeFunc RequestPrivilegeFunc
 	Platform      string
@@ -409,4 +409,9 @@ type HostConfig struct {
 
 	// Run a custom init inside the container, if null, use the daemon's configured settings
 	Init *bool `json:",omitempty"`
+
+	// 修改： 添加精简镜像选项，记录容器是否以精简模式启动
+	// SimplifyImage starts the container on a simplified image unless overridden at start
+	SimplifyImage bool `json:",omitempty"`
+	// 修改
 }
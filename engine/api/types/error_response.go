@@ -10,4 +10,23 @@ type ErrorResponse struct {
 	// The error message.
 	// Required: true
 	Message string `json:"message"`
+
+	// 修改： 精简镜像相关错误的错误码
+	// The code of the error, set for some errors of simplified images.
+	Code string `json:"code,omitempty"`
+	// 修改
 }
+
+// 修改： 精简镜像相关错误的错误码
+const (
+	// ErrorCodeImageNotSimplified is the code of the error starting a
+	// container in simplified mode from an image that has no simplification
+	// data.
+	ErrorCodeImageNotSimplified = "ImageNotSimplified"
+	// ErrorCodeSimplifyNotSupported is the code of the error starting a
+	// container in simplified mode on a storage driver that cannot mount
+	// simplified images.
+	ErrorCodeSimplifyNotSupported = "SimplifyNotSupported"
+)
+
+// 修改
@@ -34,4 +34,14 @@ type HistoryResponseItem struct {
 	// tags
 	// Required: true
 	Tags []string `json:"Tags"`
+
+	// 修改： 添加精简镜像层的信息
+	// whether the layer was rewritten by simplification, so that its size
+	// is not the one of the layer of the full image
+	Simplified bool `json:"Simplified,omitempty"`
+
+	// size of the layer, or layers, of the full image a rewritten layer was
+	// simplified from, when known
+	FullSize int64 `json:"FullSize,omitempty"`
+	// 修改
 }
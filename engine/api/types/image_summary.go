@@ -39,6 +39,19 @@ type ImageSummary struct {
 	// Required: true
 	SharedSize int64 `json:"SharedSize"`
 
+	// 修改： 添加精简镜像标志
+	// simplified
+	Simplified bool `json:"Simplified,omitempty"`
+
+	// size of the full image a simplified image was derived from, only set
+	// for simplified images in disk usage responses
+	FullSize int64 `json:"FullSize,omitempty"`
+
+	// size of the simplified image on disk, including the files fetched on
+	// demand, only set for simplified images in disk usage responses
+	MaterializedSize int64 `json:"MaterializedSize,omitempty"`
+	// 修改
+
 	// size
 	// Required: true
 	Size int64 `json:"Size"`
@@ -167,6 +167,25 @@ type Stats struct {
 	CPUStats    CPUStats    `json:"cpu_stats,omitempty"`
 	PreCPUStats CPUStats    `json:"precpu_stats,omitempty"` // "Pre"="Previous"
 	MemoryStats MemoryStats `json:"memory_stats,omitempty"`
+
+	// 修改： 精简模式下按需拉取的文件
+	SimplifyStats *SimplifyStats `json:"simplify_stats,omitempty"`
+	// 修改
+}
+
+// SimplifyStats aggregates the files looked up on demand for a container
+// running in simplified mode. It is only set for containers whose missing
+// files are fetched.
+type SimplifyStats struct {
+	// Number of files looked up and found, in the cache or in the full image
+	Fetches uint64 `json:"fetches"`
+	// Number of files looked up that were in the cache already, fetched for
+	// another container of the image
+	CacheHits uint64 `json:"cache_hits"`
+	// Size of the files fetched from the full image, in bytes
+	FetchedBytes uint64 `json:"fetched_bytes"`
+	// When a file was last fetched from the full image, zero if none was
+	LastFetch time.Time `json:"last_fetch"`
 }
 
 // StatsJSON is newly used Networks
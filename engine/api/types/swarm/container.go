@@ -71,4 +71,9 @@ type ContainerSpec struct {
 	Secrets   []*SecretReference  `json:",omitempty"`
 	Configs   []*ConfigReference  `json:",omitempty"`
 	Isolation container.Isolation `json:",omitempty"`
+	// 修改： 添加服务容器以精简模式启动的选项
+	// Simplify starts the containers of the service on simplified images,
+	// on the nodes able to run them.
+	Simplify bool `json:",omitempty"`
+	// 修改
 }
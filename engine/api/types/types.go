@@ -46,6 +46,245 @@ type ImageInspect struct {
 	GraphDriver     GraphDriverData
 	RootFS          RootFS
 	Metadata        ImageMetadata
+	// 修改： 添加精简镜像信息
+	Simplified ImageSimplified
+	// 修改
+}
+
+// ImageSimplified holds the simplification metadata of an image.
+type ImageSimplified struct {
+	// Enabled is true if the image was pulled or committed with
+	// simplification enabled.
+	Enabled bool
+	// FullImage is the ID of the full image a committed or pulled
+	// simplified image was derived from.
+	FullImage string `json:",omitempty"`
+	// Size is the size of the image on disk, including the files fetched
+	// on demand.
+	Size int64
+	// FullSize is the size of the full image.
+	FullSize int64
+	// Profile identifies the profile the image was simplified with.
+	Profile string `json:",omitempty"`
+	// Threshold is the percentage of the recorded runs of the profile a
+	// file had to be opened in to be kept. For pulled images, it is the
+	// default for simplified commits of their containers.
+	Threshold int `json:",omitempty"`
+	// Materialized is true once every file of the full image is on disk.
+	Materialized bool
+	// Annotations are the simplify annotations of the manifest the image
+	// was pulled by, if it was pushed as a simplified image.
+	Annotations map[string]string `json:",omitempty"`
+	// SignedDigest is the digest of the full image the image was pulled
+	// by, as verified by the client against its content trust signature.
+	SignedDigest string `json:",omitempty"`
+	// Pins are the globs of the paths pinned in the cache of the files
+	// fetched for the image, which are never evicted.
+	Pins []string `json:",omitempty"`
+}
+
+// ContainerSimplifyProfile contains response of Engine API:
+// GET "/containers/{name:.*}/simplify/profile"
+type ContainerSimplifyProfile struct {
+	// Recording is true while the container's file accesses are recorded.
+	Recording bool
+	// Truncated is true if file accesses were dropped because there were
+	// too many.
+	Truncated bool `json:",omitempty"`
+	// Paths are the absolute paths of the files the container opened.
+	Paths []string
+}
+
+// ContainerSimplifyFetchesOptions holds parameters to page through the
+// files looked up on demand for a container.
+type ContainerSimplifyFetchesOptions struct {
+	// After skips the fetches up to the one of this ID.
+	After uint64
+	// Limit is the largest number of fetches returned, 0 meaning all of
+	// them.
+	Limit int
+}
+
+// ContainerSimplifyFetches contains response of Engine API:
+// GET "/containers/{name:.*}/simplify/fetches"
+type ContainerSimplifyFetches struct {
+	// Fetches are the files looked up, oldest first. Only the last ones are
+	// kept.
+	Fetches []SimplifyFetch
+	// More is true if more fetches follow the last one returned.
+	More bool `json:",omitempty"`
+}
+
+// SimplifyFetch is a file looked up on demand for a simplified container.
+type SimplifyFetch struct {
+	// ID orders the fetches of the container, starting from 1.
+	ID uint64
+	// Path is the path of the file inside the container.
+	Path string
+	// Size is the size of the file in bytes, if it was found.
+	Size int64
+	// Latency is how long the lookup took, in nanoseconds.
+	Latency time.Duration
+	// Source is where the file was found: "cache", "peer" or "image".
+	Source string `json:",omitempty"`
+	// Time is when the lookup started.
+	Time time.Time
+	// Outcome is "fetched", "not-found" or "failed".
+	Outcome string
+	// Error is why the lookup failed, if it did.
+	Error string `json:",omitempty"`
+}
+
+// ImageProfile contains response of Engine API:
+// GET "/images/{name:.*}/simplify/profile"
+type ImageProfile struct {
+	// Image is the ID of the image the files were recorded for.
+	Image string
+	// Reference is the name the image was run by when the files were
+	// recorded.
+	Reference string `json:",omitempty"`
+	// Platform is the platform the files were recorded on, such as
+	// "linux/arm64", if known.
+	Platform string `json:",omitempty"`
+	// Created is when the profile was stored, in RFC 3339 format.
+	Created string
+	// Stale is true if the image is no longer present, or if Reference now
+	// refers to another image.
+	Stale bool
+	// Truncated is true if file accesses were dropped while recording.
+	Truncated bool `json:",omitempty"`
+	// Paths are the absolute paths of the files opened in the image.
+	Paths []string
+	// Runs are the IDs of the recorded runs the profile was made from.
+	Runs []string `json:",omitempty"`
+	// Counts are the number of runs each path was opened in, if the profile
+	// was merged from several runs.
+	Counts map[string]int `json:",omitempty"`
+}
+
+// ImageProfileSummary contains response of Engine API:
+// GET "/images/simplify/profiles"
+type ImageProfileSummary struct {
+	Image     string
+	Reference string `json:",omitempty"`
+	Platform  string `json:",omitempty"`
+	Created   string
+	Stale     bool
+	// Files is the number of files in the profile.
+	Files int
+	// Runs is the number of recorded runs the profile was made from.
+	Runs int
+}
+
+// ImageProfileMergeOptions holds parameters to merge simplify profiles.
+type ImageProfileMergeOptions struct {
+	// Force merges profiles recorded for other images than the target.
+	Force bool
+}
+
+// ImageSimplifyOptions holds parameters to simplify an image.
+type ImageSimplifyOptions struct {
+	// Target is the repository:tag the simplified image is tagged with. It
+	// is left untagged if empty.
+	Target string `json:",omitempty"`
+	// Profile lists the files to keep. If nil, the profile stored for the
+	// image ProfileFrom names is used, or else the one stored for the source
+	// image.
+	Profile *ImageProfile `json:",omitempty"`
+	// ProfileFrom names the image whose stored profile is used, such as an
+	// earlier version of the source image.
+	ProfileFrom string `json:",omitempty"`
+	// Threshold is the percentage of the recorded runs of the profile a file
+	// must have been opened in to be kept. If nil, the threshold the source
+	// image was pulled with applies.
+	Threshold *int `json:",omitempty"`
+	// Keep are gitignore-style patterns of files kept whether profiled or
+	// not, as those of simplified commits.
+	Keep []string `json:",omitempty"`
+	// Prune are gitignore-style patterns of files pruned unless kept by
+	// Keep.
+	Prune []string `json:",omitempty"`
+}
+
+// ImageSimplifyResult is the aux message streamed by Engine API:
+// POST "/images/{name:.*}/simplify" once the simplified image is created.
+type ImageSimplifyResult struct {
+	// ID is the ID of the simplified image.
+	ID string
+	// Simplify summarizes what was pruned from the source image.
+	Simplify SimplifySummary
+}
+
+// ImageDesimplifyResult is the aux message streamed by Engine API:
+// POST "/images/{name:.*}/desimplify" once the full image is restored.
+type ImageDesimplifyResult struct {
+	// ID is the ID of the restored image.
+	ID string
+	// Downloaded are the diff IDs of the layers of the full image that were
+	// missing locally and had to be downloaded.
+	Downloaded []string
+}
+
+// ImagePrefetchOptions holds parameters to prefetch the files pruned from a
+// simplified image.
+type ImagePrefetchOptions struct {
+	// Paths restricts the prefetch to the files matching one of these
+	// globs, or inside a directory matching one. Every file is prefetched
+	// if empty.
+	Paths []string
+}
+
+// ImagePinOptions holds parameters to pin paths in the cache of a simplified
+// image, or to unpin them.
+type ImagePinOptions struct {
+	// Paths are the globs of the paths to pin or unpin. A directory
+	// matching one is pinned with everything inside it.
+	Paths []string
+}
+
+// ImagePrefetchResult is the aux message streamed by Engine API:
+// POST "/images/{name:.*}/prefetch" once the files are in the cache.
+type ImagePrefetchResult struct {
+	// Files is the number of files fetched into the cache.
+	Files int
+	// Bytes is the size of the files fetched into the cache.
+	Bytes int64
+}
+
+// ContainerCommitResponse contains response of Engine API:
+// POST "/commit"
+type ContainerCommitResponse struct {
+	// ID is the ID of the new image, empty for dry runs.
+	ID string `json:"Id"`
+	// 修改： 精简提交时返回精简结果
+	// Simplify summarizes what was pruned, only set for simplified commits.
+	Simplify *SimplifySummary `json:",omitempty"`
+	// 修改
+}
+
+// SimplifySummary summarizes what a simplified commit pruned from the full
+// image the container was started from.
+type SimplifySummary struct {
+	// FilesKept is the number of files in the simplified image.
+	FilesKept int64
+	// FilesPruned is the number of files of the full image left out.
+	FilesPruned int64
+	// BytesSaved is the total size of the files left out.
+	BytesSaved int64
+	// FilesBelowThreshold is the number of files of the profile left out
+	// because they were opened in too few of its runs.
+	FilesBelowThreshold int64
+	// FullSize is the size of the full image, and Size the size of the
+	// simplified image. They are not set for dry runs.
+	FullSize int64 `json:",omitempty"`
+	Size     int64 `json:",omitempty"`
+	// Profile is the digest of the profile the image was simplified with,
+	// as pushed along with it, if any. It is not set for dry runs.
+	Profile string `json:",omitempty"`
+	// Kept lists the paths in the simplified image, only set for dry runs.
+	Kept []string `json:",omitempty"`
+	// Pruned lists the paths left out, only set if requested.
+	Pruned []string `json:",omitempty"`
 }
 
 // ImageMetadata contains engine-local data about the image
@@ -90,6 +329,10 @@ type ContainerPathStat struct {
 	Mode       os.FileMode `json:"mode"`
 	Mtime      time.Time   `json:"mtime"`
 	LinkTarget string      `json:"linkTarget"`
+	// 修改： 精简镜像中被裁剪的条目，按需拉取的数量及无法拉取而缺少的文件数
+	Fetched int `json:"fetched,omitempty"`
+	Pruned  int `json:"pruned,omitempty"`
+	// 修改
 }
 
 // ContainerStats contains response of Engine API:
@@ -204,6 +447,60 @@ type Info struct {
 	RuncCommit         Commit
 	InitCommit         Commit
 	SecurityOptions    []string
+	// 修改： 精简镜像的配置
+	Simplify *SimplifyInfo `json:",omitempty"`
+	// 修改
+}
+
+// SimplifyInfo holds the daemon configuration of image simplification
+type SimplifyInfo struct {
+	// Enabled determines whether containers can start on simplified images
+	// on this daemon
+	Enabled bool
+	// Drivers are the storage drivers able to run simplified images
+	Drivers []string
+	// ProfileDir holds the profiles of the files images need to run
+	ProfileDir string
+	// ImageDefault determines whether images are simplified when pulled
+	// without the client asking either way
+	ImageDefault bool
+	// Registries the images are simplified for, all if empty
+	Registries []string `json:",omitempty"`
+	// CacheDir holds the files fetched on demand for simplified images
+	CacheDir string
+	// MaxCacheSize is the maximum size of the cache, in bytes, 0 if unlimited
+	MaxCacheSize int64
+	// CacheSize is the current size of the cache, in bytes
+	CacheSize int64
+	// Fetches is the number of files looked up on demand since the daemon
+	// started
+	Fetches uint64
+	// CacheHitRatio is the ratio of those files that were in the cache
+	CacheHitRatio float64
+	// Prefetch determines whether the rest of simplified images is
+	// downloaded in the background after start
+	Prefetch bool
+	// PrefetchRate limits the prefetch, in bytes per second, 0 if unlimited
+	PrefetchRate int64
+	// Offline determines whether containers start without fetching files
+	// on demand, unless the client asks otherwise
+	Offline bool
+	// Unsupported is why containers cannot start on simplified images on
+	// this daemon, empty if they can
+	Unsupported string `json:",omitempty"`
+	// FetchUnsupported is why files pruned from simplified images are not
+	// fetched on demand on this daemon, empty if they are
+	FetchUnsupported string `json:",omitempty"`
+	// FetchHealth is the state of the service answering the fetch helper:
+	// "healthy", or "restarting" while it is set up again. Omitted if files
+	// are not fetched on demand.
+	FetchHealth string `json:",omitempty"`
+	// FetchRestarts is the number of times the service answering the fetch
+	// helper was restarted since the daemon started
+	FetchRestarts int `json:",omitempty"`
+	// FetchLastError is why the service answering the fetch helper was
+	// last restarted
+	FetchLastError string `json:",omitempty"`
 }
 
 // KeyValue holds a key/value pair
@@ -308,6 +605,12 @@ type ContainerState struct {
 	StartedAt  string
 	FinishedAt string
 	Health     *Health `json:",omitempty"`
+	// 修改： 精简容器缺失的文件无法再按需拉取的原因
+	SimplifyDegraded string `json:",omitempty"`
+	// 修改
+	// 修改： 精简容器最近一次按需拉取失败的错误
+	SimplifyFetchError string `json:",omitempty"`
+	// 修改
 }
 
 // ContainerNode stores information about the node that a container
@@ -514,6 +817,9 @@ type DiskUsage struct {
 	Volumes     []*Volume
 	BuildCache  []*BuildCache
 	BuilderSize int64 // deprecated
+	// 修改： 精简镜像相对完整镜像节省的空间
+	SimplifiedReclaimed int64 `json:",omitempty"`
+	// 修改
 }
 
 // ContainersPruneReport contains the response for Engine API:
@@ -580,6 +886,12 @@ type PushResult struct {
 	Tag    string
 	Digest string
 	Size   int
+	// 修改： 随镜像推送的profile，签名推送时一并签名
+	// SimplifyProfile is the digest of the simplify profile pushed along
+	// with the image, if any, and SimplifyProfileSize its size.
+	SimplifyProfile     string `json:",omitempty"`
+	SimplifyProfileSize int64  `json:",omitempty"`
+	// 修改
 }
 
 // BuildResult contains the image id of a successful build
@@ -48,6 +48,13 @@ type Backend interface {
 
 	CreateImage(config []byte, parent string) (Image, error)
 
+	// 修改： COPY --from精简镜像时拉取被裁剪的文件
+	// SimplifyCopySource fetches the files pruned from the image imageID, if
+	// it is simplified, at the path p of rootfs, the root filesystem of a
+	// layer on top of the image, or under p into rootfs.
+	SimplifyCopySource(ctx context.Context, imageID string, rootfs containerfs.ContainerFS, p string) error
+	// 修改
+
 	ImageCacheBuilder
 }
 
@@ -67,8 +74,8 @@ type ExecBackend interface {
 	// ContainerKill stops the container execution abruptly.
 	ContainerKill(containerID string, sig uint64) error
 	// ContainerStart starts a new container
-	// 修改： 添加simpString参数
-	ContainerStart(containerID string, hostConfig *container.HostConfig, checkpoint string, checkpointDir string, simpString string) error
+	// 修改： 添加simpCfg参数
+	ContainerStart(containerID string, hostConfig *container.HostConfig, checkpoint string, checkpointDir string, simpCfg backend.ContainerStartSimplifyConfig) error
 	// 修改
 	// ContainerWait stops processing until the given container is stopped.
 	ContainerWait(ctx context.Context, name string, condition containerpkg.WaitCondition) (<-chan containerpkg.StateStatus, error)
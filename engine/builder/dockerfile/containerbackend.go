@@ -6,6 +6,7 @@ import (
 	"io"
 
 	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/backend"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/builder"
 	containerpkg "github.com/docker/docker/container"
@@ -69,8 +70,8 @@ func (c *containerManager) Run(ctx context.Context, cID string, stdout, stderr i
 		}
 	}()
 
-	// 修改： 添加simpString = ""参数
-	if err := c.backend.ContainerStart(cID, nil, "", "", ""); err != nil {
+	// 修改： 添加simpCfg参数
+	if err := c.backend.ContainerStart(cID, nil, "", "", backend.ContainerStartSimplifyConfig{}); err != nil {
 		// 修改
 		close(finished)
 		logCancellationError(cancelErrCh, "error from ContainerStart: "+err.Error())
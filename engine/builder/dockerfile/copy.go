@@ -2,6 +2,7 @@ package dockerfile // import "github.com/docker/docker/builder/dockerfile"
 
 import (
 	"archive/tar"
+	"context"
 	"fmt"
 	"io"
 	"mime"
@@ -79,6 +80,10 @@ type copier struct {
 	// Copier should take override source as input, not imageMount.
 	activeLayer builder.RWLayer
 	tmpPaths    []string
+	// 修改： 用于从精简镜像复制时拉取被裁剪的文件
+	backend   builder.Backend
+	clientCtx context.Context
+	// 修改
 }
 
 func copierFromDispatchRequest(req dispatchRequest, download sourceDownloader, imageSource *imageMount) copier {
@@ -88,6 +93,10 @@ func copierFromDispatchRequest(req dispatchRequest, download sourceDownloader, i
 		download:    download,
 		imageSource: imageSource,
 		platform:    req.builder.platform,
+		// 修改： 用于从精简镜像复制时拉取被裁剪的文件
+		backend:   req.builder.docker,
+		clientCtx: req.builder.clientCtx,
+		// 修改
 	}
 }
 
@@ -211,6 +220,14 @@ func (o *copier) calcCopyInfo(origPath string, allowWildcards bool) ([]copyInfo,
 	origPath = strings.TrimPrefix(origPath, string(root.Separator()))
 	origPath = strings.TrimPrefix(origPath, "."+string(root.Separator()))
 
+	// 修改： 源镜像为精简镜像时先拉取被裁剪的文件，通配符匹配的文件由其所在目录一并拉取
+	if allowWildcards && imageSource != nil && imageSource.ImageID() != "" && o.backend != nil {
+		if err := o.backend.SimplifyCopySource(o.clientCtx, imageSource.ImageID(), root, simplifyCopyPath(origPath, root)); err != nil {
+			return nil, errors.Wrapf(err, "failed to fetch %s from the simplified image", origPath)
+		}
+	}
+	// 修改
+
 	// Deal with wildcards
 	if allowWildcards && containsWildcards(origPath, root.OS()) {
 		return o.copyWithWildcards(origPath)
@@ -244,6 +261,26 @@ func (o *copier) calcCopyInfo(origPath string, allowWildcards bool) ([]copyInfo,
 	return newCopyInfos(newCopyInfoFromSource(o.source, origPath, hash)), nil
 }
 
+// 修改： 计算需要从精简镜像拉取的路径
+
+// simplifyCopyPath returns the path of root the files copied for origPath
+// are at or under: origPath, or the directory holding its first wildcard.
+func simplifyCopyPath(origPath string, root containerfs.ContainerFS) string {
+	if !containsWildcards(origPath, root.OS()) {
+		return origPath
+	}
+	var dirs []string
+	for _, elem := range strings.Split(origPath, string(root.Separator())) {
+		if containsWildcards(elem, root.OS()) {
+			break
+		}
+		dirs = append(dirs, elem)
+	}
+	return strings.Join(dirs, string(root.Separator()))
+}
+
+// 修改
+
 func containsWildcards(name, platform string) bool {
 	isWindows := platform == "windows"
 	for i := 0; i < len(name); i++ {
@@ -1,10 +1,15 @@
 package dockerfile // import "github.com/docker/docker/builder/dockerfile"
 
 import (
+	"context"
 	"net/http"
+	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/docker/docker/builder"
 	"github.com/docker/docker/pkg/containerfs"
+	"golang.org/x/sync/syncmap"
 	"gotest.tools/assert"
 	is "gotest.tools/assert/cmp"
 	"gotest.tools/fs"
@@ -146,3 +151,67 @@ func TestGetFilenameForDownload(t *testing.T) {
 		assert.Check(t, is.Equal(testcase.expected, filename))
 	}
 }
+
+type dirLayer struct {
+	mockLayer
+	dir string
+}
+
+func (l *dirLayer) NewRWLayer() (builder.RWLayer, error) {
+	return &dirRWLayer{dir: l.dir}, nil
+}
+
+type dirRWLayer struct {
+	mockRWLayer
+	dir string
+}
+
+func (l *dirRWLayer) Root() containerfs.ContainerFS {
+	return containerfs.NewLocalContainerFS(l.dir)
+}
+
+func TestCalcCopyInfoFetchesFromSimplifiedImage(t *testing.T) {
+	var testcases = []struct {
+		doc      string
+		origPath string
+		expected string
+	}{
+		{
+			doc:      "directory",
+			origPath: "/app/bin",
+			expected: "app/bin",
+		},
+		{
+			doc:      "wildcard",
+			origPath: "/app/bin/*",
+			expected: "app/bin",
+		},
+	}
+
+	for _, testcase := range testcases {
+		root := fs.NewDir(t, "copy-simplified-test", fs.WithDir("app"))
+		defer root.Remove()
+
+		var fetched []string
+		backend := &MockBackend{
+			simplifyCopySourceFunc: func(imageID string, rootfs containerfs.ContainerFS, p string) error {
+				assert.Check(t, is.Equal("abcdef", imageID))
+				fetched = append(fetched, p)
+				// the files pruned from the image show up in the source layer
+				return os.MkdirAll(filepath.Join(rootfs.Path(), p, "tool"), 0755)
+			},
+		}
+		o := copier{
+			imageSource: newImageMount(&mockImage{id: "abcdef"}, &dirLayer{dir: root.Path()}),
+			pathCache:   &syncmap.Map{},
+			backend:     backend,
+			clientCtx:   context.Background(),
+		}
+
+		infos, err := o.calcCopyInfo(testcase.origPath, true)
+		assert.NilError(t, err, testcase.doc)
+		assert.Check(t, is.DeepEqual([]string{testcase.expected}, fetched), testcase.doc)
+		assert.Check(t, is.Len(infos, 1), testcase.doc)
+		o.Cleanup()
+	}
+}
@@ -18,10 +18,11 @@ import (
 
 // MockBackend implements the builder.Backend interface for unit testing
 type MockBackend struct {
-	containerCreateFunc func(config types.ContainerCreateConfig) (container.ContainerCreateCreatedBody, error)
-	commitFunc          func(backend.CommitConfig) (image.ID, error)
-	getImageFunc        func(string) (builder.Image, builder.ROLayer, error)
-	makeImageCacheFunc  func(cacheFrom []string) builder.ImageCache
+	containerCreateFunc    func(config types.ContainerCreateConfig) (container.ContainerCreateCreatedBody, error)
+	commitFunc             func(backend.CommitConfig) (image.ID, error)
+	getImageFunc           func(string) (builder.Image, builder.ROLayer, error)
+	makeImageCacheFunc     func(cacheFrom []string) builder.ImageCache
+	simplifyCopySourceFunc func(imageID string, rootfs containerfs.ContainerFS, p string) error
 }
 
 func (m *MockBackend) ContainerAttachRaw(cID string, stdin io.ReadCloser, stdout, stderr io.Writer, stream bool, attached chan struct{}) error {
@@ -50,7 +51,7 @@ func (m *MockBackend) ContainerKill(containerID string, sig uint64) error {
 	return nil
 }
 
-func (m *MockBackend) ContainerStart(containerID string, hostConfig *container.HostConfig, checkpoint string, checkpointDir string) error {
+func (m *MockBackend) ContainerStart(containerID string, hostConfig *container.HostConfig, checkpoint string, checkpointDir string, simpCfg backend.ContainerStartSimplifyConfig) error {
 	return nil
 }
 
@@ -85,6 +86,13 @@ func (m *MockBackend) CreateImage(config []byte, parent string) (builder.Image,
 	return nil, nil
 }
 
+func (m *MockBackend) SimplifyCopySource(ctx context.Context, imageID string, rootfs containerfs.ContainerFS, p string) error {
+	if m.simplifyCopySourceFunc != nil {
+		return m.simplifyCopySourceFunc(imageID, rootfs, p)
+	}
+	return nil
+}
+
 type mockImage struct {
 	id     string
 	config *container.Config
@@ -5,22 +5,57 @@ import (
 	"encoding/json"
 	"errors"
 	"net/url"
+	"strconv"
 
 	"github.com/docker/distribution/reference"
+	"github.com/docker/docker/api"
 	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
 )
 
+// 修改： 精简提交的请求体
+
+// commitBody is the body of a commit request: the container configuration of
+// the image, along with the profile of the files a simplified commit keeps.
+type commitBody struct {
+	*container.Config
+	SimplifyProfile *types.ImageProfile `json:",omitempty"`
+}
+
+// 修改
+
 // ContainerCommit applies changes into a container and creates a new tagged image.
 func (cli *Client) ContainerCommit(ctx context.Context, container string, options types.ContainerCommitOptions) (types.IDResponse, error) {
+	// 修改： 精简结果由ContainerCommitSimplified返回
+	response, err := cli.containerCommit(ctx, container, options)
+	return types.IDResponse{ID: response.ID}, err
+	// 修改
+}
+
+// 修改： 返回精简结果的提交
+
+// ContainerCommitSimplified commits the container like ContainerCommit, and
+// also returns what a simplified commit, or dry run, pruned. It requires API
+// version 1.39.
+func (cli *Client) ContainerCommitSimplified(ctx context.Context, container string, options types.ContainerCommitOptions) (types.ContainerCommitResponse, error) {
+	if err := cli.NewVersionError(api.SimplifyVersion, "simplify summary"); err != nil {
+		return types.ContainerCommitResponse{}, err
+	}
+	return cli.containerCommit(ctx, container, options)
+}
+
+// 修改
+
+func (cli *Client) containerCommit(ctx context.Context, container string, options types.ContainerCommitOptions) (types.ContainerCommitResponse, error) {
 	var repository, tag string
 	if options.Reference != "" {
 		ref, err := reference.ParseNormalizedNamed(options.Reference)
 		if err != nil {
-			return types.IDResponse{}, err
+			return types.ContainerCommitResponse{}, err
 		}
 
 		if _, isCanonical := ref.(reference.Canonical); isCanonical {
-			return types.IDResponse{}, errors.New("refusing to create a tag with a digest reference")
+			return types.ContainerCommitResponse{}, errors.New("refusing to create a tag with a digest reference")
 		}
 		ref = reference.TagNameOnly(ref)
 
@@ -43,8 +78,43 @@ func (cli *Client) ContainerCommit(ctx context.Context, container string, option
 		query.Set("pause", "0")
 	}
 
-	var response types.IDResponse
-	resp, err := cli.post(ctx, "/commit", query, options.Config, nil)
+	// 修改： 添加simplify-image参数到查询中，旧版本API不支持
+	if options.Simp || options.SimplifyDryRun || len(options.SimplifyKeep) > 0 || len(options.SimplifyPrune) > 0 || options.SimplifyThreshold != nil || options.SimplifyUseProfile != nil || options.SimplifyForce {
+		if err := cli.NewVersionError(api.SimplifyVersion, "simplify-image"); err != nil {
+			return types.ContainerCommitResponse{}, err
+		}
+	}
+	if options.Simp {
+		query.Set("simplify-image", "yes")
+		if options.Verbose {
+			query.Set("verbose", "1")
+		}
+	}
+	if options.SimplifyDryRun {
+		query.Set("simplify-dry-run", "yes")
+	}
+	for _, pattern := range options.SimplifyKeep {
+		query.Add("simplify-keep", pattern)
+	}
+	for _, pattern := range options.SimplifyPrune {
+		query.Add("simplify-prune", pattern)
+	}
+	if options.SimplifyThreshold != nil {
+		query.Set("simplify-threshold", strconv.Itoa(*options.SimplifyThreshold))
+	}
+	if options.SimplifyForce {
+		query.Set("simplify-force", "yes")
+	}
+	// 修改
+
+	var response types.ContainerCommitResponse
+	// 修改： 指定的profile随容器配置一起作为请求体上传
+	var body interface{} = options.Config
+	if options.SimplifyUseProfile != nil {
+		body = commitBody{Config: options.Config, SimplifyProfile: options.SimplifyUseProfile}
+	}
+	resp, err := cli.post(ctx, "/commit", query, body, nil)
+	// 修改
 	if err != nil {
 		return response, err
 	}
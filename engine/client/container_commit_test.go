@@ -11,6 +11,7 @@ import (
 	"testing"
 
 	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
 )
 
 func TestContainerCommitError(t *testing.T) {
@@ -94,3 +95,120 @@ func TestContainerCommit(t *testing.T) {
 		t.Fatalf("expected `new_container_id`, got %s", r.ID)
 	}
 }
+
+func TestContainerCommitSimplify(t *testing.T) {
+	expectedKeep := []string{"*.mo", "/usr/lib/plugins/"}
+	expectedPrune := []string{"/usr/share/doc"}
+
+	client := &Client{
+		client: newMockClient(func(req *http.Request) (*http.Response, error) {
+			query := req.URL.Query()
+			if simp := query.Get("simplify-image"); simp != "yes" {
+				return nil, fmt.Errorf("simplify-image not set in URL query properly. Expected 'yes', got %s", simp)
+			}
+			if verbose := query.Get("verbose"); verbose != "1" {
+				return nil, fmt.Errorf("verbose not set in URL query properly. Expected '1', got %s", verbose)
+			}
+			if keep := query["simplify-keep"]; strings.Join(keep, ",") != strings.Join(expectedKeep, ",") {
+				return nil, fmt.Errorf("simplify-keep not set in URL query properly. Expected %v, got %v", expectedKeep, keep)
+			}
+			if prune := query["simplify-prune"]; strings.Join(prune, ",") != strings.Join(expectedPrune, ",") {
+				return nil, fmt.Errorf("simplify-prune not set in URL query properly. Expected %v, got %v", expectedPrune, prune)
+			}
+			if threshold := query.Get("simplify-threshold"); threshold != "0" {
+				return nil, fmt.Errorf("simplify-threshold not set in URL query properly. Expected '0', got %s", threshold)
+			}
+			b, err := json.Marshal(types.ContainerCommitResponse{
+				ID:       "new_container_id",
+				Simplify: &types.SimplifySummary{FilesKept: 1, FilesPruned: 2, BytesSaved: 3},
+			})
+			if err != nil {
+				return nil, err
+			}
+			return &http.Response{
+				StatusCode: http.StatusCreated,
+				Body:       ioutil.NopCloser(bytes.NewReader(b)),
+			}, nil
+		}),
+	}
+
+	threshold := 0
+	r, err := client.ContainerCommitSimplified(context.Background(), "container_id", types.ContainerCommitOptions{
+		Simp:              true,
+		Verbose:           true,
+		SimplifyKeep:      expectedKeep,
+		SimplifyPrune:     expectedPrune,
+		SimplifyThreshold: &threshold,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Simplify == nil || r.Simplify.FilesPruned != 2 {
+		t.Fatalf("expected a simplify summary, got %+v", r.Simplify)
+	}
+}
+
+func TestContainerCommitSimplifiedVersion(t *testing.T) {
+	client := &Client{
+		client: newMockClient(func(req *http.Request) (*http.Response, error) {
+			return nil, fmt.Errorf("unexpected request to %s", req.URL)
+		}),
+		version: "1.38",
+	}
+	_, err := client.ContainerCommitSimplified(context.Background(), "container_id", types.ContainerCommitOptions{})
+	if err == nil || err.Error() != `"simplify summary" requires API version 1.39, but the Docker daemon API version is 1.38` {
+		t.Fatalf("expected a version error, got %v", err)
+	}
+}
+
+func TestContainerCommitSimplifyProfile(t *testing.T) {
+	client := &Client{
+		client: newMockClient(func(req *http.Request) (*http.Response, error) {
+			if force := req.URL.Query().Get("simplify-force"); force != "yes" {
+				return nil, fmt.Errorf("simplify-force not set in URL query properly. Expected 'yes', got %s", force)
+			}
+			var body struct {
+				container.Config
+				SimplifyProfile *types.ImageProfile
+			}
+			if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+				return nil, err
+			}
+			if body.User != "app" {
+				return nil, fmt.Errorf("expected the container config in the body, got %+v", body.Config)
+			}
+			if body.SimplifyProfile == nil || len(body.SimplifyProfile.Paths) != 1 {
+				return nil, fmt.Errorf("expected the profile in the body, got %+v", body.SimplifyProfile)
+			}
+			return &http.Response{
+				StatusCode: http.StatusCreated,
+				Body:       ioutil.NopCloser(bytes.NewReader([]byte(`{"Id":"new_container_id"}`))),
+			}, nil
+		}),
+	}
+
+	_, err := client.ContainerCommit(context.Background(), "container_id", types.ContainerCommitOptions{
+		Config:             &container.Config{User: "app"},
+		Simp:               true,
+		SimplifyUseProfile: &types.ImageProfile{Paths: []string{"/bin/sh"}},
+		SimplifyForce:      true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestContainerCommitSimplifyProfileVersion(t *testing.T) {
+	client := &Client{
+		client: newMockClient(func(req *http.Request) (*http.Response, error) {
+			return nil, fmt.Errorf("unexpected request to %s", req.URL)
+		}),
+		version: "1.38",
+	}
+	_, err := client.ContainerCommit(context.Background(), "container_id", types.ContainerCommitOptions{
+		SimplifyUseProfile: &types.ImageProfile{Paths: []string{"/bin/sh"}},
+	})
+	if err == nil || err.Error() != `"simplify-image" requires API version 1.39, but the Docker daemon API version is 1.38` {
+		t.Fatalf("expected a version error, got %v", err)
+	}
+}
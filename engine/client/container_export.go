@@ -4,16 +4,39 @@ import (
 	"context"
 	"io"
 	"net/url"
+
+	"github.com/docker/docker/api"
+	"github.com/docker/docker/api/types"
 )
 
 // ContainerExport retrieves the raw contents of a container
 // and returns them as an io.ReadCloser. It's up to the caller
 // to close the stream.
 func (cli *Client) ContainerExport(ctx context.Context, containerID string) (io.ReadCloser, error) {
-	serverResp, err := cli.get(ctx, "/containers/"+containerID+"/export", url.Values{}, nil)
+	// 修改： 导出选项由ContainerExportSimplified指定
+	return cli.ContainerExportSimplified(ctx, containerID, types.ContainerExportOptions{})
+	// 修改
+}
+
+// 修改： 添加导出选项
+
+// ContainerExportSimplified retrieves the raw contents of a container like
+// ContainerExport, with the options for containers of simplified images.
+// Sparse requires API version 1.39.
+func (cli *Client) ContainerExportSimplified(ctx context.Context, containerID string, options types.ContainerExportOptions) (io.ReadCloser, error) {
+	query := url.Values{}
+	if options.Sparse {
+		if err := cli.NewVersionError(api.SimplifyVersion, "sparse"); err != nil {
+			return nil, err
+		}
+		query.Set("sparse", "1")
+	}
+	serverResp, err := cli.get(ctx, "/containers/"+containerID+"/export", query, nil)
 	if err != nil {
 		return nil, err
 	}
 
 	return serverResp.body, nil
 }
+
+// 修改
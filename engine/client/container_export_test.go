@@ -8,6 +8,8 @@ import (
 	"net/http"
 	"strings"
 	"testing"
+
+	"github.com/docker/docker/api/types"
 )
 
 func TestContainerExportError(t *testing.T) {
@@ -47,3 +49,35 @@ func TestContainerExport(t *testing.T) {
 		t.Fatalf("expected response to contain 'response', got %s", string(content))
 	}
 }
+
+func TestContainerExportSimplified(t *testing.T) {
+	client := &Client{
+		client: newMockClient(func(r *http.Request) (*http.Response, error) {
+			if sparse := r.URL.Query().Get("sparse"); sparse != "1" {
+				return nil, fmt.Errorf("sparse not set in URL query properly. Expected '1', got %s", sparse)
+			}
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       ioutil.NopCloser(bytes.NewReader([]byte("response"))),
+			}, nil
+		}),
+	}
+	body, err := client.ContainerExportSimplified(context.Background(), "container_id", types.ContainerExportOptions{Sparse: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	body.Close()
+}
+
+func TestContainerExportSimplifiedVersion(t *testing.T) {
+	client := &Client{
+		client: newMockClient(func(req *http.Request) (*http.Response, error) {
+			return nil, fmt.Errorf("unexpected request to %s", req.URL)
+		}),
+		version: "1.38",
+	}
+	_, err := client.ContainerExportSimplified(context.Background(), "container_id", types.ContainerExportOptions{Sparse: true})
+	if err == nil || err.Error() != `"sparse" requires API version 1.39, but the Docker daemon API version is 1.38` {
+		t.Fatalf("expected a version error, got %v", err)
+	}
+}
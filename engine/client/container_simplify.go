@@ -0,0 +1,53 @@
+package client // import "github.com/docker/docker/client"
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"strconv"
+
+	"github.com/docker/docker/api/types"
+)
+
+// ContainerSimplifyRecord starts recording the files a running container
+// opens.
+func (cli *Client) ContainerSimplifyRecord(ctx context.Context, containerID string) error {
+	resp, err := cli.post(ctx, "/containers/"+containerID+"/simplify/record", nil, nil, nil)
+	ensureReaderClosed(resp)
+	return err
+}
+
+// ContainerSimplifyProfile returns the files a container opened while its
+// file accesses were recorded.
+func (cli *Client) ContainerSimplifyProfile(ctx context.Context, containerID string) (types.ContainerSimplifyProfile, error) {
+	var profile types.ContainerSimplifyProfile
+	resp, err := cli.get(ctx, "/containers/"+containerID+"/simplify/profile", nil, nil)
+	if err != nil {
+		return profile, wrapResponseError(err, resp, "container", containerID)
+	}
+	defer ensureReaderClosed(resp)
+
+	err = json.NewDecoder(resp.body).Decode(&profile)
+	return profile, err
+}
+
+// ContainerSimplifyFetches returns the files looked up on demand for a
+// container since the daemon started, as options select them.
+func (cli *Client) ContainerSimplifyFetches(ctx context.Context, containerID string, options types.ContainerSimplifyFetchesOptions) (types.ContainerSimplifyFetches, error) {
+	var fetches types.ContainerSimplifyFetches
+	query := url.Values{}
+	if options.After > 0 {
+		query.Set("after", strconv.FormatUint(options.After, 10))
+	}
+	if options.Limit > 0 {
+		query.Set("limit", strconv.Itoa(options.Limit))
+	}
+	resp, err := cli.get(ctx, "/containers/"+containerID+"/simplify/fetches", query, nil)
+	if err != nil {
+		return fetches, wrapResponseError(err, resp, "container", containerID)
+	}
+	defer ensureReaderClosed(resp)
+
+	err = json.NewDecoder(resp.body).Decode(&fetches)
+	return fetches, err
+}
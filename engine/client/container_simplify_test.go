@@ -0,0 +1,101 @@
+package client // import "github.com/docker/docker/client"
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+func TestContainerSimplifyRecord(t *testing.T) {
+	expectedURL := "/containers/container_id/simplify/record"
+	client := &Client{
+		client: newMockClient(func(req *http.Request) (*http.Response, error) {
+			if req.URL.Path != expectedURL {
+				return nil, fmt.Errorf("Expected URL '%s', got '%s'", expectedURL, req.URL)
+			}
+			if req.Method != http.MethodPost {
+				return nil, fmt.Errorf("expected POST method, got %s", req.Method)
+			}
+			return &http.Response{
+				StatusCode: http.StatusNoContent,
+				Body:       ioutil.NopCloser(bytes.NewReader(nil)),
+			}, nil
+		}),
+	}
+	assert.NilError(t, client.ContainerSimplifyRecord(context.Background(), "container_id"))
+}
+
+func TestContainerSimplifyProfileNotFound(t *testing.T) {
+	client := &Client{
+		client: newMockClient(errorMock(http.StatusNotFound, "Not found")),
+	}
+	_, err := client.ContainerSimplifyProfile(context.Background(), "unknown")
+	assert.Check(t, IsErrNotFound(err))
+}
+
+func TestContainerSimplifyProfile(t *testing.T) {
+	expectedURL := "/containers/container_id/simplify/profile"
+	expected := types.ContainerSimplifyProfile{Recording: true, Paths: []string{"/bin/sh", "/etc/passwd"}}
+	client := &Client{
+		client: newMockClient(func(req *http.Request) (*http.Response, error) {
+			if req.URL.Path != expectedURL {
+				return nil, fmt.Errorf("Expected URL '%s', got '%s'", expectedURL, req.URL)
+			}
+			b, err := json.Marshal(expected)
+			if err != nil {
+				return nil, err
+			}
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       ioutil.NopCloser(bytes.NewReader(b)),
+			}, nil
+		}),
+	}
+	profile, err := client.ContainerSimplifyProfile(context.Background(), "container_id")
+	assert.NilError(t, err)
+	assert.Check(t, is.DeepEqual(profile, expected))
+}
+
+func TestContainerSimplifyFetches(t *testing.T) {
+	expectedURL := "/containers/container_id/simplify/fetches"
+	expected := types.ContainerSimplifyFetches{
+		Fetches: []types.SimplifyFetch{
+			{ID: 43, Path: "/etc/app.conf", Size: 12, Latency: 3000000, Source: "image", Outcome: "fetched"},
+			{ID: 44, Path: "/etc/missing", Outcome: "not-found"},
+		},
+		More: true,
+	}
+	client := &Client{
+		client: newMockClient(func(req *http.Request) (*http.Response, error) {
+			if req.URL.Path != expectedURL {
+				return nil, fmt.Errorf("Expected URL '%s', got '%s'", expectedURL, req.URL)
+			}
+			query := req.URL.Query()
+			if after := query.Get("after"); after != "42" {
+				return nil, fmt.Errorf("after not set in URL query properly. Expected '42', got %s", after)
+			}
+			if limit := query.Get("limit"); limit != "2" {
+				return nil, fmt.Errorf("limit not set in URL query properly. Expected '2', got %s", limit)
+			}
+			b, err := json.Marshal(expected)
+			if err != nil {
+				return nil, err
+			}
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       ioutil.NopCloser(bytes.NewReader(b)),
+			}, nil
+		}),
+	}
+	fetches, err := client.ContainerSimplifyFetches(context.Background(), "container_id", types.ContainerSimplifyFetchesOptions{After: 42, Limit: 2})
+	assert.NilError(t, err)
+	assert.Check(t, is.DeepEqual(fetches, expected))
+}
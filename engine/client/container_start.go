@@ -3,7 +3,9 @@ package client // import "github.com/docker/docker/client"
 import (
 	"context"
 	"net/url"
+	"strconv"
 
+	"github.com/docker/docker/api"
 	"github.com/docker/docker/api/types"
 )
 
@@ -16,6 +18,35 @@ func (cli *Client) ContainerStart(ctx context.Context, containerID string, optio
 	if len(options.CheckpointDir) != 0 {
 		query.Set("checkpoint-dir", options.CheckpointDir)
 	}
+	// 修改： 添加simplify-image参数到查询中，旧版本API不支持
+	if options.Simp != nil || options.SimplifyRecord || options.SimplifyOffline || options.SimplifyFetchTimeout > 0 || options.SimplifyMaxConcurrentFetches > 0 || options.SimplifyAudit != "" {
+		if err := cli.NewVersionError(api.SimplifyVersion, "simplify-image"); err != nil {
+			return err
+		}
+	}
+	if options.Simp != nil {
+		if *options.Simp {
+			query.Set("simplify-image", "yes")
+		} else {
+			query.Set("simplify-image", "no")
+		}
+	}
+	if options.SimplifyRecord {
+		query.Set("simplify-record", "yes")
+	}
+	if options.SimplifyOffline {
+		query.Set("simplify-offline", "yes")
+	}
+	if options.SimplifyFetchTimeout > 0 {
+		query.Set("simplify-fetch-timeout", options.SimplifyFetchTimeout.String())
+	}
+	if options.SimplifyMaxConcurrentFetches > 0 {
+		query.Set("simplify-max-concurrent-fetches", strconv.Itoa(options.SimplifyMaxConcurrentFetches))
+	}
+	if options.SimplifyAudit != "" {
+		query.Set("simplify-audit", options.SimplifyAudit)
+	}
+	// 修改
 
 	resp, err := cli.post(ctx, "/containers/"+containerID+"/start", query, nil, nil)
 	ensureReaderClosed(resp)
@@ -9,8 +9,10 @@ import (
 	"net/http"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/errdefs"
 )
 
 func TestContainerStartError(t *testing.T) {
@@ -55,3 +57,137 @@ func TestContainerStart(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestContainerStartSimplify(t *testing.T) {
+	client := &Client{
+		client: newMockClient(func(req *http.Request) (*http.Response, error) {
+			simp := req.URL.Query().Get("simplify-image")
+			if simp != "yes" {
+				return nil, fmt.Errorf("simplify-image not set in URL query properly. Expected 'yes', got %s", simp)
+			}
+
+			record := req.URL.Query().Get("simplify-record")
+			if record != "yes" {
+				return nil, fmt.Errorf("simplify-record not set in URL query properly. Expected 'yes', got %s", record)
+			}
+
+			offline := req.URL.Query().Get("simplify-offline")
+			if offline != "yes" {
+				return nil, fmt.Errorf("simplify-offline not set in URL query properly. Expected 'yes', got %s", offline)
+			}
+
+			timeout := req.URL.Query().Get("simplify-fetch-timeout")
+			if timeout != "500ms" {
+				return nil, fmt.Errorf("simplify-fetch-timeout not set in URL query properly. Expected '500ms', got %s", timeout)
+			}
+
+			fetches := req.URL.Query().Get("simplify-max-concurrent-fetches")
+			if fetches != "4" {
+				return nil, fmt.Errorf("simplify-max-concurrent-fetches not set in URL query properly. Expected '4', got %s", fetches)
+			}
+
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       ioutil.NopCloser(bytes.NewReader([]byte(""))),
+			}, nil
+		}),
+	}
+
+	simp := true
+	err := client.ContainerStart(context.Background(), "container_id", types.ContainerStartOptions{Simp: &simp, SimplifyRecord: true, SimplifyFetchTimeout: 500 * time.Millisecond, SimplifyMaxConcurrentFetches: 4, SimplifyOffline: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestContainerStartSimplifyDisabled(t *testing.T) {
+	client := &Client{
+		client: newMockClient(func(req *http.Request) (*http.Response, error) {
+			if simp := req.URL.Query().Get("simplify-image"); simp != "no" {
+				return nil, fmt.Errorf("simplify-image not set in URL query properly. Expected 'no', got %s", simp)
+			}
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       ioutil.NopCloser(bytes.NewReader([]byte(""))),
+			}, nil
+		}),
+	}
+
+	simp := false
+	err := client.ContainerStart(context.Background(), "container_id", types.ContainerStartOptions{Simp: &simp})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestContainerStartSimplifyAudit(t *testing.T) {
+	client := &Client{
+		client: newMockClient(func(req *http.Request) (*http.Response, error) {
+			if audit := req.URL.Query().Get("simplify-audit"); audit != "app:latest" {
+				return nil, fmt.Errorf("simplify-audit not set in URL query properly. Expected 'app:latest', got %s", audit)
+			}
+			if simp := req.URL.Query().Get("simplify-image"); simp != "" {
+				return nil, fmt.Errorf("simplify-image should not be set, got %s", simp)
+			}
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       ioutil.NopCloser(bytes.NewReader([]byte(""))),
+			}, nil
+		}),
+	}
+
+	err := client.ContainerStart(context.Background(), "container_id", types.ContainerStartOptions{SimplifyAudit: "app:latest"})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestContainerStartSimplifyOlderVersion(t *testing.T) {
+	client := &Client{
+		client: newMockClient(func(req *http.Request) (*http.Response, error) {
+			return nil, fmt.Errorf("unexpected request to %s", req.URL)
+		}),
+		version: "1.38",
+	}
+	simp := true
+	err := client.ContainerStart(context.Background(), "container_id", types.ContainerStartOptions{Simp: &simp})
+	if err == nil || err.Error() != `"simplify-image" requires API version 1.39, but the Docker daemon API version is 1.38` {
+		t.Fatalf("expected a version error, got %v", err)
+	}
+}
+
+func TestContainerStartSimplifyErrorCode(t *testing.T) {
+	client := &Client{
+		client: newMockClient(func(req *http.Request) (*http.Response, error) {
+			header := http.Header{}
+			header.Set("Content-Type", "application/json")
+			body, err := json.Marshal(&types.ErrorResponse{
+				Message: "image nginx:latest has no simplification data",
+				Code:    types.ErrorCodeImageNotSimplified,
+			})
+			if err != nil {
+				return nil, err
+			}
+			return &http.Response{
+				StatusCode: http.StatusBadRequest,
+				Body:       ioutil.NopCloser(bytes.NewReader(body)),
+				Header:     header,
+			}, nil
+		}),
+	}
+	simp := true
+	err := client.ContainerStart(context.Background(), "container_id", types.ContainerStartOptions{Simp: &simp})
+	if err == nil || err.Error() != "Error response from daemon: image nginx:latest has no simplification data" {
+		t.Fatalf("expected the error of the daemon, got %v", err)
+	}
+	if !errdefs.IsInvalidParameter(err) {
+		t.Fatalf("expected an invalid parameter error, got %T", err)
+	}
+	if code := ErrorCode(err); code != types.ErrorCodeImageNotSimplified {
+		t.Fatalf("expected error code %s, got %q", types.ErrorCodeImageNotSimplified, code)
+	}
+	// errors without a code are left as they were
+	if code := ErrorCode(fmt.Errorf("Error response from daemon: Server error")); code != "" {
+		t.Fatalf("expected no error code, got %q", code)
+	}
+}
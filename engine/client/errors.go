@@ -5,6 +5,7 @@ import (
 	"net/http"
 
 	"github.com/docker/docker/api/types/versions"
+	"github.com/docker/docker/errdefs"
 	"github.com/pkg/errors"
 )
 
@@ -130,3 +131,48 @@ func (cli *Client) NewVersionError(APIrequired, feature string) error {
 	}
 	return nil
 }
+
+// 修改： 精简镜像相关错误的错误码
+
+// errorWithCode is an error response of the daemon that has a code.
+type errorWithCode struct {
+	message string
+	code    string
+}
+
+func (e errorWithCode) Error() string {
+	return "Error response from daemon: " + e.message
+}
+
+func (e errorWithCode) ErrorCode() string {
+	return e.code
+}
+
+// ErrorCode returns the code of the error response err of the daemon, such
+// as types.ErrorCodeImageNotSimplified, or "" if it has none.
+func ErrorCode(err error) string {
+	if e, ok := errors.Cause(err).(interface{ ErrorCode() string }); ok {
+		return e.ErrorCode()
+	}
+	return ""
+}
+
+// errorFromStatusCode gives err the errdefs class of the HTTP status code of
+// the response it was returned with.
+func errorFromStatusCode(err error, statusCode int) error {
+	switch statusCode {
+	case http.StatusBadRequest:
+		return errdefs.InvalidParameter(err)
+	case http.StatusNotFound:
+		return errdefs.NotFound(err)
+	case http.StatusConflict:
+		return errdefs.Conflict(err)
+	case http.StatusNotImplemented:
+		return errdefs.NotImplemented(err)
+	case http.StatusServiceUnavailable:
+		return errdefs.Unavailable(err)
+	}
+	return errdefs.System(err)
+}
+
+// 修改
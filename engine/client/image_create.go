@@ -4,9 +4,11 @@ import (
 	"context"
 	"io"
 	"net/url"
+	"strconv"
 	"strings"
 
 	"github.com/docker/distribution/reference"
+	"github.com/docker/docker/api"
 	"github.com/docker/docker/api/types"
 )
 
@@ -24,6 +26,26 @@ func (cli *Client) ImageCreate(ctx context.Context, parentReference string, opti
 	if options.Platform != "" {
 		query.Set("platform", strings.ToLower(options.Platform))
 	}
+	// 修改： 添加simplify-image参数到查询中，旧版本API不支持
+	if options.Simp {
+		if err := cli.NewVersionError(api.SimplifyVersion, "simplify-image"); err != nil {
+			return nil, err
+		}
+		query.Set("simplify-image", "yes")
+		if options.SimplifyThreshold != 0 {
+			query.Set("simplify-threshold", strconv.Itoa(options.SimplifyThreshold))
+		}
+		if options.SimplifyTrusted {
+			query.Set("simplify-trusted", "yes")
+		}
+		if options.SimplifySignedProfile != "" {
+			query.Set("simplify-signed-profile", options.SimplifySignedProfile)
+		}
+		if options.SimplifySignedDigest != "" {
+			query.Set("simplify-signed-digest", options.SimplifySignedDigest)
+		}
+	}
+	// 修改
 	resp, err := cli.tryImageCreate(ctx, query, options.RegistryAuth)
 	if err != nil {
 		return nil, err
@@ -73,3 +73,27 @@ func TestImageCreate(t *testing.T) {
 		t.Fatalf("expected Body to contain 'body' string, got %s", response)
 	}
 }
+
+func TestImageCreateSimplifyTrusted(t *testing.T) {
+	signed := "sha256:ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff"
+	client := &Client{
+		client: newMockClient(func(req *http.Request) (*http.Response, error) {
+			query := req.URL.Query()
+			if trusted := query.Get("simplify-trusted"); trusted != "yes" {
+				return nil, fmt.Errorf("simplify-trusted not set in URL query properly. Expected 'yes', got %s", trusted)
+			}
+			if dgst := query.Get("simplify-signed-digest"); dgst != signed {
+				return nil, fmt.Errorf("simplify-signed-digest not set in URL query properly. Expected '%s', got %s", signed, dgst)
+			}
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       ioutil.NopCloser(bytes.NewReader([]byte(""))),
+			}, nil
+		}),
+	}
+	resp, err := client.ImageCreate(context.Background(), "myimage@"+signed, types.ImageCreateOptions{Simp: true, SimplifyTrusted: true, SimplifySignedDigest: signed})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Close()
+}
@@ -0,0 +1,22 @@
+package client // import "github.com/docker/docker/client"
+
+import (
+	"context"
+	"io"
+)
+
+// ImageDesimplify requests the docker host to restore the full image target
+// from the simplified image name, downloading the layers of the full image
+// that are missing locally. It's up to the caller to handle the
+// io.ReadCloser, which streams the progress, and close it properly.
+func (cli *Client) ImageDesimplify(ctx context.Context, name, target string) (io.ReadCloser, error) {
+	query, err := targetQuery(target)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := cli.post(ctx, "/images/"+name+"/desimplify", query, nil, nil)
+	if err != nil {
+		return nil, wrapResponseError(err, resp, "image", name)
+	}
+	return resp.body, nil
+}
@@ -0,0 +1,49 @@
+package client // import "github.com/docker/docker/client"
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+func TestImageDesimplifyAnyError(t *testing.T) {
+	client := &Client{
+		client: newMockClient(errorMock(http.StatusInternalServerError, "Server error")),
+	}
+	_, err := client.ImageDesimplify(context.Background(), "app:slim", "app:full")
+	assert.Check(t, is.ErrorContains(err, "Error response from daemon: Server error"))
+}
+
+func TestImageDesimplify(t *testing.T) {
+	expectedURL := "/images/app:slim/desimplify"
+	client := &Client{
+		client: newMockClient(func(req *http.Request) (*http.Response, error) {
+			if req.URL.Path != expectedURL {
+				return nil, fmt.Errorf("Expected URL '%s', got '%s'", expectedURL, req.URL)
+			}
+			query := req.URL.Query()
+			if repo := query.Get("repo"); repo != "registry.example.com/app" {
+				return nil, fmt.Errorf("repo not set in URL query properly. Expected 'registry.example.com/app', got %s", repo)
+			}
+			if tag := query.Get("tag"); tag != "latest" {
+				return nil, fmt.Errorf("tag not set in URL query properly. Expected 'latest', got %s", tag)
+			}
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       ioutil.NopCloser(bytes.NewReader([]byte("body"))),
+			}, nil
+		}),
+	}
+	body, err := client.ImageDesimplify(context.Background(), "app:slim", "registry.example.com/app")
+	assert.NilError(t, err)
+	defer body.Close()
+	b, err := ioutil.ReadAll(body)
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(string(b), "body"))
+}
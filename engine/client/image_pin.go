@@ -0,0 +1,38 @@
+package client // import "github.com/docker/docker/client"
+
+import (
+	"context"
+	"io"
+	"net/url"
+
+	"github.com/docker/docker/api/types"
+)
+
+// ImagePin requests the docker host to pin paths in the cache of the
+// simplified image, fetching the files pruned from it among them at once.
+// Pinned files are never evicted from the cache. It's up to the caller to
+// handle the io.ReadCloser, which streams the progress, and close it
+// properly.
+func (cli *Client) ImagePin(ctx context.Context, image string, options types.ImagePinOptions) (io.ReadCloser, error) {
+	resp, err := cli.post(ctx, "/images/"+image+"/simplify/pin", pinQuery(options), nil, nil)
+	if err != nil {
+		return nil, wrapResponseError(err, resp, "image", image)
+	}
+	return resp.body, nil
+}
+
+// ImageUnpin unpins paths from the cache of the simplified image, so that
+// the files matching them may be evicted again.
+func (cli *Client) ImageUnpin(ctx context.Context, image string, options types.ImagePinOptions) error {
+	resp, err := cli.post(ctx, "/images/"+image+"/simplify/unpin", pinQuery(options), nil, nil)
+	ensureReaderClosed(resp)
+	return wrapResponseError(err, resp, "image", image)
+}
+
+func pinQuery(options types.ImagePinOptions) url.Values {
+	query := url.Values{}
+	for _, p := range options.Paths {
+		query.Add("paths", p)
+	}
+	return query
+}
@@ -0,0 +1,74 @@
+package client // import "github.com/docker/docker/client"
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+func TestImagePinAnyError(t *testing.T) {
+	client := &Client{
+		client: newMockClient(errorMock(http.StatusInternalServerError, "Server error")),
+	}
+	_, err := client.ImagePin(context.Background(), "app:slim", types.ImagePinOptions{})
+	assert.Check(t, is.ErrorContains(err, "Error response from daemon: Server error"))
+}
+
+func TestImagePin(t *testing.T) {
+	expectedURL := "/images/app:slim/simplify/pin"
+	client := &Client{
+		client: newMockClient(func(req *http.Request) (*http.Response, error) {
+			if req.URL.Path != expectedURL {
+				return nil, fmt.Errorf("Expected URL '%s', got '%s'", expectedURL, req.URL)
+			}
+			if paths := req.URL.Query()["paths"]; len(paths) != 2 || paths[0] != "/usr/bin/gdb" || paths[1] != "/etc" {
+				return nil, fmt.Errorf("paths not set in URL query properly. Expected [/usr/bin/gdb /etc], got %v", paths)
+			}
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       ioutil.NopCloser(bytes.NewReader([]byte("body"))),
+			}, nil
+		}),
+	}
+	body, err := client.ImagePin(context.Background(), "app:slim", types.ImagePinOptions{Paths: []string{"/usr/bin/gdb", "/etc"}})
+	assert.NilError(t, err)
+	defer body.Close()
+	b, err := ioutil.ReadAll(body)
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(string(b), "body"))
+}
+
+func TestImageUnpinAnyError(t *testing.T) {
+	client := &Client{
+		client: newMockClient(errorMock(http.StatusBadRequest, "not pinned in image app:slim: /etc")),
+	}
+	err := client.ImageUnpin(context.Background(), "app:slim", types.ImagePinOptions{Paths: []string{"/etc"}})
+	assert.Check(t, is.ErrorContains(err, "Error response from daemon: not pinned in image app:slim: /etc"))
+}
+
+func TestImageUnpin(t *testing.T) {
+	expectedURL := "/images/app:slim/simplify/unpin"
+	client := &Client{
+		client: newMockClient(func(req *http.Request) (*http.Response, error) {
+			if req.URL.Path != expectedURL {
+				return nil, fmt.Errorf("Expected URL '%s', got '%s'", expectedURL, req.URL)
+			}
+			if paths := req.URL.Query()["paths"]; len(paths) != 1 || paths[0] != "/usr/bin/gdb" {
+				return nil, fmt.Errorf("paths not set in URL query properly. Expected [/usr/bin/gdb], got %v", paths)
+			}
+			return &http.Response{
+				StatusCode: http.StatusNoContent,
+				Body:       ioutil.NopCloser(bytes.NewReader(nil)),
+			}, nil
+		}),
+	}
+	err := client.ImageUnpin(context.Background(), "app:slim", types.ImagePinOptions{Paths: []string{"/usr/bin/gdb"}})
+	assert.NilError(t, err)
+}
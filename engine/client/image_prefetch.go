@@ -0,0 +1,25 @@
+package client // import "github.com/docker/docker/client"
+
+import (
+	"context"
+	"io"
+	"net/url"
+
+	"github.com/docker/docker/api/types"
+)
+
+// ImagePrefetch requests the docker host to fetch the files pruned from the
+// simplified image into the cache its containers find missing files in,
+// ahead of the containers opening them. It's up to the caller to handle the
+// io.ReadCloser, which streams the progress, and close it properly.
+func (cli *Client) ImagePrefetch(ctx context.Context, image string, options types.ImagePrefetchOptions) (io.ReadCloser, error) {
+	query := url.Values{}
+	for _, p := range options.Paths {
+		query.Add("paths", p)
+	}
+	resp, err := cli.post(ctx, "/images/"+image+"/prefetch", query, nil, nil)
+	if err != nil {
+		return nil, wrapResponseError(err, resp, "image", image)
+	}
+	return resp.body, nil
+}
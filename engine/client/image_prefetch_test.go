@@ -0,0 +1,46 @@
+package client // import "github.com/docker/docker/client"
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+func TestImagePrefetchAnyError(t *testing.T) {
+	client := &Client{
+		client: newMockClient(errorMock(http.StatusInternalServerError, "Server error")),
+	}
+	_, err := client.ImagePrefetch(context.Background(), "app:slim", types.ImagePrefetchOptions{})
+	assert.Check(t, is.ErrorContains(err, "Error response from daemon: Server error"))
+}
+
+func TestImagePrefetch(t *testing.T) {
+	expectedURL := "/images/app:slim/prefetch"
+	client := &Client{
+		client: newMockClient(func(req *http.Request) (*http.Response, error) {
+			if req.URL.Path != expectedURL {
+				return nil, fmt.Errorf("Expected URL '%s', got '%s'", expectedURL, req.URL)
+			}
+			if paths := req.URL.Query()["paths"]; len(paths) != 2 || paths[0] != "/usr/lib/*" || paths[1] != "/etc" {
+				return nil, fmt.Errorf("paths not set in URL query properly. Expected [/usr/lib/* /etc], got %v", paths)
+			}
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       ioutil.NopCloser(bytes.NewReader([]byte("body"))),
+			}, nil
+		}),
+	}
+	body, err := client.ImagePrefetch(context.Background(), "app:slim", types.ImagePrefetchOptions{Paths: []string{"/usr/lib/*", "/etc"}})
+	assert.NilError(t, err)
+	defer body.Close()
+	b, err := ioutil.ReadAll(body)
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(string(b), "body"))
+}
@@ -0,0 +1,68 @@
+package client // import "github.com/docker/docker/client"
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+
+	"github.com/docker/docker/api/types"
+)
+
+// ImageProfileList returns the simplify profiles stored for images.
+func (cli *Client) ImageProfileList(ctx context.Context) ([]types.ImageProfileSummary, error) {
+	var profiles []types.ImageProfileSummary
+	resp, err := cli.get(ctx, "/images/simplify/profiles", nil, nil)
+	if err != nil {
+		return profiles, err
+	}
+	defer ensureReaderClosed(resp)
+
+	err = json.NewDecoder(resp.body).Decode(&profiles)
+	return profiles, err
+}
+
+// ImageProfileInspect returns the simplify profile stored for an image.
+func (cli *Client) ImageProfileInspect(ctx context.Context, image string) (types.ImageProfile, error) {
+	var profile types.ImageProfile
+	resp, err := cli.get(ctx, "/images/"+image+"/simplify/profile", nil, nil)
+	if err != nil {
+		return profile, wrapResponseError(err, resp, "image profile", image)
+	}
+	defer ensureReaderClosed(resp)
+
+	err = json.NewDecoder(resp.body).Decode(&profile)
+	return profile, err
+}
+
+// ImageProfileSave stores the simplify profile of an image, replacing any
+// previous one.
+func (cli *Client) ImageProfileSave(ctx context.Context, image string, profile types.ImageProfile) error {
+	resp, err := cli.post(ctx, "/images/"+image+"/simplify/profile", nil, profile, nil)
+	ensureReaderClosed(resp)
+	return wrapResponseError(err, resp, "image", image)
+}
+
+// ImageProfileRemove removes the simplify profile stored for an image.
+func (cli *Client) ImageProfileRemove(ctx context.Context, image string) error {
+	resp, err := cli.delete(ctx, "/images/"+image+"/simplify/profile", nil, nil)
+	ensureReaderClosed(resp)
+	return wrapResponseError(err, resp, "image profile", image)
+}
+
+// ImageProfileMerge merges the simplify profiles of sources, containers or
+// images, into the profile of an image.
+func (cli *Client) ImageProfileMerge(ctx context.Context, image string, sources []string, options types.ImageProfileMergeOptions) (types.ImageProfileSummary, error) {
+	var summary types.ImageProfileSummary
+	query := url.Values{"source": sources}
+	if options.Force {
+		query.Set("force", "1")
+	}
+	resp, err := cli.post(ctx, "/images/"+image+"/simplify/profile/merge", query, nil, nil)
+	if err != nil {
+		return summary, wrapResponseError(err, resp, "image", image)
+	}
+	defer ensureReaderClosed(resp)
+
+	err = json.NewDecoder(resp.body).Decode(&summary)
+	return summary, err
+}
@@ -0,0 +1,148 @@
+package client // import "github.com/docker/docker/client"
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+func TestImageProfileList(t *testing.T) {
+	expectedURL := "/images/simplify/profiles"
+	expected := []types.ImageProfileSummary{{Image: "sha256:abc", Reference: "app:latest", Files: 2}}
+	client := &Client{
+		client: newMockClient(func(req *http.Request) (*http.Response, error) {
+			if req.URL.Path != expectedURL {
+				return nil, fmt.Errorf("Expected URL '%s', got '%s'", expectedURL, req.URL)
+			}
+			b, err := json.Marshal(expected)
+			if err != nil {
+				return nil, err
+			}
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       ioutil.NopCloser(bytes.NewReader(b)),
+			}, nil
+		}),
+	}
+	profiles, err := client.ImageProfileList(context.Background())
+	assert.NilError(t, err)
+	assert.Check(t, is.DeepEqual(profiles, expected))
+}
+
+func TestImageProfileInspectNotFound(t *testing.T) {
+	client := &Client{
+		client: newMockClient(errorMock(http.StatusNotFound, "Not found")),
+	}
+	_, err := client.ImageProfileInspect(context.Background(), "unknown")
+	assert.Check(t, IsErrNotFound(err))
+}
+
+func TestImageProfileInspect(t *testing.T) {
+	expectedURL := "/images/app:latest/simplify/profile"
+	expected := types.ImageProfile{Image: "sha256:abc", Stale: true, Paths: []string{"/bin/sh"}}
+	client := &Client{
+		client: newMockClient(func(req *http.Request) (*http.Response, error) {
+			if req.URL.Path != expectedURL {
+				return nil, fmt.Errorf("Expected URL '%s', got '%s'", expectedURL, req.URL)
+			}
+			b, err := json.Marshal(expected)
+			if err != nil {
+				return nil, err
+			}
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       ioutil.NopCloser(bytes.NewReader(b)),
+			}, nil
+		}),
+	}
+	profile, err := client.ImageProfileInspect(context.Background(), "app:latest")
+	assert.NilError(t, err)
+	assert.Check(t, is.DeepEqual(profile, expected))
+}
+
+func TestImageProfileSave(t *testing.T) {
+	expectedURL := "/images/app:latest/simplify/profile"
+	client := &Client{
+		client: newMockClient(func(req *http.Request) (*http.Response, error) {
+			if req.URL.Path != expectedURL {
+				return nil, fmt.Errorf("Expected URL '%s', got '%s'", expectedURL, req.URL)
+			}
+			if req.Method != http.MethodPost {
+				return nil, fmt.Errorf("expected POST method, got %s", req.Method)
+			}
+			var profile types.ImageProfile
+			if err := json.NewDecoder(req.Body).Decode(&profile); err != nil {
+				return nil, err
+			}
+			if len(profile.Paths) != 1 || profile.Paths[0] != "/bin/sh" {
+				return nil, fmt.Errorf("unexpected paths %v", profile.Paths)
+			}
+			return &http.Response{
+				StatusCode: http.StatusNoContent,
+				Body:       ioutil.NopCloser(bytes.NewReader(nil)),
+			}, nil
+		}),
+	}
+	err := client.ImageProfileSave(context.Background(), "app:latest", types.ImageProfile{Paths: []string{"/bin/sh"}})
+	assert.NilError(t, err)
+}
+
+func TestImageProfileRemove(t *testing.T) {
+	expectedURL := "/images/app:latest/simplify/profile"
+	client := &Client{
+		client: newMockClient(func(req *http.Request) (*http.Response, error) {
+			if req.URL.Path != expectedURL {
+				return nil, fmt.Errorf("Expected URL '%s', got '%s'", expectedURL, req.URL)
+			}
+			if req.Method != http.MethodDelete {
+				return nil, fmt.Errorf("expected DELETE method, got %s", req.Method)
+			}
+			return &http.Response{
+				StatusCode: http.StatusNoContent,
+				Body:       ioutil.NopCloser(bytes.NewReader(nil)),
+			}, nil
+		}),
+	}
+	assert.NilError(t, client.ImageProfileRemove(context.Background(), "app:latest"))
+}
+
+func TestImageProfileMerge(t *testing.T) {
+	expectedURL := "/images/app:latest/simplify/profile/merge"
+	expected := types.ImageProfileSummary{Image: "sha256:abc", Reference: "app:latest", Files: 3, Runs: 2}
+	client := &Client{
+		client: newMockClient(func(req *http.Request) (*http.Response, error) {
+			if req.URL.Path != expectedURL {
+				return nil, fmt.Errorf("Expected URL '%s', got '%s'", expectedURL, req.URL)
+			}
+			if req.Method != http.MethodPost {
+				return nil, fmt.Errorf("expected POST method, got %s", req.Method)
+			}
+			query := req.URL.Query()
+			if sources := query["source"]; len(sources) != 2 || sources[0] != "run1" || sources[1] != "run2" {
+				return nil, fmt.Errorf("unexpected sources %v", sources)
+			}
+			if force := query.Get("force"); force != "1" {
+				return nil, fmt.Errorf("force not set, got %s", force)
+			}
+			b, err := json.Marshal(expected)
+			if err != nil {
+				return nil, err
+			}
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       ioutil.NopCloser(bytes.NewReader(b)),
+			}, nil
+		}),
+	}
+	summary, err := client.ImageProfileMerge(context.Background(), "app:latest", []string{"run1", "run2"}, types.ImageProfileMergeOptions{Force: true})
+	assert.NilError(t, err)
+	assert.Check(t, is.DeepEqual(summary, expected))
+}
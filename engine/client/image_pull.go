@@ -5,10 +5,13 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 
 	"github.com/docker/distribution/reference"
+	"github.com/docker/docker/api"
 	"github.com/docker/docker/api/types"
+	"github.com/pkg/errors"
 )
 
 // ImagePull requests the docker host to pull an image from a remote registry.
@@ -33,21 +36,74 @@ func (cli *Client) ImagePull(ctx context.Context, refStr string, options types.I
 	if options.Platform != "" {
 		query.Set("platform", strings.ToLower(options.Platform))
 	}
+	// 修改： 添加simplify-image参数到查询中，旧版本API不支持
+	simp := options.Simplify || options.Simp
+	if simp {
+		if err := cli.NewVersionError(api.SimplifyVersion, "simplify-image"); err != nil {
+			return nil, err
+		}
+		query.Set("simplify-image", "yes")
+		if options.SimplifyThreshold != 0 {
+			query.Set("simplify-threshold", strconv.Itoa(options.SimplifyThreshold))
+		}
+		if options.SimplifyRequired {
+			query.Set("simplify-required", "yes")
+		}
+		if options.SimplifyForce {
+			query.Set("simplify-force", "yes")
+		}
+		if options.SimplifyTrusted {
+			query.Set("simplify-trusted", "yes")
+		}
+		if options.SimplifySignedProfile != "" {
+			query.Set("simplify-signed-profile", options.SimplifySignedProfile)
+		}
+		if options.SimplifySignedDigest != "" {
+			query.Set("simplify-signed-digest", options.SimplifySignedDigest)
+		}
+		if options.SimplifyProfile != "" {
+			if options.SimplifyUseProfile != nil {
+				return nil, errors.New("SimplifyProfile cannot be used with SimplifyUseProfile")
+			}
+			query.Set("simplify-profile", options.SimplifyProfile)
+		}
+	}
+	// 修改
 
-	resp, err := cli.tryImageCreate(ctx, query, options.RegistryAuth)
+	// 修改： 指定了profile时随请求体上传
+	var profile *types.ImageProfile
+	if simp {
+		profile = options.SimplifyUseProfile
+	}
+	resp, err := cli.tryImagePull(ctx, query, options.RegistryAuth, profile)
 	if resp.statusCode == http.StatusUnauthorized && options.PrivilegeFunc != nil {
 		newAuthHeader, privilegeErr := options.PrivilegeFunc()
 		if privilegeErr != nil {
 			return nil, privilegeErr
 		}
-		resp, err = cli.tryImageCreate(ctx, query, newAuthHeader)
+		resp, err = cli.tryImagePull(ctx, query, newAuthHeader, profile)
 	}
+	// 修改
 	if err != nil {
 		return nil, err
 	}
 	return resp.body, nil
 }
 
+// 修改： 精简拉取指定的profile作为请求体上传
+
+// tryImagePull creates the image of query, uploading profile, if not nil,
+// to select the files of the image kept once simplified.
+func (cli *Client) tryImagePull(ctx context.Context, query url.Values, registryAuth string, profile *types.ImageProfile) (serverResponse, error) {
+	if profile == nil {
+		return cli.tryImageCreate(ctx, query, registryAuth)
+	}
+	headers := map[string][]string{"X-Registry-Auth": {registryAuth}}
+	return cli.post(ctx, "/images/create", query, profile, headers)
+}
+
+// 修改
+
 // getAPITagFromNamedRef returns a tag from the specified reference.
 // This function is necessary as long as the docker "server" api expects
 // digests to be sent as tags and makes a distinction between the name
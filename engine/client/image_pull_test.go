@@ -3,6 +3,7 @@ package client // import "github.com/docker/docker/client"
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -196,3 +197,155 @@ func TestImagePullWithoutErrors(t *testing.T) {
 		}
 	}
 }
+
+func TestImagePullSimplifyImage(t *testing.T) {
+	client := &Client{
+		client: newMockClient(func(req *http.Request) (*http.Response, error) {
+			simp := req.URL.Query().Get("simplify-image")
+			if simp != "yes" {
+				return nil, fmt.Errorf("simplify-image not set in URL query properly. Expected 'yes', got %s", simp)
+			}
+			if threshold := req.URL.Query().Get("simplify-threshold"); threshold != "50" {
+				return nil, fmt.Errorf("simplify-threshold not set in URL query properly. Expected '50', got %s", threshold)
+			}
+			if required := req.URL.Query().Get("simplify-required"); required != "yes" {
+				return nil, fmt.Errorf("simplify-required not set in URL query properly. Expected 'yes', got %s", required)
+			}
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       ioutil.NopCloser(bytes.NewReader([]byte(""))),
+			}, nil
+		}),
+	}
+	resp, err := client.ImagePull(context.Background(), "myimage", types.ImagePullOptions{Simplify: true, SimplifyThreshold: 50, SimplifyRequired: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Close()
+}
+
+func TestImagePullSimplifyTrusted(t *testing.T) {
+	signed := "sha256:9e3ae9ad5b58fe82a4d4b7a5ab3a0ee4d2a0ef4c3a23b4b2f4a1b3e0b8c2d7e1"
+	client := &Client{
+		client: newMockClient(func(req *http.Request) (*http.Response, error) {
+			if trusted := req.URL.Query().Get("simplify-trusted"); trusted != "yes" {
+				return nil, fmt.Errorf("simplify-trusted not set in URL query properly. Expected 'yes', got %s", trusted)
+			}
+			if profile := req.URL.Query().Get("simplify-signed-profile"); profile != signed {
+				return nil, fmt.Errorf("simplify-signed-profile not set in URL query properly. Expected '%s', got %s", signed, profile)
+			}
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       ioutil.NopCloser(bytes.NewReader([]byte(""))),
+			}, nil
+		}),
+	}
+	resp, err := client.ImagePull(context.Background(), "myimage", types.ImagePullOptions{Simplify: true, SimplifyTrusted: true, SimplifySignedProfile: signed})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Close()
+}
+
+func TestImagePullSimplifyOlderVersion(t *testing.T) {
+	client := &Client{
+		client: newMockClient(func(req *http.Request) (*http.Response, error) {
+			return nil, fmt.Errorf("unexpected request to %s", req.URL)
+		}),
+		version: "1.38",
+	}
+	_, err := client.ImagePull(context.Background(), "myimage", types.ImagePullOptions{Simplify: true})
+	if err == nil || err.Error() != `"simplify-image" requires API version 1.39, but the Docker daemon API version is 1.38` {
+		t.Fatalf("expected a version error, got %v", err)
+	}
+}
+
+func TestImagePullSimplifyProfile(t *testing.T) {
+	client := &Client{
+		client: newMockClient(func(req *http.Request) (*http.Response, error) {
+			if contentType := req.Header.Get("Content-Type"); contentType != "application/json" {
+				return nil, fmt.Errorf("Content-type header not set properly. Expected 'application/json', got %s", contentType)
+			}
+			var profile types.ImageProfile
+			if err := json.NewDecoder(req.Body).Decode(&profile); err != nil {
+				return nil, err
+			}
+			if len(profile.Paths) != 1 || profile.Paths[0] != "/bin/sh" {
+				return nil, fmt.Errorf("expected the profile in the body, got %+v", profile)
+			}
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       ioutil.NopCloser(bytes.NewReader([]byte(""))),
+			}, nil
+		}),
+	}
+	resp, err := client.ImagePull(context.Background(), "myimage", types.ImagePullOptions{
+		Simplify:           true,
+		SimplifyUseProfile: &types.ImageProfile{Paths: []string{"/bin/sh"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Close()
+}
+
+func TestImagePullSimplifyProfileFrom(t *testing.T) {
+	client := &Client{
+		client: newMockClient(func(req *http.Request) (*http.Response, error) {
+			query := req.URL.Query()
+			if simp := query.Get("simplify-image"); simp != "yes" {
+				return nil, fmt.Errorf("simplify-image not set in URL query properly. Expected 'yes', got %s", simp)
+			}
+			if profile := query.Get("simplify-profile"); profile != "myimage:1.0" {
+				return nil, fmt.Errorf("simplify-profile not set in URL query properly. Expected 'myimage:1.0', got %s", profile)
+			}
+			if req.ContentLength > 0 {
+				return nil, fmt.Errorf("expected no body, got %d bytes", req.ContentLength)
+			}
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       ioutil.NopCloser(bytes.NewReader([]byte(""))),
+			}, nil
+		}),
+	}
+	resp, err := client.ImagePull(context.Background(), "myimage:1.1", types.ImagePullOptions{Simplify: true, SimplifyProfile: "myimage:1.0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Close()
+}
+
+func TestImagePullSimplifyProfileWithUseProfile(t *testing.T) {
+	client := &Client{
+		client: newMockClient(func(req *http.Request) (*http.Response, error) {
+			return nil, fmt.Errorf("unexpected request to %s", req.URL)
+		}),
+	}
+	_, err := client.ImagePull(context.Background(), "myimage", types.ImagePullOptions{
+		Simplify:           true,
+		SimplifyProfile:    "myimage:1.0",
+		SimplifyUseProfile: &types.ImageProfile{Paths: []string{"/bin/sh"}},
+	})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestImagePullSimpDeprecated(t *testing.T) {
+	client := &Client{
+		client: newMockClient(func(req *http.Request) (*http.Response, error) {
+			if simp := req.URL.Query().Get("simplify-image"); simp != "yes" {
+				return nil, fmt.Errorf("simplify-image not set in URL query properly. Expected 'yes', got %s", simp)
+			}
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       ioutil.NopCloser(bytes.NewReader([]byte(""))),
+			}, nil
+		}),
+	}
+	resp, err := client.ImagePull(context.Background(), "myimage", types.ImagePullOptions{Simp: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Close()
+}
@@ -34,6 +34,14 @@ func (cli *Client) ImagePush(ctx context.Context, image string, options types.Im
 
 	query := url.Values{}
 	query.Set("tag", tag)
+	// 修改： 推送精简镜像的profile和可按文件下载的层
+	if options.SimplifyPushProfile {
+		query.Set("simplify-profile", "yes")
+	}
+	if options.SimplifyTOC {
+		query.Set("simplify-toc", "yes")
+	}
+	// 修改
 
 	resp, err := cli.tryImagePush(ctx, name, query, options.RegistryAuth)
 	if resp.statusCode == http.StatusUnauthorized && options.PrivilegeFunc != nil {
@@ -177,3 +177,43 @@ func TestImagePushWithoutErrors(t *testing.T) {
 		}
 	}
 }
+
+func TestImagePushSimplifyProfile(t *testing.T) {
+	client := &Client{
+		client: newMockClient(func(req *http.Request) (*http.Response, error) {
+			if profile := req.URL.Query().Get("simplify-profile"); profile != "yes" {
+				return nil, fmt.Errorf("simplify-profile not set in URL query properly. Expected 'yes', got %s", profile)
+			}
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       ioutil.NopCloser(bytes.NewReader([]byte(""))),
+			}, nil
+		}),
+	}
+	_, err := client.ImagePush(context.Background(), "myimage:tag", types.ImagePushOptions{SimplifyPushProfile: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestImagePushSimplifyTOC(t *testing.T) {
+	client := &Client{
+		client: newMockClient(func(req *http.Request) (*http.Response, error) {
+			query := req.URL.Query()
+			if toc := query.Get("simplify-toc"); toc != "yes" {
+				return nil, fmt.Errorf("simplify-toc not set in URL query properly. Expected 'yes', got %s", toc)
+			}
+			if profile := query.Get("simplify-profile"); profile != "" {
+				return nil, fmt.Errorf("simplify-profile should not be set in URL query, got %s", profile)
+			}
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       ioutil.NopCloser(bytes.NewReader([]byte(""))),
+			}, nil
+		}),
+	}
+	_, err := client.ImagePush(context.Background(), "myimage:tag", types.ImagePushOptions{SimplifyTOC: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
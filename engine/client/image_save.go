@@ -4,14 +4,34 @@ import (
 	"context"
 	"io"
 	"net/url"
+
+	"github.com/docker/docker/api"
+	"github.com/docker/docker/api/types"
 )
 
 // ImageSave retrieves one or more images from the docker host as an io.ReadCloser.
 // It's up to the caller to store the images and close the stream.
 func (cli *Client) ImageSave(ctx context.Context, imageIDs []string) (io.ReadCloser, error) {
+	// 修改： 保存选项由ImageSaveSimplified指定
+	return cli.ImageSaveSimplified(ctx, imageIDs, types.ImageSaveOptions{})
+	// 修改
+}
+
+// 修改： 添加保存选项
+
+// ImageSaveSimplified retrieves one or more images from the docker host like
+// ImageSave, with the options for simplified images. Simplified requires API
+// version 1.39.
+func (cli *Client) ImageSaveSimplified(ctx context.Context, imageIDs []string, options types.ImageSaveOptions) (io.ReadCloser, error) {
 	query := url.Values{
 		"names": imageIDs,
 	}
+	if options.Simplified {
+		if err := cli.NewVersionError(api.SimplifyVersion, "simplified"); err != nil {
+			return nil, err
+		}
+		query.Set("simplified", "1")
+	}
 
 	resp, err := cli.get(ctx, "/images/get", query, nil)
 	if err != nil {
@@ -19,3 +39,5 @@ func (cli *Client) ImageSave(ctx context.Context, imageIDs []string) (io.ReadClo
 	}
 	return resp.body, nil
 }
+
+// 修改
@@ -9,6 +9,8 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+
+	"github.com/docker/docker/api/types"
 )
 
 func TestImageSaveError(t *testing.T) {
@@ -54,3 +56,35 @@ func TestImageSave(t *testing.T) {
 		t.Fatalf("expected response to contain 'response', got %s", string(response))
 	}
 }
+
+func TestImageSaveSimplified(t *testing.T) {
+	client := &Client{
+		client: newMockClient(func(r *http.Request) (*http.Response, error) {
+			if simplified := r.URL.Query().Get("simplified"); simplified != "1" {
+				return nil, fmt.Errorf("simplified not set in URL query properly. Expected '1', got %s", simplified)
+			}
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       ioutil.NopCloser(bytes.NewReader([]byte("response"))),
+			}, nil
+		}),
+	}
+	saveResponse, err := client.ImageSaveSimplified(context.Background(), []string{"image_id1"}, types.ImageSaveOptions{Simplified: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	saveResponse.Close()
+}
+
+func TestImageSaveSimplifiedVersion(t *testing.T) {
+	client := &Client{
+		client: newMockClient(func(req *http.Request) (*http.Response, error) {
+			return nil, fmt.Errorf("unexpected request to %s", req.URL)
+		}),
+		version: "1.38",
+	}
+	_, err := client.ImageSaveSimplified(context.Background(), []string{"image_id1"}, types.ImageSaveOptions{Simplified: true})
+	if err == nil || err.Error() != `"simplified" requires API version 1.39, but the Docker daemon API version is 1.38` {
+		t.Fatalf("expected a version error, got %v", err)
+	}
+}
@@ -0,0 +1,49 @@
+package client // import "github.com/docker/docker/client"
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/url"
+
+	"github.com/docker/distribution/reference"
+	"github.com/docker/docker/api/types"
+)
+
+// ImageSimplify requests the docker host to simplify the image source as
+// described by options, and to tag the result as options.Target if set.
+// Without a profile in options, the one stored for source is used. It's up
+// to the caller to handle the io.ReadCloser, which streams the progress, and
+// close it properly.
+func (cli *Client) ImageSimplify(ctx context.Context, source string, options types.ImageSimplifyOptions) (io.ReadCloser, error) {
+	if _, err := targetQuery(options.Target); err != nil {
+		return nil, err
+	}
+	resp, err := cli.post(ctx, "/images/"+source+"/simplify", nil, options, nil)
+	if err != nil {
+		return nil, wrapResponseError(err, resp, "image", source)
+	}
+	return resp.body, nil
+}
+
+// targetQuery returns the repo and tag query parameters naming the image
+// target to create.
+func targetQuery(target string) (url.Values, error) {
+	query := url.Values{}
+	if target == "" {
+		return query, nil
+	}
+	ref, err := reference.ParseNormalizedNamed(target)
+	if err != nil {
+		return nil, err
+	}
+	if _, isCanonical := ref.(reference.Canonical); isCanonical {
+		return nil, errors.New("refusing to create a tag with a digest reference")
+	}
+	ref = reference.TagNameOnly(ref)
+	query.Set("repo", reference.FamiliarName(ref))
+	if tagged, ok := ref.(reference.Tagged); ok {
+		query.Set("tag", tagged.Tag())
+	}
+	return query, nil
+}
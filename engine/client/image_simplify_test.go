@@ -0,0 +1,69 @@
+package client // import "github.com/docker/docker/client"
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+func TestImageSimplifyAnyError(t *testing.T) {
+	client := &Client{
+		client: newMockClient(errorMock(http.StatusInternalServerError, "Server error")),
+	}
+	_, err := client.ImageSimplify(context.Background(), "app", types.ImageSimplifyOptions{Target: "app:slim"})
+	assert.Check(t, is.ErrorContains(err, "Error response from daemon: Server error"))
+}
+
+func TestImageSimplifyDigestTarget(t *testing.T) {
+	client := &Client{}
+	_, err := client.ImageSimplify(context.Background(), "app", types.ImageSimplifyOptions{Target: "app@sha256:c5f1a7c9d4b3bbee2b1e8c7f3b9ac5e67d4dd2ee4a23aed8d1fd1b2c1a0dd2bf"})
+	assert.Check(t, is.ErrorContains(err, "refusing to create a tag with a digest reference"))
+}
+
+func TestImageSimplify(t *testing.T) {
+	expectedURL := "/images/app:latest/simplify"
+	threshold := 50
+	options := types.ImageSimplifyOptions{
+		Target:      "registry.example.com/app:slim",
+		ProfileFrom: "app:previous",
+		Threshold:   &threshold,
+		Keep:        []string{"/etc/ssl/**"},
+		Prune:       []string{"/usr/share/doc/**"},
+	}
+	client := &Client{
+		client: newMockClient(func(req *http.Request) (*http.Response, error) {
+			if req.URL.Path != expectedURL {
+				return nil, fmt.Errorf("Expected URL '%s', got '%s'", expectedURL, req.URL)
+			}
+			if req.Method != http.MethodPost {
+				return nil, fmt.Errorf("expected POST method, got %s", req.Method)
+			}
+			var body types.ImageSimplifyOptions
+			if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+				return nil, err
+			}
+			if !reflect.DeepEqual(body, options) {
+				return nil, fmt.Errorf("options not set in request body properly. Expected %+v, got %+v", options, body)
+			}
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       ioutil.NopCloser(bytes.NewReader([]byte("progress"))),
+			}, nil
+		}),
+	}
+	rc, err := client.ImageSimplify(context.Background(), "app:latest", options)
+	assert.NilError(t, err)
+	b, err := ioutil.ReadAll(rc)
+	assert.NilError(t, err)
+	rc.Close()
+	assert.Check(t, is.Equal(string(b), "progress"))
+}
@@ -209,16 +209,23 @@ func (cli *Client) checkResponseErr(serverResp serverResponse) error {
 	}
 
 	var errorMessage string
+	// 修改： 精简镜像相关错误带有错误码
+	var errorCode string
 	if (cli.version == "" || versions.GreaterThan(cli.version, "1.23")) && ct == "application/json" {
 		var errorResponse types.ErrorResponse
 		if err := json.Unmarshal(body, &errorResponse); err != nil {
 			return fmt.Errorf("Error reading JSON: %v", err)
 		}
 		errorMessage = errorResponse.Message
+		errorCode = errorResponse.Code
 	} else {
 		errorMessage = string(body)
 	}
 
+	if errorCode != "" {
+		return errorFromStatusCode(errorWithCode{message: strings.TrimSpace(errorMessage), code: errorCode}, serverResp.statusCode)
+	}
+	// 修改
 	return fmt.Errorf("Error response from daemon: %s", strings.TrimSpace(errorMessage))
 }
 
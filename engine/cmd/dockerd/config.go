@@ -12,6 +12,21 @@ import (
 const (
 	// defaultShutdownTimeout is the default shutdown timeout for the daemon
 	defaultShutdownTimeout = 15
+	// 修改： 按需拉取精简镜像缺失文件的默认超时时间和range请求的合并
+	// defaultSimplifyFetchTimeout is the default timeout, in seconds, of the
+	// fetches of files missing from simplified containers
+	defaultSimplifyFetchTimeout = 30
+	// defaultSimplifyFetchDrainTimeout is the default time, in seconds, the
+	// fetches running when the daemon shuts down are waited for
+	defaultSimplifyFetchDrainTimeout = 10
+	// defaultSimplifyFetchMaxGap and defaultSimplifyFetchMaxBatch bound the
+	// range requests the files fetched on demand are read with together
+	defaultSimplifyFetchMaxGap   = 64 * 1024
+	defaultSimplifyFetchMaxBatch = 4 * 1024 * 1024
+	// defaultSimplifyMaxConcurrentFetches is the default number of files
+	// fetched on demand at once
+	defaultSimplifyMaxConcurrentFetches = 16
+	// 修改
 	// defaultTrustKeyFile is the default filename for the trust key
 	defaultTrustKeyFile = "key.json"
 )
@@ -59,6 +74,27 @@ func installCommonConfigFlags(conf *config.Config, flags *pflag.FlagSet) {
 	flags.IntVar(&maxConcurrentDownloads, "max-concurrent-downloads", config.DefaultMaxConcurrentDownloads, "Set the max concurrent downloads for each pull")
 	flags.IntVar(&maxConcurrentUploads, "max-concurrent-uploads", config.DefaultMaxConcurrentUploads, "Set the max concurrent uploads for each push")
 	flags.IntVar(&conf.ShutdownTimeout, "shutdown-timeout", defaultShutdownTimeout, "Set the default shutdown timeout")
+	// 修改： 添加精简镜像默认行为、缓存和后台预取的参数
+	flags.BoolVar(&conf.SimplifyImageDefault, "simplify-image-default", false, "Simplify pulled images unless the pull requests otherwise")
+	flags.Var(opts.NewNamedListOptsRef("simplify-registries", &conf.SimplifyRegistries, config.ValidateSimplifyRegistry), "simplify-registry", "Only simplify images pulled from this registry")
+	flags.StringVar(&conf.SimplifyCacheDir, "simplify-cache-dir", "", "Directory of the files fetched on demand for simplified images")
+	flags.BoolVar(&conf.SimplifyCacheShared, "simplify-cache-shared", false, "Share the simplify cache directory with other daemons through a shared file system")
+	flags.Var(&conf.SimplifyMaxCacheSize, "simplify-max-cache-size", "Maximum size of the files fetched on demand for simplified images")
+	flags.BoolVar(&conf.SimplifyPrefetch, "simplify-prefetch", false, "Download the rest of simplified images in the background after start")
+	flags.Int64Var(&conf.SimplifyPrefetchRate, "simplify-prefetch-rate", 0, "Limit the background prefetch of simplified images, in bytes per second")
+	flags.IntVar(&conf.SimplifyFetchTimeout, "simplify-fetch-timeout", defaultSimplifyFetchTimeout, "Set the timeout, in seconds, of fetching files missing from simplified containers")
+	flags.IntVar(&conf.SimplifyFetchDrainTimeout, "simplify-fetch-drain-timeout", defaultSimplifyFetchDrainTimeout, "Set the time, in seconds, fetches of files missing from simplified containers are waited for on shutdown")
+	flags.Int64Var(&conf.SimplifyFetchMaxGap, "simplify-fetch-max-gap", defaultSimplifyFetchMaxGap, "Largest gap, in bytes, between files fetched on demand read in a single range request")
+	flags.IntVar(&conf.SimplifyMaxConcurrentFetches, "simplify-max-concurrent-fetches", defaultSimplifyMaxConcurrentFetches, "Set the max concurrent fetches of files missing from simplified containers, 0 for unlimited")
+	flags.Int64Var(&conf.SimplifyFetchMaxBatch, "simplify-fetch-max-batch", defaultSimplifyFetchMaxBatch, "Largest number of bytes read in a single range request for files fetched on demand, 0 to disable batching")
+	flags.BoolVar(&conf.SimplifyPlaceholders, "simplify-placeholders", false, "Leave metadata-only placeholders of the files pruned from images the daemon simplifies")
+	flags.Var(&conf.SimplifyMaxProfileSize, "simplify-max-profile-size", "Maximum size of the simplify profiles pushed along with images, loaded or given to the daemon")
+	flags.BoolVar(&conf.SimplifyOffline, "simplify-offline", false, "Start simplified containers without fetching missing files unless the start requests otherwise")
+	flags.Var(opts.NewNamedListOptsRef("simplify-peers", &conf.SimplifyPeers, config.ValidateSimplifyPeer), "simplify-peer", "Fetch files missing from simplified containers from the cache of this daemon first")
+	flags.StringVar(&conf.SimplifyPeerListen, "simplify-peer-listen", "", "Serve the cache of files fetched for simplified containers to peers on this address")
+	flags.StringVar(&conf.SimplifyPeerToken, "simplify-peer-token", "", "Token authenticating simplify peers")
+	flags.Var(opts.NewNamedMapOpts("simplify-image-policy", conf.SimplifyImagePolicy, config.ValidateSimplifyImagePolicy), "simplify-image-policy", "Simplify, on or off, the containers started without a mode from the images matching a pattern")
+	// 修改
 	flags.IntVar(&conf.NetworkDiagnosticPort, "network-diagnostic-port", 0, "TCP port number of the network diagnostic server")
 	flags.MarkHidden("network-diagnostic-port")
 
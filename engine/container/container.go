@@ -75,7 +75,20 @@ type Container struct {
 	Driver          string
 	OS              string
 	// MountLabel contains the options for the 'mount' command
-	MountLabel             string
+	MountLabel string
+	// 修改： 记录容器是否以精简模式挂载rootfs，重启时复用
+	// SimplifyImage records whether the rootfs is mounted in simplified mode
+	SimplifyImage bool
+	// SimplifyFetch records whether files missing from the rootfs are
+	// fetched on demand while the container runs
+	SimplifyFetch bool
+	// SimplifyFetchTimeout overrides the daemon's timeout for fetching
+	// missing files if not 0
+	SimplifyFetchTimeout time.Duration
+	// SimplifyMaxConcurrentFetches bounds the missing files fetched at once
+	// for the container within the daemon's limit if not 0
+	SimplifyMaxConcurrentFetches int
+	// 修改
 	ProcessLabel           string
 	RestartCount           int
 	HasBeenStartedBefore   bool
@@ -32,6 +32,11 @@ type State struct {
 	StartedAt         time.Time
 	FinishedAt        time.Time
 	Health            *Health
+	// 修改： 容器运行期间精简rootfs中缺失的文件无法再按需拉取的原因
+	SimplifyDegraded string
+	// 修改： 容器运行期间最近一次按需拉取失败的错误
+	SimplifyFetchError string
+	// 修改
 
 	waitStop   chan struct{}
 	waitRemove chan struct{}
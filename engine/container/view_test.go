@@ -184,3 +184,15 @@ func TestViewWithHealthCheck(t *testing.T) {
 		t.Fatalf("expected Health=starting. Got: %+v", s)
 	}
 }
+
+func TestViewSimplifyImagePersisted(t *testing.T) {
+	db, err := NewViewDB()
+	assert.NilError(t, err)
+	c := newContainer(t)
+	c.SimplifyImage = true
+	assert.NilError(t, c.CheckpointTo(db))
+
+	restored := NewBaseContainer(c.ID, c.Root)
+	assert.NilError(t, restored.FromDisk())
+	assert.Check(t, restored.SimplifyImage)
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/container"
+	"github.com/docker/docker/daemon/simplify"
 	"github.com/docker/docker/errdefs"
 	"github.com/docker/docker/pkg/archive"
 	"github.com/docker/docker/pkg/chrootarchive"
@@ -90,6 +91,12 @@ func (daemon *Daemon) ContainerStatPath(name string, path string) (stat *types.C
 	if os.IsNotExist(err) {
 		return nil, containerFileNotFound{path, name}
 	}
+	// 修改： 被裁剪且无法拉取的路径
+	if e, ok := err.(simplifyPrunedError); ok {
+		e.file, e.container = path, name
+		return nil, e
+	}
+	// 修改
 	return nil, errdefs.System(err)
 }
 
@@ -115,6 +122,12 @@ func (daemon *Daemon) ContainerArchivePath(name string, path string) (content io
 	if os.IsNotExist(err) {
 		return nil, nil, containerFileNotFound{path, name}
 	}
+	// 修改： 被裁剪且无法拉取的路径
+	if e, ok := err.(simplifyPrunedError); ok {
+		e.file, e.container = path, name
+		return nil, nil, e
+	}
+	// 修改
 	return nil, nil, errdefs.System(err)
 }
 
@@ -143,6 +156,12 @@ func (daemon *Daemon) ContainerExtractToDir(name, path string, copyUIDGID, noOve
 	if os.IsNotExist(err) {
 		return containerFileNotFound{path, name}
 	}
+	// 修改： 被裁剪且无法拉取的路径
+	if e, ok := err.(simplifyPrunedError); ok {
+		e.file, e.container = path, name
+		return e
+	}
+	// 修改
 	return errdefs.System(err)
 }
 
@@ -171,7 +190,13 @@ func (daemon *Daemon) containerStatPath(container *container.Container, path str
 		return nil, err
 	}
 
-	return container.StatPath(resolvedPath, absPath)
+	// 修改： 精简镜像中被裁剪的路径从缓存中读取
+	stat, sp, err := daemon.statSimplifiedPath(container, resolvedPath, absPath, false)
+	if sp != nil {
+		sp.Release()
+	}
+	return stat, err
+	// 修改
 }
 
 // containerArchivePath creates an archive of the filesystem resource at the specified
@@ -214,10 +239,19 @@ func (daemon *Daemon) containerArchivePath(container *container.Container, path
 		return nil, nil, err
 	}
 
-	stat, err = container.StatPath(resolvedPath, absPath)
+	// 修改： 精简镜像中被裁剪的文件从缓存补全
+	stat, sp, err := daemon.statSimplifiedPath(container, resolvedPath, absPath, true)
 	if err != nil {
 		return nil, nil, err
 	}
+	if sp != nil {
+		defer func() {
+			if err != nil {
+				sp.Release()
+			}
+		}()
+	}
+	// 修改
 
 	// We need to rebase the archive entries if the last element of the
 	// resolved path was a symlink that was evaluated and is now different
@@ -238,13 +272,26 @@ func (daemon *Daemon) containerArchivePath(container *container.Container, path
 	sourceDir, sourceBase := driver.Dir(resolvedPath), driver.Base(resolvedPath)
 	opts := archive.TarResourceRebaseOpts(sourceBase, driver.Base(absPath))
 
-	data, err := archivePath(driver, sourceDir, opts)
-	if err != nil {
-		return nil, nil, err
+	// 修改： 路径本身被裁剪时只有缓存中的文件
+	var data io.ReadCloser
+	if sp == nil || !sp.Absent() {
+		if data, err = archivePath(driver, sourceDir, opts); err != nil {
+			return nil, nil, err
+		}
+	}
+	if sp != nil {
+		// 与data一样保留宿主机上的ID
+		data = simplify.CopyCache(data, sp.Dir, sp.Path, driver.Base(absPath), sp.Missing, nil)
 	}
+	// 修改
 
 	content = ioutils.NewReadCloserWrapper(data, func() error {
 		err := data.Close()
+		// 修改： 读完后缓存可以回收
+		if sp != nil {
+			sp.Release()
+		}
+		// 修改
 		container.DetachAndUnmount(daemon.LogVolumeEvent)
 		daemon.Unmount(container)
 		container.Unlock()
@@ -305,7 +352,15 @@ func (daemon *Daemon) containerExtractToDir(container *container.Container, path
 		return err
 	}
 
+	// 修改： 目标目录被裁剪时先从缓存创建
 	stat, err := driver.Lstat(resolvedPath)
+	if os.IsNotExist(err) {
+		if err := daemon.extractPrunedDirs(container, resolvedPath, absPath); err != nil {
+			return err
+		}
+		stat, err = driver.Lstat(resolvedPath)
+	}
+	// 修改
 	if err != nil {
 		return err
 	}
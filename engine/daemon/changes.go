@@ -29,6 +29,9 @@ func (daemon *Daemon) ContainerChanges(name string) ([]archive.Change, error) {
 	if err != nil {
 		return nil, err
 	}
+	// 修改： 精简镜像容器中按需获取的文件不算作新增
+	c = daemon.imageService.SimplifyChanges(container.ImageID, container.OS, container.RWLayer, container.MountLabel, c)
+	// 修改
 	containerActions.WithValues("changes").UpdateSince(start)
 	return c, nil
 }
@@ -17,9 +17,12 @@ func containerSpecFromGRPC(c *swarmapi.ContainerSpec) *types.ContainerSpec {
 	if c == nil {
 		return nil
 	}
+	// 修改： 从标签中取出精简模式选项
+	labels, simplify := simplifyFromGRPC(c.Labels)
+	// 修改
 	containerSpec := &types.ContainerSpec{
 		Image:      c.Image,
-		Labels:     c.Labels,
+		Labels:     labels,
 		Command:    c.Command,
 		Args:       c.Args,
 		Hostname:   c.Hostname,
@@ -36,6 +39,7 @@ func containerSpecFromGRPC(c *swarmapi.ContainerSpec) *types.ContainerSpec {
 		Configs:    configReferencesFromGRPC(c.Configs),
 		Isolation:  IsolationFromGRPC(c.Isolation),
 		Init:       initFromGRPC(c.Init),
+		Simplify:   simplify,
 	}
 
 	if c.DNSConfig != nil {
@@ -231,10 +235,58 @@ func configReferencesFromGRPC(sr []*swarmapi.ConfigReference) []*types.ConfigRef
 	return refs
 }
 
+// 修改： swarmkit的ContainerSpec没有精简模式的字段，以保留标签传递
+
+// LabelSimplifyImage is the container label of the swarmkit spec carrying
+// ContainerSpec.Simplify, for which it has no field. The executor strips it
+// from the labels of the containers it creates.
+const LabelSimplifyImage = "com.docker.simplify.image"
+
+// simplifyToGRPC returns labels, with LabelSimplifyImage set if simplify is,
+// and removed otherwise.
+func simplifyToGRPC(labels map[string]string, simplify bool) map[string]string {
+	if _, ok := labels[LabelSimplifyImage]; !ok && !simplify {
+		return labels
+	}
+	l := make(map[string]string, len(labels)+1)
+	for k, v := range labels {
+		l[k] = v
+	}
+	delete(l, LabelSimplifyImage)
+	if simplify {
+		l[LabelSimplifyImage] = "true"
+	}
+	if len(l) == 0 {
+		return nil
+	}
+	return l
+}
+
+// simplifyFromGRPC returns labels without LabelSimplifyImage, and whether it
+// was set.
+func simplifyFromGRPC(labels map[string]string) (map[string]string, bool) {
+	if _, ok := labels[LabelSimplifyImage]; !ok {
+		return labels, false
+	}
+	var l map[string]string
+	for k, v := range labels {
+		if k == LabelSimplifyImage {
+			continue
+		}
+		if l == nil {
+			l = make(map[string]string, len(labels)-1)
+		}
+		l[k] = v
+	}
+	return l, labels[LabelSimplifyImage] == "true"
+}
+
+// 修改
+
 func containerToGRPC(c *types.ContainerSpec) (*swarmapi.ContainerSpec, error) {
 	containerSpec := &swarmapi.ContainerSpec{
 		Image:      c.Image,
-		Labels:     c.Labels,
+		Labels:     simplifyToGRPC(c.Labels, c.Simplify),
 		Command:    c.Command,
 		Args:       c.Args,
 		Hostname:   c.Hostname,
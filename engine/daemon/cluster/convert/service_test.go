@@ -306,3 +306,43 @@ func TestTaskConvertFromGRPCNetworkAttachment(t *testing.T) {
 		t.Fatalf("expected Runtime to be %v", swarmtypes.RuntimeNetworkAttachment)
 	}
 }
+
+func TestServiceConvertSimplify(t *testing.T) {
+	labels := map[string]string{"app": "web"}
+	s := swarmtypes.ServiceSpec{
+		TaskTemplate: swarmtypes.TaskSpec{
+			ContainerSpec: &swarmtypes.ContainerSpec{
+				Image:    "alpine:latest",
+				Labels:   labels,
+				Simplify: true,
+			},
+		},
+		Mode: swarmtypes.ServiceMode{
+			Global: &swarmtypes.GlobalService{},
+		},
+	}
+	res, err := ServiceSpecToGRPC(s)
+	assert.NilError(t, err)
+	v, ok := res.Task.Runtime.(*swarmapi.TaskSpec_Container)
+	if !ok {
+		t.Fatal("expected type swarmapi.TaskSpec_Container")
+	}
+	assert.DeepEqual(t, map[string]string{"app": "web", LabelSimplifyImage: "true"}, v.Container.Labels)
+	// the labels of the spec are left untouched
+	assert.DeepEqual(t, map[string]string{"app": "web"}, labels)
+
+	svc, err := ServiceFromGRPC(swarmapi.Service{Spec: res})
+	assert.NilError(t, err)
+	assert.Check(t, svc.Spec.TaskTemplate.ContainerSpec.Simplify)
+	assert.DeepEqual(t, labels, svc.Spec.TaskTemplate.ContainerSpec.Labels)
+
+	// the label cannot be set by hand
+	s.TaskTemplate.ContainerSpec.Simplify = false
+	s.TaskTemplate.ContainerSpec.Labels = map[string]string{LabelSimplifyImage: "true"}
+	res, err = ServiceSpecToGRPC(s)
+	assert.NilError(t, err)
+	svc, err = ServiceFromGRPC(swarmapi.Service{Spec: res})
+	assert.NilError(t, err)
+	assert.Check(t, !svc.Spec.TaskTemplate.ContainerSpec.Simplify)
+	assert.Check(t, svc.Spec.TaskTemplate.ContainerSpec.Labels == nil)
+}
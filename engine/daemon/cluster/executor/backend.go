@@ -34,8 +34,8 @@ type Backend interface {
 	SetupIngress(clustertypes.NetworkCreateRequest, string) (<-chan struct{}, error)
 	ReleaseIngress() (<-chan struct{}, error)
 	CreateManagedContainer(config types.ContainerCreateConfig) (container.ContainerCreateCreatedBody, error)
-	// 修改： 添加simpString参数
-	ContainerStart(name string, hostConfig *container.HostConfig, checkpoint string, checkpointDir string, simpString string) error
+	// 修改： 添加simpCfg参数
+	ContainerStart(name string, hostConfig *container.HostConfig, checkpoint string, checkpointDir string, simpCfg backend.ContainerStartSimplifyConfig) error
 	// 修改
 	ContainerStop(name string, seconds *int) error
 	ContainerLogs(context.Context, string, *types.ContainerLogsOptions) (msgs <-chan *backend.LogMessage, tty bool, err error)
@@ -72,7 +72,9 @@ type VolumeBackend interface {
 
 // ImageBackend is used by an executor to perform image operations
 type ImageBackend interface {
-	PullImage(ctx context.Context, image, tag string, platform *specs.Platform, metaHeaders map[string][]string, authConfig *types.AuthConfig, outStream io.Writer) error
+	// 修改： 添加simpCfg参数
+	PullImage(ctx context.Context, image, tag string, platform *specs.Platform, metaHeaders map[string][]string, authConfig *types.AuthConfig, outStream io.Writer, simpCfg backend.ImagePullSimplifyConfig) error
+	// 修改
 	GetRepository(context.Context, reference.Named, *types.AuthConfig) (distribution.Repository, bool, error)
 	LookupImage(name string) (*types.ImageInspect, error)
 }
@@ -71,10 +71,12 @@ func (c *containerAdapter) pullImage(ctx context.Context) error {
 	named, err := reference.ParseNormalizedNamed(spec.Image)
 	if err == nil {
 		if _, ok := named.(reference.Canonical); ok {
-			_, err := c.imageBackend.LookupImage(spec.Image)
-			if err == nil {
+			// 修改： 要求精简模式时，本地只有完整镜像也要重新拉取
+			img, err := c.imageBackend.LookupImage(spec.Image)
+			if err == nil && (!c.container.simplify() || img.Simplified.Enabled) {
 				return nil
 			}
+			// 修改
 		}
 	}
 
@@ -96,7 +98,9 @@ func (c *containerAdapter) pullImage(ctx context.Context) error {
 	go func() {
 		// TODO @jhowardmsft LCOW Support: This will need revisiting as
 		// the stack is built up to include LCOW support for swarm.
-		err := c.imageBackend.PullImage(ctx, c.container.image(), "", nil, metaHeaders, authConfig, pw)
+		// 修改： 添加simpCfg参数
+		err := c.imageBackend.PullImage(ctx, c.container.image(), "", nil, metaHeaders, authConfig, pw, backend.ImagePullSimplifyConfig{SimplifyImage: c.container.simplify()})
+		// 修改
 		pw.CloseWithError(err)
 	}()
 
@@ -295,8 +299,13 @@ func (c *containerAdapter) start(ctx context.Context) error {
 		return err
 	}
 
-	// 修改： 添加simpString = ""参数
-	return c.backend.ContainerStart(c.container.name(), nil, "", "", "")
+	// 修改： 添加simpCfg参数
+	var simpCfg backend.ContainerStartSimplifyConfig
+	if c.container.simplify() {
+		simplify := true
+		simpCfg.SimplifyImage = &simplify
+	}
+	return c.backend.ContainerStart(c.container.name(), nil, "", "", simpCfg)
 	// 修改
 }
 
@@ -37,6 +37,13 @@ const (
 
 	// systemLabelPrefix represents the reserved namespace for system labels.
 	systemLabelPrefix = "com.docker.swarm"
+
+	// 修改： 节点能否运行精简镜像的容器
+	// engineLabelSimplify is the engine label of the node description set
+	// to "true" if the node can start containers on simplified images, which
+	// services can be constrained to.
+	engineLabelSimplify = "com.docker.simplify.enabled"
+	// 修改
 )
 
 // containerConfig converts task properties into docker container compatible
@@ -44,6 +51,9 @@ const (
 type containerConfig struct {
 	task                *api.Task
 	networksAttachments map[string]*api.NetworkAttachment
+	// 修改： 节点不能运行精简镜像时以完整镜像启动
+	simplifySupported bool
+	// 修改
 }
 
 // newContainerConfig returns a validated container config. No methods should
@@ -76,6 +86,9 @@ func (c *containerConfig) setTask(t *api.Task, node *api.NodeDescription) error
 	}
 
 	c.task = t
+	// 修改： 节点不能运行精简镜像时以完整镜像启动
+	c.simplifySupported = node != nil && node.Engine != nil && node.Engine.Labels[engineLabelSimplify] == "true"
+	// 修改
 
 	if t.Spec.GetContainer() != nil {
 		preparedSpec, err := template.ExpandContainerSpec(node, t)
@@ -172,6 +185,17 @@ func (c *containerConfig) isolation() enginecontainer.Isolation {
 	return convert.IsolationFromGRPC(c.spec().Isolation)
 }
 
+// 修改： 添加服务容器以精简模式启动的选项
+
+// simplify returns whether the container is pulled and started on a
+// simplified image: if the service asks for it, and the node can run
+// containers on simplified images. Otherwise it runs on the full image.
+func (c *containerConfig) simplify() bool {
+	return c.simplifySupported && c.spec().Labels[convert.LabelSimplifyImage] == "true"
+}
+
+// 修改
+
 func (c *containerConfig) init() *bool {
 	if c.spec().Init == nil {
 		return nil
@@ -248,6 +272,9 @@ func (c *containerConfig) labels() map[string]string {
 	for k, v := range c.spec().Labels {
 		labels[k] = v
 	}
+	// 修改： 精简模式选项不是容器的标签
+	delete(labels, convert.LabelSimplifyImage)
+	// 修改
 
 	// we then apply the overrides from the task, which may be set via the
 	// orchestrator.
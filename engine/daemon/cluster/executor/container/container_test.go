@@ -4,8 +4,10 @@ import (
 	"testing"
 
 	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/daemon/cluster/convert"
 	swarmapi "github.com/docker/swarmkit/api"
 	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
 )
 
 func TestIsolationConversion(t *testing.T) {
@@ -35,3 +37,48 @@ func TestIsolationConversion(t *testing.T) {
 		})
 	}
 }
+
+func TestSimplifyConversion(t *testing.T) {
+	cases := []struct {
+		name      string
+		simplify  bool
+		supported bool
+		expected  bool
+	}{
+		{name: "full", supported: true},
+		{name: "simplified", simplify: true, supported: true, expected: true},
+		// nodes unable to run simplified images run the full image
+		{name: "unsupported", simplify: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			labels := map[string]string{"app": "web"}
+			if c.simplify {
+				labels[convert.LabelSimplifyImage] = "true"
+			}
+			task := &swarmapi.Task{
+				Spec: swarmapi.TaskSpec{
+					Runtime: &swarmapi.TaskSpec_Container{
+						Container: &swarmapi.ContainerSpec{
+							Image:  "alpine:latest",
+							Labels: labels,
+						},
+					},
+				},
+			}
+			node := &swarmapi.NodeDescription{
+				Platform: &swarmapi.Platform{},
+				Engine:   &swarmapi.EngineDescription{Labels: map[string]string{}},
+			}
+			if c.supported {
+				node.Engine.Labels[engineLabelSimplify] = "true"
+			}
+			config, err := newContainerConfig(task, node)
+			assert.NilError(t, err)
+			assert.Equal(t, c.expected, config.simplify())
+			_, ok := config.labels()[convert.LabelSimplifyImage]
+			assert.Check(t, !ok)
+			assert.Check(t, is.Equal(config.labels()["app"], "web"))
+		})
+	}
+}
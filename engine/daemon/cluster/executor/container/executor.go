@@ -113,6 +113,11 @@ func (e *executor) Describe(ctx context.Context) (*api.NodeDescription, error) {
 			labels[stringSlice[0]] = stringSlice[1]
 		}
 	}
+	// 修改： 报告节点能否运行精简镜像的容器
+	if info.Simplify != nil && info.Simplify.Enabled {
+		labels[engineLabelSimplify] = "true"
+	}
+	// 修改
 
 	description := &api.NodeDescription{
 		Hostname: info.Name,
@@ -9,6 +9,7 @@ import (
 	"github.com/docker/docker/api/types/backend"
 	containertypes "github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/builder/dockerfile"
+	"github.com/docker/docker/container"
 	"github.com/docker/docker/errdefs"
 	"github.com/pkg/errors"
 )
@@ -114,57 +115,90 @@ func merge(userConf, imageConf *containertypes.Config) error {
 	return nil
 }
 
-// CreateImageFromContainer creates a new image from a container. The container
-// config will be updated by applying the change set to the custom config, then
-// applying that config over the existing container config.
-func (daemon *Daemon) CreateImageFromContainer(name string, c *backend.CreateImageConfig) (string, error) {
-	start := time.Now()
+// 修改： 提取提交前的容器检查，供精简提交的试运行复用
 
-	// 根据名字获取容器
+// getCommittableContainer returns the container name if it can be committed.
+func (daemon *Daemon) getCommittableContainer(name string) (*container.Container, error) {
 	container, err := daemon.GetContainer(name)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	// It is not possible to commit a running container on Windows
 	if (runtime.GOOS == "windows") && container.IsRunning() {
-		return "", errors.Errorf("%+v does not support commit of a running container", runtime.GOOS)
+		return nil, errors.Errorf("%+v does not support commit of a running container", runtime.GOOS)
 	}
 
 	if container.IsDead() {
 		err := fmt.Errorf("You cannot commit container %s which is Dead", container.ID)
-		return "", errdefs.Conflict(err)
+		return nil, errdefs.Conflict(err)
 	}
 
 	if container.IsRemovalInProgress() {
 		err := fmt.Errorf("You cannot commit container %s which is being removed", container.ID)
-		return "", errdefs.Conflict(err)
+		return nil, errdefs.Conflict(err)
+	}
+	return container, nil
+}
+
+// newImageConfig returns the config of the image committed from container
+// with c, applying the change set to the custom config and that config over
+// the container config.
+func newImageConfig(container *container.Container, c *backend.CreateImageConfig) (*containertypes.Config, error) {
+	if c.Config == nil {
+		c.Config = container.Config
+	}
+	newConfig, err := dockerfile.BuildFromConfig(c.Config, c.Changes, container.OS)
+	if err != nil {
+		return nil, err
+	}
+	if err := merge(newConfig, container.Config); err != nil {
+		return nil, err
+	}
+	return newConfig, nil
+}
+
+// 修改
+
+// CreateImageFromContainer creates a new image from a container. The container
+// config will be updated by applying the change set to the custom config, then
+// applying that config over the existing container config.
+func (daemon *Daemon) CreateImageFromContainer(name string, c *backend.CreateImageConfig) (string, error) {
+	start := time.Now()
+
+	// 根据名字获取容器
+	container, err := daemon.getCommittableContainer(name)
+	if err != nil {
+		return "", err
+	}
+
+	// 修改： 在暂停容器前检查精简提交的文件模式和阈值
+	if err := validateSimplifyConfig(c); err != nil {
+		return "", err
 	}
+	// 修改
 
 	if c.Pause && !container.IsPaused() {
 		daemon.containerPause(container)
 		defer daemon.containerUnpause(container)
 	}
 
-	if c.Config == nil {
-		c.Config = container.Config
-	}
-
 	// 修改： 添加对c.Simp的判断
-	simp := false
-	if c.Simp != "" {
-		simp = true
+	simp := c.Simp
+	// 修改
+
+	// 修改： 以克隆方式挂载精简镜像的驱动不复制读取的文件，精简提交时保留记录的文件
+	var simplifyOpened []string
+	if simp {
+		simplifyOpened = daemon.simplifyOpenedForCommit(container)
 	}
 	// 修改
 
 	// 构建新镜像的config
-	newConfig, err := dockerfile.BuildFromConfig(c.Config, c.Changes, container.OS)
+	newConfig, err := newImageConfig(container, c)
 	if err != nil {
 		return "", err
 	}
-	if err := merge(newConfig, container.Config); err != nil {
-		return "", err
-	}
 
 	id, err := daemon.imageService.CommitImage(backend.CommitConfig{
 		Author:              c.Author,
@@ -176,6 +210,12 @@ func (daemon *Daemon) CreateImageFromContainer(name string, c *backend.CreateIma
 		ContainerOS:         container.OS,
 		ParentImageID:       string(container.ImageID),
 		// 修改： 添加simp参数
+		SimplifyKeep:      c.SimplifyKeep,
+		SimplifyPrune:     c.SimplifyPrune,
+		SimplifyThreshold: c.SimplifyThreshold,
+		SimplifyProfile:   c.SimplifyProfile,
+		SimplifyForce:     c.SimplifyForce,
+		SimplifyOpened:    simplifyOpened,
 	}, simp)
 	// 修改
 
@@ -198,6 +238,11 @@ func (daemon *Daemon) CreateImageFromContainer(name string, c *backend.CreateIma
 		"imageID":  id.String(),
 		"imageRef": imageRef,
 	})
+	// 修改： 精简提交的镜像记录simplify事件
+	if simp {
+		daemon.imageService.LogImageEventWithAttributes(id.String(), imageRef, "simplify", map[string]string{"parent": container.ImageID.String()})
+	}
+	// 修改
 
 	containerActions.WithValues("commit").UpdateSince(start)
 	return id.String(), nil
@@ -7,12 +7,16 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net/url"
 	"os"
+	"path/filepath"
 	"reflect"
 	"runtime"
+	"strconv"
 	"strings"
 	"sync"
 
+	"github.com/docker/distribution/reference"
 	daemondiscovery "github.com/docker/docker/daemon/discovery"
 	"github.com/docker/docker/opts"
 	"github.com/docker/docker/pkg/authorization"
@@ -54,6 +58,9 @@ var flatOptions = map[string]bool{
 	"log-opts":           true,
 	"runtimes":           true,
 	"default-ulimits":    true,
+	// 修改： 精简镜像的启动策略是映射
+	"simplify-image-policy": true,
+	// 修改
 }
 
 // LogConfig represents the default log configuration.
@@ -149,6 +156,90 @@ type CommonConfig struct {
 	// to stop when daemon is being shutdown
 	ShutdownTimeout int `json:"shutdown-timeout,omitempty"`
 
+	// 修改： 精简镜像的默认行为、缓存和后台预取配置
+	// SimplifyImageDefault simplifies the images pulled without an explicit
+	// simplify-image option.
+	SimplifyImageDefault bool `json:"simplify-image-default,omitempty"`
+
+	// SimplifyRegistries restricts simplification to the images pulled from
+	// these registries. Empty means every registry.
+	SimplifyRegistries []string `json:"simplify-registries,omitempty"`
+
+	// SimplifyCacheDir holds the files fetched on demand for simplified
+	// images. Empty means "simplify/fetch" under the daemon root.
+	SimplifyCacheDir string `json:"simplify-cache-dir,omitempty"`
+
+	// SimplifyCacheShared is set if SimplifyCacheDir is on a file system
+	// other daemons use it on at once, such as NFS.
+	SimplifyCacheShared bool `json:"simplify-cache-shared,omitempty"`
+
+	// SimplifyMaxCacheSize caps the size of the files fetched on demand for
+	// simplified images. 0 means unlimited.
+	SimplifyMaxCacheSize opts.MemBytes `json:"simplify-max-cache-size,omitempty"`
+
+	// SimplifyPrefetch enables downloading the rest of a simplified image in
+	// the background once a container from it has started.
+	SimplifyPrefetch bool `json:"simplify-prefetch,omitempty"`
+
+	// SimplifyPrefetchRate limits the background prefetch of simplified
+	// images, in bytes per second. 0 means unlimited.
+	SimplifyPrefetchRate int64 `json:"simplify-prefetch-rate,omitempty"`
+
+	// SimplifyFetchTimeout is how long, in seconds, a file missing from a
+	// simplified container is retried for before its open fails.
+	SimplifyFetchTimeout int `json:"simplify-fetch-timeout,omitempty"`
+
+	// SimplifyFetchDrainTimeout is how long, in seconds, the fetches running
+	// when the daemon shuts down are waited for before being cancelled.
+	SimplifyFetchDrainTimeout int `json:"simplify-fetch-drain-timeout,omitempty"`
+
+	// SimplifyFetchMaxGap is the largest gap, in bytes, between the files
+	// fetched on demand from a layer blob that are read in a single range
+	// request.
+	SimplifyFetchMaxGap int64 `json:"simplify-fetch-max-gap,omitempty"`
+
+	// SimplifyFetchMaxBatch is the largest number of bytes of a layer blob
+	// read in a single range request for files fetched on demand. 0 means
+	// every file is read with a request of its own.
+	SimplifyFetchMaxBatch int64 `json:"simplify-fetch-max-batch,omitempty"`
+
+	// SimplifyMaxConcurrentFetches is the number of files fetched on demand
+	// at once for simplified containers. The lookups of the others wait.
+	// 0 means unlimited.
+	SimplifyMaxConcurrentFetches int `json:"simplify-max-concurrent-fetches,omitempty"`
+
+	// SimplifyPlaceholders leaves the regular files pruned from the images
+	// the daemon simplifies as placeholders holding only their metadata,
+	// fetched when opened.
+	SimplifyPlaceholders bool `json:"simplify-placeholders,omitempty"`
+
+	// SimplifyMaxProfileSize caps the size of the profiles pushed along with
+	// images, loaded with them or given to the daemon. 0 means the default of
+	// 8 MiB.
+	SimplifyMaxProfileSize opts.MemBytes `json:"simplify-max-profile-size,omitempty"`
+
+	// SimplifyOffline starts containers without fetching the files missing
+	// from simplified images, unless the start requests otherwise.
+	SimplifyOffline bool `json:"simplify-offline,omitempty"`
+
+	// SimplifyPeers are the URLs of the daemons whose caches the files
+	// missing from simplified images are fetched from before the registry.
+	SimplifyPeers []string `json:"simplify-peers,omitempty"`
+
+	// SimplifyPeerListen is the address the cache is served to peers on.
+	// Empty means it is not served.
+	SimplifyPeerListen string `json:"simplify-peer-listen,omitempty"`
+
+	// SimplifyPeerToken authenticates the daemon to its peers, and its peers
+	// to it.
+	SimplifyPeerToken string `json:"simplify-peer-token,omitempty"`
+
+	// SimplifyImagePolicy maps image reference patterns to "on" or "off",
+	// the simplified mode of the containers started from the images they
+	// match without requesting a mode, such as the containers of kubelet.
+	SimplifyImagePolicy map[string]string `json:"simplify-image-policy,omitempty"`
+	// 修改
+
 	Debug     bool     `json:"debug,omitempty"`
 	Hosts     []string `json:"hosts,omitempty"`
 	LogLevel  string   `json:"log-level,omitempty"`
@@ -215,6 +306,9 @@ func New() *Config {
 	config := Config{}
 	config.LogConfig.Config = make(map[string]string)
 	config.ClusterOpts = make(map[string]string)
+	// 修改： 初始化精简镜像的启动策略
+	config.SimplifyImagePolicy = make(map[string]string)
+	// 修改
 
 	if runtime.GOOS != "linux" {
 		config.V2Only = true
@@ -529,6 +623,57 @@ func Validate(config *Config) error {
 		return fmt.Errorf("invalid max concurrent uploads: %d", *config.MaxConcurrentUploads)
 	}
 
+	// 修改： validate the simplify settings
+	if config.SimplifyPrefetchRate < 0 {
+		return fmt.Errorf("invalid simplify prefetch rate: %d", config.SimplifyPrefetchRate)
+	}
+	if config.SimplifyFetchTimeout < 0 {
+		return fmt.Errorf("invalid simplify fetch timeout: %d", config.SimplifyFetchTimeout)
+	}
+	if config.SimplifyFetchDrainTimeout < 0 {
+		return fmt.Errorf("invalid simplify fetch drain timeout: %d", config.SimplifyFetchDrainTimeout)
+	}
+	if config.SimplifyFetchMaxGap < 0 {
+		return fmt.Errorf("invalid simplify fetch max gap: %d", config.SimplifyFetchMaxGap)
+	}
+	if config.SimplifyFetchMaxBatch < 0 {
+		return fmt.Errorf("invalid simplify fetch max batch: %d", config.SimplifyFetchMaxBatch)
+	}
+	if config.SimplifyMaxConcurrentFetches < 0 {
+		return fmt.Errorf("invalid simplify max concurrent fetches: %d", config.SimplifyMaxConcurrentFetches)
+	}
+	if config.SimplifyMaxCacheSize < 0 {
+		return fmt.Errorf("invalid simplify max cache size: %d", config.SimplifyMaxCacheSize)
+	}
+	if config.SimplifyMaxProfileSize < 0 {
+		return fmt.Errorf("invalid simplify max profile size: %d", config.SimplifyMaxProfileSize)
+	}
+	if config.SimplifyCacheDir != "" && !filepath.IsAbs(config.SimplifyCacheDir) {
+		return fmt.Errorf("simplify cache dir must be an absolute path: %s", config.SimplifyCacheDir)
+	}
+	if config.SimplifyCacheShared && config.SimplifyCacheDir == "" {
+		return fmt.Errorf("simplify-cache-shared requires simplify-cache-dir to be set")
+	}
+	for _, r := range config.SimplifyRegistries {
+		if _, err := ValidateSimplifyRegistry(r); err != nil {
+			return err
+		}
+	}
+	for _, p := range config.SimplifyPeers {
+		if _, err := ValidateSimplifyPeer(p); err != nil {
+			return err
+		}
+	}
+	if (len(config.SimplifyPeers) > 0 || config.SimplifyPeerListen != "") && config.SimplifyPeerToken == "" {
+		return fmt.Errorf("simplify-peer-token is required to fetch from simplify peers or serve them")
+	}
+	for pattern, mode := range config.SimplifyImagePolicy {
+		if _, err := ValidateSimplifyImagePolicy(pattern + "=" + mode); err != nil {
+			return err
+		}
+	}
+	// 修改
+
 	// validate that "default" runtime is not reset
 	if runtimes := config.GetAllRuntimes(); len(runtimes) > 0 {
 		if _, ok := runtimes[StockRuntimeName]; ok {
@@ -565,3 +710,89 @@ func ModifiedDiscoverySettings(config *Config, backendType, advertise string, cl
 
 	return !reflect.DeepEqual(config.ClusterOpts, clusterOpts)
 }
+
+// 修改： 校验simplify-registries中的仓库地址
+
+// ValidateSimplifyRegistry validates a registry simplification is enabled
+// for, a hostname with an optional port, and returns it normalized.
+func ValidateSimplifyRegistry(val string) (string, error) {
+	if val == "" || strings.Contains(val, "://") || strings.Contains(val, "/") {
+		return "", fmt.Errorf("invalid simplify registry %q: must be a hostname with an optional port", val)
+	}
+	return registry.ValidateIndexName(val)
+}
+
+// ValidateSimplifyPeer validates the URL of a daemon files missing from
+// simplified images are fetched from, such as "http://10.0.0.2:7373".
+func ValidateSimplifyPeer(val string) (string, error) {
+	u, err := url.Parse(val)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || (u.Path != "" && u.Path != "/") {
+		return "", fmt.Errorf("invalid simplify peer %q: must be an http or https URL without a path", val)
+	}
+	return strings.TrimSuffix(val, "/"), nil
+}
+
+// ValidateSimplifyImagePolicy validates an entry of the simplify image
+// policy, an image reference pattern and "on" or "off" separated by "=",
+// such as "registry.example.com/team=on".
+func ValidateSimplifyImagePolicy(val string) (string, error) {
+	vals := strings.SplitN(val, "=", 2)
+	if len(vals) != 2 || (vals[1] != "on" && vals[1] != "off") {
+		return "", fmt.Errorf("invalid simplify image policy %q: must be a pattern and on or off separated by =", val)
+	}
+	if _, err := ParseSimplifyImagePattern(vals[0]); err != nil {
+		return "", err
+	}
+	return val, nil
+}
+
+// ParseSimplifyImagePattern parses a pattern of the simplify image policy
+// and returns it normalized. A pattern is a registry, such as
+// "registry.example.com:5000", or a repository or a prefix of repositories
+// with an optional registry, such as "nginx" or "docker.io/myorg". It
+// matches the images of the registry, or of the repository and the
+// repositories under it.
+func ParseSimplifyImagePattern(val string) (string, error) {
+	invalid := fmt.Errorf("invalid simplify image pattern %q: must be a registry or a repository without tag or digest", val)
+	domain, remainder := val, ""
+	if i := strings.IndexRune(val, '/'); i != -1 {
+		domain, remainder = val[:i], val[i:]
+	}
+	if !isSimplifyRegistry(domain, remainder == "") {
+		// 没有仓库地址，按Docker Hub的仓库名规范化
+		named, err := reference.ParseNormalizedNamed(val)
+		if err != nil || !reference.IsNameOnly(named) {
+			return "", invalid
+		}
+		return named.Name(), nil
+	}
+	domain, err := ValidateSimplifyRegistry(domain)
+	if err != nil || remainder == "" {
+		return domain, err
+	}
+	// 不补全library/，使"docker.io/myorg"能匹配该用户的所有仓库
+	ref, err := reference.Parse(domain + remainder)
+	named, ok := ref.(reference.Named)
+	if err != nil || !ok || !reference.IsNameOnly(named) {
+		return "", invalid
+	}
+	return named.Name(), nil
+}
+
+// isSimplifyRegistry returns whether the first component of a pattern of the
+// simplify image policy names a registry, as in image references. Alone, it
+// only names a registry with a port, rather than a repository with a tag.
+func isSimplifyRegistry(domain string, alone bool) bool {
+	if strings.Contains(domain, ".") || domain == "localhost" {
+		return true
+	}
+	i := strings.LastIndex(domain, ":")
+	if i == -1 {
+		return false
+	}
+	if !alone {
+		return true
+	}
+	_, err := strconv.Atoi(domain[i+1:])
+	return err == nil
+}
@@ -305,6 +305,105 @@ func TestValidateConfigurationErrors(t *testing.T) {
 				},
 			},
 		},
+		{
+			config: &Config{
+				CommonConfig: CommonConfig{
+					SimplifyPrefetchRate: -1,
+				},
+			},
+		},
+		{
+			config: &Config{
+				CommonConfig: CommonConfig{
+					SimplifyMaxCacheSize: -1,
+				},
+			},
+		},
+		{
+			config: &Config{
+				CommonConfig: CommonConfig{
+					SimplifyMaxProfileSize: -1,
+				},
+			},
+		},
+		{
+			config: &Config{
+				CommonConfig: CommonConfig{
+					SimplifyFetchTimeout: -1,
+				},
+			},
+		},
+		{
+			config: &Config{
+				CommonConfig: CommonConfig{
+					SimplifyFetchDrainTimeout: -1,
+				},
+			},
+		},
+		{
+			config: &Config{
+				CommonConfig: CommonConfig{
+					SimplifyMaxConcurrentFetches: -1,
+				},
+			},
+		},
+		{
+			config: &Config{
+				CommonConfig: CommonConfig{
+					SimplifyPeers:     []string{"10.0.0.2:7373"},
+					SimplifyPeerToken: "secret",
+				},
+			},
+		},
+		{
+			config: &Config{
+				CommonConfig: CommonConfig{
+					SimplifyPeers: []string{"http://10.0.0.2:7373"},
+				},
+			},
+		},
+		{
+			config: &Config{
+				CommonConfig: CommonConfig{
+					SimplifyPeerListen: ":7373",
+				},
+			},
+		},
+		{
+			config: &Config{
+				CommonConfig: CommonConfig{
+					SimplifyImagePolicy: map[string]string{"nginx": "yes"},
+				},
+			},
+		},
+		{
+			config: &Config{
+				CommonConfig: CommonConfig{
+					SimplifyImagePolicy: map[string]string{"nginx:alpine": "on"},
+				},
+			},
+		},
+		{
+			config: &Config{
+				CommonConfig: CommonConfig{
+					SimplifyCacheShared: true,
+				},
+			},
+		},
+		{
+			config: &Config{
+				CommonConfig: CommonConfig{
+					SimplifyCacheDir: "simplify/cache",
+				},
+			},
+		},
+		{
+			config: &Config{
+				CommonConfig: CommonConfig{
+					SimplifyRegistries: []string{"https://registry.example.com"},
+				},
+			},
+		},
 	}
 	for _, tc := range testCases {
 		err := Validate(tc.config)
@@ -376,6 +475,23 @@ func TestValidateConfiguration(t *testing.T) {
 				},
 			},
 		},
+		{
+			config: &Config{
+				CommonConfig: CommonConfig{
+					SimplifyImageDefault:         true,
+					SimplifyCacheDir:             "/mnt/simplify",
+					SimplifyCacheShared:          true,
+					SimplifyMaxCacheSize:         1 << 30,
+					SimplifyFetchTimeout:         5,
+					SimplifyMaxConcurrentFetches: 4,
+					SimplifyRegistries:           []string{"registry.example.com:5000", "docker.io"},
+					SimplifyPeers:                []string{"http://10.0.0.2:7373", "https://peer.example.com/"},
+					SimplifyPeerListen:           ":7373",
+					SimplifyPeerToken:            "secret",
+					SimplifyImagePolicy:          map[string]string{"registry.example.com:5000": "on", "docker.io/myorg": "on", "nginx": "off"},
+				},
+			},
+		},
 	}
 	for _, tc := range testCases {
 		err := Validate(tc.config)
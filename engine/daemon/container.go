@@ -160,6 +160,9 @@ func (daemon *Daemon) newContainer(name string, operatingSystem string, config *
 	base.Name = name
 	base.Driver = daemon.imageService.GraphDriverForOS(operatingSystem)
 	base.OS = operatingSystem
+	// 修改： 使用创建时指定的精简镜像选项作为初始值
+	base.SimplifyImage = hostConfig.SimplifyImage
+	// 修改
 	return base, err
 }
 
@@ -75,6 +75,12 @@ func (daemon *Daemon) containerCreate(params types.ContainerCreateConfig, manage
 	}
 	containerActions.WithValues("create").UpdateSince(start)
 
+	// 修改： 提醒镜像是推送的精简镜像
+	if warning := daemon.simplifiedImageWarning(container.ImageID, params.Config.Image); warning != "" {
+		warnings = append(warnings, warning)
+	}
+	// 修改
+
 	return containertypes.ContainerCreateCreatedBody{ID: container.ID, Warnings: warnings}, nil
 }
 
@@ -5,14 +5,18 @@ package daemon // import "github.com/docker/docker/daemon"
 import (
 	"context"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 
 	containertypes "github.com/docker/docker/api/types/container"
 	mounttypes "github.com/docker/docker/api/types/mount"
 	"github.com/docker/docker/container"
+	"github.com/docker/docker/daemon/simplify"
 	"github.com/docker/docker/oci"
+	"github.com/docker/docker/pkg/chrootarchive"
 	"github.com/docker/docker/pkg/stringid"
+	volumemounts "github.com/docker/docker/volume/mounts"
 	volumeopts "github.com/docker/docker/volume/service/opts"
 	"github.com/opencontainers/selinux/go-selinux/label"
 	"github.com/sirupsen/logrus"
@@ -86,9 +90,67 @@ func (daemon *Daemon) populateVolumes(c *container.Container) error {
 		}
 
 		logrus.Debugf("copying image data from %s:%s, to %s", c.ID, mnt.Destination, mnt.Name)
-		if err := c.CopyImagePathContent(mnt.Volume, mnt.Destination); err != nil {
+		// 修改： 精简镜像中被裁剪的文件一并复制到卷中
+		if err := daemon.copyImagePathContent(c, mnt); err != nil {
+			// 修改
 			return err
 		}
 	}
 	return nil
 }
+
+// 修改： 卷从精简镜像中被裁剪的目录复制初始内容
+
+// copyImagePathContent copies the files at the destination of the volume
+// mount point mnt in the mounted root filesystem of the container c into the
+// volume, as CopyImagePathContent does, along with those pruned from its
+// simplified image there, fetched first, so that the volume is seeded as it
+// would be from the full image. If they cannot be fetched, the volume is
+// seeded without them.
+func (daemon *Daemon) copyImagePathContent(c *container.Container, mnt *volumemounts.MountPoint) error {
+	resolvedPath, err := c.GetResourcePath(mnt.Destination)
+	if err != nil {
+		return err
+	}
+	sp, err := daemon.simplifiedPath(c, resolvedPath)
+	if err != nil {
+		return err
+	}
+	if sp == nil {
+		return c.CopyImagePathContent(mnt.Volume, mnt.Destination)
+	}
+	defer sp.Release()
+	if sp.Dir == "" {
+		logrus.WithFields(logrus.Fields{"container": c.ID, "volume": mnt.Name, "pruned": sp.Pruned}).Warn("files pruned from the simplified image cannot be fetched, the volume is seeded without them")
+		return c.CopyImagePathContent(mnt.Volume, mnt.Destination)
+	}
+
+	id := stringid.GenerateNonCryptoID()
+	path, err := mnt.Volume.Mount(id)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := mnt.Volume.Unmount(id); err != nil {
+			logrus.Warnf("error while unmounting volume %s: %v", mnt.Volume.Name(), err)
+		}
+	}()
+	// 与CopyImagePathContent一致，卷不为空时不复制
+	entries, err := ioutil.ReadDir(path)
+	if err != nil || len(entries) > 0 {
+		return err
+	}
+	if err := c.CopyImagePathContent(mnt.Volume, mnt.Destination); err != nil {
+		return err
+	}
+	missing := sp.Missing
+	if sp.Absent() {
+		// 卷的根目录已存在
+		missing = missing[1:]
+	}
+	rc := simplify.CopyCache(nil, sp.Dir, sp.Path, "/", missing, daemon.idMappings)
+	defer rc.Close()
+	return chrootarchive.Untar(rc, path, daemon.defaultTarCopyOptions(false))
+}
+
+// 修改
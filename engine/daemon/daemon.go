@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net"
+	"net/http"
 	"os"
 	"path"
 	"path/filepath"
@@ -19,6 +20,7 @@ import (
 	"time"
 
 	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/backend"
 	containertypes "github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/swarm"
 	"github.com/docker/docker/builder"
@@ -27,9 +29,11 @@ import (
 	"github.com/docker/docker/daemon/discovery"
 	"github.com/docker/docker/daemon/events"
 	"github.com/docker/docker/daemon/exec"
+	"github.com/docker/docker/daemon/graphdriver"
 	"github.com/docker/docker/daemon/images"
 	"github.com/docker/docker/daemon/logger"
 	"github.com/docker/docker/daemon/network"
+	"github.com/docker/docker/daemon/simplify"
 	"github.com/docker/docker/errdefs"
 	"github.com/sirupsen/logrus"
 
@@ -101,6 +105,21 @@ type Daemon struct {
 	cluster               Cluster
 	genericResources      []swarm.GenericResource
 	metricsPluginListener net.Listener
+	// 修改： 按需拉取精简镜像缺失文件的服务，内核不支持时为nil
+	simplifyFetch *simplify.Server
+	// 向其它daemon提供按需拉取缓存的服务，未配置时为nil
+	simplifyPeers *http.Server
+	// 记录容器访问文件的recorder，以容器ID为键
+	simplifyRecordMu  sync.Mutex
+	simplifyRecorders map[string]*simplify.Recorder
+	// 以克隆方式挂载精简镜像的驱动不会复制读取的文件，记录精简模式下容器打开的文件
+	simplifyOpened map[string]*simplify.Recorder
+	// 审计profile的容器，以容器ID为键
+	simplifyAuditMu sync.Mutex
+	simplifyAudits  map[string]*simplifyAudit
+	// 同一镜像的精简容器共享的镜像层只读挂载
+	simplifyMounts *simplify.SharedMounts
+	// 修改
 
 	machineMemory uint64
 
@@ -299,6 +318,12 @@ func (daemon *Daemon) restore() error {
 					}
 				}
 
+				// 修改： 重新为live-restore的精简容器提供按需拉取
+				if alive {
+					daemon.reattachSimplifyFetch(c)
+				}
+				// 修改
+
 				c.ResetRestartManager(false)
 				if !c.HostConfig.NetworkMode.IsContainer() && c.IsRunning() {
 					options, err := daemon.buildSandboxOptions(c)
@@ -350,6 +375,11 @@ func (daemon *Daemon) restore() error {
 		}(c)
 	}
 	wg.Wait()
+
+	// 修改： 清理已不存在的容器和镜像遗留的精简状态，须在按重启策略启动容器前完成
+	daemon.reconcileSimplify()
+	// 修改
+
 	daemon.netController, err = daemon.initNetworkController(daemon.configStore, activeSandboxes)
 	if err != nil {
 		return fmt.Errorf("Error initializing network controller: %v", err)
@@ -386,8 +416,8 @@ func (daemon *Daemon) restore() error {
 
 			// Make sure networks are available before starting
 			daemon.waitForNetworks(c)
-			// 修改： 添加simpString = ""参数
-			if err := daemon.containerStart(c, "", "", true, ""); err != nil {
+			// 修改： 添加simpCfg参数，沿用容器上记录的选项
+			if err := daemon.containerStart(c, "", "", true, backend.ContainerStartSimplifyConfig{}); err != nil {
 				// 修改
 				logrus.Errorf("Failed to start container %s: %s", c.ID, err)
 			}
@@ -455,8 +485,8 @@ func (daemon *Daemon) RestartSwarmContainers() {
 				group.Add(1)
 				go func(c *container.Container) {
 					defer group.Done()
-					// 修改： 添加simpString = ""参数
-					if err := daemon.containerStart(c, "", "", true, ""); err != nil {
+					// 修改： 添加simpCfg参数，沿用容器上记录的选项
+					if err := daemon.containerStart(c, "", "", true, backend.ContainerStartSimplifyConfig{}); err != nil {
 						// 修改
 						logrus.Error(err)
 					}
@@ -867,19 +897,40 @@ func NewDaemon(config *config.Config, registryService registry.Service, containe
 	// TODO: imageStore, distributionMetadataStore, and ReferenceStore are only
 	// used above to run migration. They could be initialized in ImageService
 	// if migration is called from daemon/images. layerStore might move as well.
+	// 修改： 启动按需拉取服务，镜像服务预取时使用
+	d.startSimplifyFetch()
+	// 修改
+
 	d.imageService = images.NewImageService(images.ImageServiceConfig{
 		ContainerStore:            d.containers,
 		DistributionMetadataStore: distributionMetadataStore,
 		EventsService:             d.EventsService,
+		IDMappings:                idMappings,
 		ImageStore:                imageStore,
 		LayerStores:               layerStores,
 		MaxConcurrentDownloads:    *config.MaxConcurrentDownloads,
 		MaxConcurrentUploads:      *config.MaxConcurrentUploads,
 		ReferenceStore:            rs,
 		RegistryService:           registryService,
+		SimplifyCacheRoot:         simplifyCacheRoot(config),
+		SimplifyCacheShared:       config.SimplifyCacheShared,
+		SimplifyFetch:             d.simplifyFetch,
+		SimplifyFetchMaxBatch:     config.SimplifyFetchMaxBatch,
+		SimplifyFetchMaxGap:       config.SimplifyFetchMaxGap,
+		SimplifyImageDefault:      config.SimplifyImageDefault,
+		SimplifyMaxProfileSize:    int64(config.SimplifyMaxProfileSize),
+		SimplifyPlaceholders:      d.simplifyPlaceholders(),
+		SimplifyProfileRoot:       simplify.ProfileRoot(config.Root),
+		SimplifyRangeRoot:         simplifyRangeRoot(config),
+		SimplifyRegistries:        simplifyRegistries(config),
+		SimplifyTOCRoot:           simplify.TOCRoot(config.Root),
 		TrustKey:                  trustKey,
 	})
 
+	// 修改： 加载共享的镜像层挂载
+	d.startSimplifyMounts()
+	// 修改
+
 	go d.execCommandGC()
 
 	d.containerd, err = containerdRemote.NewClient(ContainersNamespace, d)
@@ -1031,6 +1082,19 @@ func (daemon *Daemon) Shutdown() error {
 
 	daemon.cleanupMetricsPlugins()
 
+	// 修改： 容器都已停止，关闭按需拉取服务
+	if daemon.simplifyFetch != nil {
+		if err := daemon.simplifyFetch.Close(); err != nil {
+			logrus.Errorf("Error shutting down simplify fetch: %v", err)
+		}
+	}
+	if daemon.simplifyPeers != nil {
+		if err := daemon.simplifyPeers.Close(); err != nil {
+			logrus.Errorf("Error shutting down simplify peer server: %v", err)
+		}
+	}
+	// 修改
+
 	// Shutdown plugins after containers and layerstore. Don't change the order.
 	daemon.pluginShutdown()
 
@@ -1045,11 +1109,22 @@ func (daemon *Daemon) Shutdown() error {
 // Mount sets container.BaseFS
 // (is it not set coming in? why is it unset?)
 func (daemon *Daemon) Mount(container *container.Container) error {
+	// 修改： 挂载选项作为参数传入，精简模式的参数不写入container.MountLabel
+	return daemon.mount(container, graphdriver.MountOpts{MountLabel: container.GetMountLabel()})
+	// 修改
+}
+
+// 修改： 挂载选项由调用者传入
+// mount sets container.BaseFS, mounting its RWLayer with opts.
+func (daemon *Daemon) mount(container *container.Container, opts graphdriver.MountOpts) error {
+	// 修改
 	if container.RWLayer == nil {
 		return errors.New("RWLayer of container " + container.ID + " is unexpectedly nil")
 	}
 
-	dir, err := container.RWLayer.Mount(container.GetMountLabel())
+	// 修改： 使用传入的挂载选项
+	dir, err := container.RWLayer.MountWithOpts(opts)
+	// 修改
 	if err != nil {
 		return err
 	}
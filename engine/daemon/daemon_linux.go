@@ -110,6 +110,10 @@ func getCleanPatterns(id string) (regexps []*regexp.Regexp) {
 	if id == "" {
 		id = "[0-9a-f]{64}"
 		patterns = append(patterns, "containers/"+id+"/shm")
+	} else {
+		// 修改： 共享的镜像层挂载仍可能被live-restore的容器使用，只按ID回收
+		patterns = append(patterns, "simplify/mounts/"+id+"/merged$")
+		// 修改
 	}
 	patterns = append(patterns, "aufs/mnt/"+id+"$", "overlay/"+id+"/merged$", "zfs/graph/"+id+"$")
 	for _, p := range patterns {
@@ -99,6 +99,27 @@ func TestCleanupMountsByID(t *testing.T) {
 	}
 }
 
+func TestCleanupSimplifySharedMountsByID(t *testing.T) {
+	d := &Daemon{
+		root: "/var/lib/docker/",
+	}
+
+	id := "5e2c8b9a0f3d4e6b7a8c9d0e1f2a3b4c5d6e7f8091a2b3c4d5e6f708192a3b4c"
+	mountInfo := `300 160 0:90 / /var/lib/docker/simplify/mounts/` + id + `/merged ro,relatime - overlay overlay ro,lowerdir=/var/lib/docker/overlay2/b/diff:/var/lib/docker/overlay2/a/diff`
+	var unmounted []string
+	unmount := func(target string) error {
+		unmounted = append(unmounted, target)
+		return nil
+	}
+
+	// shared mounts may still be used by live-restored containers
+	d.cleanupMountsFromReaderByID(strings.NewReader(mountInfo), "", unmount)
+	assert.Check(t, is.Len(unmounted, 0))
+
+	d.cleanupMountsFromReaderByID(strings.NewReader(mountInfo), id, unmount)
+	assert.Check(t, is.DeepEqual(unmounted, []string{"/var/lib/docker/simplify/mounts/" + id + "/merged"}))
+}
+
 func TestNotCleanupMounts(t *testing.T) {
 	d := &Daemon{
 		repository: "",
@@ -23,6 +23,7 @@ import (
 	containertypes "github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/container"
 	"github.com/docker/docker/daemon/config"
+	"github.com/docker/docker/daemon/graphdriver"
 	"github.com/docker/docker/daemon/initlayer"
 	"github.com/docker/docker/opts"
 	"github.com/docker/docker/pkg/containerfs"
@@ -1270,13 +1271,25 @@ func (daemon *Daemon) registerLinks(container *container.Container, hostConfig *
 // conditionalMountOnStart is a platform specific helper function during the
 // container start to call mount.
 // 修改： 添加simp参数
-func (daemon *Daemon) conditionalMountOnStart(container *container.Container, simp bool) error {
-	// 修改： 添加"simp=on"参数到container.MountLabel
-	if simp {
-		container.MountLabel += ",simp=on"
+func (daemon *Daemon) conditionalMountOnStart(container *container.Container, simp graphdriver.SimplifyOptions) error {
+	// 修改： simp参数随挂载选项传给graphdriver，container.MountLabel保持不变
+	if simp.IsZero() {
+		return daemon.Mount(container)
 	}
-	fmt.Println("*\n*\n*\ncontainer.MountLabel: " + container.MountLabel + "\n*\n*\n*")
-	return daemon.Mount(container)
+	if err := daemon.checkSimplifyMount(container.OS); err != nil {
+		return err
+	}
+	// 克隆的层无需特殊挂载，由daemon记录和插入文件
+	if graphdriver.SimplifiesByClone(daemon.imageService.GraphDriverForOS(container.OS)) {
+		return daemon.Mount(container)
+	}
+	// 拉取目录是容器rootfs的一层，和rootfs一样使用容器的标签
+	if simp.FetchDir != "" {
+		if err := label.Relabel(simp.FetchDir, container.GetMountLabel(), false); err != nil {
+			return err
+		}
+	}
+	return daemon.mount(container, graphdriver.MountOpts{MountLabel: container.GetMountLabel(), Simplify: simp})
 	// 修改
 }
 
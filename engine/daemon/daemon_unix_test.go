@@ -6,11 +6,18 @@ import (
 	"errors"
 	"io/ioutil"
 	"os"
+	"runtime"
 	"testing"
 
 	containertypes "github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/container"
 	"github.com/docker/docker/daemon/config"
+	"github.com/docker/docker/daemon/graphdriver"
+	"github.com/docker/docker/daemon/images"
+	"github.com/docker/docker/layer"
+	"github.com/docker/docker/pkg/containerfs"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
 )
 
 type fakeContainerGetter struct {
@@ -266,3 +273,53 @@ func TestNetworkOptions(t *testing.T) {
 		t.Fatal("Expected networkOptions error, got nil")
 	}
 }
+
+// labelRWLayer records the options it is mounted with.
+type labelRWLayer struct {
+	layer.RWLayer
+	opts graphdriver.MountOpts
+}
+
+func (l *labelRWLayer) Mount(mountLabel string) (containerfs.ContainerFS, error) {
+	return l.MountWithOpts(graphdriver.MountOpts{MountLabel: mountLabel})
+}
+
+func (l *labelRWLayer) MountWithOpts(opts graphdriver.MountOpts) (containerfs.ContainerFS, error) {
+	l.opts = opts
+	return containerfs.NewLocalContainerFS("/var/lib/docker/overlay2/abc/merged"), nil
+}
+
+type simplifyLayerStore struct {
+	layer.Store
+}
+
+func (simplifyLayerStore) DriverName() string {
+	return "simplify-label-test"
+}
+
+func TestConditionalMountOnStartSimplifyLabel(t *testing.T) {
+	graphdriver.RegisterSimplify("simplify-label-test")
+	d := &Daemon{
+		imageService: images.NewImageService(images.ImageServiceConfig{
+			LayerStores: map[string]layer.Store{runtime.GOOS: simplifyLayerStore{}},
+		}),
+	}
+
+	mountLabel := "system_u:object_r:container_file_t:s0:c1,c2"
+	for _, simp := range []graphdriver.SimplifyOptions{
+		{},
+		{Record: true},
+		{Record: true, FetchDir: "/var/lib/docker/simplify/fetch/def/fs", Lower: "/var/lib/docker/simplify/mounts/def/merged"},
+	} {
+		rw := &labelRWLayer{}
+		c := &container.Container{ID: "abc", OS: runtime.GOOS, MountLabel: mountLabel, RWLayer: rw}
+		assert.NilError(t, d.conditionalMountOnStart(c, simp))
+
+		// the rootfs is mounted with the container's label, which is left as is,
+		// and the simplify options are passed to the driver on their own
+		assert.Check(t, is.Equal(rw.opts.MountLabel, mountLabel))
+		assert.Check(t, is.DeepEqual(rw.opts.Simplify, simp))
+		assert.Check(t, is.Equal(c.MountLabel, mountLabel))
+		assert.Check(t, is.Equal(c.BaseFS.Path(), "/var/lib/docker/overlay2/abc/merged"))
+	}
+}
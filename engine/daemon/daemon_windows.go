@@ -11,6 +11,9 @@ import (
 	containertypes "github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/container"
 	"github.com/docker/docker/daemon/config"
+	"github.com/docker/docker/daemon/graphdriver"
+	"github.com/docker/docker/daemon/simplify"
+	"github.com/docker/docker/errdefs"
 	"github.com/docker/docker/pkg/containerfs"
 	"github.com/docker/docker/pkg/fileutils"
 	"github.com/docker/docker/pkg/idtools"
@@ -492,7 +495,12 @@ func (daemon *Daemon) runAsHyperVContainer(hostConfig *containertypes.HostConfig
 
 // conditionalMountOnStart is a platform specific helper function during the
 // container start to call mount.
-func (daemon *Daemon) conditionalMountOnStart(container *container.Container) error {
+// 修改： 添加simp参数，Windows不支持精简挂载
+func (daemon *Daemon) conditionalMountOnStart(container *container.Container, simp graphdriver.SimplifyOptions) error {
+	if !simp.IsZero() {
+		return errdefs.NotImplemented(simplify.ErrWindowsNotSupported)
+	}
+	// 修改
 	// Bail out now for Linux containers. We cannot mount the containers filesystem on the
 	// host as it is a non-Windows filesystem.
 	if system.LCOWSupported() && container.OS != "windows" {
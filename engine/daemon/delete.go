@@ -118,6 +118,9 @@ func (daemon *Daemon) cleanupContainer(container *container.Container, forceRemo
 	// When container creation fails and `RWLayer` has not been created yet, we
 	// do not call `ReleaseRWLayer`
 	if container.RWLayer != nil {
+		// 修改： 层释放前按挂载ID清除按需拉取的记录
+		daemon.forgetSimplifyFetches(container)
+		// 修改
 		err := daemon.imageService.ReleaseLayer(container.RWLayer, container.OS)
 		if err != nil {
 			err = errors.Wrapf(err, "container %s", container.ID)
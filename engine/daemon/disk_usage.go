@@ -41,10 +41,20 @@ func (daemon *Daemon) SystemDiskUsage(ctx context.Context) (*types.DiskUsage, er
 		return nil, err
 	}
 
+	// 修改： 汇总精简镜像节省的空间
+	var simplifiedReclaimed int64
+	for _, img := range allImages {
+		if img.Simplified && img.FullSize > img.MaterializedSize {
+			simplifiedReclaimed += img.FullSize - img.MaterializedSize
+		}
+	}
+	// 修改
+
 	return &types.DiskUsage{
-		LayersSize: allLayersSize,
-		Containers: allContainers,
-		Volumes:    localVolumes,
-		Images:     allImages,
+		LayersSize:          allLayersSize,
+		Containers:          allContainers,
+		Volumes:             localVolumes,
+		Images:              allImages,
+		SimplifiedReclaimed: simplifiedReclaimed,
 	}, nil
 }
@@ -5,11 +5,104 @@ import (
 	"strings"
 	"syscall"
 
+	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/errdefs"
 	"github.com/pkg/errors"
 	"google.golang.org/grpc"
 )
 
+// 修改： 添加精简镜像相关错误
+
+// ErrImageNotSimplified is returned when a container is started in simplified
+// mode from an image that has no simplification data.
+var ErrImageNotSimplified = errors.New("image has no simplification data")
+
+type imageNotSimplifiedError struct {
+	image string
+}
+
+func (e imageNotSimplifiedError) Error() string {
+	return fmt.Sprintf("image %s has no simplification data", e.image)
+}
+
+func (e imageNotSimplifiedError) Cause() error {
+	return ErrImageNotSimplified
+}
+
+func (imageNotSimplifiedError) InvalidParameter() {}
+
+func (imageNotSimplifiedError) ErrorCode() string {
+	return types.ErrorCodeImageNotSimplified
+}
+
+// simplifyNotSupportedError gives the error of a storage driver that cannot
+// mount simplified images the code clients tell it by.
+type simplifyNotSupportedError struct {
+	error
+}
+
+func (e simplifyNotSupportedError) Cause() error {
+	return e.error
+}
+
+func (simplifyNotSupportedError) ErrorCode() string {
+	return types.ErrorCodeSimplifyNotSupported
+}
+
+// simplifyMissingError is returned when a container is started offline
+// while files the profile of its simplified image keeps are missing.
+type simplifyMissingError struct {
+	// missing are the first of the files missing, total how many there are
+	missing []string
+	total   int
+}
+
+func (e simplifyMissingError) Error() string {
+	msg := fmt.Sprintf("cannot start offline: %d files kept by the simplify profile are missing from the image: %s", e.total, strings.Join(e.missing, ", "))
+	if more := e.total - len(e.missing); more > 0 {
+		msg += fmt.Sprintf(" and %d more", more)
+	}
+	return msg
+}
+
+func (simplifyMissingError) Conflict() {}
+
+// simplifyPrunedError is returned when docker cp reads or writes a path that
+// was pruned from the simplified image of a container, and whose files
+// cannot be fetched.
+type simplifyPrunedError struct {
+	file      string
+	container string
+	// reason is why the files cannot be fetched
+	reason string
+}
+
+func (e simplifyPrunedError) Error() string {
+	return fmt.Sprintf("Could not find the file %s in container %s: it was pruned from the simplified image and cannot be fetched: %s", e.file, e.container, e.reason)
+}
+
+func (simplifyPrunedError) NotFound() {}
+
+// simplifyExecError is returned when docker exec runs a command whose
+// executable, or a file it needs, was pruned from the simplified image of the
+// container and cannot be fetched.
+type simplifyExecError struct {
+	cmd   string
+	image string
+	// missing are the files the command needs that are missing
+	missing []string
+	// reason is why the files cannot be fetched
+	reason string
+}
+
+func (e simplifyExecError) Error() string {
+	return fmt.Sprintf("exec: %q: %s pruned from the simplified image and cannot be fetched: %s; fetch them ahead of time with `docker image prefetch --paths %s %s`", e.cmd, strings.Join(e.missing, ", "), e.reason, strings.Join(e.missing, ","), e.image)
+}
+
+func (simplifyExecError) NotFound() {}
+
+// 修改
+
 func errNotRunning(id string) error {
 	return errdefs.Conflict(errors.Errorf("Container %s is not running", id))
 }
@@ -227,6 +227,12 @@ func (d *Daemon) ContainerExecStart(ctx context.Context, name string, stdin io.R
 		p.Cwd = "/"
 	}
 
+	// 修改： 命令或用户文件被精简时先按需拉取
+	if err := d.prepareSimplifiedExec(ctx, c, ec, p.Cwd); err != nil {
+		return err
+	}
+	// 修改
+
 	if err := d.execSetPlatformOpt(c, ec, p); err != nil {
 		return err
 	}
@@ -1,10 +1,12 @@
 package daemon // import "github.com/docker/docker/daemon"
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"runtime"
 
+	"github.com/docker/docker/api/types/backend"
 	"github.com/docker/docker/container"
 	"github.com/docker/docker/errdefs"
 	"github.com/docker/docker/pkg/archive"
@@ -14,7 +16,9 @@ import (
 
 // ContainerExport writes the contents of the container to the given
 // writer. An error is returned if the container cannot be found.
-func (daemon *Daemon) ContainerExport(name string, out io.Writer) error {
+// 修改： 添加精简镜像选项
+func (daemon *Daemon) ContainerExport(name string, out io.Writer, simpCfg backend.ContainerExportSimplifyConfig) error {
+	// 修改
 	container, err := daemon.GetContainer(name)
 	if err != nil {
 		return err
@@ -34,7 +38,7 @@ func (daemon *Daemon) ContainerExport(name string, out io.Writer) error {
 		return errdefs.Conflict(err)
 	}
 
-	data, err := daemon.containerExport(container)
+	data, err := daemon.containerExport(container, simpCfg)
 	if err != nil {
 		return fmt.Errorf("Error exporting container %s: %v", name, err)
 	}
@@ -47,7 +51,7 @@ func (daemon *Daemon) ContainerExport(name string, out io.Writer) error {
 	return nil
 }
 
-func (daemon *Daemon) containerExport(container *container.Container) (arch io.ReadCloser, err error) {
+func (daemon *Daemon) containerExport(container *container.Container, simpCfg backend.ContainerExportSimplifyConfig) (arch io.ReadCloser, err error) {
 	if !system.IsOSSupported(container.OS) {
 		return nil, fmt.Errorf("cannot export %s: %s ", container.ID, system.ErrNotSupportedOperatingSystem)
 	}
@@ -75,6 +79,15 @@ func (daemon *Daemon) containerExport(container *container.Container) (arch io.R
 		rwlayer.Unmount()
 		return nil, err
 	}
+	// 修改： 精简镜像的容器导出完整的文件系统，或列出缺失的文件
+	completed, err := daemon.imageService.SimplifyExport(context.Background(), container.ImageID, container.OS, archive, rwlayer, simpCfg.Sparse)
+	if err != nil {
+		archive.Close()
+		rwlayer.Unmount()
+		return nil, err
+	}
+	archive = completed
+	// 修改
 	arch = ioutils.NewReadCloserWrapper(archive, func() error {
 		err := archive.Close()
 		rwlayer.Unmount()
@@ -6,7 +6,10 @@ import (
 	"path/filepath"
 	"testing"
 
+	"github.com/docker/docker/errdefs"
+	"github.com/pkg/errors"
 	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
 )
 
 func TestIsEmptyDir(t *testing.T) {
@@ -34,3 +37,37 @@ func TestIsEmptyDir(t *testing.T) {
 	empty = isEmptyDir(d)
 	assert.Check(t, !empty)
 }
+
+func TestSimplifyOptionsIsZero(t *testing.T) {
+	assert.Check(t, SimplifyOptions{}.IsZero())
+	// A shared lower alone, without recording or fetching, leaves the mount unchanged.
+	assert.Check(t, SimplifyOptions{Lower: "/var/lib/docker/simplify/mounts/def/merged"}.IsZero())
+	assert.Check(t, !SimplifyOptions{Record: true}.IsZero())
+	assert.Check(t, !SimplifyOptions{FetchDir: "/var/lib/docker/simplify/cache/abc/fs"}.IsZero())
+}
+
+func TestSupportsSimplify(t *testing.T) {
+	assert.Check(t, !SupportsSimplify("test-simplify"))
+	RegisterSimplify("test-simplify")
+	assert.Check(t, SupportsSimplify("test-simplify"))
+}
+
+func TestCheckSimplify(t *testing.T) {
+	RegisterSimplify("test-simplify")
+	assert.NilError(t, CheckSimplify("test-simplify"))
+
+	err := CheckSimplify("test-full")
+	assert.Check(t, is.ErrorContains(err, "storage driver test-full does not support simplified images (supported: "))
+	assert.Check(t, is.Contains(err.Error(), "test-simplify"))
+	assert.Check(t, errors.Cause(err) == ErrSimplifyNotSupported)
+	assert.Check(t, errdefs.IsNotImplemented(err))
+}
+
+func TestSimplifiesByClone(t *testing.T) {
+	RegisterSimplify("test-simplify")
+	RegisterSimplifyClone("test-simplify-clone")
+	assert.Check(t, !SimplifiesByClone("test-simplify"))
+	assert.Check(t, SimplifiesByClone("test-simplify-clone"))
+	assert.Check(t, SupportsSimplify("test-simplify-clone"))
+	assert.NilError(t, CheckSimplify("test-simplify-clone"))
+}
@@ -115,6 +115,9 @@ var (
 
 func init() {
 	graphdriver.Register(driverName, Init)
+	// 修改： overlay2支持simp挂载
+	graphdriver.RegisterSimplify(driverName)
+	// 修改
 }
 
 // Init returns the native diff driver for overlay filesystem.
@@ -535,9 +538,17 @@ func (d *Driver) Remove(id string) error {
 }
 
 // Get creates and mounts the required file system for the given id and returns the mount path.
+// 修改： 精简挂载由GetSimplified完成
 func (d *Driver) Get(id, mountLabel string) (_ containerfs.ContainerFS, retErr error) {
-	// 修改： 添加输出
-	fmt.Println("*\n*\n*\n Get here!!!")
+	return d.GetSimplified(id, graphdriver.MountOpts{MountLabel: mountLabel})
+}
+
+var _ graphdriver.SimplifyMountDriver = &Driver{}
+
+// GetSimplified is Get mounting the layer with the simplification settings
+// of opts.
+func (d *Driver) GetSimplified(id string, opts graphdriver.MountOpts) (_ containerfs.ContainerFS, retErr error) {
+	mountLabel, simp := opts.MountLabel, opts.Simplify
 	// 修改
 	d.locker.Lock(id)
 	defer d.locker.Unlock(id)
@@ -576,24 +587,6 @@ func (d *Driver) Get(id, mountLabel string) (_ containerfs.ContainerFS, retErr e
 
 	workDir := path.Join(dir, "work")
 	splitLowers := strings.Split(string(lowers), ":")
-	absLowers := make([]string, len(splitLowers))
-	for i, s := range splitLowers {
-		absLowers[i] = path.Join(d.home, s)
-	}
-	opts := fmt.Sprintf("lowerdir=%s,upperdir=%s,workdir=%s", strings.Join(absLowers, ":"), path.Join(dir, "diff"), path.Join(dir, "work"))
-
-	// 修改： 输出
-	if mountLabel != "" {
-		opts += mountLabel
-		mountLabel = ""
-	}
-	// 修改
-
-	mountData := label.FormatMountLabel(opts, mountLabel)
-
-	// 修改： 输出
-	fmt.Println("*\n*\n*\nmountData: " + mountData + "\n*\n*\n*")
-	// 修改
 
 	mount := unix.Mount
 	mountTarget := mergedDir
@@ -617,17 +610,13 @@ func (d *Driver) Get(id, mountLabel string) (_ containerfs.ContainerFS, retErr e
 		pageSize = 4096
 	}
 
-	// Use relative paths and mountFrom when the mount data has exceeded
-	// the page size. The mount syscall fails if the mount data cannot
-	// fit within a page and relative links make the mount data much
-	// smaller at the expense of requiring a fork exec to chroot.
-	if len(mountData) > pageSize {
-		opts = fmt.Sprintf("lowerdir=%s,upperdir=%s,workdir=%s", string(lowers), path.Join(id, "diff"), path.Join(id, "work"))
-		mountData = label.FormatMountLabel(opts, mountLabel)
-		if len(mountData) > pageSize {
-			return nil, fmt.Errorf("cannot mount layer, mount label too large %d", len(mountData))
-		}
-
+	// 修改： 挂载参数连同精简添加的lowerdir一起计算
+	mountData, relative, err := d.mountData(id, splitLowers, simp, mountLabel, pageSize)
+	if err != nil {
+		return nil, err
+	}
+	// 修改
+	if relative {
 		mount = func(source string, target string, mType string, flags uintptr, label string) error {
 			return mountFrom(d.home, source, target, mType, flags, label)
 		}
@@ -647,6 +636,69 @@ func (d *Driver) Get(id, mountLabel string) (_ containerfs.ContainerFS, retErr e
 	return containerfs.NewLocalContainerFS(mergedDir), nil
 }
 
+// 修改： 精简挂载的参数
+
+// mountData returns the data of the overlay mount of the layer id, whose
+// lowers are relative to the home of the driver, and whether it uses
+// relative paths, to be mounted from the home. The lowers simp adds count
+// towards the page size the data must fit in: with a deep layer chain, the
+// mount fails with an error naming them.
+func (d *Driver) mountData(id string, lowers []string, simp graphdriver.SimplifyOptions, mountLabel string, pageSize int) (string, bool, error) {
+	// 镜像层由共享的只读挂载代替，只保留容器的init层
+	var extra int
+	if simp.Lower != "" && len(lowers) > 1 {
+		lowers = []string{lowers[0], simp.Lower}
+		extra++
+	}
+	// 按需拉取的缓存目录放在所有镜像层之上、容器读写层之下
+	if simp.FetchDir != "" {
+		lowers = append([]string{simp.FetchDir}, lowers...)
+		extra++
+	}
+	absLowers := make([]string, len(lowers))
+	for i, l := range lowers {
+		absLowers[i] = l
+		if !path.IsAbs(l) {
+			absLowers[i] = path.Join(d.home, l)
+		}
+	}
+	dir := d.dir(id)
+	opts := fmt.Sprintf("lowerdir=%s,upperdir=%s,workdir=%s", strings.Join(absLowers, ":"), path.Join(dir, "diff"), path.Join(dir, "work"))
+	mountData := label.FormatMountLabel(opts+simplifyOpts(simp), mountLabel)
+	if len(mountData) <= pageSize {
+		return mountData, false, nil
+	}
+
+	// Use relative paths and mountFrom when the mount data has exceeded
+	// the page size. The mount syscall fails if the mount data cannot
+	// fit within a page and relative links make the mount data much
+	// smaller at the expense of requiring a fork exec to chroot.
+	opts = fmt.Sprintf("lowerdir=%s,upperdir=%s,workdir=%s", strings.Join(lowers, ":"), path.Join(id, "diff"), path.Join(id, "work"))
+	// 相对路径挂载同样需要simp参数，否则层数较多时simp会被忽略
+	mountData = label.FormatMountLabel(opts+simplifyOpts(simp), mountLabel)
+	if len(mountData) > pageSize {
+		if extra > 0 {
+			return "", false, fmt.Errorf("cannot mount simplified layer, mount label too large %d: %d lower directories, %d of them added by simplification, exceed the page size %d", len(mountData), len(lowers), extra, pageSize)
+		}
+		return "", false, fmt.Errorf("cannot mount layer, mount label too large %d", len(mountData))
+	}
+	return mountData, true, nil
+}
+
+// simplifyOpts returns the extra mount options for a simplified mount
+func simplifyOpts(simp graphdriver.SimplifyOptions) string {
+	var opts string
+	if simp.Record {
+		opts += "," + graphdriver.SimplifyMountOption
+	}
+	if simp.FetchDir != "" {
+		opts += "," + graphdriver.FetchMountOption
+	}
+	return opts
+}
+
+// 修改
+
 // Put unmounts the mount path created for the give id.
 // It also removes the 'merged' directory to force the kernel to unmount the
 // overlay mount in other namespaces.
@@ -3,8 +3,11 @@
 package overlay2 // import "github.com/docker/docker/daemon/graphdriver/overlay2"
 
 import (
+	"fmt"
 	"io/ioutil"
 	"os"
+	"path"
+	"strings"
 	"testing"
 
 	"github.com/docker/docker/daemon/graphdriver"
@@ -70,6 +73,56 @@ func TestOverlayTeardown(t *testing.T) {
 	graphtest.PutDriver(t)
 }
 
+// TestOverlaySimplifyMountDataDeepChain checks the mount data of a layer on
+// top of the deepest chain of lowers the driver creates, with the lowers a
+// simplified mount adds.
+func TestOverlaySimplifyMountDataDeepChain(t *testing.T) {
+	d := &Driver{home: "/var/lib/docker/overlay2"}
+	id := strings.Repeat("a", 64)
+	lowers := make([]string, maxDepth)
+	for i := range lowers {
+		lowers[i] = path.Join(linkDir, fmt.Sprintf("%0*d", idLength, i))
+	}
+	fetchDir := "/var/lib/docker/simplify/cache/" + strings.Repeat("b", 64) + "/fs"
+
+	data, relative, err := d.mountData(id, lowers, graphdriver.SimplifyOptions{Record: true, FetchDir: fetchDir}, "", 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !relative {
+		t.Fatalf("expected relative paths for %d lowers", len(lowers))
+	}
+	if !strings.HasPrefix(data, "lowerdir="+fetchDir+":"+lowers[0]+":") {
+		t.Fatalf("expected the fetch dir above the lowers, got %.200s", data)
+	}
+	if !strings.HasSuffix(data, ","+graphdriver.SimplifyMountOption+","+graphdriver.FetchMountOption) {
+		t.Fatalf("expected the simplify options, got %s", data[len(data)-100:])
+	}
+
+	// the shared lower replaces the layers of the image, leaving the init
+	// layer
+	data, relative, err = d.mountData(id, lowers, graphdriver.SimplifyOptions{FetchDir: fetchDir, Lower: "/var/lib/docker/simplify/lower"}, "", 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "lowerdir=" + fetchDir + ":" + path.Join(d.home, lowers[0]) + ":/var/lib/docker/simplify/lower,"
+	if relative || !strings.HasPrefix(data, expected) {
+		t.Fatalf("expected %s, got %s", expected, data)
+	}
+
+	// lowers that no longer fit in a page fail with an error naming the
+	// ones added by simplification
+	fetchDir = "/" + strings.Repeat("c", 400)
+	_, _, err = d.mountData(id, lowers, graphdriver.SimplifyOptions{FetchDir: fetchDir}, "", 4096)
+	if err == nil || !strings.Contains(err.Error(), "129 lower directories, 1 of them added by simplification") {
+		t.Fatalf("expected a mount data error, got %v", err)
+	}
+	// the same chain fits without them
+	if _, _, err = d.mountData(id, lowers, graphdriver.SimplifyOptions{}, "", 4096); err != nil {
+		t.Fatal(err)
+	}
+}
+
 // Benchmarks should always setup new driver
 
 func BenchmarkExists(b *testing.B) {
@@ -0,0 +1,161 @@
+package graphdriver // import "github.com/docker/docker/daemon/graphdriver"
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/docker/docker/pkg/containerfs"
+	"github.com/pkg/errors"
+)
+
+const (
+	// SimplifyMountOption is the overlay mount option that makes the kernel
+	// copy every file read or executed by the container up into the upper
+	// directory.
+	SimplifyMountOption = "simp=on"
+	// FetchMountOption is the overlay mount option that makes the kernel
+	// ask the fetch helper for files missing from every layer.
+	FetchMountOption = "lazy=on"
+)
+
+var (
+	simplifyDriversMu sync.Mutex
+	// 支持simp挂载的驱动
+	simplifyDrivers = make(map[string]bool)
+	// 以克隆镜像层的方式挂载精简镜像的驱动
+	simplifyCloneDrivers = make(map[string]bool)
+)
+
+// SimplifyOptions are the simplification settings for a single mount.
+type SimplifyOptions struct {
+	// Record copies every file read or executed up into the upper directory.
+	Record bool
+	// FetchDir is layered directly beneath the upper directory and receives
+	// the files fetched on demand. Empty disables on-demand fetching.
+	FetchDir string
+	// Lower is a read-only mount of the image layers, shared by the
+	// containers running the image. It replaces every layer beneath the
+	// writable layer but the topmost, the container's init layer. Empty
+	// mounts the layers directly.
+	Lower string
+}
+
+// IsZero returns true if the options leave the mount unchanged.
+func (o SimplifyOptions) IsZero() bool {
+	return !o.Record && o.FetchDir == ""
+}
+
+// MountOpts are the options of a single mount of a layer.
+type MountOpts struct {
+	// MountLabel is the SELinux label of the mount, as passed to Get.
+	MountLabel string
+	// Simplify are the simplification settings of the mount.
+	Simplify SimplifyOptions
+}
+
+// SimplifyMountDriver is implemented by drivers that mount layers in
+// simplified mode by themselves, rather than by cloning them.
+type SimplifyMountDriver interface {
+	// GetSimplified is Get with the simplification settings of the mount.
+	// Get is GetSimplified with zero settings.
+	GetSimplified(id string, opts MountOpts) (containerfs.ContainerFS, error)
+}
+
+// RegisterSimplify marks the named driver as able to mount layers in
+// simplified mode.
+func RegisterSimplify(name string) {
+	simplifyDriversMu.Lock()
+	simplifyDrivers[name] = true
+	simplifyDriversMu.Unlock()
+}
+
+// RegisterSimplifyClone marks the named driver as able to mount layers in
+// simplified mode, its writable layers being clones of the layers of the
+// image. Such drivers neither copy up the files read nor look up missing
+// files in the fetch directory: the files the container opens are recorded
+// instead, and those fetched on demand are inserted into its writable
+// layer.
+func RegisterSimplifyClone(name string) {
+	simplifyDriversMu.Lock()
+	simplifyDrivers[name] = true
+	simplifyCloneDrivers[name] = true
+	simplifyDriversMu.Unlock()
+}
+
+// SimplifiesByClone returns true if the named driver was registered with
+// RegisterSimplifyClone.
+func SimplifiesByClone(name string) bool {
+	simplifyDriversMu.Lock()
+	defer simplifyDriversMu.Unlock()
+	return simplifyCloneDrivers[name]
+}
+
+// SimplifyApplyDriver is implemented by drivers that build the layers of
+// simplified images from a clone of a layer of their full image, rather
+// than by extracting them anew.
+type SimplifyApplyDriver interface {
+	// ApplySimplifiedDiff creates the layer id, which has no parent, as a
+	// clone of the layer source with diff applied to it: the entries of
+	// diff the clone has already are kept as they are, and every other
+	// file of the clone is removed. The files of diff must all be from
+	// source, or added over it. It returns the size of the content of
+	// diff, as ApplyDiff does.
+	ApplySimplifiedDiff(id, source string, diff io.Reader) (size int64, err error)
+}
+
+// SupportsSimplify returns true if the named driver can mount layers in
+// simplified mode.
+func SupportsSimplify(name string) bool {
+	simplifyDriversMu.Lock()
+	defer simplifyDriversMu.Unlock()
+	return simplifyDrivers[name]
+}
+
+// ErrSimplifyNotSupported is the cause of the errors returned for storage
+// drivers that cannot mount layers in simplified mode.
+var ErrSimplifyNotSupported = errors.New("storage driver does not support simplified images")
+
+type simplifyNotSupportedError struct {
+	driver    string
+	supported []string
+}
+
+func (e simplifyNotSupportedError) Error() string {
+	msg := fmt.Sprintf("storage driver %s does not support simplified images", e.driver)
+	if len(e.supported) > 0 {
+		msg += fmt.Sprintf(" (supported: %s)", strings.Join(e.supported, ", "))
+	}
+	return msg
+}
+
+func (e simplifyNotSupportedError) Cause() error {
+	return ErrSimplifyNotSupported
+}
+
+func (simplifyNotSupportedError) NotImplemented() {}
+
+// CheckSimplify returns an error naming the drivers that can, caused by
+// ErrSimplifyNotSupported, if the named driver cannot mount layers in
+// simplified mode.
+func CheckSimplify(name string) error {
+	if SupportsSimplify(name) {
+		return nil
+	}
+	return simplifyNotSupportedError{driver: name, supported: SimplifyDrivers()}
+}
+
+// SimplifyDrivers returns the names, sorted, of the drivers able to mount
+// layers in simplified mode.
+func SimplifyDrivers() []string {
+	simplifyDriversMu.Lock()
+	defer simplifyDriversMu.Unlock()
+	names := make([]string, 0, len(simplifyDrivers))
+	for name := range simplifyDrivers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
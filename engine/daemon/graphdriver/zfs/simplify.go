@@ -0,0 +1,206 @@
+// +build linux freebsd
+
+package zfs // import "github.com/docker/docker/daemon/graphdriver/zfs"
+
+import (
+	"archive/tar"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/docker/docker/daemon/graphdriver"
+	"github.com/docker/docker/pkg/archive"
+	"github.com/docker/docker/pkg/idtools"
+	"github.com/docker/docker/pkg/system"
+	"github.com/mistifyio/go-zfs"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// simplifyDriver builds the layers of simplified images as clones of the
+// layers of the full images, so that the kept files share their blocks
+// with the full image instead of being extracted again.
+type simplifyDriver struct {
+	graphdriver.Driver
+	zfs *Driver
+}
+
+// ApplySimplifiedDiff implements graphdriver.SimplifyApplyDriver.
+func (d *simplifyDriver) ApplySimplifiedDiff(id, source string, diff io.Reader) (int64, error) {
+	return d.zfs.applySimplified(id, source, diff)
+}
+
+// applySimplified clones the dataset of source into id, writes the entries
+// of diff the clone does not already hold, and removes every path diff does
+// not name.
+func (d *Driver) applySimplified(id, source string, diff io.Reader) (int64, error) {
+	if err := d.cloneFilesystem(d.zfsPath(id), d.zfsPath(source)); err != nil {
+		return 0, err
+	}
+
+	fs, err := d.Get(id, "")
+	if err != nil {
+		return 0, err
+	}
+	defer d.Put(id)
+	root := fs.Path()
+
+	start := time.Now().UTC()
+	pr, pw := io.Pipe()
+	applied := make(chan error, 1)
+	go func() {
+		_, err := graphdriver.ApplyUncompressedLayer(root, pr, &archive.TarOptions{UIDMaps: d.uidMaps, GIDMaps: d.gidMaps})
+		pr.CloseWithError(err)
+		applied <- err
+	}()
+
+	ids := idtools.NewIDMappingsFromMaps(d.uidMaps, d.gidMaps)
+	size, kept, dirs, err := writeChanged(root, ids, diff, pw)
+	pw.CloseWithError(err)
+	if aerr := <-applied; err == nil {
+		err = aerr
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if err := removeExcluded(root, kept); err != nil {
+		return 0, err
+	}
+	// 删除文件会修改目录的时间，按diff中的记录恢复
+	for _, hdr := range dirs {
+		atime := hdr.AccessTime
+		if atime.Before(hdr.ModTime) {
+			atime = hdr.ModTime
+		}
+		if err := system.Chtimes(filepath.Join(root, hdr.Name), atime, hdr.ModTime); err != nil && !os.IsNotExist(err) {
+			return 0, err
+		}
+	}
+	logrus.Debugf("zfs: simplified layer %s from %s in %vs", id, source, time.Now().UTC().Sub(start).Seconds())
+
+	return size, nil
+}
+
+// writeChanged copies the entries of diff to w, leaving out regular files
+// root already holds unchanged and whiteouts. It returns the size of the
+// content of diff, the set of paths diff names together with their parent
+// directories, and the headers of the directories of diff.
+func writeChanged(root string, ids *idtools.IDMappings, diff io.Reader, w io.Writer) (int64, map[string]bool, []*tar.Header, error) {
+	var (
+		size int64
+		kept = map[string]bool{"/": true}
+		dirs []*tar.Header
+		tr   = tar.NewReader(diff)
+		tw   = tar.NewWriter(w)
+	)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, nil, nil, err
+		}
+		size += hdr.Size
+
+		name := filepath.Clean(string(os.PathSeparator) + hdr.Name)
+		if strings.HasPrefix(filepath.Base(name), archive.WhiteoutPrefix) {
+			continue
+		}
+		for p := name; !kept[p]; p = filepath.Dir(p) {
+			kept[p] = true
+		}
+		if hdr.Typeflag == tar.TypeDir {
+			dirs = append(dirs, hdr)
+		}
+		if hdr.Typeflag == tar.TypeGNUSparse {
+			hdr.Typeflag = tar.TypeReg
+		}
+		if hdr.Typeflag == tar.TypeReg && unchanged(filepath.Join(root, name), hdr, ids) {
+			continue
+		}
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			return 0, nil, nil, err
+		}
+		if _, err := io.Copy(tw, tr); err != nil {
+			return 0, nil, nil, err
+		}
+	}
+	return size, kept, dirs, tw.Close()
+}
+
+// unchanged reports whether path is the regular file hdr describes.
+func unchanged(path string, hdr *tar.Header, ids *idtools.IDMappings) bool {
+	fi, err := os.Lstat(path)
+	if err != nil || fi.Mode() != hdr.FileInfo().Mode() || fi.Size() != hdr.Size || fi.ModTime().Unix() != hdr.ModTime.Unix() {
+		return false
+	}
+	owner, err := ids.ToHost(idtools.IDPair{UID: hdr.Uid, GID: hdr.Gid})
+	if err != nil {
+		return false
+	}
+	stat, ok := fi.Sys().(*syscall.Stat_t)
+	return ok && int(stat.Uid) == owner.UID && int(stat.Gid) == owner.GID
+}
+
+// removeExcluded removes every path under root which is not kept.
+func removeExcluded(root string, kept map[string]bool) error {
+	return filepath.Walk(root, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		if kept[filepath.Clean(string(os.PathSeparator)+rel)] {
+			return nil
+		}
+		if err := os.RemoveAll(path); err != nil {
+			return err
+		}
+		if fi.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+}
+
+// hasDependentClones reports whether err is zfs refusing to destroy a
+// dataset because one of its snapshots has been cloned.
+func hasDependentClones(err error) bool {
+	zfsError, ok := err.(*zfs.Error)
+	return ok && strings.Contains(zfsError.Stderr, "dependent clones")
+}
+
+// promoteClone promotes one clone of a snapshot of the dataset name, which
+// takes the snapshot over from the dataset. It reports whether there was a
+// clone to promote.
+func promoteClone(name string) (bool, error) {
+	dataset := zfs.Dataset{Name: name}
+	snapshots, err := dataset.Snapshots()
+	if err != nil {
+		return false, err
+	}
+	for _, snapshot := range snapshots {
+		clones, err := snapshot.GetProperty("clones")
+		if err != nil {
+			return false, err
+		}
+		if clones == "" || clones == "-" {
+			continue
+		}
+		clone := strings.Split(clones, ",")[0]
+		if out, err := exec.Command("zfs", "promote", clone).CombinedOutput(); err != nil {
+			return false, errors.Wrapf(err, "zfs promote %s: %s", clone, strings.TrimSpace(string(out)))
+		}
+		return true, nil
+	}
+	return false, nil
+}
@@ -30,6 +30,9 @@ type zfsOptions struct {
 
 func init() {
 	graphdriver.Register("zfs", Init)
+	// 修改： zfs以克隆镜像层的方式支持simp挂载
+	graphdriver.RegisterSimplifyClone("zfs")
+	// 修改
 }
 
 // Logger returns a zfs logger implementation.
@@ -118,7 +121,9 @@ func Init(base string, opt []string, uidMaps, gidMaps []idtools.IDMap) (graphdri
 		gidMaps:          gidMaps,
 		ctr:              graphdriver.NewRefCounter(graphdriver.NewDefaultChecker()),
 	}
-	return graphdriver.NewNaiveDiffDriver(d, uidMaps, gidMaps), nil
+	// 修改： 精简镜像的层从完整镜像层克隆
+	return &simplifyDriver{Driver: graphdriver.NewNaiveDiffDriver(d, uidMaps, gidMaps), zfs: d}, nil
+	// 修改
 }
 
 func parseOptions(opt []string) (zfsOptions, error) {
@@ -348,6 +353,15 @@ func (d *Driver) Remove(id string) error {
 	name := d.zfsPath(id)
 	dataset := zfs.Dataset{Name: name}
 	err := dataset.Destroy(zfs.DestroyRecursive)
+	// 修改： 精简镜像的层是该层的克隆，先将克隆提升，使其不再依赖该层
+	for err != nil && hasDependentClones(err) {
+		promoted, perr := promoteClone(name)
+		if perr != nil || !promoted {
+			break
+		}
+		err = dataset.Destroy(zfs.DestroyRecursive)
+	}
+	// 修改
 	if err == nil {
 		d.Lock()
 		delete(d.filesystemsCache, name)
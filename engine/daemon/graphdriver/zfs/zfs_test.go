@@ -3,9 +3,15 @@
 package zfs // import "github.com/docker/docker/daemon/graphdriver/zfs"
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/docker/docker/daemon/graphdriver"
 	"github.com/docker/docker/daemon/graphdriver/graphtest"
+	"github.com/docker/docker/pkg/archive"
+	"gotest.tools/assert"
 )
 
 // This avoids creating a new driver for each test if all tests are run
@@ -30,6 +36,43 @@ func TestZfsSetQuota(t *testing.T) {
 	graphtest.DriverTestSetQuota(t, "zfs", true)
 }
 
+func TestZfsApplySimplified(t *testing.T) {
+	driver := graphtest.GetDriver(t, "zfs")
+	defer graphtest.PutDriver(t)
+
+	assert.NilError(t, driver.Create("Full", "", nil))
+	fs, err := driver.Get("Full", "")
+	assert.NilError(t, err)
+	for name, content := range map[string]string{"etc/profile": "profile", "bin/sh": "sh", "bin/ls": "ls"} {
+		assert.NilError(t, os.MkdirAll(filepath.Join(fs.Path(), filepath.Dir(name)), 0755))
+		assert.NilError(t, ioutil.WriteFile(filepath.Join(fs.Path(), name), []byte(content), 0755))
+	}
+	assert.NilError(t, driver.Put("Full"))
+
+	diff, err := archive.Generate("bin/sh", "simplified sh")
+	assert.NilError(t, err)
+	_, err = driver.(*graphtest.Driver).Driver.(graphdriver.SimplifyApplyDriver).ApplySimplifiedDiff("Simplified", "Full", diff)
+	assert.NilError(t, err)
+	defer func() {
+		assert.NilError(t, driver.Remove("Simplified"))
+	}()
+
+	// The full layer can go while its clone is still in use
+	assert.NilError(t, driver.Remove("Full"))
+
+	fs, err = driver.Get("Simplified", "")
+	assert.NilError(t, err)
+	defer driver.Put("Simplified")
+
+	content, err := ioutil.ReadFile(filepath.Join(fs.Path(), "bin/sh"))
+	assert.NilError(t, err)
+	assert.Equal(t, string(content), "simplified sh")
+	for _, name := range []string{"bin/ls", "etc"} {
+		_, err := os.Lstat(filepath.Join(fs.Path(), name))
+		assert.Assert(t, os.IsNotExist(err), name)
+	}
+}
+
 func TestZfsTeardown(t *testing.T) {
 	graphtest.PutDriver(t)
 }
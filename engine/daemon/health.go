@@ -187,6 +187,9 @@ func handleProbeResult(d *Daemon, c *container.Container, result *types.Healthch
 func monitor(d *Daemon, c *container.Container, stop chan struct{}, probe probe) {
 	probeTimeout := timeoutWithDefault(c.Config.Healthcheck.Timeout, defaultProbeTimeout)
 	probeInterval := timeoutWithDefault(c.Config.Healthcheck.Interval, defaultProbeInterval)
+	// 修改： 健康检查的命令被精简时在第一次探测前拉取
+	d.prepareSimplifiedHealthcheck(c)
+	// 修改
 	for {
 		select {
 		case <-stop:
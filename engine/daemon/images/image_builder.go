@@ -158,7 +158,10 @@ func (i *ImageService) pullForBuilder(ctx context.Context, name string, authConf
 		pullRegistryAuth = &resolvedConfig
 	}
 
-	if err := i.pullImageWithReference(ctx, ref, platform, nil, pullRegistryAuth, output); err != nil {
+	// 修改： 构建时拉取完整镜像
+	err = i.pullImageWithReference(ctx, ref, platform, nil, pullRegistryAuth, output, nil)
+	// 修改
+	if err != nil {
 		return nil, err
 	}
 	return i.GetImage(name)
@@ -2,7 +2,6 @@ package images // import "github.com/docker/docker/daemon/images"
 
 import (
 	"encoding/json"
-	"fmt"
 	"io"
 
 	"github.com/docker/docker/api/types/backend"
@@ -18,12 +17,6 @@ import (
 func (i *ImageService) CommitImage(c backend.CommitConfig, simp bool) (image.ID, error) {
 	// 修改
 
-	// 修改： 添加输出
-	fmt.Println("*\n*\n*\nsimp: ")
-	fmt.Println(simp)
-	fmt.Println("\n*\n*\n*")
-	// 修改
-
 	layerStore, ok := i.layerStores[c.ContainerOS]
 	if !ok {
 		return "", system.ErrNotSupportedOperatingSystem
@@ -39,6 +32,14 @@ func (i *ImageService) CommitImage(c backend.CommitConfig, simp bool) (image.ID,
 		}
 	}()
 
+	// 修改： 从精简镜像启动的容器，按需拉取的文件不在读写层中，需要一并提交
+	if !simp {
+		rwTar = i.mergeSimplifyCache(rwTar, image.ID(c.ParentImageID))
+	} else if rwTar, err = i.selectSimplified(rwTar, c); err != nil {
+		return "", err
+	}
+	// 修改
+
 	var parent *image.Image
 	// 获取c的父镜像层ID
 	// 修改： 增加对simp的判断
@@ -54,7 +55,18 @@ func (i *ImageService) CommitImage(c backend.CommitConfig, simp bool) (image.ID,
 	}
 
 	// 向layerStore注册读写层压缩包以及父镜像层的根目录
-	l, err := layerStore.Register(rwTar, parent.RootFS.ChainID())
+	// 修改： 精简镜像的层可以由完整镜像的层构建
+	var l layer.Layer
+	if simp && c.ParentImageID != "" {
+		var full *image.Image
+		if full, err = i.imageStore.Get(image.ID(c.ParentImageID)); err != nil {
+			return "", err
+		}
+		l, err = registerSimplified(layerStore, rwTar, full.RootFS.ChainID())
+	} else {
+		l, err = layerStore.Register(rwTar, parent.RootFS.ChainID())
+	}
+	// 修改
 	if err != nil {
 		return "", err
 	}
@@ -85,6 +97,45 @@ func (i *ImageService) CommitImage(c backend.CommitConfig, simp bool) (image.ID,
 			return "", err
 		}
 	}
+
+	// 修改： 记录精简镜像信息
+	if simp {
+		info := &image.SimplifyInfo{Source: image.SimplifySourceCommit, Parent: image.ID(c.ParentImageID)}
+		p, err := i.commitProfile(c)
+		if err != nil {
+			return "", err
+		}
+		if p != nil {
+			info.Profile = c.ParentImageID
+			if c.SimplifyProfile != nil {
+				// 保存提交时指定的profile，不替换完整镜像的profile
+				if err := i.simplifyProfiles.Put(id.Digest(), p); err != nil {
+					return "", err
+				}
+				info.Profile = id.String()
+			}
+			if info.Threshold, err = i.simplifyThreshold(image.ID(c.ParentImageID), c.SimplifyThreshold); err != nil {
+				return "", err
+			}
+		}
+		if c.ParentImageID != "" {
+			// 记录完整镜像的层，完整镜像被删除后仍可从registry按需拉取
+			full, err := i.imageStore.Get(image.ID(c.ParentImageID))
+			if err != nil {
+				return "", err
+			}
+			info.Layers = full.RootFS.DiffIDs
+			if info.FullSize, err = i.chainSize(layerStore, full.RootFS.ChainID()); err != nil {
+				return "", err
+			}
+			// 为完整镜像的层生成tar目录，按需拉取时只读取需要的条目
+			i.indexLayers(layerStore, info.Layers)
+		}
+		if err := i.imageStore.SetSimplifyInfo(id, info); err != nil {
+			return "", err
+		}
+	}
+	// 修改
 	return id, nil
 }
 
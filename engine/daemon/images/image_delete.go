@@ -129,6 +129,11 @@ func (i *ImageService) ImageDelete(imageRef string, force, prune bool) ([]types.
 				var remainingRefs []reference.Named
 				for _, repoRef := range repoRefs {
 					if _, repoRefIsCanonical := repoRef.(reference.Canonical); repoRefIsCanonical && parsedRef.Name() == repoRef.Name() {
+						// 修改： 精简镜像与完整镜像的另一个变体保留digest引用
+						if i.moveDigestToVariant(imgID, repoRef) {
+							continue
+						}
+						// 修改
 						if _, err := i.removeImageRef(repoRef); err != nil {
 							return records, err
 						}
@@ -164,6 +169,11 @@ func (i *ImageService) ImageDelete(imageRef string, force, prune bool) ([]types.
 			}
 
 			for _, repoRef := range repoRefs {
+				// 修改： 精简镜像与完整镜像的另一个变体保留digest引用
+				if i.moveDigestToVariant(imgID, repoRef) {
+					continue
+				}
+				// 修改
 				parsedRef, err := i.removeImageRef(repoRef)
 				if err != nil {
 					return nil, err
@@ -250,6 +260,11 @@ func (i *ImageService) removeAllReferencesToImageID(imgID image.ID, records *[]t
 	imageRefs := i.referenceStore.References(imgID.Digest())
 
 	for _, imageRef := range imageRefs {
+		// 修改： 精简镜像与完整镜像的另一个变体保留digest引用
+		if i.moveDigestToVariant(imgID, imageRef) {
+			continue
+		}
+		// 修改
 		parsedRef, err := i.removeImageRef(imageRef)
 		if err != nil {
 			return err
@@ -327,10 +342,20 @@ func (i *ImageService) imageDeleteHelper(imgID image.ID, records *[]types.ImageD
 		return err
 	}
 
+	// 修改： 删除镜像后清理其精简相关的数据
+	simplifyInfo, err := i.imageStore.GetSimplifyInfo(imgID)
+	if err != nil {
+		return err
+	}
+	// 修改
+
 	removedLayers, err := i.imageStore.Delete(imgID)
 	if err != nil {
 		return err
 	}
+	// 修改
+	i.removeSimplifyState(imgID, simplifyInfo, removedLayers)
+	// 修改
 
 	i.LogImageEvent(imgID.String(), imgID.String(), "delete")
 	*records = append(*records, types.ImageDeleteResponseItem{Deleted: imgID.String()})
@@ -0,0 +1,203 @@
+package images // import "github.com/docker/docker/daemon/images"
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/dockerversion"
+	"github.com/docker/docker/errdefs"
+	"github.com/docker/docker/image"
+	"github.com/docker/docker/layer"
+	"github.com/docker/docker/pkg/progress"
+	"github.com/docker/docker/pkg/streamformatter"
+	"github.com/docker/docker/pkg/stringid"
+	"github.com/docker/docker/pkg/system"
+	"github.com/pkg/errors"
+)
+
+// 修改： 从精简镜像恢复完整镜像
+
+// DesimplifyImage creates a full image from the simplified image name, made
+// of the layers of the full image it was derived from. Layers missing from
+// the layer store are downloaded from the registry they were pulled from.
+// The layers of a simplified commit are added on top, so that the changes of
+// the committed container are kept. The new image is tagged repository:tag
+// if repository is set. Progress is written to outStream.
+func (i *ImageService) DesimplifyImage(ctx context.Context, name, repository, tag string, outStream io.Writer) error {
+	newRef, err := targetReference(repository, tag)
+	if err != nil {
+		return err
+	}
+	img, err := i.GetImage(name)
+	if err != nil {
+		return err
+	}
+	info, err := i.imageStore.GetSimplifyInfo(img.ID())
+	if err != nil {
+		return err
+	}
+	if info == nil || info.Parent == "" && len(info.Layers) == 0 {
+		// 拉取时精简的镜像内容完整
+		return errdefs.InvalidParameter(errors.Errorf("image %s is not a simplified image", name))
+	}
+
+	output := streamformatter.NewJSONProgressOutput(outStream, false)
+	restored, err := i.restoreFull(ctx, name, img, info, time.Now().UTC(), output)
+	if err != nil {
+		return err
+	}
+	defer restored.release()
+	id, err := i.imageStore.Create(restored.image.RawJSON())
+	if err != nil {
+		return err
+	}
+	if newRef != nil {
+		if err := i.TagImageWithReference(id, newRef); err != nil {
+			return err
+		}
+	}
+
+	progress.Messagef(output, "", "Restored %d layers, downloaded %d", restored.fullLayers, len(restored.downloaded))
+	progress.Aux(output, types.ImageDesimplifyResult{ID: id.String(), Downloaded: restored.downloaded})
+	return nil
+}
+
+// restoredImage is a full image restored from a simplified image, whose
+// layers are held in the layer store until released.
+type restoredImage struct {
+	image *image.Image
+	// fullLayers is the number of layers of the full image
+	fullLayers int
+	// downloaded are the diff IDs of the layers downloaded
+	downloaded []string
+	release    func()
+}
+
+// restoreFull restores the full image of the simplified image img, named
+// name, as created at created. Progress is written to output.
+func (i *ImageService) restoreFull(ctx context.Context, name string, img *image.Image, info *image.SimplifyInfo, created time.Time, output progress.Output) (_ *restoredImage, retErr error) {
+	layerStore, ok := i.layerStores[img.OperatingSystem()]
+	if !ok {
+		return nil, system.ErrNotSupportedOperatingSystem
+	}
+
+	var full *image.Image
+	if info.Parent != "" {
+		// 完整镜像被删除后只能从registry恢复
+		full, _ = i.imageStore.Get(info.Parent)
+	}
+	diffIDs := info.Layers
+	if len(diffIDs) == 0 {
+		if full == nil {
+			return nil, errdefs.NotFound(errors.Errorf("full image %s of %s no longer exists", info.Parent, name))
+		}
+		diffIDs = full.RootFS.DiffIDs
+	}
+
+	var (
+		layers     []layer.Layer
+		downloaded []string
+	)
+	release := func() {
+		for _, l := range layers {
+			layer.ReleaseAndLog(layerStore, l)
+		}
+	}
+	defer func() {
+		if retErr != nil {
+			release()
+		}
+	}()
+	rootFS := image.NewRootFS()
+	for _, diffID := range diffIDs {
+		parent := rootFS.ChainID()
+		rootFS.Append(diffID)
+		id := stringid.TruncateID(diffID.String())
+		if l, err := layerStore.Get(rootFS.ChainID()); err == nil {
+			layers = append(layers, l)
+			progress.Update(output, id, "Already exists")
+			continue
+		}
+		rc, err := i.openRemoteLayer(ctx, diffID)
+		if err != nil {
+			return nil, errdefs.Unavailable(errors.Wrapf(err, "layer %s of the full image is unreachable", diffID))
+		}
+		l, err := layerStore.Register(progress.NewProgressReader(rc, output, 0, id, "Downloading"), parent)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, l)
+		if l.DiffID() != diffID {
+			return nil, errors.Errorf("downloaded layer %s has diff ID %s", diffID, l.DiffID())
+		}
+		progress.Update(output, id, "Downloaded")
+		downloaded = append(downloaded, diffID.String())
+	}
+
+	history := make([]image.History, 0, len(diffIDs))
+	if full != nil {
+		history = append(history, full.History...)
+	} else {
+		for range diffIDs {
+			history = append(history, image.History{Created: created, Comment: "Restored from " + name})
+		}
+	}
+	if info.Source == image.SimplifySourceCommit {
+		// 提交的精简层包含容器的修改，叠加在完整镜像之上
+		for n, diffID := range img.RootFS.DiffIDs {
+			l, err := i.restackLayer(layerStore, rootFS.ChainID(), layer.CreateChainID(img.RootFS.DiffIDs[:n+1]))
+			if err != nil {
+				return nil, err
+			}
+			layers = append(layers, l)
+			rootFS.Append(diffID)
+		}
+		history = append(history, img.History...)
+	}
+
+	config, err := json.Marshal(&image.Image{
+		V1Image: image.V1Image{
+			DockerVersion: dockerversion.Version,
+			Config:        img.Config,
+			Architecture:  img.Architecture,
+			OS:            img.OperatingSystem(),
+			Created:       created,
+			Author:        img.Author,
+			Comment:       "Restored from " + name,
+		},
+		RootFS:     rootFS,
+		History:    history,
+		OSFeatures: img.OSFeatures,
+		OSVersion:  img.OSVersion,
+	})
+	if err != nil {
+		return nil, err
+	}
+	restored, err := image.NewFromJSON(config)
+	if err != nil {
+		return nil, err
+	}
+	return &restoredImage{image: restored, fullLayers: len(diffIDs), downloaded: downloaded, release: release}, nil
+}
+
+// restackLayer registers the top layer of the chain chainID of the simplified
+// image on top of the layer chain parent. The layer keeps its diff ID.
+func (i *ImageService) restackLayer(layerStore layer.Store, parent, chainID layer.ChainID) (layer.Layer, error) {
+	src, err := layerStore.Get(chainID)
+	if err != nil {
+		return nil, err
+	}
+	defer layer.ReleaseAndLog(layerStore, src)
+	rc, err := src.TarStream()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return layerStore.Register(rc, parent)
+}
+
+// 修改
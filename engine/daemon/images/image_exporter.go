@@ -3,6 +3,7 @@ package images // import "github.com/docker/docker/daemon/images"
 import (
 	"io"
 
+	"github.com/docker/docker/api/types/backend"
 	"github.com/docker/docker/image/tarexport"
 )
 
@@ -11,8 +12,10 @@ import (
 // stream. All images with the given tag and all versions containing
 // the same tag are exported. names is the set of tags to export, and
 // outStream is the writer which the images are written to.
-func (i *ImageService) ExportImage(names []string, outStream io.Writer) error {
-	imageExporter := tarexport.NewTarExporter(i.imageStore, i.layerStores, i.referenceStore, i)
+// 修改： 精简镜像保存为恢复的完整镜像，或保存为精简归档
+func (i *ImageService) ExportImage(names []string, outStream io.Writer, simpCfg backend.ImageSaveSimplifyConfig) error {
+	imageExporter := tarexport.NewSimplifyTarExporter(i.imageStore, i.layerStores, i.referenceStore, i, i, simpCfg.Simplified)
+	// 修改
 	return imageExporter.Save(names, outStream)
 }
 
@@ -20,6 +23,8 @@ func (i *ImageService) ExportImage(names []string, outStream io.Writer) error {
 // complement of ImageExport.  The input stream is an uncompressed tar
 // ball containing images and metadata.
 func (i *ImageService) LoadImage(inTar io.ReadCloser, outStream io.Writer, quiet bool) error {
-	imageExporter := tarexport.NewTarExporter(i.imageStore, i.layerStores, i.referenceStore, i)
+	// 修改： 加载精简归档中的精简镜像
+	imageExporter := tarexport.NewSimplifyTarExporter(i.imageStore, i.layerStores, i.referenceStore, i, i, false)
+	// 修改
 	return imageExporter.Load(inTar, outStream, quiet)
 }
@@ -25,8 +25,18 @@ func (i *ImageService) ImageHistory(name string) ([]*image.HistoryResponseItem,
 	rootFS := *img.RootFS
 	rootFS.DiffIDs = nil
 
+	// 修改： 标出被精简改写的层
+	simplified, err := i.simplifiedLayers(img)
+	if err != nil {
+		return nil, err
+	}
+	// 修改
+
 	for _, h := range img.History {
 		var layerSize int64
+		// 修改
+		var annotation simplifiedLayer
+		// 修改
 
 		if !h.EmptyLayer {
 			if len(img.RootFS.DiffIDs) <= layerCounter {
@@ -46,6 +56,12 @@ func (i *ImageService) ImageHistory(name string) ([]*image.HistoryResponseItem,
 				return nil, err
 			}
 
+			// 修改
+			if simplified != nil {
+				annotation = simplified[layerCounter]
+			}
+			// 修改
+
 			layerCounter++
 		}
 
@@ -55,6 +71,10 @@ func (i *ImageService) ImageHistory(name string) ([]*image.HistoryResponseItem,
 			CreatedBy: h.CreatedBy,
 			Comment:   h.Comment,
 			Size:      layerSize,
+			// 修改
+			Simplified: annotation.rewritten,
+			FullSize:   annotation.fullSize,
+			// 修改
 		}}, history...)
 	}
 
@@ -63,6 +63,13 @@ func (i *ImageService) LookupImage(name string) (*types.ImageInspect, error) {
 		return nil, err
 	}
 
+	// 修改： 添加精简镜像信息
+	simplified, err := i.simplifiedInspect(img.ID(), size)
+	if err != nil {
+		return nil, err
+	}
+	// 修改
+
 	imageInspect := &types.ImageInspect{
 		ID:              img.ID().String(),
 		RepoTags:        repoTags,
@@ -84,6 +91,7 @@ func (i *ImageService) LookupImage(name string) (*types.ImageInspect, error) {
 		Metadata: types.ImageMetadata{
 			LastTagTime: lastUpdated,
 		},
+		Simplified: simplified,
 	}
 
 	imageInspect.GraphDriver.Name = i.layerStores[img.OperatingSystem()].DriverName()
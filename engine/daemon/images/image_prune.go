@@ -23,6 +23,9 @@ var imagesAcceptedFilters = map[string]bool{
 	"label":    true,
 	"label!":   true,
 	"until":    true,
+	// 修改： 按是否为精简镜像过滤
+	"simplified": true,
+	// 修改
 }
 
 // errPruneRunning is returned when a prune request is received while
@@ -58,6 +61,19 @@ func (i *ImageService) ImagesPrune(ctx context.Context, pruneFilters filters.Arg
 		return nil, err
 	}
 
+	// 修改： simplified=true只清理精简镜像，simplified=false只清理其余镜像
+	var simplified *bool
+	if pruneFilters.Contains("simplified") {
+		var b bool
+		if pruneFilters.ExactMatch("simplified", "true") || pruneFilters.ExactMatch("simplified", "1") {
+			b = true
+		} else if !pruneFilters.ExactMatch("simplified", "false") && !pruneFilters.ExactMatch("simplified", "0") {
+			return nil, invalidFilter{"simplified", pruneFilters.Get("simplified")}
+		}
+		simplified = &b
+	}
+	// 修改
+
 	var allImages map[image.ID]*image.Image
 	if danglingOnly {
 		allImages = i.imageStore.Heads()
@@ -88,6 +104,17 @@ func (i *ImageService) ImagesPrune(ctx context.Context, pruneFilters filters.Arg
 			if img.Config != nil && !matchLabels(pruneFilters, img.Config.Labels) {
 				continue
 			}
+			// 修改
+			if simplified != nil {
+				info, err := i.imageStore.GetSimplifyInfo(id)
+				if err != nil {
+					return nil, err
+				}
+				if (info != nil) != *simplified {
+					continue
+				}
+			}
+			// 修改
 			topImages[id] = img
 		}
 	}
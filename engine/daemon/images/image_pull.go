@@ -3,12 +3,15 @@ package images // import "github.com/docker/docker/daemon/images"
 import (
 	"context"
 	"io"
+	"runtime"
 	"strings"
 	"time"
 
 	dist "github.com/docker/distribution"
 	"github.com/docker/distribution/reference"
 	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/backend"
+	"github.com/docker/docker/daemon/simplify"
 	"github.com/docker/docker/distribution"
 	progressutils "github.com/docker/docker/distribution/utils"
 	"github.com/docker/docker/errdefs"
@@ -16,12 +19,23 @@ import (
 	"github.com/docker/docker/registry"
 	"github.com/opencontainers/go-digest"
 	specs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
 )
 
 // PullImage initiates a pull operation. image is the repository name to pull, and
 // tag may be either empty, or indicate a specific tag to pull.
-func (i *ImageService) PullImage(ctx context.Context, image, tag string, platform *specs.Platform, metaHeaders map[string][]string, authConfig *types.AuthConfig, outStream io.Writer) error {
+// 修改： 添加simpCfg参数
+func (i *ImageService) PullImage(ctx context.Context, image, tag string, platform *specs.Platform, metaHeaders map[string][]string, authConfig *types.AuthConfig, outStream io.Writer, simpCfg backend.ImagePullSimplifyConfig) error {
+	// 修改
 	start := time.Now()
+	// 修改： Windows不支持精简镜像，检查精简阈值
+	if runtime.GOOS == "windows" && simpCfg.SimplifyImage {
+		return errdefs.NotImplemented(simplify.ErrWindowsNotSupported)
+	}
+	if err := simplify.ValidateThreshold(simpCfg.SimplifyThreshold); err != nil {
+		return errdefs.InvalidParameter(err)
+	}
+	// 修改
 	// Special case: "pull -a" may send an image name with a
 	// trailing :. This is ugly, but let's not break API
 	// compatibility.
@@ -46,12 +60,80 @@ func (i *ImageService) PullImage(ctx context.Context, image, tag string, platfor
 		}
 	}
 
-	err = i.pullImageWithReference(ctx, ref, platform, metaHeaders, authConfig, outStream)
+	// 修改： 客户端验证签名的摘要必须是拉取的摘要
+	if simpCfg.SimplifySignedDigest != "" {
+		if digested, ok := ref.(reference.Canonical); !ok || digested.Digest().String() != simpCfg.SimplifySignedDigest {
+			return errdefs.InvalidParameter(errors.Errorf("simplify-signed-digest %s is not the digest %s is pulled by", simpCfg.SimplifySignedDigest, reference.FamiliarString(ref)))
+		}
+	}
+	// 修改
+	// 修改： 精简拉取时只下载需要的文件
+	simpCfg.SimplifyImage, err = i.simplifyPull(ref, simpCfg)
+	if err != nil {
+		return err
+	}
+	var pullSimplify *distribution.PullSimplify
+	if simpCfg.SimplifyImage {
+		if simpCfg.SimplifyProfile == nil && simpCfg.SimplifyProfileFrom != "" {
+			// 指定镜像的profile本来就是为其他镜像记录的，不检查镜像和平台
+			profile, err := i.ImageProfile(simpCfg.SimplifyProfileFrom)
+			if err != nil {
+				return err
+			}
+			profile.Image, profile.Platform = "", ""
+			simpCfg.SimplifyProfile = profile
+		}
+		if simpCfg.SimplifyProfile != nil {
+			// 拉取前检查指定的profile
+			if _, err := i.profileFromAPI(*simpCfg.SimplifyProfile); err != nil {
+				return err
+			}
+		}
+		pullSimplify = i.pullSimplify(simpCfg)
+	}
+	err = i.pullImageWithReference(ctx, ref, platform, metaHeaders, authConfig, outStream, pullSimplify)
+	// 修改
+	// 修改： 拉取成功后记录精简镜像信息
+	if err == nil && simpCfg.SimplifyImage {
+		err = i.markPulledSimplified(ref, simpCfg)
+		// 缺失的文件以拉取时的凭据按需拉取
+		i.simplifyRemotes.setAuth(ref, authConfig)
+	}
+	// 修改
 	imageActions.WithValues("pull").UpdateSince(start)
 	return err
 }
 
-func (i *ImageService) pullImageWithReference(ctx context.Context, ref reference.Named, platform *specs.Platform, metaHeaders map[string][]string, authConfig *types.AuthConfig, outStream io.Writer) error {
+// 修改： 按daemon配置决定是否精简拉取
+
+// simplifyPull returns whether the pull of ref is simplified: as requested,
+// or else as the daemon is configured to. Only the images of the registries
+// simplification is restricted to, if any, are simplified.
+func (i *ImageService) simplifyPull(ref reference.Named, simpCfg backend.ImagePullSimplifyConfig) (bool, error) {
+	i.simplifyConfigMu.Lock()
+	imageDefault, registries := i.simplifyDefault, i.simplifyRegistries
+	i.simplifyConfigMu.Unlock()
+
+	domain := reference.Domain(ref)
+	enabled := len(registries) == 0
+	for _, r := range registries {
+		if r == domain {
+			enabled = true
+			break
+		}
+	}
+	if !simpCfg.SimplifyDefault {
+		if simpCfg.SimplifyImage && !enabled {
+			return false, errdefs.Forbidden(errors.Errorf("simplification is not enabled for images from %s", domain))
+		}
+		return simpCfg.SimplifyImage, nil
+	}
+	return imageDefault && enabled, nil
+}
+
+// 修改： 添加pullSimplify参数，选择精简拉取时下载的文件
+func (i *ImageService) pullImageWithReference(ctx context.Context, ref reference.Named, platform *specs.Platform, metaHeaders map[string][]string, authConfig *types.AuthConfig, outStream io.Writer, pullSimplify *distribution.PullSimplify) error {
+	// 修改
 	// Include a buffer so that slow client connections don't affect
 	// transfer performance.
 	progressChan := make(chan progress.Progress, 100)
@@ -65,13 +147,22 @@ func (i *ImageService) pullImageWithReference(ctx context.Context, ref reference
 		close(writesDone)
 	}()
 
+	// 修改： 精简拉取的pull事件带有simplified属性
+	eventLogger := i.LogImageEvent
+	if pullSimplify != nil {
+		eventLogger = func(id, name, action string) {
+			i.LogImageEventWithAttributes(id, name, action, map[string]string{"simplified": "true"})
+		}
+	}
+	// 修改
+
 	imagePullConfig := &distribution.ImagePullConfig{
 		Config: distribution.Config{
 			MetaHeaders:      metaHeaders,
 			AuthConfig:       authConfig,
 			ProgressOutput:   progress.ChanOutput(progressChan),
 			RegistryService:  i.registryService,
-			ImageEventLogger: i.LogImageEvent,
+			ImageEventLogger: eventLogger,
 			MetadataStore:    i.distributionMetadataStore,
 			ImageStore:       distribution.NewImageConfigStoreFromStore(i.imageStore),
 			ReferenceStore:   i.referenceStore,
@@ -79,6 +170,11 @@ func (i *ImageService) pullImageWithReference(ctx context.Context, ref reference
 		DownloadManager: i.downloadManager,
 		Schema2Types:    distribution.ImageTypes,
 		Platform:        platform,
+		// 修改： 记录拉取的精简镜像
+		SimplifyAnnotations: i.markRegistrySimplified,
+		Simplify:            pullSimplify,
+		SimplifyVariants:    i.simplifyVariants,
+		// 修改
 	}
 
 	err := distribution.Pull(ctx, ref, imagePullConfig)
@@ -8,13 +8,16 @@ import (
 	"github.com/docker/distribution/manifest/schema2"
 	"github.com/docker/distribution/reference"
 	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/backend"
 	"github.com/docker/docker/distribution"
 	progressutils "github.com/docker/docker/distribution/utils"
 	"github.com/docker/docker/pkg/progress"
 )
 
 // PushImage initiates a push operation on the repository named localName.
-func (i *ImageService) PushImage(ctx context.Context, image, tag string, metaHeaders map[string][]string, authConfig *types.AuthConfig, outStream io.Writer) error {
+// 修改： 添加simpCfg参数，推送精简镜像的profile和可按文件下载的层
+func (i *ImageService) PushImage(ctx context.Context, image, tag string, metaHeaders map[string][]string, authConfig *types.AuthConfig, outStream io.Writer, simpCfg backend.ImagePushSimplifyConfig) error {
+	// 修改
 	start := time.Now()
 	ref, err := reference.ParseNormalizedNamed(image)
 	if err != nil {
@@ -56,6 +59,11 @@ func (i *ImageService) PushImage(ctx context.Context, image, tag string, metaHea
 		LayerStores:     distribution.NewLayerProvidersFromStores(i.layerStores),
 		TrustKey:        i.trustKey,
 		UploadManager:   i.uploadManager,
+		// 修改： 推送精简镜像
+		Simplified:          i.simplifyPush,
+		PushSimplifyProfile: simpCfg.SimplifyProfile,
+		PushSimplifyTOC:     simpCfg.SimplifyTOC,
+		// 修改
 	}
 
 	err = distribution.Push(ctx, ref, imagePushConfig)
@@ -0,0 +1,610 @@
+package images // import "github.com/docker/docker/daemon/images"
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+
+	"github.com/docker/distribution/reference"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/backend"
+	"github.com/docker/docker/daemon/simplify"
+	"github.com/docker/docker/distribution"
+	"github.com/docker/docker/errdefs"
+	"github.com/docker/docker/image"
+	"github.com/docker/docker/layer"
+	"github.com/docker/docker/pkg/system"
+	"github.com/opencontainers/go-digest"
+	specs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/sirupsen/logrus"
+)
+
+// 修改： 添加精简镜像信息的查询与记录
+
+// SimplifyInfo returns the simplification data recorded for the image, or nil
+// if the image was neither pulled nor committed with simplification enabled.
+func (i *ImageService) SimplifyInfo(id image.ID) (*image.SimplifyInfo, error) {
+	return i.imageStore.GetSimplifyInfo(id)
+}
+
+// markPulledSimplified records simplification data for the images ref resolves
+// to after a pull, along with the profile stored for them, or the one given
+// along with the pull. A name-only ref, as used by "pull -a", marks every tag.
+func (i *ImageService) markPulledSimplified(ref reference.Named, simpCfg backend.ImagePullSimplifyConfig) error {
+	var ids []digest.Digest
+	if reference.IsNameOnly(ref) {
+		for _, assoc := range i.referenceStore.ReferencesByName(ref) {
+			ids = append(ids, assoc.ID)
+		}
+	} else {
+		id, err := i.referenceStore.Get(ref)
+		if err != nil {
+			return err
+		}
+		ids = append(ids, id)
+	}
+	for _, id := range ids {
+		old, err := i.imageStore.GetSimplifyInfo(image.IDFromDigest(id))
+		if err != nil {
+			return err
+		}
+		if old != nil && old.Source == image.SimplifySourceRegistry && old.Annotations[distribution.AnnotationSimplified] == "true" {
+			// 镜像本身是推送的精简镜像，内容不完整，只记录签名的摘要
+			if simpCfg.SimplifySignedDigest == "" {
+				continue
+			}
+			old.Signed = digest.Digest(simpCfg.SimplifySignedDigest)
+			if err := i.imageStore.SetSimplifyInfo(image.IDFromDigest(id), old); err != nil {
+				return err
+			}
+			continue
+		}
+		info := &image.SimplifyInfo{Source: image.SimplifySourcePull, Threshold: simpCfg.SimplifyThreshold, Signed: digest.Digest(simpCfg.SimplifySignedDigest)}
+		if old != nil {
+			info.Annotations = old.Annotations
+			if old.Source == image.SimplifySourcePull {
+				// 只拉取了部分文件的镜像
+				info.Layers, info.FullSize = old.Layers, old.FullSize
+				info.Full, info.Reference = old.Full, old.Reference
+			}
+		}
+		if info.Full != "" {
+			// 记录完整镜像的digest引用，tag指向另一个变体后仍可列出
+			if r := i.variantReference(ref, image.IDFromDigest(id), info.Full); r != "" {
+				info.Reference = r
+			}
+		}
+		if simpCfg.SimplifyProfile != nil && len(info.Layers) == 0 {
+			// 完整拉取的镜像保存指定的profile，部分拉取时已保存
+			p, err := i.suppliedProfile(simpCfg.SimplifyProfile, id, i.imagePlatform(image.IDFromDigest(id)), simpCfg.SimplifyForce)
+			if err != nil {
+				return err
+			}
+			if err := i.simplifyProfiles.Put(id, p); err != nil {
+				return err
+			}
+		}
+		if i.simplifyProfile(image.IDFromDigest(id)) != nil {
+			info.Profile = id.String()
+		}
+		if err := i.imageStore.SetSimplifyInfo(image.IDFromDigest(id), info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// variantReference returns the canonical reference, in the repository of
+// ref, of the manifest the image id simplified from the image full was
+// pulled by. The digest reference points at whichever of the two was pulled
+// by it last.
+func (i *ImageService) variantReference(ref reference.Named, id, full image.ID) string {
+	for _, dgst := range []digest.Digest{id.Digest(), full.Digest()} {
+		for _, r := range i.referenceStore.References(dgst) {
+			if _, ok := r.(reference.Canonical); ok && r.Name() == ref.Name() {
+				return r.String()
+			}
+		}
+	}
+	return ""
+}
+
+// markRegistrySimplified records the simplify annotations of the manifest
+// the image id was pulled by.
+func (i *ImageService) markRegistrySimplified(id digest.Digest, annotations map[string]string) error {
+	info, err := i.imageStore.GetSimplifyInfo(image.IDFromDigest(id))
+	if err != nil {
+		return err
+	}
+	if info == nil {
+		info = &image.SimplifyInfo{Source: image.SimplifySourceRegistry}
+	}
+	info.Annotations = annotations
+	return i.imageStore.SetSimplifyInfo(image.IDFromDigest(id), info)
+}
+
+// pullSimplify returns the selection of the files pulled from images with
+// seekable layers: the files their profile keeps at the threshold of
+// simpCfg. The profile given along with the pull is used, or else the one
+// stored for the image on the platform pulled, or else the one pushed along
+// with it.
+func (i *ImageService) pullSimplify(simpCfg backend.ImagePullSimplifyConfig) *distribution.PullSimplify {
+	threshold := simpCfg.SimplifyThreshold
+	profileOf := func(full digest.Digest, platform string, pushed []byte) (*simplify.Profile, error) {
+		if simpCfg.SimplifyProfile != nil {
+			return i.suppliedProfile(simpCfg.SimplifyProfile, full, platform, simpCfg.SimplifyForce)
+		}
+		p, recorded, err := i.simplifyProfiles.Lookup(full, platform)
+		if err == nil {
+			return p, nil
+		}
+		if !os.IsNotExist(err) {
+			logrus.WithError(err).WithField("image", full).Warn("failed to read simplify profile")
+		}
+		if pushed != nil {
+			p, err := i.parseProfile(pushed)
+			switch {
+			case err != nil:
+				return nil, err
+			case p.Platform == "" || platform == "" || p.Platform == platform:
+				return p, nil
+			default:
+				recorded = append(recorded, p.Platform)
+			}
+		}
+		if len(recorded) > 0 {
+			// 只有其他平台的profile，文件路径可能不同
+			return nil, distribution.ProfilePlatformError{Platform: platform, Recorded: recorded}
+		}
+		return nil, nil
+	}
+	return &distribution.PullSimplify{
+		Keep: func(full digest.Digest, platform specs.Platform, pushed []byte) ([]string, error) {
+			p, err := profileOf(full, simplify.FormatPlatform(platform.OS, platform.Architecture), pushed)
+			if p == nil {
+				return nil, err
+			}
+			keep, _ := p.Split(threshold)
+			if keep == nil {
+				keep = []string{}
+			}
+			return keep, nil
+		},
+		Pulled: func(id, full digest.Digest, layers []layer.DiffID, tocs []*layer.TOC, pushed []byte) error {
+			info := &image.SimplifyInfo{Source: image.SimplifySourcePull, Full: image.IDFromDigest(full), Layers: layers, Threshold: threshold}
+			for n, toc := range tocs {
+				// 按需拉取缺少的文件时使用层的目录
+				if err := i.simplifyTOCs.Put(layers[n], toc); err != nil {
+					return err
+				}
+				info.FullSize += toc.FileSize()
+			}
+			p, err := profileOf(full, i.imagePlatform(image.IDFromDigest(id)), pushed)
+			if err != nil {
+				return err
+			}
+			if p != nil {
+				stored := *p
+				if err := i.simplifyProfiles.Put(id, &stored); err != nil {
+					return err
+				}
+				info.Profile = id.String()
+			}
+			return i.imageStore.SetSimplifyInfo(image.IDFromDigest(id), info)
+		},
+		Required:       simpCfg.SimplifyRequired,
+		Trusted:        simpCfg.SimplifyTrusted,
+		SignedProfile:  digest.Digest(simpCfg.SimplifySignedProfile),
+		MaxProfileSize: i.maxProfileSize(),
+		RangeRoot:      i.simplifyRangeRoot,
+		OpenLayer: func(operatingSystem string, diffIDs []layer.DiffID) (io.ReadCloser, error) {
+			layerStore, ok := i.layerStores[operatingSystem]
+			if !ok {
+				return nil, system.ErrNotSupportedOperatingSystem
+			}
+			l, err := layerStore.Get(layer.CreateChainID(diffIDs))
+			if err != nil {
+				return nil, err
+			}
+			rc, err := l.TarStream()
+			if err != nil {
+				layer.ReleaseAndLog(layerStore, l)
+				return nil, err
+			}
+			return &releaseReadCloser{ReadCloser: rc, release: func() { layer.ReleaseAndLog(layerStore, l) }}, nil
+		},
+	}
+}
+
+// simplifyPush returns the annotations and the profile to push along with
+// the image id, or nil if it has neither. Images missing files of their full
+// image are annotated as simplified, and images with a profile with its
+// digest. Images pulled as simplified keep their annotations.
+func (i *ImageService) simplifyPush(id digest.Digest) (*distribution.SimplifyPush, error) {
+	info, err := i.imageStore.GetSimplifyInfo(image.IDFromDigest(id))
+	if err != nil || info == nil {
+		return nil, err
+	}
+	push := &distribution.SimplifyPush{Annotations: make(map[string]string)}
+	if info.Source == image.SimplifySourceRegistry {
+		for k, v := range info.Annotations {
+			push.Annotations[k] = v
+		}
+		return push, nil
+	}
+	if info.Parent != "" || len(info.Layers) > 0 {
+		push.Annotations[distribution.AnnotationSimplified] = "true"
+		// 只拉取了部分文件的镜像的digest引用指向完整镜像的manifest
+		full := id
+		if info.Parent != "" {
+			push.Annotations[distribution.AnnotationSimplifyFullImage] = info.Parent.String()
+			full = info.Parent.Digest()
+		}
+		for _, ref := range i.referenceStore.References(full) {
+			if _, ok := ref.(reference.Canonical); ok {
+				push.Annotations[distribution.AnnotationSimplifyFullManifest] = ref.String()
+				break
+			}
+		}
+		if _, ok := push.Annotations[distribution.AnnotationSimplifyFullManifest]; !ok && info.Reference != "" {
+			// digest引用已指向完整镜像
+			push.Annotations[distribution.AnnotationSimplifyFullManifest] = info.Reference
+		}
+	}
+	if info.Profile != "" {
+		if p := i.simplifyProfile(image.ID(info.Profile)); p != nil {
+			if push.Profile, err = json.Marshal(p); err != nil {
+				return nil, err
+			}
+			push.Annotations[distribution.AnnotationSimplifyProfile] = digest.FromBytes(push.Profile).String()
+		}
+	}
+	if len(push.Annotations) == 0 {
+		return nil, nil
+	}
+	return push, nil
+}
+
+// simplifiedInspect returns the simplification metadata of the image for
+// inspect. size is the size of the image's own layers.
+func (i *ImageService) simplifiedInspect(id image.ID, size int64) (types.ImageSimplified, error) {
+	info, err := i.imageStore.GetSimplifyInfo(id)
+	if err != nil || info == nil {
+		return types.ImageSimplified{}, err
+	}
+	full := info.Parent
+	if full == "" {
+		full = info.Full
+	}
+	s := types.ImageSimplified{
+		Enabled:   true,
+		FullImage: full.String(),
+		Size:      size,
+		FullSize:  info.FullSize,
+		Profile:   info.Profile,
+		Threshold: info.Threshold,
+		// 客户端验证签名的完整镜像的摘要
+		SignedDigest: info.Signed.String(),
+	}
+	if info.Source == image.SimplifySourceRegistry {
+		// 推送的精简镜像缺少的文件无法按需拉取
+		s.Annotations = info.Annotations
+		s.Materialized = info.Annotations[distribution.AnnotationSimplified] != "true"
+		if s.Materialized {
+			s.FullSize = size
+		}
+		return s, nil
+	}
+	if info.Parent == "" && len(info.Layers) == 0 {
+		// 拉取时精简的镜像内容完整
+		s.FullSize = size
+		s.Materialized = true
+		return s, nil
+	}
+	if i.simplifyCacheRoot != "" {
+		cached, err := simplify.CacheSize(context.Background(), i.simplifyCacheRoot, id.Digest().Hex())
+		if err != nil {
+			return types.ImageSimplified{}, err
+		}
+		s.Size += cached
+		s.Materialized = simplify.Materialized(i.simplifyCacheRoot, id.Digest().Hex())
+		if s.Pins, err = simplify.Pins(i.simplifyCacheRoot, id.Digest().Hex()); err != nil {
+			return types.ImageSimplified{}, err
+		}
+	}
+	return s, nil
+}
+
+// chainSize returns the size of the layer chain chainID.
+func (i *ImageService) chainSize(layerStore layer.Store, chainID layer.ChainID) (int64, error) {
+	if chainID == "" {
+		return 0, nil
+	}
+	l, err := layerStore.Get(chainID)
+	if err != nil {
+		return 0, err
+	}
+	defer layer.ReleaseAndLog(layerStore, l)
+	return l.Size()
+}
+
+// indexLayers builds the tables of contents of the layers diffIDs,
+// bottom-most first, that have none yet, so that files pruned from the
+// images simplified from them are fetched without reading whole layers.
+// Failing to index a layer only makes fetching its files slower.
+func (i *ImageService) indexLayers(layerStore layer.Store, diffIDs []layer.DiffID) {
+	for n, diffID := range diffIDs {
+		if i.simplifyTOCs.Has(diffID) {
+			continue
+		}
+		if err := i.indexLayer(layerStore, layer.CreateChainID(diffIDs[:n+1]), diffID); err != nil {
+			logrus.WithError(err).WithField("layer", diffID).Warn("failed to build the table of contents of layer")
+		}
+	}
+}
+
+func (i *ImageService) indexLayer(layerStore layer.Store, chainID layer.ChainID, diffID layer.DiffID) error {
+	l, err := layerStore.Get(chainID)
+	if err != nil {
+		return err
+	}
+	defer layer.ReleaseAndLog(layerStore, l)
+	rc, err := l.TarStream()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	toc, err := layer.BuildTOC(rc, nil)
+	if err != nil {
+		return err
+	}
+	return i.simplifyTOCs.Put(diffID, toc)
+}
+
+// mergeSimplifyCache adds the files fetched on demand for the simplified
+// image parent to rwTar, the diff of a container running from it. rwTar is
+// returned unchanged if nothing was fetched for parent.
+func (i *ImageService) mergeSimplifyCache(rwTar io.ReadCloser, parent image.ID) io.ReadCloser {
+	if parent == "" || i.simplifyCacheRoot == "" {
+		return rwTar
+	}
+	dir := simplify.CacheDir(i.simplifyCacheRoot, parent.Digest().Hex())
+	if _, err := os.Stat(dir); err != nil {
+		return rwTar
+	}
+	return simplify.MergeCache(rwTar, dir, i.idMappings)
+}
+
+// SimplifySummary compares the simplified image id with the full image it was
+// derived from. It returns nil if id has no full image to compare with. The
+// pruned paths are only listed if withPaths is true.
+func (i *ImageService) SimplifySummary(ctx context.Context, id image.ID, withPaths bool) (*types.SimplifySummary, error) {
+	img, err := i.imageStore.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	full, err := i.SimplifyFetchSources(id, img.OperatingSystem())
+	if err != nil || len(full) == 0 {
+		return nil, err
+	}
+	simplified := i.layerSources(i.layerStores[img.OperatingSystem()], img.RootFS.DiffIDs)
+	s, err := simplify.Summarize(ctx, simplified, full, i.belowThreshold(id), withPaths)
+	if err != nil {
+		return nil, err
+	}
+	summary := &types.SimplifySummary{
+		FilesKept:           s.FilesKept,
+		FilesPruned:         s.FilesPruned,
+		BytesSaved:          s.BytesSaved,
+		FilesBelowThreshold: s.FilesBelowThreshold,
+		Pruned:              s.Pruned,
+	}
+	if summary.Size, err = i.chainSize(i.layerStores[img.OperatingSystem()], img.RootFS.ChainID()); err != nil {
+		return nil, err
+	}
+	info, err := i.imageStore.GetSimplifyInfo(id)
+	if err != nil || info == nil {
+		return summary, err
+	}
+	summary.FullSize = info.FullSize
+	if info.Profile != "" {
+		if p := i.simplifyProfile(image.ID(info.Profile)); p != nil {
+			// 与随镜像推送的profile的digest相同
+			b, err := json.Marshal(p)
+			if err != nil {
+				return nil, err
+			}
+			summary.Profile = digest.FromBytes(b).String()
+		}
+	}
+	return summary, nil
+}
+
+// SimplifyMissingFiles returns the files the profile the simplified image id
+// was simplified with keeps that the root filesystem mounted at rootfs
+// lacks, as MissingFiles does. Only the layers in the layer store are read,
+// so that it works without registry access. It returns no files if the image
+// has no full image or no profile.
+func (i *ImageService) SimplifyMissingFiles(ctx context.Context, id image.ID, os, rootfs string, max int) ([]string, int, error) {
+	full, err := i.SimplifyFetchSources(id, os)
+	if err != nil || len(full) == 0 {
+		return nil, 0, err
+	}
+	info, err := i.imageStore.GetSimplifyInfo(id)
+	if err != nil {
+		return nil, 0, err
+	}
+	profileID := id
+	if info.Profile != "" {
+		profileID = image.ID(info.Profile)
+	}
+	p := i.simplifyProfile(profileID)
+	if p == nil {
+		return nil, 0, nil
+	}
+	keep, _ := p.Split(info.Threshold)
+	for _, src := range full {
+		src.(*layerSource).offline = true
+	}
+	return simplify.MissingFiles(ctx, rootfs, keep, full, max)
+}
+
+// SimplifyCommitDryRun compares the writable layer of the container in c with
+// the full image it was started from, as CommitImage would when committing a
+// simplified image, without registering any layer or image.
+func (i *ImageService) SimplifyCommitDryRun(ctx context.Context, c backend.CommitConfig) (*types.SimplifySummary, error) {
+	layerStore, ok := i.layerStores[c.ContainerOS]
+	if !ok {
+		return nil, system.ErrNotSupportedOperatingSystem
+	}
+	var full []simplify.Source
+	if c.ParentImageID != "" {
+		parent, err := i.imageStore.Get(image.ID(c.ParentImageID))
+		if err != nil {
+			return nil, err
+		}
+		full = i.layerSources(layerStore, parent.RootFS.DiffIDs)
+	}
+	sel, err := i.simplifySelector(c)
+	if err != nil {
+		return nil, err
+	}
+	rw := &rwLayerSource{layerStore: layerStore, id: c.ContainerID, mountLabel: c.ContainerMountLabel, full: full, sel: sel}
+	s, err := simplify.Summarize(ctx, []simplify.Source{rw}, full, sel.Below(), true)
+	if err != nil {
+		return nil, err
+	}
+	return &types.SimplifySummary{
+		FilesKept:           s.FilesKept,
+		FilesPruned:         s.FilesPruned,
+		BytesSaved:          s.BytesSaved,
+		FilesBelowThreshold: s.FilesBelowThreshold,
+		Kept:                s.Kept,
+		Pruned:              s.Pruned,
+	}, nil
+}
+
+// rwLayerSource reads the writable layer of a container as it would be
+// committed as a simplified image.
+type rwLayerSource struct {
+	layerStore layer.Store
+	id         string
+	mountLabel string
+	full       []simplify.Source
+	sel        *simplify.Selector
+}
+
+// DiffID is not known before the layer is registered.
+func (s *rwLayerSource) DiffID() layer.DiffID {
+	return ""
+}
+
+func (s *rwLayerSource) Open(ctx context.Context) (io.ReadCloser, error) {
+	rc, err := exportContainerRw(s.layerStore, s.id, s.mountLabel)
+	if err != nil {
+		return nil, err
+	}
+	return simplify.Select(ctx, rc, s.full, s.sel), nil
+}
+
+// simplifySelector returns the selector for committing the container in c as
+// a simplified image: it applies the keep and prune patterns of c, keeps the
+// files of the profile of the full image opened in enough of its runs, the
+// files the container opened if they were recorded, the executables the
+// image config runs and the shared libraries of the files kept.
+func (i *ImageService) simplifySelector(c backend.CommitConfig) (*simplify.Selector, error) {
+	sel, err := simplify.NewSelector(c.SimplifyKeep, c.SimplifyPrune)
+	if err != nil {
+		return nil, errdefs.InvalidParameter(err)
+	}
+	p, err := i.commitProfile(c)
+	if err != nil {
+		return nil, err
+	}
+	if p != nil {
+		threshold, err := i.simplifyThreshold(image.ID(c.ParentImageID), c.SimplifyThreshold)
+		if err != nil {
+			return nil, err
+		}
+		sel.KeepProfile(p, threshold)
+	}
+	sel.KeepPaths(c.SimplifyOpened)
+	sel.KeepExecutables(c.Config)
+	sel.KeepLibraries()
+	if i.simplifyPlaceholders {
+		sel.LeavePlaceholders()
+	}
+	return sel, nil
+}
+
+// commitProfile returns the profile of the full image of the container in c
+// given along with the commit, or else the one stored for it.
+func (i *ImageService) commitProfile(c backend.CommitConfig) (*simplify.Profile, error) {
+	if c.SimplifyProfile != nil {
+		return i.suppliedProfile(c.SimplifyProfile, digest.Digest(c.ParentImageID), i.imagePlatform(image.ID(c.ParentImageID)), c.SimplifyForce)
+	}
+	return i.simplifyProfile(image.ID(c.ParentImageID)), nil
+}
+
+// simplifyThreshold returns threshold, or the one the full image was pulled
+// with if threshold is nil.
+func (i *ImageService) simplifyThreshold(full image.ID, threshold *int) (int, error) {
+	if threshold != nil {
+		return *threshold, nil
+	}
+	if full == "" {
+		return 0, nil
+	}
+	info, err := i.imageStore.GetSimplifyInfo(full)
+	if err != nil || info == nil || info.Source != image.SimplifySourcePull {
+		return 0, err
+	}
+	return info.Threshold, nil
+}
+
+// belowThreshold returns the paths of the profile the simplified image id was
+// committed with that were left out for being opened in too few runs.
+func (i *ImageService) belowThreshold(id image.ID) []string {
+	info, err := i.imageStore.GetSimplifyInfo(id)
+	if err != nil || info == nil || info.Profile == "" {
+		return nil
+	}
+	p := i.simplifyProfile(image.ID(info.Profile))
+	if p == nil {
+		return nil
+	}
+	_, below := p.Split(info.Threshold)
+	return below
+}
+
+// selectSimplified applies the selector of c to rwTar, the writable layer of
+// a container being committed as a simplified image.
+func (i *ImageService) selectSimplified(rwTar io.ReadCloser, c backend.CommitConfig) (io.ReadCloser, error) {
+	sel, err := i.simplifySelector(c)
+	if err != nil {
+		return rwTar, err
+	}
+	if sel.Empty() {
+		return rwTar, nil
+	}
+	var full []simplify.Source
+	if c.ParentImageID != "" {
+		parent, err := i.imageStore.Get(image.ID(c.ParentImageID))
+		if err != nil {
+			return rwTar, err
+		}
+		full = i.layerSources(i.layerStores[c.ContainerOS], parent.RootFS.DiffIDs)
+	}
+	return simplify.Select(context.Background(), rwTar, full, sel), nil
+}
+
+// registerSimplified registers rc, the content of a simplified image, as a
+// layer without parent. Stores which can build it from full, the chain of
+// its full image, do so; the others extract rc in full.
+func registerSimplified(ls layer.Store, rc io.Reader, full layer.ChainID) (layer.Layer, error) {
+	if ss, ok := ls.(layer.SimplifyStore); ok && full != "" {
+		return ss.RegisterSimplified(rc, full)
+	}
+	return ls.Register(rc, "")
+}
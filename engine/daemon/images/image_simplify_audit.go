@@ -0,0 +1,67 @@
+package images // import "github.com/docker/docker/daemon/images"
+
+import (
+	"context"
+
+	"github.com/docker/docker/daemon/simplify"
+	"github.com/docker/docker/errdefs"
+	"github.com/docker/docker/image"
+	"github.com/docker/docker/pkg/system"
+	"github.com/pkg/errors"
+)
+
+// 修改： 运行完整镜像，检查profile精简掉的文件是否会被访问
+
+// SimplifyAuditSelector returns the selector a simplified image made from
+// the image id with the profile stored for the image named profile would
+// be made with, as by docker image simplify: it keeps the files of the
+// profile opened in enough of its runs, the executables the image config
+// runs and their shared libraries.
+func (i *ImageService) SimplifyAuditSelector(id image.ID, profile string) (*simplify.Selector, error) {
+	info, err := i.imageStore.GetSimplifyInfo(id)
+	if err != nil {
+		return nil, errdefs.System(err)
+	}
+	if info != nil && (info.Parent != "" || len(info.Layers) > 0) {
+		// 精简镜像的rootfs本身就缺少文件
+		return nil, errdefs.InvalidParameter(errors.Errorf("image %s is simplified, only containers of full images can be audited", id))
+	}
+	img, err := i.imageStore.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	profileID, err := i.profileImageID(profile)
+	if err != nil {
+		return nil, err
+	}
+	p, err := i.storedProfile(profile, profileID)
+	if err != nil {
+		return nil, err
+	}
+	threshold, err := i.simplifyThreshold(id, nil)
+	if err != nil {
+		return nil, err
+	}
+	sel, err := simplify.NewSelector(nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	sel.KeepProfile(p, threshold)
+	sel.KeepExecutables(img.Config)
+	sel.KeepLibraries()
+	return sel, nil
+}
+
+// SimplifyPrunedPaths returns the files of the image id that a simplified
+// image made with sel would prune.
+func (i *ImageService) SimplifyPrunedPaths(ctx context.Context, id image.ID, sel *simplify.Selector) (map[string]bool, error) {
+	img, err := i.imageStore.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	layerStore, ok := i.layerStores[img.OperatingSystem()]
+	if !ok {
+		return nil, system.ErrNotSupportedOperatingSystem
+	}
+	return simplify.PrunedPaths(ctx, i.layerSources(layerStore, img.RootFS.DiffIDs), sel)
+}
@@ -0,0 +1,56 @@
+package images // import "github.com/docker/docker/daemon/images"
+
+import (
+	"context"
+
+	"github.com/docker/docker/daemon/simplify"
+	"github.com/docker/docker/image"
+	"github.com/docker/docker/layer"
+	"github.com/docker/docker/pkg/archive"
+	"github.com/sirupsen/logrus"
+)
+
+// 修改： docker diff不把按需获取的文件报告为新增
+
+// SimplifyChanges returns changes, those of the writable layer rwLayer of a
+// container of the simplified image id, without the files fetched on demand
+// into its root filesystem, as FilterChanges does. Only the layers in the
+// layer store and the tables of contents are read. The changes are returned
+// as they are if the image has no full image, or if they cannot be filtered.
+func (i *ImageService) SimplifyChanges(id image.ID, os string, rwLayer layer.RWLayer, mountLabel string, changes []archive.Change) []archive.Change {
+	var added bool
+	for _, c := range changes {
+		added = added || c.Kind == archive.ChangeAdd
+	}
+	if !added {
+		return changes
+	}
+	info, err := i.imageStore.GetSimplifyInfo(id)
+	if err != nil || info == nil || pushedSimplified(info) {
+		return changes
+	}
+	full, err := i.SimplifyFetchSources(id, os)
+	if err != nil || len(full) == 0 {
+		return changes
+	}
+	for _, src := range full {
+		src.(*layerSource).offline = true
+	}
+
+	rootfs, err := rwLayer.Mount(mountLabel)
+	if err != nil {
+		logrus.WithError(err).WithField("image", id).Warn("cannot leave the files fetched on demand out of the changes")
+		return changes
+	}
+	defer rwLayer.Unmount()
+	// 可写层目录用于判断目录本身是否被修改，取不到时保留目录的变更
+	metadata, _ := rwLayer.Metadata()
+	filtered, err := simplify.FilterChanges(context.Background(), rootfs.Path(), metadata["UpperDir"], changes, full)
+	if err != nil {
+		logrus.WithError(err).WithField("image", id).Warn("cannot leave the files fetched on demand out of the changes")
+		return changes
+	}
+	return filtered
+}
+
+// 修改
@@ -0,0 +1,120 @@
+package images // import "github.com/docker/docker/daemon/images"
+
+import (
+	"bytes"
+	"context"
+	"io"
+
+	"github.com/docker/docker/daemon/simplify"
+	"github.com/docker/docker/image"
+	"github.com/docker/docker/layer"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// 修改： docker cp读写精简镜像容器中被裁剪的路径
+
+// SimplifiedPath holds the files pruned from a simplified image at a path of
+// the root filesystem of one of its containers, or under it.
+type SimplifiedPath struct {
+	// Path is the path in the root filesystem.
+	Path string
+	// Dir is the cache of the image the pruned files were fetched into, or
+	// "" if they cannot be fetched.
+	Dir string
+	// Missing are the paths, sorted, of the entries of Dir at Path or under
+	// it that the root filesystem lacks.
+	Missing []string
+	// Pruned counts the files pruned at Path or under it that the root
+	// filesystem lacks, if they cannot be fetched.
+	Pruned  int
+	release func()
+}
+
+// Absent returns true if Path itself is missing from the root filesystem.
+func (sp *SimplifiedPath) Absent() bool {
+	return len(sp.Missing) > 0 && sp.Missing[0] == sp.Path
+}
+
+// Release allows the cache to be evicted again.
+func (sp *SimplifiedPath) Release() {
+	if sp.release != nil {
+		sp.release()
+	}
+}
+
+// SimplifyPath returns the files pruned from the simplified image id at the
+// path p of the root filesystem rootfs of one of its containers, whose
+// writable layer is rwLayer, or under p. A nil rwLayer stands for a root
+// filesystem with no changes, as that of the source of a COPY --from. Unless fetch is false, they are
+// fetched into the cache of the image first, which is kept until Release is
+// called. Otherwise they are only counted. It returns nil if none are
+// missing from rootfs.
+func (i *ImageService) SimplifyPath(ctx context.Context, id image.ID, os string, rwLayer layer.RWLayer, rootfs, p string, fetch bool) (*SimplifiedPath, error) {
+	info, err := i.imageStore.GetSimplifyInfo(id)
+	if err != nil || info == nil || pushedSimplified(info) {
+		// 推送的精简镜像没有完整镜像，无法得知裁剪了哪些文件
+		return nil, err
+	}
+	full, err := i.SimplifyFetchSources(id, os)
+	if err != nil || len(full) == 0 {
+		return nil, err
+	}
+	if !fetch || i.simplifyFetch == nil {
+		return i.prunedPath(ctx, id, rwLayer, rootfs, p)
+	}
+
+	dir, release, err := i.simplifyFetch.FetchPath(ctx, id.Digest().Hex(), full, p)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to fetch %s pruned from the image", p)
+	}
+	var missing []string
+	err = withDiff(rwLayer, func(diff io.Reader) (err error) {
+		missing, err = simplify.MissingCacheEntries(dir, rootfs, p, diff)
+		return err
+	})
+	if err != nil || len(missing) == 0 {
+		release()
+		return nil, err
+	}
+	return &SimplifiedPath{Path: p, Dir: dir, Missing: missing, release: release}, nil
+}
+
+// prunedPath counts the files pruned from the simplified image id at p or
+// under it, as SimplifyPath does when they cannot be fetched.
+func (i *ImageService) prunedPath(ctx context.Context, id image.ID, rwLayer layer.RWLayer, rootfs, p string) (*SimplifiedPath, error) {
+	summary, err := i.SimplifySummary(ctx, id, true)
+	if err != nil {
+		// 读取不到完整镜像时照常复制
+		logrus.WithError(err).WithField("image", id).Debug("cannot list the files pruned from the simplified image")
+		return nil, nil
+	}
+	if summary == nil {
+		return nil, nil
+	}
+	var n int
+	err = withDiff(rwLayer, func(diff io.Reader) (err error) {
+		n, err = simplify.CountMissing(rootfs, p, summary.Pruned, diff)
+		return err
+	})
+	if err != nil || n == 0 {
+		return nil, err
+	}
+	return &SimplifiedPath{Path: p, Pruned: n}, nil
+}
+
+// withDiff calls fn with the tar stream of rwLayer, whose whiteouts record
+// the files the container removed, or with an empty stream if it is nil.
+func withDiff(rwLayer layer.RWLayer, fn func(diff io.Reader) error) error {
+	if rwLayer == nil {
+		return fn(bytes.NewReader(nil))
+	}
+	diff, err := rwLayer.TarStream()
+	if err != nil {
+		return err
+	}
+	defer diff.Close()
+	return fn(diff)
+}
+
+// 修改
@@ -0,0 +1,170 @@
+package images // import "github.com/docker/docker/daemon/images"
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/docker/distribution/reference"
+	"github.com/docker/docker/daemon/simplify"
+	"github.com/docker/docker/image"
+	"github.com/docker/docker/layer"
+	"github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+)
+
+// removeSimplifyState removes what was stored for simplifying the image id
+// once it is deleted: the cache of the files fetched for it, releasing the
+// files of the blob store no other cache links to, its profiles, and the
+// tables of contents of its removed layers and of the layers of the full
+// image it was derived from (as recorded in info, nil if it is not
+// simplified), that no remaining image uses. Failures are logged: the image
+// is gone whatever happens to its state.
+func (i *ImageService) removeSimplifyState(id image.ID, info *image.SimplifyInfo, removedLayers []layer.Metadata) {
+	log := logrus.WithField("image", id)
+	// 共享的缓存可能仍被其它daemon上的同一镜像使用，留给淘汰回收
+	if i.simplifyCacheRoot != "" && !i.simplifyCacheShared {
+		dir := filepath.Join(i.simplifyCacheRoot, id.Digest().Hex())
+		if _, err := os.Stat(dir); err == nil {
+			if err := simplify.RemoveCache(i.simplifyCacheRoot, id.Digest().Hex()); err != nil {
+				log.WithError(err).Warn("failed to remove simplify fetch cache of deleted image")
+			} else if _, err := simplify.PruneBlobs(i.simplifyCacheRoot); err != nil {
+				log.WithError(err).Warn("failed to release simplify blobs of deleted image")
+			}
+		}
+	}
+	if err := i.simplifyProfiles.DeleteImage(id.Digest()); err != nil {
+		log.WithError(err).Warn("failed to remove simplify profiles of deleted image")
+	}
+
+	var diffIDs []layer.DiffID
+	for _, l := range removedLayers {
+		diffIDs = append(diffIDs, l.DiffID)
+	}
+	if info != nil {
+		diffIDs = append(diffIDs, info.Layers...)
+	}
+	var stored []layer.DiffID
+	for _, diffID := range diffIDs {
+		if i.simplifyTOCs.Has(diffID) {
+			stored = append(stored, diffID)
+		}
+	}
+	if len(stored) == 0 {
+		return
+	}
+	used, err := i.simplifyDiffIDs()
+	if err != nil {
+		// 无法确定哪些层仍被使用时全部保留
+		log.WithError(err).Warn("failed to remove tables of contents of deleted layers")
+		return
+	}
+	for _, diffID := range stored {
+		if used[diffID] {
+			continue
+		}
+		if err := i.simplifyTOCs.Delete(diffID); err != nil {
+			log.WithError(err).WithField("layer", diffID).Warn("failed to remove table of contents of deleted layer")
+		}
+	}
+}
+
+// simplifyDiffIDs returns the diff IDs of the layers of the images, and of
+// the full images simplified images were derived from.
+func (i *ImageService) simplifyDiffIDs() (map[layer.DiffID]bool, error) {
+	used := make(map[layer.DiffID]bool)
+	for id, img := range i.imageStore.Map() {
+		for _, diffID := range img.RootFS.DiffIDs {
+			used[diffID] = true
+		}
+		info, err := i.imageStore.GetSimplifyInfo(id)
+		if err != nil {
+			return nil, err
+		}
+		if info != nil {
+			for _, diffID := range info.Layers {
+				used[diffID] = true
+			}
+		}
+	}
+	return used, nil
+}
+
+// moveDigestToVariant moves the digest reference ref of the image id, about
+// to be removed along with it, to the other variant of the image pulled by
+// the same digest: the full image a pulled simplified image was derived
+// from, or a simplified image pulled from the full image id. It returns
+// false, leaving ref to be removed, if ref is not a digest reference of the
+// repository the variants were pulled from or no other variant is local.
+func (i *ImageService) moveDigestToVariant(id image.ID, ref reference.Named) bool {
+	canonical, ok := ref.(reference.Canonical)
+	if !ok {
+		return false
+	}
+	variant, name := i.simplifyVariant(id)
+	if variant == "" || ref.Name() != name {
+		return false
+	}
+	// digest引用不能覆盖，先删除
+	if _, err := i.referenceStore.Delete(canonical); err != nil {
+		logrus.WithError(err).WithField("image", id).Warnf("failed to remove digest reference %s", reference.FamiliarString(ref))
+		return false
+	}
+	if err := i.referenceStore.AddDigest(canonical, variant.Digest(), false); err != nil {
+		logrus.WithError(err).WithField("image", variant).Warnf("failed to move digest reference %s to the image", reference.FamiliarString(ref))
+		return false
+	}
+	i.LogImageEvent(variant.String(), reference.FamiliarString(ref), "tag")
+	return true
+}
+
+// simplifyVariant returns the other local variant of the image id, and the
+// name of the repository they were pulled from, or "" if there is none. Of
+// the simplified images pulled from a full image, the one with the lowest
+// ID is returned.
+func (i *ImageService) simplifyVariant(id image.ID) (image.ID, string) {
+	info, err := i.imageStore.GetSimplifyInfo(id)
+	if err != nil {
+		return "", ""
+	}
+	if info != nil && info.Full != "" {
+		if _, err := i.imageStore.Get(info.Full); err != nil || info.Full == id {
+			return "", ""
+		}
+		return info.Full, referenceName(info.Reference)
+	}
+	var variant image.ID
+	var name string
+	for other := range i.imageStore.Map() {
+		if other == id || (variant != "" && other > variant) {
+			continue
+		}
+		info, err := i.imageStore.GetSimplifyInfo(other)
+		if err != nil || info == nil || info.Full != id {
+			continue
+		}
+		variant, name = other, referenceName(info.Reference)
+	}
+	return variant, name
+}
+
+// referenceName returns the name of the repository of the reference ref, or
+// "" if it is invalid.
+func referenceName(ref string) string {
+	named, err := reference.ParseNormalizedNamed(ref)
+	if err != nil {
+		return ""
+	}
+	return named.Name()
+}
+
+// simplifyVariants returns whether one of the images a and b is a simplified
+// image pulled from the other.
+func (i *ImageService) simplifyVariants(a, b digest.Digest) bool {
+	for _, pair := range [][2]digest.Digest{{a, b}, {b, a}} {
+		info, err := i.imageStore.GetSimplifyInfo(image.IDFromDigest(pair[1]))
+		if err == nil && info != nil && info.Full == image.IDFromDigest(pair[0]) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,74 @@
+package images // import "github.com/docker/docker/daemon/images"
+
+import (
+	"context"
+
+	containertypes "github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/daemon/simplify"
+	"github.com/docker/docker/image"
+	"github.com/pkg/errors"
+)
+
+// 修改： docker exec的命令被精简时按需拉取
+
+// SimplifiedExec holds the files pruned from a simplified image that running
+// commands in one of its containers needs.
+type SimplifiedExec struct {
+	// Missing are the paths, sorted, of the files the root filesystem still
+	// lacks.
+	Missing []string
+	// Err is why the missing files could not be fetched, if they were.
+	Err error
+}
+
+// SimplifyExec returns the files pruned from the simplified image id that
+// running the commands of config in one of its containers, whose root
+// filesystem is mounted at rootfs, needs, along with the files at paths, as
+// MissingExecFiles does.
+// Unless fetch is false, they are fetched into the cache of the image first,
+// which its running containers see. It returns nil if none are missing.
+func (i *ImageService) SimplifyExec(ctx context.Context, id image.ID, os, rootfs string, config *containertypes.Config, paths []string, fetch bool) (*SimplifiedExec, error) {
+	info, err := i.imageStore.GetSimplifyInfo(id)
+	if err != nil || info == nil || pushedSimplified(info) {
+		return nil, err
+	}
+	full, err := i.SimplifyFetchSources(id, os)
+	if err != nil || len(full) == 0 {
+		return nil, err
+	}
+	fetch = fetch && i.simplifyFetch != nil
+	if !fetch {
+		for _, src := range full {
+			src.(*layerSource).offline = true
+		}
+	}
+	missing, err := simplify.MissingExecFiles(ctx, rootfs, full, config, paths)
+	if err != nil || len(missing) == 0 {
+		return nil, err
+	}
+	se := &SimplifiedExec{Missing: missing}
+	if !fetch {
+		return se, nil
+	}
+
+	hex := id.Digest().Hex()
+	for _, p := range missing {
+		_, release, err := i.simplifyFetch.FetchPath(ctx, hex, full, p)
+		if err != nil {
+			se.Err = errors.Wrapf(err, "failed to fetch %s", p)
+			break
+		}
+		// 容器挂载了缓存，文件不会在其运行时被清除
+		release()
+	}
+	// 重新检查，拉取不到的文件仍然缺失
+	if se.Missing, err = simplify.Absent(rootfs, missing); err != nil {
+		return nil, err
+	}
+	if len(se.Missing) == 0 {
+		return nil, nil
+	}
+	return se, nil
+}
+
+// 修改
@@ -0,0 +1,72 @@
+package images // import "github.com/docker/docker/daemon/images"
+
+import (
+	"context"
+	"io"
+
+	"github.com/docker/docker/daemon/simplify"
+	"github.com/docker/docker/distribution"
+	"github.com/docker/docker/errdefs"
+	"github.com/docker/docker/image"
+	"github.com/docker/docker/layer"
+	"github.com/docker/docker/pkg/ioutils"
+	"github.com/pkg/errors"
+)
+
+// 修改： 导出精简镜像的容器时补全被裁剪的文件
+
+// SimplifyExport completes rootfs, the tar stream of the root filesystem of
+// a container of the image id whose writable layer is rwLayer, with the
+// files pruned from the image, fetched into its cache first. If sparse, the
+// files missing from rootfs are listed in simplify.OmittedManifest instead.
+// rootfs is returned as is if the image is not simplified. Otherwise,
+// closing the returned stream closes rootfs.
+func (i *ImageService) SimplifyExport(ctx context.Context, id image.ID, os string, rootfs io.ReadCloser, rwLayer layer.RWLayer, sparse bool) (io.ReadCloser, error) {
+	info, err := i.imageStore.GetSimplifyInfo(id)
+	if err != nil || info == nil {
+		return rootfs, err
+	}
+	if info.Source == image.SimplifySourceRegistry && info.Annotations[distribution.AnnotationSimplified] == "true" {
+		// 推送的精简镜像没有完整镜像，无法得知缺少哪些文件
+		return nil, errdefs.Unavailable(errors.Errorf("the files pruned from image %s are unknown: its full image %s was not pulled", id, info.Annotations[distribution.AnnotationSimplifyFullImage]))
+	}
+	full, err := i.SimplifyFetchSources(id, os)
+	if err != nil {
+		return nil, err
+	}
+	if len(full) == 0 {
+		// 拉取时精简的镜像内容完整
+		return rootfs, nil
+	}
+
+	var omitted []string
+	if sparse {
+		summary, err := i.SimplifySummary(ctx, id, true)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to list the files pruned from the image")
+		}
+		omitted = summary.Pruned
+	} else if i.simplifyFetch == nil {
+		return nil, errdefs.NotImplemented(errors.New("files pruned from simplified images cannot be fetched on this daemon, export a sparse archive instead"))
+	}
+	diff, err := rwLayer.TarStream()
+	if err != nil {
+		return nil, err
+	}
+	if sparse {
+		return simplify.SparseExport(rootfs, diff, omitted), nil
+	}
+	dir, release, err := i.simplifyFetch.Materialize(ctx, id.Digest().Hex(), full)
+	if err != nil {
+		diff.Close()
+		return nil, errors.Wrap(err, "failed to fetch the files pruned from the image")
+	}
+	rc := simplify.CompleteExport(rootfs, diff, dir, i.idMappings)
+	return ioutils.NewReadCloserWrapper(rc, func() error {
+		err := rc.Close()
+		release()
+		return err
+	}), nil
+}
+
+// 修改
@@ -0,0 +1,370 @@
+package images // import "github.com/docker/docker/daemon/images"
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	dist "github.com/docker/distribution"
+	"github.com/docker/docker/daemon/simplify"
+	"github.com/docker/docker/distribution"
+	"github.com/docker/docker/distribution/metadata"
+	"github.com/docker/docker/image"
+	"github.com/docker/docker/layer"
+	"github.com/docker/docker/pkg/archive"
+	"github.com/docker/docker/pkg/system"
+	"github.com/docker/go-units"
+	"github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+)
+
+// 修改： 按需拉取精简镜像中缺失的文件时，定位完整镜像各层的来源
+
+// SimplifyFetchSources returns the layers of the full image the simplified
+// image id was derived from, topmost first, or nil if the image has no full
+// image to fetch pruned files from.
+func (i *ImageService) SimplifyFetchSources(id image.ID, os string) ([]simplify.Source, error) {
+	layerStore, ok := i.layerStores[os]
+	if !ok {
+		return nil, system.ErrNotSupportedOperatingSystem
+	}
+	diffIDs, err := i.simplifyFullLayers(id)
+	if err != nil {
+		return nil, err
+	}
+	return i.layerSources(layerStore, diffIDs), nil
+}
+
+// simplifyFullLayers returns the diff IDs of the layers of the full image
+// the simplified image id was derived from, bottom-most first, or nil if the
+// image has no full image. The full image of an image built or committed on
+// top of a simplified image is that of its parent with the layers it added.
+func (i *ImageService) simplifyFullLayers(id image.ID) ([]layer.DiffID, error) {
+	info, err := i.imageStore.GetSimplifyInfo(id)
+	if err != nil {
+		return nil, err
+	}
+	if info == nil {
+		return i.simplifyChildFullLayers(id)
+	}
+	if len(info.Layers) == 0 && info.Parent != "" {
+		full, err := i.imageStore.Get(info.Parent)
+		if err != nil {
+			return nil, err
+		}
+		return full.RootFS.DiffIDs, nil
+	}
+	return info.Layers, nil
+}
+
+// simplifyChildFullLayers returns the layers of the full image of id, an
+// image without simplification data of its own, as simplifyFullLayers does.
+// It returns nil unless an ancestor of id is a simplified image with a full
+// image.
+func (i *ImageService) simplifyChildFullLayers(id image.ID) ([]layer.DiffID, error) {
+	parent, err := i.imageStore.GetParent(id)
+	if err != nil || parent == "" {
+		// 只有本地构建或提交的镜像记录了父镜像
+		return nil, nil
+	}
+	full, err := i.simplifyFullLayers(parent)
+	if err != nil || len(full) == 0 {
+		return nil, err
+	}
+	img, err := i.imageStore.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	p, err := i.imageStore.Get(parent)
+	if err != nil {
+		return nil, err
+	}
+	n := len(p.RootFS.DiffIDs)
+	if len(img.RootFS.DiffIDs) < n {
+		return nil, nil
+	}
+	// 子镜像在父镜像之上添加的层叠加在完整镜像之上，其whiteout遮住完整镜像中的文件
+	return append(append([]layer.DiffID(nil), full...), img.RootFS.DiffIDs[n:]...), nil
+}
+
+// layerSources returns the layers diffIDs, bottom-most first, as sources,
+// topmost first.
+func (i *ImageService) layerSources(layerStore layer.Store, diffIDs []layer.DiffID) []simplify.Source {
+	sources := make([]simplify.Source, 0, len(diffIDs))
+	for n := len(diffIDs) - 1; n >= 0; n-- {
+		sources = append(sources, &layerSource{
+			images:     i,
+			layerStore: layerStore,
+			chainID:    layer.CreateChainID(diffIDs[:n+1]),
+			diffID:     diffIDs[n],
+		})
+	}
+	return sources
+}
+
+// layerSource reads a layer of the full image from the local layer store if
+// it is still there, and from the registry it was pulled from otherwise.
+type layerSource struct {
+	images     *ImageService
+	layerStore layer.Store
+	chainID    layer.ChainID
+	diffID     layer.DiffID
+	// offline sources only read the layer store
+	offline bool
+
+	tocOnce sync.Once
+	toc     *layer.TOC
+}
+
+func (s *layerSource) DiffID() layer.DiffID {
+	return s.diffID
+}
+
+func (s *layerSource) Open(ctx context.Context) (io.ReadCloser, error) {
+	if l, err := s.layerStore.Get(s.chainID); err == nil {
+		rc, err := l.TarStream()
+		if err == nil {
+			return &releaseReadCloser{ReadCloser: rc, release: func() { layer.ReleaseAndLog(s.layerStore, l) }}, nil
+		}
+		layer.ReleaseAndLog(s.layerStore, l)
+	}
+	if s.offline {
+		return nil, fmt.Errorf("layer %s of the full image is not available offline", s.diffID)
+	}
+	return s.images.openRemoteLayer(ctx, s.diffID)
+}
+
+// TOC returns the table of contents of the layer if one was built when it
+// was committed or pulled.
+func (s *layerSource) TOC() *layer.TOC {
+	s.tocOnce.Do(func() {
+		toc, err := s.images.simplifyTOCs.Get(s.diffID)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				logrus.WithError(err).WithField("layer", s.diffID).Warn("invalid table of contents of layer")
+			}
+			return
+		}
+		s.toc = toc
+	})
+	return s.toc
+}
+
+func (s *layerSource) OpenEntry(ctx context.Context, n int) (io.ReadCloser, error) {
+	e := s.TOC().Entries[n]
+	if l, err := s.layerStore.Get(s.chainID); err == nil {
+		rc, err := l.TarStream()
+		if err == nil {
+			return openEntry(&releaseReadCloser{ReadCloser: rc, release: func() { layer.ReleaseAndLog(s.layerStore, l) }}, e)
+		}
+		layer.ReleaseAndLog(s.layerStore, l)
+	}
+	if s.offline {
+		return nil, fmt.Errorf("layer %s of the full image is not available offline", s.diffID)
+	}
+	return s.images.openRemoteEntry(ctx, s.diffID, n, e)
+}
+
+// openEntry returns the tar stream rc from the start of the entry e. If the
+// offset of e is not known, the entry is looked up in the stream and the
+// stream returned holds it only.
+func openEntry(rc io.ReadCloser, e layer.TOCEntry) (io.ReadCloser, error) {
+	if e.Offset >= 0 {
+		if _, err := io.CopyN(ioutil.Discard, rc, e.Offset); err != nil {
+			rc.Close()
+			return nil, err
+		}
+		return rc, nil
+	}
+
+	name := path.Clean("/" + e.Name)
+	tr := tar.NewReader(rc)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			rc.Close()
+			return nil, fmt.Errorf("entry %s not found in layer", e.Name)
+		}
+		if err != nil {
+			rc.Close()
+			return nil, err
+		}
+		if path.Clean("/"+hdr.Name) != name {
+			continue
+		}
+		// 以目录中的名字重新打包该条目
+		hdr.Name = e.Name
+		pr, pw := io.Pipe()
+		go func() {
+			tw := tar.NewWriter(pw)
+			err := tw.WriteHeader(hdr)
+			if err == nil {
+				_, err = io.Copy(tw, tr)
+			}
+			if err == nil {
+				err = tw.Close()
+			}
+			pw.CloseWithError(err)
+		}()
+		return &releaseReadCloser{ReadCloser: pr, release: func() { rc.Close() }}, nil
+	}
+}
+
+// openRemoteEntry opens the uncompressed blob of diffID from the start of
+// its n-th entry e. Only the part of the blob holding the entry is
+// downloaded if the blob is seekable or in the eStargz format, along with
+// the nearby entries other fetches read at the same time.
+func (i *ImageService) openRemoteEntry(ctx context.Context, diffID layer.DiffID, n int, e layer.TOCEntry) (io.ReadCloser, error) {
+	metas, err := metadata.NewV2MetadataService(i.distributionMetadataStore).GetMetadata(diffID)
+	if err != nil {
+		return nil, err
+	}
+	for _, meta := range metas {
+		meta := meta
+		if se := distribution.LocateSeekableEntry(i.distributionMetadataStore, meta.Digest, n, &e); se != nil && i.simplifyBatcher.Coalesces(se.Size) {
+			// 小文件与同时拉取的相邻文件合并为一个range请求
+			data, err := i.simplifyBatcher.Read(ctx, meta.Digest, se.Offset, se.Size, func(ctx context.Context, offset int64) (io.ReadCloser, error) {
+				blob, err := i.openRawBlob(ctx, meta)
+				if err != nil {
+					return nil, err
+				}
+				if _, err := blob.Seek(offset, io.SeekStart); err != nil {
+					blob.Close()
+					return nil, err
+				}
+				return blob, nil
+			})
+			if err == nil {
+				return se.Open(bytes.NewReader(data))
+			}
+			logrus.WithError(err).WithField("blob", meta.Digest).Debug("cannot read entry of seekable layer blob")
+			continue
+		}
+		rc, ok, err := distribution.OpenSeekableEntry(i.distributionMetadataStore, meta.Digest, n, &e, func() (dist.ReadSeekCloser, error) {
+			return i.openRawBlob(ctx, meta)
+		})
+		if !ok {
+			continue
+		}
+		if err != nil {
+			logrus.WithError(err).WithField("blob", meta.Digest).Debug("cannot read entry of seekable layer blob")
+			continue
+		}
+		return rc, nil
+	}
+
+	rc, err := i.openRemoteLayer(ctx, diffID)
+	if err != nil {
+		return nil, err
+	}
+	return openEntry(rc, e)
+}
+
+// openRemoteLayer opens the uncompressed blob of diffID from a repository
+// it is known to have been pulled from.
+func (i *ImageService) openRemoteLayer(ctx context.Context, diffID layer.DiffID) (io.ReadCloser, error) {
+	metas, err := metadata.NewV2MetadataService(i.distributionMetadataStore).GetMetadata(diffID)
+	if err != nil {
+		return nil, err
+	}
+	lastErr := fmt.Errorf("no registry source known for layer %s", diffID)
+	for _, meta := range metas {
+		rc, err := i.openBlob(ctx, meta)
+		if err == nil {
+			return rc, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+func (i *ImageService) openBlob(ctx context.Context, meta metadata.V2Metadata) (io.ReadCloser, error) {
+	blob, err := i.openRawBlob(ctx, meta)
+	if err != nil {
+		return nil, err
+	}
+	rc, err := archive.DecompressStream(blob)
+	if err != nil {
+		blob.Close()
+		return nil, err
+	}
+	return &releaseReadCloser{ReadCloser: rc, release: func() { blob.Close() }}, nil
+}
+
+// openRawBlob opens the blob of meta, as stored in the registry.
+func (i *ImageService) openRawBlob(ctx context.Context, meta metadata.V2Metadata) (dist.ReadSeekCloser, error) {
+	return i.simplifyRemotes.openBlob(ctx, meta)
+}
+
+// releaseReadCloser calls release once the stream is closed.
+type releaseReadCloser struct {
+	io.ReadCloser
+	release func()
+}
+
+func (r *releaseReadCloser) Close() error {
+	err := r.ReadCloser.Close()
+	r.release()
+	return err
+}
+
+// RemoveOrphanedSimplifyCaches removes the caches of files fetched for
+// simplified images that no longer exist, along with the files of the blob
+// store no remaining cache links to, and returns their image IDs. It must
+// not run while containers are attached to the caches. Caches shared with
+// other daemons are left to the eviction, as the images may exist there.
+func (i *ImageService) RemoveOrphanedSimplifyCaches() ([]string, error) {
+	if i.simplifyCacheRoot == "" || i.simplifyCacheShared {
+		return nil, nil
+	}
+	dirs, err := ioutil.ReadDir(i.simplifyCacheRoot)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var removed []string
+	for _, d := range dirs {
+		dgst := digest.NewDigestFromHex(digest.SHA256.String(), d.Name())
+		if dgst.Validate() != nil {
+			continue
+		}
+		if _, err := i.imageStore.Get(image.ID(dgst)); err == nil {
+			continue
+		}
+		if err := simplify.RemoveCache(i.simplifyCacheRoot, d.Name()); err != nil {
+			return removed, err
+		}
+		removed = append(removed, d.Name())
+	}
+	// 其它镜像不再链接的文件随之释放
+	if _, err := simplify.PruneBlobs(i.simplifyCacheRoot); err != nil {
+		return removed, err
+	}
+	return removed, nil
+}
+
+// simplifyRangeMaxAge is how long the ranges downloaded by an interrupted
+// simplified pull are kept for it to resume.
+const simplifyRangeMaxAge = 7 * 24 * time.Hour
+
+// RemoveStaleSimplifyRanges removes the ranges of layer blobs downloaded by
+// simplified pulls interrupted for longer than simplifyRangeMaxAge.
+func (i *ImageService) RemoveStaleSimplifyRanges() error {
+	if i.simplifyRangeRoot == "" {
+		return nil
+	}
+	freed, err := distribution.RemoveStaleRanges(i.simplifyRangeRoot, time.Now().Add(-simplifyRangeMaxAge))
+	if freed > 0 {
+		logrus.Debugf("removed %s of stale ranges of interrupted simplified pulls", units.HumanSize(float64(freed)))
+	}
+	return err
+}
@@ -0,0 +1,96 @@
+package images // import "github.com/docker/docker/daemon/images"
+
+import (
+	"os"
+
+	"github.com/docker/docker/distribution"
+	"github.com/docker/docker/image"
+	"github.com/docker/docker/layer"
+	"github.com/sirupsen/logrus"
+)
+
+// 修改： 历史中标出被精简改写的层
+
+// simplifiedLayer is the simplification data of a layer of an image shown in
+// its history.
+type simplifiedLayer struct {
+	// rewritten is true if the layer is not the one of the full image.
+	rewritten bool
+	// fullSize is the size of the layer, or layers, of the full image the
+	// layer was simplified from, or 0 if unknown.
+	fullSize int64
+}
+
+// simplifiedLayers returns the simplification data of the layers of the
+// image img, bottom-most first, or nil if it is not simplified. Layers
+// pulled with part of their files are matched with the layers of the full
+// image one by one; the single layer of committed simplified images stands
+// for the whole full image.
+func (i *ImageService) simplifiedLayers(img *image.Image) ([]simplifiedLayer, error) {
+	info, err := i.imageStore.GetSimplifyInfo(img.ID())
+	if err != nil || info == nil {
+		return nil, err
+	}
+	diffIDs := img.RootFS.DiffIDs
+	layers := make([]simplifiedLayer, len(diffIDs))
+	switch {
+	case info.Source == image.SimplifySourceRegistry:
+		// 推送的精简镜像不知道完整镜像的层
+		if info.Annotations[distribution.AnnotationSimplified] == "true" {
+			for n := range layers {
+				layers[n].rewritten = true
+			}
+		}
+	case len(info.Layers) == 0:
+		// 拉取时精简的镜像内容完整
+	case info.Parent == "" && len(info.Layers) == len(diffIDs):
+		for n, diffID := range diffIDs {
+			if diffID == info.Layers[n] {
+				continue
+			}
+			layers[n] = simplifiedLayer{rewritten: true, fullSize: i.fullLayerSize(img.OperatingSystem(), info.Layers[:n+1])}
+		}
+	default:
+		full := make(map[layer.DiffID]bool)
+		for _, diffID := range info.Layers {
+			full[diffID] = true
+		}
+		for n, diffID := range diffIDs {
+			layers[n].rewritten = !full[diffID]
+		}
+		if len(diffIDs) == 1 {
+			layers[0].fullSize = info.FullSize
+		}
+	}
+	return layers, nil
+}
+
+// fullLayerSize returns the size of the top-most of the layers diffIDs of a
+// full image, from its table of contents or else from the layer store, or 0
+// if neither has it.
+func (i *ImageService) fullLayerSize(operatingSystem string, diffIDs []layer.DiffID) int64 {
+	diffID := diffIDs[len(diffIDs)-1]
+	toc, err := i.simplifyTOCs.Get(diffID)
+	if err == nil {
+		return toc.FileSize()
+	}
+	if !os.IsNotExist(err) {
+		logrus.WithError(err).WithField("layer", diffID).Warn("failed to read table of contents of layer")
+	}
+	layerStore, ok := i.layerStores[operatingSystem]
+	if !ok {
+		return 0
+	}
+	l, err := layerStore.Get(layer.CreateChainID(diffIDs))
+	if err != nil {
+		return 0
+	}
+	defer layer.ReleaseAndLog(layerStore, l)
+	size, err := l.DiffSize()
+	if err != nil {
+		return 0
+	}
+	return size
+}
+
+// 修改
@@ -0,0 +1,274 @@
+package images // import "github.com/docker/docker/daemon/images"
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+
+	"github.com/docker/distribution/reference"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/daemon/simplify"
+	"github.com/docker/docker/errdefs"
+	"github.com/docker/docker/image"
+	"github.com/docker/docker/layer"
+	"github.com/docker/docker/pkg/archive"
+	"github.com/docker/docker/pkg/ioutils"
+	"github.com/docker/docker/pkg/progress"
+	"github.com/docker/docker/pkg/streamformatter"
+	"github.com/docker/docker/pkg/stringid"
+	"github.com/docker/docker/pkg/system"
+	units "github.com/docker/go-units"
+	"github.com/pkg/errors"
+)
+
+// 修改： 不运行容器，直接根据profile从本地镜像生成精简镜像
+
+// SimplifyImage creates a simplified image from the image source, keeping the
+// files of a profile along with the executables the image runs and their
+// libraries, and those matching the keep patterns of options. The profile of
+// options is used if set, or else the one stored for the image it names, or
+// for source. The new image is tagged with the target of options if set.
+// Progress is written to outStream. The source image is left untouched.
+// Simplifications of the same image are serialized.
+func (i *ImageService) SimplifyImage(ctx context.Context, source string, options types.ImageSimplifyOptions, outStream io.Writer) error {
+	newRef, err := simplifyTarget(options.Target)
+	if err != nil {
+		return err
+	}
+	if options.Threshold != nil {
+		if err := simplify.ValidateThreshold(*options.Threshold); err != nil {
+			return errdefs.InvalidParameter(err)
+		}
+	}
+	sel, err := simplify.NewSelector(options.Keep, options.Prune)
+	if err != nil {
+		return errdefs.InvalidParameter(err)
+	}
+
+	src, err := i.GetImage(source)
+	if err != nil {
+		return err
+	}
+	// 同一镜像的精简依次进行
+	i.simplifyLocks.Lock(src.ID().String())
+	defer i.simplifyLocks.Unlock(src.ID().String())
+	info, err := i.imageStore.GetSimplifyInfo(src.ID())
+	if err != nil {
+		return err
+	}
+	if info != nil && info.Parent != "" {
+		// 精简镜像缺少的文件只能按需拉取，应从完整镜像精简
+		return errdefs.InvalidParameter(errors.Errorf("image %s is already simplified, simplify its full image %s instead", source, info.Parent))
+	}
+	if info != nil && len(info.Layers) > 0 {
+		return errdefs.InvalidParameter(errors.Errorf("only the files kept by its profile were pulled for image %s, restore it with docker image desimplify first", source))
+	}
+	layerStore, ok := i.layerStores[src.OperatingSystem()]
+	if !ok {
+		return system.ErrNotSupportedOperatingSystem
+	}
+
+	var profile *simplify.Profile
+	switch {
+	case options.Profile != nil:
+		if profile, err = i.profileFromAPI(*options.Profile); err != nil {
+			return err
+		}
+	case options.ProfileFrom != "":
+		id, err := i.profileImageID(options.ProfileFrom)
+		if err != nil {
+			return err
+		}
+		if profile, err = i.storedProfile(options.ProfileFrom, id); err != nil {
+			return err
+		}
+	default:
+		if profile = i.simplifyProfile(src.ID()); profile == nil {
+			return errdefs.NotFound(errors.Errorf("no simplify profile for image %s", source))
+		}
+	}
+	threshold, err := i.simplifyThreshold(src.ID(), options.Threshold)
+	if err != nil {
+		return err
+	}
+
+	sel.KeepProfile(profile, threshold)
+	sel.KeepExecutables(src.Config)
+	sel.KeepLibraries()
+	if i.simplifyPlaceholders {
+		sel.LeavePlaceholders()
+	}
+
+	output := streamformatter.NewJSONProgressOutput(outStream, false)
+	keep, _ := profile.Split(threshold)
+	progress.Messagef(output, "", "Simplifying %s with %d of %d profiled files", source, len(keep), len(profile.Paths))
+
+	diffIDs := src.RootFS.DiffIDs
+	full := i.layerSources(layerStore, diffIDs)
+	for n, s := range full {
+		// 层按从上到下的顺序排列
+		full[n] = &progressSource{Source: s, out: output, size: diffSize(layerStore, diffIDs[:len(diffIDs)-n])}
+	}
+	empty, err := archive.Generate()
+	if err != nil {
+		return err
+	}
+	rc := simplify.Select(ctx, ioutil.NopCloser(empty), full, sel)
+	l, err := registerSimplified(layerStore, rc, src.RootFS.ChainID())
+	rc.Close()
+	if err != nil {
+		return err
+	}
+	defer layer.ReleaseAndLog(layerStore, l)
+
+	// 精简镜像的配置只取决于源镜像和保留的文件，各节点上的ID相同
+	created := src.Created
+	comment := "Simplified from " + src.ID().String()
+	config, err := json.Marshal(&image.Image{
+		V1Image: image.V1Image{
+			DockerVersion: src.DockerVersion,
+			Config:        src.Config,
+			Architecture:  src.Architecture,
+			OS:            src.OperatingSystem(),
+			Created:       created,
+			Comment:       comment,
+		},
+		RootFS: &image.RootFS{
+			Type:    "layers",
+			DiffIDs: []layer.DiffID{l.DiffID()},
+		},
+		History: []image.History{{
+			Created: created,
+			Comment: comment,
+		}},
+		OSFeatures: src.OSFeatures,
+		OSVersion:  src.OSVersion,
+	})
+	if err != nil {
+		return err
+	}
+	id, err := i.imageStore.Create(config)
+	if err != nil {
+		return err
+	}
+	if err := i.imageStore.SetParent(id, src.ID()); err != nil {
+		return err
+	}
+
+	simplified := &image.SimplifyInfo{Source: image.SimplifySourceImage, Parent: src.ID(), Layers: src.RootFS.DiffIDs, Threshold: threshold}
+	if options.Profile == nil {
+		simplified.Profile = profile.Image.String()
+	}
+	if simplified.FullSize, err = i.chainSize(layerStore, src.RootFS.ChainID()); err != nil {
+		return err
+	}
+	// 为源镜像的层生成tar目录，按需拉取时只读取需要的条目
+	i.indexLayers(layerStore, simplified.Layers)
+	if err := i.imageStore.SetSimplifyInfo(id, simplified); err != nil {
+		return err
+	}
+
+	var refName string
+	if newRef != nil {
+		if err := i.TagImageWithReference(id, newRef); err != nil {
+			return err
+		}
+		refName = reference.FamiliarString(newRef)
+	}
+	i.LogImageEventWithAttributes(id.String(), refName, "simplify", map[string]string{"parent": src.ID().String()})
+
+	summary, err := simplify.Summarize(ctx, i.layerSources(layerStore, []layer.DiffID{l.DiffID()}), full, sel.Below(), false)
+	if err != nil {
+		return err
+	}
+	progress.Messagef(output, "", "Kept %d files, pruned %d files, saved %s", summary.FilesKept, summary.FilesPruned, units.HumanSize(float64(summary.BytesSaved)))
+	progress.Aux(output, types.ImageSimplifyResult{
+		ID: id.String(),
+		Simplify: types.SimplifySummary{
+			FilesKept:           summary.FilesKept,
+			FilesPruned:         summary.FilesPruned,
+			BytesSaved:          summary.BytesSaved,
+			FilesBelowThreshold: summary.FilesBelowThreshold,
+		},
+	})
+	return nil
+}
+
+// simplifyTarget returns the reference target, repository:tag, the image
+// created by SimplifyImage is tagged with, or nil if target is empty.
+func simplifyTarget(target string) (reference.Named, error) {
+	if target == "" {
+		return nil, nil
+	}
+	ref, err := reference.ParseNormalizedNamed(target)
+	if err != nil {
+		return nil, errdefs.InvalidParameter(err)
+	}
+	if _, isCanonical := ref.(reference.Canonical); isCanonical {
+		return nil, errdefs.InvalidParameter(errors.New("refusing to create a tag with a digest reference"))
+	}
+	return reference.TagNameOnly(ref), nil
+}
+
+// targetReference returns the reference repository:tag the image created by
+// DesimplifyImage is tagged with, or nil if repository is empty.
+func targetReference(repository, tag string) (reference.Named, error) {
+	if repository == "" {
+		return nil, nil
+	}
+	ref, err := reference.ParseNormalizedNamed(repository)
+	if err != nil {
+		return nil, errdefs.InvalidParameter(err)
+	}
+	if _, isCanonical := ref.(reference.Canonical); isCanonical {
+		return nil, errdefs.InvalidParameter(errors.New("refusing to create a tag with a digest reference"))
+	}
+	if tag != "" {
+		if ref, err = reference.WithTag(reference.TrimNamed(ref), tag); err != nil {
+			return nil, errdefs.InvalidParameter(err)
+		}
+	}
+	return ref, nil
+}
+
+// diffSize returns the size of the top layer of the chain diffIDs, or 0 if it
+// is not in the layer store.
+func diffSize(layerStore layer.Store, diffIDs []layer.DiffID) int64 {
+	l, err := layerStore.Get(layer.CreateChainID(diffIDs))
+	if err != nil {
+		return 0
+	}
+	defer layer.ReleaseAndLog(layerStore, l)
+	size, _ := l.DiffSize()
+	return size
+}
+
+// progressSource reports the progress of reading a layer of the full image.
+type progressSource struct {
+	simplify.Source
+	out  progress.Output
+	size int64
+}
+
+func (s *progressSource) Open(ctx context.Context) (io.ReadCloser, error) {
+	rc, err := s.Source.Open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return layerProgress(rc, s.out, s.DiffID(), s.size, "Processing", "Processed"), nil
+}
+
+// layerProgress reports the progress of reading the layer diffID, of the
+// given size, from rc to out as action, and done once rc is closed.
+func layerProgress(rc io.ReadCloser, out progress.Output, diffID layer.DiffID, size int64, action, done string) io.ReadCloser {
+	id := stringid.TruncateID(diffID.String())
+	pr := progress.NewProgressReader(rc, out, size, id, action)
+	return ioutils.NewReadCloserWrapper(pr, func() error {
+		err := pr.Close()
+		progress.Update(out, id, done)
+		return err
+	})
+}
+
+// 修改
@@ -0,0 +1,156 @@
+package images // import "github.com/docker/docker/daemon/images"
+
+import (
+	"context"
+	"io"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/daemon/simplify"
+	"github.com/docker/docker/distribution"
+	"github.com/docker/docker/errdefs"
+	"github.com/docker/docker/image"
+	"github.com/docker/docker/layer"
+	"github.com/docker/docker/pkg/progress"
+	"github.com/docker/docker/pkg/streamformatter"
+	"github.com/docker/docker/pkg/system"
+	units "github.com/docker/go-units"
+	"github.com/pkg/errors"
+)
+
+// 修改： 提前将精简镜像缺失的文件全部或按路径拉取到缓存
+
+// PrefetchImage fetches the files pruned from the simplified image name into
+// the cache its containers find missing files in, so that they are not
+// fetched on demand. Only the files matching one of the globs paths, or
+// inside a directory matching one, are fetched if paths is not empty. It can
+// run while containers of the image are running, and resumes where an
+// interrupted prefetch stopped. Progress is written to outStream.
+func (i *ImageService) PrefetchImage(ctx context.Context, name string, paths []string, outStream io.Writer) error {
+	if err := simplify.ValidatePrefetchPatterns(paths); err != nil {
+		return errdefs.InvalidParameter(err)
+	}
+	img, layerStore, diffIDs, err := i.prefetchableImage(name)
+	if err != nil {
+		return err
+	}
+
+	output := streamformatter.NewJSONProgressOutput(outStream, false)
+	res, err := i.simplifyFetch.PrefetchImage(ctx, img.ID().Digest().Hex(), i.layerSources(layerStore, diffIDs), prefetchOptions(layerStore, diffIDs, paths, output))
+	if err != nil {
+		return errors.Wrapf(err, "failed to prefetch image %s", name)
+	}
+
+	progress.Messagef(output, "", "Prefetched %d files, %s", res.Files, units.HumanSize(float64(res.Bytes)))
+	progress.Aux(output, types.ImagePrefetchResult{Files: res.Files, Bytes: res.Bytes})
+	return nil
+}
+
+// prefetchableImage returns the simplified image name, along with the layer
+// store and the layers of its full image, bottom-most first, if the files
+// pruned from it can be fetched.
+func (i *ImageService) prefetchableImage(name string) (*image.Image, layer.Store, []layer.DiffID, error) {
+	if i.simplifyFetch == nil {
+		return nil, nil, nil, errdefs.NotImplemented(errors.New("files pruned from simplified images cannot be fetched on this daemon"))
+	}
+	img, err := i.GetImage(name)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	layerStore, ok := i.layerStores[img.OperatingSystem()]
+	if !ok {
+		return nil, nil, nil, system.ErrNotSupportedOperatingSystem
+	}
+	info, err := i.imageStore.GetSimplifyInfo(img.ID())
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if info == nil {
+		return nil, nil, nil, errdefs.InvalidParameter(errors.Errorf("image %s is not a simplified image", name))
+	}
+	if info.Source == image.SimplifySourceRegistry && info.Annotations[distribution.AnnotationSimplified] == "true" {
+		return nil, nil, nil, errdefs.InvalidParameter(errors.Errorf("files pruned from image %s cannot be fetched: its full image %s was not pulled", name, info.Annotations[distribution.AnnotationSimplifyFullImage]))
+	}
+	diffIDs, err := i.simplifyFullLayers(img.ID())
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if len(diffIDs) == 0 {
+		return nil, nil, nil, errdefs.InvalidParameter(errors.Errorf("image %s holds every file of its full image, there is nothing to fetch", name))
+	}
+	return img, layerStore, diffIDs, nil
+}
+
+// prefetchOptions returns the options prefetching the files of the layers
+// diffIDs matching paths, reporting the progress of reading them to output.
+func prefetchOptions(layerStore layer.Store, diffIDs []layer.DiffID, paths []string, output progress.Output) simplify.PrefetchOptions {
+	sizes := make(map[layer.DiffID]int64, len(diffIDs))
+	for n, diffID := range diffIDs {
+		// 不在本地的层从registry读取，大小未知
+		sizes[diffID] = diffSize(layerStore, diffIDs[:n+1])
+	}
+	return simplify.PrefetchOptions{
+		Patterns: paths,
+		Progress: func(diffID layer.DiffID, rc io.ReadCloser) io.ReadCloser {
+			return layerProgress(rc, output, diffID, sizes[diffID], "Prefetching", "Prefetched")
+		},
+	}
+}
+
+// 修改
+
+// 修改： 固定缓存中的路径，淘汰时保留
+
+// PinImage pins the paths matching one of the globs paths, or inside a
+// directory matching one, in the cache of the simplified image name, and
+// fetches the files pruned from it among them at once. Pinned files are not
+// evicted, however full the disk, until they are unpinned. Progress is
+// written to outStream.
+func (i *ImageService) PinImage(ctx context.Context, name string, paths []string, outStream io.Writer) error {
+	if len(paths) == 0 {
+		return errdefs.InvalidParameter(errors.New("no paths to pin"))
+	}
+	if err := simplify.ValidatePrefetchPatterns(paths); err != nil {
+		return errdefs.InvalidParameter(err)
+	}
+	img, layerStore, diffIDs, err := i.prefetchableImage(name)
+	if err != nil {
+		return err
+	}
+
+	output := streamformatter.NewJSONProgressOutput(outStream, false)
+	res, err := i.simplifyFetch.Pin(ctx, img.ID().Digest().Hex(), i.layerSources(layerStore, diffIDs), prefetchOptions(layerStore, diffIDs, paths, output))
+	if err != nil {
+		return errors.Wrapf(err, "failed to pin paths of image %s", name)
+	}
+
+	progress.Messagef(output, "", "Pinned %d paths, prefetched %d files, %s", len(paths), res.Files, units.HumanSize(float64(res.Bytes)))
+	progress.Aux(output, types.ImagePrefetchResult{Files: res.Files, Bytes: res.Bytes})
+	return nil
+}
+
+// UnpinImage unpins the globs paths from the cache of the image name, so
+// that the files matching them may be evicted again. The paths that were
+// pinned are unpinned even if others were not.
+func (i *ImageService) UnpinImage(name string, paths []string) error {
+	if len(paths) == 0 {
+		return errdefs.InvalidParameter(errors.New("no paths to unpin"))
+	}
+	if i.simplifyFetch == nil {
+		return errdefs.NotImplemented(errors.New("files pruned from simplified images cannot be fetched on this daemon"))
+	}
+	img, err := i.GetImage(name)
+	if err != nil {
+		return err
+	}
+	notPinned, err := i.simplifyFetch.Unpin(img.ID().Digest().Hex(), paths)
+	if err != nil {
+		return errdefs.System(err)
+	}
+	if len(notPinned) > 0 {
+		return errdefs.InvalidParameter(errors.Errorf("not pinned in image %s: %s", name, strings.Join(notPinned, ", ")))
+	}
+	return nil
+}
+
+// 修改
@@ -0,0 +1,325 @@
+package images // import "github.com/docker/docker/daemon/images"
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/docker/distribution/reference"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/container"
+	"github.com/docker/docker/daemon/simplify"
+	"github.com/docker/docker/errdefs"
+	"github.com/docker/docker/image"
+	"github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// 修改： 按镜像保存和管理记录的文件访问
+
+// SaveSimplifyProfile stores p, recorded by a container, as the profile of
+// the image it ran.
+func (i *ImageService) SaveSimplifyProfile(p *simplify.Profile) error {
+	stored := *p
+	stored.Created = time.Time{}
+	return i.simplifyProfiles.Put(p.Image, &stored)
+}
+
+// imagePlatform returns the platform of the image id, as profiles are
+// stored for, or an empty string if the image is gone.
+func (i *ImageService) imagePlatform(id image.ID) string {
+	img, err := i.imageStore.Get(id)
+	if err != nil {
+		return ""
+	}
+	return simplify.FormatPlatform(img.OperatingSystem(), img.Architecture)
+}
+
+// simplifyProfile returns the profile stored for the image id on its
+// platform, or nil if there is none.
+func (i *ImageService) simplifyProfile(id image.ID) *simplify.Profile {
+	if id == "" {
+		return nil
+	}
+	p, _, err := i.simplifyProfiles.Lookup(id.Digest(), i.imagePlatform(id))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logrus.WithError(err).WithField("image", id).Warn("failed to read simplify profile")
+		}
+		return nil
+	}
+	return p
+}
+
+// profileStale returns true if the image p was recorded for is gone, or if
+// the name it was run by now refers to another image.
+func (i *ImageService) profileStale(p *simplify.Profile) bool {
+	if _, err := i.imageStore.Get(image.ID(p.Image)); err != nil {
+		return true
+	}
+	ref, err := reference.ParseNormalizedNamed(p.Reference)
+	if err != nil {
+		return false
+	}
+	id, err := i.referenceStore.Get(reference.TagNameOnly(ref))
+	return err == nil && id != p.Image
+}
+
+// profileImageID returns the ID of the image name refers to. Profiles of
+// images that no longer exist can be referred to by full image ID.
+func (i *ImageService) profileImageID(name string) (digest.Digest, error) {
+	img, err := i.GetImage(name)
+	if err == nil {
+		return img.ID().Digest(), nil
+	}
+	id, perr := digest.Parse(name)
+	if perr != nil {
+		id = digest.NewDigestFromHex(string(digest.SHA256), name)
+	}
+	if id.Validate() != nil {
+		return "", err
+	}
+	if _, _, perr := i.simplifyProfiles.Lookup(id, ""); perr != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+func profileCreated(p *simplify.Profile) string {
+	return p.Created.Format(time.RFC3339Nano)
+}
+
+// ImageProfiles returns the profiles stored for images.
+func (i *ImageService) ImageProfiles() ([]*types.ImageProfileSummary, error) {
+	keys, err := i.simplifyProfiles.List()
+	if err != nil {
+		return nil, err
+	}
+	summaries := []*types.ImageProfileSummary{}
+	for _, key := range keys {
+		p, err := i.simplifyProfiles.Get(key.Image, key.Platform)
+		if err != nil {
+			// 列出时被删除
+			continue
+		}
+		summaries = append(summaries, &types.ImageProfileSummary{
+			Image:     p.Image.String(),
+			Reference: p.Reference,
+			Platform:  p.Platform,
+			Created:   profileCreated(p),
+			Stale:     i.profileStale(p),
+			Files:     len(p.Paths),
+			Runs:      p.NumRuns(),
+		})
+	}
+	return summaries, nil
+}
+
+// storedProfile returns the profile stored for the image id on its
+// platform, or on any if the image is gone. name is the name id was referred
+// to by.
+func (i *ImageService) storedProfile(name string, id digest.Digest) (*simplify.Profile, error) {
+	platform := i.imagePlatform(image.IDFromDigest(id))
+	p, recorded, err := i.simplifyProfiles.Lookup(id, platform)
+	if os.IsNotExist(err) {
+		if len(recorded) > 0 {
+			return nil, errdefs.NotFound(errors.Errorf("no simplify profile for image %s on %s, only on %s", name, platform, strings.Join(recorded, ", ")))
+		}
+		return nil, errdefs.NotFound(errors.Errorf("no simplify profile for image %s", name))
+	}
+	if err != nil {
+		return nil, errdefs.System(err)
+	}
+	return p, nil
+}
+
+// ImageProfile returns the profile stored for the image name.
+func (i *ImageService) ImageProfile(name string) (*types.ImageProfile, error) {
+	id, err := i.profileImageID(name)
+	if err != nil {
+		return nil, err
+	}
+	p, err := i.storedProfile(name, id)
+	if err != nil {
+		return nil, err
+	}
+	return &types.ImageProfile{
+		Image:     p.Image.String(),
+		Reference: p.Reference,
+		Platform:  p.Platform,
+		Created:   profileCreated(p),
+		Stale:     i.profileStale(p),
+		Truncated: p.Truncated,
+		Paths:     p.Paths,
+		Runs:      p.Runs,
+		Counts:    p.Counts,
+	}, nil
+}
+
+// ImageProfileSave stores profile as the profile of the image name,
+// replacing any previous one.
+func (i *ImageService) ImageProfileSave(name string, profile types.ImageProfile) error {
+	img, err := i.GetImage(name)
+	if err != nil {
+		return err
+	}
+	p, err := i.profileFromAPI(profile)
+	if err != nil {
+		return err
+	}
+	p.Platform = i.imagePlatform(img.ID())
+	return i.simplifyProfiles.Put(img.ID().Digest(), p)
+}
+
+// profileFromAPI validates profile, given through the API, and returns it
+// with its paths cleaned and sorted.
+func (i *ImageService) profileFromAPI(profile types.ImageProfile) (*simplify.Profile, error) {
+	p := &simplify.Profile{Reference: profile.Reference, Platform: profile.Platform, Truncated: profile.Truncated, Paths: profile.Paths, Runs: profile.Runs, Counts: profile.Counts}
+	b, err := json.Marshal(p)
+	if err != nil {
+		return nil, errdefs.InvalidParameter(err)
+	}
+	if p, err = simplify.ParseProfile(b, i.maxProfileSize()); err != nil {
+		return nil, errdefs.InvalidParameter(err)
+	}
+	return p, nil
+}
+
+// parseProfile validates the profile b, pushed along with an image or saved
+// with it.
+func (i *ImageService) parseProfile(b []byte) (*simplify.Profile, error) {
+	p, err := simplify.ParseProfile(b, i.maxProfileSize())
+	if err != nil {
+		return nil, errdefs.InvalidParameter(err)
+	}
+	return p, nil
+}
+
+// maxProfileSize returns the largest profile, in bytes, the daemon uses.
+func (i *ImageService) maxProfileSize() int64 {
+	if i.simplifyMaxProfileSize <= 0 {
+		return simplify.DefaultMaxProfileSize
+	}
+	return i.simplifyMaxProfileSize
+}
+
+// suppliedProfile validates profile, given along with a pull or a commit of
+// the image id of platform, and returns it as recorded for id on platform.
+// Unless force is set, a profile recorded for another image or on another
+// platform is rejected.
+func (i *ImageService) suppliedProfile(profile *types.ImageProfile, id digest.Digest, platform string, force bool) (*simplify.Profile, error) {
+	p, err := i.profileFromAPI(*profile)
+	if err != nil {
+		return nil, err
+	}
+	if profile.Image != "" && profile.Image != id.String() && !force {
+		return nil, errdefs.InvalidParameter(errors.Errorf("profile was recorded for image %s, not %s", profile.Image, id))
+	}
+	if profile.Platform != "" && platform != "" && profile.Platform != platform && !force {
+		return nil, errdefs.InvalidParameter(errors.Errorf("profile was recorded on %s, not %s", profile.Platform, platform))
+	}
+	p.Image = id
+	if platform != "" {
+		p.Platform = platform
+	}
+	return p, nil
+}
+
+// ImageProfileDelete removes the profile stored for the image name.
+func (i *ImageService) ImageProfileDelete(name string) error {
+	id, err := i.profileImageID(name)
+	if err != nil {
+		return err
+	}
+	p, err := i.storedProfile(name, id)
+	if err != nil {
+		return err
+	}
+	err = i.simplifyProfiles.Delete(id, p.Platform)
+	if os.IsNotExist(err) {
+		return errdefs.NotFound(errors.Errorf("no simplify profile for image %s", name))
+	}
+	return err
+}
+
+// runProfile returns the profile recorded by the last run of the container
+// name, or nil if there is no such container.
+func (i *ImageService) runProfile(name string) (*simplify.Profile, error) {
+	var found *container.Container
+	for _, c := range i.containers.List() {
+		if c.ID == name || c.Name == "/"+name {
+			found = c
+			break
+		}
+		if strings.HasPrefix(c.ID, name) {
+			if found != nil {
+				return nil, errdefs.InvalidParameter(errors.Errorf("multiple containers found with provided prefix: %s", name))
+			}
+			found = c
+		}
+	}
+	if found == nil {
+		return nil, nil
+	}
+	p, err := simplify.LoadProfile(simplify.RunProfilePath(found.Root))
+	if os.IsNotExist(err) {
+		return nil, errdefs.NotFound(errors.Errorf("no files were recorded for container %s", found.ID))
+	}
+	return p, err
+}
+
+// ImageProfileMerge merges the profiles of sources into the profile of the
+// image target, replacing it. A source is either a container, whose last
+// recorded run is merged, or an image, whose profile is merged. Unless force
+// is true, every source must have been recorded for the target image.
+func (i *ImageService) ImageProfileMerge(target string, sources []string, force bool) (*types.ImageProfileSummary, error) {
+	img, err := i.GetImage(target)
+	if err != nil {
+		return nil, err
+	}
+	id := img.ID().Digest()
+	var profiles []*simplify.Profile
+	for _, source := range sources {
+		p, err := i.runProfile(source)
+		if err != nil {
+			return nil, err
+		}
+		if p == nil {
+			pid, err := i.profileImageID(source)
+			if err != nil {
+				return nil, err
+			}
+			if p, err = i.storedProfile(source, pid); err != nil {
+				return nil, err
+			}
+		}
+		if p.Image != id && !force {
+			return nil, errdefs.InvalidParameter(errors.Errorf("profile of %s was recorded for image %s, not %s", source, p.Image, id))
+		}
+		profiles = append(profiles, p)
+	}
+
+	merged, err := simplify.MergeProfiles(profiles)
+	if err != nil {
+		return nil, errdefs.InvalidParameter(err)
+	}
+	if !strings.HasPrefix(id.Hex(), strings.TrimPrefix(target, "sha256:")) {
+		// 目标以名称而不是ID指定
+		merged.Reference = target
+	}
+	merged.Platform = i.imagePlatform(img.ID())
+	if err := i.simplifyProfiles.Put(id, merged); err != nil {
+		return nil, err
+	}
+	return &types.ImageProfileSummary{
+		Image:     merged.Image.String(),
+		Reference: merged.Reference,
+		Platform:  merged.Platform,
+		Created:   profileCreated(merged),
+		Stale:     i.profileStale(merged),
+		Files:     len(merged.Paths),
+		Runs:      merged.NumRuns(),
+	}, nil
+}
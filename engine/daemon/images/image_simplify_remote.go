@@ -0,0 +1,208 @@
+package images // import "github.com/docker/docker/daemon/images"
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+
+	dist "github.com/docker/distribution"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/docker/distribution/registry/client"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/daemon/simplify"
+	"github.com/docker/docker/distribution"
+	"github.com/docker/docker/distribution/metadata"
+	"github.com/docker/docker/registry"
+	"github.com/sirupsen/logrus"
+)
+
+// 修改： 按需拉取时与拉取一样经registry服务解析endpoint
+
+// simplifyRemotes opens the layer blobs of full images from the registries
+// they were pulled from. Endpoints are looked up through the registry
+// service like pulls do, so that registry mirrors, insecure registries and
+// the certificates of certs.d apply, and the credentials of the last
+// simplified pull of each repository are used. Credentials are only kept in
+// memory: after a restart, files are fetched anonymously until the image is
+// pulled again.
+type simplifyRemotes struct {
+	registryService registry.Service
+
+	mu sync.Mutex
+	// auths are the credentials of each repository name
+	auths map[string]types.AuthConfig
+	// repos are the repositories connected to, so that each fetch does not
+	// ping the registry and authenticate again
+	repos map[remoteRepo]dist.Repository
+}
+
+// remoteRepo is a repository name at an endpoint.
+type remoteRepo struct {
+	name     string
+	endpoint string
+}
+
+func newSimplifyRemotes(registryService registry.Service) *simplifyRemotes {
+	return &simplifyRemotes{
+		registryService: registryService,
+		auths:           make(map[string]types.AuthConfig),
+		repos:           make(map[remoteRepo]dist.Repository),
+	}
+}
+
+// setAuth sets the credentials files of the images of the repository of ref
+// are fetched with, anonymously if authConfig is empty.
+func (r *simplifyRemotes) setAuth(ref reference.Named, authConfig *types.AuthConfig) {
+	repoInfo, err := r.registryService.ResolveRepository(ref)
+	if err != nil {
+		return
+	}
+	name := repoInfo.Name.Name()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if authConfig == nil || *authConfig == (types.AuthConfig{}) {
+		delete(r.auths, name)
+	} else {
+		r.auths[name] = *authConfig
+	}
+	// 凭据变化后重新认证
+	for key := range r.repos {
+		if key.name == name {
+			delete(r.repos, key)
+		}
+	}
+}
+
+// reset drops the repositories connected to, once the mirrors or the
+// insecure registries are reloaded.
+func (r *simplifyRemotes) reset() {
+	r.mu.Lock()
+	r.repos = make(map[remoteRepo]dist.Repository)
+	r.mu.Unlock()
+}
+
+// openBlob opens the blob of meta, as stored in the registry, from the first
+// endpoint of the repository it was pulled from that has it.
+func (r *simplifyRemotes) openBlob(ctx context.Context, meta metadata.V2Metadata) (dist.ReadSeekCloser, error) {
+	named, err := reference.ParseNormalizedNamed(meta.SourceRepository)
+	if err != nil {
+		return nil, err
+	}
+	repoInfo, err := r.registryService.ResolveRepository(named)
+	if err != nil {
+		return nil, err
+	}
+	endpoints, err := r.registryService.LookupPullEndpoints(reference.Domain(repoInfo.Name))
+	if err != nil {
+		return nil, err
+	}
+	var (
+		lastErr = fmt.Errorf("no v2 endpoint for %s", repoInfo.Name)
+		credErr error
+	)
+	for _, endpoint := range endpoints {
+		if endpoint.Version == registry.APIVersion1 {
+			continue
+		}
+		key := remoteRepo{name: repoInfo.Name.Name(), endpoint: endpoint.URL.String()}
+		repo, cached, err := r.repository(ctx, key, repoInfo, endpoint)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		// Open只在读取时才发出请求，先确认该endpoint有这个blob，没有时与拉取一样换下一个
+		blobs := repo.Blobs(ctx)
+		_, err = blobs.Stat(ctx, meta.Digest)
+		if isAuthError(err) && cached {
+			// token过期或被撤销，重新走一遍认证流程
+			r.drop(key)
+			if repo, _, err = r.repository(ctx, key, repoInfo, endpoint); err == nil {
+				blobs = repo.Blobs(ctx)
+				_, err = blobs.Stat(ctx, meta.Digest)
+			}
+		}
+		if isAuthError(err) {
+			err = simplify.CredentialsError{Repository: key.name, Err: err}
+			credErr = err
+		}
+		if err != nil {
+			if err != dist.ErrBlobUnknown {
+				r.drop(key)
+			}
+			logrus.WithError(err).WithField("endpoint", key.endpoint).Debugf("cannot fetch blob %s", meta.Digest)
+			lastErr = err
+			continue
+		}
+		blob, err := blobs.Open(ctx, meta.Digest)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		return blob, nil
+	}
+	if credErr != nil {
+		// 其它endpoint的错误多半只是换了协议，凭据被拒的原因更明确
+		return nil, credErr
+	}
+	return nil, lastErr
+}
+
+// repository returns the repository key, connecting to it if it is not yet,
+// and whether it was already connected to.
+func (r *simplifyRemotes) repository(ctx context.Context, key remoteRepo, repoInfo *registry.RepositoryInfo, endpoint registry.APIEndpoint) (dist.Repository, bool, error) {
+	r.mu.Lock()
+	repo, ok := r.repos[key]
+	authConfig := r.auths[key.name]
+	r.mu.Unlock()
+	if ok {
+		return repo, true, nil
+	}
+	repo, _, err := distribution.NewV2Repository(ctx, repoInfo, endpoint, nil, &authConfig, "pull")
+	if err != nil {
+		return nil, false, err
+	}
+	r.mu.Lock()
+	r.repos[key] = repo
+	r.mu.Unlock()
+	return repo, false, nil
+}
+
+// drop forgets the repository key, connecting to it again on the next fetch.
+func (r *simplifyRemotes) drop(key remoteRepo) {
+	r.mu.Lock()
+	delete(r.repos, key)
+	r.mu.Unlock()
+}
+
+// isAuthError returns true if err is the registry rejecting the credentials
+// or the token of a request, including when a new token is requested.
+func isAuthError(err error) bool {
+	if uerr, ok := err.(*url.Error); ok {
+		err = uerr.Err
+	}
+	switch e := err.(type) {
+	case errcode.Errors:
+		for _, err := range e {
+			if isAuthError(err) {
+				return true
+			}
+		}
+	case errcode.Error:
+		return e.Code == errcode.ErrorCodeUnauthorized || e.Code == errcode.ErrorCodeDenied
+	case *client.UnexpectedHTTPResponseError:
+		return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden
+	}
+	return false
+}
+
+// ResetSimplifyRemotes makes the following fetches of files of simplified
+// images connect to the registries again, once the registry configuration
+// is reloaded.
+func (i *ImageService) ResetSimplifyRemotes() {
+	i.simplifyRemotes.reset()
+}
+
+// 修改
@@ -0,0 +1,179 @@
+package images // import "github.com/docker/docker/daemon/images"
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/docker/docker/daemon/graphdriver"
+	"github.com/docker/docker/distribution"
+	"github.com/docker/docker/distribution/metadata"
+	"github.com/docker/docker/errdefs"
+	"github.com/docker/docker/image"
+	"github.com/docker/docker/image/tarexport"
+	"github.com/docker/docker/layer"
+	"github.com/docker/docker/pkg/progress"
+	"github.com/docker/docker/pkg/system"
+	"github.com/pkg/errors"
+)
+
+// 修改： 保存与加载精简镜像
+
+// pushedSimplified returns true if the image info is recorded for was pushed
+// as a simplified image, whose pruned files cannot be fetched.
+func pushedSimplified(info *image.SimplifyInfo) bool {
+	return info.Source == image.SimplifySourceRegistry && info.Annotations[distribution.AnnotationSimplified] == "true"
+}
+
+// RestoreSimplified returns the full image restored from the simplified
+// image id, so that a regular archive holds every file of the image. Layers
+// of the full image missing from the layer store are downloaded from the
+// registry they were pulled from.
+func (i *ImageService) RestoreSimplified(id image.ID) (*image.Image, func(), error) {
+	info, err := i.imageStore.GetSimplifyInfo(id)
+	if err != nil || info == nil {
+		return nil, nil, err
+	}
+	if pushedSimplified(info) {
+		return nil, nil, errdefs.Unavailable(errors.Errorf("files pruned from image %s cannot be fetched: its full image was not pulled, save it as a simplified archive instead", id))
+	}
+	if info.Parent == "" && len(info.Layers) == 0 {
+		// 拉取时精简的镜像内容完整
+		return nil, nil, nil
+	}
+	img, err := i.imageStore.Get(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	// 使用原镜像的创建时间，多次保存得到相同的镜像
+	restored, err := i.restoreFull(context.Background(), id.String(), img, info, img.Created, progress.DiscardOutput())
+	if err != nil {
+		return nil, nil, err
+	}
+	return restored.image, restored.release, nil
+}
+
+// SaveSimplified returns the simplification data of the simplified image id
+// for a simplified archive, along with the registry blobs the layers of its
+// full image can be fetched from.
+func (i *ImageService) SaveSimplified(id image.ID) (*tarexport.SimplifiedImage, error) {
+	info, err := i.imageStore.GetSimplifyInfo(id)
+	if err != nil || info == nil {
+		return nil, err
+	}
+	if !pushedSimplified(info) && info.Parent == "" && len(info.Layers) == 0 {
+		return nil, nil
+	}
+	s := &tarexport.SimplifiedImage{Info: *info}
+	if s.Info.Layers, err = i.simplifyFullLayers(id); err != nil {
+		return nil, err
+	}
+	v2MetadataService := metadata.NewV2MetadataService(i.distributionMetadataStore)
+	for _, diffID := range s.Info.Layers {
+		metas, err := v2MetadataService.GetMetadata(diffID)
+		if err != nil {
+			continue
+		}
+		for _, meta := range metas {
+			if s.Sources == nil {
+				s.Sources = make(map[layer.DiffID][]tarexport.LayerSource)
+			}
+			s.Sources[diffID] = append(s.Sources[diffID], tarexport.LayerSource{Digest: meta.Digest, Repository: meta.SourceRepository})
+		}
+	}
+	for _, diffID := range s.Info.Layers {
+		// 加载后按需拉取单个文件时使用层的目录
+		if toc, err := i.simplifyTOCs.Get(diffID); err == nil {
+			if s.TOCs == nil {
+				s.TOCs = make(map[layer.DiffID]*layer.TOC)
+			}
+			s.TOCs[diffID] = toc
+		}
+	}
+	if info.Profile != "" {
+		if p := i.simplifyProfile(image.ID(info.Profile)); p != nil {
+			if s.Profile, err = json.Marshal(p); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return s, nil
+}
+
+// CheckSimplified checks that the storage driver for os supports simplified
+// images, and that every layer of the full image of the simplified image s
+// is either in the layer store or known to a registry, so that its pruned
+// files can be fetched once it is loaded.
+func (i *ImageService) CheckSimplified(s *tarexport.SimplifiedImage, os string) error {
+	if pushedSimplified(&s.Info) {
+		// 与拉取推送的精简镜像相同，缺少的文件本就无法拉取
+		return nil
+	}
+	layerStore, ok := i.layerStores[os]
+	if !ok {
+		return system.ErrNotSupportedOperatingSystem
+	}
+	if driver := layerStore.DriverName(); !graphdriver.SupportsSimplify(driver) {
+		return errdefs.NotImplemented(errors.Errorf("cannot load simplified image: the %s storage driver does not support simplified images, save the image as a regular archive instead", driver))
+	}
+	if len(s.Info.Layers) == 0 {
+		return errdefs.InvalidParameter(errors.New("invalid simplified image: the layers of its full image are not listed"))
+	}
+	v2MetadataService := metadata.NewV2MetadataService(i.distributionMetadataStore)
+	for n, diffID := range s.Info.Layers {
+		if l, err := layerStore.Get(layer.CreateChainID(s.Info.Layers[:n+1])); err == nil {
+			layer.ReleaseAndLog(layerStore, l)
+			continue
+		}
+		if len(s.Sources[diffID]) > 0 {
+			continue
+		}
+		if metas, err := v2MetadataService.GetMetadata(diffID); err == nil && len(metas) > 0 {
+			continue
+		}
+		return errdefs.InvalidParameter(errors.Errorf("cannot load simplified image: layer %s of its full image is neither loaded nor known to a registry, save the image as a regular archive instead", diffID))
+	}
+	return nil
+}
+
+// LoadSimplified records the simplification data of the simplified image id
+// loaded from a simplified archive, and the registry blobs the layers of its
+// full image can be fetched from.
+func (i *ImageService) LoadSimplified(id image.ID, s *tarexport.SimplifiedImage) error {
+	info := s.Info
+	v2MetadataService := metadata.NewV2MetadataService(i.distributionMetadataStore)
+	for diffID, sources := range s.Sources {
+		for _, src := range sources {
+			if err := v2MetadataService.Add(diffID, metadata.V2Metadata{Digest: src.Digest, SourceRepository: src.Repository}); err != nil {
+				return err
+			}
+		}
+	}
+	for diffID, toc := range s.TOCs {
+		if i.simplifyTOCs.Has(diffID) {
+			continue
+		}
+		if err := i.simplifyTOCs.Put(diffID, toc); err != nil {
+			return err
+		}
+	}
+	if info.Parent != "" {
+		// 完整镜像不在本地时，从完整镜像的层按需拉取
+		if _, err := i.imageStore.Get(info.Parent); err != nil {
+			info.Parent = ""
+		}
+	}
+	info.Profile = ""
+	if s.Profile != nil {
+		p, err := i.parseProfile(s.Profile)
+		if err != nil {
+			return err
+		}
+		if err := i.simplifyProfiles.Put(id.Digest(), p); err != nil {
+			return err
+		}
+		info.Profile = id.String()
+	}
+	return i.imageStore.SetSimplifyInfo(id, &info)
+}
+
+// 修改
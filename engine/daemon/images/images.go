@@ -15,6 +15,7 @@ import (
 	"github.com/docker/docker/image"
 	"github.com/docker/docker/layer"
 	"github.com/docker/docker/pkg/system"
+	"github.com/sirupsen/logrus"
 )
 
 var acceptedImageFilterTags = map[string]bool{
@@ -23,6 +24,9 @@ var acceptedImageFilterTags = map[string]bool{
 	"before":    true,
 	"since":     true,
 	"reference": true,
+	// 修改： 按是否为精简镜像过滤
+	"simplified": true,
+	// 修改
 }
 
 // byCreated is a temporary type used to sort a list of images by creation
@@ -61,6 +65,19 @@ func (i *ImageService) Images(imageFilters filters.Args, all bool, withExtraAttr
 			return nil, invalidFilter{"dangling", imageFilters.Get("dangling")}
 		}
 	}
+	// 修改： simplified=true只列出精简镜像，simplified=false只列出其余镜像
+	var simplifiedOnly, fullOnly bool
+	if imageFilters.Contains("simplified") {
+		if imageFilters.ExactMatch("simplified", "true") {
+			simplifiedOnly = true
+		} else if imageFilters.ExactMatch("simplified", "false") {
+			fullOnly = true
+		} else {
+			return nil, invalidFilter{"simplified", imageFilters.Get("simplified")}
+		}
+	}
+	// 修改
+
 	if danglingOnly {
 		allImages = i.imageStore.Heads()
 	} else {
@@ -84,6 +101,13 @@ func (i *ImageService) Images(imageFilters filters.Args, all bool, withExtraAttr
 		return nil, err
 	}
 
+	// 修改： 精简镜像与完整镜像都列出拉取时的digest引用
+	variantDigests, err := i.variantDigests()
+	if err != nil {
+		return nil, err
+	}
+	// 修改
+
 	images := []*types.ImageSummary{}
 	var imagesMap map[*image.Image]*types.ImageSummary
 	var layerRefs map[layer.ChainID]int
@@ -143,6 +167,17 @@ func (i *ImageService) Images(imageFilters filters.Args, all bool, withExtraAttr
 
 		newImage := newImage(img, size)
 
+		// 修改： 标记精简镜像
+		info, err := i.imageStore.GetSimplifyInfo(id)
+		if err != nil {
+			return nil, err
+		}
+		newImage.Simplified = info != nil
+		if (simplifiedOnly && !newImage.Simplified) || (fullOnly && newImage.Simplified) {
+			continue
+		}
+		// 修改
+
 		for _, ref := range i.referenceStore.References(id.Digest()) {
 			if imageFilters.Contains("reference") {
 				var found bool
@@ -164,6 +199,22 @@ func (i *ImageService) Images(imageFilters filters.Args, all bool, withExtraAttr
 				newImage.RepoTags = append(newImage.RepoTags, reference.FamiliarString(ref))
 			}
 		}
+		// 修改
+		for _, ref := range variantDigests[id] {
+			found := !imageFilters.Contains("reference")
+			for _, pattern := range imageFilters.Get("reference") {
+				matched, err := reference.FamiliarMatch(pattern, ref)
+				if err != nil {
+					return nil, err
+				}
+				found = found || matched
+			}
+			digestRef := reference.FamiliarString(ref)
+			if found && !containsString(newImage.RepoDigests, digestRef) {
+				newImage.RepoDigests = append(newImage.RepoDigests, digestRef)
+			}
+		}
+		// 修改
 		if newImage.RepoDigests == nil && newImage.RepoTags == nil {
 			if all || len(i.imageStore.Children(id)) == 0 {
 
@@ -192,6 +243,17 @@ func (i *ImageService) Images(imageFilters filters.Args, all bool, withExtraAttr
 				layerRefs = make(map[layer.ChainID]int)
 			}
 
+			// 修改： 统计精简镜像实际占用的空间，包括按需拉取的文件
+			if newImage.Simplified {
+				simplified, err := i.simplifiedInspect(id, size)
+				if err != nil {
+					return nil, err
+				}
+				newImage.FullSize = simplified.FullSize
+				newImage.MaterializedSize = simplified.Size
+			}
+			// 修改
+
 			// Get container count
 			newImage.Containers = 0
 			for _, c := range allContainers {
@@ -245,6 +307,40 @@ func (i *ImageService) Images(imageFilters filters.Args, all bool, withExtraAttr
 	return images, nil
 }
 
+// variantDigests returns the digest references recorded for the simplified
+// images pulled with part of their files, listed for both them and the full
+// images they were derived from, since the reference store only points a
+// digest reference at one of them.
+func (i *ImageService) variantDigests() (map[image.ID][]reference.Named, error) {
+	digests := make(map[image.ID][]reference.Named)
+	for id := range i.imageStore.Map() {
+		info, err := i.imageStore.GetSimplifyInfo(id)
+		if err != nil {
+			return nil, err
+		}
+		if info == nil || info.Full == "" || info.Reference == "" {
+			continue
+		}
+		ref, err := reference.ParseNormalizedNamed(info.Reference)
+		if err != nil {
+			logrus.WithError(err).WithField("image", id).Warn("invalid reference recorded for simplified image")
+			continue
+		}
+		digests[id] = append(digests[id], ref)
+		digests[info.Full] = append(digests[info.Full], ref)
+	}
+	return digests, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
 // SquashImage creates a new image with the diff of the specified image and the specified parent.
 // This new image contains only the layers from it's parent + 1 extra layer which contains the diff of all the layers in between.
 // The existing image(s) is not destroyed.
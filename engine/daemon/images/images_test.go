@@ -0,0 +1,687 @@
+package images // import "github.com/docker/docker/daemon/images"
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	dref "github.com/docker/distribution/reference"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/backend"
+	containertypes "github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/container"
+	daemonevents "github.com/docker/docker/daemon/events"
+	"github.com/docker/docker/daemon/simplify"
+	"github.com/docker/docker/distribution"
+	"github.com/docker/docker/distribution/metadata"
+	"github.com/docker/docker/errdefs"
+	"github.com/docker/docker/image"
+	"github.com/docker/docker/image/tarexport"
+	"github.com/docker/docker/layer"
+	"github.com/docker/docker/pkg/locker"
+	"github.com/docker/docker/reference"
+	"github.com/docker/docker/registry"
+	"github.com/google/go-cmp/cmp"
+	"github.com/opencontainers/go-digest"
+	specs "github.com/opencontainers/image-spec/specs-go/v1"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+func newTestImageService(t *testing.T) (*ImageService, func()) {
+	root, err := ioutil.TempDir("", "images-test")
+	assert.NilError(t, err)
+
+	fs, err := image.NewFSStoreBackend(filepath.Join(root, "imagedb"))
+	assert.NilError(t, err)
+	imageStore, err := image.NewImageStore(fs, map[string]image.LayerGetReleaser{runtime.GOOS: nopLayerGetReleaser{}})
+	assert.NilError(t, err)
+	referenceStore, err := reference.NewReferenceStore(filepath.Join(root, "repositories.json"))
+	assert.NilError(t, err)
+	metadataStore, err := metadata.NewFSMetadataStore(filepath.Join(root, "distribution"))
+	assert.NilError(t, err)
+
+	return &ImageService{
+		imageStore:                imageStore,
+		referenceStore:            referenceStore,
+		distributionMetadataStore: metadataStore,
+		layerStores:               map[string]layer.Store{},
+		simplifyProfiles:          simplify.NewProfileStore(filepath.Join(root, "profiles")),
+		simplifyTOCs:              simplify.NewTOCStore(filepath.Join(root, "tocs")),
+		simplifyCacheRoot:         filepath.Join(root, "fetch"),
+		simplifyLocks:             locker.New(),
+		containers:                container.NewMemoryStore(),
+		eventsService:             daemonevents.New(),
+	}, func() { os.RemoveAll(root) }
+}
+
+// nopLayerGetReleaser lets images with layers be created in the image store
+// of tests without a layer store.
+type nopLayerGetReleaser struct{}
+
+func (nopLayerGetReleaser) Get(layer.ChainID) (layer.Layer, error) {
+	return nil, nil
+}
+
+func (nopLayerGetReleaser) Release(layer.Layer) ([]layer.Metadata, error) {
+	return nil, nil
+}
+
+func TestImagesFilterSimplified(t *testing.T) {
+	i, cleanup := newTestImageService(t)
+	defer cleanup()
+
+	full, err := i.imageStore.Create([]byte(`{"os":"` + runtime.GOOS + `","rootfs":{"type":"layers"},"config":{"Labels":{"name":"full"}}}`))
+	assert.NilError(t, err)
+	simplified, err := i.imageStore.Create([]byte(`{"os":"` + runtime.GOOS + `","rootfs":{"type":"layers"},"config":{"Labels":{"name":"simplified"}}}`))
+	assert.NilError(t, err)
+	assert.NilError(t, i.imageStore.SetSimplifyInfo(simplified, &image.SimplifyInfo{Source: image.SimplifySourceCommit, Parent: full}))
+
+	testCases := []struct {
+		filters  filters.Args
+		expected []image.ID
+	}{
+		{filters: filters.NewArgs(), expected: []image.ID{full, simplified}},
+		{filters: filters.NewArgs(filters.Arg("simplified", "true")), expected: []image.ID{simplified}},
+		{filters: filters.NewArgs(filters.Arg("simplified", "false")), expected: []image.ID{full}},
+		{filters: filters.NewArgs(filters.Arg("simplified", "true"), filters.Arg("label", "name=full")), expected: nil},
+	}
+	for _, tc := range testCases {
+		images, err := i.Images(tc.filters, true, false)
+		assert.NilError(t, err)
+		var ids []image.ID
+		for _, img := range images {
+			ids = append(ids, image.ID(img.ID))
+			assert.Check(t, is.Equal(img.Simplified, image.ID(img.ID) == simplified))
+		}
+		assert.Check(t, is.Len(ids, len(tc.expected)))
+		for _, id := range tc.expected {
+			assert.Check(t, is.Contains(ids, id))
+		}
+	}
+
+	_, err = i.Images(filters.NewArgs(filters.Arg("simplified", "yes")), false, false)
+	assert.Check(t, errdefs.IsInvalidParameter(err))
+}
+
+func TestImagesPruneSimplified(t *testing.T) {
+	i, cleanup := newTestImageService(t)
+	defer cleanup()
+
+	shared, fullOnly := digest.FromString("shared"), digest.FromString("full only")
+	full, err := i.imageStore.Create([]byte(`{"os":"` + runtime.GOOS + `","rootfs":{"type":"layers","diff_ids":["` + shared.String() + `"]}}`))
+	assert.NilError(t, err)
+	simplified, err := i.imageStore.Create([]byte(`{"os":"` + runtime.GOOS + `","rootfs":{"type":"layers"},"config":{"Labels":{"name":"simplified"}}}`))
+	assert.NilError(t, err)
+	assert.NilError(t, i.imageStore.SetSimplifyInfo(simplified, &image.SimplifyInfo{
+		Source: image.SimplifySourcePull,
+		Layers: []layer.DiffID{layer.DiffID(fullOnly), layer.DiffID(shared)},
+	}))
+	for _, diffID := range []digest.Digest{shared, fullOnly} {
+		assert.NilError(t, i.simplifyTOCs.Put(layer.DiffID(diffID), &layer.TOC{End: 1024}))
+	}
+	assert.NilError(t, i.simplifyProfiles.Put(simplified.Digest(), &simplify.Profile{Platform: "linux/amd64", Paths: []string{"/bin/sh"}}))
+	// a file fetched for the simplified image, shared through the blob store
+	cached := filepath.Join(simplify.CacheDir(i.simplifyCacheRoot, simplified.Digest().Hex()), "bin/sh")
+	blob := filepath.Join(i.simplifyCacheRoot, "blobs/sha256/sh")
+	for _, dir := range []string{filepath.Dir(cached), filepath.Dir(blob)} {
+		assert.NilError(t, os.MkdirAll(dir, 0755))
+	}
+	assert.NilError(t, ioutil.WriteFile(cached, []byte("sh"), 0755))
+	assert.NilError(t, os.Link(cached, blob))
+
+	_, err = i.ImagesPrune(context.Background(), filters.NewArgs(filters.Arg("simplified", "yes")))
+	assert.Check(t, errdefs.IsInvalidParameter(err))
+
+	report, err := i.ImagesPrune(context.Background(), filters.NewArgs(filters.Arg("dangling", "false"), filters.Arg("simplified", "true")))
+	assert.NilError(t, err)
+	assert.Check(t, is.DeepEqual(report.ImagesDeleted, []types.ImageDeleteResponseItem{{Deleted: simplified.String()}}))
+	_, err = i.imageStore.Get(full)
+	assert.Check(t, err)
+
+	// the state of the simplified image is gone, but for the table of
+	// contents of the layer the full image still uses
+	for _, p := range []string{filepath.Join(i.simplifyCacheRoot, simplified.Digest().Hex()), blob} {
+		_, err := os.Stat(p)
+		assert.Check(t, os.IsNotExist(err), p)
+	}
+	profiles, err := i.simplifyProfiles.List()
+	assert.NilError(t, err)
+	assert.Check(t, is.Len(profiles, 0))
+	assert.Check(t, i.simplifyTOCs.Has(layer.DiffID(shared)))
+	assert.Check(t, !i.simplifyTOCs.Has(layer.DiffID(fullOnly)))
+}
+
+var (
+	amd64 = specs.Platform{OS: "linux", Architecture: "amd64"}
+	arm64 = specs.Platform{OS: "linux", Architecture: "arm64", Variant: "v8"}
+)
+
+func TestPullSimplifySuppliedProfile(t *testing.T) {
+	i, cleanup := newTestImageService(t)
+	defer cleanup()
+
+	full := digest.FromString("full")
+	profile := &types.ImageProfile{Image: digest.FromString("other").String(), Paths: []string{"/bin/sh", "/etc//passwd"}}
+	keep, err := i.pullSimplify(backend.ImagePullSimplifyConfig{SimplifyImage: true, SimplifyProfile: profile}).Keep(full, amd64, nil)
+	assert.Check(t, errdefs.IsInvalidParameter(err))
+	assert.Check(t, is.Nil(keep))
+
+	keep, err = i.pullSimplify(backend.ImagePullSimplifyConfig{SimplifyImage: true, SimplifyProfile: profile, SimplifyForce: true}).Keep(full, amd64, nil)
+	assert.NilError(t, err)
+	assert.Check(t, is.DeepEqual(keep, []string{"/bin/sh", "/etc/passwd"}))
+
+	// profiles not naming an image apply to any
+	profile.Image = ""
+	keep, err = i.pullSimplify(backend.ImagePullSimplifyConfig{SimplifyImage: true, SimplifyProfile: profile}).Keep(full, amd64, nil)
+	assert.NilError(t, err)
+	assert.Check(t, is.Len(keep, 2))
+
+	profile.Paths = []string{"bin/sh"}
+	_, err = i.pullSimplify(backend.ImagePullSimplifyConfig{SimplifyImage: true, SimplifyProfile: profile}).Keep(full, amd64, nil)
+	assert.Check(t, errdefs.IsInvalidParameter(err))
+	assert.Check(t, is.ErrorContains(err, `invalid simplify profile entry "bin/sh": is not absolute`))
+}
+
+func TestPullSimplifyPlatformProfile(t *testing.T) {
+	i, cleanup := newTestImageService(t)
+	defer cleanup()
+
+	full := digest.FromString("full")
+	assert.NilError(t, i.simplifyProfiles.Put(full, &simplify.Profile{Platform: "linux/amd64", Paths: []string{"/lib/x86_64-linux-gnu/libc.so.6"}}))
+	ps := i.pullSimplify(backend.ImagePullSimplifyConfig{SimplifyImage: true})
+
+	keep, err := ps.Keep(full, amd64, nil)
+	assert.NilError(t, err)
+	assert.Check(t, is.DeepEqual(keep, []string{"/lib/x86_64-linux-gnu/libc.so.6"}))
+
+	// the files of other platforms are not selected
+	keep, err = ps.Keep(full, arm64, nil)
+	assert.Check(t, is.DeepEqual(err, distribution.ProfilePlatformError{Platform: "linux/arm64", Recorded: []string{"linux/amd64"}}))
+	assert.Check(t, is.Nil(keep))
+
+	// unless a profile of the platform was pushed along with the image
+	keep, err = ps.Keep(full, arm64, []byte(`{"platform":"linux/arm64","paths":["/lib/aarch64-linux-gnu/libc.so.6"]}`))
+	assert.NilError(t, err)
+	assert.Check(t, is.DeepEqual(keep, []string{"/lib/aarch64-linux-gnu/libc.so.6"}))
+
+	// invalid profiles pushed along with the image fail the pull
+	_, err = ps.Keep(full, arm64, []byte(`{"platform":"linux/arm64","paths":["/lib/../../etc/shadow"]}`))
+	assert.Check(t, errdefs.IsInvalidParameter(err))
+	assert.Check(t, is.ErrorContains(err, `invalid simplify profile entry "/lib/../../etc/shadow"`))
+	i.simplifyMaxProfileSize = 16
+	_, err = ps.Keep(full, arm64, []byte(`{"platform":"linux/arm64","paths":["/lib/aarch64-linux-gnu/libc.so.6"]}`))
+	assert.Check(t, errdefs.IsInvalidParameter(err))
+	i.simplifyMaxProfileSize = 0
+
+	profile := &types.ImageProfile{Platform: "linux/amd64", Paths: []string{"/bin/sh"}}
+	_, err = i.pullSimplify(backend.ImagePullSimplifyConfig{SimplifyImage: true, SimplifyProfile: profile}).Keep(full, arm64, nil)
+	assert.Check(t, is.ErrorContains(err, "profile was recorded on linux/amd64, not linux/arm64"))
+	keep, err = i.pullSimplify(backend.ImagePullSimplifyConfig{SimplifyImage: true, SimplifyProfile: profile, SimplifyForce: true}).Keep(full, arm64, nil)
+	assert.NilError(t, err)
+	assert.Check(t, is.DeepEqual(keep, []string{"/bin/sh"}))
+}
+
+func TestSimplifyPullConfig(t *testing.T) {
+	i, cleanup := newTestImageService(t)
+	defer cleanup()
+	hub, err := dref.ParseNormalizedNamed("busybox")
+	assert.NilError(t, err)
+	private, err := dref.ParseNormalizedNamed("registry.example.com:5000/app")
+	assert.NilError(t, err)
+
+	// images are pulled in full unless asked otherwise
+	simplified, err := i.simplifyPull(hub, backend.ImagePullSimplifyConfig{SimplifyDefault: true})
+	assert.NilError(t, err)
+	assert.Check(t, !simplified)
+
+	i.UpdateSimplifyConfig(true, []string{"registry.example.com:5000"})
+	simplified, err = i.simplifyPull(private, backend.ImagePullSimplifyConfig{SimplifyDefault: true})
+	assert.NilError(t, err)
+	assert.Check(t, simplified)
+	// the client asking either way overrides the default
+	simplified, err = i.simplifyPull(private, backend.ImagePullSimplifyConfig{})
+	assert.NilError(t, err)
+	assert.Check(t, !simplified)
+	// images from other registries are not simplified
+	simplified, err = i.simplifyPull(hub, backend.ImagePullSimplifyConfig{SimplifyDefault: true})
+	assert.NilError(t, err)
+	assert.Check(t, !simplified)
+	_, err = i.simplifyPull(hub, backend.ImagePullSimplifyConfig{SimplifyImage: true})
+	assert.Check(t, errdefs.IsForbidden(err))
+	assert.Check(t, is.Error(err, "simplification is not enabled for images from docker.io"))
+}
+
+func TestMarkPulledSimplifiedSigned(t *testing.T) {
+	i, cleanup := newTestImageService(t)
+	defer cleanup()
+
+	id, err := i.imageStore.Create([]byte(`{"os":"` + runtime.GOOS + `","rootfs":{"type":"layers"}}`))
+	assert.NilError(t, err)
+	named, err := dref.ParseNormalizedNamed("busybox")
+	assert.NilError(t, err)
+	signed := digest.FromString("signed manifest")
+	ref, err := dref.WithDigest(named, signed)
+	assert.NilError(t, err)
+	assert.NilError(t, i.referenceStore.AddDigest(ref, id.Digest(), false))
+
+	// the digest the client verified is recorded as the provenance of the image
+	assert.NilError(t, i.markPulledSimplified(ref, backend.ImagePullSimplifyConfig{SimplifyImage: true, SimplifyTrusted: true, SimplifySignedDigest: signed.String()}))
+	simplified, err := i.simplifiedInspect(id, 0)
+	assert.NilError(t, err)
+	assert.Check(t, simplified.Enabled)
+	assert.Check(t, is.Equal(simplified.SignedDigest, signed.String()))
+
+	// pulls without content trust record none
+	assert.NilError(t, i.markPulledSimplified(ref, backend.ImagePullSimplifyConfig{SimplifyImage: true}))
+	simplified, err = i.simplifiedInspect(id, 0)
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(simplified.SignedDigest, ""))
+
+	// the signed digest must be the one pulled
+	other := fmt.Sprintf("busybox@%s", digest.FromString("other manifest"))
+	err = i.PullImage(context.Background(), other, "", nil, nil, nil, ioutil.Discard, backend.ImagePullSimplifyConfig{SimplifyImage: true, SimplifySignedDigest: signed.String()})
+	assert.Check(t, errdefs.IsInvalidParameter(err))
+	assert.Check(t, is.ErrorContains(err, "is not the digest"))
+	err = i.PullImage(context.Background(), "busybox", "latest", nil, nil, nil, ioutil.Discard, backend.ImagePullSimplifyConfig{SimplifyImage: true, SimplifySignedDigest: signed.String()})
+	assert.Check(t, errdefs.IsInvalidParameter(err))
+}
+
+func TestSimplifiedVariants(t *testing.T) {
+	i, cleanup := newTestImageService(t)
+	defer cleanup()
+
+	fullConfig := []byte(`{"os":"` + runtime.GOOS + `","rootfs":{"type":"layers"},"config":{"Labels":{"name":"full"}}}`)
+	simplifiedConfig := []byte(`{"os":"` + runtime.GOOS + `","rootfs":{"type":"layers"},"config":{"Labels":{"name":"simplified"}}}`)
+	full, err := i.imageStore.Create(fullConfig)
+	assert.NilError(t, err)
+	pullSimplified := func(ref string) image.ID {
+		id, err := i.imageStore.Create(simplifiedConfig)
+		assert.NilError(t, err)
+		assert.NilError(t, i.imageStore.SetSimplifyInfo(id, &image.SimplifyInfo{Source: image.SimplifySourcePull, Full: full, Reference: ref}))
+		return id
+	}
+	simplified := pullSimplified("")
+
+	named, err := dref.ParseNormalizedNamed("busybox")
+	assert.NilError(t, err)
+	canonical, err := dref.WithDigest(named, digest.FromString("manifest"))
+	assert.NilError(t, err)
+	tagged, err := dref.WithTag(named, "latest")
+	assert.NilError(t, err)
+	// pulled simplified by digest, then tagged by a pull of the full image
+	assert.NilError(t, i.referenceStore.AddDigest(canonical, simplified.Digest(), true))
+	assert.NilError(t, i.markPulledSimplified(canonical, backend.ImagePullSimplifyConfig{SimplifyImage: true}))
+	assert.NilError(t, i.referenceStore.AddTag(tagged, full.Digest(), true))
+
+	info, err := i.imageStore.GetSimplifyInfo(simplified)
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(info.Full, full))
+	assert.Check(t, is.Equal(info.Reference, canonical.String()))
+	inspect, err := i.simplifiedInspect(simplified, 0)
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(inspect.FullImage, full.String()))
+
+	// both variants list the digest they were pulled by
+	images, err := i.Images(filters.NewArgs(), false, false)
+	assert.NilError(t, err)
+	assert.Assert(t, is.Len(images, 2))
+	for _, img := range images {
+		assert.Check(t, is.DeepEqual(img.RepoDigests, []string{"busybox@" + canonical.Digest().String()}))
+		if image.ID(img.ID) == full {
+			assert.Check(t, is.DeepEqual(img.RepoTags, []string{"busybox:latest"}))
+		}
+	}
+
+	// deleting the simplified image leaves the digest to the full image
+	_, err = i.ImageDelete(simplified.String(), false, false)
+	assert.NilError(t, err)
+	id, err := i.referenceStore.Get(canonical)
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(id, full.Digest()))
+
+	// and deleting the full image leaves it to the simplified image
+	simplified = pullSimplified(canonical.String())
+	_, err = i.ImageDelete(full.String(), true, false)
+	assert.NilError(t, err)
+	id, err = i.referenceStore.Get(canonical)
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(id, simplified.Digest()))
+	_, err = i.referenceStore.Get(tagged)
+	assert.Check(t, is.Equal(err, reference.ErrDoesNotExist))
+}
+
+func TestSimplifiedLayers(t *testing.T) {
+	i, cleanup := newTestImageService(t)
+	defer cleanup()
+
+	create := func(diffIDs ...layer.DiffID) *image.Image {
+		config, err := json.Marshal(&image.Image{
+			V1Image: image.V1Image{OS: runtime.GOOS},
+			RootFS:  &image.RootFS{Type: "layers", DiffIDs: diffIDs},
+		})
+		assert.NilError(t, err)
+		id, err := i.imageStore.Create(config)
+		assert.NilError(t, err)
+		img, err := i.imageStore.Get(id)
+		assert.NilError(t, err)
+		return img
+	}
+	base, top := layer.DiffID(digest.FromString("base")), layer.DiffID(digest.FromString("top"))
+
+	// full images have nothing to annotate
+	full := create(base, top)
+	layers, err := i.simplifiedLayers(full)
+	assert.NilError(t, err)
+	assert.Check(t, is.Nil(layers))
+
+	// layers pulled with part of their files are matched one by one with the
+	// layers of the full image, sized by their tables of contents
+	assert.NilError(t, i.simplifyTOCs.Put(top, &layer.TOC{Entries: []layer.TOCEntry{{Name: "app", Type: '0', Size: 2048}}, End: -1}))
+	pulled := create(base, layer.DiffID(digest.FromString("top simplified")))
+	assert.NilError(t, i.imageStore.SetSimplifyInfo(pulled.ID(), &image.SimplifyInfo{Source: image.SimplifySourcePull, Full: full.ID(), Layers: []layer.DiffID{base, top}}))
+	layers, err = i.simplifiedLayers(pulled)
+	assert.NilError(t, err)
+	assert.Check(t, is.DeepEqual(layers, []simplifiedLayer{{}, {rewritten: true, fullSize: 2048}}, cmp.AllowUnexported(simplifiedLayer{})))
+
+	// the single layer of committed images stands for the whole full image
+	committed := create(layer.DiffID(digest.FromString("committed")))
+	assert.NilError(t, i.imageStore.SetSimplifyInfo(committed.ID(), &image.SimplifyInfo{Source: image.SimplifySourceCommit, Parent: full.ID(), Layers: []layer.DiffID{base, top}, FullSize: 4096}))
+	layers, err = i.simplifiedLayers(committed)
+	assert.NilError(t, err)
+	assert.Check(t, is.DeepEqual(layers, []simplifiedLayer{{rewritten: true, fullSize: 4096}}, cmp.AllowUnexported(simplifiedLayer{})))
+}
+
+func TestRemoveOrphanedSimplifyCaches(t *testing.T) {
+	i, cleanup := newTestImageService(t)
+	defer cleanup()
+
+	removed, err := i.RemoveOrphanedSimplifyCaches()
+	assert.NilError(t, err)
+	assert.Check(t, is.Len(removed, 0))
+
+	id, err := i.imageStore.Create([]byte(`{"os":"` + runtime.GOOS + `","rootfs":{"type":"layers"}}`))
+	assert.NilError(t, err)
+	deleted := digest.FromString("deleted").Hex()
+	for _, dir := range []string{id.Digest().Hex(), deleted, "tmp", "blobs"} {
+		assert.NilError(t, os.MkdirAll(simplify.CacheDir(i.simplifyCacheRoot, dir), 0700))
+	}
+
+	// the image may exist on the other daemons sharing the caches
+	i.simplifyCacheShared = true
+	removed, err = i.RemoveOrphanedSimplifyCaches()
+	assert.NilError(t, err)
+	assert.Check(t, is.Len(removed, 0))
+	_, err = os.Stat(filepath.Join(i.simplifyCacheRoot, deleted))
+	assert.Check(t, err)
+
+	i.simplifyCacheShared = false
+	removed, err = i.RemoveOrphanedSimplifyCaches()
+	assert.NilError(t, err)
+	assert.Check(t, is.DeepEqual(removed, []string{deleted}))
+	for _, dir := range []string{id.Digest().Hex(), "tmp", "blobs"} {
+		_, err = os.Stat(filepath.Join(i.simplifyCacheRoot, dir))
+		assert.Check(t, err)
+	}
+}
+
+func TestSaveLoadSimplified(t *testing.T) {
+	i, cleanup := newTestImageService(t)
+	defer cleanup()
+
+	full, err := i.imageStore.Create([]byte(`{"os":"` + runtime.GOOS + `","rootfs":{"type":"layers"},"config":{"Labels":{"name":"full"}}}`))
+	assert.NilError(t, err)
+	simplified, err := i.imageStore.Create([]byte(`{"os":"` + runtime.GOOS + `","rootfs":{"type":"layers"},"config":{"Labels":{"name":"simplified"}}}`))
+	assert.NilError(t, err)
+	fullLayer := layer.DiffID(digest.FromString("full layer"))
+	assert.NilError(t, i.imageStore.SetSimplifyInfo(simplified, &image.SimplifyInfo{Source: image.SimplifySourceCommit, Parent: full, Layers: []layer.DiffID{fullLayer}, Profile: full.String()}))
+	assert.NilError(t, i.simplifyProfiles.Put(full.Digest(), &simplify.Profile{Paths: []string{"/bin/sh"}}))
+	blob := digest.FromString("full blob")
+	assert.NilError(t, metadata.NewV2MetadataService(i.distributionMetadataStore).Add(fullLayer, metadata.V2Metadata{Digest: blob, SourceRepository: "docker.io/library/app"}))
+	toc := &layer.TOC{Entries: []layer.TOCEntry{{Name: "bin/sh", Size: 7}}, End: 1024}
+	assert.NilError(t, i.simplifyTOCs.Put(fullLayer, toc))
+
+	s, err := i.SaveSimplified(full)
+	assert.NilError(t, err)
+	assert.Check(t, is.Nil(s))
+	s, err = i.SaveSimplified(simplified)
+	assert.NilError(t, err)
+	assert.Check(t, is.DeepEqual(s.Sources, map[layer.DiffID][]tarexport.LayerSource{fullLayer: {{Digest: blob, Repository: "docker.io/library/app"}}}))
+	assert.Check(t, is.Contains(string(s.Profile), "/bin/sh"))
+	assert.Check(t, is.DeepEqual(s.TOCs, map[layer.DiffID]*layer.TOC{fullLayer: toc}))
+
+	// loaded by a daemon without the full image, which only knows the layer
+	// of the full image from the archive
+	loader, cleanupLoader := newTestImageService(t)
+	defer cleanupLoader()
+	loaded, err := loader.imageStore.Create([]byte(`{"os":"` + runtime.GOOS + `","rootfs":{"type":"layers"},"config":{"Labels":{"name":"simplified"}}}`))
+	assert.NilError(t, err)
+	// loading the archive again changes nothing
+	for n := 0; n < 2; n++ {
+		assert.NilError(t, loader.LoadSimplified(loaded, s))
+		info, err := loader.SimplifyInfo(loaded)
+		assert.NilError(t, err)
+		assert.Check(t, is.DeepEqual(*info, image.SimplifyInfo{Source: image.SimplifySourceCommit, Layers: []layer.DiffID{fullLayer}, Profile: loaded.String()}))
+		assert.Check(t, loader.simplifyProfile(loaded) != nil)
+		metas, err := metadata.NewV2MetadataService(loader.distributionMetadataStore).GetMetadata(fullLayer)
+		assert.NilError(t, err)
+		assert.Check(t, is.Len(metas, 1))
+		loadedTOC, err := loader.simplifyTOCs.Get(fullLayer)
+		assert.NilError(t, err)
+		assert.Check(t, is.DeepEqual(loadedTOC, toc))
+	}
+
+	// images pushed as simplified are loaded as pulled, but cannot be
+	// restored for a regular archive
+	pushed := image.SimplifyInfo{Source: image.SimplifySourceRegistry, Annotations: map[string]string{distribution.AnnotationSimplified: "true"}}
+	assert.NilError(t, loader.CheckSimplified(&tarexport.SimplifiedImage{Info: pushed}, runtime.GOOS))
+	assert.NilError(t, i.imageStore.SetSimplifyInfo(full, &pushed))
+	_, _, err = i.RestoreSimplified(full)
+	assert.Check(t, errdefs.IsUnavailable(err))
+	assert.Check(t, is.ErrorContains(err, "save it as a simplified archive instead"))
+}
+
+func TestSimplifyFullLayersOfChild(t *testing.T) {
+	i, cleanup := newTestImageService(t)
+	defer cleanup()
+
+	create := func(name string, diffIDs ...layer.DiffID) image.ID {
+		b, err := json.Marshal(&image.Image{
+			V1Image: image.V1Image{OS: runtime.GOOS, Config: &containertypes.Config{Labels: map[string]string{"name": name}}},
+			RootFS:  &image.RootFS{Type: "layers", DiffIDs: diffIDs},
+		})
+		assert.NilError(t, err)
+		id, err := i.imageStore.Create(b)
+		assert.NilError(t, err)
+		return id
+	}
+	diffID := func(s string) layer.DiffID {
+		return layer.DiffID(digest.FromString(s))
+	}
+
+	full := create("full", diffID("base"), diffID("app"))
+	simplified := create("simplified", diffID("simplified"))
+	assert.NilError(t, i.imageStore.SetSimplifyInfo(simplified, &image.SimplifyInfo{Source: image.SimplifySourceCommit, Parent: full}))
+	// built FROM the simplified image, one RUN step after the other
+	step1 := create("step1", diffID("simplified"), diffID("run1"))
+	assert.NilError(t, i.imageStore.SetParent(step1, simplified))
+	step2 := create("step2", diffID("simplified"), diffID("run1"), diffID("run2"))
+	assert.NilError(t, i.imageStore.SetParent(step2, step1))
+	// pulled images record no parent
+	pulled := create("pulled", diffID("simplified"), diffID("pulled"))
+
+	for _, tc := range []struct {
+		id       image.ID
+		expected []layer.DiffID
+	}{
+		{id: simplified, expected: []layer.DiffID{diffID("base"), diffID("app")}},
+		{id: step1, expected: []layer.DiffID{diffID("base"), diffID("app"), diffID("run1")}},
+		{id: step2, expected: []layer.DiffID{diffID("base"), diffID("app"), diffID("run1"), diffID("run2")}},
+		{id: pulled},
+		{id: full},
+	} {
+		diffIDs, err := i.simplifyFullLayers(tc.id)
+		assert.NilError(t, err)
+		assert.Check(t, is.DeepEqual(diffIDs, tc.expected), "image %s", tc.id)
+	}
+
+	// children of a full image have no full image
+	child := create("child", diffID("base"), diffID("app"), diffID("run"))
+	assert.NilError(t, i.imageStore.SetParent(child, full))
+	diffIDs, err := i.simplifyFullLayers(child)
+	assert.NilError(t, err)
+	assert.Check(t, is.Len(diffIDs, 0))
+}
+
+func TestSimplifyRemotesMirror(t *testing.T) {
+	blob := []byte("layer blob")
+	dgst := digest.FromBytes(blob)
+
+	// mirror serves blob to the client with the credentials of the pull if
+	// has is set
+	mirror := func(has bool, pings *int32) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Docker-Distribution-API-Version", "registry/2.0")
+			if r.URL.Path == "/v2/" {
+				atomic.AddInt32(pings, 1)
+			}
+			if user, password, ok := r.BasicAuth(); !ok || user != "user" || password != "secret" {
+				w.Header().Set("WWW-Authenticate", `Basic realm="mirror"`)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			switch {
+			case r.URL.Path == "/v2/":
+			case has && r.URL.Path == "/v2/library/busybox/blobs/"+dgst.String():
+				http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(blob))
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+	}
+	var emptyPings, pings int32
+	empty := mirror(false, &emptyPings)
+	defer empty.Close()
+	cache := mirror(true, &pings)
+	defer cache.Close()
+
+	registryService, err := registry.NewService(registry.ServiceOptions{Mirrors: []string{empty.URL, cache.URL}})
+	assert.NilError(t, err)
+	remotes := newSimplifyRemotes(registryService)
+	ref, err := dref.ParseNormalizedNamed("busybox")
+	assert.NilError(t, err)
+	remotes.setAuth(ref, &types.AuthConfig{Username: "user", Password: "secret"})
+
+	// the blob missing from the first mirror is read from the next one, which
+	// is only pinged once
+	meta := metadata.V2Metadata{Digest: dgst, SourceRepository: "docker.io/library/busybox"}
+	for n := 0; n < 2; n++ {
+		rc, err := remotes.openBlob(context.Background(), meta)
+		assert.NilError(t, err)
+		b, err := ioutil.ReadAll(rc)
+		rc.Close()
+		assert.NilError(t, err)
+		assert.Check(t, is.Equal(string(b), string(blob)))
+	}
+	assert.Check(t, is.Equal(atomic.LoadInt32(&emptyPings), int32(1)))
+	assert.Check(t, is.Equal(atomic.LoadInt32(&pings), int32(1)))
+
+	// the repositories are connected to again once the mirrors are reloaded
+	remotes.reset()
+	rc, err := remotes.openBlob(context.Background(), meta)
+	assert.NilError(t, err)
+	rc.Close()
+	assert.Check(t, is.Equal(atomic.LoadInt32(&pings), int32(2)))
+}
+
+func TestSimplifyRemotesReauthenticate(t *testing.T) {
+	blob := []byte("layer blob")
+	dgst := digest.FromBytes(blob)
+
+	// the registry only accepts the last token it issued, to the client with
+	// the password, until it is revoked
+	var (
+		mu       sync.Mutex
+		password = "secret"
+		valid    string
+		issued   int
+		reg      *httptest.Server
+	)
+	reg = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.URL.Path == "/token" {
+			if user, pass, ok := r.BasicAuth(); !ok || user != "user" || pass != password {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			issued++
+			valid = fmt.Sprintf("token%d", issued)
+			json.NewEncoder(w).Encode(map[string]interface{}{"token": valid, "expires_in": 3600})
+			return
+		}
+		w.Header().Set("Docker-Distribution-API-Version", "registry/2.0")
+		if valid == "" || r.Header.Get("Authorization") != "Bearer "+valid {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="registry",error="invalid_token"`, reg.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path == "/v2/app/blobs/"+dgst.String() {
+			http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(blob))
+		}
+	}))
+	defer reg.Close()
+
+	registryService, err := registry.NewService(registry.ServiceOptions{})
+	assert.NilError(t, err)
+	remotes := newSimplifyRemotes(registryService)
+	repository := strings.TrimPrefix(reg.URL, "https://") + "/app"
+	ref, err := dref.ParseNormalizedNamed(repository)
+	assert.NilError(t, err)
+	remotes.setAuth(ref, &types.AuthConfig{Username: "user", Password: "secret"})
+
+	meta := metadata.V2Metadata{Digest: dgst, SourceRepository: repository}
+	fetch := func() error {
+		rc, err := remotes.openBlob(context.Background(), meta)
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		b, err := ioutil.ReadAll(rc)
+		assert.Check(t, is.Equal(string(b), string(blob)))
+		return err
+	}
+	assert.NilError(t, fetch())
+
+	// a token revoked, or expired, is replaced
+	revoke := func() {
+		mu.Lock()
+		valid = ""
+		mu.Unlock()
+	}
+	revoke()
+	assert.NilError(t, fetch())
+	assert.Check(t, is.Equal(issued, 2))
+
+	// rotated credentials are reported as such
+	mu.Lock()
+	password = "rotated"
+	mu.Unlock()
+	revoke()
+	err = fetch()
+	assert.Check(t, simplify.IsCredentialsError(err), "%v", err)
+	assert.Check(t, is.ErrorContains(err, "pull the image again"))
+}
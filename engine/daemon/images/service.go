@@ -4,14 +4,18 @@ import (
 	"context"
 	"os"
 	"runtime"
+	"sync"
 
 	"github.com/docker/docker/container"
 	daemonevents "github.com/docker/docker/daemon/events"
+	"github.com/docker/docker/daemon/simplify"
 	"github.com/docker/docker/distribution"
 	"github.com/docker/docker/distribution/metadata"
 	"github.com/docker/docker/distribution/xfer"
 	"github.com/docker/docker/image"
 	"github.com/docker/docker/layer"
+	"github.com/docker/docker/pkg/idtools"
+	"github.com/docker/docker/pkg/locker"
 	dockerreference "github.com/docker/docker/reference"
 	"github.com/docker/docker/registry"
 	"github.com/docker/libtrust"
@@ -34,12 +38,25 @@ type ImageServiceConfig struct {
 	ContainerStore            containerStore
 	DistributionMetadataStore metadata.Store
 	EventsService             *daemonevents.Events
+	IDMappings                *idtools.IDMappings
 	ImageStore                image.Store
 	LayerStores               map[string]layer.Store
 	MaxConcurrentDownloads    int
 	MaxConcurrentUploads      int
 	ReferenceStore            dockerreference.Store
 	RegistryService           registry.Service
+	SimplifyCacheRoot         string
+	SimplifyCacheShared       bool
+	SimplifyFetch             *simplify.Server
+	SimplifyFetchMaxBatch     int64
+	SimplifyFetchMaxGap       int64
+	SimplifyImageDefault      bool
+	SimplifyMaxProfileSize    int64
+	SimplifyPlaceholders      bool
+	SimplifyProfileRoot       string
+	SimplifyRangeRoot         string
+	SimplifyRegistries        []string
+	SimplifyTOCRoot           string
 	TrustKey                  libtrust.PrivateKey
 }
 
@@ -52,10 +69,24 @@ func NewImageService(config ImageServiceConfig) *ImageService {
 		distributionMetadataStore: config.DistributionMetadataStore,
 		downloadManager:           xfer.NewLayerDownloadManager(config.LayerStores, config.MaxConcurrentDownloads),
 		eventsService:             config.EventsService,
+		idMappings:                config.IDMappings,
 		imageStore:                config.ImageStore,
 		layerStores:               config.LayerStores,
 		referenceStore:            config.ReferenceStore,
 		registryService:           config.RegistryService,
+		simplifyBatcher:           simplify.NewRangeBatcher(config.SimplifyFetchMaxGap, config.SimplifyFetchMaxBatch),
+		simplifyCacheRoot:         config.SimplifyCacheRoot,
+		simplifyCacheShared:       config.SimplifyCacheShared,
+		simplifyFetch:             config.SimplifyFetch,
+		simplifyLocks:             locker.New(),
+		simplifyDefault:           config.SimplifyImageDefault,
+		simplifyMaxProfileSize:    config.SimplifyMaxProfileSize,
+		simplifyPlaceholders:      config.SimplifyPlaceholders,
+		simplifyRegistries:        config.SimplifyRegistries,
+		simplifyRemotes:           newSimplifyRemotes(config.RegistryService),
+		simplifyProfiles:          simplify.NewProfileStore(config.SimplifyProfileRoot),
+		simplifyRangeRoot:         config.SimplifyRangeRoot,
+		simplifyTOCs:              simplify.NewTOCStore(config.SimplifyTOCRoot),
 		trustKey:                  config.TrustKey,
 		uploadManager:             xfer.NewLayerUploadManager(config.MaxConcurrentUploads),
 	}
@@ -67,11 +98,26 @@ type ImageService struct {
 	distributionMetadataStore metadata.Store
 	downloadManager           *xfer.LayerDownloadManager
 	eventsService             *daemonevents.Events
+	idMappings                *idtools.IDMappings // 缓存中的文件属于重映射后的宿主机ID
 	imageStore                image.Store
 	layerStores               map[string]layer.Store // By operating system
 	pruneRunning              int32
 	referenceStore            dockerreference.Store
 	registryService           registry.Service
+	simplifyBatcher           *simplify.RangeBatcher // 合并按需拉取时相邻文件的range请求
+	simplifyCacheRoot         string                 // 按需拉取的缓存目录
+	simplifyCacheShared       bool                   // 缓存目录同时被其它daemon使用
+	simplifyConfigMu          sync.Mutex
+	simplifyFetch             *simplify.Server // 内核不支持按需拉取时为nil
+	simplifyLocks             *locker.Locker   // 按源镜像ID串行化docker image simplify
+	simplifyDefault           bool             // 未指定时是否精简拉取
+	simplifyMaxProfileSize    int64            // 使用的profile的最大字节数，为0时使用默认值
+	simplifyPlaceholders      bool             // 精简掉的文件留下占位文件
+	simplifyRegistries        []string         // 只精简从这些仓库拉取的镜像，为空时不限
+	simplifyProfiles          *simplify.ProfileStore
+	simplifyRemotes           *simplifyRemotes   // 按需拉取时连接的registry
+	simplifyRangeRoot         string             // 精简拉取中断时已下载的层数据
+	simplifyTOCs              *simplify.TOCStore // 层的tar目录
 	trustKey                  libtrust.PrivateKey
 	uploadManager             *xfer.LayerUploadManager
 }
@@ -249,3 +295,14 @@ func (i *ImageService) UpdateConfig(maxDownloads, maxUploads *int) {
 		i.uploadManager.SetConcurrency(*maxUploads)
 	}
 }
+
+// 修改： 更新精简拉取的默认行为
+
+// UpdateSimplifyConfig updates whether pulls are simplified by default, and
+// the registries simplification is restricted to.
+func (i *ImageService) UpdateSimplifyConfig(imageDefault bool, registries []string) {
+	i.simplifyConfigMu.Lock()
+	i.simplifyDefault = imageDefault
+	i.simplifyRegistries = registries
+	i.simplifyConfigMu.Unlock()
+}
@@ -132,6 +132,20 @@ func (daemon *Daemon) SystemInfo() (*types.Info, error) {
 		Isolation:          daemon.defaultIsolation,
 	}
 
+	// 修改： 精简镜像的配置
+	v.Simplify = &types.SimplifyInfo{
+		ImageDefault: daemon.configStore.SimplifyImageDefault,
+		Registries:   simplifyRegistries(daemon.configStore),
+		CacheDir:     simplifyCacheRoot(daemon.configStore),
+		MaxCacheSize: int64(daemon.configStore.SimplifyMaxCacheSize),
+		Prefetch:     daemon.configStore.SimplifyPrefetch,
+		PrefetchRate: daemon.configStore.SimplifyPrefetchRate,
+		Offline:      daemon.configStore.SimplifyOffline,
+	}
+	v.Simplify.Unsupported, v.Simplify.FetchUnsupported = daemon.simplifyUnsupported()
+	daemon.fillSimplifyInfo(v.Simplify)
+	// 修改
+
 	// Retrieve platform specific info
 	daemon.FillPlatformInfo(v, sysInfo)
 
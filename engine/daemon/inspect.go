@@ -159,6 +159,10 @@ func (daemon *Daemon) getInspectData(container *container.Container) (*types.Con
 		StartedAt:  container.State.StartedAt.Format(time.RFC3339Nano),
 		FinishedAt: container.State.FinishedAt.Format(time.RFC3339Nano),
 		Health:     containerHealth,
+		// 修改： 返回精简容器的降级原因和按需拉取的错误
+		SimplifyDegraded:   container.State.SimplifyDegraded,
+		SimplifyFetchError: container.State.SimplifyFetchError,
+		// 修改
 	}
 
 	contJSONBase := &types.ContainerJSONBase{
@@ -22,6 +22,13 @@ var (
 	engineMemory              metrics.Gauge
 	healthChecksCounter       metrics.Counter
 	healthChecksFailedCounter metrics.Counter
+	// 修改： 按策略以精简模式启动的容器数
+	simplifyPolicyStarts metrics.Counter
+	// 修改
+	// 修改： 审计profile的容器数和会被精简掉的访问文件数
+	simplifyAudits      metrics.Counter
+	simplifyAuditMisses metrics.Counter
+	// 修改
 
 	stateCtr *stateCounter
 )
@@ -35,6 +42,9 @@ func init() {
 		"commit",
 		"create",
 		"delete",
+		// 修改： 以精简模式启动的容器
+		"start_simplified",
+		// 修改
 	} {
 		containerActions.WithValues(a).Update(0)
 	}
@@ -53,6 +63,13 @@ func init() {
 	engineMemory = ns.NewGauge("engine_memory", "The number of bytes of memory that the host system of the engine has", metrics.Bytes)
 	healthChecksCounter = ns.NewCounter("health_checks", "The total number of health checks")
 	healthChecksFailedCounter = ns.NewCounter("health_checks_failed", "The total number of failed health checks")
+	// 修改： 按策略以精简模式启动的容器数
+	simplifyPolicyStarts = ns.NewCounter("simplify_policy_starts", "The number of containers started in simplified mode by the simplify image policy")
+	// 修改
+	// 修改： 审计profile的容器数和会被精简掉的访问文件数
+	simplifyAudits = ns.NewCounter("simplify_audits", "The number of containers of full images started to audit a simplify profile")
+	simplifyAuditMisses = ns.NewCounter("simplify_audit_misses", "The number of files opened by audited containers that a simplified image made from the audited profile would have pruned")
+	// 修改
 
 	stateCtr = newStateCounter(ns.NewDesc("container_states", "The count of containers in various states", metrics.Unit("containers"), "state"))
 	ns.Add(stateCtr)
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/backend"
 	"github.com/docker/docker/container"
 	"github.com/docker/docker/libcontainerd"
 	"github.com/docker/docker/restartmanager"
@@ -94,8 +95,8 @@ func (daemon *Daemon) ProcessEvent(id string, e libcontainerd.EventType, ei libc
 						// But containerStart will use daemon.netController segment.
 						// So to avoid panic at startup process, here must wait util daemon restore done.
 						daemon.waitForStartupDone()
-						// 修改： 添加simpString = ""参数
-						if err = daemon.containerStart(c, "", "", false, ""); err != nil {
+						// 修改： 添加simpCfg参数，沿用容器上记录的选项
+						if err = daemon.containerStart(c, "", "", false, backend.ContainerStartSimplifyConfig{}); err != nil {
 							// 修改
 							logrus.Debugf("failed to restart container: %+v", err)
 						}
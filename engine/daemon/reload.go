@@ -3,6 +3,7 @@ package daemon // import "github.com/docker/docker/daemon"
 import (
 	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/docker/docker/daemon/config"
 	"github.com/docker/docker/daemon/discovery"
@@ -22,6 +23,7 @@ import (
 // - Insecure registries
 // - Registry mirrors
 // - Daemon live restore
+// - Simplification default, registries, cache size, prefetch, fetch timeout and offline mode
 func (daemon *Daemon) Reload(conf *config.Config) (err error) {
 	daemon.configStore.Lock()
 	attributes := map[string]string{}
@@ -64,6 +66,11 @@ func (daemon *Daemon) Reload(conf *config.Config) (err error) {
 	if err := daemon.reloadLiveRestore(conf, attributes); err != nil {
 		return err
 	}
+	// 修改： 重新加载精简镜像的配置
+	if err := daemon.reloadSimplify(conf, attributes); err != nil {
+		return err
+	}
+	// 修改
 	return daemon.reloadNetworkDiagnosticPort(conf, attributes)
 }
 
@@ -322,3 +329,89 @@ func (daemon *Daemon) reloadNetworkDiagnosticPort(conf *config.Config, attribute
 
 	return nil
 }
+
+// 修改： 重新加载精简镜像的配置
+
+// reloadSimplify updates the simplification settings, but the cache dir, and
+// updates the passed attributes
+func (daemon *Daemon) reloadSimplify(conf *config.Config, attributes map[string]string) error {
+	if conf.IsValueSet("simplify-image-default") {
+		daemon.configStore.SimplifyImageDefault = conf.SimplifyImageDefault
+	}
+	if conf.IsValueSet("simplify-registries") {
+		daemon.configStore.SimplifyRegistries = conf.SimplifyRegistries
+	}
+	if conf.IsValueSet("simplify-max-cache-size") {
+		daemon.configStore.SimplifyMaxCacheSize = conf.SimplifyMaxCacheSize
+		if daemon.simplifyFetch != nil {
+			daemon.simplifyFetch.SetMaxCacheSize(int64(conf.SimplifyMaxCacheSize))
+		}
+	}
+	if conf.IsValueSet("simplify-prefetch") {
+		daemon.configStore.SimplifyPrefetch = conf.SimplifyPrefetch
+	}
+	if conf.IsValueSet("simplify-prefetch-rate") {
+		daemon.configStore.SimplifyPrefetchRate = conf.SimplifyPrefetchRate
+	}
+	if conf.IsValueSet("simplify-offline") {
+		daemon.configStore.SimplifyOffline = conf.SimplifyOffline
+	}
+	if conf.IsValueSet("simplify-fetch-timeout") {
+		daemon.configStore.SimplifyFetchTimeout = conf.SimplifyFetchTimeout
+		if daemon.simplifyFetch != nil {
+			daemon.simplifyFetch.SetFetchTimeout(time.Duration(conf.SimplifyFetchTimeout) * time.Second)
+		}
+	}
+	if conf.IsValueSet("simplify-fetch-drain-timeout") {
+		daemon.configStore.SimplifyFetchDrainTimeout = conf.SimplifyFetchDrainTimeout
+		if daemon.simplifyFetch != nil {
+			daemon.simplifyFetch.SetDrainTimeout(time.Duration(conf.SimplifyFetchDrainTimeout) * time.Second)
+		}
+	}
+	if conf.IsValueSet("simplify-max-concurrent-fetches") {
+		daemon.configStore.SimplifyMaxConcurrentFetches = conf.SimplifyMaxConcurrentFetches
+		if daemon.simplifyFetch != nil {
+			daemon.simplifyFetch.SetMaxConcurrentFetches(conf.SimplifyMaxConcurrentFetches)
+		}
+	}
+	if conf.IsValueSet("simplify-peers") {
+		daemon.configStore.SimplifyPeers = conf.SimplifyPeers
+		if daemon.simplifyFetch != nil {
+			daemon.simplifyFetch.SetBlobSources(simplifyPeerSources(daemon.configStore))
+		}
+	}
+	if conf.IsValueSet("simplify-image-policy") {
+		daemon.configStore.SimplifyImagePolicy = conf.SimplifyImagePolicy
+	}
+	if conf.IsValueSet("insecure-registries") || conf.IsValueSet("registry-mirrors") {
+		// 按需拉取重新连接registry
+		daemon.imageService.ResetSimplifyRemotes()
+	}
+	daemon.imageService.UpdateSimplifyConfig(daemon.configStore.SimplifyImageDefault, simplifyRegistries(daemon.configStore))
+
+	// prepare reload event attributes with updatable configurations
+	registries, err := json.Marshal(daemon.configStore.SimplifyRegistries)
+	if err != nil {
+		return err
+	}
+	peers, err := json.Marshal(daemon.configStore.SimplifyPeers)
+	if err != nil {
+		return err
+	}
+	policy, err := json.Marshal(daemon.configStore.SimplifyImagePolicy)
+	if err != nil {
+		return err
+	}
+	attributes["simplify-image-default"] = fmt.Sprintf("%t", daemon.configStore.SimplifyImageDefault)
+	attributes["simplify-registries"] = string(registries)
+	attributes["simplify-max-cache-size"] = fmt.Sprintf("%d", daemon.configStore.SimplifyMaxCacheSize)
+	attributes["simplify-prefetch"] = fmt.Sprintf("%t", daemon.configStore.SimplifyPrefetch)
+	attributes["simplify-prefetch-rate"] = fmt.Sprintf("%d", daemon.configStore.SimplifyPrefetchRate)
+	attributes["simplify-offline"] = fmt.Sprintf("%t", daemon.configStore.SimplifyOffline)
+	attributes["simplify-fetch-timeout"] = fmt.Sprintf("%d", daemon.configStore.SimplifyFetchTimeout)
+	attributes["simplify-fetch-drain-timeout"] = fmt.Sprintf("%d", daemon.configStore.SimplifyFetchDrainTimeout)
+	attributes["simplify-max-concurrent-fetches"] = fmt.Sprintf("%d", daemon.configStore.SimplifyMaxConcurrentFetches)
+	attributes["simplify-peers"] = string(peers)
+	attributes["simplify-image-policy"] = string(policy)
+	return nil
+}
@@ -571,3 +571,53 @@ func TestDaemonReloadNetworkDiagnosticPort(t *testing.T) {
 	}
 
 }
+
+func TestDaemonReloadSimplify(t *testing.T) {
+	daemon := &Daemon{
+		configStore: &config.Config{
+			CommonConfig: config.CommonConfig{
+				SimplifyCacheDir:   "/mnt/simplify",
+				SimplifyRegistries: []string{"docker.io"},
+			},
+		},
+		imageService: images.NewImageService(images.ImageServiceConfig{}),
+	}
+
+	newConfig := &config.Config{
+		CommonConfig: config.CommonConfig{
+			SimplifyImageDefault:         true,
+			SimplifyCacheDir:             "/mnt/other",
+			SimplifyMaxCacheSize:         1 << 30,
+			SimplifyFetchTimeout:         5,
+			SimplifyFetchDrainTimeout:    20,
+			SimplifyMaxConcurrentFetches: 4,
+			SimplifyOffline:              true,
+			SimplifyPeers:                []string{"http://10.0.0.2:7373"},
+			SimplifyImagePolicy:          map[string]string{"nginx": "on"},
+			ValuesSet: map[string]interface{}{
+				"simplify-image-default":          true,
+				"simplify-cache-dir":              "/mnt/other",
+				"simplify-max-cache-size":         "1g",
+				"simplify-fetch-timeout":          5,
+				"simplify-fetch-drain-timeout":    20,
+				"simplify-max-concurrent-fetches": 4,
+				"simplify-offline":                true,
+				"simplify-peers":                  []string{"http://10.0.0.2:7373"},
+				"simplify-image-policy":           map[string]string{"nginx": "on"},
+			},
+		},
+	}
+	assert.NilError(t, daemon.Reload(newConfig))
+
+	assert.Check(t, daemon.configStore.SimplifyImageDefault)
+	assert.Check(t, is.Equal(int64(daemon.configStore.SimplifyMaxCacheSize), int64(1<<30)))
+	assert.Check(t, is.Equal(daemon.configStore.SimplifyFetchTimeout, 5))
+	assert.Check(t, is.Equal(daemon.configStore.SimplifyFetchDrainTimeout, 20))
+	assert.Check(t, is.Equal(daemon.configStore.SimplifyMaxConcurrentFetches, 4))
+	assert.Check(t, daemon.configStore.SimplifyOffline)
+	assert.Check(t, is.DeepEqual(daemon.configStore.SimplifyPeers, []string{"http://10.0.0.2:7373"}))
+	assert.Check(t, is.DeepEqual(daemon.configStore.SimplifyImagePolicy, map[string]string{"nginx": "on"}))
+	// the cache dir is not reloaded, nor are the settings left out
+	assert.Check(t, is.Equal(daemon.configStore.SimplifyCacheDir, "/mnt/simplify"))
+	assert.Check(t, is.DeepEqual(daemon.configStore.SimplifyRegistries, []string{"docker.io"}))
+}
@@ -3,6 +3,7 @@ package daemon // import "github.com/docker/docker/daemon"
 import (
 	"fmt"
 
+	"github.com/docker/docker/api/types/backend"
 	"github.com/docker/docker/container"
 	"github.com/sirupsen/logrus"
 )
@@ -61,8 +62,8 @@ func (daemon *Daemon) containerRestart(container *container.Container, seconds i
 		}
 	}
 
-	// 修改： 添加simpString = ""参数
-	if err := daemon.containerStart(container, "", "", true, ""); err != nil {
+	// 修改： 添加simpCfg参数，沿用容器上记录的选项
+	if err := daemon.containerStart(container, "", "", true, backend.ContainerStartSimplifyConfig{}); err != nil {
 		// 修改
 		return err
 	}
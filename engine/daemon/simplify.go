@@ -0,0 +1,1203 @@
+package daemon // import "github.com/docker/docker/daemon"
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/distribution/reference"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/backend"
+	containertypes "github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/container"
+	"github.com/docker/docker/daemon/config"
+	"github.com/docker/docker/daemon/exec"
+	"github.com/docker/docker/daemon/graphdriver"
+	"github.com/docker/docker/daemon/images"
+	"github.com/docker/docker/daemon/simplify"
+	"github.com/docker/docker/distribution"
+	"github.com/docker/docker/errdefs"
+	"github.com/docker/docker/image"
+	"github.com/docker/docker/pkg/containerfs"
+	"github.com/docker/docker/pkg/stringid"
+	rsystem "github.com/opencontainers/runc/libcontainer/system"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// 修改： 添加精简模式启动前的检查
+
+// simplifyOnStart returns whether the container starts in simplified mode:
+// as requested, or else as it last started, so that restart policies,
+// live-restore and docker restart keep the choice.
+func simplifyOnStart(container *container.Container, simpCfg backend.ContainerStartSimplifyConfig) bool {
+	if simpCfg.SimplifyImage != nil {
+		return *simpCfg.SimplifyImage
+	}
+	return container.SimplifyImage
+}
+
+// simplifyRequested returns true if the start of container with simpCfg,
+// or its creation, asks for anything of image simplification.
+func simplifyRequested(container *container.Container, simpCfg backend.ContainerStartSimplifyConfig) bool {
+	return simplifyOnStart(container, simpCfg) || simpCfg.SimplifyRecord || simpCfg.SimplifyAudit != ""
+}
+
+// checkSimplifyOnStart verifies that the storage driver can mount the
+// container's rootfs in simplified mode, and that its image carries
+// simplification data, before anything is set up for the mount.
+func (daemon *Daemon) checkSimplifyOnStart(container *container.Container) error {
+	if err := daemon.checkSimplifyMount(container.OS); err != nil {
+		return simplifyNotSupportedError{err}
+	}
+	info, err := daemon.imageService.SimplifyInfo(container.ImageID)
+	if err != nil {
+		return errdefs.System(err)
+	}
+	if info == nil {
+		return imageNotSimplifiedError{image: container.Config.Image}
+	}
+	return nil
+}
+
+// checkSimplifyMount returns why the rootfs of the containers of os cannot
+// be mounted in simplified mode, nil if it can. Daemons running in a user
+// namespace cannot, whatever their storage driver.
+func (daemon *Daemon) checkSimplifyMount(os string) error {
+	if rsystem.RunningInUserNS() {
+		return errdefs.NotImplemented(simplify.ErrRootlessNotSupported)
+	}
+	return graphdriver.CheckSimplify(daemon.imageService.GraphDriverForOS(os))
+}
+
+// simplifyByPolicy returns whether the simplify image policy of the daemon
+// starts the container in simplified mode. Containers whose image carries
+// no simplification data start in full mode whatever the policy: their
+// creator did not ask for a simplified image. So do all containers if the
+// storage driver cannot mount simplified rootfs.
+func (daemon *Daemon) simplifyByPolicy(container *container.Container) bool {
+	if !simplifyImagePolicy(daemon.configStore.SimplifyImagePolicy, container.Config.Image) {
+		return false
+	}
+	if err := daemon.checkSimplifyMount(container.OS); err != nil {
+		logrus.WithField("container", container.ID).Warnf("starting in full mode despite the simplify image policy: %v", err)
+		return false
+	}
+	info, err := daemon.imageService.SimplifyInfo(container.ImageID)
+	if err != nil || info == nil {
+		logrus.WithField("container", container.ID).Debugf("image %s is not simplified, starting in full mode despite the simplify image policy", container.Config.Image)
+		return false
+	}
+	return true
+}
+
+// simplifyImagePolicy returns whether policy simplifies the containers of
+// the image ref. The longest pattern matching ref applies, and "off" wins
+// over "on" between patterns naming the same images.
+func simplifyImagePolicy(policy map[string]string, ref string) bool {
+	if len(policy) == 0 {
+		return false
+	}
+	named, err := reference.ParseNormalizedNamed(ref)
+	if err != nil {
+		return false
+	}
+	name := named.Name()
+	var matched, mode string
+	for pattern, m := range policy {
+		p, err := config.ParseSimplifyImagePattern(pattern)
+		if err != nil || (name != p && !strings.HasPrefix(name, p+"/")) {
+			continue
+		}
+		if len(p) < len(matched) || (len(p) == len(matched) && mode == "off") {
+			continue
+		}
+		matched, mode = p, m
+	}
+	return mode == "on"
+}
+
+// simplifiedImageWarning returns a warning if the image id, named name, was
+// pulled as a simplified image, whose missing files cannot be fetched on
+// demand.
+func (daemon *Daemon) simplifiedImageWarning(id image.ID, name string) string {
+	info, err := daemon.imageService.SimplifyInfo(id)
+	if err != nil || info == nil || info.Source != image.SimplifySourceRegistry || info.Annotations[distribution.AnnotationSimplified] != "true" {
+		return ""
+	}
+	return fmt.Sprintf("Image %s is a simplified image: files of its full image %s are missing from it and cannot be fetched on demand", name, info.Annotations[distribution.AnnotationSimplifyFullImage])
+}
+
+// 修改： 按需拉取精简镜像中缺失的文件
+
+// startSimplifyFetch starts answering the kernel for files missing from
+// simplified images. Without kernel support containers still start, but
+// pruned files stay missing. Storage drivers mounting simplified images as
+// clones need no kernel support: the files fetched are inserted into the
+// rootfs of the containers instead of being looked up.
+func (daemon *Daemon) startSimplifyFetch() {
+	daemon.serveSimplifyPeers()
+	sock := filepath.Join(daemon.configStore.ExecRoot, "simplify-fetch.sock")
+	if graphdriver.SimplifiesByClone(daemon.graphDrivers[runtime.GOOS]) {
+		sock = ""
+	} else if !simplify.Supported() {
+		logrus.Debug("overlay module has no fetch helper support, files pruned from simplified images will not be fetched")
+		return
+	} else if rsystem.RunningInUserNS() {
+		// 用户命名空间中无权设置overlay模块的参数
+		logrus.Debug("running in a user namespace, files pruned from simplified images will not be fetched")
+		return
+	}
+	s, err := simplify.NewServer(simplifyCacheRoot(daemon.configStore), sock, int64(daemon.configStore.SimplifyMaxCacheSize), time.Duration(daemon.configStore.SimplifyFetchTimeout)*time.Second, daemon.configStore.SimplifyMaxConcurrentFetches, daemon.logSimplifyEvent, daemon.idMappings, daemon.configStore.SimplifyCacheShared)
+	if err != nil {
+		logrus.WithError(err).Warn("failed to start simplify fetch, files pruned from simplified images will not be fetched")
+		return
+	}
+	s.SetBlobSources(simplifyPeerSources(daemon.configStore))
+	s.SetDrainTimeout(time.Duration(daemon.configStore.SimplifyFetchDrainTimeout) * time.Second)
+	daemon.simplifyFetch = s
+}
+
+// serveSimplifyPeers serves the files fetched for simplified images to the
+// daemons configured with this one as a peer, if an address is configured.
+func (daemon *Daemon) serveSimplifyPeers() {
+	addr := daemon.configStore.SimplifyPeerListen
+	if addr == "" {
+		return
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		logrus.WithError(err).Warn("failed to serve simplify peers")
+		return
+	}
+	srv := &http.Server{Handler: simplify.NewPeerHandler(simplifyCacheRoot(daemon.configStore), daemon.configStore.SimplifyPeerToken)}
+	go func() {
+		if err := srv.Serve(l); err != nil && err != http.ErrServerClosed {
+			logrus.WithError(err).Warn("simplify peer server stopped")
+		}
+	}()
+	daemon.simplifyPeers = srv
+}
+
+// simplifyPeerSources returns the peers configured as sources of the files
+// missing from simplified images.
+func simplifyPeerSources(conf *config.Config) []simplify.BlobSource {
+	var sources []simplify.BlobSource
+	for _, p := range conf.SimplifyPeers {
+		if p, err := config.ValidateSimplifyPeer(p); err == nil {
+			sources = append(sources, simplify.NewPeerSource(p, conf.SimplifyPeerToken))
+		}
+	}
+	return sources
+}
+
+// simplifyUnsupported returns why containers cannot start on simplified
+// images, and why the files pruned from them are not fetched on demand,
+// empty if they can and are.
+func (daemon *Daemon) simplifyUnsupported() (string, string) {
+	if runtime.GOOS == "windows" {
+		return simplify.ErrWindowsNotSupported.Error(), simplify.ErrWindowsNotSupported.Error()
+	}
+	var mount, fetch string
+	if err := daemon.checkSimplifyMount(runtime.GOOS); err != nil {
+		mount = err.Error()
+	}
+	switch {
+	case daemon.simplifyFetch != nil:
+	case rsystem.RunningInUserNS():
+		fetch = simplify.ErrRootlessNotSupported.Error()
+	case !simplify.Supported():
+		fetch = "overlay module has no fetch helper support"
+	default:
+		fetch = "the fetch service failed to start, see the daemon logs"
+	}
+	return mount, fetch
+}
+
+// fillSimplifyInfo fills in info whether simplified images are supported,
+// along with the health of the service fetching files on demand, the size
+// of its cache and how often they were found in it since the daemon
+// started.
+func (daemon *Daemon) fillSimplifyInfo(info *types.SimplifyInfo) {
+	info.Enabled = info.Unsupported == ""
+	info.Drivers = graphdriver.SimplifyDrivers()
+	info.ProfileDir = simplify.ProfileRoot(daemon.configStore.Root)
+	if daemon.simplifyFetch == nil {
+		return
+	}
+	size, err := daemon.simplifyFetch.CacheSize()
+	if err != nil {
+		logrus.WithError(err).Warn("could not get the size of the simplify cache")
+	}
+	info.CacheSize = size
+	h := daemon.simplifyFetch.Health()
+	info.FetchHealth = "healthy"
+	if !h.Healthy {
+		info.FetchHealth = "restarting"
+	}
+	info.FetchRestarts, info.FetchLastError = h.Restarts, h.LastError
+	st := daemon.simplifyFetch.TotalStats()
+	info.Fetches = st.Fetches
+	if st.Fetches > 0 {
+		info.CacheHitRatio = float64(st.CacheHits) / float64(st.Fetches)
+	}
+}
+
+// logSimplifyEvent logs an event of the on-demand fetching of the container
+// whose writable layer has the given mount ID. Failed fetches are also
+// recorded in the state of the container.
+func (daemon *Daemon) logSimplifyEvent(mountID, action string, attributes map[string]string) {
+	c := daemon.containers.First(func(c *container.Container) bool {
+		if !c.SimplifyFetch {
+			return false
+		}
+		id, err := daemon.imageService.GetLayerMountID(c.ID, c.OS)
+		return err == nil && id == mountID
+	})
+	if c == nil {
+		return
+	}
+	if action == simplify.EventFetchError {
+		// 容器锁可能被等待该文件的操作持有，如docker cp
+		go daemon.setSimplifyFetchError(c, attributes["error"])
+	}
+	attributes["imageID"] = c.ImageID.String()
+	daemon.LogContainerEventWithAttributes(c, action, attributes)
+}
+
+// setSimplifyFetchError records the last fetch of a missing file that
+// failed for the container. It is kept once the container exits, as the
+// failure may be why, until it starts again.
+func (daemon *Daemon) setSimplifyFetchError(c *container.Container, msg string) {
+	c.Lock()
+	defer c.Unlock()
+	c.State.SimplifyFetchError = msg
+	if err := c.CheckpointTo(daemon.containersReplica); err != nil {
+		logrus.WithError(err).WithField("container", c.ID).Error("failed to save simplify fetch error")
+	}
+}
+
+// maxMissingListed is how many of the files missing from the rootfs of a
+// container started offline are listed in the error.
+const maxMissingListed = 10
+
+// simplifyOffline returns whether the container starts without fetching
+// missing files: as requested, or else as the daemon is configured to.
+func (daemon *Daemon) simplifyOffline(simpCfg backend.ContainerStartSimplifyConfig) bool {
+	if simpCfg.SimplifyOffline != nil {
+		return *simpCfg.SimplifyOffline
+	}
+	return daemon.configStore.SimplifyOffline
+}
+
+// checkSimplifyOffline refuses to start the container, whose rootfs is
+// mounted, without fetching missing files if files the profile of its
+// simplified image keeps are missing from it.
+func (daemon *Daemon) checkSimplifyOffline(container *container.Container) error {
+	missing, total, err := daemon.imageService.SimplifyMissingFiles(context.Background(), container.ImageID, container.OS, container.BaseFS.Path(), maxMissingListed)
+	if err != nil {
+		return errdefs.Unavailable(errors.Wrap(err, "cannot verify offline that the files kept by the simplify profile are in the image"))
+	}
+	if total > 0 {
+		return simplifyMissingError{missing: missing, total: total}
+	}
+	return nil
+}
+
+// simplifyCacheRoot returns the directory of the files fetched on demand for
+// simplified images. With user namespaces remapped, the files are owned by
+// the remapped IDs, so a configured directory is split by remapped root as
+// the daemon root is.
+func simplifyCacheRoot(conf *config.Config) string {
+	if conf.SimplifyCacheDir != "" {
+		if conf.RemappedRoot != "" {
+			// daemon根目录已位于以重映射的"uid.gid"命名的子目录
+			return filepath.Join(conf.SimplifyCacheDir, filepath.Base(conf.Root))
+		}
+		return conf.SimplifyCacheDir
+	}
+	return simplify.CacheRoot(conf.Root)
+}
+
+// simplifyRangeRoot returns the directory the ranges of layer blobs
+// downloaded by interrupted simplified pulls are kept in.
+func simplifyRangeRoot(conf *config.Config) string {
+	return filepath.Join(conf.Root, "simplify", "ranges")
+}
+
+// simplifyPlaceholders returns whether the files pruned from the images the
+// daemon simplifies are left as placeholders. Placeholders need the overlay
+// module to fetch them when opened, which storage drivers mounting
+// simplified images as clones do not use.
+func (daemon *Daemon) simplifyPlaceholders() bool {
+	if !daemon.configStore.SimplifyPlaceholders {
+		return false
+	}
+	if daemon.simplifyFetch == nil || graphdriver.SimplifiesByClone(daemon.graphDrivers[runtime.GOOS]) {
+		logrus.Warn("simplify placeholders need the overlay module to fetch files on demand, pruned files are left out instead")
+		return false
+	}
+	return true
+}
+
+// simplifyRegistries returns the registries simplification is restricted
+// to, named as in image references.
+func simplifyRegistries(conf *config.Config) []string {
+	var registries []string
+	for _, r := range conf.SimplifyRegistries {
+		if r, err := config.ValidateSimplifyRegistry(r); err == nil {
+			registries = append(registries, r)
+		}
+	}
+	return registries
+}
+
+// attachSimplifyFetch prepares on-demand fetching for a container running
+// from a simplified image and returns the directory to layer underneath its
+// writable layer, or "" if nothing can be fetched for it.
+func (daemon *Daemon) attachSimplifyFetch(container *container.Container) (string, error) {
+	if daemon.simplifyFetch == nil {
+		return "", nil
+	}
+	sources, err := daemon.imageService.SimplifyFetchSources(container.ImageID, container.OS)
+	if err != nil {
+		return "", errdefs.System(err)
+	}
+	if len(sources) == 0 {
+		return "", nil
+	}
+	mountID, err := daemon.imageService.GetLayerMountID(container.ID, container.OS)
+	if err != nil {
+		return "", errdefs.System(err)
+	}
+	dir, err := daemon.simplifyFetch.Attach(context.Background(), mountID, container.ImageID.Digest().Hex(), sources, container.SimplifyFetchTimeout, container.SimplifyMaxConcurrentFetches)
+	if err != nil {
+		return "", errdefs.System(err)
+	}
+	return dir, nil
+}
+
+// detachSimplifyFetch releases what attachSimplifyFetch set up. It is a
+// no-op for containers started without on-demand fetching.
+func (daemon *Daemon) detachSimplifyFetch(container *container.Container) {
+	if daemon.simplifyFetch == nil {
+		return
+	}
+	if mountID, err := daemon.imageService.GetLayerMountID(container.ID, container.OS); err == nil {
+		daemon.simplifyFetch.Detach(mountID)
+	}
+}
+
+// startSimplifyMounts loads the read-only mounts of image layers shared by
+// simplified containers. Without them every container mounts the layers of
+// its image on its own.
+func (daemon *Daemon) startSimplifyMounts() {
+	m, err := simplify.NewSharedMounts(simplify.SharedMountRoot(daemon.root))
+	if err != nil {
+		logrus.WithError(err).Warn("failed to load simplify shared mounts, image layers will not be shared")
+		return
+	}
+	daemon.simplifyMounts = m
+}
+
+// acquireSimplifyLower returns the shared read-only mount of the layers of
+// the container's image to mount its writable layer on, or "" if the
+// container mounts them on its own.
+func (daemon *Daemon) acquireSimplifyLower(container *container.Container) string {
+	if daemon.simplifyMounts == nil || container.RWLayer == nil {
+		return ""
+	}
+	metadata, err := container.RWLayer.Metadata()
+	if err != nil {
+		return ""
+	}
+	// 第一层是容器的init层，其余为镜像层；镜像只有一层时没有可共享的挂载
+	lowers := strings.Split(metadata["LowerDir"], ":")
+	if len(lowers) < 3 {
+		return ""
+	}
+	target, err := daemon.simplifyMounts.Acquire(container.ID, lowers[1:], container.GetMountLabel())
+	if err != nil {
+		logrus.WithError(err).WithField("container", container.ID).Warn("failed to share the mount of image layers")
+		return ""
+	}
+	return target
+}
+
+// releaseSimplifyLower releases what acquireSimplifyLower acquired. It is a
+// no-op for containers not holding a shared mount.
+func (daemon *Daemon) releaseSimplifyLower(container *container.Container) {
+	if daemon.simplifyMounts == nil {
+		return
+	}
+	if err := daemon.simplifyMounts.Release(container.ID); err != nil {
+		logrus.WithError(err).WithField("container", container.ID).Warn("failed to release the shared mount of image layers")
+	}
+}
+
+// cleanupSimplify tears down what containerStart set up for a simplified
+// container once its root filesystem is unmounted. Each step is a no-op for
+// containers started normally, and for those already cleaned up.
+func (daemon *Daemon) cleanupSimplify(container *container.Container) {
+	daemon.releaseSimplifyLower(container)
+	daemon.detachSimplifyFetch(container)
+	container.SimplifyFetch = false
+	container.State.SimplifyDegraded = ""
+}
+
+// reattachSimplifyFetch fetches the files missing from the rootfs of a
+// container that kept running while the daemon restarted, as the previous
+// daemon did. If it cannot, the container is marked degraded, since the
+// missing files it opens will not be found.
+func (daemon *Daemon) reattachSimplifyFetch(c *container.Container) {
+	if !c.SimplifyFetch {
+		return
+	}
+	dir, err := daemon.attachSimplifyFetch(c)
+	if err == nil && dir == "" {
+		err = errors.New("on-demand fetching is no longer available")
+	}
+	if err == nil && c.BaseFS != nil && daemon.simplifiesByClone(c) {
+		err = daemon.insertSimplifyFetches(c)
+	}
+	if err == nil {
+		daemon.prefetchSimplified(c)
+		return
+	}
+	logrus.WithError(err).WithField("container", c.ID).Error("failed to re-attach simplify fetch to restored container, files missing from its rootfs will not be found")
+	c.Lock()
+	c.State.SimplifyDegraded = fmt.Sprintf("files missing from the simplified rootfs cannot be fetched: %v", err)
+	if err := c.CheckpointTo(daemon.containersReplica); err != nil {
+		logrus.WithError(err).WithField("container", c.ID).Error("failed to save degraded container state")
+	}
+	c.Unlock()
+}
+
+// reconcileSimplify removes the simplify state left behind by containers and
+// images that no longer exist, or exited while the daemon was down, and by
+// simplified pulls that never resumed, then
+// starts evicting the fetch caches. No container may have been started yet,
+// and those still running must have been attached again.
+func (daemon *Daemon) reconcileSimplify() {
+	daemon.reapSimplifyMounts()
+	removed, err := daemon.imageService.RemoveOrphanedSimplifyCaches()
+	if err != nil {
+		logrus.WithError(err).Warn("failed to remove orphaned simplify fetch caches")
+	}
+	for _, id := range removed {
+		logrus.WithField("image", id).Debug("removed simplify fetch cache of deleted image")
+	}
+	if err := daemon.imageService.RemoveStaleSimplifyRanges(); err != nil {
+		logrus.WithError(err).Warn("failed to remove stale ranges of interrupted simplified pulls")
+	}
+	// 所有仍在运行的容器都已重新挂载缓存，可以开始回收
+	if daemon.simplifyFetch != nil {
+		daemon.simplifyFetch.StartEviction()
+	}
+}
+
+// reapSimplifyMounts unmounts and removes the shared mounts no running
+// container holds anymore, such as those of containers that exited while
+// the daemon was down.
+func (daemon *Daemon) reapSimplifyMounts() {
+	if daemon.simplifyMounts == nil {
+		return
+	}
+	reaped, err := daemon.simplifyMounts.Reconcile(func(id string) bool {
+		c := daemon.containers.Get(id)
+		return c != nil && c.IsRunning()
+	})
+	if err != nil {
+		logrus.WithError(err).Warn("failed to reconcile simplify shared mounts")
+		return
+	}
+	for _, id := range reaped {
+		if err := daemon.cleanupMountsByID(id); err != nil {
+			logrus.WithError(err).WithField("mount", id).Warn("failed to unmount simplify shared mount")
+			continue
+		}
+		if err := daemon.simplifyMounts.Remove(id); err != nil {
+			logrus.WithError(err).WithField("mount", id).Warn("failed to remove simplify shared mount")
+		}
+	}
+}
+
+// simplifyStats returns the files looked up on demand for the container, or
+// nil if its missing files are not fetched.
+func (daemon *Daemon) simplifyStats(container *container.Container) *types.SimplifyStats {
+	if daemon.simplifyFetch == nil || !container.SimplifyFetch {
+		return nil
+	}
+	mountID, err := daemon.imageService.GetLayerMountID(container.ID, container.OS)
+	if err != nil {
+		return nil
+	}
+	st, ok := daemon.simplifyFetch.Stats(mountID)
+	if !ok {
+		return nil
+	}
+	return &types.SimplifyStats{
+		Fetches:      st.Fetches,
+		CacheHits:    st.CacheHits,
+		FetchedBytes: st.FetchedBytes,
+		LastFetch:    st.LastFetch,
+	}
+}
+
+// prefetchSimplified starts downloading the rest of the container's
+// simplified image in the background if the daemon is configured to.
+func (daemon *Daemon) prefetchSimplified(container *container.Container) {
+	if daemon.simplifyFetch == nil || !daemon.configStore.SimplifyPrefetch {
+		return
+	}
+	if mountID, err := daemon.imageService.GetLayerMountID(container.ID, container.OS); err == nil {
+		daemon.simplifyFetch.Prefetch(mountID, daemon.configStore.SimplifyPrefetchRate)
+	}
+}
+
+// SimplifySummary summarizes what was pruned from the full image the
+// simplified image imageID was derived from, or returns nil if there is no
+// full image to compare with.
+func (daemon *Daemon) SimplifySummary(ctx context.Context, imageID string, withPaths bool) (*types.SimplifySummary, error) {
+	summary, err := daemon.imageService.SimplifySummary(ctx, image.ID(imageID), withPaths)
+	if err != nil {
+		return nil, errdefs.System(err)
+	}
+	return summary, nil
+}
+
+// validateSimplifyConfig checks the file patterns and the threshold of a
+// simplified commit.
+func validateSimplifyConfig(c *backend.CreateImageConfig) error {
+	if runtime.GOOS == "windows" && c.Simp {
+		return errdefs.NotImplemented(simplify.ErrWindowsNotSupported)
+	}
+	if _, err := simplify.NewSelector(c.SimplifyKeep, c.SimplifyPrune); err != nil {
+		return errdefs.InvalidParameter(err)
+	}
+	if c.SimplifyThreshold != nil {
+		if err := simplify.ValidateThreshold(*c.SimplifyThreshold); err != nil {
+			return errdefs.InvalidParameter(err)
+		}
+	}
+	return nil
+}
+
+// SimplifyCommitDryRun reports what committing the container name with
+// simplification enabled would keep and prune, without creating an image.
+// The container is paused as for a real commit.
+func (daemon *Daemon) SimplifyCommitDryRun(ctx context.Context, name string, c *backend.CreateImageConfig) (*types.SimplifySummary, error) {
+	container, err := daemon.getCommittableContainer(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateSimplifyConfig(c); err != nil {
+		return nil, err
+	}
+
+	// 精简镜像会保留新镜像配置中的启动命令
+	config, err := newImageConfig(container, c)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Pause && !container.IsPaused() {
+		daemon.containerPause(container)
+		defer daemon.containerUnpause(container)
+	}
+
+	summary, err := daemon.imageService.SimplifyCommitDryRun(ctx, backend.CommitConfig{
+		Config:              config,
+		ContainerID:         container.ID,
+		ContainerMountLabel: container.MountLabel,
+		ContainerOS:         container.OS,
+		ParentImageID:       string(container.ImageID),
+		SimplifyKeep:        c.SimplifyKeep,
+		SimplifyPrune:       c.SimplifyPrune,
+		SimplifyThreshold:   c.SimplifyThreshold,
+		SimplifyProfile:     c.SimplifyProfile,
+		SimplifyForce:       c.SimplifyForce,
+	})
+	if err != nil {
+		return nil, errdefs.System(err)
+	}
+	return summary, nil
+}
+
+// 修改： 记录容器访问的文件
+
+// startSimplifyRecord starts recording the files the container opens. The
+// container's root filesystem must be mounted. It is a no-op if the
+// container is already recorded.
+func (daemon *Daemon) startSimplifyRecord(container *container.Container) error {
+	daemon.simplifyRecordMu.Lock()
+	defer daemon.simplifyRecordMu.Unlock()
+	if daemon.simplifyRecorders[container.ID] != nil {
+		return nil
+	}
+	r, err := simplify.NewRecorder(container.BaseFS.Path())
+	if err == simplify.ErrRecordNotSupported {
+		return errdefs.NotImplemented(err)
+	}
+	if err != nil {
+		return errdefs.System(err)
+	}
+	if daemon.simplifyRecorders == nil {
+		daemon.simplifyRecorders = make(map[string]*simplify.Recorder)
+	}
+	daemon.simplifyRecorders[container.ID] = r
+	return nil
+}
+
+// stopSimplifyRecord stops recording the files the container opens and
+// saves them with the container and as the profile of its image. It is a
+// no-op if the container is not recorded.
+func (daemon *Daemon) stopSimplifyRecord(container *container.Container) {
+	daemon.simplifyRecordMu.Lock()
+	r := daemon.simplifyRecorders[container.ID]
+	delete(daemon.simplifyRecorders, container.ID)
+	daemon.simplifyRecordMu.Unlock()
+	if r == nil {
+		return
+	}
+	r.Close()
+	profile := r.Profile()
+	profile.Image = container.ImageID.Digest()
+	profile.Reference = container.Config.Image
+	if img, err := daemon.imageService.GetImage(container.ImageID.String()); err == nil {
+		// 不同平台的镜像文件布局不同，记录运行的平台
+		profile.Platform = simplify.FormatPlatform(img.OperatingSystem(), img.Architecture)
+	}
+	profile.Runs = []string{stringid.GenerateRandomID()}
+	if err := profile.Save(simplify.RunProfilePath(container.Root)); err != nil {
+		logrus.WithError(err).WithField("container", container.ID).Warn("failed to save simplify profile")
+	}
+	// 最近一次记录的结果作为镜像的profile
+	if err := daemon.imageService.SaveSimplifyProfile(profile); err != nil {
+		logrus.WithError(err).WithField("container", container.ID).Warn("failed to store simplify profile of image")
+	}
+}
+
+// simplifiesByClone returns whether the storage driver of the container
+// mounts simplified images as clones, which neither copy up the files read
+// nor look up those missing.
+func (daemon *Daemon) simplifiesByClone(container *container.Container) bool {
+	return graphdriver.SimplifiesByClone(daemon.imageService.GraphDriverForOS(container.OS))
+}
+
+// startSimplifyOpened starts recording the files the container opens in
+// simplified mode, which a simplified commit of the container keeps as
+// overlay keeps the files copied up. The container's root filesystem must
+// be mounted. Without recording, the files only read are left out of the
+// commit.
+func (daemon *Daemon) startSimplifyOpened(container *container.Container) {
+	daemon.simplifyRecordMu.Lock()
+	defer daemon.simplifyRecordMu.Unlock()
+	if daemon.simplifyOpened[container.ID] != nil {
+		return
+	}
+	r, err := simplify.NewRecorder(container.BaseFS.Path())
+	if err != nil {
+		logrus.WithError(err).WithField("container", container.ID).Warn("failed to record the files opened in simplified mode, a simplified commit will only keep those written")
+		return
+	}
+	if daemon.simplifyOpened == nil {
+		daemon.simplifyOpened = make(map[string]*simplify.Recorder)
+	}
+	daemon.simplifyOpened[container.ID] = r
+}
+
+// stopSimplifyOpened stops recording the files the container opens in
+// simplified mode and adds them to those of its previous runs. It is a
+// no-op if they are not recorded.
+func (daemon *Daemon) stopSimplifyOpened(container *container.Container) {
+	daemon.simplifyRecordMu.Lock()
+	r := daemon.simplifyOpened[container.ID]
+	delete(daemon.simplifyOpened, container.ID)
+	daemon.simplifyRecordMu.Unlock()
+	if r == nil {
+		return
+	}
+	r.Close()
+	profile := &simplify.Profile{Paths: daemon.simplifyOpenedPaths(container, r)}
+	if err := profile.Save(simplify.OpenedProfilePath(container.Root)); err != nil {
+		logrus.WithError(err).WithField("container", container.ID).Warn("failed to save the files opened in simplified mode")
+	}
+}
+
+// simplifyOpenedPaths returns the files the container opened in simplified
+// mode, sorted: those of its previous runs, and those recorded by r so far
+// if it is not nil.
+func (daemon *Daemon) simplifyOpenedPaths(container *container.Container, r *simplify.Recorder) []string {
+	opened := make(map[string]bool)
+	if p, err := simplify.LoadProfile(simplify.OpenedProfilePath(container.Root)); err == nil {
+		for _, path := range p.Paths {
+			opened[path] = true
+		}
+	} else if !os.IsNotExist(err) {
+		logrus.WithError(err).WithField("container", container.ID).Warn("failed to load the files opened in simplified mode")
+	}
+	if r != nil {
+		for _, path := range r.Profile().Paths {
+			opened[path] = true
+		}
+	}
+	paths := make([]string, 0, len(opened))
+	for path := range opened {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// simplifyOpenedForCommit returns the files a simplified commit of the
+// container must keep although they are not in its writable layer, or nil
+// if its storage driver copies them up.
+func (daemon *Daemon) simplifyOpenedForCommit(container *container.Container) []string {
+	if !daemon.simplifiesByClone(container) {
+		return nil
+	}
+	daemon.simplifyRecordMu.Lock()
+	r := daemon.simplifyOpened[container.ID]
+	daemon.simplifyRecordMu.Unlock()
+	return daemon.simplifyOpenedPaths(container, r)
+}
+
+// insertSimplifyFetches inserts the files fetched for the container's image
+// into its root filesystem, for storage drivers mounting simplified images
+// as clones, under which the cache cannot be layered. It is a no-op for
+// containers whose missing files are not fetched.
+func (daemon *Daemon) insertSimplifyFetches(container *container.Container) error {
+	if daemon.simplifyFetch == nil || !container.SimplifyFetch {
+		return nil
+	}
+	mountID, err := daemon.imageService.GetLayerMountID(container.ID, container.OS)
+	if err != nil {
+		return errdefs.System(err)
+	}
+	if err := daemon.simplifyFetch.Insert(mountID, container.BaseFS.Path(), simplify.InsertStatePath(container.Root)); err != nil {
+		return errdefs.System(err)
+	}
+	return nil
+}
+
+// 修改： 运行完整镜像，审计profile精简掉的文件是否会被访问
+
+// simplifyAudit is the audit of a container of a full image against a
+// profile.
+type simplifyAudit struct {
+	profile  string
+	recorder *simplify.Recorder
+	audit    *simplify.Audit
+	// done is closed once the files the profile prunes are known, or err
+	// is set
+	done chan struct{}
+	err  error
+}
+
+// startSimplifyAudit starts comparing the files the container opens with
+// those a simplified image made from its image with the profile stored for
+// the image named profile would prune, emitting an event for each. The
+// container's root filesystem must be mounted. It is a no-op if the
+// container is already audited.
+func (daemon *Daemon) startSimplifyAudit(container *container.Container, profile string) error {
+	sel, err := daemon.imageService.SimplifyAuditSelector(container.ImageID, profile)
+	if err != nil {
+		return err
+	}
+	daemon.simplifyAuditMu.Lock()
+	defer daemon.simplifyAuditMu.Unlock()
+	if daemon.simplifyAudits[container.ID] != nil {
+		return nil
+	}
+	r, err := simplify.NewRecorder(container.BaseFS.Path())
+	if err == simplify.ErrRecordNotSupported {
+		return errdefs.NotImplemented(err)
+	}
+	if err != nil {
+		return errdefs.System(err)
+	}
+	imageID := container.ImageID
+	a := &simplifyAudit{profile: profile, recorder: r, done: make(chan struct{})}
+	a.audit = simplify.NewAudit(func(path string) {
+		simplifyAuditMisses.Inc()
+		daemon.LogContainerEventWithAttributes(container, simplify.EventAuditMiss, map[string]string{
+			"path":    path,
+			"profile": profile,
+			"imageID": imageID.String(),
+		})
+	})
+	// 计算精简掉的文件需要读取整个镜像，在后台进行，之前访问的文件随后比较
+	go func() {
+		defer close(a.done)
+		pruned, err := daemon.imageService.SimplifyPrunedPaths(context.Background(), imageID, sel)
+		if err != nil {
+			a.err = err
+			return
+		}
+		a.audit.SetPruned(pruned)
+	}()
+	r.Notify(a.audit.Opened)
+	if daemon.simplifyAudits == nil {
+		daemon.simplifyAudits = make(map[string]*simplifyAudit)
+	}
+	daemon.simplifyAudits[container.ID] = a
+	return nil
+}
+
+// stopSimplifyAudit stops auditing the container and emits an event
+// reporting how many of the files it opened would have been pruned, once
+// they are known. It is a no-op if the container is not audited.
+func (daemon *Daemon) stopSimplifyAudit(container *container.Container) {
+	daemon.simplifyAuditMu.Lock()
+	a := daemon.simplifyAudits[container.ID]
+	delete(daemon.simplifyAudits, container.ID)
+	daemon.simplifyAuditMu.Unlock()
+	if a == nil {
+		return
+	}
+	a.recorder.Close()
+	imageID := container.ImageID
+	go func() {
+		<-a.done
+		attributes := map[string]string{
+			"profile": a.profile,
+			"imageID": imageID.String(),
+		}
+		if a.err != nil {
+			logrus.WithError(a.err).WithField("container", container.ID).Warn("failed to audit simplify profile")
+			attributes["error"] = a.err.Error()
+		} else {
+			attributes["misses"] = strconv.Itoa(len(a.audit.Misses()))
+		}
+		if a.recorder.Profile().Truncated {
+			// 有访问没有记录下来，结果可能不完整
+			attributes["truncated"] = "true"
+		}
+		daemon.LogContainerEventWithAttributes(container, simplify.EventAudit, attributes)
+	}()
+}
+
+// ContainerSimplifyRecord starts recording the files the running container
+// name opens, until it stops.
+func (daemon *Daemon) ContainerSimplifyRecord(name string) error {
+	container, err := daemon.GetContainer(name)
+	if err != nil {
+		return err
+	}
+	container.Lock()
+	defer container.Unlock()
+	if !container.Running {
+		return errNotRunning(container.ID)
+	}
+	return daemon.startSimplifyRecord(container)
+}
+
+// ContainerSimplifyProfile returns the files the container name opened while
+// they were recorded: those recorded so far if it is running, or those
+// recorded until it last stopped.
+func (daemon *Daemon) ContainerSimplifyProfile(name string) (*types.ContainerSimplifyProfile, error) {
+	container, err := daemon.GetContainer(name)
+	if err != nil {
+		return nil, err
+	}
+
+	daemon.simplifyRecordMu.Lock()
+	r := daemon.simplifyRecorders[container.ID]
+	daemon.simplifyRecordMu.Unlock()
+	var profile *simplify.Profile
+	if r != nil {
+		profile = r.Profile()
+	} else if profile, err = simplify.LoadProfile(simplify.RunProfilePath(container.Root)); err != nil {
+		if os.IsNotExist(err) {
+			return nil, errdefs.NotFound(errors.Errorf("no files were recorded for container %s", container.ID))
+		}
+		return nil, errdefs.System(err)
+	}
+	return &types.ContainerSimplifyProfile{
+		Recording: r != nil,
+		Truncated: profile.Truncated,
+		Paths:     profile.Paths,
+	}, nil
+}
+
+// ContainerSimplifyFetches returns the files looked up on demand for the
+// container name since the daemon started, as options select them.
+func (daemon *Daemon) ContainerSimplifyFetches(name string, options types.ContainerSimplifyFetchesOptions) (*types.ContainerSimplifyFetches, error) {
+	container, err := daemon.GetContainer(name)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		entries []simplify.FetchLogEntry
+		more    bool
+		ok      bool
+	)
+	if daemon.simplifyFetch != nil {
+		if mountID, err := daemon.imageService.GetLayerMountID(container.ID, container.OS); err == nil {
+			entries, more, ok = daemon.simplifyFetch.FetchLog(mountID, options.After, options.Limit)
+		}
+	}
+	if !ok {
+		return nil, errdefs.NotFound(errors.Errorf("no files were fetched on demand for container %s", container.ID))
+	}
+	fetches := &types.ContainerSimplifyFetches{Fetches: []types.SimplifyFetch{}, More: more}
+	for _, e := range entries {
+		fetches.Fetches = append(fetches.Fetches, types.SimplifyFetch{
+			ID:      e.ID,
+			Path:    e.Path,
+			Size:    e.Size,
+			Latency: e.Latency,
+			Source:  e.Source,
+			Time:    e.Time,
+			Outcome: e.Outcome,
+			Error:   e.Error,
+		})
+	}
+	return fetches, nil
+}
+
+// forgetSimplifyFetches drops the files looked up on demand for the
+// container, which is being removed.
+func (daemon *Daemon) forgetSimplifyFetches(container *container.Container) {
+	if daemon.simplifyFetch == nil {
+		return
+	}
+	if mountID, err := daemon.imageService.GetLayerMountID(container.ID, container.OS); err == nil {
+		daemon.simplifyFetch.ForgetFetchLog(mountID)
+	}
+}
+
+// 修改： docker cp读写精简镜像容器中被裁剪的路径
+
+// simplifiedPath returns the files pruned from the simplified image of the
+// container, whose root filesystem is mounted, at the host path resolvedPath
+// or under it, fetched into the cache unless the daemon is offline. It
+// returns nil if none are missing from the root filesystem.
+func (daemon *Daemon) simplifiedPath(container *container.Container, resolvedPath string) (*images.SimplifiedPath, error) {
+	driver := container.BaseFS
+	rel, err := driver.Rel(driver.Path(), resolvedPath)
+	if err != nil {
+		return nil, err
+	}
+	return daemon.imageService.SimplifyPath(context.Background(), container.ImageID, container.OS, container.RWLayer, driver.Path(), filepath.Clean("/"+rel), !daemon.configStore.SimplifyOffline)
+}
+
+// prunedPathError returns the error of docker cp for the path file, pruned
+// from the simplified image of a container, whose files cannot be fetched.
+func (daemon *Daemon) prunedPathError(file string) error {
+	return simplifyPrunedError{file: file, reason: daemon.noFetchReason()}
+}
+
+// noFetchReason returns why the files pruned from simplified images cannot
+// be fetched.
+func (daemon *Daemon) noFetchReason() string {
+	if daemon.configStore.SimplifyOffline {
+		return "the daemon is offline"
+	}
+	return "on-demand fetching is not available on this daemon"
+}
+
+// statSimplifiedPath stats the resource at resolvedPath, a host path in the
+// mounted root filesystem of the container, as container.StatPath does. If
+// it is missing, or is a directory and dirs is set, the files pruned from
+// the simplified image of the container there are returned too and counted
+// in the stat, and a missing resource is stat in the cache they were fetched
+// into. The files must be released once read.
+func (daemon *Daemon) statSimplifiedPath(container *container.Container, resolvedPath, absPath string, dirs bool) (*types.ContainerPathStat, *images.SimplifiedPath, error) {
+	stat, statErr := container.StatPath(resolvedPath, absPath)
+	if statErr == nil && (!dirs || !stat.Mode.IsDir()) || statErr != nil && !os.IsNotExist(statErr) {
+		return stat, nil, statErr
+	}
+	sp, err := daemon.simplifiedPath(container, resolvedPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	if sp == nil {
+		return stat, nil, statErr
+	}
+	if statErr != nil {
+		if sp.Dir == "" {
+			return nil, nil, daemon.prunedPathError(absPath)
+		}
+		if stat, err = prunedPathStat(sp, absPath); err != nil {
+			sp.Release()
+			return nil, nil, err
+		}
+	}
+	stat.Fetched, stat.Pruned = len(sp.Missing), sp.Pruned
+	return stat, sp, nil
+}
+
+// prunedPathStat stats the path of sp, missing from the root filesystem of
+// its container, in the cache it was fetched into.
+func prunedPathStat(sp *images.SimplifiedPath, absPath string) (*types.ContainerPathStat, error) {
+	p := filepath.Join(sp.Dir, sp.Path)
+	lstat, err := os.Lstat(p)
+	if err != nil {
+		return nil, err
+	}
+	var linkTarget string
+	if lstat.Mode()&os.ModeSymlink != 0 {
+		// 链接指向的路径可能同样被裁剪，只按字面解析
+		if linkTarget, err = os.Readlink(p); err != nil {
+			return nil, err
+		}
+		if !filepath.IsAbs(linkTarget) {
+			linkTarget = filepath.Join(filepath.Dir(sp.Path), linkTarget)
+		}
+		linkTarget = filepath.Clean(linkTarget)
+	}
+	return &types.ContainerPathStat{
+		Name:       filepath.Base(absPath),
+		Size:       lstat.Size(),
+		Mode:       lstat.Mode(),
+		Mtime:      lstat.ModTime(),
+		LinkTarget: linkTarget,
+	}, nil
+}
+
+// extractPrunedDirs creates the directory at resolvedPath, a host path in
+// the mounted root filesystem of the container, and those above it if they
+// were pruned from its simplified image too, so that an archive can be
+// extracted to it. It is a no-op if the directory was not pruned.
+func (daemon *Daemon) extractPrunedDirs(container *container.Container, resolvedPath, absPath string) error {
+	sp, err := daemon.simplifiedPath(container, resolvedPath)
+	if err != nil || sp == nil {
+		return err
+	}
+	defer sp.Release()
+	if sp.Dir == "" {
+		return daemon.prunedPathError(absPath)
+	}
+	driver := container.BaseFS
+	dirs, err := simplify.MissingDirs(sp.Dir, driver.Path(), sp.Path)
+	if err != nil || len(dirs) == 0 {
+		return err
+	}
+	if container.HostConfig.ReadonlyRootfs {
+		return ErrRootFSReadOnly
+	}
+	rc := simplify.CopyCache(nil, sp.Dir, "/", "/", dirs, daemon.idMappings)
+	defer rc.Close()
+	return extractArchive(driver, rc, driver.Path(), daemon.defaultTarCopyOptions(false))
+}
+
+// 修改： 多阶段构建COPY --from精简镜像时拉取被裁剪的文件
+
+// SimplifyCopySource fetches the files pruned from the image imageID, if it
+// is simplified, at the path p of rootfs or under it, and extracts them into
+// rootfs, the root filesystem of a fresh layer on top of the image the
+// builder copies from. It fails if they cannot be fetched, rather than
+// letting the COPY miss them.
+func (daemon *Daemon) SimplifyCopySource(ctx context.Context, imageID string, rootfs containerfs.ContainerFS, p string) error {
+	img, err := daemon.imageService.GetImage(imageID)
+	if err != nil {
+		return err
+	}
+	p = filepath.Clean("/" + p)
+	sp, err := daemon.imageService.SimplifyPath(ctx, img.ID(), img.OperatingSystem(), nil, rootfs.Path(), p, !daemon.configStore.SimplifyOffline)
+	if err != nil || sp == nil {
+		return err
+	}
+	defer sp.Release()
+	if sp.Dir == "" {
+		return errdefs.NotFound(errors.Errorf("%d files at %s were pruned from the simplified image %s and cannot be fetched: %s", sp.Pruned, p, stringid.TruncateID(imageID), daemon.noFetchReason()))
+	}
+	rc := simplify.CopyCache(nil, sp.Dir, "/", "/", sp.Missing, daemon.idMappings)
+	defer rc.Close()
+	return extractArchive(rootfs, rc, rootfs.Path(), daemon.defaultTarCopyOptions(false))
+}
+
+// 修改： docker exec的命令被精简时按需拉取
+
+// execUserFiles are the files users and groups given by name are looked up
+// in when running exec commands.
+var execUserFiles = []string{"/etc/passwd", "/etc/group"}
+
+// prepareSimplifiedExec fetches the executable of the exec command ec, run in
+// cwd, and the files it needs, if they were pruned from the simplified image
+// of the running container c, along with the files users are looked up in if
+// ec names its user or group. It fails naming simplification as the cause if
+// they cannot be fetched, rather than letting the command not be found.
+func (daemon *Daemon) prepareSimplifiedExec(ctx context.Context, c *container.Container, ec *exec.Config, cwd string) error {
+	if c.BaseFS == nil {
+		return nil
+	}
+	var paths []string
+	if userByName(ec.User) {
+		paths = execUserFiles
+	}
+	fetch := c.SimplifyFetch && !daemon.configStore.SimplifyOffline
+	config := &containertypes.Config{Cmd: []string{ec.Entrypoint}, Env: ec.Env, WorkingDir: cwd}
+	se, err := daemon.imageService.SimplifyExec(ctx, c.ImageID, c.OS, c.BaseFS.Path(), config, paths, fetch)
+	if err != nil {
+		// 读取不到完整镜像时照常执行
+		logrus.WithError(err).WithField("container", c.ID).Debug("cannot look up the files of the exec command pruned from the simplified image")
+		return nil
+	}
+	if se == nil {
+		return nil
+	}
+	reason := "the container was started offline"
+	switch {
+	case se.Err != nil:
+		reason = se.Err.Error()
+	case daemon.simplifyFetch == nil:
+		reason = "on-demand fetching is not available on this daemon"
+	case daemon.configStore.SimplifyOffline:
+		reason = "the daemon is offline"
+	}
+	return simplifyExecError{cmd: ec.Entrypoint, image: c.Config.Image, missing: se.Missing, reason: reason}
+}
+
+// prepareSimplifiedHealthcheck fetches the executables of the healthcheck of
+// the running container c and the files they need, as prepareSimplifiedExec
+// does, before its first probe, so that probes do not fail because they were
+// pruned from its simplified image. Scripts run by a shell are looked into
+// for their first command.
+func (daemon *Daemon) prepareSimplifiedHealthcheck(c *container.Container) {
+	if c.BaseFS == nil {
+		return
+	}
+	var paths []string
+	if userByName(c.Config.User) {
+		paths = execUserFiles
+	}
+	// 只解析健康检查的命令
+	config := *c.Config
+	config.Entrypoint, config.Cmd = nil, nil
+	fetch := c.SimplifyFetch && !daemon.configStore.SimplifyOffline
+	se, err := daemon.imageService.SimplifyExec(context.Background(), c.ImageID, c.OS, c.BaseFS.Path(), &config, paths, fetch)
+	if err != nil {
+		logrus.WithError(err).WithField("container", c.ID).Debug("cannot look up the files of the healthcheck pruned from the simplified image")
+		return
+	}
+	if se == nil {
+		return
+	}
+	entry := logrus.WithFields(logrus.Fields{"container": c.ID, "missing": strings.Join(se.Missing, ",")})
+	if se.Err != nil {
+		entry = entry.WithError(se.Err)
+	}
+	entry.Warn("files the healthcheck needs were pruned from the simplified image and cannot be fetched, its probes may fail")
+}
+
+// userByName returns true if the user of an exec command, given as
+// user[:group], names the user or the group rather than giving their IDs.
+func userByName(user string) bool {
+	for _, part := range strings.SplitN(user, ":", 2) {
+		if _, err := strconv.Atoi(part); part != "" && err != nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,17 @@
+package simplify // import "github.com/docker/docker/daemon/simplify"
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// accessTime returns the time the file was last accessed, as far as the
+// mount options of its filesystem keep track of it.
+func accessTime(fi os.FileInfo) time.Time {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return time.Time{}
+	}
+	return time.Unix(st.Atim.Unix())
+}
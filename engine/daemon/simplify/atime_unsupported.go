@@ -0,0 +1,13 @@
+// +build !linux
+
+package simplify // import "github.com/docker/docker/daemon/simplify"
+
+import (
+	"os"
+	"time"
+)
+
+// accessTime is not known on this platform.
+func accessTime(fi os.FileInfo) time.Time {
+	return time.Time{}
+}
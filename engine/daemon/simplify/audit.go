@@ -0,0 +1,132 @@
+package simplify // import "github.com/docker/docker/daemon/simplify"
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// EventAuditMiss is the action of the event emitted the first time a
+// container audited against a profile opens a file a simplified image made
+// from the profile would have pruned.
+const EventAuditMiss = "simplify-audit-miss"
+
+// EventAudit is the action of the event emitted once the audit of a
+// container against a profile is over.
+const EventAudit = "simplify-audit"
+
+// Audit compares the files opened in a container of a full image with those
+// a simplified image made from a profile would prune, reporting the misses:
+// the files its container would have had to fetch on demand.
+type Audit struct {
+	onMiss func(path string)
+
+	mu sync.Mutex
+	// pruned are the files the simplified image would prune, nil until
+	// they are known
+	pruned map[string]bool
+	// opened are the files opened before the pruned ones were known
+	opened []string
+	misses map[string]bool
+}
+
+// NewAudit returns an Audit calling onMiss, outside of its lock, with each
+// file opened that would have been pruned, once.
+func NewAudit(onMiss func(path string)) *Audit {
+	return &Audit{onMiss: onMiss, misses: make(map[string]bool)}
+}
+
+// Opened reports that the file at path was opened in the container.
+func (a *Audit) Opened(path string) {
+	a.mu.Lock()
+	if a.pruned == nil {
+		a.opened = append(a.opened, path)
+		a.mu.Unlock()
+		return
+	}
+	miss := a.miss(path)
+	a.mu.Unlock()
+	if miss {
+		a.onMiss(path)
+	}
+}
+
+// miss records path as a miss if it would have been pruned and was not
+// reported yet. a.mu must be held.
+func (a *Audit) miss(path string) bool {
+	if !a.pruned[path] || a.misses[path] {
+		return false
+	}
+	a.misses[path] = true
+	return true
+}
+
+// SetPruned sets the files the simplified image would prune, and reports
+// the misses among those opened so far.
+func (a *Audit) SetPruned(pruned map[string]bool) {
+	a.mu.Lock()
+	a.pruned = pruned
+	var misses []string
+	for _, p := range a.opened {
+		if a.miss(p) {
+			misses = append(misses, p)
+		}
+	}
+	a.opened = nil
+	a.mu.Unlock()
+	for _, p := range misses {
+		a.onMiss(p)
+	}
+}
+
+// Misses returns the files opened that would have been pruned, sorted.
+func (a *Audit) Misses() []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	misses := make([]string, 0, len(a.misses))
+	for p := range a.misses {
+		misses = append(misses, p)
+	}
+	sort.Strings(misses)
+	return misses
+}
+
+// PrunedPaths returns the files of the full image, made of the layers full,
+// topmost first, that a simplified image made from it with sel would prune.
+func PrunedPaths(ctx context.Context, full []Source, sel *Selector) (map[string]bool, error) {
+	var empty bytes.Buffer
+	if err := tar.NewWriter(&empty).Close(); err != nil {
+		return nil, err
+	}
+	rc := Select(ctx, ioutil.NopCloser(&empty), full, sel)
+	defer rc.Close()
+	kept := make(map[string]bool)
+	tr := tar.NewReader(rc)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		kept[filepath.Clean("/"+hdr.Name)] = true
+	}
+
+	pruned := make(map[string]bool)
+	err := scanImage(ctx, full, func(name string, hdr *tar.Header, _ io.Reader) error {
+		if hdr.Typeflag != tar.TypeDir && !kept[name] {
+			pruned[name] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pruned, nil
+}
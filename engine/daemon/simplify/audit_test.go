@@ -0,0 +1,46 @@
+package simplify // import "github.com/docker/docker/daemon/simplify"
+
+import (
+	"context"
+	"testing"
+
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+func TestPrunedPaths(t *testing.T) {
+	full := []Source{
+		// top
+		tarSource{dir("etc/"), file("etc/.wh.removed.conf"), dir("usr/"), dir("usr/bin/"), file("usr/bin/app"), file("usr/bin/tool")},
+		// bottom
+		tarSource{dir("etc/"), file("etc/app.conf"), file("etc/removed.conf"), dir("usr/"), dir("usr/lib/"), file("usr/lib/libapp.so")},
+	}
+	sel, err := NewSelector([]string{"etc/*.conf"}, nil)
+	assert.NilError(t, err)
+	sel.KeepProfile(&Profile{Paths: []string{"/usr/bin/app"}}, 0)
+
+	pruned, err := PrunedPaths(context.Background(), full, sel)
+	assert.NilError(t, err)
+	assert.Check(t, is.DeepEqual(pruned, map[string]bool{"/usr/bin/tool": true, "/usr/lib/libapp.so": true}))
+}
+
+func TestAudit(t *testing.T) {
+	var reported []string
+	a := NewAudit(func(path string) {
+		reported = append(reported, path)
+	})
+
+	// files opened before the pruned ones are known are reported with them
+	a.Opened("/usr/bin/tool")
+	a.Opened("/usr/bin/app")
+	assert.Check(t, is.Len(reported, 0))
+	a.SetPruned(map[string]bool{"/usr/bin/tool": true, "/usr/lib/libapp.so": true})
+	assert.Check(t, is.DeepEqual(reported, []string{"/usr/bin/tool"}))
+
+	a.Opened("/usr/lib/libapp.so")
+	a.Opened("/tmp/created")
+	// a miss is only reported once
+	a.Opened("/usr/bin/tool")
+	assert.Check(t, is.DeepEqual(reported, []string{"/usr/bin/tool", "/usr/lib/libapp.so"}))
+	assert.Check(t, is.DeepEqual(a.Misses(), []string{"/usr/bin/tool", "/usr/lib/libapp.so"}))
+}
@@ -0,0 +1,170 @@
+package simplify // import "github.com/docker/docker/daemon/simplify"
+
+import (
+	"context"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/opencontainers/go-digest"
+)
+
+// RangeBatcher coalesces the reads of nearby ranges of the same layer blob
+// into single range requests, whose data is sliced locally. Containers
+// faulting in many small files at once, such as Python packages or
+// node_modules, otherwise make one round trip to the registry per file.
+//
+// The first read of a blob is issued at once. The reads of the blob that
+// arrive while it is in flight are coalesced into the next requests, so no
+// read waits longer than for the request before it.
+type RangeBatcher struct {
+	// maxGap is the largest gap between two ranges read through rather than
+	// read with requests of their own, and maxBatch the largest number of
+	// bytes read by a single request.
+	maxGap   int64
+	maxBatch int64
+
+	mu sync.Mutex
+	// pending are the reads waiting for each blob being read
+	pending map[digest.Digest][]*rangeRead
+}
+
+// rangeRead is a read of size bytes at offset of a blob, done once data or
+// err is set.
+type rangeRead struct {
+	ctx          context.Context
+	offset, size int64
+	open         OpenRangeFunc
+	data         []byte
+	err          error
+	done         chan struct{}
+}
+
+// OpenRangeFunc opens a blob from offset.
+type OpenRangeFunc func(ctx context.Context, offset int64) (io.ReadCloser, error)
+
+// NewRangeBatcher returns a RangeBatcher reading through gaps of up to
+// maxGap bytes between the ranges it coalesces, up to maxBatch bytes per
+// request. Ranges are not coalesced if maxBatch is 0.
+func NewRangeBatcher(maxGap, maxBatch int64) *RangeBatcher {
+	return &RangeBatcher{
+		maxGap:   maxGap,
+		maxBatch: maxBatch,
+		pending:  make(map[digest.Digest][]*rangeRead),
+	}
+}
+
+// Coalesces returns true if ranges of size bytes are read through b, false
+// if they are better streamed with requests of their own.
+func (b *RangeBatcher) Coalesces(size int64) bool {
+	return b != nil && b.maxBatch > 0 && size <= b.maxBatch
+}
+
+// Read returns the size bytes of the blob at offset, opening the blob with
+// open, possibly along with nearby ranges read by other callers.
+func (b *RangeBatcher) Read(ctx context.Context, blob digest.Digest, offset, size int64, open OpenRangeFunc) ([]byte, error) {
+	r := &rangeRead{ctx: ctx, offset: offset, size: size, open: open, done: make(chan struct{})}
+	b.mu.Lock()
+	_, running := b.pending[blob]
+	b.pending[blob] = append(b.pending[blob], r)
+	b.mu.Unlock()
+	if !running {
+		go b.run(blob)
+	}
+	select {
+	case <-r.done:
+		return r.data, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// run reads the ranges of blob pending until there are none left.
+func (b *RangeBatcher) run(blob digest.Digest) {
+	for {
+		b.mu.Lock()
+		reads := b.pending[blob]
+		if len(reads) == 0 {
+			delete(b.pending, blob)
+			b.mu.Unlock()
+			return
+		}
+		b.pending[blob] = reads[:0:0]
+		b.mu.Unlock()
+
+		for _, batch := range b.batches(reads) {
+			b.read(batch)
+		}
+	}
+}
+
+// batches groups the reads that are still waiting into those read with a
+// single request each.
+func (b *RangeBatcher) batches(reads []*rangeRead) [][]*rangeRead {
+	var waiting []*rangeRead
+	for _, r := range reads {
+		if r.ctx.Err() == nil {
+			waiting = append(waiting, r)
+		}
+	}
+	sort.Slice(waiting, func(i, j int) bool {
+		return waiting[i].offset < waiting[j].offset
+	})
+
+	var (
+		batches    [][]*rangeRead
+		start, end int64
+	)
+	for _, r := range waiting {
+		n := len(batches)
+		if n > 0 && r.offset-end <= b.maxGap && maxInt64(end, r.offset+r.size)-start <= b.maxBatch {
+			batches[n-1] = append(batches[n-1], r)
+			end = maxInt64(end, r.offset+r.size)
+			continue
+		}
+		batches = append(batches, []*rangeRead{r})
+		start, end = r.offset, r.offset+r.size
+	}
+	return batches
+}
+
+// read reads the ranges of batch, sorted by offset, with a single request,
+// made on behalf of the first of them whose caller is still waiting.
+func (b *RangeBatcher) read(batch []*rangeRead) {
+	start, end := batch[0].offset, batch[0].offset
+	for _, r := range batch {
+		end = maxInt64(end, r.offset+r.size)
+	}
+	ctx := batch[0].ctx
+	for _, r := range batch {
+		if r.ctx.Err() == nil {
+			ctx = r.ctx
+			break
+		}
+	}
+
+	data := make([]byte, end-start)
+	rc, err := batch[0].open(ctx, start)
+	if err == nil {
+		_, err = io.ReadFull(rc, data)
+		rc.Close()
+	}
+	for _, r := range batch {
+		if err != nil {
+			r.err = err
+		} else {
+			r.data = data[r.offset-start : r.offset-start+r.size]
+		}
+		close(r.done)
+	}
+	if err == nil && len(batch) > 1 {
+		fetchRangesSaved.Inc(float64(len(batch) - 1))
+	}
+}
+
+func maxInt64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
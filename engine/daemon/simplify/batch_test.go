@@ -0,0 +1,93 @@
+package simplify // import "github.com/docker/docker/daemon/simplify"
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+func TestRangeBatcher(t *testing.T) {
+	blob := make([]byte, 4096)
+	for n := range blob {
+		blob[n] = byte(n)
+	}
+	dgst := digest.FromBytes(blob)
+
+	var (
+		mu      sync.Mutex
+		opened  []int64
+		release = make(chan struct{})
+	)
+	open := func(ctx context.Context, offset int64) (io.ReadCloser, error) {
+		mu.Lock()
+		opened = append(opened, offset)
+		first := len(opened) == 1
+		mu.Unlock()
+		if first {
+			// the reads arriving meanwhile are coalesced
+			<-release
+		}
+		return ioutil.NopCloser(bytes.NewReader(blob[offset:])), nil
+	}
+
+	b := NewRangeBatcher(100, 1000)
+	ranges := []struct{ offset, size int64 }{
+		{0, 10},
+		{500, 20},
+		{550, 30},
+		{650, 10},
+		{3000, 10},
+	}
+	var wg sync.WaitGroup
+	read := func(offset, size int64) {
+		defer wg.Done()
+		data, err := b.Read(context.Background(), dgst, offset, size, open)
+		assert.Check(t, err)
+		assert.Check(t, bytes.Equal(data, blob[offset:offset+size]), "range at %d", offset)
+	}
+	wg.Add(len(ranges))
+	go read(ranges[0].offset, ranges[0].size)
+	for {
+		mu.Lock()
+		n := len(opened)
+		mu.Unlock()
+		if n == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	for _, r := range ranges[1:] {
+		go read(r.offset, r.size)
+	}
+	for {
+		b.mu.Lock()
+		n := len(b.pending[dgst])
+		b.mu.Unlock()
+		if n == len(ranges)-1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	// 500, 550 and 650 are read together, 3000 is too far from them
+	assert.Check(t, is.DeepEqual(opened, []int64{0, 500, 3000}))
+}
+
+func TestRangeBatcherCoalesces(t *testing.T) {
+	b := NewRangeBatcher(100, 1000)
+	assert.Check(t, b.Coalesces(1000))
+	assert.Check(t, !b.Coalesces(1001))
+	assert.Check(t, !NewRangeBatcher(100, 0).Coalesces(1))
+	var none *RangeBatcher
+	assert.Check(t, !none.Coalesces(1))
+}
@@ -0,0 +1,113 @@
+package simplify // import "github.com/docker/docker/daemon/simplify"
+
+import (
+	"archive/tar"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/docker/docker/pkg/idtools"
+	"github.com/opencontainers/go-digest"
+)
+
+// blobsDir is the directory under the cache root holding the blob store. It
+// is not the cache of an image.
+const blobsDir = "blobs"
+
+// blobStore holds the files fetched for simplified images by the digest of
+// their content, as recorded in the table of contents of their layer. The
+// files are hard linked into the caches of the images they were fetched
+// for, so a file shared by several images is only fetched and stored once.
+// Hard links share the ownership, mode, modification time and extended
+// attributes of the file, so these are part of the key too. A blob is no longer used once no cache links to it, that is
+// once it has a single link left.
+type blobStore struct {
+	root string
+}
+
+func newBlobStore(cacheRoot string) *blobStore {
+	return &blobStore{root: filepath.Join(cacheRoot, blobsDir)}
+}
+
+// path returns the path of the blob with the content dgst, the modification
+// time and extended attributes of hdr, and its ownership and mode shifted to
+// the host IDs of idMappings, if set.
+func (s *blobStore) path(dgst digest.Digest, hdr *tar.Header, idMappings *idtools.IDMappings) (string, error) {
+	if err := dgst.Validate(); err != nil {
+		return "", err
+	}
+	ids := idtools.IDPair{UID: hdr.Uid, GID: hdr.Gid}
+	if idMappings != nil && !idMappings.Empty() {
+		var err error
+		if ids, err = idMappings.ToHost(ids); err != nil {
+			return "", err
+		}
+	}
+	name := fmt.Sprintf("%s-%d-%d-%o", dgst.Hex(), ids.UID, ids.GID, uint32(hdr.FileInfo().Mode()))
+	if !hdr.ModTime.IsZero() {
+		name += fmt.Sprintf("-%d", hdr.ModTime.UnixNano())
+	}
+	if key := xattrsKey(hdr.Xattrs); key != "" {
+		name += "-" + key
+	}
+	return filepath.Join(s.root, dgst.Algorithm().String(), name), nil
+}
+
+// xattrsKey returns the part of the key of a blob for the extended
+// attributes xattrs, or "" if it has none the fetcher sets.
+func xattrsKey(xattrs map[string]string) string {
+	var keys []string
+	for k := range xattrs {
+		if k != selinuxXattr {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == 0 {
+		return ""
+	}
+	sort.Strings(keys)
+	h := digest.Canonical.Digester()
+	for _, k := range keys {
+		fmt.Fprintf(h.Hash(), "%s=%s\x00", k, xattrs[k])
+	}
+	return h.Digest().Hex()[:16]
+}
+
+// add stores the file at p as blob, unless the store has it already.
+func (s *blobStore) add(p, blob string) error {
+	if err := os.MkdirAll(filepath.Dir(blob), 0700); err != nil {
+		return err
+	}
+	if err := os.Link(p, blob); err != nil && !os.IsExist(err) {
+		return err
+	}
+	return nil
+}
+
+// PruneBlobs removes the blobs of the blob store of the caches under root
+// that no cache links to anymore, such as those of the files of removed
+// images, and returns the number of bytes freed.
+func PruneBlobs(root string) (int64, error) {
+	var freed int64
+	err := filepath.Walk(newBlobStore(root).root, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if fi.IsDir() {
+			return nil
+		}
+		if _, nlink := inode(fi); nlink > 1 {
+			return nil
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		freed += fi.Size()
+		return nil
+	})
+	return freed, err
+}
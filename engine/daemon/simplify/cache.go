@@ -0,0 +1,228 @@
+package simplify // import "github.com/docker/docker/daemon/simplify"
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// cacheFile is a file fetched into the caches of images. A file of the
+// blob store is linked into the caches of every image it was fetched for.
+type cacheFile struct {
+	// links are the paths of the file in the caches of images.
+	links []cacheLink
+	// blob is the path of the file in the blob store, if it is stored.
+	blob string
+	size int64
+	used time.Time
+}
+
+// cacheLink is the path of a file in the cache of image.
+type cacheLink struct {
+	image string
+	path  string
+}
+
+// scanCaches returns the files fetched into the caches under root, and the
+// size they take, counting the files linked into several caches once.
+// Directories are not returned: they are created for the whole image when
+// the cache is prepared and must stay.
+func scanCaches(root string) ([]*cacheFile, int64, error) {
+	dirs, err := ioutil.ReadDir(root)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, 0, nil
+		}
+		return nil, 0, err
+	}
+	var (
+		files  []*cacheFile
+		total  int64
+		inodes = make(map[uint64]*cacheFile)
+	)
+	// add records the file at path, found in the cache of image, or in the
+	// blob store if image is empty.
+	add := func(image, path string, fi os.FileInfo) {
+		ino, _ := inode(fi)
+		f := inodes[ino]
+		if f == nil || ino == 0 {
+			f = &cacheFile{size: fi.Size(), used: lastUsed(fi)}
+			files = append(files, f)
+			total += fi.Size()
+			if ino != 0 {
+				inodes[ino] = f
+			}
+		}
+		if image == "" {
+			f.blob = path
+		} else {
+			f.links = append(f.links, cacheLink{image: image, path: path})
+		}
+	}
+	walk := func(dir, image string) error {
+		return filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+			if err != nil {
+				// 缓存可能同时被删除
+				if os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+			if !fi.IsDir() {
+				add(image, path, fi)
+			}
+			return nil
+		})
+	}
+	for _, d := range dirs {
+		if !d.IsDir() || d.Name() == blobsDir {
+			continue
+		}
+		if err := walk(CacheDir(root, d.Name()), d.Name()); err != nil {
+			return nil, 0, err
+		}
+	}
+	if err := walk(newBlobStore(root).root, ""); err != nil {
+		return nil, 0, err
+	}
+	return files, total, nil
+}
+
+// lastUsed returns the time the file was last read, or fetched if it was
+// not read since. Fetching sets the access time of the file, as its
+// modification time is that of the full image, if known.
+func lastUsed(fi os.FileInfo) time.Time {
+	if atime := accessTime(fi); atime.After(fi.ModTime()) {
+		return atime
+	}
+	return fi.ModTime()
+}
+
+// evictFiles removes the least recently used of files, which take total
+// bytes, until they take at most target bytes. The files linked into the
+// cache of an image at a path evictable returns false for are kept, along
+// with their links in the caches of other images and the blob store,
+// whatever the target. Blobs no cache links to anymore are removed. The caches files
+// are removed from are no longer complete, so they are prefetched again if
+// needed. It returns the number of bytes and of files removed.
+func evictFiles(root string, files []*cacheFile, total, target int64, evictable func(image, path string) bool) (int64, int, error) {
+	sort.Slice(files, func(i, j int) bool { return files[i].used.Before(files[j].used) })
+	var (
+		freed   int64
+		evicted int
+		touched = make(map[string]bool)
+	)
+	for _, f := range files {
+		if total-freed <= target && len(f.links) > 0 {
+			continue
+		}
+		if !f.evictable(root, evictable) {
+			continue
+		}
+		for _, l := range f.links {
+			if !touched[l.image] {
+				if err := invalidatePrefetch(filepath.Join(root, l.image)); err != nil {
+					return freed, evicted, err
+				}
+				touched[l.image] = true
+			}
+			if err := os.Remove(l.path); err != nil && !os.IsNotExist(err) {
+				return freed, evicted, err
+			}
+		}
+		if f.blob != "" {
+			if err := os.Remove(f.blob); err != nil && !os.IsNotExist(err) {
+				return freed, evicted, err
+			}
+		}
+		freed += f.size
+		evicted++
+	}
+	return freed, evicted, nil
+}
+
+// evictable returns true if evictable returns true for every image the file
+// is linked into the cache under root of, and its path in the full image.
+func (f *cacheFile) evictable(root string, evictable func(image, path string) bool) bool {
+	for _, l := range f.links {
+		rel, err := filepath.Rel(CacheDir(root, l.image), l.path)
+		if err != nil {
+			return false
+		}
+		if !evictable(l.image, filepath.Clean("/"+rel)) {
+			return false
+		}
+	}
+	return true
+}
+
+// invalidatePrefetch forgets that every file of the full image, or of some
+// of its layers, was prefetched into the cache under root.
+func invalidatePrefetch(root string) error {
+	if err := os.Remove(filepath.Join(root, materializedFile)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return os.RemoveAll(filepath.Join(root, "layers"))
+}
+
+// Lock files of the cache of an image, next to it. usedLock is held shared
+// while the cache is used and exclusively while it is evicted, and
+// prepareLock exclusively while a cache shared by several daemons is
+// prepared.
+const (
+	usedLock    = ".lock"
+	prepareLock = ".prepare.lock"
+)
+
+// RemoveCache removes the cache of imageID under root, along with its lock
+// files. It must not be used by any container.
+func RemoveCache(root, imageID string) error {
+	dir := filepath.Join(root, imageID)
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	for _, name := range []string{usedLock, prepareLock} {
+		if err := os.Remove(dir + name); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// lockCache opens the lock file name of the cache of an image at root and
+// takes the lock how on it. It returns an error if wait is not set and the
+// lock is held by another. Closing the file releases the lock.
+func lockCache(root, name string, how int, wait bool) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(root), 0700); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(root+name, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := flock(f, how, wait); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// isNoSpace returns true if err was caused by the disk being full.
+func isNoSpace(err error) bool {
+	switch e := errors.Cause(err).(type) {
+	case *os.PathError:
+		err = e.Err
+	case *os.LinkError:
+		err = e.Err
+	case *os.SyscallError:
+		err = e.Err
+	default:
+		err = e
+	}
+	return err == syscall.ENOSPC
+}
@@ -0,0 +1,138 @@
+package simplify // import "github.com/docker/docker/daemon/simplify"
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+func TestEvictFiles(t *testing.T) {
+	root, err := ioutil.TempDir("", "simplify-cache")
+	assert.NilError(t, err)
+	defer os.RemoveAll(root)
+
+	now := time.Now()
+	for _, tc := range []struct {
+		image, path string
+		used        time.Duration
+	}{
+		{"running", "bin/sh", 3 * time.Hour},
+		{"stopped", "bin/old", 2 * time.Hour},
+		{"stopped", "bin/recent", time.Minute},
+		{"other", "etc/app.conf", time.Hour},
+	} {
+		p := filepath.Join(CacheDir(root, tc.image), tc.path)
+		assert.NilError(t, os.MkdirAll(filepath.Dir(p), 0755))
+		assert.NilError(t, ioutil.WriteFile(p, make([]byte, 100), 0644))
+		used := now.Add(-tc.used)
+		assert.NilError(t, os.Chtimes(p, used, used))
+	}
+	// the stopped image was fully prefetched
+	assert.NilError(t, ioutil.WriteFile(filepath.Join(root, "stopped", materializedFile), nil, 0644))
+	assert.NilError(t, os.MkdirAll(filepath.Join(root, "stopped", "layers"), 0755))
+
+	files, total, err := scanCaches(root)
+	assert.NilError(t, err)
+	assert.Check(t, is.Len(files, 4))
+	assert.Check(t, is.Equal(total, int64(400)))
+
+	// files of caches a container is attached to are kept, however old
+	freed, evicted, err := evictFiles(root, files, total, 250, func(image, path string) bool { return image != "running" })
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(freed, int64(200)))
+	assert.Check(t, is.Equal(evicted, 2))
+	for _, tc := range []struct {
+		path    string
+		evicted bool
+	}{
+		{"running/fs/bin/sh", false},
+		{"stopped/fs/bin/old", true},
+		{"stopped/fs/bin/recent", false},
+		{"other/fs/etc/app.conf", true},
+		{"stopped/" + materializedFile, true},
+		{"stopped/layers", true},
+		// directories stay for the overlay to look missing files up in
+		{"other/fs/etc", false},
+	} {
+		_, err := os.Stat(filepath.Join(root, tc.path))
+		assert.Check(t, is.Equal(os.IsNotExist(err), tc.evicted), tc.path)
+	}
+
+	files, total, err = scanCaches(root)
+	assert.NilError(t, err)
+	assert.Check(t, is.Len(files, 2))
+	assert.Check(t, is.Equal(total, int64(200)))
+}
+
+func TestEvictSharedFiles(t *testing.T) {
+	root, err := ioutil.TempDir("", "simplify-cache")
+	assert.NilError(t, err)
+	defer os.RemoveAll(root)
+
+	now := time.Now()
+	blobs := newBlobStore(root)
+	for _, tc := range []struct {
+		blob   string
+		images []string
+		used   time.Duration
+	}{
+		{"sha256/libc", []string{"running", "stopped"}, 3 * time.Hour},
+		{"sha256/busybox", []string{"stopped", "other"}, 2 * time.Hour},
+		// the images linking to it were removed
+		{"sha256/orphan", nil, time.Minute},
+	} {
+		p := filepath.Join(blobs.root, tc.blob)
+		assert.NilError(t, os.MkdirAll(filepath.Dir(p), 0700))
+		assert.NilError(t, ioutil.WriteFile(p, make([]byte, 100), 0644))
+		for _, image := range tc.images {
+			l := filepath.Join(CacheDir(root, image), "bin", filepath.Base(tc.blob))
+			assert.NilError(t, os.MkdirAll(filepath.Dir(l), 0755))
+			assert.NilError(t, os.Link(p, l))
+		}
+		used := now.Add(-tc.used)
+		assert.NilError(t, os.Chtimes(p, used, used))
+	}
+
+	// files linked into several caches are counted once
+	files, total, err := scanCaches(root)
+	assert.NilError(t, err)
+	assert.Check(t, is.Len(files, 3))
+	assert.Check(t, is.Equal(total, int64(300)))
+
+	// libc is kept for the running image, however old, and the orphaned
+	// blob is removed whatever the target
+	freed, evicted, err := evictFiles(root, files, total, 250, func(image, path string) bool { return image != "running" })
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(freed, int64(200)))
+	assert.Check(t, is.Equal(evicted, 2))
+	for _, tc := range []struct {
+		path    string
+		evicted bool
+	}{
+		{"blobs/sha256/libc", false},
+		{"running/fs/bin/libc", false},
+		{"stopped/fs/bin/libc", false},
+		{"blobs/sha256/busybox", true},
+		{"stopped/fs/bin/busybox", true},
+		{"other/fs/bin/busybox", true},
+		{"blobs/sha256/orphan", true},
+	} {
+		_, err := os.Stat(filepath.Join(root, tc.path))
+		assert.Check(t, is.Equal(os.IsNotExist(err), tc.evicted), tc.path)
+	}
+}
+
+func TestIsNoSpace(t *testing.T) {
+	err := errors.Wrap(&os.PathError{Op: "write", Path: "/tmp/fetch-1", Err: syscall.ENOSPC}, "failed to fetch /bin/sh")
+	assert.Check(t, isNoSpace(err))
+	assert.Check(t, isNoSpace(&os.LinkError{Op: "rename", Err: syscall.ENOSPC}))
+	assert.Check(t, !isNoSpace(&os.PathError{Op: "fetch", Path: "/bin/sh", Err: syscall.ENOENT}))
+	assert.Check(t, !isNoSpace(nil))
+}
@@ -0,0 +1,207 @@
+package simplify // import "github.com/docker/docker/daemon/simplify"
+
+import (
+	"archive/tar"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/docker/layer"
+	"github.com/docker/docker/pkg/archive"
+	"github.com/opencontainers/go-digest"
+)
+
+// FilterChanges returns changes, those of the root filesystem mounted at
+// rootfs of a container of a simplified image, without the files added that
+// the full image holds with the same content, such as those fetched on
+// demand, as recorded by the digests of its tables of contents. The other
+// files added that the full image holds are reported as modified. The
+// directories reported as modified only because of the files left out are
+// left out too, unless upper, the writable layer of the container, holds
+// them. The full image is given as its layers, topmost first.
+func FilterChanges(ctx context.Context, rootfs, upper string, changes []archive.Change, full []Source) ([]archive.Change, error) {
+	added := make(map[string]bool)
+	for _, c := range changes {
+		if c.Kind == archive.ChangeAdd {
+			added[filepath.Clean("/"+c.Path)] = true
+		}
+	}
+	if len(added) == 0 {
+		return changes, nil
+	}
+	entries, err := fullEntries(ctx, full, added)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return changes, nil
+	}
+	unchanged := make(map[string]bool)
+	for p, e := range entries {
+		same, err := sameContent(filepath.Join(rootfs, p), e)
+		if err != nil {
+			return nil, err
+		}
+		unchanged[p] = same
+	}
+
+	var filtered []archive.Change
+	for _, c := range changes {
+		same, ok := unchanged[filepath.Clean("/"+c.Path)]
+		switch {
+		case same:
+			continue
+		case ok:
+			// 完整镜像中本就有该文件，内容不同即为修改
+			c.Kind = archive.ChangeModify
+		}
+		filtered = append(filtered, c)
+	}
+	return pruneDirChanges(filtered, rootfs, upper)
+}
+
+// pruneDirChanges drops from changes the directories reported as modified
+// that hold no other change and that upper does not hold, since the
+// directories whose own metadata changed are copied up to it.
+func pruneDirChanges(changes []archive.Change, rootfs, upper string) ([]archive.Change, error) {
+	if upper == "" {
+		return changes, nil
+	}
+	// 自下而上处理，父目录只需查看保留下来的变更
+	var kept []archive.Change
+	for n := len(changes) - 1; n >= 0; n-- {
+		c := changes[n]
+		if c.Kind == archive.ChangeModify && !hasChangesUnder(kept, c.Path) {
+			fi, err := os.Lstat(filepath.Join(rootfs, c.Path))
+			if err == nil && fi.IsDir() {
+				if _, err := os.Lstat(filepath.Join(upper, c.Path)); os.IsNotExist(err) {
+					continue
+				}
+			}
+		}
+		kept = append(kept, c)
+	}
+	pruned := make([]archive.Change, 0, len(kept))
+	for n := len(kept) - 1; n >= 0; n-- {
+		pruned = append(pruned, kept[n])
+	}
+	return pruned, nil
+}
+
+// hasChangesUnder returns true if one of changes is under the directory p.
+func hasChangesUnder(changes []archive.Change, p string) bool {
+	for _, c := range changes {
+		if strings.HasPrefix(c.Path, strings.TrimSuffix(p, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// fullEntries returns the entries of the full image, given as its layers,
+// topmost first, at paths, with the digests of the regular files. Layers
+// are read from their tables of contents where available.
+func fullEntries(ctx context.Context, full []Source, paths map[string]bool) (map[string]layer.TOCEntry, error) {
+	pending := make(map[string]bool, len(paths))
+	for p := range paths {
+		pending[p] = true
+	}
+	entries := make(map[string]layer.TOCEntry)
+	for _, src := range full {
+		if len(pending) == 0 {
+			break
+		}
+		if is, ok := src.(IndexedSource); ok {
+			if toc := is.TOC(); toc != nil {
+				for p := range pending {
+					n, hidden := toc.Lookup(p)
+					if n >= 0 {
+						e := toc.Entries[n]
+						if e.Type == tar.TypeLink {
+							// 硬链接的内容是其目标文件的内容
+							if m := toc.Index(e.Linkname); m >= 0 {
+								e.Size, e.Digest = toc.Entries[m].Size, toc.Entries[m].Digest
+							}
+						}
+						entries[p] = e
+					}
+					if hidden {
+						delete(pending, p)
+					}
+				}
+				continue
+			}
+		}
+		rc, err := src.Open(ctx)
+		if err != nil {
+			return nil, err
+		}
+		layerHidden, err := scanLayer(ctx, rc, make(map[string]bool), make(map[string]bool), func(name string, hdr *tar.Header, r io.Reader) error {
+			if !pending[name] {
+				return nil
+			}
+			e := layer.TOCEntry{Name: hdr.Name, Type: hdr.Typeflag, Linkname: hdr.Linkname, Size: hdr.Size, Mode: hdr.Mode, UID: hdr.Uid, GID: hdr.Gid, ModTime: hdr.ModTime, Devmajor: hdr.Devmajor, Devminor: hdr.Devminor, Xattrs: hdr.Xattrs}
+			if isRegular(hdr) {
+				e.Type, e.Sparse = tar.TypeReg, archive.IsSparse(hdr)
+				d, err := digest.FromReader(r)
+				if err != nil {
+					return err
+				}
+				e.Digest = d
+			}
+			entries[name] = e
+			delete(pending, name)
+			return nil
+		})
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+		hidden := make(map[string]bool)
+		for _, p := range layerHidden {
+			hidden[p] = true
+		}
+		for p := range pending {
+			if isHidden(hidden, p) {
+				delete(pending, p)
+			}
+		}
+	}
+	return entries, nil
+}
+
+// sameContent returns true if the file at path has the type and content the
+// entry e of the full image records.
+func sameContent(path string, e layer.TOCEntry) (bool, error) {
+	fi, err := os.Lstat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	switch e.Type {
+	case tar.TypeDir:
+		return fi.IsDir(), nil
+	case tar.TypeSymlink:
+		if fi.Mode()&os.ModeSymlink == 0 {
+			return false, nil
+		}
+		link, err := os.Readlink(path)
+		return link == e.Linkname, err
+	case tar.TypeReg, tar.TypeRegA, tar.TypeLink:
+		if !fi.Mode().IsRegular() || fi.Size() != e.Size || e.Digest.Validate() != nil {
+			return false, nil
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return false, err
+		}
+		defer f.Close()
+		d, err := e.Digest.Algorithm().FromReader(f)
+		return d == e.Digest, err
+	}
+	return false, nil
+}
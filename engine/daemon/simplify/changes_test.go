@@ -0,0 +1,72 @@
+package simplify // import "github.com/docker/docker/daemon/simplify"
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/docker/pkg/archive"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+func TestFilterChanges(t *testing.T) {
+	rootfs, err := ioutil.TempDir("", "simplify-changes-rootfs")
+	assert.NilError(t, err)
+	defer os.RemoveAll(rootfs)
+	upper, err := ioutil.TempDir("", "simplify-changes-upper")
+	assert.NilError(t, err)
+	defer os.RemoveAll(upper)
+
+	for _, d := range []string{"bin", "etc", "usr/share/doc", "var"} {
+		assert.NilError(t, os.MkdirAll(filepath.Join(rootfs, d), 0755))
+	}
+	// fetched on demand, as the full image holds them
+	for _, p := range []string{"bin/sh", "etc/hosts", "usr/share/doc/README"} {
+		assert.NilError(t, ioutil.WriteFile(filepath.Join(rootfs, p), []byte(p), 0644))
+	}
+	assert.NilError(t, os.Symlink("/bin/sh", filepath.Join(rootfs, "bin/bash")))
+	// changed by the container
+	assert.NilError(t, ioutil.WriteFile(filepath.Join(rootfs, "etc/app.conf"), []byte("changed"), 0644))
+	assert.NilError(t, ioutil.WriteFile(filepath.Join(rootfs, "var/app.log"), nil, 0644))
+	assert.NilError(t, os.MkdirAll(filepath.Join(upper, "var"), 0755))
+	assert.NilError(t, os.MkdirAll(filepath.Join(upper, "bin"), 0755))
+
+	full := []Source{
+		// top
+		tarSource{dir("etc/"), file("etc/app.conf"), dir("usr/"), dir("usr/share/"), dir("usr/share/doc/"), file("usr/share/doc/README")},
+		// bottom, read from its table of contents
+		newIndexedSource(t, tarSource{dir("bin/"), file("bin/sh"), symlink("bin/bash", "/bin/sh").hdr, dir("etc/"), file("etc/hosts")}),
+	}
+	changes := []archive.Change{
+		{Path: "/bin", Kind: archive.ChangeModify},
+		{Path: "/bin/bash", Kind: archive.ChangeAdd},
+		{Path: "/bin/sh", Kind: archive.ChangeAdd},
+		{Path: "/etc", Kind: archive.ChangeModify},
+		{Path: "/etc/app.conf", Kind: archive.ChangeAdd},
+		{Path: "/etc/hosts", Kind: archive.ChangeAdd},
+		{Path: "/usr", Kind: archive.ChangeModify},
+		{Path: "/usr/share", Kind: archive.ChangeModify},
+		{Path: "/usr/share/doc", Kind: archive.ChangeModify},
+		{Path: "/usr/share/doc/README", Kind: archive.ChangeAdd},
+		{Path: "/var", Kind: archive.ChangeModify},
+		{Path: "/var/app.log", Kind: archive.ChangeAdd},
+	}
+	filtered, err := FilterChanges(context.Background(), rootfs, upper, changes, full)
+	assert.NilError(t, err)
+	assert.Check(t, is.DeepEqual(filtered, []archive.Change{
+		// held by the writable layer
+		{Path: "/bin", Kind: archive.ChangeModify},
+		{Path: "/etc", Kind: archive.ChangeModify},
+		{Path: "/etc/app.conf", Kind: archive.ChangeModify},
+		{Path: "/var", Kind: archive.ChangeModify},
+		{Path: "/var/app.log", Kind: archive.ChangeAdd},
+	}))
+
+	// without the writable layer, directories are kept
+	filtered, err = FilterChanges(context.Background(), rootfs, "", changes, full)
+	assert.NilError(t, err)
+	assert.Check(t, is.Len(filtered, 8))
+}
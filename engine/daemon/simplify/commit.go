@@ -0,0 +1,192 @@
+package simplify // import "github.com/docker/docker/daemon/simplify"
+
+import (
+	"archive/tar"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/docker/pkg/archive"
+	"github.com/docker/docker/pkg/idtools"
+	"github.com/docker/docker/pkg/ioutils"
+)
+
+// CacheDir returns the directory holding the files fetched for imageID into
+// the cache under root.
+func CacheDir(root, imageID string) string {
+	return NewFetcher(filepath.Join(root, imageID), nil).Dir()
+}
+
+// MergeCache returns diff, the tar stream of a container's writable layer,
+// with the files fetched into dir added to it, so an image committed from a
+// container of a simplified image does not depend on the cache. Entries of
+// diff take precedence, and its whiteouts hide the fetched files beneath
+// them. The owners of the fetched files are mapped back to the IDs of the
+// container with idMappings, if set, as they are in diff. Closing the
+// returned stream closes diff.
+func MergeCache(diff io.ReadCloser, dir string, idMappings *idtools.IDMappings) io.ReadCloser {
+	pr, pw := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		pw.CloseWithError(mergeCache(pw, diff, dir, idMappings))
+		close(done)
+	}()
+	return ioutils.NewReadCloserWrapper(pr, func() error {
+		pr.Close()
+		<-done
+		return diff.Close()
+	})
+}
+
+func mergeCache(w io.Writer, diff io.Reader, dir string, idMappings *idtools.IDMappings) error {
+	tw := tar.NewWriter(w)
+
+	// 先原样复制读写层，记录其中的文件及其遮住的路径
+	seen := make(map[string]bool)
+	hidden := make(map[string]bool)
+	if err := copyEntries(tw, diff, seen, hidden); err != nil {
+		return err
+	}
+	// 再加入读写层中没有的已拉取文件
+	if err := addCache(tw, dir, seen, hidden, idMappings); err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// copyEntries copies the entries of the tar stream r to tw. The paths of its
+// files are recorded in seen, and those it hides from the layers beneath it,
+// with whiteouts or files replacing directories, in hidden.
+func copyEntries(tw *tar.Writer, r io.Reader, seen, hidden map[string]bool) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := io.Copy(tw, tr); err != nil {
+			return err
+		}
+
+		name := filepath.Clean("/" + hdr.Name)
+		base := filepath.Base(name)
+		switch {
+		case base == archive.WhiteoutOpaqueDir:
+			hidden[filepath.Dir(name)] = true
+		case strings.HasPrefix(base, archive.WhiteoutPrefix):
+			hidden[filepath.Join(filepath.Dir(name), strings.TrimPrefix(base, archive.WhiteoutPrefix))] = true
+		default:
+			seen[name] = true
+			if hdr.Typeflag != tar.TypeDir {
+				// 读写层中的文件替换了缓存中的同名目录
+				hidden[name] = true
+			}
+		}
+	}
+}
+
+// addCache writes the files fetched into dir to tw, except those in seen or
+// hidden. The directories of the cache are only written along with the
+// files they hold, unless they are in seen.
+func addCache(tw *tar.Writer, dir string, seen, hidden map[string]bool, idMappings *idtools.IDMappings) error {
+	// 缓存里的目录只在包含已加入的文件时才加入
+	added := make(map[string]bool)
+	return filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.Clean("/" + rel)
+		if name == "/" {
+			return nil
+		}
+		if isHidden(hidden, name) {
+			if fi.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if fi.IsDir() || seen[name] {
+			return nil
+		}
+		for _, parent := range parents(name) {
+			if seen[parent] || added[parent] {
+				continue
+			}
+			if err := addCacheEntry(tw, dir, parent, idMappings); err != nil {
+				return err
+			}
+			added[parent] = true
+		}
+		return addCacheEntry(tw, dir, name, idMappings)
+	})
+}
+
+// parents returns the parent directories of p, outermost first.
+func parents(p string) []string {
+	var dirs []string
+	for d := filepath.Dir(p); d != "/"; d = filepath.Dir(d) {
+		dirs = append([]string{d}, dirs...)
+	}
+	return dirs
+}
+
+// addCacheEntry writes the entry at name inside dir to tw.
+func addCacheEntry(tw *tar.Writer, dir, name string, idMappings *idtools.IDMappings) error {
+	return addCacheEntryAs(tw, filepath.Join(dir, name), name, idMappings)
+}
+
+// addCacheEntryAs writes the entry at path to tw, named name. Its owner is
+// mapped from the host IDs back to those of the container with idMappings,
+// if set.
+func addCacheEntryAs(tw *tar.Writer, path, name string, idMappings *idtools.IDMappings) error {
+	fi, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	var link string
+	if fi.Mode()&os.ModeSymlink != 0 {
+		if link, err = os.Readlink(path); err != nil {
+			return err
+		}
+	}
+	hdr, err := archive.FileInfoHeader(strings.TrimPrefix(name, "/"), fi, link)
+	if err != nil {
+		return err
+	}
+	// 用户名和组名来自宿主机，只保留数字ID
+	hdr.Uname, hdr.Gname = "", ""
+	// 保留文件能力等扩展属性；SELinux标签由挂载决定
+	if hdr.Xattrs, err = listXattrs(path); err != nil {
+		return err
+	}
+	if idMappings != nil && !idMappings.Empty() {
+		// 缓存中的文件属于重映射后的宿主机ID
+		if hdr.Uid, hdr.Gid, err = idMappings.ToContainer(idtools.IDPair{UID: hdr.Uid, GID: hdr.Gid}); err != nil {
+			return err
+		}
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if !fi.Mode().IsRegular() {
+		return nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(tw, f)
+	return err
+}
@@ -0,0 +1,64 @@
+package simplify // import "github.com/docker/docker/daemon/simplify"
+
+import (
+	"archive/tar"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+func TestMergeCache(t *testing.T) {
+	cache, err := ioutil.TempDir("", "simplify-merge")
+	assert.NilError(t, err)
+	defer os.RemoveAll(cache)
+
+	for _, p := range []string{"etc/app.conf", "etc/gone.conf", "etc/rw.conf", "var/lib/old", "usr/bin/app", "run/sock/file"} {
+		assert.NilError(t, os.MkdirAll(filepath.Join(cache, filepath.Dir(p)), 0755))
+		assert.NilError(t, ioutil.WriteFile(filepath.Join(cache, p), []byte("cache:"+p), 0644))
+	}
+	// directories without fetched files are not added
+	assert.NilError(t, os.MkdirAll(filepath.Join(cache, "opt/empty"), 0755))
+	assert.NilError(t, os.Symlink("app", filepath.Join(cache, "usr/bin/link")))
+
+	diff, err := tarSource{
+		dir("etc/"), file("etc/rw.conf"), file("etc/.wh.gone.conf"),
+		dir("var/"), file("var/.wh..wh..opq"),
+		file("run/sock"),
+	}.Open(context.Background())
+	assert.NilError(t, err)
+
+	rc := MergeCache(diff, cache, nil)
+	defer rc.Close()
+
+	entries := make(map[string]string)
+	var names []string
+	tr := tar.NewReader(rc)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.NilError(t, err)
+		b, err := ioutil.ReadAll(tr)
+		assert.NilError(t, err)
+		names = append(names, hdr.Name)
+		entries[hdr.Name] = string(b)
+	}
+
+	assert.Check(t, is.DeepEqual(names, []string{
+		"etc/", "etc/rw.conf", "etc/.wh.gone.conf",
+		"var/", "var/.wh..wh..opq",
+		"run/sock",
+		"etc/app.conf",
+		"usr/", "usr/bin/", "usr/bin/app", "usr/bin/link",
+	}))
+	// the writable layer takes precedence
+	assert.Check(t, is.Equal(entries["etc/rw.conf"], "etc/rw.conf"))
+	assert.Check(t, is.Equal(entries["etc/app.conf"], "cache:etc/app.conf"))
+}
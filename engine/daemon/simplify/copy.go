@@ -0,0 +1,172 @@
+package simplify // import "github.com/docker/docker/daemon/simplify"
+
+import (
+	"archive/tar"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/docker/pkg/idtools"
+	"github.com/docker/docker/pkg/ioutils"
+	symlinkutil "github.com/docker/docker/pkg/symlink"
+)
+
+// MissingCacheEntries returns the paths, sorted, of the entries of the cache
+// dir at p or under it that the root filesystem mounted at rootfs lacks, as
+// docker cp reads them. The entries the container removed, as recorded by
+// the whiteouts of diff, the tar stream of its writable layer, are left out,
+// as are those beneath files of rootfs replacing directories of the cache.
+func MissingCacheEntries(dir, rootfs, p string, diff io.Reader) ([]string, error) {
+	hidden, err := whiteouts(diff)
+	if err != nil {
+		return nil, err
+	}
+	p = filepath.Clean("/" + p)
+	var missing []string
+	err = filepath.Walk(filepath.Join(dir, p), func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == filepath.Join(dir, p) {
+				// 完整镜像中也没有该路径
+				return filepath.SkipDir
+			}
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.Clean("/" + rel)
+		if isHidden(hidden, name) {
+			if fi.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		// 只进入rootfs中真实存在的目录，不会跟随容器中的符号链接
+		st, err := os.Lstat(filepath.Join(rootfs, name))
+		switch {
+		case os.IsNotExist(err):
+			missing = append(missing, name)
+			return nil
+		case err != nil:
+			return err
+		case fi.IsDir() && !st.IsDir():
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	return missing, err
+}
+
+// MissingDirs returns the paths, outermost first, of p and the directories
+// above it that the root filesystem mounted at rootfs lacks, as long as they
+// are directories of the cache dir, so that they can be created before an
+// archive is extracted to p.
+func MissingDirs(dir, rootfs, p string) ([]string, error) {
+	var dirs []string
+	p = filepath.Clean("/" + p)
+	for _, d := range append(parents(p), p) {
+		if d == "/" {
+			continue
+		}
+		_, err := os.Lstat(filepath.Join(rootfs, d))
+		if err == nil {
+			continue
+		}
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+		fi, err := os.Lstat(filepath.Join(dir, d))
+		if err != nil || !fi.IsDir() {
+			break
+		}
+		dirs = append(dirs, d)
+	}
+	return dirs, nil
+}
+
+// CountMissing returns how many of pruned, the paths pruned from a
+// simplified image, are at p or under it and missing from the root
+// filesystem mounted at rootfs. Those the container removed, as recorded by
+// the whiteouts of diff, the tar stream of its writable layer, are not
+// counted.
+func CountMissing(rootfs, p string, pruned []string, diff io.Reader) (int, error) {
+	hidden, err := whiteouts(diff)
+	if err != nil {
+		return 0, err
+	}
+	p = filepath.Clean("/" + p)
+	var n int
+	for _, name := range pruned {
+		name = filepath.Clean("/" + name)
+		if name != p && p != "/" && !strings.HasPrefix(name, p+"/") || isHidden(hidden, name) {
+			continue
+		}
+		// 在rootfs范围内解析符号链接，避免访问宿主机上的文件
+		resolved, err := symlinkutil.FollowSymlinkInScope(filepath.Join(rootfs, name), rootfs)
+		if err == nil {
+			_, err = os.Lstat(resolved)
+		}
+		if os.IsNotExist(err) {
+			n++
+		} else if err != nil {
+			return 0, err
+		}
+	}
+	return n, nil
+}
+
+// CopyCache returns content, the tar stream docker cp reads of the path p of
+// the root filesystem of a container, with the entries of the cache dir at
+// missing, paths at p or under it, added after its own. They are named as
+// those of content are, with p replaced by rebase. content may be nil if p
+// itself is missing from the root filesystem. The owners of the entries of
+// the cache are mapped back to the IDs of the container with idMappings, if
+// set. Closing the returned stream closes content.
+func CopyCache(content io.ReadCloser, dir, p, rebase string, missing []string, idMappings *idtools.IDMappings) io.ReadCloser {
+	p = filepath.Clean("/" + p)
+	pr, pw := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		tw := tar.NewWriter(pw)
+		if content != nil {
+			if err := copyEntries(tw, content, make(map[string]bool), make(map[string]bool)); err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+		for _, name := range missing {
+			rel := strings.TrimPrefix(name, p)
+			if p == "/" {
+				rel = name
+			}
+			if err := addCacheEntryAs(tw, filepath.Join(dir, name), strings.TrimSuffix(rebase, "/")+rel, idMappings); err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+		pw.CloseWithError(tw.Close())
+	}()
+	return ioutils.NewReadCloserWrapper(pr, func() error {
+		pr.Close()
+		<-done
+		if content == nil {
+			return nil
+		}
+		return content.Close()
+	})
+}
+
+// escapeGlob returns p quoted so that, as a glob, it only matches p.
+func escapeGlob(p string) string {
+	var b strings.Builder
+	for _, c := range p {
+		if strings.ContainsRune(`*?[\`, c) {
+			b.WriteRune('\\')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
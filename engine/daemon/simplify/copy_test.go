@@ -0,0 +1,123 @@
+package simplify // import "github.com/docker/docker/daemon/simplify"
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+// copyDirs returns a cache holding the files of the full image, and the
+// root filesystem of a container of the simplified image, which removed
+// /usr/share/doc/gone and replaced /usr/share/man with a file.
+func copyDirs(t *testing.T) (string, string) {
+	cache, err := ioutil.TempDir("", "simplify-copy-cache")
+	assert.NilError(t, err)
+	for _, p := range []string{
+		"usr/share/doc/app/README", "usr/share/doc/app/html/index.html", "usr/share/doc/gone",
+		"usr/share/doc/kept", "usr/share/man/app.1", "etc/app.conf",
+	} {
+		assert.NilError(t, os.MkdirAll(filepath.Join(cache, filepath.Dir(p)), 0755))
+		assert.NilError(t, ioutil.WriteFile(filepath.Join(cache, p), []byte("cache:"+p), 0644))
+	}
+	rootfs, err := ioutil.TempDir("", "simplify-copy-rootfs")
+	assert.NilError(t, err)
+	assert.NilError(t, os.MkdirAll(filepath.Join(rootfs, "usr/share/doc"), 0755))
+	assert.NilError(t, ioutil.WriteFile(filepath.Join(rootfs, "usr/share/doc/kept"), nil, 0644))
+	assert.NilError(t, ioutil.WriteFile(filepath.Join(rootfs, "usr/share/man"), nil, 0644))
+	return cache, rootfs
+}
+
+// copyDiff returns the tar stream of the writable layer of the container of
+// copyDirs.
+func copyDiff(t *testing.T) *strings.Reader {
+	rc, err := tarSource{dir("usr/"), dir("usr/share/"), dir("usr/share/doc/"), file("usr/share/doc/.wh.gone"), file("usr/share/man")}.Open(context.Background())
+	assert.NilError(t, err)
+	defer rc.Close()
+	b, err := ioutil.ReadAll(rc)
+	assert.NilError(t, err)
+	return strings.NewReader(string(b))
+}
+
+func TestMissingCacheEntries(t *testing.T) {
+	cache, rootfs := copyDirs(t)
+	defer os.RemoveAll(cache)
+	defer os.RemoveAll(rootfs)
+
+	missing, err := MissingCacheEntries(cache, rootfs, "/usr", copyDiff(t))
+	assert.NilError(t, err)
+	// entries removed by the container, or beneath its files, are left out
+	assert.Check(t, is.DeepEqual(missing, []string{
+		"/usr/share/doc/app",
+		"/usr/share/doc/app/README",
+		"/usr/share/doc/app/html",
+		"/usr/share/doc/app/html/index.html",
+	}))
+
+	missing, err = MissingCacheEntries(cache, rootfs, "/usr/share/doc/app/README", copyDiff(t))
+	assert.NilError(t, err)
+	assert.Check(t, is.DeepEqual(missing, []string{"/usr/share/doc/app/README"}))
+
+	// paths the full image lacks are not missing
+	missing, err = MissingCacheEntries(cache, rootfs, "/opt", copyDiff(t))
+	assert.NilError(t, err)
+	assert.Check(t, is.Len(missing, 0))
+}
+
+func TestMissingDirs(t *testing.T) {
+	cache, rootfs := copyDirs(t)
+	defer os.RemoveAll(cache)
+	defer os.RemoveAll(rootfs)
+
+	dirs, err := MissingDirs(cache, rootfs, "/usr/share/doc/app/html")
+	assert.NilError(t, err)
+	assert.Check(t, is.DeepEqual(dirs, []string{"/usr/share/doc/app", "/usr/share/doc/app/html"}))
+	// only directories are created
+	dirs, err = MissingDirs(cache, rootfs, "/etc/app.conf")
+	assert.NilError(t, err)
+	assert.Check(t, is.DeepEqual(dirs, []string{"/etc"}))
+}
+
+func TestCountMissing(t *testing.T) {
+	cache, rootfs := copyDirs(t)
+	defer os.RemoveAll(cache)
+	defer os.RemoveAll(rootfs)
+
+	pruned := []string{"/usr/share/doc/app/README", "/usr/share/doc/gone", "/usr/share/doc/kept", "/usr/share/docs", "/etc/app.conf"}
+	n, err := CountMissing(rootfs, "/usr/share/doc", pruned, copyDiff(t))
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(n, 1))
+	n, err = CountMissing(rootfs, "/", pruned, copyDiff(t))
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(n, 3))
+}
+
+func TestCopyCache(t *testing.T) {
+	cache, rootfs := copyDirs(t)
+	defer os.RemoveAll(cache)
+	defer os.RemoveAll(rootfs)
+
+	content, err := tarSource{dir("doc/"), file("doc/kept")}.Open(context.Background())
+	assert.NilError(t, err)
+	missing := []string{"/usr/share/doc/app", "/usr/share/doc/app/README"}
+	names, entries := readExport(t, CopyCache(content, cache, "/usr/share/doc", "doc", missing, nil))
+	assert.Check(t, is.DeepEqual(names, []string{"doc/", "doc/kept", "doc/app/", "doc/app/README"}))
+	assert.Check(t, is.Equal(entries["doc/app/README"], "cache:usr/share/doc/app/README"))
+
+	// a missing path is read from the cache alone, named as requested
+	names, _ = readExport(t, CopyCache(nil, cache, "/usr/share/doc/app/README", "README.md", missing[1:], nil))
+	assert.Check(t, is.DeepEqual(names, []string{"README.md"}))
+	names, _ = readExport(t, CopyCache(nil, cache, "/", "/", []string{"/etc", "/etc/app.conf"}, nil))
+	assert.Check(t, is.DeepEqual(names, []string{"etc/", "etc/app.conf"}))
+}
+
+func TestEscapeGlob(t *testing.T) {
+	p := escapeGlob("/usr/share/doc/[draft]*?")
+	assert.Check(t, matchPath([]string{p}, "/usr/share/doc/[draft]*?/index.html"))
+	assert.Check(t, !matchPath([]string{p}, "/usr/share/doc/d*?"))
+}
@@ -0,0 +1,246 @@
+package simplify // import "github.com/docker/docker/daemon/simplify"
+
+import (
+	"bufio"
+	"bytes"
+	"debug/elf"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// maxParseSize is the size of the largest file read into memory to look up
+// the libraries it loads.
+const maxParseSize = 256 << 20
+
+const (
+	glibcConfig    = "/etc/ld.so.conf"
+	glibcCache     = "/etc/ld.so.cache"
+	muslConfigGlob = "/etc/ld-musl-*.path"
+)
+
+// elfInfo is the dynamic linking information of an ELF file.
+type elfInfo struct {
+	class   elf.Class
+	machine elf.Machine
+	// interp is the dynamic linker of an executable.
+	interp  string
+	needed  []string
+	rpath   []string
+	runpath []string
+}
+
+// isELF returns true if head is the beginning of an ELF file.
+func isELF(head []byte) bool {
+	return bytes.HasPrefix(head, []byte(elf.ELFMAG))
+}
+
+// isLinkerConfig returns true if name is a configuration file of the glibc or
+// musl dynamic linker.
+func isLinkerConfig(name string) bool {
+	if name == glibcConfig || filepath.Dir(name) == glibcConfig+".d" {
+		return true
+	}
+	ok, _ := filepath.Match(muslConfigGlob, name)
+	return ok
+}
+
+// parseELF returns the dynamic linking information of the ELF file name, or
+// nil if it cannot be parsed.
+func parseELF(name string, r io.ReaderAt) *elfInfo {
+	f, err := elf.NewFile(r)
+	if err != nil {
+		logrus.WithError(err).WithField("path", name).Debug("simplify: cannot parse ELF file")
+		return nil
+	}
+	defer f.Close()
+
+	info := &elfInfo{class: f.Class, machine: f.Machine}
+	for _, prog := range f.Progs {
+		if prog.Type != elf.PT_INTERP {
+			continue
+		}
+		b, err := ioutil.ReadAll(prog.Open())
+		if err != nil {
+			return nil
+		}
+		info.interp = string(bytes.TrimRight(b, "\x00"))
+	}
+	if info.needed, err = f.DynString(elf.DT_NEEDED); err != nil {
+		logrus.WithError(err).WithField("path", name).Debug("simplify: cannot read needed libraries")
+		return nil
+	}
+	for _, tag := range []elf.DynTag{elf.DT_RPATH, elf.DT_RUNPATH} {
+		paths, err := f.DynString(tag)
+		if err != nil {
+			return nil
+		}
+		var dirs []string
+		for _, p := range paths {
+			dirs = append(dirs, filepath.SplitList(p)...)
+		}
+		if tag == elf.DT_RPATH {
+			info.rpath = dirs
+		} else {
+			info.runpath = dirs
+		}
+	}
+	return info
+}
+
+// requireLibraries requires the dynamic linker and the shared libraries of
+// the ELF file p.
+func (r *executableResolver) requireLibraries(p string, info *elfInfo) {
+	if info.interp != "" {
+		if _, e, _ := r.lookup(info.interp); e == nil {
+			r.warnMissing(info.interp, p)
+		}
+		r.require(info.interp)
+	}
+	for _, lib := range info.needed {
+		found := r.findLibrary(p, info, lib)
+		if found == "" {
+			r.warnMissing(lib, p)
+			continue
+		}
+		r.require(found)
+	}
+}
+
+// warnMissing logs that lib, needed by p, is not in the image, once per
+// library.
+func (r *executableResolver) warnMissing(lib, p string) {
+	if r.missing[lib] {
+		return
+	}
+	r.missing[lib] = true
+	logrus.WithField("path", p).Warnf("simplify: cannot find library %s", lib)
+}
+
+// findLibrary returns the path of the library lib loaded by the ELF file p,
+// or "" if it is not in the image. Like the dynamic linker, it searches the
+// DT_RPATH of p, unless it has a DT_RUNPATH, LD_LIBRARY_PATH, the DT_RUNPATH
+// of p and the directories configured for the dynamic linker.
+func (r *executableResolver) findLibrary(p string, info *elfInfo, lib string) string {
+	if strings.Contains(lib, "/") {
+		if !filepath.IsAbs(lib) {
+			lib = filepath.Join("/", r.sel.workdir, lib)
+		}
+		return lib
+	}
+	var dirs []string
+	if len(info.runpath) == 0 {
+		dirs = append(dirs, info.rpath...)
+	}
+	dirs = append(dirs, r.sel.libraryPath...)
+	dirs = append(dirs, info.runpath...)
+	dirs = append(dirs, r.defaultLibraryDirs(info.class)...)
+	for _, dir := range dirs {
+		dir = strings.Replace(dir, "$ORIGIN", filepath.Dir(p), -1)
+		dir = strings.Replace(dir, "${ORIGIN}", filepath.Dir(p), -1)
+		if !filepath.IsAbs(dir) || strings.Contains(dir, "$") {
+			continue
+		}
+		candidate := filepath.Join(dir, lib)
+		_, e, _ := r.lookup(candidate)
+		if e == nil {
+			continue
+		}
+		// 跳过其他架构的同名库，例如lib32中的库
+		if e.elf != nil && (e.elf.class != info.class || e.elf.machine != info.machine) {
+			continue
+		}
+		return candidate
+	}
+	return ""
+}
+
+// defaultLibraryDirs returns the directories the dynamic linker of the image
+// searches for libraries of the given class when neither LD_LIBRARY_PATH nor
+// the run paths of an ELF file have them. It also requires the files the
+// linker reads them from at run time.
+func (r *executableResolver) defaultLibraryDirs(class elf.Class) []string {
+	if dirs, ok := r.libraryDirs[class]; ok {
+		return dirs
+	}
+
+	var dirs []string
+	if musl := r.matching(muslConfigGlob); len(musl) > 0 || len(r.matching("/lib/ld-musl-*")) > 0 {
+		// musl只读取/etc/ld-musl-$(ARCH).path，不存在时使用默认路径
+		for _, config := range musl {
+			r.required[config] = true
+			dirs = append(dirs, strings.FieldsFunc(string(r.index[config].content), func(c rune) bool {
+				return c == ':' || c == '\n'
+			})...)
+		}
+		if len(musl) == 0 {
+			dirs = []string{"/lib", "/usr/local/lib", "/usr/lib"}
+		}
+	} else {
+		// glibc在运行时读取ld.so.cache，其内容由ld.so.conf生成
+		if r.index[glibcCache] != nil {
+			r.required[glibcCache] = true
+		}
+		dirs = r.linkerConfigDirs(glibcConfig, make(map[string]bool))
+		if class == elf.ELFCLASS64 {
+			dirs = append(dirs, "/lib64", "/usr/lib64")
+		}
+		dirs = append(dirs, "/lib", "/usr/lib")
+	}
+	r.libraryDirs[class] = dirs
+	return dirs
+}
+
+// linkerConfigDirs returns the directories listed in the glibc linker
+// configuration file config and the files it includes.
+func (r *executableResolver) linkerConfigDirs(config string, visited map[string]bool) []string {
+	e := r.index[config]
+	if e == nil || visited[config] {
+		return nil
+	}
+	visited[config] = true
+
+	var dirs []string
+	s := bufio.NewScanner(bytes.NewReader(e.content))
+	for s.Scan() {
+		line := s.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		// 目录之间可以用空白、逗号或冒号分隔
+		fields := strings.FieldsFunc(line, func(c rune) bool {
+			return c == ' ' || c == '\t' || c == ',' || c == ':'
+		})
+		switch {
+		case len(fields) == 0 || fields[0] == "hwcap":
+		case fields[0] == "include":
+			for _, pattern := range fields[1:] {
+				if !filepath.IsAbs(pattern) {
+					pattern = filepath.Join(filepath.Dir(config), pattern)
+				}
+				for _, included := range r.matching(pattern) {
+					dirs = append(dirs, r.linkerConfigDirs(included, visited)...)
+				}
+			}
+		default:
+			dirs = append(dirs, fields...)
+		}
+	}
+	return dirs
+}
+
+// matching returns the paths in the index matching pattern, sorted.
+func (r *executableResolver) matching(pattern string) []string {
+	var paths []string
+	for p := range r.index {
+		if ok, _ := filepath.Match(pattern, p); ok {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
@@ -0,0 +1,164 @@
+package simplify // import "github.com/docker/docker/daemon/simplify"
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"testing"
+
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+// elfFile returns a minimal ELF64 shared object for machine, with the given
+// dynamic linker, run path and needed libraries.
+func elfFile(machine elf.Machine, interp, runpath string, needed ...string) string {
+	dynstr := []byte{0}
+	var dyn []elf.Dyn64
+	addString := func(tag elf.DynTag, s string) {
+		dyn = append(dyn, elf.Dyn64{Tag: int64(tag), Val: uint64(len(dynstr))})
+		dynstr = append(append(dynstr, s...), 0)
+	}
+	for _, lib := range needed {
+		addString(elf.DT_NEEDED, lib)
+	}
+	if runpath != "" {
+		addString(elf.DT_RUNPATH, runpath)
+	}
+	dyn = append(dyn, elf.Dyn64{Tag: int64(elf.DT_NULL)})
+
+	var progs []elf.Prog64
+	off := uint64(64)
+	if interp != "" {
+		off += 56
+		progs = append(progs, elf.Prog64{Type: uint32(elf.PT_INTERP), Off: off, Filesz: uint64(len(interp) + 1)})
+		off += uint64(len(interp) + 1)
+	}
+	dynstrOff := off
+	dynOff := dynstrOff + uint64(len(dynstr))
+	shOff := dynOff + uint64(16*len(dyn))
+	sections := []elf.Section64{
+		{},
+		{Type: uint32(elf.SHT_STRTAB), Off: dynstrOff, Size: uint64(len(dynstr))},
+		{Type: uint32(elf.SHT_DYNAMIC), Off: dynOff, Size: uint64(16 * len(dyn)), Link: 1, Entsize: 16},
+	}
+	hdr := elf.Header64{
+		Ident:     [elf.EI_NIDENT]byte{0x7f, 'E', 'L', 'F', byte(elf.ELFCLASS64), byte(elf.ELFDATA2LSB), byte(elf.EV_CURRENT)},
+		Type:      uint16(elf.ET_DYN),
+		Machine:   uint16(machine),
+		Version:   uint32(elf.EV_CURRENT),
+		Shoff:     shOff,
+		Ehsize:    64,
+		Phentsize: 56,
+		Phnum:     uint16(len(progs)),
+		Shentsize: 64,
+		Shnum:     uint16(len(sections)),
+	}
+	if len(progs) > 0 {
+		hdr.Phoff = 64
+	}
+
+	buf := bytes.NewBuffer(nil)
+	for _, v := range []interface{}{hdr, progs} {
+		binary.Write(buf, binary.LittleEndian, v)
+	}
+	if interp != "" {
+		buf.WriteString(interp + "\x00")
+	}
+	buf.Write(dynstr)
+	for _, v := range []interface{}{dyn, sections} {
+		binary.Write(buf, binary.LittleEndian, v)
+	}
+	return buf.String()
+}
+
+func TestParseELF(t *testing.T) {
+	info := parseELF("app", bytes.NewReader([]byte(elfFile(elf.EM_X86_64, "/lib64/ld-linux-x86-64.so.2", "$ORIGIN/../lib:/opt/lib", "libfoo.so.1", "libc.so.6"))))
+	assert.Assert(t, info != nil)
+	assert.Check(t, is.Equal(info.class, elf.ELFCLASS64))
+	assert.Check(t, is.Equal(info.machine, elf.EM_X86_64))
+	assert.Check(t, is.Equal(info.interp, "/lib64/ld-linux-x86-64.so.2"))
+	assert.Check(t, is.DeepEqual(info.needed, []string{"libfoo.so.1", "libc.so.6"}))
+	assert.Check(t, is.DeepEqual(info.runpath, []string{"$ORIGIN/../lib", "/opt/lib"}))
+
+	assert.Check(t, parseELF("script", bytes.NewReader([]byte("#!/bin/sh\n"))) == nil)
+}
+
+func selectLibraries(t *testing.T, full, diff Source) []string {
+	sel, err := NewSelector(nil, nil)
+	assert.NilError(t, err)
+	sel.KeepLibraries()
+	return selectedNames(t, []Source{full}, diff, sel)
+}
+
+func TestSelectKeepsLibrariesGlibc(t *testing.T) {
+	const lib = "usr/lib/x86_64-linux-gnu/"
+	full := execSource{
+		entry(dir("etc/")),
+		entry(file("etc/ld.so.cache")),
+		exe("etc/ld.so.conf", "include /etc/ld.so.conf.d/*.conf\n"),
+		entry(dir("etc/ld.so.conf.d/")),
+		exe("etc/ld.so.conf.d/x86_64-linux-gnu.conf", "# Multiarch support\n/usr/local/lib/x86_64-linux-gnu\n/usr/lib/x86_64-linux-gnu\n"),
+		entry(dir("lib64/")),
+		symlink("lib64/ld-linux-x86-64.so.2", "/"+lib+"ld-2.28.so"),
+		entry(dir("usr/")),
+		entry(dir("usr/lib/")),
+		entry(dir(lib)),
+		exe(lib+"ld-2.28.so", elfFile(elf.EM_X86_64, "", "")),
+		exe(lib+"libc.so.6", elfFile(elf.EM_X86_64, "", "", "ld-linux-x86-64.so.2")),
+		symlink(lib+"libfoo.so.1", "libfoo.so.1.2.3"),
+		exe(lib+"libfoo.so.1.2.3", elfFile(elf.EM_X86_64, "", "", "libc.so.6")),
+		exe(lib+"libbar.so", elfFile(elf.EM_X86_64, "", "", "libc.so.6")),
+		exe(lib+"libunused.so", elfFile(elf.EM_X86_64, "", "", "libc.so.6")),
+		entry(dir("opt/")),
+		entry(dir("opt/app/")),
+		entry(dir("opt/app/lib/")),
+		// built for another architecture, skipped by the dynamic linker
+		exe("opt/app/lib/libbar.so", elfFile(elf.EM_386, "", "")),
+		exe("opt/app/lib/libbaz.so", elfFile(elf.EM_X86_64, "", "")),
+		entry(dir("opt/app/bin/")),
+		exe("opt/app/bin/app", elfFile(elf.EM_X86_64, "/lib64/ld-linux-x86-64.so.2", "$ORIGIN/../lib", "libfoo.so.1", "libbar.so", "libbaz.so", "libmissing.so.0")),
+	}
+	// the container only ran app, whose libraries were loaded before
+	// profiling started
+	diff := execSource{
+		entry(dir("opt/")),
+		entry(dir("opt/app/")),
+		entry(dir("opt/app/bin/")),
+		exe("opt/app/bin/app", elfFile(elf.EM_X86_64, "/lib64/ld-linux-x86-64.so.2", "$ORIGIN/../lib", "libfoo.so.1", "libbar.so", "libbaz.so", "libmissing.so.0")),
+	}
+
+	assert.Check(t, is.DeepEqual(selectLibraries(t, full, diff), []string{
+		"opt/", "opt/app/", "opt/app/bin/", "opt/app/bin/app",
+		"etc/", "etc/ld.so.cache",
+		"lib64/", "lib64/ld-linux-x86-64.so.2",
+		"usr/", "usr/lib/", lib, lib + "ld-2.28.so", lib + "libc.so.6", lib + "libfoo.so.1", lib + "libfoo.so.1.2.3", lib + "libbar.so",
+		"opt/app/lib/", "opt/app/lib/libbaz.so",
+	}))
+}
+
+func TestSelectKeepsLibrariesMusl(t *testing.T) {
+	full := execSource{
+		entry(dir("etc/")),
+		exe("etc/ld-musl-x86_64.path", "/lib\n/usr/local/lib:/usr/lib\n"),
+		entry(dir("lib/")),
+		exe("lib/ld-musl-x86_64.so.1", elfFile(elf.EM_X86_64, "", "")),
+		symlink("lib/libc.musl-x86_64.so.1", "ld-musl-x86_64.so.1"),
+		entry(dir("usr/")),
+		entry(dir("usr/local/")),
+		entry(dir("usr/local/lib/")),
+		exe("usr/local/lib/libz.so.1", elfFile(elf.EM_X86_64, "", "", "libc.musl-x86_64.so.1")),
+		entry(dir("usr/lib/")),
+		exe("usr/lib/libz.so.1", elfFile(elf.EM_X86_64, "", "", "libc.musl-x86_64.so.1")),
+		entry(dir("bin/")),
+		exe("bin/app", elfFile(elf.EM_X86_64, "/lib/ld-musl-x86_64.so.1", "", "libz.so.1", "libc.musl-x86_64.so.1")),
+	}
+	diff := execSource{entry(dir("bin/")), exe("bin/app", elfFile(elf.EM_X86_64, "/lib/ld-musl-x86_64.so.1", "", "libz.so.1", "libc.musl-x86_64.so.1"))}
+
+	assert.Check(t, is.DeepEqual(selectLibraries(t, full, diff), []string{
+		"bin/", "bin/app",
+		"etc/", "etc/ld-musl-x86_64.path",
+		"lib/", "lib/ld-musl-x86_64.so.1", "lib/libc.musl-x86_64.so.1",
+		"usr/", "usr/local/", "usr/local/lib/", "usr/local/lib/libz.so.1",
+	}))
+}
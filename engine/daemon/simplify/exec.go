@@ -0,0 +1,82 @@
+package simplify // import "github.com/docker/docker/daemon/simplify"
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+
+	containertypes "github.com/docker/docker/api/types/container"
+)
+
+// MissingExecFiles returns the paths, sorted, of the files of the full image
+// that running the commands of config in a container needs and that its root
+// filesystem, mounted at rootfs, lacks: the executables KeepExecutables
+// keeps for config, along with the symlinks leading to them, the interpreters
+// named on their shebang lines and the shared libraries they load, and the
+// files at paths. The full image is given as its layers, topmost first, and
+// is only read if one of the executables or of paths is missing from rootfs.
+func MissingExecFiles(ctx context.Context, rootfs string, full []Source, config *containertypes.Config, paths []string) ([]string, error) {
+	sel := &Selector{libraries: true}
+	sel.KeepExecutables(config)
+	found := true
+	for _, cmd := range sel.commands {
+		ok, err := lookPath(rootfs, cmd, sel)
+		if err != nil {
+			return nil, err
+		}
+		found = found && ok
+	}
+	absent, err := absentPaths(rootfs, paths)
+	if err != nil {
+		return nil, err
+	}
+	if found && len(absent) == 0 {
+		return nil, nil
+	}
+
+	index, err := indexImage(ctx, full)
+	if err != nil {
+		return nil, err
+	}
+	r := newExecutableResolver(index, sel, true)
+	r.requireCommands()
+	for _, p := range paths {
+		r.require(filepath.Clean("/" + p))
+	}
+	required := make([]string, 0, len(r.required))
+	for p := range r.required {
+		required = append(required, p)
+	}
+	return Absent(rootfs, required)
+}
+
+// lookPath returns true if the root filesystem mounted at rootfs has the
+// executable cmd, looked up as sel does.
+func lookPath(rootfs, cmd string, sel *Selector) (bool, error) {
+	if cmd == "" {
+		return true, nil
+	}
+	var candidates []string
+	switch {
+	case filepath.IsAbs(cmd):
+		candidates = []string{cmd}
+	case strings.Contains(cmd, "/"):
+		candidates = []string{filepath.Join("/", sel.workdir, cmd)}
+	default:
+		for _, dir := range sel.path {
+			if filepath.IsAbs(dir) {
+				candidates = append(candidates, filepath.Join(dir, cmd))
+			}
+		}
+	}
+	for _, p := range candidates {
+		absent, err := absentPaths(rootfs, []string{p})
+		if err != nil {
+			return false, err
+		}
+		if len(absent) == 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,56 @@
+package simplify // import "github.com/docker/docker/daemon/simplify"
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	containertypes "github.com/docker/docker/api/types/container"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+func TestMissingExecFiles(t *testing.T) {
+	rootfs, err := ioutil.TempDir("", "simplify-exec")
+	assert.NilError(t, err)
+	defer os.RemoveAll(rootfs)
+	// the simplified image kept the shell and the configuration only
+	for _, d := range []string{"app", "bin", "etc", "usr"} {
+		assert.NilError(t, os.Mkdir(filepath.Join(rootfs, d), 0755))
+	}
+	assert.NilError(t, ioutil.WriteFile(filepath.Join(rootfs, "bin/busybox"), nil, 0755))
+	assert.NilError(t, os.Symlink("busybox", filepath.Join(rootfs, "bin/sh")))
+	assert.NilError(t, ioutil.WriteFile(filepath.Join(rootfs, "etc/app.conf"), nil, 0644))
+	assert.NilError(t, os.Symlink("../bin", filepath.Join(rootfs, "usr/bin")))
+
+	ctx := context.Background()
+	env := []string{"PATH=/usr/bin:/bin"}
+	missing, err := MissingExecFiles(ctx, rootfs, fullImage, &containertypes.Config{Cmd: []string{"sh"}, Env: env}, nil)
+	assert.NilError(t, err)
+	assert.Check(t, is.Len(missing, 0))
+
+	// looked up through the symlink in the PATH
+	missing, err = MissingExecFiles(ctx, rootfs, fullImage, &containertypes.Config{Cmd: []string{"bash"}, Env: env}, nil)
+	assert.NilError(t, err)
+	assert.Check(t, is.DeepEqual(missing, []string{"/bin/bash"}))
+
+	// the interpreter of a script is needed too
+	missing, err = MissingExecFiles(ctx, rootfs, fullImage, &containertypes.Config{Cmd: []string{"./start.sh"}, Env: env, WorkingDir: "/app"}, []string{"/etc/app.conf"})
+	assert.NilError(t, err)
+	assert.Check(t, is.DeepEqual(missing, []string{"/app/start.sh", "/bin/bash"}))
+
+	// and so are the commands of a healthcheck run by a shell
+	missing, err = MissingExecFiles(ctx, rootfs, fullImage, &containertypes.Config{
+		Healthcheck: &containertypes.HealthConfig{Test: []string{"CMD-SHELL", "curl -f http://localhost/ || exit 1"}},
+		Env:         env,
+	}, nil)
+	assert.NilError(t, err)
+	assert.Check(t, is.DeepEqual(missing, []string{"/bin/curl"}))
+
+	// commands the full image lacks are not missing
+	missing, err = MissingExecFiles(ctx, rootfs, fullImage, &containertypes.Config{Cmd: []string{"vim"}, Env: env}, nil)
+	assert.NilError(t, err)
+	assert.Check(t, is.Len(missing, 0))
+}
@@ -0,0 +1,344 @@
+package simplify // import "github.com/docker/docker/daemon/simplify"
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"debug/elf"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	containertypes "github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/system"
+	"github.com/sirupsen/logrus"
+)
+
+// maxSymlinks bounds the symlinks followed while resolving a path, as the
+// kernel does, so that symlink loops in an image terminate.
+const maxSymlinks = 40
+
+// shebangSize is how much of an executable is read for its shebang line.
+const shebangSize = 256
+
+// KeepExecutables makes the selector keep the executables config runs even if
+// the container never ran them: those named by its entrypoint, command and
+// healthcheck, the interpreters named on their shebang lines, and the shell
+// running commands given in shell form.
+func (s *Selector) KeepExecutables(config *containertypes.Config) {
+	if config == nil {
+		return
+	}
+	s.commands = nil
+	argv := config.Entrypoint
+	if len(argv) == 0 {
+		argv = config.Cmd
+	} else if len(config.Cmd) > 0 {
+		// 入口脚本通常会exec CMD
+		s.commands = append(s.commands, config.Cmd[0])
+	}
+	s.commands = append(s.commands, argvCommands(argv)...)
+	if hc := config.Healthcheck; hc != nil && len(hc.Test) > 1 {
+		switch hc.Test[0] {
+		case "CMD":
+			s.commands = append(s.commands, argvCommands(hc.Test[1:])...)
+		case "CMD-SHELL":
+			shell := []string(config.Shell)
+			if len(shell) == 0 {
+				shell = []string{"/bin/sh", "-c"}
+			}
+			s.commands = append(s.commands, argvCommands(append(shell, hc.Test[1]))...)
+		}
+	}
+
+	s.path = filepath.SplitList(system.DefaultPathEnv("linux"))
+	s.libraryPath = nil
+	for _, env := range config.Env {
+		switch {
+		case strings.HasPrefix(env, "PATH="):
+			s.path = filepath.SplitList(strings.TrimPrefix(env, "PATH="))
+		case strings.HasPrefix(env, "LD_LIBRARY_PATH="):
+			s.libraryPath = filepath.SplitList(strings.TrimPrefix(env, "LD_LIBRARY_PATH="))
+		}
+	}
+	s.workdir = config.WorkingDir
+}
+
+// argvCommands returns the commands run by argv: its first element and, for
+// "sh -c" forms, the first command of the script.
+func argvCommands(argv []string) []string {
+	if len(argv) == 0 {
+		return nil
+	}
+	cmds := []string{argv[0]}
+	if len(argv) > 2 && argv[1] == "-c" {
+		switch filepath.Base(argv[0]) {
+		case "sh", "bash", "ash", "dash", "zsh", "ksh":
+			if cmd := scriptCommand(argv[2]); cmd != "" {
+				cmds = append(cmds, cmd)
+			}
+		}
+	}
+	return cmds
+}
+
+// scriptCommand returns the first command of a shell script, or "" if it
+// cannot be told without a shell.
+func scriptCommand(script string) string {
+	for _, word := range strings.Fields(script) {
+		if word == "exec" || (strings.Contains(word, "=") && !strings.HasPrefix(word, "=")) {
+			// 跳过exec和环境变量赋值
+			continue
+		}
+		if strings.ContainsAny(word, "$`\"'\\;&|<>(){}*?[") {
+			return ""
+		}
+		return word
+	}
+	return ""
+}
+
+// execEntry is a non-directory entry of an image as far as resolving
+// executables and their libraries is concerned.
+type execEntry struct {
+	typeflag byte
+	linkname string
+	// shebang holds the fields of the shebang line of an executable file.
+	shebang []string
+	// elf holds the dynamic linking information of an ELF file.
+	elf *elfInfo
+	// content holds the content of dynamic linker configuration files.
+	content []byte
+}
+
+// isExecutable returns true if hdr is a regular file anyone may execute.
+func isExecutable(hdr *tar.Header) bool {
+	return isRegular(hdr) && hdr.Mode&0111 != 0
+}
+
+// isRegular returns true if hdr is a regular file, sparse files included.
+func isRegular(hdr *tar.Header) bool {
+	return hdr.Typeflag == tar.TypeReg || hdr.Typeflag == tar.TypeRegA || hdr.Typeflag == tar.TypeGNUSparse
+}
+
+// readEntry returns the entry for the file name described by hdr, copying
+// its content from r to w.
+func readEntry(name string, hdr *tar.Header, r io.Reader, w io.Writer) (*execEntry, error) {
+	e := &execEntry{typeflag: hdr.Typeflag, linkname: hdr.Linkname}
+	if !isRegular(hdr) {
+		_, err := io.Copy(w, r)
+		return e, err
+	}
+
+	head := make([]byte, shebangSize)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	head = head[:n]
+
+	switch {
+	case isELF(head) || isLinkerConfig(name):
+		// 解析ELF文件和动态链接器配置需要完整的内容
+		if hdr.Size > maxParseSize {
+			logrus.WithField("path", name).Warn("simplify: file too large to look up its libraries")
+			break
+		}
+		buf := bytes.NewBuffer(make([]byte, 0, hdr.Size))
+		buf.Write(head)
+		if _, err := io.Copy(buf, r); err != nil {
+			return nil, err
+		}
+		if isELF(head) {
+			e.elf = parseELF(name, bytes.NewReader(buf.Bytes()))
+		} else {
+			e.content = buf.Bytes()
+		}
+		_, err := w.Write(buf.Bytes())
+		return e, err
+	case bytes.HasPrefix(head, []byte("#!")) && isExecutable(hdr):
+		line := head[2:]
+		if i := bytes.IndexByte(line, '\n'); i >= 0 {
+			line = line[:i]
+		}
+		e.shebang = strings.Fields(string(line))
+	}
+	if _, err := w.Write(head); err != nil {
+		return nil, err
+	}
+	_, err = io.Copy(w, r)
+	return e, err
+}
+
+// indexImage returns the non-directory entries of the image made of sources,
+// topmost first.
+func indexImage(ctx context.Context, sources []Source) (map[string]*execEntry, error) {
+	index := make(map[string]*execEntry)
+	err := scanImage(ctx, sources, func(name string, hdr *tar.Header, r io.Reader) error {
+		if hdr.Typeflag == tar.TypeDir {
+			return nil
+		}
+		e, err := readEntry(name, hdr, r, ioutil.Discard)
+		if err != nil {
+			return err
+		}
+		index[name] = e
+		return nil
+	})
+	return index, err
+}
+
+// indexLinks returns the non-directory entries of the image made of sources
+// as indexImage does, without reading their content: only the symlinks and
+// hard links can be followed.
+func indexLinks(ctx context.Context, sources []Source) (map[string]*execEntry, error) {
+	index := make(map[string]*execEntry)
+	err := scanImage(ctx, sources, func(name string, hdr *tar.Header, _ io.Reader) error {
+		if hdr.Typeflag != tar.TypeDir {
+			index[name] = &execEntry{typeflag: hdr.Typeflag, linkname: hdr.Linkname}
+		}
+		return nil
+	})
+	return index, err
+}
+
+// executableResolver finds the files needed to run commands in an image.
+type executableResolver struct {
+	index map[string]*execEntry
+	sel   *Selector
+	// libraries is true if the shared libraries of the files are required.
+	libraries bool
+	required  map[string]bool
+	// libraryDirs are the directories the dynamic linker searches by
+	// default, per ELF class.
+	libraryDirs map[elf.Class][]string
+	missing     map[string]bool
+}
+
+func newExecutableResolver(index map[string]*execEntry, sel *Selector, libraries bool) *executableResolver {
+	return &executableResolver{
+		index:       index,
+		sel:         sel,
+		libraries:   libraries,
+		required:    make(map[string]bool),
+		libraryDirs: make(map[elf.Class][]string),
+		missing:     make(map[string]bool),
+	}
+}
+
+// requireCommands requires the executables of the commands of the selector.
+func (r *executableResolver) requireCommands() {
+	for _, cmd := range r.sel.commands {
+		r.requireCommand(cmd)
+	}
+}
+
+// requireCommand requires the executable cmd, looking it up in the PATH if
+// it has no slash.
+func (r *executableResolver) requireCommand(cmd string) {
+	if cmd == "" {
+		return
+	}
+	if strings.Contains(cmd, "/") {
+		if !filepath.IsAbs(cmd) {
+			cmd = filepath.Join("/", r.sel.workdir, cmd)
+		}
+		r.require(cmd)
+		return
+	}
+	for _, dir := range r.sel.path {
+		if !filepath.IsAbs(dir) {
+			continue
+		}
+		p := filepath.Join(dir, cmd)
+		if _, e, _ := r.lookup(p); e != nil {
+			r.require(p)
+			return
+		}
+	}
+}
+
+// require requires the file at p along with the symlinks leading to it, the
+// interpreter named on its shebang line and the libraries it loads.
+func (r *executableResolver) require(p string) {
+	target, e, links := r.lookup(p)
+	if e == nil {
+		return
+	}
+	for _, l := range links {
+		r.required[l] = true
+	}
+	if r.required[target] {
+		return
+	}
+	r.required[target] = true
+
+	switch {
+	case e.typeflag == tar.TypeLink:
+		r.require(filepath.Clean("/" + e.linkname))
+	case len(e.shebang) > 0:
+		r.requireCommand(e.shebang[0])
+		if filepath.Base(e.shebang[0]) == "env" {
+			// #!/usr/bin/env python3 在PATH中查找解释器
+			for _, arg := range e.shebang[1:] {
+				if strings.HasPrefix(arg, "-") || strings.Contains(arg, "=") {
+					continue
+				}
+				r.requireCommand(arg)
+				break
+			}
+		}
+	case e.elf != nil && r.libraries:
+		r.requireLibraries(target, e.elf)
+	}
+}
+
+// requireLinks requires the file at p along with the symlinks leading to it
+// and, if it is a hard link, the entry holding its content.
+func (r *executableResolver) requireLinks(p string) {
+	target, e, links := r.lookup(p)
+	if e == nil {
+		return
+	}
+	for _, l := range links {
+		r.required[l] = true
+	}
+	r.required[target] = true
+	if e.typeflag == tar.TypeLink {
+		if l := filepath.Clean("/" + e.linkname); !r.required[l] {
+			r.requireLinks(l)
+		}
+	}
+}
+
+// lookup resolves the symlinks in p. It returns the resolved path, its entry,
+// or nil if there is no such file, and the symlinks followed.
+func (r *executableResolver) lookup(p string) (string, *execEntry, []string) {
+	var links []string
+	for len(links) <= maxSymlinks {
+		parts := strings.Split(strings.TrimPrefix(filepath.Clean("/"+p), "/"), "/")
+		resolved := "/"
+		followed := false
+		for i, part := range parts {
+			cur := filepath.Join(resolved, part)
+			e := r.index[cur]
+			if e == nil || e.typeflag != tar.TypeSymlink {
+				resolved = cur
+				continue
+			}
+			links = append(links, cur)
+			target := e.linkname
+			if !filepath.IsAbs(target) {
+				target = filepath.Join(resolved, target)
+			}
+			p = filepath.Join(append([]string{target}, parts[i+1:]...)...)
+			followed = true
+			break
+		}
+		if !followed {
+			return resolved, r.index[resolved], links
+		}
+	}
+	return "", nil, nil
+}
@@ -0,0 +1,180 @@
+package simplify // import "github.com/docker/docker/daemon/simplify"
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	containertypes "github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/layer"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+// execSource is a layer whose regular files hold the given contents.
+type execSource []execFile
+
+type execFile struct {
+	hdr     *tar.Header
+	content string
+}
+
+func (s execSource) DiffID() layer.DiffID {
+	return ""
+}
+
+func (s execSource) Open(ctx context.Context) (io.ReadCloser, error) {
+	buf := bytes.NewBuffer(nil)
+	tw := tar.NewWriter(buf)
+	for _, f := range s {
+		hdr := *f.hdr
+		if hdr.Typeflag == tar.TypeReg {
+			hdr.Size = int64(len(f.content))
+		}
+		if err := tw.WriteHeader(&hdr); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write([]byte(f.content)); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(buf), nil
+}
+
+func exe(name, content string) execFile {
+	return execFile{hdr: &tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0755}, content: content}
+}
+
+func symlink(name, target string) execFile {
+	return execFile{hdr: &tar.Header{Name: name, Typeflag: tar.TypeSymlink, Linkname: target, Mode: 0777}}
+}
+
+func entry(hdr *tar.Header) execFile {
+	return execFile{hdr: hdr}
+}
+
+// fullImage has a busybox-style /bin, a /usr/bin merged into /bin and a
+// few scripts that are never executed while profiling.
+var fullImage = []Source{
+	execSource{
+		entry(dir("app/")),
+		exe("app/start.sh", "#!/bin/bash\nexec server\n"),
+		exe("app/job.py", "#!/usr/bin/env -S python3 -u\nprint()\n"),
+		exe("app/check", "#!/bin/sh\n"),
+		exe("app/unused.sh", "#!/usr/bin/perl\n"),
+	},
+	execSource{
+		entry(dir("bin/")),
+		exe("bin/busybox", "\x7fELF"),
+		symlink("bin/sh", "busybox"),
+		exe("bin/bash", "\x7fELF"),
+		exe("bin/python3", "\x7fELF"),
+		exe("bin/env", "\x7fELF"),
+		exe("bin/perl", "\x7fELF"),
+		exe("bin/server", "\x7fELF"),
+		exe("bin/curl", "\x7fELF"),
+		entry(dir("usr/")),
+		symlink("usr/bin", "../bin"),
+		entry(dir("etc/")),
+		entry(file("etc/app.conf")),
+	},
+}
+
+func selectedNames(t *testing.T, full []Source, diff Source, sel *Selector) []string {
+	rc, err := diff.Open(context.Background())
+	assert.NilError(t, err)
+	rc = Select(context.Background(), rc, full, sel)
+	defer rc.Close()
+
+	var names []string
+	tr := tar.NewReader(rc)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.NilError(t, err)
+		names = append(names, hdr.Name)
+	}
+	return names
+}
+
+func TestSelectKeepsExecutables(t *testing.T) {
+	diff := execSource{entry(dir("etc/")), entry(file("etc/app.conf"))}
+
+	for _, tc := range []struct {
+		name     string
+		config   *containertypes.Config
+		expected []string
+	}{
+		{
+			name:   "script never executed",
+			config: &containertypes.Config{Cmd: []string{"/app/start.sh"}},
+			// start.sh execs server, which is not looked into
+			expected: []string{"etc/", "etc/app.conf", "app/", "app/start.sh", "bin/", "bin/bash"},
+		},
+		{
+			name:     "relative to working dir",
+			config:   &containertypes.Config{WorkingDir: "/app", Cmd: []string{"./start.sh"}},
+			expected: []string{"etc/", "etc/app.conf", "app/", "app/start.sh", "bin/", "bin/bash"},
+		},
+		{
+			name:     "shell form",
+			config:   &containertypes.Config{Cmd: []string{"/bin/sh", "-c", "exec server --port 80"}},
+			expected: []string{"etc/", "etc/app.conf", "bin/", "bin/busybox", "bin/sh", "bin/server", "usr/", "usr/bin"},
+		},
+		{
+			name:   "env shebang",
+			config: &containertypes.Config{Entrypoint: []string{"/usr/bin/env"}, Cmd: []string{"/app/job.py"}},
+			expected: []string{
+				"etc/", "etc/app.conf", "app/", "app/job.py",
+				"bin/", "bin/python3", "bin/env", "usr/", "usr/bin",
+			},
+		},
+		{
+			name: "healthcheck",
+			config: &containertypes.Config{
+				Env:         []string{"PATH=/usr/bin"},
+				Cmd:         []string{"server"},
+				Healthcheck: &containertypes.HealthConfig{Test: []string{"CMD-SHELL", "curl -f http://localhost/ || exit 1"}},
+			},
+			expected: []string{"etc/", "etc/app.conf", "bin/", "bin/busybox", "bin/sh", "bin/server", "bin/curl", "usr/", "usr/bin"},
+		},
+		{
+			name:     "missing executable",
+			config:   &containertypes.Config{Cmd: []string{"/app/missing.sh"}},
+			expected: []string{"etc/", "etc/app.conf"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			sel, err := NewSelector(nil, nil)
+			assert.NilError(t, err)
+			sel.KeepExecutables(tc.config)
+			assert.Check(t, is.DeepEqual(selectedNames(t, fullImage, diff, sel), tc.expected))
+		})
+	}
+}
+
+func TestSelectExecutablesChangedInContainer(t *testing.T) {
+	sel, err := NewSelector(nil, []string{"/app", "/bin"})
+	assert.NilError(t, err)
+	sel.KeepExecutables(&containertypes.Config{Cmd: []string{"/app/start.sh"}, Healthcheck: &containertypes.HealthConfig{Test: []string{"CMD", "/app/check"}}})
+
+	// the container rewrote start.sh to use perl and removed bash and check
+	diff := execSource{
+		entry(dir("app/")),
+		exe("app/start.sh", "#!/usr/bin/perl\n"),
+		entry(file("app/.wh.check")),
+		entry(dir("bin/")),
+		entry(file("bin/.wh.bash")),
+	}
+	assert.Check(t, is.DeepEqual(selectedNames(t, fullImage, diff, sel), []string{
+		"app/", "app/start.sh", "app/.wh.check", "bin/", "bin/.wh.bash", "bin/perl", "usr/", "usr/bin",
+	}))
+}
@@ -0,0 +1,124 @@
+package simplify // import "github.com/docker/docker/daemon/simplify"
+
+import (
+	"archive/tar"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/pkg/archive"
+	"github.com/docker/docker/pkg/idtools"
+	"github.com/docker/docker/pkg/ioutils"
+)
+
+// OmittedManifest is the file listing, one per line, the paths of the full
+// image a sparse export of a container of a simplified image omits. It is
+// added at the root of the exported filesystem.
+const OmittedManifest = ".simplify-omitted"
+
+// CompleteExport returns rootfs, the tar stream of the root filesystem of a
+// container of a simplified image, with the files of the full image fetched
+// into dir added to it, so that the export holds every file of the full
+// image. The files the container removed, as recorded by the whiteouts of
+// diff, the tar stream of its writable layer, are left out. The owners of the
+// fetched files are mapped back to the IDs of the container with idMappings,
+// if set. Closing the returned stream closes rootfs and diff.
+func CompleteExport(rootfs, diff io.ReadCloser, dir string, idMappings *idtools.IDMappings) io.ReadCloser {
+	return pipeExport(rootfs, diff, func(tw *tar.Writer, seen, hidden map[string]bool) error {
+		return addCache(tw, dir, seen, hidden, idMappings)
+	})
+}
+
+// SparseExport returns rootfs, the tar stream of the root filesystem of a
+// container of a simplified image, with OmittedManifest added to it, listing
+// the paths pruned from the full image that are missing from rootfs. The
+// files the container removed, as recorded by the whiteouts of diff, the tar
+// stream of its writable layer, are not listed. Closing the returned stream
+// closes rootfs and diff.
+func SparseExport(rootfs, diff io.ReadCloser, pruned []string) io.ReadCloser {
+	return pipeExport(rootfs, diff, func(tw *tar.Writer, seen, hidden map[string]bool) error {
+		var omitted []string
+		for _, p := range pruned {
+			p = filepath.Clean("/" + p)
+			if !seen[p] && !isHidden(hidden, p) {
+				omitted = append(omitted, p)
+			}
+		}
+		sort.Strings(omitted)
+		var b strings.Builder
+		for _, p := range omitted {
+			b.WriteString(p + "\n")
+		}
+		if err := tw.WriteHeader(&tar.Header{
+			Name:     OmittedManifest,
+			Typeflag: tar.TypeReg,
+			Mode:     0444,
+			Size:     int64(b.Len()),
+			ModTime:  time.Now(),
+		}); err != nil {
+			return err
+		}
+		_, err := io.WriteString(tw, b.String())
+		return err
+	})
+}
+
+// pipeExport streams the entries of rootfs followed by those fn writes,
+// given the paths of rootfs in seen, and those rootfs or the whiteouts of
+// diff hide from the full image in hidden.
+func pipeExport(rootfs, diff io.ReadCloser, fn func(tw *tar.Writer, seen, hidden map[string]bool) error) io.ReadCloser {
+	pr, pw := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// 先读取读写层中的whiteout，容器删除的文件不再加入
+		hidden, err := whiteouts(diff)
+		if err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		tw := tar.NewWriter(pw)
+		seen := make(map[string]bool)
+		if err := copyEntries(tw, rootfs, seen, hidden); err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		if err := fn(tw, seen, hidden); err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		pw.CloseWithError(tw.Close())
+	}()
+	return ioutils.NewReadCloserWrapper(pr, func() error {
+		pr.Close()
+		<-done
+		diff.Close()
+		return rootfs.Close()
+	})
+}
+
+// whiteouts returns the paths the whiteouts and opaque directories of the
+// tar stream of a layer, r, hide from the layers beneath it.
+func whiteouts(r io.Reader) (map[string]bool, error) {
+	hidden := make(map[string]bool)
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return hidden, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		name := filepath.Clean("/" + hdr.Name)
+		base := filepath.Base(name)
+		switch {
+		case base == archive.WhiteoutOpaqueDir:
+			hidden[filepath.Dir(name)] = true
+		case strings.HasPrefix(base, archive.WhiteoutPrefix):
+			hidden[filepath.Join(filepath.Dir(name), strings.TrimPrefix(base, archive.WhiteoutPrefix))] = true
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package simplify // import "github.com/docker/docker/daemon/simplify"
+
+import (
+	"archive/tar"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+// readExport returns the names of the entries of the tar stream rc, in
+// order, and the contents of its files.
+func readExport(t *testing.T, rc io.ReadCloser) ([]string, map[string]string) {
+	defer rc.Close()
+	var names []string
+	entries := make(map[string]string)
+	tr := tar.NewReader(rc)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return names, entries
+		}
+		assert.NilError(t, err)
+		b, err := ioutil.ReadAll(tr)
+		assert.NilError(t, err)
+		names = append(names, hdr.Name)
+		entries[hdr.Name] = string(b)
+	}
+}
+
+// exportStreams returns the root filesystem of a container of a simplified
+// image, which removed /etc/gone.conf and emptied /var, and the diff of its
+// writable layer.
+func exportStreams(t *testing.T) (io.ReadCloser, io.ReadCloser) {
+	rootfs, err := tarSource{
+		dir("bin/"), file("bin/sh"),
+		dir("etc/"), file("etc/rw.conf"),
+		dir("var/"), file("var/new"),
+	}.Open(context.Background())
+	assert.NilError(t, err)
+	diff, err := tarSource{
+		dir("etc/"), file("etc/rw.conf"), file("etc/.wh.gone.conf"),
+		dir("var/"), file("var/.wh..wh..opq"), file("var/new"),
+	}.Open(context.Background())
+	assert.NilError(t, err)
+	return rootfs, diff
+}
+
+func TestCompleteExport(t *testing.T) {
+	cache, err := ioutil.TempDir("", "simplify-export")
+	assert.NilError(t, err)
+	defer os.RemoveAll(cache)
+	for _, p := range []string{"bin/sh", "bin/ls", "etc/app.conf", "etc/gone.conf", "etc/rw.conf", "var/lib/old"} {
+		assert.NilError(t, os.MkdirAll(filepath.Join(cache, filepath.Dir(p)), 0755))
+		assert.NilError(t, ioutil.WriteFile(filepath.Join(cache, p), []byte("cache:"+p), 0644))
+	}
+
+	rootfs, diff := exportStreams(t)
+	names, entries := readExport(t, CompleteExport(rootfs, diff, cache, nil))
+	// whiteouts of the writable layer are not exported
+	assert.Check(t, is.DeepEqual(names, []string{
+		"bin/", "bin/sh", "etc/", "etc/rw.conf", "var/", "var/new",
+		"bin/ls", "etc/app.conf",
+	}))
+	// the root filesystem takes precedence
+	assert.Check(t, is.Equal(entries["etc/rw.conf"], "etc/rw.conf"))
+	assert.Check(t, is.Equal(entries["bin/ls"], "cache:bin/ls"))
+}
+
+func TestSparseExport(t *testing.T) {
+	rootfs, diff := exportStreams(t)
+	pruned := []string{"/usr/lib/libz.so", "/bin/sh", "/etc/gone.conf", "/var/lib/old", "/bin/ls"}
+	names, entries := readExport(t, SparseExport(rootfs, diff, pruned))
+	assert.Check(t, is.DeepEqual(names, []string{
+		"bin/", "bin/sh", "etc/", "etc/rw.conf", "var/", "var/new",
+		OmittedManifest,
+	}))
+	// files fetched on demand and files removed by the container are not
+	// omitted
+	assert.Check(t, is.Equal(entries[OmittedManifest], "/bin/ls\n/usr/lib/libz.so\n"))
+}
@@ -0,0 +1,822 @@
+// Package simplify materializes files pruned from a simplified image on
+// demand, fetching them from the layers of the full image it was derived
+// from.
+package simplify // import "github.com/docker/docker/daemon/simplify"
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/docker/docker/layer"
+	"github.com/docker/docker/pkg/archive"
+	"github.com/docker/docker/pkg/idtools"
+	"github.com/docker/docker/pkg/locker"
+	"github.com/docker/docker/pkg/system"
+	"github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// readyFile marks a cache whose directory tree has been fully prepared.
+const readyFile = "ready"
+
+// CacheRoot returns the directory under the daemon root holding the caches
+// of files fetched for simplified images.
+func CacheRoot(daemonRoot string) string {
+	return filepath.Join(daemonRoot, "simplify", "fetch")
+}
+
+// Source is a layer of the full image that pruned files are fetched from.
+type Source interface {
+	// DiffID returns the diff ID of the layer.
+	DiffID() layer.DiffID
+	// Open returns the uncompressed tar stream of the layer.
+	Open(ctx context.Context) (io.ReadCloser, error)
+}
+
+// IndexedSource is a Source whose entries can be read without scanning the
+// whole tar stream of the layer.
+type IndexedSource interface {
+	Source
+	// TOC returns the table of contents of the tar stream of the layer, or
+	// nil if it is not known.
+	TOC() *layer.TOC
+	// OpenEntry returns the tar stream of the layer starting at its n-th
+	// entry.
+	OpenEntry(ctx context.Context, n int) (io.ReadCloser, error)
+}
+
+// Fetcher fetches files missing from a simplified image into a cache
+// directory that is layered underneath the writable layer of every container
+// running from that image.
+type Fetcher struct {
+	root string
+	// sources are the layers of the full image, topmost first.
+	sources []Source
+	locker  *locker.Locker
+	// idMappings shift the owners of the entries of the full image to the
+	// host IDs the containers are remapped to, if set.
+	idMappings *idtools.IDMappings
+	// blobs shares the files fetched with the caches of other images, if
+	// set.
+	blobs *blobStore
+	// blobSources are tried for the content of regular files before the
+	// layers, if set.
+	blobSources *blobSources
+	// shared is set if the cache may be used by other daemons at once,
+	// through a shared file system.
+	shared bool
+
+	mu       sync.Mutex
+	prepared bool
+	// notify is called with the path of each file fetched or found in the
+	// cache, if set
+	notify func(p string)
+	// lock is held shared on the cache once prepared, if it is shared, so
+	// that other daemons do not evict it
+	lock *os.File
+}
+
+// NewFetcher returns a Fetcher caching files under root. sources are the
+// layers of the full image, topmost first.
+func NewFetcher(root string, sources []Source) *Fetcher {
+	return &Fetcher{
+		root:    root,
+		sources: sources,
+		locker:  locker.New(),
+	}
+}
+
+// Dir returns the directory holding the fetched files, which is layered
+// underneath the container's writable layer.
+func (f *Fetcher) Dir() string {
+	return filepath.Join(f.root, "fs")
+}
+
+func (f *Fetcher) tmpDir() string {
+	return filepath.Join(f.root, "tmp")
+}
+
+// Prepare creates every directory of the full image in the cache, so that
+// the overlay looks up missing files in it. It must complete before the
+// cache is mounted and is a no-op once it has succeeded. The cache is not
+// evicted until Close is called. A shared cache is prepared by a single
+// daemon at once.
+func (f *Fetcher) Prepare(ctx context.Context) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.prepared {
+		return nil
+	}
+	// 使用期间持有共享锁，其它容器和daemon可以同时使用，但不能淘汰
+	lock, err := lockCache(f.root, usedLock, lockShared, true)
+	if err != nil {
+		return errors.Wrap(err, "failed to lock simplify cache")
+	}
+	if f.shared {
+		prepare, err := lockCache(f.root, prepareLock, lockExclusive, true)
+		if err != nil {
+			lock.Close()
+			return errors.Wrap(err, "failed to lock simplify cache")
+		}
+		defer prepare.Close()
+	}
+	if err := f.prepare(ctx); err != nil {
+		lock.Close()
+		return err
+	}
+	f.lock = lock
+	return nil
+}
+
+// Close releases the lock Prepare holds on the cache, so that it may be
+// evicted. It is a no-op if the cache was not prepared.
+func (f *Fetcher) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.lock == nil {
+		return nil
+	}
+	err := f.lock.Close()
+	f.lock = nil
+	f.prepared = false
+	return err
+}
+
+// prepare is Prepare, once f.mu and the locks of the cache are held.
+func (f *Fetcher) prepare(ctx context.Context) error {
+	if _, err := os.Stat(filepath.Join(f.root, readyFile)); err == nil {
+		if !f.shared {
+			// 丢弃daemon上次停止时未完成的临时文件，它们会被重新拉取；
+			// 共享的缓存中它们可能属于其它daemon
+			if err := os.RemoveAll(f.tmpDir()); err != nil {
+				return err
+			}
+			if err := os.MkdirAll(f.tmpDir(), 0755); err != nil {
+				return err
+			}
+		}
+		f.prepared = true
+		return nil
+	}
+
+	// 上次准备未完成，重新开始
+	if err := os.RemoveAll(f.root); err != nil {
+		return err
+	}
+	for _, dir := range []string{f.Dir(), f.tmpDir()} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	// 缓存的根目录即容器的根目录，属于容器中的root
+	if err := f.chown(f.Dir(), &tar.Header{}); err != nil {
+		return err
+	}
+	// 从最底层开始，依次应用每一层的目录
+	for i := len(f.sources) - 1; i >= 0; i-- {
+		if err := f.prepareLayer(ctx, f.sources[i]); err != nil {
+			return errors.Wrap(err, "failed to prepare simplify cache")
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(f.root, readyFile), nil, 0644); err != nil {
+		return err
+	}
+	f.prepared = true
+	return nil
+}
+
+func (f *Fetcher) prepareLayer(ctx context.Context, src Source) error {
+	rc, err := src.Open(ctx)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	var (
+		dirs    []*tar.Header
+		removed []string
+	)
+	tr := tar.NewReader(rc)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		name := filepath.Clean("/" + hdr.Name)
+		base := filepath.Base(name)
+		switch {
+		case base == archive.WhiteoutOpaqueDir:
+			// 不透明目录会遮住下层的所有内容
+			entries, err := ioutil.ReadDir(filepath.Join(f.Dir(), filepath.Dir(name)))
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			for _, e := range entries {
+				removed = append(removed, filepath.Join(filepath.Dir(name), e.Name()))
+			}
+		case strings.HasPrefix(base, archive.WhiteoutPrefix):
+			removed = append(removed, filepath.Join(filepath.Dir(name), strings.TrimPrefix(base, archive.WhiteoutPrefix)))
+		case hdr.Typeflag == tar.TypeDir:
+			dirs = append(dirs, hdr)
+		default:
+			// 本层用文件替换了下层的目录
+			removed = append(removed, name)
+		}
+	}
+
+	// whiteout只作用于下层，因此先删除再创建本层的目录
+	for _, name := range removed {
+		if err := os.RemoveAll(filepath.Join(f.Dir(), name)); err != nil {
+			return err
+		}
+	}
+	for _, hdr := range dirs {
+		if err := os.MkdirAll(filepath.Join(f.Dir(), filepath.Clean("/"+hdr.Name)), 0755); err != nil {
+			return err
+		}
+	}
+	// 创建子目录会改变上级目录的修改时间，因此全部创建之后再应用元数据
+	for _, hdr := range dirs {
+		if err := f.applyHeader(filepath.Join(f.Dir(), filepath.Clean("/"+hdr.Name)), hdr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Notify sets fn to be called with the path, inside the container's rootfs,
+// of each file fetched into the cache, or looked up and found there.
+func (f *Fetcher) Notify(fn func(p string)) {
+	f.mu.Lock()
+	f.notify = fn
+	f.mu.Unlock()
+}
+
+// notified passes p to the function set with Notify, if any.
+func (f *Fetcher) notified(p string) {
+	f.mu.Lock()
+	fn := f.notify
+	f.mu.Unlock()
+	if fn != nil {
+		fn(p)
+	}
+}
+
+// Fetch materializes the file at p, a path inside the container's rootfs,
+// in the cache. It returns an error satisfying os.IsNotExist if no layer of
+// the full image contains p.
+func (f *Fetcher) Fetch(ctx context.Context, p string) error {
+	_, _, err := f.fetch(ctx, p)
+	return err
+}
+
+// fetch is Fetch, returning the size of the file and where it was found:
+// FetchSourceCache if it was in the cache already, or in the blob store.
+func (f *Fetcher) fetch(ctx context.Context, p string) (size int64, from string, retErr error) {
+	p = filepath.Clean("/" + p)
+	defer func() {
+		if retErr == nil {
+			f.notified(p)
+		}
+	}()
+	f.locker.Lock(p)
+	defer f.locker.Unlock(p)
+
+	target := filepath.Join(f.Dir(), p)
+	if fi, err := os.Lstat(target); err == nil {
+		return fi.Size(), FetchSourceCache, nil
+	}
+	// 在目录中新建条目会改变目录的修改时间，之后恢复为完整镜像中的时间
+	if dir, err := os.Lstat(filepath.Dir(target)); err == nil {
+		defer system.Chtimes(filepath.Dir(target), accessTime(dir), dir.ModTime())
+	}
+	for i, src := range f.sources {
+		found, stop, from, err := f.fetchFrom(ctx, src, p, target)
+		if err != nil {
+			return 0, "", errors.Wrapf(err, "failed to fetch %s", p)
+		}
+		if found {
+			fi, err := os.Lstat(target)
+			if err != nil {
+				return 0, "", err
+			}
+			f.linkGroup(i, p, target)
+			return fi.Size(), from, nil
+		}
+		if stop {
+			break
+		}
+	}
+	return 0, "", &os.PathError{Op: "fetch", Path: p, Err: syscall.ENOENT}
+}
+
+// linkGroup links target, the file fetched for p from the i-th layer of the
+// full image, to the other names of its hard link group in the table of
+// contents of the layer, as the layer links them, so that they share its
+// content rather than being fetched again as copies. Each name appears
+// whole or not at all. Names the cache has, or that the layers above hide
+// or replace, are skipped, as are all of them if a layer above has no table
+// of contents to tell.
+func (f *Fetcher) linkGroup(i int, p, target string) {
+	is, ok := f.sources[i].(IndexedSource)
+	if !ok || is.TOC() == nil {
+		return
+	}
+	toc := is.TOC()
+	n, _ := toc.Lookup(p)
+	if n < 0 {
+		return
+	}
+	for _, m := range toc.LinkGroup(n) {
+		name := filepath.Clean("/" + toc.Entries[m].Name)
+		if name == p || !f.visible(i, name) {
+			continue
+		}
+		link := filepath.Join(f.Dir(), name)
+		if err := os.MkdirAll(filepath.Dir(link), 0755); err != nil {
+			return
+		}
+		if err := os.Link(target, link); err != nil && !os.IsExist(err) {
+			logrus.WithError(err).WithField("path", name).Debug("failed to link simplify fetch to its hard link group")
+		}
+	}
+}
+
+// visible returns true if the entry for p in the i-th layer of the full
+// image is the one the image has, as far as the tables of contents of the
+// layers above tell.
+func (f *Fetcher) visible(i int, p string) bool {
+	for _, src := range f.sources[:i] {
+		is, ok := src.(IndexedSource)
+		if !ok || is.TOC() == nil {
+			return false
+		}
+		if n, hidden := is.TOC().Lookup(p); n >= 0 || hidden {
+			return false
+		}
+	}
+	return true
+}
+
+// fetchFrom looks for p in a single layer. stop is true if the layer hides
+// p in every layer beneath it, and from tells where the file was found: in
+// the blob store or a blob source rather than read from the layer.
+func (f *Fetcher) fetchFrom(ctx context.Context, src Source, p, target string) (found, stop bool, from string, _ error) {
+	if is, ok := src.(IndexedSource); ok {
+		if toc := is.TOC(); toc != nil {
+			return f.fetchIndexed(ctx, is, toc, p, target)
+		}
+	}
+	found, stop, err := f.fetchStream(ctx, src, p, target)
+	return found, stop, FetchSourceImage, err
+}
+
+// fetchStream looks for p in the tar stream of a layer. The file is only
+// moved into the cache once the whole stream matches the diff ID of the
+// layer.
+func (f *Fetcher) fetchStream(ctx context.Context, src Source, p, target string) (found, stop bool, _ error) {
+	rc, err := src.Open(ctx)
+	if err != nil {
+		return false, false, err
+	}
+	defer rc.Close()
+	vr := newVerifiedReader(rc, src.DiffID())
+
+	// p及其所有上级目录的whiteout，以及其上级目录中的不透明标记
+	whiteouts := make(map[string]bool)
+	opaques := make(map[string]bool)
+	for a := p; a != "/"; a = filepath.Dir(a) {
+		whiteouts[filepath.Join(filepath.Dir(a), archive.WhiteoutPrefix+filepath.Base(a))] = true
+		opaques[filepath.Join(filepath.Dir(a), archive.WhiteoutOpaqueDir)] = true
+	}
+
+	tr := tar.NewReader(vr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return false, stop, nil
+		}
+		if err != nil {
+			return false, false, err
+		}
+		name := filepath.Clean("/" + hdr.Name)
+		switch {
+		case name == p && hdr.Typeflag == tar.TypeLink:
+			// 硬链接的内容在其目标条目中，目标总是出现在同一层的前面
+			return true, true, f.fetchLink(ctx, src, hdr.Linkname, target)
+		case name == p:
+			return true, true, f.extract(target, hdr, tr, vr.verify)
+		case whiteouts[name]:
+			return false, true, nil
+		case opaques[name]:
+			stop = true
+		}
+	}
+}
+
+// fetchLink extracts the entry linkname of src, the target of a hard link,
+// to target.
+func (f *Fetcher) fetchLink(ctx context.Context, src Source, linkname, target string) error {
+	rc, err := src.Open(ctx)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	vr := newVerifiedReader(rc, src.DiffID())
+
+	linkname = filepath.Clean("/" + linkname)
+	tr := tar.NewReader(vr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return errors.Errorf("target %s of hard link not found in layer %s", linkname, src.DiffID())
+		}
+		if err != nil {
+			return err
+		}
+		if filepath.Clean("/"+hdr.Name) == linkname && hdr.Typeflag != tar.TypeLink {
+			return f.extract(target, hdr, tr, vr.verify)
+		}
+	}
+}
+
+// fetchIndexed looks for p in a layer using its table of contents, reading
+// only the entry extracted. Entries without a digest to verify their
+// content against are read from the whole tar stream of the layer instead.
+// Regular files with a digest are looked up in the blob store first, then
+// in the blob sources, and added to the blob store once fetched.
+func (f *Fetcher) fetchIndexed(ctx context.Context, src IndexedSource, toc *layer.TOC, p, target string) (found, stop bool, from string, _ error) {
+	n, hidden := toc.Lookup(p)
+	if n < 0 {
+		return false, hidden, "", nil
+	}
+	if e := toc.Entries[n]; e.Type == tar.TypeLink {
+		// 硬链接的内容在其目标条目中
+		if n = toc.Index(e.Linkname); n < 0 {
+			return false, false, "", errors.Errorf("target %s of hard link not found in layer %s", e.Linkname, src.DiffID())
+		}
+	}
+	e := toc.Entries[n]
+	regular := e.Type == tar.TypeReg || e.Type == tar.TypeRegA
+	if e.Digest == "" && regular {
+		found, stop, err := f.fetchStream(ctx, src, p, target)
+		return found, stop, FetchSourceImage, err
+	}
+	if regular && e.Mode != 0 && f.linkBlob(e, target) {
+		return true, true, FetchSourceCache, nil
+	}
+	// 对端按逻辑大小返回内容，稀疏文件的空洞也会被传输，因此只从层中读取其数据
+	if regular && e.Mode != 0 && !e.Sparse && f.fetchBlob(ctx, e, target) {
+		return true, true, FetchSourcePeer, nil
+	}
+
+	rc, err := src.OpenEntry(ctx, n)
+	if err != nil {
+		return false, false, "", err
+	}
+	defer rc.Close()
+
+	tr := tar.NewReader(rc)
+	hdr, err := tr.Next()
+	if err != nil {
+		return false, false, "", err
+	}
+	if hdr.Name != e.Name {
+		return false, false, "", errors.Errorf("table of contents of layer %s does not match: found %s instead of %s", src.DiffID(), hdr.Name, e.Name)
+	}
+	var (
+		r      io.Reader = tr
+		verify func() error
+	)
+	if e.Digest != "" {
+		verifier := e.Digest.Verifier()
+		r = io.TeeReader(tr, verifier)
+		verify = func() error {
+			if !verifier.Verified() {
+				return VerificationError{Name: e.Name, Layer: src.DiffID(), Expected: e.Digest}
+			}
+			return nil
+		}
+	}
+	if err := f.extract(target, hdr, r, verify); err != nil {
+		return true, true, FetchSourceImage, err
+	}
+	if regular {
+		f.storeBlob(e.Digest, hdr, target)
+	}
+	return true, true, FetchSourceImage, nil
+}
+
+// linkBlob links the file of the blob store matching e, a regular file of
+// the table of contents of a layer, to target. It returns false if the
+// store does not have it.
+func (f *Fetcher) linkBlob(e layer.TOCEntry, target string) bool {
+	if f.blobs == nil {
+		return false
+	}
+	blob, err := f.blobs.path(e.Digest, entryHeader(e), f.idMappings)
+	if err != nil {
+		return false
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return false
+	}
+	if err := os.Link(blob, target); err != nil {
+		// 链接数达到上限等情况下重新拉取
+		if !os.IsNotExist(err) {
+			logrus.WithError(err).WithField("blob", blob).Debug("failed to link simplify blob")
+		}
+		return false
+	}
+	return true
+}
+
+// fetchBlob fetches the content of e, a regular file of the table of
+// contents of a layer, to target from the blob sources, such as the caches
+// of peers. It returns false if none of them returns content matching the
+// digest of e.
+func (f *Fetcher) fetchBlob(ctx context.Context, e layer.TOCEntry, target string) bool {
+	hdr := entryHeader(e)
+	for _, src := range f.blobSources.get() {
+		rc, err := src.OpenBlob(ctx, e.Digest)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				logrus.WithError(err).WithField("blob", e.Digest).Debug("failed to open simplify blob source")
+			}
+			continue
+		}
+		verifier := e.Digest.Verifier()
+		// 来源不可信，内容以目录中的大小和digest为准
+		r := io.TeeReader(io.LimitReader(rc, e.Size), verifier)
+		err = f.extract(target, hdr, r, func() error {
+			if !verifier.Verified() {
+				return errors.Errorf("content of %s does not match %s", e.Name, e.Digest)
+			}
+			return nil
+		})
+		rc.Close()
+		if err != nil {
+			logrus.WithError(err).WithField("blob", e.Digest).Debug("failed to fetch from simplify blob source")
+			continue
+		}
+		peerHits.Inc()
+		f.storeBlob(e.Digest, hdr, target)
+		return true
+	}
+	return false
+}
+
+// entryHeader returns the header of e, a regular file of the table of
+// contents of a layer, for its content to be extracted without reading the
+// layer.
+func entryHeader(e layer.TOCEntry) *tar.Header {
+	return &tar.Header{Name: e.Name, Typeflag: e.Type, Mode: e.Mode, Uid: e.UID, Gid: e.GID, Size: e.Size, ModTime: e.ModTime, Devmajor: e.Devmajor, Devminor: e.Devminor, Xattrs: e.Xattrs}
+}
+
+// storeBlob adds the file fetched to target, whose content was verified to
+// match dgst, to the blob store, for the caches of other images to link to.
+// The file stays in the cache of the image if it cannot be stored.
+func (f *Fetcher) storeBlob(dgst digest.Digest, hdr *tar.Header, target string) {
+	if f.blobs == nil {
+		return
+	}
+	blob, err := f.blobs.path(dgst, hdr, f.idMappings)
+	if err == nil {
+		err = f.blobs.add(target, blob)
+	}
+	if err != nil {
+		logrus.WithError(err).WithField("path", target).Debug("failed to store simplify blob")
+	}
+}
+
+// extract writes the entry read from r to target. If verify is set, it is
+// called once the content was read and the entry is only moved in if it
+// returns nil.
+func (f *Fetcher) extract(target string, hdr *tar.Header, r io.Reader, verify func() error) error {
+	if verify == nil {
+		verify = func() error { return nil }
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		if err := verify(); err != nil {
+			return err
+		}
+		if err := os.Mkdir(target, 0755); err != nil && !os.IsExist(err) {
+			return err
+		}
+	case tar.TypeReg, tar.TypeRegA, tar.TypeGNUSparse:
+		// 先写到缓存之外的临时文件，完成后再移入，避免容器看到不完整的文件
+		tmp, err := ioutil.TempFile(f.tmpDir(), "fetch-")
+		if err != nil {
+			return err
+		}
+		if archive.IsSparse(hdr) {
+			// 空洞不写入，缓存中的文件同样是稀疏的
+			_, err = archive.CopySparse(tmp, r)
+		} else {
+			_, err = io.Copy(tmp, r)
+		}
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+			return err
+		}
+		if err := verify(); err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+			return err
+		}
+		// 移入前落盘，daemon停止或主机掉电后缓存中不会留下截断的文件
+		if err := tmp.Sync(); err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+			return err
+		}
+		if err := tmp.Close(); err != nil {
+			os.Remove(tmp.Name())
+			return err
+		}
+		if err := f.applyHeader(tmp.Name(), hdr); err != nil {
+			os.Remove(tmp.Name())
+			return err
+		}
+		if err := os.Rename(tmp.Name(), target); err != nil {
+			os.Remove(tmp.Name())
+			return err
+		}
+		return nil
+	case tar.TypeSymlink:
+		if err := verify(); err != nil {
+			return err
+		}
+		if err := os.Symlink(hdr.Linkname, target); err != nil {
+			if !os.IsExist(err) {
+				return err
+			}
+			// 共享的缓存中其它daemon可能同时拉取了同一个链接
+			if l, lerr := os.Readlink(target); lerr != nil || l != hdr.Linkname {
+				return err
+			}
+		}
+		if err := f.chown(target, hdr); err != nil {
+			return err
+		}
+		if err := setXattrs(target, hdr.Xattrs); err != nil {
+			return err
+		}
+		return setModTime(target, hdr)
+	case tar.TypeChar, tar.TypeBlock, tar.TypeFifo:
+		if err := verify(); err != nil {
+			return err
+		}
+		if err := mknod(target, hdr); err != nil && !os.IsExist(err) {
+			return &os.PathError{Op: "mknod", Path: target, Err: err}
+		}
+	default:
+		return fmt.Errorf("unsupported entry type %q", hdr.Typeflag)
+	}
+	return f.applyHeader(target, hdr)
+}
+
+// selinuxXattr is the extended attribute holding the SELinux label of a
+// file. It is never set on the files of the cache, nor read back from
+// them: the container sees them with its mount label, which its overlay
+// mount applies to all of its files.
+const selinuxXattr = "security.selinux"
+
+// applyHeader sets the ownership, mode, extended attributes and
+// modification time recorded in hdr on path. The extended attributes are
+// set after the owner, as changing the owner of a file drops its
+// capabilities.
+func (f *Fetcher) applyHeader(path string, hdr *tar.Header) error {
+	if err := f.chown(path, hdr); err != nil {
+		return err
+	}
+	if err := os.Chmod(path, hdr.FileInfo().Mode()); err != nil {
+		return err
+	}
+	if err := setXattrs(path, hdr.Xattrs); err != nil {
+		return err
+	}
+	return setModTime(path, hdr)
+}
+
+// setModTime sets the modification time recorded in hdr on path, without
+// following symlinks, unless it is not known. The access time is set to
+// now, which is when the file was fetched as far as eviction is concerned.
+func setModTime(path string, hdr *tar.Header) error {
+	if hdr.ModTime.IsZero() {
+		return nil
+	}
+	if hdr.Typeflag != tar.TypeSymlink {
+		return system.Chtimes(path, time.Now(), hdr.ModTime)
+	}
+	ts := []syscall.Timespec{syscall.NsecToTimespec(time.Now().UnixNano()), syscall.NsecToTimespec(hdr.ModTime.UnixNano())}
+	if err := system.LUtimesNano(path, ts); err != nil && err != system.ErrNotSupportedPlatform {
+		return &os.PathError{Op: "lutimes", Path: path, Err: err}
+	}
+	return nil
+}
+
+// chown sets the ownership recorded in hdr on path, shifted to the host IDs
+// of f.idMappings as the graphdriver does for the layers of the image.
+func (f *Fetcher) chown(path string, hdr *tar.Header) error {
+	ids := idtools.IDPair{UID: hdr.Uid, GID: hdr.Gid}
+	if f.idMappings != nil && !f.idMappings.Empty() {
+		var err error
+		if ids, err = f.idMappings.ToHost(ids); err != nil {
+			return err
+		}
+	}
+	return os.Lchown(path, ids.UID, ids.GID)
+}
+
+// VerificationError is returned when content fetched for a simplified image
+// does not match the digest it was recorded with, which happens if the
+// registry or the layer store returned tampered or corrupted data.
+type VerificationError struct {
+	// Name is the entry read, or "" if the whole layer was.
+	Name string
+	// Layer is the diff ID of the layer read.
+	Layer layer.DiffID
+	// Expected is the digest the content should have had.
+	Expected digest.Digest
+}
+
+func (e VerificationError) Error() string {
+	if e.Name == "" {
+		return fmt.Sprintf("content verification failed for layer %s", e.Layer)
+	}
+	return fmt.Sprintf("content verification failed for %s in layer %s", e.Name, e.Layer)
+}
+
+// IsVerificationError returns true if err was caused by fetched content not
+// matching its digest.
+func IsVerificationError(err error) bool {
+	_, ok := errors.Cause(err).(VerificationError)
+	return ok
+}
+
+// CredentialsError is returned by sources when the registry rejects the
+// credentials a layer is fetched with, even once authenticated again.
+// Fetching the layer again fails until the credentials are updated.
+type CredentialsError struct {
+	// Repository is the repository the layer is fetched from.
+	Repository string
+	Err        error
+}
+
+func (e CredentialsError) Error() string {
+	return fmt.Sprintf("registry rejected the credentials for %s, pull the image again to update them: %v", e.Repository, e.Err)
+}
+
+// IsCredentialsError returns true if err was caused by the registry
+// rejecting the credentials of a fetch.
+func IsCredentialsError(err error) bool {
+	_, ok := errors.Cause(err).(CredentialsError)
+	return ok
+}
+
+// verifiedReader digests the tar stream of a layer as it is read.
+type verifiedReader struct {
+	r        io.Reader
+	diffID   layer.DiffID
+	verifier digest.Verifier
+}
+
+func newVerifiedReader(r io.Reader, diffID layer.DiffID) *verifiedReader {
+	verifier := digest.Digest(diffID).Verifier()
+	return &verifiedReader{r: io.TeeReader(r, verifier), diffID: diffID, verifier: verifier}
+}
+
+func (v *verifiedReader) Read(p []byte) (int, error) {
+	return v.r.Read(p)
+}
+
+// verify reads the rest of the stream and returns an error if the whole of
+// it does not match the diff ID of the layer.
+func (v *verifiedReader) verify() error {
+	if _, err := io.Copy(ioutil.Discard, v.r); err != nil {
+		return err
+	}
+	if !v.verifier.Verified() {
+		return VerificationError{Layer: v.diffID, Expected: digest.Digest(v.diffID)}
+	}
+	return nil
+}
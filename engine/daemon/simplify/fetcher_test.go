@@ -0,0 +1,671 @@
+package simplify // import "github.com/docker/docker/daemon/simplify"
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/internal/testutil"
+	"github.com/docker/docker/layer"
+	"github.com/docker/docker/pkg/idtools"
+	"github.com/docker/docker/pkg/system"
+	"github.com/opencontainers/go-digest"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+type tarSource []*tar.Header
+
+func (s tarSource) DiffID() layer.DiffID {
+	b, err := s.tar()
+	if err != nil {
+		panic(err)
+	}
+	return layer.DiffID(digest.FromBytes(b))
+}
+
+func (s tarSource) Open(ctx context.Context) (io.ReadCloser, error) {
+	b, err := s.tar()
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(bytes.NewReader(b)), nil
+}
+
+func (s tarSource) tar() ([]byte, error) {
+	return s.build(func(name string) string { return name })
+}
+
+// build returns the tar stream of the layer with content returning the
+// content of each regular file.
+func (s tarSource) build(content func(name string) string) ([]byte, error) {
+	buf := bytes.NewBuffer(nil)
+	tw := tar.NewWriter(buf)
+	for _, hdr := range s {
+		if err := tw.WriteHeader(hdr); err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			if _, err := tw.Write([]byte(content(hdr.Name))); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func dir(name string) *tar.Header {
+	return &tar.Header{Name: name, Typeflag: tar.TypeDir, Mode: 0755}
+}
+
+func file(name string) *tar.Header {
+	return &tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0640, Size: int64(len(name))}
+}
+
+func newTestFetcher(t *testing.T) (*Fetcher, func()) {
+	if os.Getuid() != 0 {
+		t.Skip("requires root to preserve ownership")
+	}
+	root, err := ioutil.TempDir("", "simplify-fetch")
+	assert.NilError(t, err)
+
+	f := NewFetcher(filepath.Join(root, "cache"), []Source{
+		// top
+		tarSource{dir("etc/"), file("etc/.wh.removed.conf"), dir("usr/"), file("usr/.wh..wh..opq"), dir("usr/bin/"), file("usr/bin/app")},
+		// bottom
+		tarSource{dir("etc/"), file("etc/app.conf"), file("etc/removed.conf"), dir("usr/"), dir("usr/lib/"), file("usr/lib/libold.so")},
+	})
+	assert.NilError(t, f.Prepare(context.Background()))
+	return f, func() { os.RemoveAll(root) }
+}
+
+func TestFetcherPrepare(t *testing.T) {
+	f, cleanup := newTestFetcher(t)
+	defer cleanup()
+
+	fi, err := os.Stat(filepath.Join(f.Dir(), "usr/bin"))
+	assert.NilError(t, err)
+	assert.Check(t, fi.IsDir())
+
+	// usr/lib is hidden by the opaque usr/ in the top layer
+	_, err = os.Stat(filepath.Join(f.Dir(), "usr/lib"))
+	assert.Check(t, os.IsNotExist(err))
+
+	// files are only fetched on demand
+	_, err = os.Stat(filepath.Join(f.Dir(), "etc/app.conf"))
+	assert.Check(t, os.IsNotExist(err))
+}
+
+func TestFetcherFetch(t *testing.T) {
+	f, cleanup := newTestFetcher(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	assert.NilError(t, f.Fetch(ctx, "/etc/app.conf"))
+	b, err := ioutil.ReadFile(filepath.Join(f.Dir(), "etc/app.conf"))
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(string(b), "etc/app.conf"))
+	fi, err := os.Stat(filepath.Join(f.Dir(), "etc/app.conf"))
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(fi.Mode().Perm(), os.FileMode(0640)))
+
+	// fetching again is a no-op
+	assert.NilError(t, f.Fetch(ctx, "/etc/app.conf"))
+
+	assert.NilError(t, f.Fetch(ctx, "/usr/bin/app"))
+
+	for _, p := range []string{"/etc/removed.conf", "/usr/lib/libold.so", "/etc/missing.conf"} {
+		err := f.Fetch(ctx, p)
+		assert.Check(t, os.IsNotExist(err), "%s: %v", p, err)
+	}
+}
+
+func TestFetcherPrefetch(t *testing.T) {
+	f, cleanup := newTestFetcher(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	assert.NilError(t, f.Fetch(ctx, "/usr/bin/app"))
+	assert.NilError(t, ioutil.WriteFile(filepath.Join(f.Dir(), "usr/bin/app"), []byte("fetched on demand"), 0640))
+
+	assert.Check(t, !f.Materialized())
+	res, err := f.Prefetch(ctx, PrefetchOptions{})
+	assert.NilError(t, err)
+	assert.Check(t, f.Materialized())
+	assert.Check(t, is.DeepEqual(res, PrefetchResult{Files: 1, Bytes: int64(len("etc/app.conf"))}))
+
+	_, err = os.Stat(filepath.Join(f.Dir(), "etc/app.conf"))
+	assert.NilError(t, err)
+
+	// whited out and opaque-hidden files are not materialized
+	for _, p := range []string{"etc/removed.conf", "usr/lib/libold.so"} {
+		_, err := os.Stat(filepath.Join(f.Dir(), p))
+		assert.Check(t, os.IsNotExist(err), p)
+	}
+
+	// files fetched on demand are not downloaded again
+	b, err := ioutil.ReadFile(filepath.Join(f.Dir(), "usr/bin/app"))
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(string(b), "fetched on demand"))
+}
+
+func TestFetcherPrefetchPaths(t *testing.T) {
+	f, cleanup := newTestFetcher(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	_, err := f.Prefetch(ctx, PrefetchOptions{Patterns: []string{"/etc/["}})
+	assert.Check(t, is.ErrorContains(err, "invalid prefetch path"))
+
+	// directories matching a pattern are prefetched whole
+	res, err := f.Prefetch(ctx, PrefetchOptions{Patterns: []string{"/etc/*.conf", "usr/bin"}})
+	assert.NilError(t, err)
+	assert.Check(t, is.DeepEqual(res, PrefetchResult{Files: 2, Bytes: int64(len("etc/app.conf") + len("usr/bin/app"))}))
+	assert.Check(t, !f.Materialized())
+
+	// the rest of the image is prefetched once the paths are
+	res, err = f.Prefetch(ctx, PrefetchOptions{})
+	assert.NilError(t, err)
+	assert.Check(t, is.DeepEqual(res, PrefetchResult{}))
+	assert.Check(t, f.Materialized())
+	res, err = f.Prefetch(ctx, PrefetchOptions{Patterns: []string{"/etc/*.conf"}})
+	assert.NilError(t, err)
+	assert.Check(t, is.DeepEqual(res, PrefetchResult{}))
+}
+
+// indexedSource records the entries read using its table of contents.
+type indexedSource struct {
+	tarSource
+	toc    *layer.TOC
+	opened []int
+}
+
+func newIndexedSource(t *testing.T, s tarSource) *indexedSource {
+	rc, err := s.Open(context.Background())
+	assert.NilError(t, err)
+	toc, err := layer.BuildTOC(rc, nil)
+	assert.NilError(t, err)
+	return &indexedSource{tarSource: s, toc: toc}
+}
+
+func (s *indexedSource) TOC() *layer.TOC {
+	return s.toc
+}
+
+func (s *indexedSource) OpenEntry(ctx context.Context, n int) (io.ReadCloser, error) {
+	s.opened = append(s.opened, n)
+	rc, err := s.tarSource.Open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(bytes.NewReader(b[s.toc.Entries[n].Offset:])), nil
+}
+
+func TestFetcherFetchIndexed(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("requires root to preserve ownership")
+	}
+	root, err := ioutil.TempDir("", "simplify-fetch")
+	assert.NilError(t, err)
+	defer os.RemoveAll(root)
+
+	link := &tar.Header{Name: "usr/bin/alias", Typeflag: tar.TypeLink, Linkname: "usr/bin/app", Mode: 0755}
+	top := newIndexedSource(t, tarSource{dir("etc/"), file("etc/.wh.removed.conf"), dir("usr/"), dir("usr/bin/"), file("usr/bin/app"), link})
+	bottom := newIndexedSource(t, tarSource{dir("etc/"), file("etc/app.conf"), file("etc/removed.conf")})
+	f := NewFetcher(filepath.Join(root, "cache"), []Source{top, bottom})
+	ctx := context.Background()
+	assert.NilError(t, f.Prepare(ctx))
+
+	assert.NilError(t, f.Fetch(ctx, "/etc/app.conf"))
+	b, err := ioutil.ReadFile(filepath.Join(f.Dir(), "etc/app.conf"))
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(string(b), "etc/app.conf"))
+	// only the entry fetched is read
+	assert.Check(t, is.Len(top.opened, 0))
+	assert.Check(t, is.DeepEqual(bottom.opened, []int{1}))
+
+	err = f.Fetch(ctx, "/etc/removed.conf")
+	assert.Check(t, os.IsNotExist(err), "%v", err)
+	assert.Check(t, is.DeepEqual(bottom.opened, []int{1}))
+
+	// content not matching the table of contents is not cached
+	good := top.toc.Entries[4].Digest
+	top.toc.Entries[4].Digest = digest.FromString("other")
+	err = f.Fetch(ctx, "/usr/bin/app")
+	assert.Check(t, is.ErrorContains(err, "verification failed"))
+	_, err = os.Stat(filepath.Join(f.Dir(), "usr/bin/app"))
+	assert.Check(t, os.IsNotExist(err))
+	top.toc.Entries[4].Digest = good
+
+	// hard links get the content of their target, which is linked with them
+	assert.NilError(t, f.Fetch(ctx, "/usr/bin/alias"))
+	b, err = ioutil.ReadFile(filepath.Join(f.Dir(), "usr/bin/alias"))
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(string(b), "usr/bin/app"))
+	_, err = os.Stat(filepath.Join(f.Dir(), "usr/bin/app"))
+	assert.NilError(t, err)
+}
+
+func TestFetcherFetchSharedBlob(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("requires root to preserve ownership")
+	}
+	root, err := ioutil.TempDir("", "simplify-fetch")
+	assert.NilError(t, err)
+	defer os.RemoveAll(root)
+
+	blobs := newBlobStore(root)
+	owned := file("etc/owned.conf")
+	owned.Uid = 1000
+	first := newIndexedSource(t, tarSource{dir("etc/"), file("etc/app.conf"), owned})
+	// the same files at other offsets of another layer
+	second := newIndexedSource(t, tarSource{dir("etc/"), file("etc/other.conf"), file("etc/app.conf"), file("etc/owned.conf")})
+	ctx := context.Background()
+	var fetchers []*Fetcher
+	for _, src := range []Source{first, second} {
+		f := NewFetcher(filepath.Join(root, fmt.Sprintf("image%d", len(fetchers))), []Source{src})
+		f.blobs = blobs
+		assert.NilError(t, f.Prepare(ctx))
+		fetchers = append(fetchers, f)
+	}
+
+	_, from, err := fetchers[0].fetch(ctx, "/etc/app.conf")
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(from, FetchSourceImage))
+	// a file fetched for one image is found in the blob store for the other
+	_, from, err = fetchers[1].fetch(ctx, "/etc/app.conf")
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(from, FetchSourceCache))
+	assert.Check(t, is.Len(second.opened, 0))
+	fi0, err := os.Stat(filepath.Join(fetchers[0].Dir(), "etc/app.conf"))
+	assert.NilError(t, err)
+	fi1, err := os.Stat(filepath.Join(fetchers[1].Dir(), "etc/app.conf"))
+	assert.NilError(t, err)
+	assert.Check(t, os.SameFile(fi0, fi1))
+	assert.Check(t, is.Equal(fi1.Mode().Perm(), os.FileMode(0640)))
+
+	// files owned by other users are not shared
+	assert.NilError(t, fetchers[0].Fetch(ctx, "/etc/owned.conf"))
+	_, from, err = fetchers[1].fetch(ctx, "/etc/owned.conf")
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(from, FetchSourceImage))
+	assert.Check(t, is.DeepEqual(second.opened, []int{3}))
+	fi, err := os.Stat(filepath.Join(fetchers[1].Dir(), "etc/owned.conf"))
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(fi.Sys().(*syscall.Stat_t).Uid, uint32(0)))
+
+	// the blob is kept as long as a cache links to it
+	assert.NilError(t, os.RemoveAll(filepath.Join(root, "image0")))
+	freed, err := PruneBlobs(root)
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(freed, int64(len("etc/owned.conf"))))
+	assert.NilError(t, os.RemoveAll(filepath.Join(root, "image1")))
+	freed, err = PruneBlobs(root)
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(freed, int64(len("etc/app.conf")+len("etc/owned.conf"))))
+	files, total, err := scanCaches(root)
+	assert.NilError(t, err)
+	assert.Check(t, is.Len(files, 0))
+	assert.Check(t, is.Equal(total, int64(0)))
+}
+
+// capNetRaw is the security.capability extended attribute of a binary with
+// the CAP_NET_RAW capability, such as ping.
+var capNetRaw = string([]byte{0x01, 0x00, 0x00, 0x02, 0x00, 0x20, 0x00, 0x00, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0})
+
+// TestFetcherFetchXattrs fetches a binary carrying file capabilities, left
+// out of a simplified image, and checks that it keeps them, along with its
+// other extended attributes.
+func TestFetcherFetchXattrs(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("requires root to preserve ownership")
+	}
+	root, err := ioutil.TempDir("", "simplify-fetch")
+	assert.NilError(t, err)
+	defer os.RemoveAll(root)
+
+	blobs := newBlobStore(root)
+	ping := file("bin/ping")
+	ping.Mode = 0755
+	ping.Xattrs = map[string]string{"security.capability": capNetRaw, "user.origin": "image", selinuxXattr: "system_u:object_r:bin_t:s0"}
+	first := newIndexedSource(t, tarSource{dir("bin/"), ping})
+	// the same binary without capabilities
+	plain := file("bin/ping")
+	plain.Mode = 0755
+	second := newIndexedSource(t, tarSource{dir("bin/"), plain})
+	ctx := context.Background()
+	var fetchers []*Fetcher
+	for _, src := range []Source{first, second} {
+		f := NewFetcher(filepath.Join(root, fmt.Sprintf("image%d", len(fetchers))), []Source{src})
+		f.blobs = blobs
+		assert.NilError(t, f.Prepare(ctx))
+		fetchers = append(fetchers, f)
+	}
+
+	assert.NilError(t, fetchers[0].Fetch(ctx, "/bin/ping"))
+	target := filepath.Join(fetchers[0].Dir(), "bin/ping")
+	xattrs, err := listXattrs(target)
+	assert.NilError(t, err)
+	// the label comes from the mount of the container
+	assert.Check(t, is.DeepEqual(xattrs, map[string]string{"security.capability": capNetRaw, "user.origin": "image"}))
+
+	// files with other extended attributes are not shared
+	_, from, err := fetchers[1].fetch(ctx, "/bin/ping")
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(from, FetchSourceImage))
+	xattrs, err = listXattrs(filepath.Join(fetchers[1].Dir(), "bin/ping"))
+	assert.NilError(t, err)
+	assert.Check(t, is.Len(xattrs, 0))
+
+	// they are committed along with the file
+	buf := bytes.NewBuffer(nil)
+	tw := tar.NewWriter(buf)
+	assert.NilError(t, addCacheEntry(tw, fetchers[0].Dir(), "/bin/ping", nil))
+	assert.NilError(t, tw.Close())
+	hdr, err := tar.NewReader(buf).Next()
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(hdr.Xattrs["security.capability"], capNetRaw))
+	assert.Check(t, is.Equal(hdr.Xattrs["user.origin"], "image"))
+}
+
+func TestFetcherFetchMetadata(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("requires root to create devices")
+	}
+	root, err := ioutil.TempDir("", "simplify-fetch")
+	assert.NilError(t, err)
+	defer os.RemoveAll(root)
+
+	mtime := time.Unix(1500000000, 0)
+	dev := dir("dev/")
+	dev.ModTime = mtime
+	data := &tar.Header{Name: "var/lib/postgresql/data/", Typeflag: tar.TypeDir, Mode: 0700, Uid: 70, Gid: 70, ModTime: mtime}
+	su := file("bin/su")
+	su.Mode, su.ModTime = 04755, mtime
+	link := &tar.Header{Name: "bin/sh", Typeflag: tar.TypeSymlink, Linkname: "busybox", ModTime: mtime}
+	f := NewFetcher(filepath.Join(root, "cache"), []Source{tarSource{
+		dir("bin/"), su, link, dev,
+		&tar.Header{Name: "dev/null", Typeflag: tar.TypeChar, Mode: 0666, Devmajor: 1, Devminor: 3, ModTime: mtime},
+		&tar.Header{Name: "dev/initctl", Typeflag: tar.TypeFifo, Mode: 0600, ModTime: mtime},
+		dir("var/"), dir("var/lib/"), dir("var/lib/postgresql/"), data,
+	}})
+	ctx := context.Background()
+	assert.NilError(t, f.Prepare(ctx))
+	for _, p := range []string{"/bin/su", "/bin/sh", "/dev/null", "/dev/initctl"} {
+		assert.NilError(t, f.Fetch(ctx, p))
+	}
+
+	for p, expected := range map[string]os.FileMode{
+		"bin/su":                  0755 | os.ModeSetuid,
+		"dev/null":                0666 | os.ModeDevice | os.ModeCharDevice,
+		"dev/initctl":             0600 | os.ModeNamedPipe,
+		"var/lib/postgresql/data": 0700 | os.ModeDir,
+	} {
+		fi, err := os.Lstat(filepath.Join(f.Dir(), p))
+		assert.NilError(t, err)
+		assert.Check(t, is.Equal(fi.Mode(), expected), p)
+		assert.Check(t, fi.ModTime().Equal(mtime), p)
+	}
+	fi, err := os.Lstat(filepath.Join(f.Dir(), "var/lib/postgresql/data"))
+	assert.NilError(t, err)
+	st := fi.Sys().(*syscall.Stat_t)
+	assert.Check(t, is.DeepEqual([2]int{int(st.Uid), int(st.Gid)}, [2]int{70, 70}))
+	fi, err = os.Lstat(filepath.Join(f.Dir(), "dev/null"))
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(fi.Sys().(*syscall.Stat_t).Rdev, uint64(system.Mkdev(1, 3))))
+	fi, err = os.Lstat(filepath.Join(f.Dir(), "bin/sh"))
+	assert.NilError(t, err)
+	assert.Check(t, fi.ModTime().Equal(mtime))
+
+	// fetching files into a directory leaves its modification time as is
+	fi, err = os.Lstat(filepath.Join(f.Dir(), "dev"))
+	assert.NilError(t, err)
+	assert.Check(t, fi.ModTime().Equal(mtime))
+}
+
+// rawSource is a layer whose tar stream is written as is, such as one with
+// entries tar.Writer cannot encode.
+type rawSource []byte
+
+func (s rawSource) DiffID() layer.DiffID {
+	return layer.DiffID(digest.FromBytes(s))
+}
+
+func (s rawSource) Open(ctx context.Context) (io.ReadCloser, error) {
+	return ioutil.NopCloser(bytes.NewReader(s)), nil
+}
+
+func TestFetcherFetchSparse(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("requires root to preserve ownership")
+	}
+	root, err := ioutil.TempDir("", "simplify-fetch")
+	assert.NilError(t, err)
+	defer os.RemoveAll(root)
+
+	size := int64(1 << 30)
+	data := testutil.SparseData{Offset: 1 << 20, Data: bytes.Repeat([]byte("x"), 1<<20)}
+	b := testutil.GNUSparseEntry("db.img", size, data)
+	f := NewFetcher(filepath.Join(root, "cache"), []Source{rawSource(append(b, make([]byte, 1024)...))})
+	ctx := context.Background()
+	assert.NilError(t, f.Prepare(ctx))
+	assert.NilError(t, f.Fetch(ctx, "/db.img"))
+
+	target := filepath.Join(f.Dir(), "db.img")
+	fi, err := os.Stat(target)
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(fi.Size(), size))
+	// the holes are left as holes, where the filesystem supports them
+	if blocks := fi.Sys().(*syscall.Stat_t).Blocks * 512; blocks >= size {
+		t.Skip("filesystem does not support holes")
+	}
+	file, err := os.Open(target)
+	assert.NilError(t, err)
+	defer file.Close()
+	content := make([]byte, len(data.Data))
+	_, err = file.ReadAt(content, data.Offset)
+	assert.NilError(t, err)
+	assert.Check(t, bytes.Equal(content, data.Data))
+}
+
+func TestFetcherFetchHardLink(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("requires root to preserve ownership")
+	}
+	root, err := ioutil.TempDir("", "simplify-fetch")
+	assert.NilError(t, err)
+	defer os.RemoveAll(root)
+
+	link := &tar.Header{Name: "bin/dash", Typeflag: tar.TypeLink, Linkname: "bin/sh", Mode: 0755}
+	f := NewFetcher(filepath.Join(root, "cache"), []Source{tarSource{dir("bin/"), file("bin/sh"), link}})
+	ctx := context.Background()
+	assert.NilError(t, f.Prepare(ctx))
+
+	assert.NilError(t, f.Fetch(ctx, "/bin/dash"))
+	b, err := ioutil.ReadFile(filepath.Join(f.Dir(), "bin/dash"))
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(string(b), "bin/sh"))
+}
+
+// TestFetcherFetchLinkGroup fetches a name of a busybox-style hard link
+// farm, and checks that the other names of the group the image has are
+// linked to the file fetched.
+func TestFetcherFetchLinkGroup(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("requires root to preserve ownership")
+	}
+	root, err := ioutil.TempDir("", "simplify-fetch")
+	assert.NilError(t, err)
+	defer os.RemoveAll(root)
+
+	hardlink := func(name string) *tar.Header {
+		return &tar.Header{Name: name, Typeflag: tar.TypeLink, Linkname: "bin/busybox", Mode: 0755}
+	}
+	f := NewFetcher(filepath.Join(root, "cache"), []Source{
+		// top: replaces cat and deletes rm
+		newIndexedSource(t, tarSource{dir("bin/"), file("bin/cat"), file("bin/.wh.rm")}),
+		newIndexedSource(t, tarSource{dir("bin/"), file("bin/busybox"), hardlink("bin/ls"), hardlink("bin/cat"), hardlink("bin/rm"), hardlink("bin/sh")}),
+	})
+	ctx := context.Background()
+	assert.NilError(t, f.Prepare(ctx))
+
+	assert.NilError(t, f.Fetch(ctx, "/bin/ls"))
+	fi, err := os.Stat(filepath.Join(f.Dir(), "bin/ls"))
+	assert.NilError(t, err)
+	for _, p := range []string{"bin/busybox", "bin/sh"} {
+		other, err := os.Stat(filepath.Join(f.Dir(), p))
+		assert.NilError(t, err)
+		assert.Check(t, os.SameFile(fi, other), p)
+	}
+	for _, p := range []string{"bin/cat", "bin/rm"} {
+		_, err = os.Lstat(filepath.Join(f.Dir(), p))
+		assert.Check(t, os.IsNotExist(err), p)
+	}
+
+	// the top cat is fetched on its own
+	assert.NilError(t, f.Fetch(ctx, "/bin/cat"))
+	b, err := ioutil.ReadFile(filepath.Join(f.Dir(), "bin/cat"))
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(string(b), "bin/cat"))
+}
+
+// corruptedSource answers with the files of its layer altered, as a
+// tampered registry would.
+type corruptedSource struct {
+	tarSource
+}
+
+func (s corruptedSource) Open(ctx context.Context) (io.ReadCloser, error) {
+	b, err := s.build(strings.ToUpper)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(bytes.NewReader(b)), nil
+}
+
+func TestFetcherFetchCorrupted(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("requires root to preserve ownership")
+	}
+	root, err := ioutil.TempDir("", "simplify-fetch")
+	assert.NilError(t, err)
+	defer os.RemoveAll(root)
+
+	src := corruptedSource{tarSource{dir("bin/"), file("bin/sh"), file("bin/ls")}}
+	f := NewFetcher(filepath.Join(root, "cache"), []Source{src})
+	ctx := context.Background()
+	assert.NilError(t, f.Prepare(ctx))
+
+	// the whole layer is verified before the file is made visible
+	err = f.Fetch(ctx, "/bin/ls")
+	assert.Check(t, IsVerificationError(err), "%v", err)
+	assert.Check(t, is.ErrorContains(err, "content verification failed for layer "+string(src.DiffID())))
+	_, err = os.Stat(filepath.Join(f.Dir(), "bin/ls"))
+	assert.Check(t, os.IsNotExist(err))
+
+	_, err = f.Prefetch(ctx, PrefetchOptions{})
+	assert.Check(t, IsVerificationError(err), "%v", err)
+	assert.Check(t, !f.Materialized())
+	for _, p := range []string{"bin/sh", "bin/ls"} {
+		_, err = os.Stat(filepath.Join(f.Dir(), p))
+		assert.Check(t, os.IsNotExist(err), p)
+	}
+
+	// entries without a digest fall back to verifying the whole layer
+	indexed := newIndexedSource(t, src.tarSource)
+	indexed.toc.Entries[2].Digest = ""
+	f = NewFetcher(filepath.Join(root, "indexed"), []Source{corruptedIndexedSource{indexed}})
+	assert.NilError(t, f.Prepare(ctx))
+	err = f.Fetch(ctx, "/bin/ls")
+	assert.Check(t, IsVerificationError(err), "%v", err)
+	assert.Check(t, is.Len(indexed.opened, 0))
+	_, err = os.Stat(filepath.Join(f.Dir(), "bin/ls"))
+	assert.Check(t, os.IsNotExist(err))
+}
+
+type corruptedIndexedSource struct {
+	*indexedSource
+}
+
+func (s corruptedIndexedSource) Open(ctx context.Context) (io.ReadCloser, error) {
+	return corruptedSource{s.tarSource}.Open(ctx)
+}
+
+func TestFetcherRemapped(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("requires root to preserve ownership")
+	}
+	root, err := ioutil.TempDir("", "simplify-fetch")
+	assert.NilError(t, err)
+	defer os.RemoveAll(root)
+
+	owned := func(hdr *tar.Header, uid, gid int) *tar.Header {
+		hdr.Uid, hdr.Gid = uid, gid
+		return hdr
+	}
+	f := NewFetcher(filepath.Join(root, "cache"), []Source{tarSource{
+		dir("bin/"), owned(file("bin/su"), 0, 0),
+		owned(dir("home/"), 0, 0), owned(dir("home/app/"), 1000, 1000), owned(file("home/app/.profile"), 1000, 1000),
+	}})
+	f.idMappings = idtools.NewIDMappingsFromMaps(
+		[]idtools.IDMap{{ContainerID: 0, HostID: 100000, Size: 65536}},
+		[]idtools.IDMap{{ContainerID: 0, HostID: 200000, Size: 65536}},
+	)
+	ctx := context.Background()
+	assert.NilError(t, f.Prepare(ctx))
+	assert.NilError(t, f.Fetch(ctx, "/bin/su"))
+	assert.NilError(t, f.Fetch(ctx, "/home/app/.profile"))
+
+	// the cache is owned by the IDs the graphdriver shifts the layers to
+	for p, ids := range map[string][2]int{
+		"":                  {100000, 200000},
+		"bin":               {100000, 200000},
+		"bin/su":            {100000, 200000},
+		"home/app":          {101000, 201000},
+		"home/app/.profile": {101000, 201000},
+	} {
+		fi, err := os.Lstat(filepath.Join(f.Dir(), p))
+		assert.NilError(t, err)
+		st := fi.Sys().(*syscall.Stat_t)
+		assert.Check(t, is.DeepEqual([2]int{int(st.Uid), int(st.Gid)}, ids), p)
+	}
+
+	// and mapped back to the IDs of the container when read
+	tr := tar.NewReader(CopyCache(nil, f.Dir(), "/home", "home", []string{"/home/app", "/home/app/.profile"}, f.idMappings))
+	for _, name := range []string{"home/app/", "home/app/.profile"} {
+		hdr, err := tr.Next()
+		assert.NilError(t, err)
+		assert.Check(t, is.Equal(hdr.Name, name))
+		assert.Check(t, is.DeepEqual([2]int{hdr.Uid, hdr.Gid}, [2]int{1000, 1000}), name)
+	}
+}
+
+func TestFetcherExtractExistingSymlink(t *testing.T) {
+	f, cleanup := newTestFetcher(t)
+	defer cleanup()
+
+	// another daemon sharing the cache fetched the link meanwhile
+	hdr := &tar.Header{Name: "etc/link", Typeflag: tar.TypeSymlink, Linkname: "app.conf"}
+	target := filepath.Join(f.Dir(), "etc/link")
+	assert.NilError(t, os.Symlink("app.conf", target))
+	assert.Check(t, f.extract(target, hdr, nil, nil))
+
+	hdr.Linkname = "other.conf"
+	assert.Check(t, os.IsExist(f.extract(target, hdr, nil, nil)))
+}
@@ -0,0 +1,95 @@
+package simplify // import "github.com/docker/docker/daemon/simplify"
+
+import (
+	"time"
+)
+
+// Where the files looked up on demand were found, as recorded in the fetch
+// logs of the containers.
+const (
+	// FetchSourceCache is the cache of the image, or the blob store the
+	// caches share.
+	FetchSourceCache = "cache"
+	// FetchSourcePeer is the cache of another daemon.
+	FetchSourcePeer = "peer"
+	// FetchSourceImage is a layer of the full image, read from the layer
+	// store or the registry.
+	FetchSourceImage = "image"
+)
+
+// Outcomes of the files looked up on demand, as recorded in the fetch logs
+// of the containers.
+const (
+	// FetchOutcomeFetched is the outcome of a file found.
+	FetchOutcomeFetched = "fetched"
+	// FetchOutcomeNotFound is the outcome of a file in no layer of the full
+	// image.
+	FetchOutcomeNotFound = "not-found"
+	// FetchOutcomeFailed is the outcome of a file that could not be
+	// fetched.
+	FetchOutcomeFailed = "failed"
+)
+
+// fetchLogSize is the number of entries the fetch log of a container keeps,
+// the oldest being dropped first.
+const fetchLogSize = 1024
+
+// FetchLogEntry is a file looked up on demand for a container.
+type FetchLogEntry struct {
+	// ID orders the entries of the log of a container, starting from 1.
+	ID uint64
+	// Path is the path of the file inside the container.
+	Path string
+	// Size is the size of the file, if it was found.
+	Size int64
+	// Latency is how long the lookup took, once it left the queue.
+	Latency time.Duration
+	// Source is where the file was found, one of the FetchSource
+	// constants, if it was.
+	Source string
+	// Time is when the lookup started.
+	Time time.Time
+	// Outcome is one of the FetchOutcome constants.
+	Outcome string
+	// Error is why the lookup failed, if it did.
+	Error string
+}
+
+// fetchLog keeps the last fetchLogSize files looked up for a container.
+type fetchLog struct {
+	// entries is a ring, the entry of ID n being at (n-1) % fetchLogSize
+	entries []FetchLogEntry
+	// last is the ID of the last entry added
+	last uint64
+}
+
+// add appends e to the log, dropping the oldest entry if it is full.
+func (l *fetchLog) add(e FetchLogEntry) {
+	l.last++
+	e.ID = l.last
+	if len(l.entries) < fetchLogSize {
+		l.entries = append(l.entries, e)
+		return
+	}
+	l.entries[(e.ID-1)%fetchLogSize] = e
+}
+
+// since returns at most limit of the entries whose ID is greater than
+// after, oldest first, all of them if limit is 0, and whether more follow.
+func (l *fetchLog) since(after uint64, limit int) ([]FetchLogEntry, bool) {
+	first := uint64(1)
+	if l.last > uint64(len(l.entries)) {
+		first = l.last - uint64(len(l.entries)) + 1
+	}
+	if after >= first {
+		first = after + 1
+	}
+	var entries []FetchLogEntry
+	for id := first; id <= l.last; id++ {
+		if limit > 0 && len(entries) == limit {
+			return entries, true
+		}
+		entries = append(entries, l.entries[(id-1)%fetchLogSize])
+	}
+	return entries, false
+}
@@ -0,0 +1,39 @@
+package simplify // import "github.com/docker/docker/daemon/simplify"
+
+import (
+	"fmt"
+	"testing"
+
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+func TestFetchLog(t *testing.T) {
+	var l fetchLog
+	entries, more := l.since(0, 0)
+	assert.Check(t, is.Len(entries, 0))
+	assert.Check(t, !more)
+
+	for n := 1; n <= fetchLogSize+10; n++ {
+		l.add(FetchLogEntry{Path: fmt.Sprintf("/file%d", n)})
+	}
+	assert.Check(t, is.Len(l.entries, fetchLogSize))
+
+	// the oldest entries were dropped
+	entries, more = l.since(0, 2)
+	assert.Check(t, more)
+	assert.Assert(t, is.Len(entries, 2))
+	assert.Check(t, is.Equal(entries[0].ID, uint64(11)))
+	assert.Check(t, is.Equal(entries[0].Path, "/file11"))
+	assert.Check(t, is.Equal(entries[1].ID, uint64(12)))
+
+	entries, more = l.since(fetchLogSize+5, 0)
+	assert.Check(t, !more)
+	assert.Assert(t, is.Len(entries, 5))
+	assert.Check(t, is.Equal(entries[4].ID, uint64(fetchLogSize+10)))
+	assert.Check(t, is.Equal(entries[4].Path, fmt.Sprintf("/file%d", fetchLogSize+10)))
+
+	entries, more = l.since(fetchLogSize+10, 0)
+	assert.Check(t, is.Len(entries, 0))
+	assert.Check(t, !more)
+}
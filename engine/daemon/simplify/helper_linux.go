@@ -0,0 +1,132 @@
+package simplify // import "github.com/docker/docker/daemon/simplify"
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/docker/docker/pkg/reexec"
+)
+
+const (
+	// helperName is the name the kernel runs the fetch helper under.
+	helperName = "docker-simplify-fetch"
+	// sockEnv passes the server socket to the fetch helper.
+	sockEnv = "DOCKER_SIMPLIFY_FETCH_SOCK"
+
+	kernelParams = "/sys/module/overlay/parameters"
+)
+
+func init() {
+	reexec.Register(helperName, fetchHelperMain)
+}
+
+// Supported returns true if the overlay module can fetch missing files
+// through a helper.
+func Supported() bool {
+	_, err := os.Stat(filepath.Join(kernelParams, "fetch_helper"))
+	return err == nil
+}
+
+// configureKernel points the overlay module at the fetch helper and sock.
+// An empty sock unsets both.
+func configureKernel(sock string) error {
+	var helper string
+	if sock != "" {
+		// 内核以辅助程序路径的文件名作为argv[0]，通过符号链接让dockerd以reexec方式运行
+		self, err := os.Executable()
+		if err != nil {
+			return err
+		}
+		helper = filepath.Join(filepath.Dir(sock), helperName)
+		os.Remove(helper)
+		if err := os.Symlink(self, helper); err != nil {
+			return err
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(kernelParams, "fetch_socket"), []byte(sock), 0644); err != nil {
+		return fmt.Errorf("error configuring simplify fetch socket: %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(kernelParams, "fetch_helper"), []byte(helper), 0644); err != nil {
+		return fmt.Errorf("error configuring simplify fetch helper: %v", err)
+	}
+	return nil
+}
+
+// kernelConfigured returns true if the overlay module points at the fetch
+// helper and sock.
+func kernelConfigured(sock string) bool {
+	b, err := ioutil.ReadFile(filepath.Join(kernelParams, "fetch_socket"))
+	if err != nil || strings.TrimSpace(string(b)) != sock {
+		return false
+	}
+	b, err = ioutil.ReadFile(filepath.Join(kernelParams, "fetch_helper"))
+	if err != nil {
+		return false
+	}
+	// 辅助程序的符号链接可能随运行目录一起被删除
+	_, err = os.Stat(strings.TrimSpace(string(b)))
+	return err == nil
+}
+
+// fetchHelperMain is the entry-point for docker-simplify-fetch, run by the
+// kernel with the upper directory of the mount and the missing path. It
+// exits with the errno answered by the server, which the kernel fails the
+// lookup with; other errors exit with ENOENT, so the path is left missing.
+func fetchHelperMain() {
+	err := fetchHelper(os.Getenv(sockEnv), os.Args[1:])
+	if err != nil {
+		fmt.Fprint(os.Stderr, err)
+	}
+	os.Exit(helperExitCode(err))
+}
+
+// helperExitCode returns the exit status of the fetch helper for err.
+func helperExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	if ferr, ok := err.(fetchError); ok && ferr.errno != 0 {
+		return int(ferr.errno)
+	}
+	return int(syscall.ENOENT)
+}
+
+// fetchError is a failed fetch, as answered by the server.
+type fetchError struct {
+	msg   string
+	errno syscall.Errno
+}
+
+func (e fetchError) Error() string {
+	return e.msg
+}
+
+func fetchHelper(sock string, args []string) error {
+	if len(args) != 2 {
+		return errors.New("usage: docker-simplify-fetch UPPERDIR PATH")
+	}
+	conn, err := net.Dial("unix", sock)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := json.NewEncoder(conn).Encode(fetchRequest{Upper: args[0], Path: args[1]}); err != nil {
+		return err
+	}
+	var resp fetchResponse
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return err
+	}
+	if resp.Error != "" {
+		return fetchError{msg: resp.Error, errno: resp.Errno}
+	}
+	return nil
+}
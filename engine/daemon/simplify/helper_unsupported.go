@@ -0,0 +1,22 @@
+// +build !linux
+
+package simplify // import "github.com/docker/docker/daemon/simplify"
+
+import "errors"
+
+// Supported returns true if the overlay module can fetch missing files
+// through a helper.
+func Supported() bool {
+	return false
+}
+
+func configureKernel(sock string) error {
+	if sock == "" {
+		return nil
+	}
+	return errors.New("simplify fetch is not supported on this platform")
+}
+
+func kernelConfigured(sock string) bool {
+	return sock == ""
+}
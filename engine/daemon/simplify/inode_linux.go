@@ -0,0 +1,24 @@
+package simplify // import "github.com/docker/docker/daemon/simplify"
+
+import (
+	"os"
+	"syscall"
+)
+
+// inode returns the inode number of the file and its number of hard links.
+func inode(fi os.FileInfo) (ino, nlink uint64) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 1
+	}
+	return st.Ino, uint64(st.Nlink)
+}
+
+// owner returns the owner of the file, if known.
+func owner(fi os.FileInfo) (uid, gid int, ok bool) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+	return int(st.Uid), int(st.Gid), true
+}
@@ -0,0 +1,16 @@
+// +build !linux
+
+package simplify // import "github.com/docker/docker/daemon/simplify"
+
+import "os"
+
+// inode is not known on this platform: every file is taken to have a single
+// link.
+func inode(fi os.FileInfo) (ino, nlink uint64) {
+	return 0, 1
+}
+
+// owner returns the owner of the file, if known.
+func owner(fi os.FileInfo) (uid, gid int, ok bool) {
+	return 0, 0, false
+}
@@ -0,0 +1,255 @@
+package simplify // import "github.com/docker/docker/daemon/simplify"
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	symlinkutil "github.com/docker/docker/pkg/symlink"
+	"github.com/docker/docker/pkg/system"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// insertTarget is a root filesystem the files fetched for the image of a
+// container are copied into, for storage drivers that cannot layer the
+// cache underneath it.
+type insertTarget struct {
+	imageID string
+	rootfs  string
+	// state is the file listing the paths inserted into rootfs, kept across
+	// the runs of the container so that the files it removed are not
+	// inserted again
+	state string
+
+	mu       sync.Mutex
+	inserted map[string]bool
+}
+
+// InsertStatePath returns the path of the state file of Insert for the
+// container whose root is containerRoot.
+func InsertStatePath(containerRoot string) string {
+	return filepath.Join(containerRoot, "simplify-inserted")
+}
+
+// Insert copies the files of the cache of the image attached to mountID
+// that the root filesystem mounted at rootfs lacks into it, and then each
+// file fetched for the image, until mountID is detached. The paths inserted
+// are listed in the file state, and are not inserted again. It is used
+// instead of layering the cache underneath the writable layer of the
+// container.
+func (s *Server) Insert(mountID, rootfs, state string) error {
+	s.mu.Lock()
+	imageID, ok := s.mounts[mountID]
+	f := s.fetchers[imageID]
+	if !ok || f == nil {
+		s.mu.Unlock()
+		return errors.Errorf("no simplify fetch attached to %s", mountID)
+	}
+	inserted, err := readInserted(state)
+	if err != nil {
+		s.mu.Unlock()
+		return err
+	}
+	t := &insertTarget{imageID: imageID, rootfs: rootfs, state: state, inserted: inserted}
+	s.inserts[mountID] = t
+	s.mu.Unlock()
+
+	dir := f.Dir()
+	return filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		// 目录在准备缓存时全部创建，只插入其中的文件
+		if fi.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		return t.insert(dir, filepath.Clean("/"+rel))
+	})
+}
+
+// inserted inserts the file at p, just fetched into the cache dir of
+// imageID, into the root filesystems of the containers of the image.
+func (s *Server) inserted(imageID, dir, p string) {
+	s.mu.Lock()
+	var targets []*insertTarget
+	for _, t := range s.inserts {
+		if t.imageID == imageID {
+			targets = append(targets, t)
+		}
+	}
+	s.mu.Unlock()
+	p = filepath.Clean("/" + p)
+	for _, t := range targets {
+		if err := t.insert(dir, p); err != nil {
+			logrus.WithError(err).WithField("path", p).Warn("failed to insert fetched file into container rootfs")
+		}
+	}
+}
+
+// insert copies the entry of the cache dir at p into the root filesystem,
+// along with the parent directories it lacks, unless it was inserted
+// already. An entry the root
+// filesystem has is recorded as inserted, so that it is not inserted once
+// the container removes it.
+func (t *insertTarget) insert(dir, p string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.inserted[p] {
+		return nil
+	}
+	parent, err := symlinkutil.FollowSymlinkInScope(filepath.Join(t.rootfs, filepath.Dir(p)), t.rootfs)
+	if err != nil {
+		return err
+	}
+	target := filepath.Join(parent, filepath.Base(p))
+	if _, err := os.Lstat(target); err == nil {
+		return t.record(p)
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	if err := insertParents(dir, filepath.Dir(p), t.rootfs); err != nil {
+		return err
+	}
+	if err := copyEntry(filepath.Join(dir, p), target); err != nil {
+		return err
+	}
+	return t.record(p)
+}
+
+// record adds p to the paths inserted, in memory and in the state file.
+func (t *insertTarget) record(p string) error {
+	file, err := os.OpenFile(t.state, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err := fmt.Fprintln(file, strconv.Quote(p)); err != nil {
+		return err
+	}
+	t.inserted[p] = true
+	return nil
+}
+
+// readInserted returns the paths listed in the state file of Insert, none if
+// it does not exist.
+func readInserted(state string) (map[string]bool, error) {
+	inserted := make(map[string]bool)
+	file, err := os.Open(state)
+	if os.IsNotExist(err) {
+		return inserted, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		p, err := strconv.Unquote(scanner.Text())
+		if err != nil {
+			// 写入中断的最后一行
+			continue
+		}
+		inserted[p] = true
+	}
+	return inserted, scanner.Err()
+}
+
+// insertParents creates the directories of the cache dir at p and above it
+// that the root filesystem lacks, as the cache has them.
+func insertParents(dir, p, rootfs string) error {
+	if p == "/" {
+		return nil
+	}
+	target, err := symlinkutil.FollowSymlinkInScope(filepath.Join(rootfs, p), rootfs)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Lstat(target); err == nil {
+		return nil
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	if err := insertParents(dir, filepath.Dir(p), rootfs); err != nil {
+		return err
+	}
+	src := filepath.Join(dir, p)
+	fi, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+	if err := os.Mkdir(target, fi.Mode().Perm()); err != nil {
+		return err
+	}
+	return copyMetadata(target, fi)
+}
+
+// copyEntry copies the regular file or symbolic link src to dst, which does
+// not exist, with its owner, permissions and times. Other entries are
+// skipped.
+func copyEntry(src, dst string) error {
+	fi, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+	switch {
+	case fi.Mode().IsRegular():
+		in, err := os.Open(src)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, fi.Mode().Perm())
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(out, in); err != nil {
+			out.Close()
+			os.Remove(dst)
+			return err
+		}
+		if err := out.Close(); err != nil {
+			return err
+		}
+	case fi.Mode()&os.ModeSymlink != 0:
+		link, err := os.Readlink(src)
+		if err != nil {
+			return err
+		}
+		if err := os.Symlink(link, dst); err != nil {
+			return err
+		}
+	default:
+		return nil
+	}
+	return copyMetadata(dst, fi)
+}
+
+// copyMetadata gives dst the owner, and unless it is a symbolic link the
+// permissions and times, of the entry whose info is fi.
+func copyMetadata(dst string, fi os.FileInfo) error {
+	if uid, gid, ok := owner(fi); ok {
+		if err := os.Lchown(dst, uid, gid); err != nil {
+			return err
+		}
+	}
+	if fi.Mode()&os.ModeSymlink != 0 {
+		return nil
+	}
+	// chown会清除setuid位
+	if err := os.Chmod(dst, fi.Mode()&(os.ModePerm|os.ModeSetuid|os.ModeSetgid|os.ModeSticky)); err != nil {
+		return err
+	}
+	return system.Chtimes(dst, fi.ModTime(), fi.ModTime())
+}
@@ -0,0 +1,67 @@
+package simplify // import "github.com/docker/docker/daemon/simplify"
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+func TestServerInsert(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("requires root to preserve ownership")
+	}
+	root, err := ioutil.TempDir("", "simplify-server")
+	assert.NilError(t, err)
+	defer os.RemoveAll(root)
+	rootfs := filepath.Join(root, "rootfs")
+	assert.NilError(t, os.MkdirAll(filepath.Join(rootfs, "etc"), 0755))
+	assert.NilError(t, ioutil.WriteFile(filepath.Join(rootfs, "etc/hosts"), []byte("kept"), 0644))
+	state := filepath.Join(root, "inserted")
+
+	s := newTestServer(root, nil)
+	ctx := context.Background()
+	sources := []Source{tarSource{dir("etc/"), file("etc/app.conf"), file("etc/hosts"), dir("usr/"), dir("usr/lib/"), file("usr/lib/libc.so")}}
+	_, err = s.Attach(ctx, "mount", "image", sources, 0, 0)
+	assert.NilError(t, err)
+	assert.NilError(t, s.fetch(ctx, fetchRequest{Upper: "mount/diff", Path: "/etc/app.conf"}))
+	assert.NilError(t, s.fetch(ctx, fetchRequest{Upper: "mount/diff", Path: "/etc/hosts"}))
+
+	// the files fetched already are inserted, but not over those of the rootfs
+	assert.NilError(t, s.Insert("mount", rootfs, state))
+	content, err := ioutil.ReadFile(filepath.Join(rootfs, "etc/app.conf"))
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(string(content), "etc/app.conf"))
+	content, err = ioutil.ReadFile(filepath.Join(rootfs, "etc/hosts"))
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(string(content), "kept"))
+
+	// files fetched later are inserted along with the directories missing
+	assert.NilError(t, s.fetch(ctx, fetchRequest{Upper: "mount/diff", Path: "/usr/lib/libc.so"}))
+	fi, err := os.Stat(filepath.Join(rootfs, "usr/lib"))
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(fi.Mode(), os.ModeDir|0755))
+	content, err = ioutil.ReadFile(filepath.Join(rootfs, "usr/lib/libc.so"))
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(string(content), "usr/lib/libc.so"))
+	s.Detach("mount")
+	assert.Check(t, is.Len(s.inserts, 0))
+
+	// files the container removed are not inserted again
+	assert.NilError(t, os.Remove(filepath.Join(rootfs, "etc/app.conf")))
+	assert.NilError(t, os.Remove(filepath.Join(rootfs, "etc/hosts")))
+	_, err = s.Attach(ctx, "mount", "image", sources, 0, 0)
+	assert.NilError(t, err)
+	assert.NilError(t, s.Insert("mount", rootfs, state))
+	for _, p := range []string{"etc/app.conf", "etc/hosts"} {
+		_, err = os.Lstat(filepath.Join(rootfs, p))
+		assert.Check(t, os.IsNotExist(err), p)
+	}
+	s.Detach("mount")
+
+	assert.Check(t, is.ErrorContains(s.Insert("mount", rootfs, state), "no simplify fetch attached"))
+}
@@ -0,0 +1,27 @@
+package simplify // import "github.com/docker/docker/daemon/simplify"
+
+import (
+	"os"
+	"syscall"
+)
+
+const (
+	lockShared    = syscall.LOCK_SH
+	lockExclusive = syscall.LOCK_EX
+)
+
+// flock takes the lock how on f, or converts the lock held on it, waiting
+// for the other holders to release it if wait is set. The locks are taken
+// with flock(2), which NFS clients map to locks held by the server, so they
+// are shared with the other hosts mounting the file system.
+func flock(f *os.File, how int, wait bool) error {
+	if !wait {
+		how |= syscall.LOCK_NB
+	}
+	for {
+		err := syscall.Flock(int(f.Fd()), how)
+		if err != syscall.EINTR {
+			return err
+		}
+	}
+}
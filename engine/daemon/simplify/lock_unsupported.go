@@ -0,0 +1,15 @@
+// +build !linux
+
+package simplify // import "github.com/docker/docker/daemon/simplify"
+
+import "os"
+
+const (
+	lockShared = iota
+	lockExclusive
+)
+
+// flock is a no-op on this platform: caches are never shared.
+func flock(f *os.File, how int, wait bool) error {
+	return nil
+}
@@ -0,0 +1,31 @@
+package simplify // import "github.com/docker/docker/daemon/simplify"
+
+import "github.com/docker/go-metrics"
+
+var (
+	cacheSize        metrics.Gauge
+	cacheEvictions   metrics.Counter
+	fetches          metrics.LabeledCounter
+	fetchedBytes     metrics.LabeledCounter
+	fetchLatency     metrics.LabeledTimer
+	cacheHitRatio    metrics.LabeledGauge
+	fetchRangesSaved metrics.Counter
+	peerHits         metrics.Counter
+	helperRestarts   metrics.Counter
+	fetchNoSpace     metrics.Counter
+)
+
+func init() {
+	ns := metrics.NewNamespace("engine", "daemon", nil)
+	cacheSize = ns.NewGauge("simplify_cache_size", "The size of the files fetched on demand for simplified images", metrics.Bytes)
+	cacheEvictions = ns.NewCounter("simplify_cache_evictions", "The number of files evicted from the cache of simplified images")
+	fetches = ns.NewLabeledCounter("simplify_fetches", "The number of files looked up on demand for simplified images", "image")
+	fetchedBytes = ns.NewLabeledCounter("simplify_fetched_bytes", "The number of bytes of the files fetched on demand for simplified images", "image")
+	fetchLatency = ns.NewLabeledTimer("simplify_fetch", "The number of seconds it takes to fetch a file on demand for simplified images", "image")
+	cacheHitRatio = ns.NewLabeledGauge("simplify_cache_hit_ratio", "The ratio of the files looked up on demand for simplified images found in the cache", metrics.Unit("ratio"), "image")
+	fetchRangesSaved = ns.NewCounter("simplify_fetch_range_requests_saved", "The number of range requests saved by reading the files fetched on demand for simplified images at nearby offsets of a layer blob together")
+	peerHits = ns.NewCounter("simplify_fetch_peer_hits", "The number of files fetched on demand for simplified images from peers rather than from the registry")
+	fetchNoSpace = ns.NewCounter("simplify_fetch_no_space", "The number of files that could not be fetched on demand for simplified images because the disk was full, even once the cache was evicted")
+	helperRestarts = ns.NewCounter("simplify_fetch_service_restarts", "The number of times the service answering the fetch helper of simplified images was restarted, or recovered from a panic")
+	metrics.Register(ns)
+}
@@ -0,0 +1,120 @@
+package simplify // import "github.com/docker/docker/daemon/simplify"
+
+import (
+	"archive/tar"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	symlinkutil "github.com/docker/docker/pkg/symlink"
+)
+
+// MissingFiles returns the paths, sorted, of the files of the full image
+// that the root filesystem mounted at rootfs lacks, out of paths. Paths that
+// are not in the full image either, such as files the container creates as
+// it runs, are not missing. At most max paths are returned, along with the
+// number of files missing. The full image is given as its layers, topmost
+// first, and is read from their tables of contents where available.
+func MissingFiles(ctx context.Context, rootfs string, paths []string, full []Source, max int) ([]string, int, error) {
+	absent, err := absentPaths(rootfs, paths)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var missing []string
+	for _, src := range full {
+		if len(absent) == 0 {
+			break
+		}
+		if is, ok := src.(IndexedSource); ok {
+			if toc := is.TOC(); toc != nil {
+				for p := range absent {
+					n, hidden := toc.Lookup(p)
+					if n >= 0 && toc.Entries[n].Type != tar.TypeDir {
+						missing = append(missing, p)
+					}
+					if hidden {
+						delete(absent, p)
+					}
+				}
+				continue
+			}
+		}
+		rc, err := src.Open(ctx)
+		if err != nil {
+			return nil, 0, err
+		}
+		layerHidden, err := scanLayer(ctx, rc, make(map[string]bool), make(map[string]bool), func(name string, hdr *tar.Header, _ io.Reader) error {
+			if absent[name] {
+				if hdr.Typeflag != tar.TypeDir {
+					missing = append(missing, name)
+				}
+				delete(absent, name)
+			}
+			return nil
+		})
+		rc.Close()
+		if err != nil {
+			return nil, 0, err
+		}
+		hidden := make(map[string]bool)
+		for _, p := range layerHidden {
+			hidden[p] = true
+		}
+		for p := range absent {
+			if isHidden(hidden, p) {
+				delete(absent, p)
+			}
+		}
+	}
+
+	sort.Strings(missing)
+	total := len(missing)
+	if len(missing) > max {
+		missing = missing[:max]
+	}
+	return missing, total, nil
+}
+
+// Absent returns the paths, sorted, of those of paths the root filesystem
+// mounted at rootfs lacks, following symlinks inside it.
+func Absent(rootfs string, paths []string) ([]string, error) {
+	absent, err := absentPaths(rootfs, paths)
+	if err != nil {
+		return nil, err
+	}
+	missing := make([]string, 0, len(absent))
+	for p := range absent {
+		missing = append(missing, p)
+	}
+	sort.Strings(missing)
+	return missing, nil
+}
+
+// absentPaths returns those of paths the root filesystem mounted at rootfs
+// lacks, following symlinks inside it. The placeholders of files pruned are
+// absent.
+func absentPaths(rootfs string, paths []string) (map[string]bool, error) {
+	absent := make(map[string]bool)
+	for _, p := range paths {
+		p = filepath.Clean("/" + p)
+		// 在rootfs范围内解析符号链接，避免访问宿主机上的文件
+		resolved, err := symlinkutil.FollowSymlinkInScope(filepath.Join(rootfs, p), rootfs)
+		if err == nil {
+			_, err = os.Lstat(resolved)
+		}
+		if err == nil && isPlaceholder(resolved) {
+			absent[p] = true
+			continue
+		}
+		if err != nil {
+			if !os.IsNotExist(err) {
+				return nil, err
+			}
+			absent[p] = true
+		}
+	}
+	return absent, nil
+}
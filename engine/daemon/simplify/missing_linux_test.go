@@ -0,0 +1,35 @@
+package simplify // import "github.com/docker/docker/daemon/simplify"
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/docker/pkg/archive"
+	"github.com/docker/docker/pkg/system"
+	"golang.org/x/sys/unix"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+func TestAbsentPlaceholders(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("requires root to set trusted xattrs")
+	}
+	rootfs, err := ioutil.TempDir("", "simplify-missing")
+	assert.NilError(t, err)
+	defer os.RemoveAll(rootfs)
+	for _, name := range []string{"lib.so", "app.conf"} {
+		assert.NilError(t, ioutil.WriteFile(filepath.Join(rootfs, name), nil, 0644))
+	}
+	err = system.Lsetxattr(filepath.Join(rootfs, "lib.so"), archive.PlaceholderXattr, []byte("4096"), 0)
+	if err == unix.ENOTSUP {
+		t.Skip("filesystem does not support trusted xattrs")
+	}
+	assert.NilError(t, err)
+
+	absent, err := Absent(rootfs, []string{"/lib.so", "/app.conf"})
+	assert.NilError(t, err)
+	assert.Check(t, is.DeepEqual(absent, []string{"/lib.so"}))
+}
@@ -0,0 +1,50 @@
+package simplify // import "github.com/docker/docker/daemon/simplify"
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+func TestMissingFiles(t *testing.T) {
+	rootfs, err := ioutil.TempDir("", "simplify-missing")
+	assert.NilError(t, err)
+	defer os.RemoveAll(rootfs)
+	for _, d := range []string{"etc", "var"} {
+		assert.NilError(t, os.Mkdir(filepath.Join(rootfs, d), 0755))
+	}
+	assert.NilError(t, ioutil.WriteFile(filepath.Join(rootfs, "etc/hosts"), nil, 0644))
+	// a link out of the rootfs is resolved inside it
+	assert.NilError(t, os.Symlink("/", filepath.Join(rootfs, "host")))
+
+	full := []Source{
+		// top
+		tarSource{dir("etc/"), file("etc/app.conf"), file("etc/.wh.old.conf")},
+		// bottom, read from its table of contents
+		newIndexedSource(t, tarSource{dir("bin/"), file("bin/sh"), dir("etc/"), file("etc/hosts"), file("etc/old.conf"), dir("var/")}),
+	}
+	paths := []string{
+		"/etc/app.conf",
+		"/etc/hosts",
+		// removed by the top layer
+		"/etc/old.conf",
+		"/bin/sh",
+		// created by the container
+		"/var/run/app.pid",
+		"/host" + rootfs + "/etc/hosts",
+	}
+	missing, total, err := MissingFiles(context.Background(), rootfs, paths, full, 10)
+	assert.NilError(t, err)
+	assert.Check(t, is.DeepEqual(missing, []string{"/bin/sh", "/etc/app.conf"}))
+	assert.Check(t, is.Equal(total, 2))
+
+	missing, total, err = MissingFiles(context.Background(), rootfs, paths, full, 1)
+	assert.NilError(t, err)
+	assert.Check(t, is.DeepEqual(missing, []string{"/bin/sh"}))
+	assert.Check(t, is.Equal(total, 2))
+}
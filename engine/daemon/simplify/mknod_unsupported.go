@@ -0,0 +1,15 @@
+// +build !linux
+
+package simplify // import "github.com/docker/docker/daemon/simplify"
+
+import (
+	"archive/tar"
+
+	"github.com/docker/docker/pkg/system"
+)
+
+// mknod is not supported on this platform: the caches of simplified images
+// hold no special files.
+func mknod(path string, hdr *tar.Header) error {
+	return system.ErrNotSupportedPlatform
+}
@@ -0,0 +1,175 @@
+package simplify // import "github.com/docker/docker/daemon/simplify"
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+)
+
+// BlobSource is a source of the content of the regular files of full
+// images by digest, tried before their layers. The content it returns is
+// verified against the digest, so the source need not be trusted.
+type BlobSource interface {
+	// OpenBlob returns the content dgst, or an error satisfying
+	// os.IsNotExist if the source does not have it.
+	OpenBlob(ctx context.Context, dgst digest.Digest) (io.ReadCloser, error)
+}
+
+// blobSources are the BlobSources the fetchers try, which are replaced
+// when the configuration of the daemon is reloaded. A nil *blobSources has
+// none.
+type blobSources struct {
+	mu      sync.Mutex
+	sources []BlobSource
+}
+
+func (b *blobSources) set(sources []BlobSource) {
+	b.mu.Lock()
+	b.sources = sources
+	b.mu.Unlock()
+}
+
+func (b *blobSources) get() []BlobSource {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.sources
+}
+
+// peerBlobPath is the path under which a peer handler serves blobs by
+// digest.
+const peerBlobPath = "/blobs/"
+
+const (
+	// peerDialTimeout and peerResponseTimeout bound how long a peer that is
+	// down or overloaded delays a fetch before the next source is tried.
+	peerDialTimeout     = 2 * time.Second
+	peerResponseTimeout = 5 * time.Second
+)
+
+// PeerSource is a BlobSource reading the files another daemon fetched,
+// served by its peer handler.
+type PeerSource struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+// NewPeerSource returns a PeerSource for the daemon serving its peer
+// handler at url, such as "http://10.0.0.2:7373", authenticated with token.
+func NewPeerSource(url, token string) *PeerSource {
+	return &PeerSource{
+		url:   strings.TrimSuffix(url, "/"),
+		token: token,
+		client: &http.Client{
+			Transport: &http.Transport{
+				Proxy:                 http.ProxyFromEnvironment,
+				Dial:                  (&net.Dialer{Timeout: peerDialTimeout, KeepAlive: 30 * time.Second}).Dial,
+				ResponseHeaderTimeout: peerResponseTimeout,
+				MaxIdleConnsPerHost:   4,
+			},
+		},
+	}
+}
+
+// OpenBlob implements BlobSource.
+func (p *PeerSource) OpenBlob(ctx context.Context, dgst digest.Digest) (io.ReadCloser, error) {
+	req, err := http.NewRequest(http.MethodGet, p.url+peerBlobPath+dgst.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Authorization", "Bearer "+p.token)
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.Body, nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, &os.PathError{Op: "open", Path: req.URL.String(), Err: os.ErrNotExist}
+	}
+	resp.Body.Close()
+	return nil, fmt.Errorf("peer %s: %s", p.url, resp.Status)
+}
+
+// peerHandler serves the blob store to the peers presenting token.
+type peerHandler struct {
+	blobs *blobStore
+	token string
+}
+
+// NewPeerHandler returns a handler serving the files fetched into the blob
+// store of the caches under root to the peers presenting token, so that
+// they read them from this daemon rather than from the registry.
+func NewPeerHandler(root, token string) http.Handler {
+	return &peerHandler{blobs: newBlobStore(root), token: token}
+}
+
+func (h *peerHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") || subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(h.token)) != 1 {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if !strings.HasPrefix(r.URL.Path, peerBlobPath) {
+		http.NotFound(w, r)
+		return
+	}
+	dgst, err := digest.Parse(strings.TrimPrefix(r.URL.Path, peerBlobPath))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	f, err := h.open(dgst)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.FormatInt(fi.Size(), 10))
+	if r.Method == http.MethodHead {
+		return
+	}
+	io.Copy(w, f)
+}
+
+// open opens a file of the blob store with the content dgst, whatever its
+// ownership and mode.
+func (h *peerHandler) open(dgst digest.Digest) (*os.File, error) {
+	matches, err := filepath.Glob(filepath.Join(h.blobs.root, dgst.Algorithm().String(), dgst.Hex()+"-*"))
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range matches {
+		if f, err := os.Open(m); err == nil {
+			return f, nil
+		}
+	}
+	return nil, os.ErrNotExist
+}
@@ -0,0 +1,100 @@
+package simplify // import "github.com/docker/docker/daemon/simplify"
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+func TestPeerHandler(t *testing.T) {
+	root, err := ioutil.TempDir("", "simplify-peer")
+	assert.NilError(t, err)
+	defer os.RemoveAll(root)
+
+	content := "etc/app.conf"
+	dgst := digest.FromString(content)
+	blob, err := newBlobStore(root).path(dgst, file("etc/app.conf"), nil)
+	assert.NilError(t, err)
+	assert.NilError(t, os.MkdirAll(filepath.Dir(blob), 0700))
+	assert.NilError(t, ioutil.WriteFile(blob, []byte(content), 0640))
+
+	ts := httptest.NewServer(NewPeerHandler(root, "secret"))
+	defer ts.Close()
+	ctx := context.Background()
+
+	rc, err := NewPeerSource(ts.URL+"/", "secret").OpenBlob(ctx, dgst)
+	assert.NilError(t, err)
+	b, err := ioutil.ReadAll(rc)
+	rc.Close()
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(string(b), content))
+
+	_, err = NewPeerSource(ts.URL, "secret").OpenBlob(ctx, digest.FromString("missing"))
+	assert.Check(t, os.IsNotExist(err), "%v", err)
+
+	_, err = NewPeerSource(ts.URL, "wrong").OpenBlob(ctx, dgst)
+	assert.Check(t, is.ErrorContains(err, "401 Unauthorized"))
+	assert.Check(t, !os.IsNotExist(err))
+}
+
+// tamperedBlobSource returns content that does not match any digest.
+type tamperedBlobSource struct{}
+
+func (tamperedBlobSource) OpenBlob(ctx context.Context, dgst digest.Digest) (io.ReadCloser, error) {
+	return ioutil.NopCloser(strings.NewReader("tampered content")), nil
+}
+
+func TestFetcherFetchFromPeer(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("requires root to preserve ownership")
+	}
+	root, err := ioutil.TempDir("", "simplify-peer")
+	assert.NilError(t, err)
+	defer os.RemoveAll(root)
+
+	layer := tarSource{dir("etc/"), file("etc/app.conf"), file("etc/other.conf")}
+	ctx := context.Background()
+
+	// the peer fetched the file from the registry already
+	peerRoot := filepath.Join(root, "peer")
+	peer := NewFetcher(filepath.Join(peerRoot, "image"), []Source{newIndexedSource(t, layer)})
+	peer.blobs = newBlobStore(peerRoot)
+	assert.NilError(t, peer.Prepare(ctx))
+	assert.NilError(t, peer.Fetch(ctx, "/etc/app.conf"))
+	ts := httptest.NewServer(NewPeerHandler(peerRoot, "secret"))
+	defer ts.Close()
+
+	localRoot := filepath.Join(root, "local")
+	src := newIndexedSource(t, layer)
+	f := NewFetcher(filepath.Join(localRoot, "image"), []Source{src})
+	f.blobs = newBlobStore(localRoot)
+	f.blobSources = &blobSources{}
+	f.blobSources.set([]BlobSource{tamperedBlobSource{}, NewPeerSource(ts.URL, "secret")})
+	assert.NilError(t, f.Prepare(ctx))
+
+	// tampered content is skipped, and the file is read from the peer rather
+	// than from the layer
+	_, from, err := f.fetch(ctx, "/etc/app.conf")
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(from, FetchSourcePeer))
+	assert.Check(t, is.Len(src.opened, 0))
+	b, err := ioutil.ReadFile(filepath.Join(f.Dir(), "etc/app.conf"))
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(string(b), "etc/app.conf"))
+	fi, err := os.Stat(filepath.Join(f.Dir(), "etc/app.conf"))
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(fi.Mode().Perm(), os.FileMode(0640)))
+
+	// files no peer has are read from the layer
+	assert.NilError(t, f.Fetch(ctx, "/etc/other.conf"))
+	assert.Check(t, is.DeepEqual(src.opened, []int{2}))
+}
@@ -0,0 +1,134 @@
+package simplify // import "github.com/docker/docker/daemon/simplify"
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+
+	"github.com/docker/docker/pkg/ioutils"
+)
+
+// pinsFile lists the globs of the paths pinned in the cache of an image,
+// next to it.
+const pinsFile = "pins.json"
+
+// Pins returns the globs of the paths pinned in the cache of imageID under
+// root, sorted.
+func Pins(root, imageID string) ([]string, error) {
+	b, err := ioutil.ReadFile(filepath.Join(root, imageID, pinsFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var pins []string
+	if err := json.Unmarshal(b, &pins); err != nil {
+		return nil, err
+	}
+	return pins, nil
+}
+
+// savePins replaces the globs of the paths pinned in the cache at root.
+func savePins(root string, pins []string) error {
+	if len(pins) == 0 {
+		if err := os.Remove(filepath.Join(root, pinsFile)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	sort.Strings(pins)
+	b, err := json.Marshal(pins)
+	if err != nil {
+		return err
+	}
+	return ioutils.AtomicWriteFile(filepath.Join(root, pinsFile), b, 0644)
+}
+
+// cleanPins returns patterns as they are pinned: absolute and clean.
+func cleanPins(patterns []string) []string {
+	pins := make([]string, len(patterns))
+	for n, p := range patterns {
+		pins[n] = path.Clean("/" + p)
+	}
+	return pins
+}
+
+// Pin pins the paths matching one of the globs opts.Patterns, or inside a
+// directory matching one, in the cache of imageID, and prefetches the files
+// of the full image among them. Pinned files are never evicted, however
+// full the disk. Pins are kept with the cache, across restarts of the
+// daemon.
+func (s *Server) Pin(ctx context.Context, imageID string, sources []Source, opts PrefetchOptions) (PrefetchResult, error) {
+	if err := ValidatePrefetchPatterns(opts.Patterns); err != nil {
+		return PrefetchResult{}, err
+	}
+	ctx, done, err := s.enter(ctx)
+	if err != nil {
+		return PrefetchResult{}, err
+	}
+	defer done()
+	f, release := s.hold(imageID, sources)
+	defer release()
+	// 准备缓存可能清空它的目录，之后才记录固定的路径
+	if err := f.Prepare(ctx); err != nil {
+		return PrefetchResult{}, err
+	}
+	s.pinMu.Lock()
+	pins, err := Pins(s.root, imageID)
+	if err == nil {
+		pinned := make(map[string]bool)
+		for _, p := range pins {
+			pinned[p] = true
+		}
+		for _, p := range cleanPins(opts.Patterns) {
+			if !pinned[p] {
+				pinned[p] = true
+				pins = append(pins, p)
+			}
+		}
+		err = savePins(f.root, pins)
+	}
+	s.pinMu.Unlock()
+	if err != nil {
+		return PrefetchResult{}, err
+	}
+	return s.PrefetchImage(ctx, imageID, sources, opts)
+}
+
+// Unpin unpins the globs patterns from the cache of imageID, so that the
+// files matching them may be evicted again. It returns those that were not
+// pinned, which are ignored.
+func (s *Server) Unpin(imageID string, patterns []string) ([]string, error) {
+	s.pinMu.Lock()
+	defer s.pinMu.Unlock()
+	pins, err := Pins(s.root, imageID)
+	if err != nil {
+		return nil, err
+	}
+	unpin := make(map[string]bool)
+	for _, p := range cleanPins(patterns) {
+		unpin[p] = true
+	}
+	var kept []string
+	for _, p := range pins {
+		if unpin[p] {
+			delete(unpin, p)
+			continue
+		}
+		kept = append(kept, p)
+	}
+	var notPinned []string
+	for p := range unpin {
+		notPinned = append(notPinned, p)
+	}
+	sort.Strings(notPinned)
+	if len(kept) == len(pins) {
+		return notPinned, nil
+	}
+	return notPinned, savePins(filepath.Join(s.root, imageID), kept)
+}
@@ -0,0 +1,325 @@
+package simplify // import "github.com/docker/docker/daemon/simplify"
+
+import (
+	"archive/tar"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/docker/layer"
+	"github.com/docker/docker/pkg/archive"
+	"github.com/docker/docker/pkg/directory"
+	"github.com/docker/docker/pkg/ioutils"
+	"github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
+)
+
+// materializedFile marks a cache holding every file of the full image.
+const materializedFile = "materialized"
+
+// Materialized returns true once Prefetch has fetched every file of the
+// full image.
+func (f *Fetcher) Materialized() bool {
+	_, err := os.Stat(filepath.Join(f.root, materializedFile))
+	return err == nil
+}
+
+// Materialized returns true if every file of the full image of imageID has
+// been fetched into the cache under root.
+func Materialized(root, imageID string) bool {
+	return NewFetcher(filepath.Join(root, imageID), nil).Materialized()
+}
+
+// CacheSize returns the size of the files fetched for imageID into the cache
+// under root.
+func CacheSize(ctx context.Context, root, imageID string) (int64, error) {
+	size, err := directory.Size(ctx, CacheDir(root, imageID))
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	return size, err
+}
+
+// layerDoneFile marks a layer whose files have all been prefetched, so an
+// interrupted prefetch does not read it again.
+func (f *Fetcher) layerDoneFile(diffID layer.DiffID) string {
+	return filepath.Join(f.root, "layers", digest.Digest(diffID).Hex())
+}
+
+// PrefetchOptions holds parameters to prefetch the files of the full image.
+type PrefetchOptions struct {
+	// BytesPerSec limits reading the layers, 0 meaning unlimited.
+	BytesPerSec int64
+	// Patterns restricts the prefetch to the paths matching one of these
+	// globs, or inside a directory matching one. Every file is prefetched
+	// if empty.
+	Patterns []string
+	// Progress, if set, wraps the layers as they are read, to report the
+	// progress of reading them.
+	Progress func(diffID layer.DiffID, rc io.ReadCloser) io.ReadCloser
+}
+
+// PrefetchResult counts the files a prefetch moved into the cache.
+type PrefetchResult struct {
+	Files int
+	Bytes int64
+}
+
+// ValidatePrefetchPatterns returns an error if one of patterns is not a
+// valid glob.
+func ValidatePrefetchPatterns(patterns []string) error {
+	for _, p := range patterns {
+		if _, err := path.Match(p, ""); err != nil {
+			return errors.Wrapf(err, "invalid prefetch path %q", p)
+		}
+	}
+	return nil
+}
+
+// matchPath returns true if p, or one of its parent directories, matches
+// one of patterns.
+func matchPath(patterns []string, p string) bool {
+	for {
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(pattern, p); ok {
+				return true
+			}
+		}
+		if p == "/" {
+			return false
+		}
+		p = filepath.Dir(p)
+	}
+}
+
+// Prefetch fetches every file of the full image that is not in the cache
+// yet, or only those matching opts.Patterns. Files already fetched on demand
+// are left untouched. A prefetch that is interrupted resumes from the layers
+// it had not completed, and one of an image already materialized does
+// nothing.
+func (f *Fetcher) Prefetch(ctx context.Context, opts PrefetchOptions) (PrefetchResult, error) {
+	var res PrefetchResult
+	if f.Materialized() {
+		return res, nil
+	}
+	if err := ValidatePrefetchPatterns(opts.Patterns); err != nil {
+		return res, err
+	}
+	patterns := make([]string, len(opts.Patterns))
+	for n, p := range opts.Patterns {
+		patterns[n] = path.Clean("/" + p)
+	}
+	if err := os.MkdirAll(filepath.Join(f.root, "layers"), 0755); err != nil {
+		return res, err
+	}
+
+	var limiter *rate.Limiter
+	if opts.BytesPerSec > 0 {
+		limiter = rate.NewLimiter(rate.Limit(opts.BytesPerSec), int(opts.BytesPerSec))
+	}
+
+	// 上层中已出现的文件，以及上层的whiteout和不透明目录，都会遮住下层的同名文件
+	seen := make(map[string]bool)
+	hidden := make(map[string]bool)
+	for _, src := range f.sources {
+		done := f.layerDoneFile(src.DiffID())
+		layerHidden, err := readLines(done)
+		if err != nil && !os.IsNotExist(err) {
+			return res, err
+		}
+		if os.IsNotExist(err) {
+			if layerHidden, err = f.prefetchLayer(ctx, src, limiter, opts.Progress, patterns, seen, hidden, &res); err != nil {
+				return res, err
+			}
+			// 只拉取了部分文件的层下次仍需读取
+			if len(patterns) == 0 {
+				if err := ioutils.AtomicWriteFile(done, []byte(strings.Join(layerHidden, "\n")), 0644); err != nil {
+					return res, err
+				}
+			}
+		}
+		// whiteout只遮住更下面的层
+		for _, p := range layerHidden {
+			hidden[p] = true
+		}
+	}
+	if len(patterns) > 0 {
+		return res, nil
+	}
+	return res, ioutil.WriteFile(filepath.Join(f.root, materializedFile), nil, 0644)
+}
+
+// prefetchLayer fetches the files src provides that are not in the cache,
+// and match patterns if any, counting them in res. It returns the paths the
+// layer hides from the layers beneath it. The files are staged until the
+// whole layer has been read and matches its diff ID, and only then moved
+// into the cache.
+func (f *Fetcher) prefetchLayer(ctx context.Context, src Source, limiter *rate.Limiter, progress func(layer.DiffID, io.ReadCloser) io.ReadCloser, patterns []string, seen, hidden map[string]bool, res *PrefetchResult) ([]string, error) {
+	rc, err := src.Open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if progress != nil {
+		rc = progress(src.DiffID(), rc)
+	}
+	defer rc.Close()
+
+	var r io.Reader = rc
+	if limiter != nil {
+		r = &limitedReader{ctx: ctx, r: rc, limiter: limiter}
+	}
+	vr := newVerifiedReader(r, src.DiffID())
+
+	stage, err := ioutil.TempDir(f.tmpDir(), "prefetch-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(stage)
+
+	var staged []*tar.Header
+	layerHidden, err := scanLayer(ctx, vr, seen, hidden, func(name string, hdr *tar.Header, r io.Reader) error {
+		if len(patterns) > 0 && !matchPath(patterns, name) {
+			return nil
+		}
+		switch hdr.Typeflag {
+		case tar.TypeReg, tar.TypeRegA, tar.TypeGNUSparse, tar.TypeSymlink:
+			if _, err := os.Lstat(filepath.Join(f.Dir(), name)); err == nil {
+				// 已按需拉取的文件不再下载
+				return nil
+			}
+			if err := f.extract(filepath.Join(stage, name), hdr, r, nil); err != nil {
+				logrus.WithError(err).WithField("path", name).Debug("simplify prefetch skipped file")
+				return nil
+			}
+			staged = append(staged, &tar.Header{Name: name, Typeflag: hdr.Typeflag, Size: hdr.Size})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := vr.verify(); err != nil {
+		return nil, err
+	}
+	for _, hdr := range staged {
+		moved, err := f.prefetchEntry(hdr.Name, filepath.Join(stage, hdr.Name))
+		if err != nil {
+			logrus.WithError(err).WithField("path", hdr.Name).Debug("simplify prefetch skipped file")
+			continue
+		}
+		if moved {
+			res.Files++
+			if hdr.Typeflag != tar.TypeSymlink {
+				res.Bytes += hdr.Size
+			}
+		}
+	}
+	return layerHidden, nil
+}
+
+// scanLayer calls fn for every entry of the layer read from r that is not
+// hidden by the layers above it, as recorded in seen and hidden. It returns
+// the paths the layer hides from the layers beneath it.
+func scanLayer(ctx context.Context, r io.Reader, seen, hidden map[string]bool, fn func(name string, hdr *tar.Header, r io.Reader) error) ([]string, error) {
+	var layerHidden []string
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return layerHidden, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		name := filepath.Clean("/" + hdr.Name)
+		base := filepath.Base(name)
+		switch {
+		case base == archive.WhiteoutOpaqueDir:
+			layerHidden = append(layerHidden, filepath.Dir(name))
+			continue
+		case strings.HasPrefix(base, archive.WhiteoutPrefix):
+			layerHidden = append(layerHidden, filepath.Join(filepath.Dir(name), strings.TrimPrefix(base, archive.WhiteoutPrefix)))
+			continue
+		}
+		if seen[name] || isHidden(hidden, name) {
+			continue
+		}
+		seen[name] = true
+		if hdr.Typeflag != tar.TypeDir {
+			// 不是目录的条目遮住下层的同名文件，以及被它替换的同名目录中的文件
+			layerHidden = append(layerHidden, name)
+		}
+		if err := fn(name, hdr, tr); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func readLines(path string) ([]string, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil || len(b) == 0 {
+		return nil, err
+	}
+	return strings.Split(string(b), "\n"), nil
+}
+
+// prefetchEntry moves the file staged for name into the cache unless it was
+// fetched on demand meanwhile, and returns whether it did.
+func (f *Fetcher) prefetchEntry(name, staged string) (moved bool, retErr error) {
+	defer func() {
+		if moved && retErr == nil {
+			f.notified(name)
+		}
+	}()
+	f.locker.Lock(name)
+	defer f.locker.Unlock(name)
+
+	target := filepath.Join(f.Dir(), name)
+	if _, err := os.Lstat(target); err == nil {
+		return false, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return false, err
+	}
+	return true, os.Rename(staged, target)
+}
+
+// isHidden returns true if p or one of its parents is in hidden.
+func isHidden(hidden map[string]bool, p string) bool {
+	for ; p != "/"; p = filepath.Dir(p) {
+		if hidden[p] {
+			return true
+		}
+	}
+	return false
+}
+
+// limitedReader throttles reads from r to the rate of limiter.
+type limitedReader struct {
+	ctx     context.Context
+	r       io.Reader
+	limiter *rate.Limiter
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if burst := l.limiter.Burst(); len(p) > burst {
+		p = p[:burst]
+	}
+	n, err := l.r.Read(p)
+	if n > 0 {
+		if werr := l.limiter.WaitN(l.ctx, n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,478 @@
+package simplify // import "github.com/docker/docker/daemon/simplify"
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/containerd/containerd/platforms"
+	"github.com/docker/docker/pkg/ioutils"
+	"github.com/docker/docker/pkg/stringid"
+	"github.com/opencontainers/go-digest"
+	specs "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// ErrRecordNotSupported is returned when file accesses cannot be recorded
+// on this platform.
+var ErrRecordNotSupported = errors.New("recording file accesses is not supported on this platform")
+
+// ErrWindowsNotSupported is returned by Windows daemons for every request
+// to simplify images or to run containers on simplified images.
+var ErrWindowsNotSupported = errors.New("image simplification is not supported on Windows")
+
+// ErrRootlessNotSupported is returned by daemons running in a user
+// namespace, as rootless daemons do, for every request to run containers on
+// simplified images: they can neither mount overlays with the simplify
+// options nor point the overlay module at the fetch helper.
+var ErrRootlessNotSupported = errors.New("simplified containers are not supported by daemons running in a user namespace (rootless)")
+
+// Profile lists the files a container opened while its accesses were
+// recorded.
+type Profile struct {
+	// Image is the ID of the image the container ran, once the profile is
+	// stored for it.
+	Image digest.Digest `json:"image,omitempty"`
+	// Reference is the name the container referred to the image by.
+	Reference string `json:"reference,omitempty"`
+	// Platform is the platform the container ran on, as returned by
+	// FormatPlatform, or empty if it is not known.
+	Platform string `json:"platform,omitempty"`
+	// Created is when the profile was stored.
+	Created time.Time `json:"created,omitempty"`
+	// Paths are the absolute paths inside the container, sorted.
+	Paths []string `json:"paths"`
+	// Truncated is true if accesses were dropped, either because too many
+	// files were opened or because the kernel queue overflowed.
+	Truncated bool `json:"truncated,omitempty"`
+	// Runs are the IDs of the recorded runs the profile was made from.
+	Runs []string `json:"runs,omitempty"`
+	// Counts are the number of runs each path was opened in. A nil map means
+	// every path was opened in every run.
+	Counts map[string]int `json:"counts,omitempty"`
+}
+
+// RunProfilePath returns the path the profile recorded by the last run of
+// the container whose root is containerRoot is saved to.
+func RunProfilePath(containerRoot string) string {
+	return filepath.Join(containerRoot, "simplify-profile.json")
+}
+
+// OpenedProfilePath returns the path the files opened by the runs of the
+// container whose root is containerRoot in simplified mode are saved to, for
+// storage drivers which do not copy them up into its writable layer.
+func OpenedProfilePath(containerRoot string) string {
+	return filepath.Join(containerRoot, "simplify-opened.json")
+}
+
+// NumRuns returns the number of recorded runs the profile was made from.
+func (p *Profile) NumRuns() int {
+	if len(p.Runs) == 0 {
+		return 1
+	}
+	return len(p.Runs)
+}
+
+// Count returns the number of runs path was opened in.
+func (p *Profile) Count(path string) int {
+	if p.Counts == nil {
+		return p.NumRuns()
+	}
+	return p.Counts[path]
+}
+
+// FormatPlatform returns the platform of an image of the operating system os
+// and the architecture arch, such as "linux/arm64", or an empty string if
+// either is unknown. Variants are left out as image configs do not record
+// them.
+func FormatPlatform(os, arch string) string {
+	if os == "" || arch == "" {
+		return ""
+	}
+	p := platforms.Normalize(specs.Platform{OS: os, Architecture: arch})
+	p.Variant = ""
+	return platforms.Format(p)
+}
+
+// ValidateThreshold returns an error if threshold is not a percentage.
+func ValidateThreshold(threshold int) error {
+	if threshold < 0 || threshold > 100 {
+		return fmt.Errorf("invalid simplify threshold %d: must be between 0 and 100", threshold)
+	}
+	return nil
+}
+
+// Split divides the paths of the profile into those opened in at least
+// threshold percent of its runs and those, below the threshold, opened in
+// fewer. A threshold of 0 keeps every path.
+func (p *Profile) Split(threshold int) (keep, below []string) {
+	runs := p.NumRuns()
+	for _, path := range p.Paths {
+		if p.Count(path)*100 >= threshold*runs {
+			keep = append(keep, path)
+		} else {
+			below = append(below, path)
+		}
+	}
+	return keep, below
+}
+
+// ErrRunsOverlap is returned by MergeProfiles when profiles share some, but
+// not all, of their runs.
+var ErrRunsOverlap = errors.New("profiles share recorded runs")
+
+// MergeProfiles returns the union of the files of profiles, counting the
+// runs each was opened in. A profile whose runs were all merged already is
+// skipped so that no run is counted twice, and a profile without runs counts
+// as a single run.
+func MergeProfiles(profiles []*Profile) (*Profile, error) {
+	merged := &Profile{Counts: make(map[string]int)}
+	merging := make(map[string]bool)
+	for _, p := range profiles {
+		runs := p.Runs
+		if len(runs) == 0 {
+			// 没有记录运行ID的profile视为一次单独的运行
+			runs = []string{stringid.GenerateRandomID()}
+		}
+		included := 0
+		for _, run := range runs {
+			if merging[run] {
+				included++
+			}
+		}
+		if included == len(runs) {
+			continue
+		}
+		if included > 0 {
+			return nil, ErrRunsOverlap
+		}
+		for _, run := range runs {
+			merging[run] = true
+			merged.Runs = append(merged.Runs, run)
+		}
+		for _, path := range p.Paths {
+			if merged.Counts[path] == 0 {
+				merged.Paths = append(merged.Paths, path)
+			}
+			merged.Counts[path] += p.Count(path)
+		}
+		merged.Truncated = merged.Truncated || p.Truncated
+	}
+	sort.Strings(merged.Paths)
+	return merged, nil
+}
+
+// LoadProfile reads the profile saved at path. It returns an error
+// satisfying os.IsNotExist if there is none.
+func LoadProfile(path string) (*Profile, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var p Profile
+	if err := json.Unmarshal(b, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// DefaultMaxProfileSize is the largest profile, in bytes of JSON, imported
+// or used unless the daemon is configured otherwise.
+const DefaultMaxProfileSize = 8 << 20
+
+// InvalidProfileError is returned for a profile failing validation. Path is
+// the offending entry, if the profile is rejected for one of its entries.
+type InvalidProfileError struct {
+	Path   string
+	Reason string
+}
+
+func (e InvalidProfileError) Error() string {
+	if e.Path == "" {
+		return "invalid simplify profile: " + e.Reason
+	}
+	return fmt.Sprintf("invalid simplify profile entry %q: %s", e.Path, e.Reason)
+}
+
+// ParseProfile decodes and validates the profile b, such as one pushed along
+// with an image or saved with it. Profiles larger than max bytes are
+// rejected, unless max is 0. The paths of the profile returned are cleaned
+// and sorted.
+func ParseProfile(b []byte, max int64) (*Profile, error) {
+	if max > 0 && int64(len(b)) > max {
+		return nil, InvalidProfileError{Reason: fmt.Sprintf("%d bytes exceed the maximum of %d", len(b), max)}
+	}
+	var raw struct {
+		Counts json.RawMessage `json:"counts"`
+	}
+	var p Profile
+	if err := json.Unmarshal(b, &p); err != nil {
+		return nil, InvalidProfileError{Reason: err.Error()}
+	}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return nil, InvalidProfileError{Reason: err.Error()}
+	}
+	// 重复的键在解码时被覆盖，需要从原始JSON中找出
+	if err := checkDuplicateCounts(raw.Counts); err != nil {
+		return nil, err
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	p.clean()
+	return &p, nil
+}
+
+// checkDuplicateCounts rejects the counts of a profile, as JSON, listing a
+// path twice with different counts.
+func checkDuplicateCounts(b json.RawMessage) error {
+	if len(b) == 0 || string(b) == "null" {
+		return nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	if _, err := dec.Token(); err != nil {
+		return InvalidProfileError{Reason: err.Error()}
+	}
+	counts := make(map[string]json.Number)
+	dec.UseNumber()
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return InvalidProfileError{Reason: err.Error()}
+		}
+		path, _ := tok.(string)
+		var count json.Number
+		if err := dec.Decode(&count); err != nil {
+			return InvalidProfileError{Path: path, Reason: err.Error()}
+		}
+		if prev, ok := counts[path]; ok && prev != count {
+			return InvalidProfileError{Path: path, Reason: fmt.Sprintf("counted both %s and %s times", prev, count)}
+		}
+		counts[path] = count
+	}
+	return nil
+}
+
+// Validate checks the entries of the profile: every path must be absolute,
+// must not go up with "..", and must not contain a NUL byte, and paths
+// listed more than once, once cleaned, must have the same count. The count
+// of a path must be between 1 and the number of runs of the profile.
+func (p *Profile) Validate() error {
+	runs := p.NumRuns()
+	seen := make(map[string]string)
+	for _, path := range p.Paths {
+		if strings.IndexByte(path, 0) >= 0 {
+			return InvalidProfileError{Path: path, Reason: "contains a NUL byte"}
+		}
+		if !strings.HasPrefix(path, "/") {
+			return InvalidProfileError{Path: path, Reason: "is not absolute"}
+		}
+		for _, elem := range strings.Split(path, "/") {
+			if elem == ".." {
+				return InvalidProfileError{Path: path, Reason: "escapes the root of the image"}
+			}
+		}
+		if p.Counts != nil {
+			if count := p.Counts[path]; count < 1 || count > runs {
+				return InvalidProfileError{Path: path, Reason: fmt.Sprintf("opened in %d of %d runs", count, runs)}
+			}
+		}
+		clean := filepath.Clean(path)
+		if other, ok := seen[clean]; ok && p.Count(other) != p.Count(path) {
+			return InvalidProfileError{Path: path, Reason: fmt.Sprintf("conflicts with %q", other)}
+		}
+		seen[clean] = path
+	}
+	return nil
+}
+
+// clean cleans the paths of a valid profile, listing each once, sorted.
+func (p *Profile) clean() {
+	paths, counts := p.Paths, p.Counts
+	p.Paths = nil
+	if counts != nil {
+		p.Counts = make(map[string]int)
+	}
+	seen := make(map[string]bool)
+	for _, path := range paths {
+		clean := filepath.Clean(path)
+		if seen[clean] {
+			continue
+		}
+		seen[clean] = true
+		p.Paths = append(p.Paths, clean)
+		if counts != nil {
+			p.Counts[clean] = counts[path]
+		}
+	}
+	sort.Strings(p.Paths)
+}
+
+// Save writes the profile to path.
+func (p *Profile) Save(path string) error {
+	b, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	return ioutils.AtomicWriteFile(path, b, 0600)
+}
+
+// ProfileRoot returns the directory the profiles of images are stored in.
+func ProfileRoot(daemonRoot string) string {
+	return filepath.Join(daemonRoot, "simplify", "profiles")
+}
+
+// ProfileStore stores the profiles of images, keyed by image ID and by the
+// platform they were recorded on.
+type ProfileStore struct {
+	root string
+	mu   sync.Mutex
+}
+
+// ProfileKey identifies a profile in a ProfileStore.
+type ProfileKey struct {
+	Image    digest.Digest
+	Platform string
+}
+
+// NewProfileStore returns a store keeping profiles in root.
+func NewProfileStore(root string) *ProfileStore {
+	return &ProfileStore{root: root}
+}
+
+func (s *ProfileStore) path(id digest.Digest, platform string) string {
+	if platform == "" {
+		// 未知平台的profile保持原来的文件名
+		return filepath.Join(s.root, id.Hex()+".json")
+	}
+	return filepath.Join(s.root, id.Hex()+"_"+strings.Replace(platform, "/", "_", -1)+".json")
+}
+
+// Get returns the profile of the image id recorded on platform. It returns
+// an error satisfying os.IsNotExist if there is none.
+func (s *ProfileStore) Get(id digest.Digest, platform string) (*Profile, error) {
+	if err := id.Validate(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return LoadProfile(s.path(id, platform))
+}
+
+// Lookup returns the profile of the image id recorded on platform, or else
+// the one recorded on an unknown platform. An empty platform matches any.
+// If there is no such profile, it returns an error satisfying os.IsNotExist
+// along with the platforms the profiles of id were recorded on instead.
+func (s *ProfileStore) Lookup(id digest.Digest, platform string) (*Profile, []string, error) {
+	p, err := s.Get(id, platform)
+	if !os.IsNotExist(err) {
+		return p, nil, err
+	}
+	if platform != "" {
+		if p, err = s.Get(id, ""); !os.IsNotExist(err) {
+			return p, nil, err
+		}
+	}
+	keys, lerr := s.List()
+	if lerr != nil {
+		return nil, nil, lerr
+	}
+	var recorded []string
+	for _, key := range keys {
+		if key.Image != id {
+			continue
+		}
+		if platform == "" {
+			p, err := s.Get(id, key.Platform)
+			return p, nil, err
+		}
+		recorded = append(recorded, key.Platform)
+	}
+	return nil, recorded, err
+}
+
+// Put stores p as the profile of the image id on the platform p was
+// recorded on, replacing any previous one.
+func (s *ProfileStore) Put(id digest.Digest, p *Profile) error {
+	if err := id.Validate(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.MkdirAll(s.root, 0700); err != nil {
+		return err
+	}
+	p.Image = id
+	if p.Created.IsZero() {
+		p.Created = time.Now().UTC()
+	}
+	return p.Save(s.path(id, p.Platform))
+}
+
+// Delete removes the profile of the image id recorded on platform. It
+// returns an error satisfying os.IsNotExist if there is none.
+func (s *ProfileStore) Delete(id digest.Digest, platform string) error {
+	if err := id.Validate(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return os.Remove(s.path(id, platform))
+}
+
+// DeleteImage removes the profiles of the image id recorded on every
+// platform.
+func (s *ProfileStore) DeleteImage(id digest.Digest) error {
+	if err := id.Validate(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	paths, err := filepath.Glob(filepath.Join(s.root, id.Hex()+"_*.json"))
+	if err != nil {
+		return err
+	}
+	for _, p := range append(paths, s.path(id, "")) {
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// List returns the keys of the stored profiles, sorted by image ID and
+// platform.
+func (s *ProfileStore) List() ([]ProfileKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	files, err := ioutil.ReadDir(s.root)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var keys []ProfileKey
+	for _, f := range files {
+		if filepath.Ext(f.Name()) != ".json" {
+			continue
+		}
+		name := strings.SplitN(strings.TrimSuffix(f.Name(), ".json"), "_", 2)
+		key := ProfileKey{Image: digest.NewDigestFromHex(string(digest.SHA256), name[0])}
+		if key.Image.Validate() != nil {
+			continue
+		}
+		if len(name) == 2 {
+			key.Platform = strings.Replace(name[1], "_", "/", -1)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
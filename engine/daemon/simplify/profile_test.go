@@ -0,0 +1,224 @@
+package simplify // import "github.com/docker/docker/daemon/simplify"
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+func TestProfileSave(t *testing.T) {
+	dir, err := ioutil.TempDir("", "simplify-profile")
+	assert.NilError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "profile.json")
+
+	_, err = LoadProfile(path)
+	assert.Check(t, os.IsNotExist(err))
+
+	p := &Profile{Paths: []string{"/bin/sh", "/etc/passwd"}, Truncated: true}
+	assert.NilError(t, p.Save(path))
+	loaded, err := LoadProfile(path)
+	assert.NilError(t, err)
+	assert.Check(t, is.DeepEqual(loaded, p))
+}
+
+func TestProfileStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "simplify-profiles")
+	assert.NilError(t, err)
+	defer os.RemoveAll(dir)
+	s := NewProfileStore(filepath.Join(dir, "profiles"))
+
+	ids, err := s.List()
+	assert.NilError(t, err)
+	assert.Check(t, is.Len(ids, 0))
+
+	id := digest.FromString("image")
+	_, err = s.Get(id, "")
+	assert.Check(t, os.IsNotExist(err))
+	assert.Check(t, s.Put("invalid", &Profile{}) != nil)
+
+	assert.NilError(t, s.Put(id, &Profile{Reference: "app:latest", Paths: []string{"/bin/sh"}}))
+	p, err := s.Get(id, "")
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(p.Image, id))
+	assert.Check(t, is.Equal(p.Reference, "app:latest"))
+	assert.Check(t, !p.Created.IsZero())
+	assert.Check(t, is.DeepEqual(p.Paths, []string{"/bin/sh"}))
+
+	ids, err = s.List()
+	assert.NilError(t, err)
+	assert.Check(t, is.DeepEqual(ids, []ProfileKey{{Image: id}}))
+
+	assert.NilError(t, s.Delete(id, ""))
+	assert.Check(t, os.IsNotExist(s.Delete(id, "")))
+}
+
+func TestProfileStoreLookup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "simplify-profiles")
+	assert.NilError(t, err)
+	defer os.RemoveAll(dir)
+	s := NewProfileStore(filepath.Join(dir, "profiles"))
+
+	id := digest.FromString("image")
+	assert.NilError(t, s.Put(id, &Profile{Platform: "linux/amd64", Paths: []string{"/lib/x86_64-linux-gnu/libc.so.6"}}))
+	assert.NilError(t, s.Put(id, &Profile{Platform: "linux/arm64", Paths: []string{"/lib/aarch64-linux-gnu/libc.so.6"}}))
+	keys, err := s.List()
+	assert.NilError(t, err)
+	assert.Check(t, is.DeepEqual(keys, []ProfileKey{{Image: id, Platform: "linux/amd64"}, {Image: id, Platform: "linux/arm64"}}))
+
+	p, recorded, err := s.Lookup(id, "linux/arm64")
+	assert.NilError(t, err)
+	assert.Check(t, is.DeepEqual(p.Paths, []string{"/lib/aarch64-linux-gnu/libc.so.6"}))
+	assert.Check(t, is.Len(recorded, 0))
+
+	// only profiles recorded on other platforms
+	_, recorded, err = s.Lookup(id, "linux/ppc64le")
+	assert.Check(t, os.IsNotExist(err))
+	assert.Check(t, is.DeepEqual(recorded, []string{"linux/amd64", "linux/arm64"}))
+
+	// any platform matches an unknown one
+	p, _, err = s.Lookup(id, "")
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(p.Platform, "linux/amd64"))
+
+	// profiles recorded on an unknown platform match any
+	assert.NilError(t, s.Put(id, &Profile{Paths: []string{"/bin/sh"}}))
+	p, _, err = s.Lookup(id, "linux/ppc64le")
+	assert.NilError(t, err)
+	assert.Check(t, is.DeepEqual(p.Paths, []string{"/bin/sh"}))
+
+	_, recorded, err = s.Lookup(digest.FromString("other"), "linux/amd64")
+	assert.Check(t, os.IsNotExist(err))
+	assert.Check(t, is.Len(recorded, 0))
+}
+
+func TestFormatPlatform(t *testing.T) {
+	assert.Check(t, is.Equal(FormatPlatform("linux", "amd64"), "linux/amd64"))
+	assert.Check(t, is.Equal(FormatPlatform("linux", "aarch64"), "linux/arm64"))
+	assert.Check(t, is.Equal(FormatPlatform("linux", "arm"), "linux/arm"))
+	assert.Check(t, is.Equal(FormatPlatform("", "amd64"), ""))
+}
+
+func TestMergeProfiles(t *testing.T) {
+	a := &Profile{Runs: []string{"a"}, Paths: []string{"/bin/sh", "/etc/a.conf"}}
+	b := &Profile{Runs: []string{"b"}, Paths: []string{"/bin/sh", "/etc/b.conf"}, Truncated: true}
+	ab, err := MergeProfiles([]*Profile{a, b})
+	assert.NilError(t, err)
+	assert.Check(t, is.DeepEqual(ab.Runs, []string{"a", "b"}))
+	assert.Check(t, is.DeepEqual(ab.Paths, []string{"/bin/sh", "/etc/a.conf", "/etc/b.conf"}))
+	assert.Check(t, is.DeepEqual(ab.Counts, map[string]int{"/bin/sh": 2, "/etc/a.conf": 1, "/etc/b.conf": 1}))
+	assert.Check(t, ab.Truncated)
+
+	// runs merged already are not counted twice
+	c := &Profile{Runs: []string{"c"}, Paths: []string{"/etc/a.conf"}}
+	merged, err := MergeProfiles([]*Profile{ab, a, c, {Paths: []string{"/bin/sh"}}})
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(merged.NumRuns(), 4))
+	assert.Check(t, is.Equal(merged.Count("/bin/sh"), 3))
+	assert.Check(t, is.Equal(merged.Count("/etc/a.conf"), 2))
+	assert.Check(t, is.Equal(a.Count("/etc/a.conf"), 1))
+
+	_, err = MergeProfiles([]*Profile{ab, {Runs: []string{"a", "d"}}})
+	assert.Check(t, is.Equal(err, ErrRunsOverlap))
+}
+
+func TestProfileSplit(t *testing.T) {
+	p := &Profile{
+		Paths:  []string{"/bin/app", "/etc/app.conf", "/usr/lib/plugin.so"},
+		Runs:   []string{"a", "b", "c"},
+		Counts: map[string]int{"/bin/app": 3, "/etc/app.conf": 2, "/usr/lib/plugin.so": 1},
+	}
+	for _, tc := range []struct {
+		threshold   int
+		keep, below []string
+	}{
+		{threshold: 0, keep: []string{"/bin/app", "/etc/app.conf", "/usr/lib/plugin.so"}},
+		{threshold: 33, keep: []string{"/bin/app", "/etc/app.conf", "/usr/lib/plugin.so"}},
+		{threshold: 34, keep: []string{"/bin/app", "/etc/app.conf"}, below: []string{"/usr/lib/plugin.so"}},
+		{threshold: 100, keep: []string{"/bin/app"}, below: []string{"/etc/app.conf", "/usr/lib/plugin.so"}},
+	} {
+		keep, below := p.Split(tc.threshold)
+		assert.Check(t, is.DeepEqual(keep, tc.keep), "threshold %d", tc.threshold)
+		assert.Check(t, is.DeepEqual(below, tc.below), "threshold %d", tc.threshold)
+	}
+
+	// a single run opened every path it recorded
+	keep, below := (&Profile{Paths: []string{"/bin/app"}}).Split(100)
+	assert.Check(t, is.DeepEqual(keep, []string{"/bin/app"}))
+	assert.Check(t, is.Len(below, 0))
+}
+
+func TestParseProfile(t *testing.T) {
+	p, err := ParseProfile([]byte(`{"paths":["/etc/./app.conf","/bin/app","/bin//app"],"runs":["a","b"],"counts":{"/etc/./app.conf":1,"/bin/app":2,"/bin//app":2}}`), 0)
+	assert.NilError(t, err)
+	assert.Check(t, is.DeepEqual(p.Paths, []string{"/bin/app", "/etc/app.conf"}))
+	assert.Check(t, is.DeepEqual(p.Counts, map[string]int{"/bin/app": 2, "/etc/app.conf": 1}))
+
+	for _, tc := range []struct {
+		profile string
+		max     int64
+		err     string
+	}{
+		{profile: `{"paths":["/etc/../../etc/shadow"]}`, err: `invalid simplify profile entry "/etc/../../etc/shadow": escapes the root of the image`},
+		{profile: `{"paths":["etc/app.conf"]}`, err: `invalid simplify profile entry "etc/app.conf": is not absolute`},
+		{profile: `{"paths":["/etc/app.conf\u0000.bak"]}`, err: `invalid simplify profile entry "/etc/app.conf\x00.bak": contains a NUL byte`},
+		{profile: `{"paths":["/bin/app","/bin//app"],"runs":["a","b"],"counts":{"/bin/app":2,"/bin//app":1}}`, err: `invalid simplify profile entry "/bin//app": conflicts with "/bin/app"`},
+		{profile: `{"paths":["/bin/app"],"runs":["a","b"],"counts":{"/bin/app":2,"/bin/app":1}}`, err: `invalid simplify profile entry "/bin/app": counted both 2 and 1 times`},
+		{profile: `{"paths":["/bin/app"],"runs":["a"],"counts":{"/bin/app":3}}`, err: `invalid simplify profile entry "/bin/app": opened in 3 of 1 runs`},
+		{profile: `{"paths":["/bin/app"]}`, max: 10, err: `invalid simplify profile: 22 bytes exceed the maximum of 10`},
+		{profile: `{"paths":"/bin/app"}`, err: `invalid simplify profile: json: cannot unmarshal string into Go struct field Profile.paths of type []string`},
+	} {
+		_, err := ParseProfile([]byte(tc.profile), tc.max)
+		assert.Check(t, is.Error(err, tc.err), tc.profile)
+	}
+}
+
+// TestParseProfileFuzz feeds ParseProfile random mutations of valid profiles:
+// it must never panic, and the profiles it accepts must be valid and survive
+// being encoded and parsed again.
+func TestParseProfileFuzz(t *testing.T) {
+	seeds := []string{
+		`{"paths":["/bin/app","/etc/app.conf"]}`,
+		`{"paths":["/bin/app","/usr/lib/x.so"],"runs":["a","b"],"counts":{"/bin/app":2,"/usr/lib/x.so":1}}`,
+		`{"image":"sha256:abc","platform":"linux/amd64","paths":["/"],"truncated":true}`,
+	}
+	tokens := []string{"..", "/", "\x00", `\u0000`, `"`, ",", ":", "{", "}", "[", "]", "0", "-1", "99", `"/a"`, `"../a"`}
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 20000; i++ {
+		b := []byte(seeds[r.Intn(len(seeds))])
+		for n := r.Intn(4) + 1; n > 0; n-- {
+			at := r.Intn(len(b) + 1)
+			switch r.Intn(3) {
+			case 0:
+				b = append(b[:at:at], append([]byte(tokens[r.Intn(len(tokens))]), b[at:]...)...)
+			case 1:
+				if at < len(b) {
+					b = append(b[:at:at], b[at+1:]...)
+				}
+			default:
+				if at < len(b) {
+					b[at] = byte(r.Intn(256))
+				}
+			}
+		}
+		p, err := ParseProfile(b, 0)
+		if err != nil {
+			_, ok := err.(InvalidProfileError)
+			assert.Assert(t, ok, "%q: %v", b, err)
+			continue
+		}
+		assert.NilError(t, p.Validate(), "%q", b)
+		encoded, err := json.Marshal(p)
+		assert.NilError(t, err)
+		again, err := ParseProfile(encoded, 0)
+		assert.NilError(t, err, "%q", b)
+		assert.Check(t, is.DeepEqual(again.Paths, p.Paths), "%q", b)
+	}
+}
@@ -0,0 +1,183 @@
+package simplify // import "github.com/docker/docker/daemon/simplify"
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// errQueueClosed is returned to the fetches waiting for a worker when the
+// server stops.
+var errQueueClosed = errors.New("simplify fetch server stopped")
+
+// fetchQueue bounds the number of files fetched on demand at once. Fetches
+// beyond the limit wait for a worker rather than fail, which keeps the
+// lookup of the missing file blocked in the container. Workers are handed
+// to the containers with waiting fetches in turn, so a container looking up
+// thousands of files does not starve the others.
+type fetchQueue struct {
+	mu sync.Mutex
+	// limit is the number of fetches run at once, 0 meaning unlimited
+	limit   int
+	running int
+	// mounts are the fetches of each mount ID, and order the mount IDs
+	// with fetches waiting, in the order they are served
+	mounts map[string]*mountFetches
+	order  []string
+	stop   <-chan struct{}
+}
+
+// mountFetches are the fetches of a container, at most limit of which run at
+// once if it is not 0.
+type mountFetches struct {
+	limit   int
+	running int
+	waiting []chan struct{}
+}
+
+func newFetchQueue(limit int, stop <-chan struct{}) *fetchQueue {
+	return &fetchQueue{
+		limit:  limit,
+		mounts: make(map[string]*mountFetches),
+		stop:   stop,
+	}
+}
+
+// setLimit sets the number of fetches run at once, 0 meaning unlimited.
+func (q *fetchQueue) setLimit(limit int) {
+	q.mu.Lock()
+	q.limit = limit
+	q.dispatch()
+	q.mu.Unlock()
+}
+
+// acquire waits for a worker to fetch a file for the container with the
+// given mount ID, which runs at most limit fetches at once if it is not 0.
+// The func returned must be called once the fetch is done.
+func (q *fetchQueue) acquire(ctx context.Context, mountID string, limit int) (func(), error) {
+	q.mu.Lock()
+	m := q.mounts[mountID]
+	if m == nil {
+		m = &mountFetches{}
+		q.mounts[mountID] = m
+	}
+	m.limit = limit
+	if len(m.waiting) == 0 && q.available(m) {
+		q.start(m)
+		q.mu.Unlock()
+		return q.releaser(mountID, m), nil
+	}
+	ready := make(chan struct{})
+	if len(m.waiting) == 0 {
+		q.order = append(q.order, mountID)
+	}
+	m.waiting = append(m.waiting, ready)
+	q.mu.Unlock()
+
+	var err error
+	select {
+	case <-ready:
+		return q.releaser(mountID, m), nil
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-q.stop:
+		err = errQueueClosed
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	select {
+	case <-ready:
+		// 已分配到worker，交还给其他请求
+		q.finish(mountID, m)
+		return nil, err
+	default:
+	}
+	for n, w := range m.waiting {
+		if w == ready {
+			m.waiting = append(m.waiting[:n], m.waiting[n+1:]...)
+			break
+		}
+	}
+	if len(m.waiting) == 0 {
+		q.unqueue(mountID)
+	}
+	q.forget(mountID, m)
+	return nil, err
+}
+
+func (q *fetchQueue) releaser(mountID string, m *mountFetches) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			q.mu.Lock()
+			q.finish(mountID, m)
+			q.mu.Unlock()
+		})
+	}
+}
+
+// available returns true if a fetch of m can start. q.mu must be held.
+func (q *fetchQueue) available(m *mountFetches) bool {
+	return (q.limit <= 0 || q.running < q.limit) && (m.limit <= 0 || m.running < m.limit)
+}
+
+// start counts a fetch of m as running. q.mu must be held.
+func (q *fetchQueue) start(m *mountFetches) {
+	q.running++
+	m.running++
+}
+
+// finish counts a fetch of m as done and hands its worker over. q.mu must be
+// held.
+func (q *fetchQueue) finish(mountID string, m *mountFetches) {
+	q.running--
+	m.running--
+	q.forget(mountID, m)
+	q.dispatch()
+}
+
+// dispatch starts the waiting fetches there are workers for, taking turns
+// between the mount IDs. q.mu must be held.
+func (q *fetchQueue) dispatch() {
+	for q.limit <= 0 || q.running < q.limit {
+		started := false
+		for n, mountID := range q.order {
+			m := q.mounts[mountID]
+			if !q.available(m) {
+				continue
+			}
+			ready := m.waiting[0]
+			m.waiting = m.waiting[1:]
+			q.start(m)
+			close(ready)
+			// 轮到下一个容器，本容器排到最后
+			q.order = append(q.order[:n], q.order[n+1:]...)
+			if len(m.waiting) > 0 {
+				q.order = append(q.order, mountID)
+			}
+			started = true
+			break
+		}
+		if !started {
+			return
+		}
+	}
+}
+
+// unqueue removes mountID from the order of the mount IDs served. q.mu must
+// be held.
+func (q *fetchQueue) unqueue(mountID string) {
+	for n, id := range q.order {
+		if id == mountID {
+			q.order = append(q.order[:n], q.order[n+1:]...)
+			return
+		}
+	}
+}
+
+// forget drops m once it has no fetch left. q.mu must be held.
+func (q *fetchQueue) forget(mountID string, m *mountFetches) {
+	if m.running == 0 && len(m.waiting) == 0 && q.mounts[mountID] == m {
+		delete(q.mounts, mountID)
+	}
+}
@@ -0,0 +1,160 @@
+package simplify // import "github.com/docker/docker/daemon/simplify"
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+// queued waits until n fetches are waiting in q.
+func queued(q *fetchQueue, n int) {
+	for {
+		q.mu.Lock()
+		waiting := 0
+		for _, m := range q.mounts {
+			waiting += len(m.waiting)
+		}
+		q.mu.Unlock()
+		if waiting == n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestFetchQueueFairness(t *testing.T) {
+	stop := make(chan struct{})
+	defer close(stop)
+	q := newFetchQueue(1, stop)
+	ctx := context.Background()
+
+	release, err := q.acquire(ctx, "busy", 0)
+	assert.NilError(t, err)
+
+	var (
+		mu     sync.Mutex
+		served []string
+		wg     sync.WaitGroup
+	)
+	fetch := func(mountID string) {
+		defer wg.Done()
+		release, err := q.acquire(ctx, mountID, 0)
+		assert.Check(t, err)
+		mu.Lock()
+		served = append(served, mountID)
+		mu.Unlock()
+		release()
+	}
+	// the busy container looks up many files before the quiet one looks up
+	// its own
+	for n := 0; n < 3; n++ {
+		wg.Add(1)
+		go fetch("busy")
+		queued(q, n+1)
+	}
+	wg.Add(1)
+	go fetch("quiet")
+	queued(q, 4)
+
+	release()
+	wg.Wait()
+	assert.Check(t, is.DeepEqual(served, []string{"busy", "quiet", "busy", "busy"}))
+	assert.Check(t, is.Len(q.mounts, 0))
+}
+
+func TestFetchQueueMountLimit(t *testing.T) {
+	stop := make(chan struct{})
+	defer close(stop)
+	q := newFetchQueue(0, stop)
+	ctx := context.Background()
+
+	first, err := q.acquire(ctx, "limited", 1)
+	assert.NilError(t, err)
+	// the limit of a container does not hold back the others
+	other, err := q.acquire(ctx, "unlimited", 0)
+	assert.NilError(t, err)
+	other()
+
+	timeout, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	_, err = q.acquire(timeout, "limited", 1)
+	assert.Check(t, is.Equal(err, context.DeadlineExceeded))
+
+	acquired := make(chan struct{})
+	go func() {
+		release, err := q.acquire(ctx, "limited", 1)
+		assert.Check(t, err)
+		release()
+		close(acquired)
+	}()
+	queued(q, 1)
+	first()
+	<-acquired
+	assert.Check(t, is.Len(q.mounts, 0))
+}
+
+func TestFetchQueueStop(t *testing.T) {
+	stop := make(chan struct{})
+	q := newFetchQueue(1, stop)
+	release, err := q.acquire(context.Background(), "mount", 0)
+	assert.NilError(t, err)
+	defer release()
+
+	errs := make(chan error)
+	go func() {
+		_, err := q.acquire(context.Background(), "mount", 0)
+		errs <- err
+	}()
+	queued(q, 1)
+	close(stop)
+	assert.Check(t, is.Equal(<-errs, errQueueClosed))
+}
+
+func TestFetchQueueStress(t *testing.T) {
+	const (
+		limit  = 16
+		mounts = 10
+		opens  = 10000
+	)
+	stop := make(chan struct{})
+	defer close(stop)
+	q := newFetchQueue(limit, stop)
+
+	var (
+		mu              sync.Mutex
+		running, maxRan int
+		wg              sync.WaitGroup
+	)
+	wg.Add(opens)
+	for n := 0; n < opens; n++ {
+		go func(mountID string) {
+			defer wg.Done()
+			release, err := q.acquire(context.Background(), mountID, 0)
+			if !assert.Check(t, err) {
+				return
+			}
+			mu.Lock()
+			running++
+			if running > maxRan {
+				maxRan = running
+			}
+			mu.Unlock()
+			time.Sleep(100 * time.Microsecond)
+			mu.Lock()
+			running--
+			mu.Unlock()
+			release()
+		}(fmt.Sprintf("mount%d", n%mounts))
+	}
+	wg.Wait()
+
+	assert.Check(t, maxRan <= limit, "%d fetches ran at once", maxRan)
+	assert.Check(t, is.Equal(q.running, 0))
+	assert.Check(t, is.Len(q.mounts, 0))
+	assert.Check(t, is.Len(q.order, 0))
+}
@@ -0,0 +1,193 @@
+package simplify // import "github.com/docker/docker/daemon/simplify"
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unsafe"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+// maxRecordedPaths bounds the memory used by a recording. Accesses to
+// further files are dropped and the profile is marked truncated.
+const maxRecordedPaths = 1 << 20
+
+// fanotify constants, see fanotify(7).
+const (
+	fanClassNotif = 0x0
+	fanCloexec    = 0x1
+	fanNonblock   = 0x2
+	fanMarkAdd    = 0x1
+	fanMarkMount  = 0x10
+	fanOpen       = 0x20
+	fanQOverflow  = 0x4000
+)
+
+// fanotifyEventMetadata is struct fanotify_event_metadata.
+type fanotifyEventMetadata struct {
+	EventLen    uint32
+	Vers        uint8
+	Reserved    uint8
+	MetadataLen uint16
+	Mask        uint64
+	Fd          int32
+	Pid         int32
+}
+
+const metadataSize = int(unsafe.Sizeof(fanotifyEventMetadata{}))
+
+// Recorder records the files opened in a container's root filesystem. It
+// watches the whole mount the root filesystem is on, so files opened by exec
+// sessions are recorded as well, but not those in volumes.
+type Recorder struct {
+	rootfs string
+	f      *os.File
+	done   chan struct{}
+
+	mu        sync.Mutex
+	paths     map[string]struct{}
+	truncated bool
+	notify    func(path string)
+}
+
+// NewRecorder starts recording the files opened under rootfs.
+func NewRecorder(rootfs string) (*Recorder, error) {
+	if unsafe.Sizeof(uintptr(0)) != 8 {
+		// 32位平台上fanotify_mark的掩码参数占用两个寄存器
+		return nil, ErrRecordNotSupported
+	}
+	fd, _, errno := unix.Syscall(unix.SYS_FANOTIFY_INIT, fanClassNotif|fanCloexec|fanNonblock, unix.O_RDONLY|unix.O_LARGEFILE|unix.O_CLOEXEC, 0)
+	if errno != 0 {
+		if errno == unix.ENOSYS {
+			return nil, ErrRecordNotSupported
+		}
+		return nil, os.NewSyscallError("fanotify_init", errno)
+	}
+	path, err := unix.BytePtrFromString(rootfs)
+	if err != nil {
+		unix.Close(int(fd))
+		return nil, err
+	}
+	dirfd := unix.AT_FDCWD
+	_, _, errno = unix.Syscall6(unix.SYS_FANOTIFY_MARK, fd, fanMarkAdd|fanMarkMount, fanOpen, uintptr(dirfd), uintptr(unsafe.Pointer(path)), 0)
+	if errno != 0 {
+		unix.Close(int(fd))
+		return nil, os.NewSyscallError("fanotify_mark", errno)
+	}
+
+	r := &Recorder{
+		rootfs: filepath.Clean(rootfs),
+		f:      os.NewFile(fd, "fanotify"),
+		done:   make(chan struct{}),
+		paths:  make(map[string]struct{}),
+	}
+	go r.read()
+	return r, nil
+}
+
+func (r *Recorder) read() {
+	defer close(r.done)
+	buf := make([]byte, 64*metadataSize)
+	for {
+		n, err := r.f.Read(buf)
+		if err != nil {
+			if !strings.Contains(err.Error(), os.ErrClosed.Error()) {
+				logrus.WithError(err).WithField("rootfs", r.rootfs).Warn("simplify: recording file accesses stopped")
+			}
+			return
+		}
+		for off := 0; off+metadataSize <= n; {
+			ev := (*fanotifyEventMetadata)(unsafe.Pointer(&buf[off]))
+			if ev.EventLen < uint32(metadataSize) {
+				break
+			}
+			r.handle(ev)
+			off += int(ev.EventLen)
+		}
+	}
+}
+
+func (r *Recorder) handle(ev *fanotifyEventMetadata) {
+	if ev.Mask&fanQOverflow != 0 {
+		r.mu.Lock()
+		r.truncated = true
+		r.mu.Unlock()
+	}
+	if ev.Fd < 0 {
+		return
+	}
+	defer unix.Close(int(ev.Fd))
+	if int(ev.Pid) == os.Getpid() {
+		// 守护进程自身的访问，例如docker cp和commit
+		return
+	}
+	p, err := os.Readlink("/proc/self/fd/" + strconv.Itoa(int(ev.Fd)))
+	if err != nil || strings.HasSuffix(p, " (deleted)") {
+		return
+	}
+	rel, err := filepath.Rel(r.rootfs, p)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+		// 同一挂载点上容器之外的文件
+		return
+	}
+	r.record(filepath.Clean("/" + rel))
+}
+
+func (r *Recorder) record(p string) {
+	r.mu.Lock()
+	if _, ok := r.paths[p]; ok {
+		r.mu.Unlock()
+		return
+	}
+	if len(r.paths) >= maxRecordedPaths {
+		r.truncated = true
+		r.mu.Unlock()
+		return
+	}
+	r.paths[p] = struct{}{}
+	notify := r.notify
+	r.mu.Unlock()
+	if notify != nil {
+		notify(p)
+	}
+}
+
+// Notify calls fn with the files recorded so far, then with each file
+// opened for the first time from now on. A file opened meanwhile may be
+// passed twice.
+func (r *Recorder) Notify(fn func(path string)) {
+	r.mu.Lock()
+	r.notify = fn
+	paths := make([]string, 0, len(r.paths))
+	for p := range r.paths {
+		paths = append(paths, p)
+	}
+	r.mu.Unlock()
+	for _, p := range paths {
+		fn(p)
+	}
+}
+
+// Profile returns the files recorded so far.
+func (r *Recorder) Profile() *Profile {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p := &Profile{Paths: make([]string, 0, len(r.paths)), Truncated: r.truncated}
+	for path := range r.paths {
+		p.Paths = append(p.Paths, path)
+	}
+	sort.Strings(p.Paths)
+	return p
+}
+
+// Close stops recording.
+func (r *Recorder) Close() error {
+	err := r.f.Close()
+	<-r.done
+	return err
+}
@@ -0,0 +1,62 @@
+package simplify // import "github.com/docker/docker/daemon/simplify"
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+	"gotest.tools/poll"
+)
+
+func TestRecorder(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("requires root to use fanotify")
+	}
+	rootfs, err := ioutil.TempDir("", "simplify-record")
+	assert.NilError(t, err)
+	defer os.RemoveAll(rootfs)
+	assert.NilError(t, os.MkdirAll(filepath.Join(rootfs, "etc"), 0755))
+	for _, name := range []string{"etc/opened", "etc/untouched"} {
+		assert.NilError(t, ioutil.WriteFile(filepath.Join(rootfs, name), []byte(name), 0644))
+	}
+
+	r, err := NewRecorder(rootfs)
+	if err == ErrRecordNotSupported {
+		t.Skip(err)
+	}
+	assert.NilError(t, err)
+	defer r.Close()
+
+	// files opened by the daemon itself are not recorded
+	_, err = ioutil.ReadFile(filepath.Join(rootfs, "etc/untouched"))
+	assert.NilError(t, err)
+	assert.NilError(t, exec.Command("cat", filepath.Join(rootfs, "etc/opened")).Run())
+
+	poll.WaitOn(t, func(poll.LogT) poll.Result {
+		if len(r.Profile().Paths) == 0 {
+			return poll.Continue("no access recorded yet")
+		}
+		return poll.Success()
+	}, poll.WithDelay(10*time.Millisecond), poll.WithTimeout(5*time.Second))
+
+	assert.NilError(t, r.Close())
+	assert.Check(t, is.DeepEqual(r.Profile(), &Profile{Paths: []string{"/etc/opened"}}))
+}
+
+func TestRecorderNotify(t *testing.T) {
+	r := &Recorder{paths: make(map[string]struct{})}
+	r.record("/etc/before")
+
+	var notified []string
+	r.Notify(func(path string) {
+		notified = append(notified, path)
+	})
+	r.record("/etc/after")
+	r.record("/etc/before")
+	assert.Check(t, is.DeepEqual(notified, []string{"/etc/before", "/etc/after"}))
+}
@@ -0,0 +1,25 @@
+// +build !linux
+
+package simplify // import "github.com/docker/docker/daemon/simplify"
+
+// Recorder records the files opened in a container's root filesystem.
+type Recorder struct{}
+
+// NewRecorder is not supported on this platform.
+func NewRecorder(rootfs string) (*Recorder, error) {
+	return nil, ErrRecordNotSupported
+}
+
+// Profile returns the files recorded so far.
+func (r *Recorder) Profile() *Profile {
+	return &Profile{}
+}
+
+// Notify calls fn with each file recorded.
+func (r *Recorder) Notify(fn func(path string)) {
+}
+
+// Close stops recording.
+func (r *Recorder) Close() error {
+	return nil
+}
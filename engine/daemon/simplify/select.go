@@ -0,0 +1,366 @@
+package simplify // import "github.com/docker/docker/daemon/simplify"
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/pkg/archive"
+	"github.com/docker/docker/pkg/fileutils"
+	"github.com/docker/docker/pkg/ioutils"
+)
+
+// Selector overrides which files of the full image a simplified image keeps,
+// regardless of whether the container accessed them.
+type Selector struct {
+	keep, prune *fileutils.PatternMatcher
+	// paths are the absolute paths of files kept, such as those of a
+	// profile.
+	paths map[string]bool
+	// below are the absolute paths of files of a profile opened in too few
+	// of its runs, pruned unless kept otherwise.
+	below map[string]bool
+
+	// commands are the commands whose executables are kept, looked up in
+	// path and relative to workdir.
+	commands []string
+	path     []string
+	workdir  string
+
+	// libraries is true if the shared libraries of the files kept are kept,
+	// looked up in libraryPath before the directories of the linker.
+	libraries   bool
+	libraryPath []string
+
+	// placeholders is true if the regular files of the full image pruned
+	// are left as placeholders.
+	placeholders bool
+}
+
+// NewSelector returns a Selector keeping the files matching keep and pruning
+// those matching prune. Patterns are gitignore-style globs matched against
+// absolute paths inside the image: a pattern without a slash matches a name
+// at any depth, and a pattern matching a directory matches everything in it.
+// keep wins over prune.
+func NewSelector(keep, prune []string) (*Selector, error) {
+	s := &Selector{}
+	var err error
+	if s.keep, err = newPatternMatcher(keep); err != nil {
+		return nil, err
+	}
+	if s.prune, err = newPatternMatcher(prune); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func newPatternMatcher(patterns []string) (*fileutils.PatternMatcher, error) {
+	if len(patterns) == 0 {
+		return nil, nil
+	}
+	var converted []string
+	for _, p := range patterns {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		var neg string
+		if strings.HasPrefix(p, "!") {
+			neg, p = "!", p[1:]
+			if p == "" {
+				return nil, fmt.Errorf("illegal exclusion pattern: %q", neg)
+			}
+		}
+		// 与gitignore一致：以/开头的模式从根目录匹配，不含/的模式匹配任意层级的文件名
+		if strings.HasPrefix(p, "/") {
+			p = strings.TrimLeft(p, "/")
+		} else if !strings.Contains(strings.TrimSuffix(p, "/"), "/") {
+			p = "**/" + p
+		}
+		p = strings.TrimSuffix(p, "/")
+		converted = append(converted, neg+p, neg+p+"/**")
+	}
+	pm, err := fileutils.NewPatternMatcher(converted)
+	if err != nil {
+		return nil, err
+	}
+	// 正则表达式只在第一次匹配时编译，提前暴露错误
+	if _, err := pm.Matches("."); err != nil {
+		return nil, err
+	}
+	return pm, nil
+}
+
+// Empty returns true if the selector has no patterns and keeps no
+// executables or libraries.
+func (s *Selector) Empty() bool {
+	return s == nil || (s.keep == nil && s.prune == nil && len(s.paths) == 0 && len(s.below) == 0 && len(s.commands) == 0 && !s.libraries && !s.placeholders)
+}
+
+// KeepPaths makes the selector keep the files at the given absolute paths.
+func (s *Selector) KeepPaths(paths []string) {
+	if s.paths == nil {
+		s.paths = make(map[string]bool)
+	}
+	for _, p := range paths {
+		s.paths[filepath.Clean("/"+p)] = true
+	}
+}
+
+// KeepProfile makes the selector keep the files of p opened in at least
+// threshold percent of its runs and prune the others.
+func (s *Selector) KeepProfile(p *Profile, threshold int) {
+	keep, below := p.Split(threshold)
+	s.KeepPaths(keep)
+	if s.below == nil {
+		s.below = make(map[string]bool)
+	}
+	for _, p := range below {
+		s.below[filepath.Clean("/"+p)] = true
+	}
+}
+
+// Below returns the paths of the profile below its threshold, sorted.
+func (s *Selector) Below() []string {
+	var paths []string
+	for p := range s.below {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// KeepLibraries makes the selector keep the shared libraries loaded by the
+// executables and libraries a simplified image keeps, along with their
+// dynamic linker.
+func (s *Selector) KeepLibraries() {
+	s.libraries = true
+}
+
+// LeavePlaceholders makes the selector leave a placeholder in place of each
+// regular file of the full image a simplified image leaves out: a file
+// without content that has its name, size, mode, owner and times, marked
+// with archive.PlaceholderXattr. Directory listings and stat() then look as
+// on the full image, and the overlay module fetches the file when the
+// placeholder is opened.
+func (s *Selector) LeavePlaceholders() {
+	s.placeholders = true
+}
+
+// Keep returns true if p matches a keep pattern or is a path kept.
+func (s *Selector) Keep(p string) bool {
+	return s != nil && (matches(s.keep, p) || s.paths[filepath.Clean("/"+p)])
+}
+
+// Prune returns true if p matches a prune pattern or is below the threshold
+// of a profile, and is not kept.
+func (s *Selector) Prune(p string) bool {
+	return s != nil && (matches(s.prune, p) || s.below[filepath.Clean("/"+p)]) && !s.Keep(p)
+}
+
+func matches(pm *fileutils.PatternMatcher, p string) bool {
+	if pm == nil {
+		return false
+	}
+	ok, err := pm.Matches(strings.TrimPrefix(filepath.Clean("/"+p), "/"))
+	return err == nil && ok
+}
+
+// Select returns diff, the writable layer of a container being committed as
+// a simplified image, with the files sel prunes removed and the files of
+// the full image it keeps added. full are the layers of the full image,
+// topmost first. The executables and libraries sel keeps are never pruned,
+// nor are the whiteouts and opaque markers of diff. The targets of the
+// symlinks kept, followed through chains, and the entries holding the
+// content of the hard links kept are kept along with them. The regular files
+// of the full image left out are left as placeholders if sel leaves them.
+// Closing the returned stream closes diff.
+func Select(ctx context.Context, diff io.ReadCloser, full []Source, sel *Selector) io.ReadCloser {
+	if sel.Empty() {
+		return diff
+	}
+	pr, pw := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		pw.CloseWithError(selectFiles(ctx, pw, diff, full, sel))
+		close(done)
+	}()
+	return ioutils.NewReadCloserWrapper(pr, func() error {
+		pr.Close()
+		<-done
+		return diff.Close()
+	})
+}
+
+func selectFiles(ctx context.Context, w io.Writer, diff io.Reader, full []Source, sel *Selector) error {
+	tw := tar.NewWriter(w)
+
+	// 先在完整镜像中找出启动命令需要的文件，它们不会被精简掉
+	var (
+		index    map[string]*execEntry
+		required map[string]bool
+	)
+	if len(sel.commands) > 0 || sel.libraries {
+		var err error
+		if index, err = indexImage(ctx, full); err != nil {
+			return err
+		}
+		r := newExecutableResolver(index, sel, false)
+		r.requireCommands()
+		required = r.required
+	} else if sel.keep != nil || len(sel.paths) > 0 {
+		// 只需跟随保留的文件的链接
+		var err error
+		if index, err = indexLinks(ctx, full); err != nil {
+			return err
+		}
+	}
+
+	written := make(map[string]bool)
+	hidden := make(map[string]bool)
+	tr := tar.NewReader(diff)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		name := filepath.Clean("/" + hdr.Name)
+		// 容器删除的文件不会再从完整镜像中加入
+		whiteout := true
+		switch base := filepath.Base(name); {
+		case base == archive.WhiteoutOpaqueDir:
+			hidden[filepath.Dir(name)] = true
+		case strings.HasPrefix(base, archive.WhiteoutPrefix):
+			hidden[filepath.Join(filepath.Dir(name), strings.TrimPrefix(base, archive.WhiteoutPrefix))] = true
+		default:
+			whiteout = false
+		}
+		// whiteout无论是否匹配精简规则都保留，否则被删除的文件或不透明目录下层的内容会重新出现
+		if !whiteout && hdr.Typeflag != tar.TypeDir && !required[name] && sel.Prune(name) {
+			continue
+		}
+		if hdr.Typeflag == tar.TypeLink && !written[filepath.Clean("/"+hdr.Linkname)] {
+			// 硬链接的内容在已被精简掉的目标条目中，链接随其一起精简，之后按需拉取
+			continue
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		written[name] = true
+		if index == nil || whiteout || hdr.Typeflag == tar.TypeDir {
+			if _, err := io.Copy(tw, tr); err != nil {
+				return err
+			}
+			continue
+		}
+		// 读写层中的文件覆盖完整镜像中的同名文件
+		if index[name], err = readEntry(name, hdr, tr, tw); err != nil {
+			return err
+		}
+	}
+
+	if index != nil {
+		// 容器删除或修改的文件可能改变命令和库的解析结果
+		for name := range index {
+			if isHidden(hidden, name) && !written[name] {
+				delete(index, name)
+			}
+		}
+		r := newExecutableResolver(index, sel, sel.libraries)
+		r.requireCommands()
+		// 保留的所有文件经过的符号链接和硬链接的目标，以及需要的库
+		for name := range index {
+			if !written[name] && !sel.Keep(name) {
+				continue
+			}
+			if sel.libraries {
+				r.require(name)
+			} else {
+				r.requireLinks(name)
+			}
+		}
+		// 记录的路径可能经过目录的符号链接
+		for p := range sel.paths {
+			r.requireLinks(p)
+		}
+		required = r.required
+	}
+
+	if sel.keep != nil || len(sel.paths) > 0 || len(required) > 0 || sel.placeholders {
+		// 加入完整镜像中匹配保留模式、在profile中或启动命令需要、但容器没有访问过的文件及其上级目录
+		dirs := make(map[string]*tar.Header)
+		err := scanImage(ctx, full, func(name string, hdr *tar.Header, r io.Reader) error {
+			if hdr.Typeflag == tar.TypeDir {
+				dirs[name] = hdr
+				return nil
+			}
+			if written[name] || isHidden(hidden, name) {
+				return nil
+			}
+			if !(required[name] || sel.Keep(name)) {
+				// 精简掉的普通文件留下只有元数据的占位文件，空文件本身就是完整的
+				if !sel.placeholders || !isRegular(hdr) {
+					return nil
+				}
+				if hdr.Size > 0 {
+					hdr, r = placeholder(hdr), nil
+				}
+			} else if hdr.Typeflag == tar.TypeLink && !written[filepath.Clean("/"+hdr.Linkname)] {
+				// 硬链接的目标已被容器删除，无法单独保留
+				return nil
+			}
+			for _, parent := range parents(name) {
+				if written[parent] || dirs[parent] == nil {
+					continue
+				}
+				if err := tw.WriteHeader(dirs[parent]); err != nil {
+					return err
+				}
+				written[parent] = true
+			}
+			if hdr.Typeflag == tar.TypeGNUSparse {
+				// tar.Writer不能写稀疏文件，按普通文件写入其全部内容
+				hdr.Typeflag = tar.TypeReg
+			}
+			if err := tw.WriteHeader(hdr); err != nil {
+				return err
+			}
+			if r != nil {
+				if _, err := io.Copy(tw, r); err != nil {
+					return err
+				}
+			}
+			written[name] = true
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+// placeholder returns the header of the placeholder of the regular file hdr:
+// an empty file with the metadata of hdr, marked with its size.
+func placeholder(hdr *tar.Header) *tar.Header {
+	ph := *hdr
+	ph.Typeflag = tar.TypeReg
+	ph.Size = 0
+	// 稀疏文件的PAX记录不再适用，扩展属性需要PAX格式
+	ph.PAXRecords = nil
+	ph.Format = tar.FormatUnknown
+	ph.Xattrs = make(map[string]string, len(hdr.Xattrs)+1)
+	for k, v := range hdr.Xattrs {
+		ph.Xattrs[k] = v
+	}
+	ph.Xattrs[archive.PlaceholderXattr] = strconv.FormatInt(hdr.Size, 10)
+	return &ph
+}
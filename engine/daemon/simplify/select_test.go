@@ -0,0 +1,240 @@
+package simplify // import "github.com/docker/docker/daemon/simplify"
+
+import (
+	"archive/tar"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/docker/docker/pkg/archive"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+func TestSelector(t *testing.T) {
+	sel, err := NewSelector([]string{"*.mo", "/usr/lib/plugins/", "/etc/ssl/certs/keep.pem"}, []string{"/usr/share/locale", "/etc/ssl/certs/*.pem", "docs"})
+	assert.NilError(t, err)
+
+	for _, tc := range []struct {
+		path  string
+		keep  bool
+		prune bool
+	}{
+		{path: "/usr/share/locale/de/app.mo", keep: true},
+		{path: "/usr/share/locale/de/app.txt", prune: true},
+		{path: "/usr/lib/plugins/lazy.so", keep: true},
+		{path: "/usr/lib/other.so"},
+		{path: "/etc/ssl/certs/keep.pem", keep: true},
+		{path: "/etc/ssl/certs/drop.pem", prune: true},
+		{path: "/opt/app/docs/readme", prune: true},
+		{path: "/opt/app/documents/readme"},
+	} {
+		assert.Check(t, is.Equal(sel.Keep(tc.path), tc.keep), tc.path)
+		assert.Check(t, is.Equal(sel.Prune(tc.path), tc.prune), tc.path)
+	}
+
+	_, err = NewSelector([]string{"[a-"}, nil)
+	assert.Check(t, err != nil)
+	_, err = NewSelector(nil, []string{"!"})
+	assert.Check(t, err != nil)
+
+	sel, err = NewSelector(nil, nil)
+	assert.NilError(t, err)
+	assert.Check(t, sel.Empty())
+}
+
+func TestSelect(t *testing.T) {
+	full := []Source{
+		// top
+		tarSource{dir("etc/"), file("etc/.wh.removed.conf"), dir("usr/"), dir("usr/lib/"), dir("usr/lib/plugins/"), file("usr/lib/plugins/lazy.so")},
+		// bottom
+		tarSource{dir("etc/"), file("etc/app.conf"), file("etc/removed.conf"), dir("usr/"), dir("usr/share/"), file("usr/share/app.mo")},
+	}
+	diff, err := tarSource{dir("etc/"), file("etc/app.conf"), dir("usr/"), dir("usr/share/"), file("usr/share/app.mo"), file("usr/share/app.txt")}.Open(context.Background())
+	assert.NilError(t, err)
+
+	sel, err := NewSelector([]string{"/usr/lib/plugins", "*.mo", "removed.conf"}, []string{"/usr/share"})
+	assert.NilError(t, err)
+	rc := Select(context.Background(), diff, full, sel)
+	defer rc.Close()
+
+	var names []string
+	tr := tar.NewReader(rc)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.NilError(t, err)
+		names = append(names, hdr.Name)
+	}
+	assert.Check(t, is.DeepEqual(names, []string{
+		"etc/", "etc/app.conf", "usr/", "usr/share/", "usr/share/app.mo",
+		"usr/lib/", "usr/lib/plugins/", "usr/lib/plugins/lazy.so",
+	}))
+}
+
+func TestSelectLeavesPlaceholders(t *testing.T) {
+	lib := file("usr/lib/libold.so")
+	lib.Uid, lib.Gid, lib.Mode = 1000, 1000, 0755
+	// tarSource只为TypeReg写入内容
+	empty := &tar.Header{Name: "etc/empty", Typeflag: tar.TypeRegA, Mode: 0600}
+	full := []Source{
+		// top
+		tarSource{dir("etc/"), file("etc/.wh.removed.conf"), dir("usr/"), dir("usr/lib/"), lib},
+		// bottom
+		tarSource{dir("etc/"), file("etc/app.conf"), file("etc/removed.conf"), empty, dir("usr/"), dir("usr/share/"), file("usr/share/app.mo")},
+	}
+	diff, err := tarSource{dir("etc/"), file("etc/app.conf")}.Open(context.Background())
+	assert.NilError(t, err)
+
+	sel, err := NewSelector([]string{"*.mo"}, nil)
+	assert.NilError(t, err)
+	sel.LeavePlaceholders()
+	rc := Select(context.Background(), diff, full, sel)
+	defer rc.Close()
+
+	var names []string
+	headers := make(map[string]*tar.Header)
+	tr := tar.NewReader(rc)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.NilError(t, err)
+		names = append(names, hdr.Name)
+		headers[hdr.Name] = hdr
+	}
+	assert.Check(t, is.DeepEqual(names, []string{
+		"etc/", "etc/app.conf", "usr/", "usr/lib/", "usr/lib/libold.so",
+		"etc/empty", "usr/share/", "usr/share/app.mo",
+	}))
+
+	ph := headers["usr/lib/libold.so"]
+	assert.Check(t, is.Equal(ph.Size, int64(0)))
+	assert.Check(t, is.Equal(ph.Mode, int64(0755)))
+	assert.Check(t, is.Equal(ph.Uid, 1000))
+	size, ok := archive.PlaceholderSize(ph)
+	assert.Check(t, ok)
+	assert.Check(t, is.Equal(size, lib.Size))
+	// 空文件和保留的文件不是占位文件
+	for _, name := range []string{"etc/app.conf", "etc/empty", "usr/share/app.mo"} {
+		_, ok := archive.PlaceholderSize(headers[name])
+		assert.Check(t, !ok, name)
+	}
+}
+
+// TestSelectKeepsWhiteouts checks that the files deleted or shadowed across
+// the layers of the full image, or by the container, are not brought back
+// however the files are selected.
+func TestSelectKeepsWhiteouts(t *testing.T) {
+	full := []Source{
+		// top: deletes secret.conf, makes opt/ opaque and replaces var/log/
+		// with a file
+		tarSource{dir("etc/"), file("etc/.wh.secret.conf"), dir("opt/"), file("opt/.wh..wh..opq"), file("opt/new"), dir("var/"), file("var/log")},
+		// bottom
+		tarSource{dir("etc/"), file("etc/secret.conf"), dir("opt/"), file("opt/old"), dir("var/"), dir("var/log/"), file("var/log/old.log")},
+	}
+	// the container deleted app.conf and emptied srv/
+	diff, err := tarSource{dir("etc/"), file("etc/.wh.app.conf"), dir("srv/"), file("srv/.wh..wh..opq")}.Open(context.Background())
+	assert.NilError(t, err)
+
+	// the whiteouts match the prune patterns, and the files they hide the
+	// keep patterns
+	sel, err := NewSelector([]string{"secret.conf", "/opt", "old.log"}, []string{"/etc", "/srv", "*.conf"})
+	assert.NilError(t, err)
+	rc := Select(context.Background(), diff, full, sel)
+	defer rc.Close()
+
+	var names []string
+	tr := tar.NewReader(rc)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.NilError(t, err)
+		names = append(names, hdr.Name)
+	}
+	assert.Check(t, is.DeepEqual(names, []string{
+		"etc/", "etc/.wh.app.conf", "srv/", "srv/.wh..wh..opq", "opt/", "opt/new",
+	}))
+}
+
+func TestSelectKeepsPaths(t *testing.T) {
+	sel, err := NewSelector(nil, []string{"/etc"})
+	assert.NilError(t, err)
+	sel.KeepPaths([]string{"/app/unused.sh", "/etc/app.conf", "/bin/missing"})
+	assert.Check(t, !sel.Empty())
+
+	diff := execSource{entry(dir("etc/")), entry(file("etc/app.conf")), entry(file("etc/other.conf"))}
+	assert.Check(t, is.DeepEqual(selectedNames(t, fullImage, diff, sel), []string{
+		"etc/", "etc/app.conf", "app/", "app/unused.sh",
+	}))
+}
+
+func TestSelectKeepsProfile(t *testing.T) {
+	sel, err := NewSelector([]string{"/bin/curl"}, nil)
+	assert.NilError(t, err)
+	sel.KeepProfile(&Profile{
+		Paths:  []string{"/app/start.sh", "/app/unused.sh", "/bin/curl", "/etc/app.conf"},
+		Runs:   []string{"a", "b", "c", "d"},
+		Counts: map[string]int{"/app/start.sh": 4, "/app/unused.sh": 1, "/bin/curl": 1, "/etc/app.conf": 2},
+	}, 50)
+	assert.Check(t, is.DeepEqual(sel.Below(), []string{"/app/unused.sh", "/bin/curl"}))
+
+	// app.conf was opened in half of the runs, unused.sh in too few of them
+	// and curl is kept by pattern
+	diff := execSource{entry(dir("app/")), exe("app/unused.sh", "#!/usr/bin/perl\n"), entry(dir("etc/")), entry(file("etc/app.conf"))}
+	assert.Check(t, is.DeepEqual(selectedNames(t, fullImage, diff, sel), []string{
+		"app/", "etc/", "etc/app.conf", "app/start.sh", "bin/", "bin/curl",
+	}))
+}
+
+func hardlink(name, target string) execFile {
+	return entry(&tar.Header{Name: name, Typeflag: tar.TypeLink, Linkname: target, Mode: 0755})
+}
+
+// busyboxImage has a busybox-style hard link farm in /bin, a chain of
+// symlinks to python and /lib merged into /usr/lib.
+var busyboxImage = []Source{
+	execSource{
+		entry(dir("bin/")),
+		exe("bin/busybox", "\x7fELF"),
+		hardlink("bin/ls", "bin/busybox"),
+		hardlink("bin/cat", "bin/busybox"),
+		entry(dir("usr/")),
+		entry(dir("usr/bin/")),
+		exe("usr/bin/python3.8", "\x7fELF"),
+		symlink("usr/bin/python3", "python3.8"),
+		symlink("usr/bin/py", "/usr/bin/python3"),
+		entry(dir("usr/lib/")),
+		entry(file("usr/lib/libz.so")),
+		entry(file("usr/lib/libc.so")),
+		symlink("lib", "usr/lib"),
+	},
+}
+
+func TestSelectKeepsLinks(t *testing.T) {
+	sel, err := NewSelector(nil, []string{"/opt/data"})
+	assert.NilError(t, err)
+	// the profile recorded the links opened, not their targets
+	sel.KeepPaths([]string{"/bin/ls", "/usr/bin/py", "/lib/libz.so"})
+
+	// the container added a symlink to python, and a hard link to a file
+	// pruned
+	diff := execSource{
+		entry(dir("etc/")),
+		symlink("etc/python", "/usr/bin/py"),
+		entry(dir("opt/")),
+		entry(file("opt/data")),
+		hardlink("opt/copy", "opt/data"),
+	}
+	assert.Check(t, is.DeepEqual(selectedNames(t, busyboxImage, diff, sel), []string{
+		"etc/", "etc/python", "opt/",
+		"bin/", "bin/busybox", "bin/ls",
+		"usr/", "usr/bin/", "usr/bin/python3.8", "usr/bin/python3", "usr/bin/py",
+		"usr/lib/", "usr/lib/libz.so", "lib",
+	}))
+}
@@ -0,0 +1,1033 @@
+package simplify // import "github.com/docker/docker/daemon/simplify"
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/docker/docker/pkg/idtools"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// fetchRequest is sent by the fetch helper for a file the kernel could not
+// find in any layer of a lazy mount.
+type fetchRequest struct {
+	// Upper is the upper directory of the overlay mount.
+	Upper string
+	// Path is the path of the missing file inside the mount.
+	Path string
+}
+
+// Actions of the events of the containers whose missing files are fetched.
+const (
+	// EventFetchError is emitted when a file missing from a container could
+	// not be fetched for another reason than not being in the full image.
+	EventFetchError = "simplify-fetch-error"
+	// EventComplete is emitted when every file of the image of a container
+	// was prefetched.
+	EventComplete = "simplify-complete"
+)
+
+// FetchErrorNoSpace is the reason attribute of the EventFetchError events
+// of the files that could not be fetched because the disk was full.
+const FetchErrorNoSpace = "no space"
+
+// EventFunc is called with the action and attributes of an event of the
+// container whose writable layer has the given mount ID.
+type EventFunc func(mountID, action string, attributes map[string]string)
+
+const (
+	// evictInterval is how often the caches are evicted down to their
+	// maximum size.
+	evictInterval = 5 * time.Minute
+	// fetchBackoff is how long a failed fetch is waited for before it is
+	// retried the first time. The wait doubles after each of the next
+	// failures, up to fetchMaxBackoff.
+	fetchBackoff    = 100 * time.Millisecond
+	fetchMaxBackoff = time.Second
+)
+
+type fetchResponse struct {
+	Error string `json:",omitempty"`
+	// Errno is what the lookup of the missing file fails with, if set.
+	Errno syscall.Errno `json:",omitempty"`
+}
+
+type fetcherRef struct {
+	*Fetcher
+	refs int
+	// cancelPrefetch stops the background prefetch, nil if none is running
+	cancelPrefetch context.CancelFunc
+}
+
+// FetchStats counts the files looked up on demand for a container, or for
+// all the containers of an image.
+type FetchStats struct {
+	// Fetches is the number of files looked up and found, in the cache or
+	// in the full image.
+	Fetches uint64
+	// CacheHits is the number of files looked up that were in the cache,
+	// fetched for another container of the image.
+	CacheHits uint64
+	// FetchedBytes is the size of the files fetched from the full image.
+	FetchedBytes uint64
+	// LastFetch is when a file was last fetched from the full image.
+	LastFetch time.Time
+}
+
+func (st *FetchStats) add(size int64, cached bool, now time.Time) {
+	st.Fetches++
+	if cached {
+		st.CacheHits++
+		return
+	}
+	st.FetchedBytes += uint64(size)
+	st.LastFetch = now
+}
+
+// Server answers the fetch helper on behalf of the fetchers of all running
+// simplified containers.
+type Server struct {
+	root string
+	sock string
+
+	// helperMu guards the listener of the fetch helper, nil while it is
+	// restarted, and the health of the service answering it
+	helperMu sync.Mutex
+	l        net.Listener
+	health   HelperHealth
+	// configure points the kernel at the fetch helper and a socket, and
+	// configured checks that it still does
+	configure  func(sock string) error
+	configured func(sock string) bool
+
+	mu sync.Mutex
+	// fetchers are shared by all containers of an image, keyed by image ID
+	fetchers map[string]*fetcherRef
+	// mounts maps the layer mount ID of each container to its image ID
+	mounts map[string]string
+	// stats are kept for each attached mount ID, and for each image since
+	// the daemon started
+	stats      map[string]*FetchStats
+	imageStats map[string]*FetchStats
+	// logs are kept for each mount ID attached since the daemon started,
+	// until forgotten
+	logs map[string]*fetchLog
+	// inserts are the root filesystems the files fetched for some of the
+	// attached mount IDs are inserted into, keyed by mount ID
+	inserts map[string]*insertTarget
+	// timeouts override fetchTimeout for some of the attached mount IDs
+	timeouts     map[string]time.Duration
+	fetchTimeout time.Duration
+	// fetchLimits bound the fetches run at once for some of the attached
+	// mount IDs, within the limit of queue
+	fetchLimits map[string]int
+	queue       *fetchQueue
+	// maxSize is the size the caches are evicted down to, 0 if unlimited
+	maxSize int64
+	// size is that of the caches when last scanned, plus the size of the
+	// files fetched since, -1 until they are scanned
+	size int64
+	// evicting is set once every running container is attached
+	evicting bool
+	// events is called for the events of attached containers, if set
+	events EventFunc
+	// idMappings are those of the user namespace containers are remapped
+	// to, if any
+	idMappings *idtools.IDMappings
+	// blobs holds the files fetched by digest, shared by the caches, if
+	// they are not shared with other daemons
+	blobs *blobStore
+	// shared is set if other daemons use the caches at once, through a
+	// shared file system
+	shared bool
+	// blobSources are tried before the registry, such as peers
+	blobSources *blobSources
+
+	// evictMu serializes evictions
+	evictMu sync.Mutex
+	// pinMu serializes the updates of the pins of the caches
+	pinMu sync.Mutex
+	stop  chan struct{}
+
+	// ctx is that of the lookups of the fetch helper and of the background
+	// prefetches, cancelled once the server is closed and drained
+	ctx    context.Context
+	cancel context.CancelFunc
+	// draining is set once the server is closed, after which no lookup,
+	// prefetch or fetch of the daemon is started. inflight tracks those
+	// running, and drainTimeout is how long they are waited for before being
+	// cancelled
+	draining     bool
+	inflight     sync.WaitGroup
+	drainTimeout time.Duration
+	// closeOnce closes the server once, and closeErr is what Close returns
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// errDraining is returned by the fetches the daemon starts once the server
+// is closed.
+var errDraining = errors.New("simplify fetch server is shutting down")
+
+// NewServer returns a Server caching fetched files under root, up to
+// maxSize bytes, and listening for the fetch helper on sock. Fetches are
+// given up after fetchTimeout, 0 meaning never, and at most maxFetches of
+// them run at once, 0 meaning unlimited. The events of attached
+// containers are passed to events, if not nil. The fetched files are owned
+// by the host IDs idMappings maps the owners recorded in the full image to.
+// If shared is set, root may be used by other daemons at once: the caches
+// are locked while prepared, used and evicted, and files are not shared
+// between the caches through hard links, whose link counts other hosts
+// cannot be relied on to keep. It points the kernel at the helper, so
+// Supported must be checked first, unless sock is empty: the server then
+// answers no helper, and only fetches files explicitly, inserting them into
+// the root filesystems given to Insert.
+func NewServer(root, sock string, maxSize int64, fetchTimeout time.Duration, maxFetches int, events EventFunc, idMappings *idtools.IDMappings, shared bool) (*Server, error) {
+	if err := os.MkdirAll(root, 0700); err != nil {
+		return nil, err
+	}
+	stop := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Server{
+		root:         root,
+		sock:         sock,
+		configure:    configureKernel,
+		configured:   kernelConfigured,
+		fetchers:     make(map[string]*fetcherRef),
+		mounts:       make(map[string]string),
+		stats:        make(map[string]*FetchStats),
+		imageStats:   make(map[string]*FetchStats),
+		logs:         make(map[string]*fetchLog),
+		inserts:      make(map[string]*insertTarget),
+		timeouts:     make(map[string]time.Duration),
+		fetchTimeout: fetchTimeout,
+		fetchLimits:  make(map[string]int),
+		queue:        newFetchQueue(maxFetches, stop),
+		maxSize:      maxSize,
+		size:         -1,
+		events:       events,
+		idMappings:   idMappings,
+		blobSources:  &blobSources{},
+		shared:       shared,
+		stop:         stop,
+		ctx:          ctx,
+		cancel:       cancel,
+	}
+	if !shared {
+		s.blobs = newBlobStore(root)
+	}
+	if sock == "" {
+		s.health.Healthy = true
+		return s, nil
+	}
+	if err := s.listen(); err != nil {
+		return nil, err
+	}
+	go s.supervise()
+	return s, nil
+}
+
+// SetMaxCacheSize sets the size the caches are evicted down to, 0 meaning
+// unlimited.
+func (s *Server) SetMaxCacheSize(size int64) {
+	s.mu.Lock()
+	s.maxSize = size
+	s.mu.Unlock()
+}
+
+// SetFetchTimeout sets how long fetches are retried for before giving up,
+// 0 meaning never, for the mount IDs attached without a timeout of their
+// own.
+func (s *Server) SetFetchTimeout(timeout time.Duration) {
+	s.mu.Lock()
+	s.fetchTimeout = timeout
+	s.mu.Unlock()
+}
+
+// SetDrainTimeout sets how long Close waits for the lookups of the fetch
+// helper being answered, and the background prefetches, to complete before
+// cancelling them.
+func (s *Server) SetDrainTimeout(timeout time.Duration) {
+	s.mu.Lock()
+	s.drainTimeout = timeout
+	s.mu.Unlock()
+}
+
+// SetBlobSources sets the sources, such as peers, the content of files is
+// fetched from before the layers of the full images, in order.
+func (s *Server) SetBlobSources(sources []BlobSource) {
+	s.blobSources.set(sources)
+}
+
+// SetMaxConcurrentFetches sets how many files are fetched on demand at once,
+// 0 meaning unlimited. The fetches beyond it wait for others to complete.
+func (s *Server) SetMaxConcurrentFetches(n int) {
+	s.queue.setLimit(n)
+}
+
+// StartEviction starts evicting the least recently used files of the
+// caches no running container is attached to, periodically and whenever
+// the disk is full. It must not be called before the containers that kept
+// running while the daemon restarted are attached again.
+func (s *Server) StartEviction() {
+	s.mu.Lock()
+	started := s.evicting
+	s.evicting = true
+	s.mu.Unlock()
+	if started {
+		return
+	}
+	go func() {
+		t := time.NewTicker(evictInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-s.stop:
+				return
+			case <-t.C:
+				if _, err := s.evict(false); err != nil {
+					logrus.WithError(err).Warn("simplify cache eviction failed")
+				}
+			}
+		}
+	}()
+}
+
+// evict removes the least recently used files of the caches no container
+// is attached to, until the caches fit in their maximum size, or, if the
+// disk is full, take a quarter less space than they do. It returns the
+// number of bytes removed.
+func (s *Server) evict(full bool) (int64, error) {
+	s.evictMu.Lock()
+	defer s.evictMu.Unlock()
+
+	s.mu.Lock()
+	evicting, target := s.evicting, s.maxSize
+	s.mu.Unlock()
+	if !evicting {
+		return 0, nil
+	}
+
+	files, total, err := scanCaches(s.root)
+	if err != nil {
+		return 0, err
+	}
+	s.setSize(total)
+	if full {
+		if t := total - total/4; target <= 0 || t < target {
+			target = t
+		}
+	}
+	if target <= 0 || total <= target {
+		return 0, nil
+	}
+
+	// 只在记录使用中的缓存时持有s.mu，删除文件时不阻塞查找
+	s.mu.Lock()
+	attached := make(map[string]bool, len(s.fetchers))
+	for imageID := range s.fetchers {
+		attached[imageID] = true
+	}
+	s.mu.Unlock()
+	locks := make(map[string]*os.File)
+	pins := make(map[string][]string)
+	freed, evicted, err := evictFiles(s.root, files, total, target, func(imageID, p string) bool {
+		if attached[imageID] {
+			return false
+		}
+		// 之后挂载的容器或其它daemon使用的缓存持有共享锁，取不到独占锁时保留；
+		// 取到时淘汰完成前不能再使用该缓存
+		lock, ok := locks[imageID]
+		if !ok {
+			lock, _ = lockCache(filepath.Join(s.root, imageID), usedLock, lockExclusive, false)
+			locks[imageID] = lock
+		}
+		if lock == nil {
+			return false
+		}
+		// 固定的路径无论磁盘是否已满都保留
+		patterns, ok := pins[imageID]
+		if !ok {
+			var err error
+			if patterns, err = Pins(s.root, imageID); err != nil {
+				logrus.WithError(err).WithField("image", imageID).Warn("failed to read simplify cache pins, keeping the cache")
+				patterns = []string{"/"}
+			}
+			pins[imageID] = patterns
+		}
+		return len(patterns) == 0 || !matchPath(patterns, p)
+	})
+	for _, lock := range locks {
+		if lock != nil {
+			lock.Close()
+		}
+	}
+	s.setSize(total - freed)
+	cacheEvictions.Inc(float64(evicted))
+	if evicted > 0 {
+		logrus.WithField("files", evicted).Debugf("evicted %d bytes from simplify cache", freed)
+	}
+	return freed, err
+}
+
+// setSize records size as that of the caches.
+func (s *Server) setSize(size int64) {
+	s.mu.Lock()
+	s.size = size
+	s.mu.Unlock()
+	cacheSize.Set(float64(size))
+}
+
+// CacheSize returns the size of the caches, in bytes. They are scanned the
+// first time, and after that the size is kept up to date by the fetches and
+// the evictions, so it may be off by the files prefetched since the last
+// eviction.
+func (s *Server) CacheSize() (int64, error) {
+	s.mu.Lock()
+	size := s.size
+	s.mu.Unlock()
+	if size >= 0 {
+		return size, nil
+	}
+	_, size, err := scanCaches(s.root)
+	if err != nil {
+		return 0, err
+	}
+	s.mu.Lock()
+	// 扫描期间可能已有淘汰记录了大小
+	if s.size < 0 {
+		s.size = size
+	}
+	size = s.size
+	s.mu.Unlock()
+	return size, nil
+}
+
+// Attach prepares the fetcher of imageID for the container whose writable
+// layer has the given mount ID and returns the directory to layer
+// underneath it. sources are only used if no container of the image is
+// running yet. The fetches of the container are given up after timeout, or
+// after the timeout of the server if 0. At most maxFetches of them run at
+// once if it is not 0, within the limit of the server.
+func (s *Server) Attach(ctx context.Context, mountID, imageID string, sources []Source, timeout time.Duration, maxFetches int) (string, error) {
+	s.mu.Lock()
+	f := s.acquire(imageID, sources)
+	s.mounts[mountID] = imageID
+	s.stats[mountID] = &FetchStats{}
+	if s.logs[mountID] == nil {
+		s.logs[mountID] = &fetchLog{}
+	}
+	if timeout > 0 {
+		s.timeouts[mountID] = timeout
+	}
+	if maxFetches > 0 {
+		s.fetchLimits[mountID] = maxFetches
+	}
+	s.mu.Unlock()
+
+	if err := f.Prepare(ctx); err != nil {
+		s.Detach(mountID)
+		return "", err
+	}
+	return f.Dir(), nil
+}
+
+// Detach releases the fetcher attached to the given mount ID. It is a no-op
+// if nothing is attached.
+func (s *Server) Detach(mountID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	imageID, ok := s.mounts[mountID]
+	if !ok {
+		return
+	}
+	delete(s.mounts, mountID)
+	delete(s.inserts, mountID)
+	delete(s.stats, mountID)
+	delete(s.timeouts, mountID)
+	delete(s.fetchLimits, mountID)
+	s.release(imageID)
+}
+
+// acquire returns the fetcher of imageID, created with sources if it does
+// not exist yet, and takes a reference to it. s.mu must be held.
+func (s *Server) acquire(imageID string, sources []Source) *fetcherRef {
+	f, ok := s.fetchers[imageID]
+	if !ok {
+		f = &fetcherRef{Fetcher: NewFetcher(filepath.Join(s.root, imageID), sources)}
+		f.idMappings = s.idMappings
+		f.blobs = s.blobs
+		f.blobSources = s.blobSources
+		f.shared = s.shared
+		f.Notify(func(p string) { s.inserted(imageID, f.Dir(), p) })
+		s.fetchers[imageID] = f
+	}
+	f.refs++
+	return f
+}
+
+// release drops a reference taken by acquire. s.mu must be held.
+func (s *Server) release(imageID string) {
+	f := s.fetchers[imageID]
+	if f == nil {
+		return
+	}
+	f.refs--
+	if f.refs <= 0 {
+		// 最后一个容器停止时取消后台预取
+		if f.cancelPrefetch != nil {
+			f.cancelPrefetch()
+		}
+		if err := f.Close(); err != nil {
+			logrus.WithError(err).WithField("cache", f.root).Warn("failed to unlock simplify cache")
+		}
+		delete(s.fetchers, imageID)
+	}
+}
+
+// Prefetch starts downloading the rest of the image attached to the given
+// mount ID in the background, limited to bytesPerSec. It is a no-op if a
+// prefetch of the image is already running. The prefetch is cancelled once
+// every container of the image has been detached.
+func (s *Server) Prefetch(mountID string, bytesPerSec int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	imageID := s.mounts[mountID]
+	f := s.fetchers[imageID]
+	if f == nil || f.cancelPrefetch != nil || s.draining {
+		return
+	}
+	ctx, cancel := context.WithCancel(s.ctx)
+	f.cancelPrefetch = cancel
+	s.inflight.Add(1)
+	go func() {
+		defer s.inflight.Done()
+		_, err := f.Prefetch(ctx, PrefetchOptions{BytesPerSec: bytesPerSec})
+		switch {
+		case err == nil:
+			logrus.WithField("cache", f.root).Debug("simplified image fully materialized")
+		case IsVerificationError(err):
+			logVerificationFailure(err, logrus.Fields{"cache": f.root})
+		case ctx.Err() == nil:
+			logrus.WithError(err).WithField("cache", f.root).Warn("simplify prefetch failed")
+		}
+		s.mu.Lock()
+		f.cancelPrefetch = nil
+		var mounts []string
+		if err == nil {
+			mounts = s.attached(imageID)
+		}
+		s.mu.Unlock()
+		cancel()
+		for _, m := range mounts {
+			s.emit(m, EventComplete, map[string]string{})
+		}
+	}()
+}
+
+// PrefetchImage fetches every file of the full image of imageID into its
+// cache, or those matching opts.Patterns, while containers of the image may
+// be running and fetching files on demand. sources are only used if no
+// container of the image is running. Once the image is fully materialized,
+// its containers are told as they are by Prefetch.
+func (s *Server) PrefetchImage(ctx context.Context, imageID string, sources []Source, opts PrefetchOptions) (PrefetchResult, error) {
+	ctx, done, err := s.enter(ctx)
+	if err != nil {
+		return PrefetchResult{}, err
+	}
+	defer done()
+	res, release, err := s.prefetchImage(ctx, imageID, sources, opts)
+	release()
+	return res, err
+}
+
+// Materialize fetches every file of the full image of imageID into its
+// cache, as PrefetchImage does, and returns the directory holding them. The
+// cache is not evicted until release is called.
+func (s *Server) Materialize(ctx context.Context, imageID string, sources []Source) (dir string, release func(), _ error) {
+	ctx, done, err := s.enter(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+	defer done()
+	_, release, err = s.prefetchImage(ctx, imageID, sources, PrefetchOptions{})
+	if err != nil {
+		release()
+		return "", nil, err
+	}
+	return CacheDir(s.root, imageID), release, nil
+}
+
+// FetchPath fetches the file of the full image of imageID at p into its
+// cache, or every file under p if it is a directory, as docker cp reads
+// them, and returns the directory of the cache. Paths not in the full image
+// are not an error. The cache is not evicted until release is called.
+func (s *Server) FetchPath(ctx context.Context, imageID string, sources []Source, p string) (dir string, release func(), _ error) {
+	ctx, done, err := s.enter(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+	defer done()
+	f, release := s.hold(imageID, sources)
+	if err := f.Prepare(ctx); err != nil {
+		release()
+		return "", nil, err
+	}
+	p = filepath.Clean("/" + p)
+	if fi, serr := os.Lstat(filepath.Join(f.Dir(), p)); serr == nil && fi.IsDir() {
+		// 目录在准备缓存时已创建，拉取其中的文件
+		_, err = f.Prefetch(ctx, PrefetchOptions{Patterns: []string{escapeGlob(p)}})
+	} else {
+		// 请求没有截止时间时，和容器的拉取一样在超时后放弃重试
+		s.mu.Lock()
+		timeout := s.fetchTimeout
+		s.mu.Unlock()
+		if _, ok := ctx.Deadline(); !ok && timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		_, _, err = s.fetchRetry(ctx, f.Fetcher, p)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		if IsVerificationError(err) {
+			logVerificationFailure(err, logrus.Fields{"cache": f.root, "path": p})
+		}
+		release()
+		return "", nil, err
+	}
+	return f.Dir(), release, nil
+}
+
+// hold takes a reference to the fetcher of imageID, as acquire does, so that
+// its cache is not evicted, and returns it along with the func dropping the
+// reference, which may be called more than once.
+func (s *Server) hold(imageID string, sources []Source) (*fetcherRef, func()) {
+	s.mu.Lock()
+	f := s.acquire(imageID, sources)
+	s.mu.Unlock()
+	var once sync.Once
+	return f, func() {
+		once.Do(func() {
+			s.mu.Lock()
+			s.release(imageID)
+			s.mu.Unlock()
+		})
+	}
+}
+
+// prefetchImage is PrefetchImage, also returning the func to call once the
+// cache of imageID may be evicted again.
+func (s *Server) prefetchImage(ctx context.Context, imageID string, sources []Source, opts PrefetchOptions) (PrefetchResult, func(), error) {
+	f, release := s.hold(imageID, sources)
+	if err := f.Prepare(ctx); err != nil {
+		return PrefetchResult{}, release, err
+	}
+	materialized := f.Materialized()
+	res, err := f.Prefetch(ctx, opts)
+	if err != nil {
+		if IsVerificationError(err) {
+			logVerificationFailure(err, logrus.Fields{"cache": f.root})
+		}
+		return res, release, err
+	}
+	if !materialized && f.Materialized() {
+		s.mu.Lock()
+		mounts := s.attached(imageID)
+		s.mu.Unlock()
+		for _, m := range mounts {
+			s.emit(m, EventComplete, map[string]string{})
+		}
+	}
+	return res, release, nil
+}
+
+// attached returns the mount IDs of the containers attached to the fetcher
+// of imageID. s.mu must be held.
+func (s *Server) attached(imageID string) []string {
+	var mounts []string
+	for m, id := range s.mounts {
+		if id == imageID {
+			mounts = append(mounts, m)
+		}
+	}
+	sort.Strings(mounts)
+	return mounts
+}
+
+// emit passes an event of the container whose writable layer has the given
+// mount ID to the events func of the server, if any.
+func (s *Server) emit(mountID, action string, attributes map[string]string) {
+	if s.events != nil {
+		s.events(mountID, action, attributes)
+	}
+}
+
+// Stats returns the files looked up on demand for the container whose
+// writable layer has the given mount ID, and false if nothing is attached
+// to it.
+func (s *Server) Stats(mountID string) (FetchStats, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, ok := s.stats[mountID]
+	if !ok {
+		return FetchStats{}, false
+	}
+	return *st, true
+}
+
+// FetchLog returns at most limit of the files looked up on demand for the
+// container whose writable layer has the given mount ID after the entry
+// of ID after, oldest first, all of them if limit is 0, and whether more
+// follow. It returns false if nothing was attached to the mount ID since
+// the daemon started, or since the log was forgotten.
+func (s *Server) FetchLog(mountID string, after uint64, limit int) ([]FetchLogEntry, bool, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l, ok := s.logs[mountID]
+	if !ok {
+		return nil, false, false
+	}
+	entries, more := l.since(after, limit)
+	return entries, more, true
+}
+
+// ForgetFetchLog drops the fetch log of the container whose writable layer
+// has the given mount ID, once it is removed.
+func (s *Server) ForgetFetchLog(mountID string) {
+	s.mu.Lock()
+	delete(s.logs, mountID)
+	s.mu.Unlock()
+}
+
+// TotalStats returns the stats of all the files looked up since the daemon
+// started, for any image.
+func (s *Server) TotalStats() FetchStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var total FetchStats
+	for _, st := range s.imageStats {
+		total.Fetches += st.Fetches
+		total.CacheHits += st.CacheHits
+		total.FetchedBytes += st.FetchedBytes
+		if st.LastFetch.After(total.LastFetch) {
+			total.LastFetch = st.LastFetch
+		}
+	}
+	return total
+}
+
+// Close stops answering the fetch helper. Lookups of missing files fail
+// with ENOENT from then on. The lookups being answered, and the background
+// prefetches, are given the drain timeout to complete, then cancelled: the
+// files they were writing are discarded, to be fetched again once the
+// daemon restarts, and Close returns once they are.
+func (s *Server) Close() error {
+	s.closeOnce.Do(func() {
+		s.closeErr = s.close()
+	})
+	return s.closeErr
+}
+
+func (s *Server) close() error {
+	if s.sock != "" {
+		if err := s.configure(""); err != nil {
+			logrus.WithError(err).Warn("failed to reset simplify fetch helper")
+		}
+	}
+	s.helperMu.Lock()
+	close(s.stop)
+	var err error
+	if s.l != nil {
+		err = s.l.Close()
+		s.l = nil
+	}
+	if s.sock != "" {
+		os.Remove(s.sock)
+	}
+	s.helperMu.Unlock()
+
+	s.mu.Lock()
+	s.draining = true
+	timeout := s.drainTimeout
+	s.mu.Unlock()
+	if !s.drain(timeout) {
+		logrus.Warnf("simplify fetches still running after %s, cancelling them", timeout)
+	}
+	s.cancel()
+	s.inflight.Wait()
+	return err
+}
+
+// drain waits up to timeout for the lookups being answered and the
+// background prefetches to complete, and returns whether they did.
+func (s *Server) drain(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		s.inflight.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// begin registers a lookup of the fetch helper being answered, and returns
+// false if the server is draining, so it must not be answered.
+func (s *Server) begin() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.draining {
+		return false
+	}
+	s.inflight.Add(1)
+	return true
+}
+
+// enter registers a fetch the daemon runs itself, such as that of docker
+// cp, as begin does for the lookups, and returns its context, which is
+// cancelled along with them once the drain timeout expires, and the func to
+// call once it returns. It fails if the server is draining.
+func (s *Server) enter(ctx context.Context) (context.Context, func(), error) {
+	if !s.begin() {
+		return nil, nil, errDraining
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	returned := make(chan struct{})
+	go func() {
+		select {
+		case <-s.ctx.Done():
+			cancel()
+		case <-returned:
+		}
+	}()
+	return ctx, func() {
+		close(returned)
+		cancel()
+		s.inflight.Done()
+	}, nil
+}
+
+// serve answers the fetch helper on l until it fails. It is restarted
+// unless the server was closed.
+func (s *Server) serve(l net.Listener) {
+	var delay time.Duration
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			select {
+			case <-s.stop:
+				return
+			default:
+			}
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				// 如文件描述符耗尽，与net/http一样稍后重试
+				if delay == 0 {
+					delay = 5 * time.Millisecond
+				} else if delay *= 2; delay > time.Second {
+					delay = time.Second
+				}
+				logrus.WithError(err).Warnf("simplify fetch accept failed, retrying in %s", delay)
+				time.Sleep(delay)
+				continue
+			}
+			s.restart(l, err)
+			return
+		}
+		delay = 0
+		go s.handle(conn)
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+
+	var req fetchRequest
+	if err := json.NewDecoder(conn).Decode(&req); err != nil {
+		logrus.WithError(err).Debug("invalid simplify fetch request")
+		return
+	}
+	json.NewEncoder(conn).Encode(s.answer(req))
+}
+
+// answer looks up the file of req. A panic while fetching it only fails
+// the lookup, with EIO: the other lookups are answered as before.
+func (s *Server) answer(req fetchRequest) (resp fetchResponse) {
+	if !s.begin() {
+		return fetchResponse{Error: "simplify fetch is shutting down", Errno: syscall.ENOENT}
+	}
+	defer s.inflight.Done()
+	defer func() {
+		if r := recover(); r != nil {
+			logrus.WithField("path", req.Path).Errorf("simplify fetch panicked: %v\n%s", r, debug.Stack())
+			s.recovered(fmt.Errorf("panic fetching %s: %v", req.Path, r))
+			resp = fetchResponse{Error: fmt.Sprintf("simplify fetch failed: %v", r), Errno: syscall.EIO}
+		}
+	}()
+	if err := s.fetch(s.ctx, req); err != nil {
+		switch {
+		case os.IsNotExist(err):
+			resp.Errno = syscall.ENOENT
+		case IsVerificationError(err):
+			// 内容被篡改的文件不能让容器打开
+			logVerificationFailure(err, logrus.Fields{"path": req.Path, "upper": req.Upper})
+			resp.Errno = syscall.EIO
+		default:
+			logrus.WithError(err).WithField("path", req.Path).Warn("simplify fetch failed")
+			resp.Errno = syscall.EIO
+		}
+		resp.Error = err.Error()
+	}
+	return resp
+}
+
+// logVerificationFailure records content fetched for a simplified image
+// that did not match its digest. It is logged as a security event, as the
+// registry or the layer store may have been tampered with.
+func logVerificationFailure(err error, fields logrus.Fields) {
+	if verr, ok := errors.Cause(err).(VerificationError); ok {
+		fields["layer"] = verr.Layer
+		fields["expected"] = verr.Expected
+		if verr.Name != "" {
+			fields["entry"] = verr.Name
+		}
+	}
+	fields["event"] = "security"
+	logrus.WithError(err).WithFields(fields).Error("content fetched for simplified image failed verification, possible tampering")
+}
+
+func (s *Server) fetch(ctx context.Context, req fetchRequest) error {
+	// upperdir是"<mount id>/diff"，可能是相对路径
+	mountID := filepath.Base(filepath.Dir(req.Upper))
+
+	s.mu.Lock()
+	var f *Fetcher
+	imageID, ok := s.mounts[mountID]
+	if ok {
+		f = s.fetchers[imageID].Fetcher
+	}
+	timeout, ok := s.timeouts[mountID]
+	if !ok {
+		timeout = s.fetchTimeout
+	}
+	limit := s.fetchLimits[mountID]
+	s.mu.Unlock()
+	if f == nil {
+		return fmt.Errorf("no simplify fetcher attached to mount %s", mountID)
+	}
+
+	// 排队等待空闲的worker，期间查找缺失文件的系统调用保持阻塞，不计入超时
+	release, err := s.queue.acquire(ctx, mountID, limit)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	logrus.WithField("mount", mountID).Debugf("simplify fetch %s", req.Path)
+	start := time.Now()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	size, from, err := s.fetchRetry(ctx, f, req.Path)
+	entry := FetchLogEntry{Path: req.Path, Size: size, Latency: time.Since(start), Source: from, Time: start, Outcome: FetchOutcomeFetched}
+	switch {
+	case err == nil:
+		s.recordFetch(mountID, imageID, size, from == FetchSourceCache, start)
+	case os.IsNotExist(err):
+		entry.Outcome = FetchOutcomeNotFound
+	default:
+		entry.Outcome, entry.Error = FetchOutcomeFailed, err.Error()
+		attributes := map[string]string{"path": req.Path, "error": err.Error()}
+		if isNoSpace(err) {
+			attributes["reason"] = FetchErrorNoSpace
+			fetchNoSpace.Inc()
+		}
+		s.emit(mountID, EventFetchError, attributes)
+	}
+	s.mu.Lock()
+	if l := s.logs[mountID]; l != nil {
+		l.add(entry)
+	}
+	s.mu.Unlock()
+	return err
+}
+
+// fetchRetry fetches p with f, retrying with exponential backoff until ctx
+// is done: its deadline, if any, is all that bounds the retries. Files not
+// found, content failing verification and credentials the registry rejects
+// are not retried, nor is a full disk once the caches were evicted.
+func (s *Server) fetchRetry(ctx context.Context, f *Fetcher, p string) (int64, string, error) {
+	backoff := fetchBackoff
+	for attempt := 1; ; attempt++ {
+		size, from, err := f.fetch(ctx, p)
+		if isNoSpace(err) {
+			// 磁盘已满时回收缓存后重试一次
+			freed, eerr := s.evict(true)
+			if eerr != nil {
+				logrus.WithError(eerr).Warn("simplify cache eviction failed")
+			}
+			if freed > 0 {
+				size, from, err = f.fetch(ctx, p)
+			}
+			if isNoSpace(err) {
+				return size, from, errors.Wrapf(err, "no space left for the simplify cache after evicting %d bytes", freed)
+			}
+		}
+		if err == nil || os.IsNotExist(err) || IsVerificationError(err) || IsCredentialsError(err) || isNoSpace(err) {
+			return size, from, err
+		}
+		logrus.WithError(err).WithField("path", p).Debugf("simplify fetch failed, retrying in %s", backoff)
+		select {
+		case <-ctx.Done():
+			return 0, "", errors.Wrapf(err, "giving up after %d attempts", attempt)
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > fetchMaxBackoff {
+			backoff = fetchMaxBackoff
+		}
+	}
+}
+
+// recordFetch counts a file looked up for the container with the given
+// mount ID, running from imageID, in its stats and the daemon metrics.
+func (s *Server) recordFetch(mountID, imageID string, size int64, cached bool, start time.Time) {
+	now := time.Now()
+	s.mu.Lock()
+	if st := s.stats[mountID]; st != nil {
+		st.add(size, cached, now)
+	}
+	st := s.imageStats[imageID]
+	if st == nil {
+		st = &FetchStats{}
+		s.imageStats[imageID] = st
+	}
+	st.add(size, cached, now)
+	ratio := float64(st.CacheHits) / float64(st.Fetches)
+	if !cached && s.size >= 0 {
+		s.size += size
+	}
+	s.mu.Unlock()
+
+	fetches.WithValues(imageID).Inc()
+	cacheHitRatio.WithValues(imageID).Set(ratio)
+	if !cached {
+		fetchedBytes.WithValues(imageID).Inc(float64(size))
+		fetchLatency.WithValues(imageID).Update(now.Sub(start))
+	}
+}
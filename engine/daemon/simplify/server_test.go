@@ -0,0 +1,797 @@
+package simplify // import "github.com/docker/docker/daemon/simplify"
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+// newTestServer returns a Server without a listener: requests are answered
+// by calling fetch directly.
+func newTestServer(root string, events EventFunc) *Server {
+	stop := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Server{
+		root:        root,
+		fetchers:    make(map[string]*fetcherRef),
+		mounts:      make(map[string]string),
+		stats:       make(map[string]*FetchStats),
+		imageStats:  make(map[string]*FetchStats),
+		logs:        make(map[string]*fetchLog),
+		inserts:     make(map[string]*insertTarget),
+		timeouts:    make(map[string]time.Duration),
+		fetchLimits: make(map[string]int),
+		queue:       newFetchQueue(0, stop),
+		size:        -1,
+		events:      events,
+		stop:        stop,
+		ctx:         ctx,
+		cancel:      cancel,
+		configure:   func(string) error { return nil },
+	}
+}
+
+func TestServerFetchStats(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("requires root to preserve ownership")
+	}
+	root, err := ioutil.TempDir("", "simplify-server")
+	assert.NilError(t, err)
+	defer os.RemoveAll(root)
+
+	s := newTestServer(root, nil)
+	ctx := context.Background()
+	sources := []Source{tarSource{dir("etc/"), file("etc/app.conf"), file("etc/hosts")}}
+	for _, mountID := range []string{"first", "second"} {
+		_, err := s.Attach(ctx, mountID, "image", sources, 0, 0)
+		assert.NilError(t, err)
+	}
+	size, err := s.CacheSize()
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(size, int64(0)))
+
+	assert.NilError(t, s.fetch(ctx, fetchRequest{Upper: "first/diff", Path: "/etc/app.conf"}))
+	// the second container finds the file fetched for the first in the cache
+	assert.NilError(t, s.fetch(ctx, fetchRequest{Upper: "second/diff", Path: "/etc/app.conf"}))
+	assert.NilError(t, s.fetch(ctx, fetchRequest{Upper: "second/diff", Path: "/etc/hosts"}))
+	// files not found are not counted
+	assert.Check(t, os.IsNotExist(s.fetch(ctx, fetchRequest{Upper: "second/diff", Path: "/etc/missing"})))
+
+	first, ok := s.Stats("first")
+	assert.Assert(t, ok)
+	assert.Check(t, is.Equal(first.Fetches, uint64(1)))
+	assert.Check(t, is.Equal(first.CacheHits, uint64(0)))
+	assert.Check(t, is.Equal(first.FetchedBytes, uint64(len("etc/app.conf"))))
+	assert.Check(t, !first.LastFetch.IsZero())
+
+	second, ok := s.Stats("second")
+	assert.Assert(t, ok)
+	assert.Check(t, is.Equal(second.Fetches, uint64(2)))
+	assert.Check(t, is.Equal(second.CacheHits, uint64(1)))
+	assert.Check(t, is.Equal(second.FetchedBytes, uint64(len("etc/hosts"))))
+
+	assert.Check(t, is.DeepEqual(*s.imageStats["image"], FetchStats{
+		Fetches:      3,
+		CacheHits:    1,
+		FetchedBytes: uint64(len("etc/app.conf") + len("etc/hosts")),
+		LastFetch:    second.LastFetch,
+	}))
+	assert.Check(t, is.DeepEqual(s.TotalStats(), *s.imageStats["image"]))
+
+	// the size is kept up to date without scanning the caches again
+	size, err = s.CacheSize()
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(size, int64(len("etc/app.conf")+len("etc/hosts"))))
+	_, scanned, err := scanCaches(root)
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(size, scanned))
+
+	s.Detach("first")
+	_, ok = s.Stats("first")
+	assert.Check(t, !ok)
+
+	// the log of the files looked up outlives the container
+	entries, more, ok := s.FetchLog("second", 0, 0)
+	assert.Assert(t, ok)
+	assert.Check(t, !more)
+	assert.Assert(t, is.Len(entries, 3))
+	for i, e := range []FetchLogEntry{
+		{ID: 1, Path: "/etc/app.conf", Size: int64(len("etc/app.conf")), Source: FetchSourceCache, Outcome: FetchOutcomeFetched},
+		{ID: 2, Path: "/etc/hosts", Size: int64(len("etc/hosts")), Source: FetchSourceImage, Outcome: FetchOutcomeFetched},
+		{ID: 3, Path: "/etc/missing", Outcome: FetchOutcomeNotFound},
+	} {
+		assert.Check(t, !entries[i].Time.IsZero())
+		e.Time, e.Latency = entries[i].Time, entries[i].Latency
+		assert.Check(t, is.DeepEqual(entries[i], e))
+	}
+	s.Detach("second")
+	entries, more, ok = s.FetchLog("second", 1, 1)
+	assert.Assert(t, ok)
+	assert.Check(t, more)
+	assert.Check(t, is.Len(entries, 1))
+	assert.Check(t, is.Equal(entries[0].Path, "/etc/hosts"))
+
+	s.ForgetFetchLog("second")
+	_, _, ok = s.FetchLog("second", 0, 0)
+	assert.Check(t, !ok)
+}
+
+type serverEvent struct {
+	MountID, Action string
+	Attributes      map[string]string
+}
+
+func TestServerEvents(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("requires root to preserve ownership")
+	}
+	root, err := ioutil.TempDir("", "simplify-server")
+	assert.NilError(t, err)
+	defer os.RemoveAll(root)
+
+	events := make(chan serverEvent, 10)
+	s := newTestServer(root, func(mountID, action string, attributes map[string]string) {
+		events <- serverEvent{mountID, action, attributes}
+	})
+	ctx := context.Background()
+	files := tarSource{dir("bin/"), file("bin/sh"), file("bin/ls")}
+	_, err = s.Attach(ctx, "corrupted", "tampered", []Source{corruptedSource{files}}, 0, 0)
+	assert.NilError(t, err)
+
+	// files not found are not failures
+	assert.Check(t, os.IsNotExist(s.fetch(ctx, fetchRequest{Upper: "corrupted/diff", Path: "/bin/missing"})))
+	err = s.fetch(ctx, fetchRequest{Upper: "corrupted/diff", Path: "/bin/ls"})
+	assert.Check(t, IsVerificationError(err), "%v", err)
+	assert.Check(t, is.DeepEqual(<-events, serverEvent{"corrupted", EventFetchError, map[string]string{"path": "/bin/ls", "error": err.Error()}}))
+
+	for _, mountID := range []string{"first", "second"} {
+		_, err := s.Attach(ctx, mountID, "image", []Source{files}, 0, 0)
+		assert.NilError(t, err)
+	}
+	s.Prefetch("first", 0)
+	// every container of the image is told, not only the one prefetching
+	assert.Check(t, is.DeepEqual(<-events, serverEvent{"first", EventComplete, map[string]string{}}))
+	assert.Check(t, is.DeepEqual(<-events, serverEvent{"second", EventComplete, map[string]string{}}))
+	assert.Check(t, is.Len(events, 0))
+}
+
+// unreachableSource fails to open its layer, as an unreachable registry
+// would, once failures is set.
+type unreachableSource struct {
+	tarSource
+	// failures is the number of opens left to fail, or -1 for opens to
+	// hang until their context is done
+	failures *int
+}
+
+func (s unreachableSource) Open(ctx context.Context) (io.ReadCloser, error) {
+	switch {
+	case *s.failures < 0:
+		<-ctx.Done()
+		return nil, ctx.Err()
+	case *s.failures > 0:
+		*s.failures--
+		return nil, errors.New("connection refused")
+	}
+	return s.tarSource.Open(ctx)
+}
+
+func TestServerFetchRetry(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("requires root to preserve ownership")
+	}
+	root, err := ioutil.TempDir("", "simplify-server")
+	assert.NilError(t, err)
+	defer os.RemoveAll(root)
+
+	events := make(chan serverEvent, 10)
+	s := newTestServer(root, func(mountID, action string, attributes map[string]string) {
+		events <- serverEvent{mountID, action, attributes}
+	})
+	s.fetchTimeout = time.Minute
+	ctx := context.Background()
+	var failures int
+	src := unreachableSource{tarSource{dir("bin/"), file("bin/sh"), file("bin/ls"), file("bin/cat")}, &failures}
+	_, err = s.Attach(ctx, "patient", "image", []Source{src}, 0, 0)
+	assert.NilError(t, err)
+	_, err = s.Attach(ctx, "latency-sensitive", "image", []Source{src}, 300*time.Millisecond, 0)
+	assert.NilError(t, err)
+
+	// transient failures are retried
+	failures = 2
+	assert.NilError(t, s.fetch(ctx, fetchRequest{Upper: "patient/diff", Path: "/bin/sh"}))
+	assert.Check(t, is.Equal(failures, 0))
+
+	// there is no limit on the attempts but the timeout of the container
+	failures = 6
+	assert.NilError(t, s.fetch(ctx, fetchRequest{Upper: "patient/diff", Path: "/bin/ls"}))
+	assert.Check(t, is.Equal(failures, 0))
+
+	// the timeout of the container bounds a fetch that hangs
+	failures = -1
+	start := time.Now()
+	err = s.fetch(ctx, fetchRequest{Upper: "latency-sensitive/diff", Path: "/bin/cat"})
+	assert.Check(t, is.ErrorContains(err, "context deadline exceeded"))
+	assert.Check(t, time.Since(start) < 10*time.Second)
+	ev := <-events
+	assert.Check(t, is.Equal(ev.MountID, "latency-sensitive"))
+	assert.Check(t, is.Equal(ev.Attributes["path"], "/bin/cat"))
+}
+
+func TestServerFetchRetryUntilTimeout(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("requires root to preserve ownership")
+	}
+	root, err := ioutil.TempDir("", "simplify-server")
+	assert.NilError(t, err)
+	defer os.RemoveAll(root)
+
+	events := make(chan serverEvent, 10)
+	s := newTestServer(root, func(mountID, action string, attributes map[string]string) {
+		events <- serverEvent{mountID, action, attributes}
+	})
+	ctx := context.Background()
+	var failures int
+	src := unreachableSource{tarSource{dir("bin/"), file("bin/sh")}, &failures}
+	timeout := 2 * time.Second
+	_, err = s.Attach(ctx, "unreachable", "image", []Source{src}, timeout, 0)
+	assert.NilError(t, err)
+	// the registry goes down once the cache is prepared
+	failures = 1000
+
+	// the fetch is retried until the timeout, then given up
+	start := time.Now()
+	err = s.fetch(ctx, fetchRequest{Upper: "unreachable/diff", Path: "/bin/sh"})
+	elapsed := time.Since(start)
+	assert.Check(t, is.ErrorContains(err, "connection refused"))
+	assert.Check(t, elapsed >= timeout, "gave up after %s", elapsed)
+	assert.Check(t, elapsed < timeout+time.Second, "gave up after %s", elapsed)
+	// retried at 0, 100ms, 300ms, 700ms and 1.5s, then at most every second
+	assert.Check(t, 1000-failures >= 5, "fetched %d times", 1000-failures)
+	ev := <-events
+	assert.Check(t, is.Equal(ev.Action, EventFetchError))
+	assert.Check(t, is.Equal(ev.Attributes["path"], "/bin/sh"))
+}
+
+// rejectedSource is a layer whose registry rejects the credentials it is
+// fetched with once it is prepared.
+type rejectedSource struct {
+	tarSource
+	opens *int
+}
+
+func (s rejectedSource) Open(ctx context.Context) (io.ReadCloser, error) {
+	*s.opens++
+	if *s.opens > 1 {
+		return nil, CredentialsError{Repository: "registry.example.com/private", Err: errors.New("unauthorized: authentication required")}
+	}
+	return s.tarSource.Open(ctx)
+}
+
+func TestServerFetchRejectedCredentials(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("requires root to preserve ownership")
+	}
+	root, err := ioutil.TempDir("", "simplify-server")
+	assert.NilError(t, err)
+	defer os.RemoveAll(root)
+
+	events := make(chan serverEvent, 10)
+	s := newTestServer(root, func(mountID, action string, attributes map[string]string) {
+		events <- serverEvent{mountID, action, attributes}
+	})
+	s.fetchTimeout = time.Minute
+	ctx := context.Background()
+	var opens int
+	_, err = s.Attach(ctx, "private", "image", []Source{rejectedSource{tarSource{dir("bin/"), file("bin/sh")}, &opens}}, 0, 0)
+	assert.NilError(t, err)
+
+	// fetching again does not help until the image is pulled again
+	err = s.fetch(ctx, fetchRequest{Upper: "private/diff", Path: "/bin/sh"})
+	assert.Check(t, IsCredentialsError(err), "%v", err)
+	assert.Check(t, is.Equal(opens, 2))
+	ev := <-events
+	assert.Check(t, is.Equal(ev.Action, EventFetchError))
+	assert.Check(t, is.Contains(ev.Attributes["error"], "registry rejected the credentials for registry.example.com/private"))
+}
+
+func TestServerPrefetchImage(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("requires root to preserve ownership")
+	}
+	root, err := ioutil.TempDir("", "simplify-server")
+	assert.NilError(t, err)
+	defer os.RemoveAll(root)
+
+	events := make(chan serverEvent, 10)
+	s := newTestServer(root, func(mountID, action string, attributes map[string]string) {
+		events <- serverEvent{mountID, action, attributes}
+	})
+	ctx := context.Background()
+	sources := []Source{tarSource{dir("bin/"), file("bin/sh"), file("bin/ls")}}
+
+	// without containers running, the fetcher is only kept for the prefetch
+	res, err := s.PrefetchImage(ctx, "idle", sources, PrefetchOptions{Patterns: []string{"/bin/sh"}})
+	assert.NilError(t, err)
+	assert.Check(t, is.DeepEqual(res, PrefetchResult{Files: 1, Bytes: int64(len("bin/sh"))}))
+	assert.Check(t, is.Len(s.fetchers, 0))
+	assert.Check(t, is.Len(events, 0))
+
+	_, err = s.Attach(ctx, "running", "image", sources, 0, 0)
+	assert.NilError(t, err)
+	res, err = s.PrefetchImage(ctx, "image", nil, PrefetchOptions{})
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(res.Files, 2))
+	assert.Check(t, is.DeepEqual(<-events, serverEvent{"running", EventComplete, map[string]string{}}))
+	assert.Check(t, is.Equal(s.fetchers["image"].refs, 1))
+
+	// prefetching again is a no-op
+	res, err = s.PrefetchImage(ctx, "image", nil, PrefetchOptions{})
+	assert.NilError(t, err)
+	assert.Check(t, is.DeepEqual(res, PrefetchResult{}))
+	assert.Check(t, is.Len(events, 0))
+}
+
+func TestServerMaterialize(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("requires root to preserve ownership")
+	}
+	root, err := ioutil.TempDir("", "simplify-server")
+	assert.NilError(t, err)
+	defer os.RemoveAll(root)
+
+	s := newTestServer(root, nil)
+	s.evicting = true
+	sources := []Source{tarSource{dir("bin/"), file("bin/sh"), file("bin/ls")}}
+	dir, release, err := s.Materialize(context.Background(), "image", sources)
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(dir, CacheDir(root, "image")))
+	_, err = os.Stat(filepath.Join(dir, "bin/ls"))
+	assert.NilError(t, err)
+
+	// the cache is kept until released, however small the maximum
+	s.maxSize = 1
+	freed, err := s.evict(false)
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(freed, int64(0)))
+	release()
+	release()
+	assert.Check(t, is.Len(s.fetchers, 0))
+	freed, err = s.evict(false)
+	assert.NilError(t, err)
+	assert.Check(t, freed > 0)
+}
+
+func TestServerEvictLockedCache(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("requires root to preserve ownership")
+	}
+	root, err := ioutil.TempDir("", "simplify-server")
+	assert.NilError(t, err)
+	defer os.RemoveAll(root)
+
+	s := newTestServer(root, nil)
+	s.evicting = true
+	s.maxSize = 1
+	ctx := context.Background()
+	sources := []Source{tarSource{dir("bin/"), file("bin/sh"), file("bin/ls")}}
+	_, err = s.PrefetchImage(ctx, "image", sources, PrefetchOptions{})
+	assert.NilError(t, err)
+
+	// a cache prepared after the eviction recorded the attached ones, as by
+	// a container attached while it runs, is kept until closed
+	f := NewFetcher(filepath.Join(root, "image"), sources)
+	assert.NilError(t, f.Prepare(ctx))
+	freed, err := s.evict(false)
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(freed, int64(0)))
+	assert.NilError(t, f.Close())
+	freed, err = s.evict(false)
+	assert.NilError(t, err)
+	assert.Check(t, freed > 0)
+
+	// the lock files are removed along with the cache
+	assert.NilError(t, RemoveCache(root, "image"))
+	_, err = os.Stat(filepath.Join(root, "image"+usedLock))
+	assert.Check(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(root, "image"))
+	assert.Check(t, os.IsNotExist(err))
+}
+
+func TestServerPin(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("requires root to preserve ownership")
+	}
+	root, err := ioutil.TempDir("", "simplify-server")
+	assert.NilError(t, err)
+	defer os.RemoveAll(root)
+
+	s := newTestServer(root, nil)
+	s.evicting = true
+	ctx := context.Background()
+	sources := []Source{tarSource{dir("bin/"), file("bin/sh"), file("bin/ls"), dir("usr/"), dir("usr/bin/"), file("usr/bin/gdb"), file("usr/bin/strace")}}
+
+	// the pinned files are fetched at once
+	res, err := s.Pin(ctx, "image", sources, PrefetchOptions{Patterns: []string{"usr/bin/gdb", "/usr/bin/strace"}})
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(res.Files, 2))
+	_, err = s.PrefetchImage(ctx, "image", sources, PrefetchOptions{Patterns: []string{"/bin/*"}})
+	assert.NilError(t, err)
+	pins, err := Pins(root, "image")
+	assert.NilError(t, err)
+	assert.Check(t, is.DeepEqual(pins, []string{"/usr/bin/gdb", "/usr/bin/strace"}))
+
+	// pinned files are kept, however small the maximum
+	s.maxSize = 1
+	_, err = s.evict(true)
+	assert.NilError(t, err)
+	for _, tc := range []struct {
+		path    string
+		evicted bool
+	}{
+		{"bin/sh", true},
+		{"bin/ls", true},
+		{"usr/bin/gdb", false},
+		{"usr/bin/strace", false},
+	} {
+		_, err := os.Stat(filepath.Join(CacheDir(root, "image"), tc.path))
+		assert.Check(t, is.Equal(os.IsNotExist(err), tc.evicted), tc.path)
+	}
+
+	notPinned, err := s.Unpin("image", []string{"/usr/bin/strace", "/bin/sh"})
+	assert.NilError(t, err)
+	assert.Check(t, is.DeepEqual(notPinned, []string{"/bin/sh"}))
+	pins, err = Pins(root, "image")
+	assert.NilError(t, err)
+	assert.Check(t, is.DeepEqual(pins, []string{"/usr/bin/gdb"}))
+	_, err = s.evict(false)
+	assert.NilError(t, err)
+	_, err = os.Stat(filepath.Join(CacheDir(root, "image"), "usr/bin/strace"))
+	assert.Check(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(CacheDir(root, "image"), "usr/bin/gdb"))
+	assert.Check(t, err)
+
+	// unpinning the last path removes the pins
+	_, err = s.Unpin("image", []string{"/usr/bin/gdb"})
+	assert.NilError(t, err)
+	_, err = os.Stat(filepath.Join(root, "image", pinsFile))
+	assert.Check(t, os.IsNotExist(err))
+}
+
+func TestServerFetchPath(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("requires root to preserve ownership")
+	}
+	root, err := ioutil.TempDir("", "simplify-server")
+	assert.NilError(t, err)
+	defer os.RemoveAll(root)
+
+	s := newTestServer(root, nil)
+	sources := []Source{tarSource{dir("bin/"), file("bin/sh"), dir("usr/"), dir("usr/share/"), dir("usr/share/doc/"), file("usr/share/doc/README"), file("usr/share/doc/NEWS")}}
+	dir, release, err := s.FetchPath(context.Background(), "image", sources, "/usr/share")
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(dir, CacheDir(root, "image")))
+	// the files under the directory are fetched, and only them
+	for _, p := range []string{"usr/share/doc/README", "usr/share/doc/NEWS"} {
+		_, err = os.Stat(filepath.Join(dir, p))
+		assert.Check(t, err)
+	}
+	_, err = os.Stat(filepath.Join(dir, "bin/sh"))
+	assert.Check(t, os.IsNotExist(err))
+	assert.Check(t, is.Equal(s.fetchers["image"].refs, 1))
+	release()
+
+	_, release, err = s.FetchPath(context.Background(), "image", sources, "/bin/sh")
+	assert.NilError(t, err)
+	_, err = os.Stat(filepath.Join(dir, "bin/sh"))
+	assert.Check(t, err)
+	release()
+	// paths the full image lacks are not an error
+	_, release, err = s.FetchPath(context.Background(), "image", sources, "/opt")
+	assert.NilError(t, err)
+	release()
+	assert.Check(t, is.Len(s.fetchers, 0))
+}
+
+func TestServerSharedCache(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("requires root to preserve ownership")
+	}
+	root, err := ioutil.TempDir("", "simplify-server")
+	assert.NilError(t, err)
+	defer os.RemoveAll(root)
+
+	// two daemons sharing the directory of the caches
+	local, other := newTestServer(root, nil), newTestServer(root, nil)
+	for _, s := range []*Server{local, other} {
+		s.shared = true
+		s.evicting = true
+		s.maxSize = 1
+	}
+	sources := []Source{tarSource{dir("bin/"), file("bin/sh"), file("bin/ls")}}
+	ctx := context.Background()
+
+	errs := make(chan error)
+	releases := make(chan func(), 2)
+	for _, s := range []*Server{local, other} {
+		go func(s *Server) {
+			_, release, err := s.FetchPath(ctx, "image", sources, "/bin/sh")
+			releases <- release
+			errs <- err
+		}(s)
+	}
+	assert.Check(t, <-errs)
+	assert.Check(t, <-errs)
+	(<-releases)()
+
+	dir, release, err := local.Materialize(ctx, "image", sources)
+	assert.NilError(t, err)
+	(<-releases)()
+	_, err = os.Stat(filepath.Join(dir, "bin/ls"))
+	assert.NilError(t, err)
+
+	// the cache is not evicted by the other daemon while in use
+	freed, err := other.evict(false)
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(freed, int64(0)))
+	release()
+	freed, err = other.evict(false)
+	assert.NilError(t, err)
+	assert.Check(t, freed > 0)
+
+	// files are not shared through the hard links of the blob store
+	_, err = os.Stat(filepath.Join(root, blobsDir))
+	assert.Check(t, os.IsNotExist(err))
+}
+
+// gatedSource holds the opens of its layer, once armed is set, until gate
+// is closed. Each open held is sent to opened.
+type gatedSource struct {
+	tarSource
+	armed  *int32
+	opened chan struct{}
+	gate   chan struct{}
+}
+
+func (s gatedSource) Open(ctx context.Context) (io.ReadCloser, error) {
+	if atomic.LoadInt32(s.armed) != 0 {
+		s.opened <- struct{}{}
+		select {
+		case <-s.gate:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return s.tarSource.Open(ctx)
+}
+
+func TestServerDrain(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("requires root to preserve ownership")
+	}
+	root, err := ioutil.TempDir("", "simplify-server")
+	assert.NilError(t, err)
+	defer os.RemoveAll(root)
+
+	// a fetch running when the server is closed completes within the
+	// drain timeout
+	s := newTestServer(root, nil)
+	s.drainTimeout = time.Minute
+	var armed int32
+	src := gatedSource{tarSource{dir("etc/"), file("etc/app.conf"), file("etc/hosts")}, &armed, make(chan struct{}, 1), make(chan struct{})}
+	_, err = s.Attach(context.Background(), "container", "image", []Source{src}, 0, 0)
+	assert.NilError(t, err)
+	atomic.StoreInt32(&armed, 1)
+	answered := make(chan fetchResponse)
+	go func() {
+		answered <- s.answer(fetchRequest{Upper: "container/diff", Path: "/etc/app.conf"})
+	}()
+	<-src.opened
+	closed := make(chan error)
+	go func() {
+		closed <- s.Close()
+	}()
+	select {
+	case <-closed:
+		t.Fatal("the server was closed before the fetch completed")
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(src.gate)
+	assert.Check(t, is.Equal((<-answered).Errno, syscall.Errno(0)))
+	assert.NilError(t, <-closed)
+	_, err = os.Stat(filepath.Join(root, "image", "fs", "etc", "app.conf"))
+	assert.NilError(t, err)
+	// lookups are no longer answered
+	resp := s.answer(fetchRequest{Upper: "container/diff", Path: "/etc/hosts"})
+	assert.Check(t, is.Equal(resp.Errno, syscall.ENOENT))
+
+	// a fetch still running after the drain timeout is cancelled, leaving
+	// nothing behind
+	s = newTestServer(root, nil)
+	s.drainTimeout = 100 * time.Millisecond
+	failures := -1
+	_, err = s.Attach(context.Background(), "container", "image", []Source{unreachableSource{src.tarSource, &failures}}, 0, 0)
+	assert.NilError(t, err)
+	go func() {
+		answered <- s.answer(fetchRequest{Upper: "container/diff", Path: "/etc/hosts"})
+	}()
+	time.Sleep(50 * time.Millisecond)
+	assert.NilError(t, s.Close())
+	resp = <-answered
+	assert.Check(t, is.Equal(resp.Errno, syscall.EIO))
+	assert.Check(t, is.Contains(resp.Error, "context canceled"))
+	_, err = os.Stat(filepath.Join(root, "image", "fs", "etc", "hosts"))
+	assert.Check(t, os.IsNotExist(err))
+
+	// the files left partially written by a daemon that did not drain are
+	// discarded once it restarts
+	stale := filepath.Join(root, "image", "tmp", "fetch-stale")
+	assert.NilError(t, ioutil.WriteFile(stale, []byte("trunc"), 0644))
+	s = newTestServer(root, nil)
+	_, err = s.Attach(context.Background(), "container", "image", []Source{src.tarSource}, 0, 0)
+	assert.NilError(t, err)
+	_, err = os.Stat(stale)
+	assert.Check(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(root, "image", "fs", "etc", "app.conf"))
+	assert.NilError(t, err)
+}
+
+func TestServerDrainFetchPath(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("requires root to preserve ownership")
+	}
+	root, err := ioutil.TempDir("", "simplify-server")
+	assert.NilError(t, err)
+	defer os.RemoveAll(root)
+
+	// a fetch of the daemon running when the server is closed completes
+	// within the drain timeout
+	s := newTestServer(root, nil)
+	s.drainTimeout = time.Minute
+	var armed int32
+	src := gatedSource{tarSource{dir("etc/"), file("etc/app.conf"), file("etc/hosts")}, &armed, make(chan struct{}, 1), make(chan struct{})}
+	atomic.StoreInt32(&armed, 1)
+	type fetched struct {
+		release func()
+		err     error
+	}
+	fetches := make(chan fetched)
+	go func() {
+		_, release, err := s.FetchPath(context.Background(), "image", []Source{src}, "/etc/app.conf")
+		fetches <- fetched{release, err}
+	}()
+	<-src.opened
+	closed := make(chan error)
+	go func() {
+		closed <- s.Close()
+	}()
+	select {
+	case <-closed:
+		t.Fatal("the server was closed before the fetch completed")
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(src.gate)
+	f := <-fetches
+	assert.NilError(t, f.err)
+	f.release()
+	assert.NilError(t, <-closed)
+
+	// the fetches of the daemon are refused once the server is closed
+	_, _, err = s.FetchPath(context.Background(), "image", []Source{src.tarSource}, "/etc/hosts")
+	assert.Check(t, is.Equal(err, errDraining))
+	_, _, err = s.Materialize(context.Background(), "image", []Source{src.tarSource})
+	assert.Check(t, is.Equal(err, errDraining))
+	_, err = s.PrefetchImage(context.Background(), "image", []Source{src.tarSource}, PrefetchOptions{})
+	assert.Check(t, is.Equal(err, errDraining))
+	_, err = s.Pin(context.Background(), "image", []Source{src.tarSource}, PrefetchOptions{Patterns: []string{"/etc/hosts"}})
+	assert.Check(t, is.Equal(err, errDraining))
+	// closing again is a no-op
+	assert.NilError(t, s.Close())
+
+	// a fetch of the daemon still running after the drain timeout is
+	// cancelled, however long its own context
+	s = newTestServer(root, nil)
+	s.drainTimeout = 100 * time.Millisecond
+	failures := -1
+	go func() {
+		_, release, err := s.Materialize(context.Background(), "other", []Source{unreachableSource{src.tarSource, &failures}})
+		fetches <- fetched{release, err}
+	}()
+	time.Sleep(50 * time.Millisecond)
+	assert.NilError(t, s.Close())
+	f = <-fetches
+	assert.Check(t, is.ErrorContains(f.err, "context canceled"))
+	assert.Check(t, is.Len(s.fetchers, 0))
+}
+
+// fullSource fails to be read past the first bytes of the content of
+// etc/hosts, as the disk filling up while it is written would, as long as
+// failures is not 0. Each failure decrements failures if it is positive.
+type fullSource struct {
+	tarSource
+	failures *int
+}
+
+func (s fullSource) Open(ctx context.Context) (io.ReadCloser, error) {
+	b, err := s.tar()
+	if err != nil {
+		return nil, err
+	}
+	if *s.failures == 0 {
+		return ioutil.NopCloser(bytes.NewReader(b)), nil
+	}
+	if *s.failures > 0 {
+		*s.failures--
+	}
+	// etc/hosts follows the header of etc/ and its own
+	return ioutil.NopCloser(io.MultiReader(bytes.NewReader(b[:2*512+4]), noSpaceReader{})), nil
+}
+
+type noSpaceReader struct{}
+
+func (noSpaceReader) Read([]byte) (int, error) {
+	return 0, &os.PathError{Op: "write", Path: "/tmp/fetch-1", Err: syscall.ENOSPC}
+}
+
+func TestServerFetchNoSpace(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("requires root to preserve ownership")
+	}
+	root, err := ioutil.TempDir("", "simplify-server")
+	assert.NilError(t, err)
+	defer os.RemoveAll(root)
+
+	events := make(chan serverEvent, 10)
+	s := newTestServer(root, func(mountID, action string, attributes map[string]string) {
+		events <- serverEvent{mountID, action, attributes}
+	})
+	s.evicting = true
+	ctx := context.Background()
+	// the cache of an image no container runs can be evicted
+	_, release, err := s.Materialize(ctx, "old", []Source{tarSource{dir("bin/"), file("bin/sh"), file("bin/ls")}})
+	assert.NilError(t, err)
+	release()
+
+	var failures int
+	src := fullSource{tarSource{dir("etc/"), file("etc/hosts"), file("etc/app.conf")}, &failures}
+	_, err = s.Attach(ctx, "container", "image", []Source{src}, 0, 0)
+	assert.NilError(t, err)
+
+	// the fetch is retried once the cache was evicted
+	failures = 1
+	assert.NilError(t, s.fetch(ctx, fetchRequest{Upper: "container/diff", Path: "/etc/hosts"}))
+	assert.Check(t, is.Equal(failures, 0))
+	size, err := s.CacheSize()
+	assert.NilError(t, err)
+	assert.Check(t, size < int64(len("/bin/sh")+len("/bin/ls")+len("/etc/hosts")))
+
+	// the disk is still full once nothing is left to evict
+	assert.NilError(t, os.RemoveAll(filepath.Join(root, "image", "fs", "etc", "hosts")))
+	failures = -1
+	err = s.fetch(ctx, fetchRequest{Upper: "container/diff", Path: "/etc/hosts"})
+	assert.Check(t, isNoSpace(err))
+	assert.Check(t, is.ErrorContains(err, "no space left for the simplify cache"))
+	resp := s.answer(fetchRequest{Upper: "container/diff", Path: "/etc/hosts"})
+	assert.Check(t, is.Equal(resp.Errno, syscall.EIO))
+	ev := <-events
+	assert.Check(t, is.Equal(ev.Action, EventFetchError))
+	assert.Check(t, is.Equal(ev.Attributes["reason"], FetchErrorNoSpace))
+
+	// nothing partially written is left behind
+	_, err = os.Lstat(filepath.Join(root, "image", "fs", "etc", "hosts"))
+	assert.Check(t, os.IsNotExist(err))
+	tmp, err := ioutil.ReadDir(filepath.Join(root, "image", "tmp"))
+	assert.NilError(t, err)
+	assert.Check(t, is.Len(tmp, 0))
+}
@@ -0,0 +1,283 @@
+package simplify // import "github.com/docker/docker/daemon/simplify"
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/docker/docker/pkg/ioutils"
+	"github.com/docker/docker/pkg/mount"
+	"github.com/opencontainers/go-digest"
+	"github.com/opencontainers/selinux/go-selinux/label"
+	"github.com/sirupsen/logrus"
+)
+
+// SharedMountRoot returns the directory the shared read-only mounts of the
+// layers of simplified images are made in.
+func SharedMountRoot(daemonRoot string) string {
+	return filepath.Join(daemonRoot, "simplify", "mounts")
+}
+
+// SharedMountID returns the ID of the shared mount of lowers labeled with
+// mountLabel.
+func SharedMountID(lowers []string, mountLabel string) string {
+	key := strings.Join(lowers, ":")
+	if mountLabel != "" {
+		// 不带标签的挂载保持原来的ID
+		key += "\n" + mountLabel
+	}
+	return digest.FromString(key).Hex()
+}
+
+// SharedMountLabel returns the SELinux label the shared mount of the layers
+// of a container labeled mountLabel is made with: the label with level s0,
+// which containers of every level can read, as volumes shared with the "z"
+// option are labeled. An empty label is returned as it is.
+func SharedMountLabel(mountLabel string) string {
+	parts := strings.SplitN(mountLabel, ":", 4)
+	if len(parts) < 4 {
+		return mountLabel
+	}
+	parts[3] = "s0"
+	return strings.Join(parts, ":")
+}
+
+// sharedMountState is saved along with each shared mount so that the
+// containers holding it are known after a daemon restart.
+type sharedMountState struct {
+	// Lowers are the directories mounted, topmost first.
+	Lowers []string
+	// Holders are the IDs of the containers mounted on top of it, sorted.
+	Holders []string
+}
+
+// SharedMounts mounts the layers of an image read-only once for all the
+// simplified containers running it, and unmounts them once the last of
+// them is cleaned up. The containers holding each mount are saved on disk.
+type SharedMounts struct {
+	root    string
+	mount   func(lowers []string, mountLabel, target string) error
+	unmount func(target string) error
+	mounted func(target string) (bool, error)
+
+	mu     sync.Mutex
+	states map[string]*sharedMountState
+}
+
+// NewSharedMounts returns the shared mounts made in root, loading the
+// holders saved by the previous daemon.
+func NewSharedMounts(root string) (*SharedMounts, error) {
+	return newSharedMounts(root, mountLowers, unmountLowers, mountedLowers)
+}
+
+func newSharedMounts(root string, mount func([]string, string, string) error, unmount func(string) error, mounted func(string) (bool, error)) (*SharedMounts, error) {
+	s := &SharedMounts{
+		root:    root,
+		mount:   mount,
+		unmount: unmount,
+		mounted: mounted,
+		states:  make(map[string]*sharedMountState),
+	}
+	if err := os.MkdirAll(root, 0700); err != nil {
+		return nil, err
+	}
+	dirs, err := ioutil.ReadDir(root)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range dirs {
+		b, err := ioutil.ReadFile(s.statePath(d.Name()))
+		if err != nil {
+			// 没有状态的挂载在Reconcile时回收
+			continue
+		}
+		var state sharedMountState
+		if err := json.Unmarshal(b, &state); err != nil {
+			logrus.WithError(err).WithField("mount", d.Name()).Warn("invalid simplify shared mount state")
+			continue
+		}
+		s.states[d.Name()] = &state
+	}
+	return s, nil
+}
+
+func (s *SharedMounts) target(id string) string {
+	return filepath.Join(s.root, id, "merged")
+}
+
+func (s *SharedMounts) statePath(id string) string {
+	return filepath.Join(s.root, id, "state.json")
+}
+
+func (s *SharedMounts) save(id string, state *sharedMountState) error {
+	b, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return ioutils.AtomicWriteFile(s.statePath(id), b, 0600)
+}
+
+// Acquire returns the path of the read-only mount of lowers, topmost first,
+// held by the container, mounting it if no container holds it yet. The
+// mount is labeled with the shared form of the container's mountLabel.
+func (s *SharedMounts) Acquire(container string, lowers []string, mountLabel string) (string, error) {
+	mountLabel = SharedMountLabel(mountLabel)
+	id := SharedMountID(lowers, mountLabel)
+	target := s.target(id)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state := s.states[id]
+	if state == nil {
+		state = &sharedMountState{Lowers: lowers}
+	}
+	if len(state.Holders) == 0 {
+		if err := os.MkdirAll(target, 0700); err != nil {
+			return "", err
+		}
+		// 上次释放时可能没能卸载
+		mounted, err := s.mounted(target)
+		if err != nil {
+			return "", err
+		}
+		if !mounted {
+			if err := s.mount(lowers, mountLabel, target); err != nil {
+				return "", err
+			}
+		}
+	}
+	if !containsString(state.Holders, container) {
+		state.Holders = append(state.Holders, container)
+		sort.Strings(state.Holders)
+	}
+	if err := s.save(id, state); err != nil {
+		if len(state.Holders) == 1 {
+			s.unmount(target)
+		}
+		return "", err
+	}
+	s.states[id] = state
+	return target, nil
+}
+
+// Release drops the hold of the container on the mount it acquired, if
+// any, unmounting it if no other container holds it.
+func (s *SharedMounts) Release(container string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, state := range s.states {
+		if containsString(state.Holders, container) {
+			return s.release(id, state, func(holder string) bool { return holder == container })
+		}
+	}
+	return nil
+}
+
+// release drops the holders of the mount id that drop returns true for, and
+// unmounts it once none is left. The state of a mount that fails to
+// unmount is kept, without holders, for Reconcile to retry.
+func (s *SharedMounts) release(id string, state *sharedMountState, drop func(holder string) bool) error {
+	var holders []string
+	for _, holder := range state.Holders {
+		if !drop(holder) {
+			holders = append(holders, holder)
+		}
+	}
+	state.Holders = holders
+	if len(holders) > 0 {
+		return s.save(id, state)
+	}
+	if err := s.unmount(s.target(id)); err != nil {
+		if serr := s.save(id, state); serr != nil {
+			logrus.WithError(serr).WithField("mount", id).Warn("failed to save simplify shared mount state")
+		}
+		return err
+	}
+	delete(s.states, id)
+	return os.RemoveAll(filepath.Join(s.root, id))
+}
+
+// Holders returns the number of containers holding the mount id.
+func (s *SharedMounts) Holders(id string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if state := s.states[id]; state != nil {
+		return len(state.Holders)
+	}
+	return 0
+}
+
+// Reconcile drops the holds of the containers running returns false for,
+// as after a daemon restart, and returns the IDs of the mounts no container
+// holds anymore. The caller unmounts those left behind, then removes them.
+func (s *SharedMounts) Reconcile(running func(container string) bool) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	dirs, err := ioutil.ReadDir(s.root)
+	if err != nil {
+		return nil, err
+	}
+	var reaped []string
+	for _, d := range dirs {
+		id := d.Name()
+		if state := s.states[id]; state != nil {
+			state.Holders = filterStrings(state.Holders, running)
+			if len(state.Holders) > 0 {
+				if err := s.save(id, state); err != nil {
+					return nil, err
+				}
+				continue
+			}
+		}
+		delete(s.states, id)
+		reaped = append(reaped, id)
+	}
+	return reaped, nil
+}
+
+// Remove removes the directory of the mount id once it was unmounted.
+func (s *SharedMounts) Remove(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.states[id] != nil {
+		return nil
+	}
+	return os.RemoveAll(filepath.Join(s.root, id))
+}
+
+// mountLowers mounts lowers, at least two of them and topmost first, at
+// target, labeled with mountLabel. An overlay without an upper directory is
+// read-only.
+func mountLowers(lowers []string, mountLabel, target string) error {
+	return mount.Mount("overlay", target, "overlay", label.FormatMountLabel("ro,lowerdir="+strings.Join(lowers, ":"), mountLabel))
+}
+
+func unmountLowers(target string) error {
+	return mount.Unmount(target)
+}
+
+func mountedLowers(target string) (bool, error) {
+	return mount.Mounted(target)
+}
+
+func containsString(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func filterStrings(ss []string, keep func(string) bool) []string {
+	var kept []string
+	for _, s := range ss {
+		if keep(s) {
+			kept = append(kept, s)
+		}
+	}
+	return kept
+}
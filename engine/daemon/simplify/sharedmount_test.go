@@ -0,0 +1,133 @@
+package simplify // import "github.com/docker/docker/daemon/simplify"
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+// fakeMounts records the mounts made instead of making them.
+type fakeMounts struct {
+	mounts  map[string][]string
+	labels  map[string]string
+	mounted int
+}
+
+func (f *fakeMounts) sharedMounts(t *testing.T, root string) *SharedMounts {
+	s, err := newSharedMounts(root, func(lowers []string, mountLabel, target string) error {
+		f.mounts[target] = lowers
+		f.labels[target] = mountLabel
+		f.mounted++
+		return nil
+	}, func(target string) error {
+		delete(f.mounts, target)
+		return nil
+	}, func(target string) (bool, error) {
+		_, ok := f.mounts[target]
+		return ok, nil
+	})
+	assert.NilError(t, err)
+	return s
+}
+
+func TestSharedMounts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "simplify-mounts")
+	assert.NilError(t, err)
+	defer os.RemoveAll(dir)
+	f := &fakeMounts{mounts: make(map[string][]string), labels: make(map[string]string)}
+	s := f.sharedMounts(t, dir)
+
+	lowers := []string{"/var/lib/docker/overlay2/b/diff", "/var/lib/docker/overlay2/a/diff"}
+	id := SharedMountID(lowers, "")
+	target, err := s.Acquire("c1", lowers, "")
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(target, filepath.Join(dir, id, "merged")))
+	// the second container reuses the mount of the first
+	target2, err := s.Acquire("c2", lowers, "")
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(target2, target))
+	assert.Check(t, is.Equal(f.mounted, 1))
+	assert.Check(t, is.Equal(s.Holders(id), 2))
+
+	assert.NilError(t, s.Release("c1"))
+	assert.Check(t, is.DeepEqual(f.mounts[target], lowers))
+	assert.Check(t, is.Equal(s.Holders(id), 1))
+	// releasing twice does not drop another hold
+	assert.NilError(t, s.Release("c1"))
+	assert.Check(t, is.Equal(s.Holders(id), 1))
+
+	assert.NilError(t, s.Release("c2"))
+	assert.Check(t, is.Len(f.mounts, 0))
+	assert.Check(t, is.Equal(s.Holders(id), 0))
+	_, err = os.Stat(filepath.Join(dir, id))
+	assert.Check(t, os.IsNotExist(err))
+}
+
+func TestSharedMountsRestart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "simplify-mounts")
+	assert.NilError(t, err)
+	defer os.RemoveAll(dir)
+	f := &fakeMounts{mounts: make(map[string][]string), labels: make(map[string]string)}
+	s := f.sharedMounts(t, dir)
+
+	lowers := []string{"/var/lib/docker/overlay2/b/diff", "/var/lib/docker/overlay2/a/diff"}
+	other := []string{"/var/lib/docker/overlay2/c/diff", "/var/lib/docker/overlay2/a/diff"}
+	_, err = s.Acquire("running", lowers, "")
+	assert.NilError(t, err)
+	_, err = s.Acquire("exited", lowers, "")
+	assert.NilError(t, err)
+	_, err = s.Acquire("exited", other, "")
+	assert.NilError(t, err)
+	// a mount left without state
+	assert.NilError(t, os.MkdirAll(filepath.Join(dir, "leaked", "merged"), 0700))
+
+	// the holders are known to the next daemon
+	s = f.sharedMounts(t, dir)
+	assert.Check(t, is.Equal(s.Holders(SharedMountID(lowers, "")), 2))
+	reaped, err := s.Reconcile(func(container string) bool { return container == "running" })
+	assert.NilError(t, err)
+	expected := []string{SharedMountID(other, ""), "leaked"}
+	sort.Strings(expected)
+	assert.Check(t, is.DeepEqual(reaped, expected))
+	assert.Check(t, is.Equal(s.Holders(SharedMountID(lowers, "")), 1))
+	for _, id := range reaped {
+		assert.NilError(t, s.Remove(id))
+		_, err = os.Stat(filepath.Join(dir, id))
+		assert.Check(t, os.IsNotExist(err))
+	}
+
+	// the holds dropped are saved
+	s = f.sharedMounts(t, dir)
+	assert.Check(t, is.Equal(s.Holders(SharedMountID(lowers, "")), 1))
+	assert.Check(t, is.Equal(s.Holders(SharedMountID(other, "")), 0))
+}
+
+func TestSharedMountsLabel(t *testing.T) {
+	dir, err := ioutil.TempDir("", "simplify-mounts")
+	assert.NilError(t, err)
+	defer os.RemoveAll(dir)
+	f := &fakeMounts{mounts: make(map[string][]string), labels: make(map[string]string)}
+	s := f.sharedMounts(t, dir)
+
+	lowers := []string{"/var/lib/docker/overlay2/b/diff", "/var/lib/docker/overlay2/a/diff"}
+	target, err := s.Acquire("c1", lowers, "system_u:object_r:container_file_t:s0:c1,c2")
+	assert.NilError(t, err)
+	// containers of another level share the mount, labeled to be readable by both
+	target2, err := s.Acquire("c2", lowers, "system_u:object_r:container_file_t:s0:c3,c4")
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(target2, target))
+	assert.Check(t, is.Equal(f.mounted, 1))
+	assert.Check(t, is.Equal(f.labels[target], "system_u:object_r:container_file_t:s0"))
+	assert.Check(t, is.Equal(s.Holders(SharedMountID(lowers, "system_u:object_r:container_file_t:s0")), 2))
+
+	// an unlabeled container does not share the labeled mount
+	target3, err := s.Acquire("c3", lowers, "")
+	assert.NilError(t, err)
+	assert.Check(t, target3 != target)
+	assert.Check(t, is.Equal(f.labels[target3], ""))
+}
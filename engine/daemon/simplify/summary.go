@@ -0,0 +1,105 @@
+package simplify // import "github.com/docker/docker/daemon/simplify"
+
+import (
+	"archive/tar"
+	"context"
+	"io"
+	"path/filepath"
+	"sort"
+
+	"github.com/docker/docker/pkg/archive"
+)
+
+// Summary describes what simplification left out of the full image.
+type Summary struct {
+	// FilesKept is the number of files in the simplified image.
+	FilesKept int64
+	// FilesPruned is the number of files of the full image left out.
+	FilesPruned int64
+	// BytesSaved is the total size of the files left out.
+	BytesSaved int64
+	// FilesBelowThreshold is the number of files left out because they were
+	// opened in too few of the runs of the profile.
+	FilesBelowThreshold int64
+	// Kept lists the paths in the simplified image, sorted, if they were
+	// asked for.
+	Kept []string
+	// Pruned lists the paths left out, sorted, if they were asked for.
+	Pruned []string
+}
+
+// Summarize compares the files of a simplified image with those of the full
+// image it was derived from. Both are given as their layers, topmost first.
+// below are the paths of the profile below its threshold. The kept and
+// pruned paths are only listed if withPaths is true.
+func Summarize(ctx context.Context, simplified, full []Source, below []string, withPaths bool) (*Summary, error) {
+	s := &Summary{}
+	belowSet := make(map[string]bool)
+	for _, p := range below {
+		belowSet[filepath.Clean("/"+p)] = true
+	}
+	kept := make(map[string]bool)
+	err := scanImage(ctx, simplified, func(name string, hdr *tar.Header, _ io.Reader) error {
+		// 占位文件的内容没有保留
+		if _, ok := archive.PlaceholderSize(hdr); ok {
+			return nil
+		}
+		if hdr.Typeflag != tar.TypeDir {
+			kept[name] = true
+			s.FilesKept++
+			if withPaths {
+				s.Kept = append(s.Kept, name)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = scanImage(ctx, full, func(name string, hdr *tar.Header, _ io.Reader) error {
+		if hdr.Typeflag == tar.TypeDir || kept[name] {
+			return nil
+		}
+		s.FilesPruned++
+		if belowSet[name] {
+			s.FilesBelowThreshold++
+		}
+		if isRegular(hdr) {
+			s.BytesSaved += hdr.Size
+		}
+		if withPaths {
+			s.Pruned = append(s.Pruned, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(s.Kept)
+	sort.Strings(s.Pruned)
+	return s, nil
+}
+
+// scanImage calls fn for every entry visible in the image made of sources,
+// topmost first.
+func scanImage(ctx context.Context, sources []Source, fn func(name string, hdr *tar.Header, r io.Reader) error) error {
+	seen := make(map[string]bool)
+	hidden := make(map[string]bool)
+	for _, src := range sources {
+		rc, err := src.Open(ctx)
+		if err != nil {
+			return err
+		}
+		layerHidden, err := scanLayer(ctx, rc, seen, hidden, fn)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+		// whiteout只遮住更下面的层
+		for _, p := range layerHidden {
+			hidden[p] = true
+		}
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package simplify // import "github.com/docker/docker/daemon/simplify"
+
+import (
+	"context"
+	"testing"
+
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+func TestSummarize(t *testing.T) {
+	full := []Source{
+		// top
+		tarSource{dir("etc/"), file("etc/.wh.removed.conf"), dir("usr/"), dir("usr/bin/"), file("usr/bin/app"), file("usr/bin/tool")},
+		// bottom
+		tarSource{dir("etc/"), file("etc/app.conf"), file("etc/removed.conf"), dir("usr/"), dir("usr/lib/"), file("usr/lib/libapp.so")},
+	}
+	simplified := []Source{
+		tarSource{dir("etc/"), file("etc/app.conf"), dir("usr/"), dir("usr/bin/"), file("usr/bin/app")},
+	}
+
+	s, err := Summarize(context.Background(), simplified, full, []string{"/usr/bin/tool", "/etc/app.conf", "/etc/removed.conf"}, true)
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(s.FilesKept, int64(2)))
+	assert.Check(t, is.Equal(s.FilesPruned, int64(2)))
+	assert.Check(t, is.Equal(s.BytesSaved, int64(len("usr/bin/tool")+len("usr/lib/libapp.so"))))
+	assert.Check(t, is.Equal(s.FilesBelowThreshold, int64(1)))
+	assert.Check(t, is.DeepEqual(s.Kept, []string{"/etc/app.conf", "/usr/bin/app"}))
+	assert.Check(t, is.DeepEqual(s.Pruned, []string{"/usr/bin/tool", "/usr/lib/libapp.so"}))
+
+	s, err = Summarize(context.Background(), simplified, full, nil, false)
+	assert.NilError(t, err)
+	assert.Check(t, is.Len(s.Kept, 0))
+	assert.Check(t, is.Len(s.Pruned, 0))
+}
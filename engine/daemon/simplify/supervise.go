@@ -0,0 +1,166 @@
+package simplify // import "github.com/docker/docker/daemon/simplify"
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// superviseInterval is how often the socket of the fetch helper and the
+	// kernel parameters pointing at it are checked.
+	superviseInterval = 10 * time.Second
+	// restartBackoff is the delay before the service answering the fetch
+	// helper is set up again after failing to, doubled up to
+	// maxRestartBackoff.
+	restartBackoff    = 100 * time.Millisecond
+	maxRestartBackoff = 10 * time.Second
+)
+
+// HelperHealth is the state of the service answering the fetch helper.
+type HelperHealth struct {
+	// Healthy is false while the service is being restarted.
+	Healthy bool
+	// Restarts is the number of times the service was restarted, or
+	// recovered from a panic while answering the helper, since the daemon
+	// started.
+	Restarts int
+	// LastError is why the service was last restarted.
+	LastError string
+	// LastRestart is when it was.
+	LastRestart time.Time
+}
+
+// Health returns the state of the service answering the fetch helper.
+func (s *Server) Health() HelperHealth {
+	s.helperMu.Lock()
+	defer s.helperMu.Unlock()
+	return s.health
+}
+
+// listen sets up the listener of the fetch helper on the socket of the
+// server, points the kernel at it and starts answering the helper. It must
+// be called with helperMu held.
+func (s *Server) listen() error {
+	os.Remove(s.sock)
+	l, err := net.Listen("unix", s.sock)
+	if err != nil {
+		return fmt.Errorf("error setting up simplify fetch listener: %v", err)
+	}
+	if err := s.configure(s.sock); err != nil {
+		l.Close()
+		return err
+	}
+	s.l = l
+	s.health.Healthy = true
+	go s.serve(l)
+	return nil
+}
+
+// supervise checks the service answering the fetch helper until the server
+// is closed.
+func (s *Server) supervise() {
+	t := time.NewTicker(superviseInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-t.C:
+			s.check()
+		}
+	}
+}
+
+// check restarts the service answering the fetch helper if its socket was
+// removed, or if the kernel no longer points at it, as happens when the
+// overlay module is reloaded.
+func (s *Server) check() {
+	s.helperMu.Lock()
+	l := s.l
+	s.helperMu.Unlock()
+	if l == nil {
+		// 正在重启
+		return
+	}
+	if _, err := os.Stat(s.sock); err != nil {
+		s.restart(l, errors.Wrap(err, "fetch helper socket lost"))
+		return
+	}
+	if !s.configured(s.sock) {
+		s.restart(l, errors.New("the overlay module no longer points at the fetch helper"))
+	}
+}
+
+// restart sets the service answering the fetch helper up again in place of
+// the listener l, which failed with reason, retrying until it succeeds or
+// the server is closed. The containers attached keep their fetchers: their
+// lookups are answered again once it is set up, and those made meanwhile
+// fail with EIO. Nothing is done if l was already replaced.
+func (s *Server) restart(l net.Listener, reason error) {
+	s.helperMu.Lock()
+	if s.l != l {
+		s.helperMu.Unlock()
+		return
+	}
+	l.Close()
+	s.l = nil
+	s.failed(reason)
+	s.helperMu.Unlock()
+	logrus.WithError(reason).Warn("simplify fetch service failed, restarting it")
+
+	backoff := restartBackoff
+	for {
+		s.helperMu.Lock()
+		select {
+		case <-s.stop:
+			s.helperMu.Unlock()
+			return
+		default:
+		}
+		err := s.listen()
+		s.helperMu.Unlock()
+		if err == nil {
+			logrus.Info("simplify fetch service restarted")
+			return
+		}
+		logrus.WithError(err).Warnf("failed to restart simplify fetch service, retrying in %s", backoff)
+		select {
+		case <-s.stop:
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > maxRestartBackoff {
+			backoff = maxRestartBackoff
+		}
+	}
+}
+
+// recovered records that the service answering the fetch helper recovered
+// from reason, a panic.
+func (s *Server) recovered(reason error) {
+	s.helperMu.Lock()
+	s.failed(reason)
+	s.health.Healthy = s.l != nil
+	s.helperMu.Unlock()
+}
+
+// failed records a failure of the service answering the fetch helper for
+// reason. The size of the caches, which the failure may have left
+// inaccurate, is scanned from disk again. It must be called with helperMu
+// held.
+func (s *Server) failed(reason error) {
+	s.health.Healthy = false
+	s.health.Restarts++
+	s.health.LastError = reason.Error()
+	s.health.LastRestart = time.Now()
+	helperRestarts.Inc()
+
+	s.mu.Lock()
+	s.size = -1
+	s.mu.Unlock()
+}
@@ -0,0 +1,131 @@
+package simplify // import "github.com/docker/docker/daemon/simplify"
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+	"gotest.tools/poll"
+)
+
+// panicSource panics when its layer is read while armed is set.
+type panicSource struct {
+	tarSource
+	armed *int32
+}
+
+func (s panicSource) Open(ctx context.Context) (io.ReadCloser, error) {
+	if atomic.LoadInt32(s.armed) != 0 {
+		panic("layer read failed")
+	}
+	return s.tarSource.Open(ctx)
+}
+
+// TestServerHelperRestart kills the service answering the fetch helper in
+// the ways it can fail, and checks that the lookups of the attached
+// container are answered again each time.
+func TestServerHelperRestart(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("requires root to preserve ownership")
+	}
+	root, err := ioutil.TempDir("", "simplify-server")
+	assert.NilError(t, err)
+	defer os.RemoveAll(root)
+	run, err := ioutil.TempDir("", "simplify-run")
+	assert.NilError(t, err)
+	defer os.RemoveAll(run)
+
+	// the kernel parameters are faked: configured is reset to simulate a
+	// reload of the overlay module
+	var configured int32
+	s := newTestServer(root, nil)
+	s.sock = filepath.Join(run, "fetch.sock")
+	s.configure = func(sock string) error {
+		if sock != "" {
+			atomic.StoreInt32(&configured, 1)
+		}
+		return nil
+	}
+	s.configured = func(sock string) bool {
+		return atomic.LoadInt32(&configured) != 0
+	}
+	s.helperMu.Lock()
+	assert.NilError(t, s.listen())
+	s.helperMu.Unlock()
+	defer s.Close()
+
+	var armed int32
+	sources := []Source{panicSource{tarSource{dir("etc/"), file("etc/app.conf"), file("etc/hosts")}, &armed}}
+	_, err = s.Attach(context.Background(), "container", "image", sources, 0, 0)
+	assert.NilError(t, err)
+	lookup := func(p string) error {
+		return fetchHelper(s.sock, []string{"container/diff", p})
+	}
+	restarted := func(restarts int) func(poll.LogT) poll.Result {
+		return func(poll.LogT) poll.Result {
+			if h := s.Health(); !h.Healthy || h.Restarts != restarts {
+				return poll.Continue("health is %+v", h)
+			}
+			return poll.Success()
+		}
+	}
+	assert.NilError(t, lookup("/etc/app.conf"))
+	assert.Check(t, s.Health().Healthy)
+
+	// the listener dies
+	s.helperMu.Lock()
+	s.l.Close()
+	s.helperMu.Unlock()
+	poll.WaitOn(t, restarted(1), poll.WithDelay(10*time.Millisecond))
+	assert.NilError(t, lookup("/etc/app.conf"))
+
+	// the socket is removed
+	assert.NilError(t, os.Remove(s.sock))
+	s.check()
+	poll.WaitOn(t, restarted(2), poll.WithDelay(10*time.Millisecond))
+	assert.Check(t, is.Contains(s.Health().LastError, "fetch helper socket lost"))
+	assert.NilError(t, lookup("/etc/app.conf"))
+
+	// the kernel no longer points at the helper
+	atomic.StoreInt32(&configured, 0)
+	s.check()
+	poll.WaitOn(t, restarted(3), poll.WithDelay(10*time.Millisecond))
+	assert.Check(t, s.configured(s.sock))
+	assert.NilError(t, lookup("/etc/app.conf"))
+
+	// a fetch panics: only its lookup fails
+	atomic.StoreInt32(&armed, 1)
+	err = lookup("/etc/hosts")
+	ferr, ok := err.(fetchError)
+	assert.Assert(t, ok, "unexpected error %v", err)
+	assert.Check(t, is.Equal(ferr.errno, syscall.EIO))
+	// the kernel fails the open with the exit status of the helper
+	assert.Check(t, is.Equal(helperExitCode(err), int(syscall.EIO)))
+	h := s.Health()
+	assert.Check(t, h.Healthy)
+	assert.Check(t, is.Equal(h.Restarts, 4))
+	assert.Check(t, is.Contains(h.LastError, "panic fetching /etc/hosts"))
+	atomic.StoreInt32(&armed, 0)
+	assert.NilError(t, lookup("/etc/hosts"))
+
+	// the container kept its stats through the restarts
+	st, ok := s.Stats("container")
+	assert.Assert(t, ok)
+	assert.Check(t, is.Equal(st.Fetches, uint64(5)))
+}
+
+func TestHelperExitCode(t *testing.T) {
+	assert.Check(t, is.Equal(helperExitCode(nil), 0))
+	assert.Check(t, is.Equal(helperExitCode(fetchError{msg: "digest mismatch", errno: syscall.EIO}), int(syscall.EIO)))
+	assert.Check(t, is.Equal(helperExitCode(fetchError{msg: "not found", errno: syscall.ENOENT}), int(syscall.ENOENT)))
+	// the daemon could not be reached: the path is left missing
+	assert.Check(t, is.Equal(helperExitCode(syscall.ECONNREFUSED), int(syscall.ENOENT)))
+}
@@ -0,0 +1,95 @@
+package simplify // import "github.com/docker/docker/daemon/simplify"
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/docker/docker/layer"
+	"github.com/docker/docker/pkg/ioutils"
+	"github.com/opencontainers/go-digest"
+)
+
+// TOCRoot returns the directory the tables of contents of layers are stored
+// in.
+func TOCRoot(daemonRoot string) string {
+	return filepath.Join(daemonRoot, "simplify", "toc")
+}
+
+// TOCStore stores the tables of contents of the tar streams of layers, keyed
+// by diff ID.
+type TOCStore struct {
+	root string
+	mu   sync.Mutex
+}
+
+// NewTOCStore returns a store keeping tables of contents in root.
+func NewTOCStore(root string) *TOCStore {
+	return &TOCStore{root: root}
+}
+
+func (s *TOCStore) path(diffID layer.DiffID) string {
+	return filepath.Join(s.root, digest.Digest(diffID).Hex()+".json")
+}
+
+// Get returns the table of contents of the layer diffID. It returns an error
+// satisfying os.IsNotExist if there is none.
+func (s *TOCStore) Get(diffID layer.DiffID) (*layer.TOC, error) {
+	if err := digest.Digest(diffID).Validate(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, err := ioutil.ReadFile(s.path(diffID))
+	if err != nil {
+		return nil, err
+	}
+	var toc layer.TOC
+	if err := json.Unmarshal(b, &toc); err != nil {
+		return nil, err
+	}
+	return &toc, nil
+}
+
+// Put stores toc as the table of contents of the layer diffID.
+func (s *TOCStore) Put(diffID layer.DiffID, toc *layer.TOC) error {
+	if err := digest.Digest(diffID).Validate(); err != nil {
+		return err
+	}
+	b, err := json.Marshal(toc)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.MkdirAll(s.root, 0700); err != nil {
+		return err
+	}
+	return ioutils.AtomicWriteFile(s.path(diffID), b, 0600)
+}
+
+// Delete removes the table of contents of the layer diffID, if stored.
+func (s *TOCStore) Delete(diffID layer.DiffID) error {
+	if err := digest.Digest(diffID).Validate(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.Remove(s.path(diffID)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Has returns true if the table of contents of the layer diffID is stored.
+func (s *TOCStore) Has(diffID layer.DiffID) bool {
+	if digest.Digest(diffID).Validate() != nil {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := os.Stat(s.path(diffID))
+	return err == nil
+}
@@ -0,0 +1,34 @@
+package simplify // import "github.com/docker/docker/daemon/simplify"
+
+import (
+	"archive/tar"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/docker/docker/layer"
+	"github.com/opencontainers/go-digest"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+func TestTOCStore(t *testing.T) {
+	root, err := ioutil.TempDir("", "simplify-toc")
+	assert.NilError(t, err)
+	defer os.RemoveAll(root)
+
+	s := NewTOCStore(root)
+	diffID := layer.DiffID(digest.FromString("layer"))
+	assert.Check(t, !s.Has(diffID))
+	_, err = s.Get(diffID)
+	assert.Check(t, os.IsNotExist(err))
+
+	toc := &layer.TOC{Entries: []layer.TOCEntry{{Name: "etc/app.conf", Type: tar.TypeReg, Size: 4, Digest: digest.FromString("conf")}}, End: 1024}
+	assert.NilError(t, s.Put(diffID, toc))
+	assert.Check(t, s.Has(diffID))
+	stored, err := s.Get(diffID)
+	assert.NilError(t, err)
+	assert.Check(t, is.DeepEqual(stored, toc))
+
+	assert.Check(t, s.Put("invalid", toc) != nil)
+}
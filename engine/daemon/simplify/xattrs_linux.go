@@ -0,0 +1,75 @@
+package simplify // import "github.com/docker/docker/daemon/simplify"
+
+import (
+	"bytes"
+	"os"
+	"strings"
+
+	"github.com/docker/docker/pkg/archive"
+	"github.com/docker/docker/pkg/system"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+// setXattrs sets the extended attributes xattrs on path, but for its SELinux
+// label. Attributes the filesystem of the cache does not support are
+// skipped with a warning, as pkg/archive does when applying a layer.
+func setXattrs(path string, xattrs map[string]string) error {
+	var unsupported []string
+	for key, value := range xattrs {
+		if key == selinuxXattr {
+			continue
+		}
+		if err := system.Lsetxattr(path, key, []byte(value), 0); err != nil {
+			if err == unix.ENOTSUP {
+				unsupported = append(unsupported, key)
+				continue
+			}
+			return &os.PathError{Op: "setxattr " + key, Path: path, Err: err}
+		}
+	}
+	if len(unsupported) > 0 {
+		logrus.WithField("path", path).WithField("xattrs", unsupported).Warn("ignored xattrs of simplify fetch: the cache filesystem does not support them")
+	}
+	return nil
+}
+
+// listXattrs returns the extended attributes of path, but for its SELinux
+// label and those of overlayfs, or nil if it has none.
+func listXattrs(path string) (map[string]string, error) {
+	size, err := unix.Llistxattr(path, nil)
+	if err != nil || size == 0 {
+		if err == unix.ENOTSUP {
+			err = nil
+		}
+		return nil, err
+	}
+	buf := make([]byte, size)
+	if size, err = unix.Llistxattr(path, buf); err != nil {
+		return nil, err
+	}
+	var xattrs map[string]string
+	for _, key := range bytes.Split(buf[:size], []byte{0}) {
+		k := string(key)
+		if k == "" || k == selinuxXattr || strings.HasPrefix(k, "trusted.overlay.") {
+			continue
+		}
+		value, err := system.Lgetxattr(path, k)
+		if err != nil {
+			return nil, &os.PathError{Op: "getxattr " + k, Path: path, Err: err}
+		}
+		if xattrs == nil {
+			xattrs = make(map[string]string)
+		}
+		xattrs[k] = string(value)
+	}
+	return xattrs, nil
+}
+
+// isPlaceholder returns true if path is the placeholder of a file pruned
+// from a simplified image. Reading the attribute does not open the file, so
+// it does not fetch it.
+func isPlaceholder(path string) bool {
+	value, err := system.Lgetxattr(path, archive.PlaceholderXattr)
+	return err == nil && value != nil
+}
@@ -0,0 +1,21 @@
+// +build !linux
+
+package simplify // import "github.com/docker/docker/daemon/simplify"
+
+// setXattrs is a no-op on this platform: extended attributes are not
+// supported.
+func setXattrs(path string, xattrs map[string]string) error {
+	return nil
+}
+
+// listXattrs returns nil on this platform: extended attributes are not
+// supported.
+func listXattrs(path string) (map[string]string, error) {
+	return nil, nil
+}
+
+// isPlaceholder returns false on this platform: extended attributes are not
+// supported.
+func isPlaceholder(path string) bool {
+	return false
+}
@@ -0,0 +1,151 @@
+package daemon // import "github.com/docker/docker/daemon"
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types/backend"
+	containertypes "github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/container"
+	"github.com/docker/docker/daemon/config"
+	"github.com/docker/docker/daemon/images"
+	"github.com/docker/docker/errdefs"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+func TestReattachSimplifyFetchDegraded(t *testing.T) {
+	db, err := container.NewViewDB()
+	assert.NilError(t, err)
+	d := &Daemon{containersReplica: db}
+
+	root, err := ioutil.TempDir("", "simplify-reattach")
+	assert.NilError(t, err)
+	defer os.RemoveAll(root)
+	c := container.NewBaseContainer("abc", root)
+	c.Config = &containertypes.Config{}
+	c.HostConfig = &containertypes.HostConfig{}
+	d.reattachSimplifyFetch(c)
+	assert.Check(t, is.Equal(c.State.SimplifyDegraded, ""))
+
+	// the daemon restarted without on-demand fetching
+	c.SimplifyFetch = true
+	d.reattachSimplifyFetch(c)
+	assert.Check(t, is.Equal(c.State.SimplifyDegraded, "files missing from the simplified rootfs cannot be fetched: on-demand fetching is no longer available"))
+	// the degraded state is saved
+	saved := container.NewBaseContainer("abc", root)
+	assert.NilError(t, saved.FromDisk())
+	assert.Check(t, is.Equal(saved.State.SimplifyDegraded, c.State.SimplifyDegraded))
+
+	d.cleanupSimplify(c)
+	assert.Check(t, !c.SimplifyFetch)
+	assert.Check(t, is.Equal(c.State.SimplifyDegraded, ""))
+}
+
+func TestSetSimplifyFetchError(t *testing.T) {
+	db, err := container.NewViewDB()
+	assert.NilError(t, err)
+	d := &Daemon{containersReplica: db}
+
+	root, err := ioutil.TempDir("", "simplify-fetch-error")
+	assert.NilError(t, err)
+	defer os.RemoveAll(root)
+	c := container.NewBaseContainer("abc", root)
+	c.Config = &containertypes.Config{}
+	c.HostConfig = &containertypes.HostConfig{}
+
+	d.setSimplifyFetchError(c, "failed to fetch /bin/sh: giving up after 5 attempts")
+	saved := container.NewBaseContainer("abc", root)
+	assert.NilError(t, saved.FromDisk())
+	assert.Check(t, is.Equal(saved.State.SimplifyFetchError, "failed to fetch /bin/sh: giving up after 5 attempts"))
+
+	// the error is kept once the container exits
+	d.cleanupSimplify(c)
+	assert.Check(t, is.Equal(c.State.SimplifyFetchError, "failed to fetch /bin/sh: giving up after 5 attempts"))
+}
+
+func TestSimplifyOffline(t *testing.T) {
+	d := &Daemon{configStore: &config.Config{}}
+	assert.Check(t, !d.simplifyOffline(backend.ContainerStartSimplifyConfig{}))
+	d.configStore.SimplifyOffline = true
+	assert.Check(t, d.simplifyOffline(backend.ContainerStartSimplifyConfig{}))
+	online := false
+	assert.Check(t, !d.simplifyOffline(backend.ContainerStartSimplifyConfig{SimplifyOffline: &online}))
+
+	err := simplifyMissingError{missing: []string{"/etc/app.conf", "/usr/lib/libssl.so"}, total: 2}
+	assert.Check(t, errdefs.IsConflict(err))
+	assert.Check(t, is.Error(err, "cannot start offline: 2 files kept by the simplify profile are missing from the image: /etc/app.conf, /usr/lib/libssl.so"))
+	err.total = 12
+	assert.Check(t, is.Error(err, "cannot start offline: 12 files kept by the simplify profile are missing from the image: /etc/app.conf, /usr/lib/libssl.so and 10 more"))
+}
+
+func TestSimplifyImagePolicy(t *testing.T) {
+	policy := map[string]string{
+		"registry.example.com:5000": "on",
+		"docker.io/myorg":           "on",
+		"docker.io/myorg/legacy":    "off",
+		"nginx":                     "on",
+		"docker.io/library/nginx":   "off",
+	}
+	for _, tc := range []struct {
+		ref      string
+		simplify bool
+	}{
+		{ref: "registry.example.com:5000/team/app:1.0", simplify: true},
+		{ref: "registry.example.com/team/app"},
+		{ref: "myorg/app@sha256:" + strings.Repeat("a", 64), simplify: true},
+		{ref: "myorg/legacy:latest"},
+		{ref: "myorg/legacy-app", simplify: true},
+		{ref: "docker.io/myorganization/app"},
+		// "off" wins between patterns naming the same images
+		{ref: "nginx:alpine"},
+		{ref: "alpine"},
+		{ref: "Invalid Reference"},
+	} {
+		assert.Check(t, is.Equal(simplifyImagePolicy(policy, tc.ref), tc.simplify), tc.ref)
+	}
+	assert.Check(t, !simplifyImagePolicy(nil, "nginx"))
+}
+
+func TestPrunedPathStat(t *testing.T) {
+	dir, err := ioutil.TempDir("", "simplify-pruned-stat")
+	assert.NilError(t, err)
+	defer os.RemoveAll(dir)
+	assert.NilError(t, os.MkdirAll(filepath.Join(dir, "usr/share/doc"), 0755))
+	assert.NilError(t, os.Symlink("../licenses/COPYING", filepath.Join(dir, "usr/share/doc/COPYING")))
+
+	sp := &images.SimplifiedPath{Path: "/usr/share/doc/COPYING", Dir: dir, Missing: []string{"/usr/share/doc/COPYING"}}
+	stat, err := prunedPathStat(sp, "/usr/share/doc/COPYING")
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(stat.Name, "COPYING"))
+	assert.Check(t, stat.Mode&os.ModeSymlink != 0)
+	// the link is resolved as it reads, its target may be pruned too
+	assert.Check(t, is.Equal(stat.LinkTarget, "/usr/share/licenses/COPYING"))
+
+	d := &Daemon{configStore: &config.Config{SimplifyOffline: true}}
+	err = d.prunedPathError("/usr/share/doc")
+	assert.Check(t, errdefs.IsNotFound(err))
+	e := err.(simplifyPrunedError)
+	e.file, e.container = "/usr/share/doc", "slim"
+	assert.Check(t, is.Error(e, "Could not find the file /usr/share/doc in container slim: it was pruned from the simplified image and cannot be fetched: the daemon is offline"))
+}
+
+func TestUserByName(t *testing.T) {
+	for user, expected := range map[string]bool{
+		"":          false,
+		"1000":      false,
+		"1000:1000": false,
+		"app":       true,
+		"1000:app":  true,
+		"app:1000":  true,
+	} {
+		assert.Check(t, is.Equal(userByName(user), expected), user)
+	}
+
+	err := simplifyExecError{cmd: "bash", image: "slim", missing: []string{"/bin/bash", "/lib/libtinfo.so.6"}, reason: "the container was started offline"}
+	assert.Check(t, errdefs.IsNotFound(err))
+	assert.Check(t, is.Error(err, "exec: \"bash\": /bin/bash, /lib/libtinfo.so.6 pruned from the simplified image and cannot be fetched: the container was started offline; fetch them ahead of time with `docker image prefetch --paths /bin/bash,/lib/libtinfo.so.6 slim`"))
+}
@@ -3,12 +3,14 @@ package daemon // import "github.com/docker/docker/daemon"
 import (
 	"context"
 	"runtime"
-	"strings"
 	"time"
 
 	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/backend"
 	containertypes "github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/container"
+	"github.com/docker/docker/daemon/graphdriver"
+	"github.com/docker/docker/daemon/simplify"
 	"github.com/docker/docker/errdefs"
 	"github.com/docker/docker/pkg/mount"
 	"github.com/pkg/errors"
@@ -16,8 +18,8 @@ import (
 )
 
 // ContainerStart starts a container.
-// 修改： 添加simpString参数
-func (daemon *Daemon) ContainerStart(name string, hostConfig *containertypes.HostConfig, checkpoint string, checkpointDir string, simpString string) error {
+// 修改： 添加simpCfg参数
+func (daemon *Daemon) ContainerStart(name string, hostConfig *containertypes.HostConfig, checkpoint string, checkpointDir string, simpCfg backend.ContainerStartSimplifyConfig) error {
 	// 修改
 	if checkpoint != "" && !daemon.HasExperimental() {
 		return errdefs.InvalidParameter(errors.New("checkpoint is only supported in experimental mode"))
@@ -81,6 +83,11 @@ func (daemon *Daemon) ContainerStart(name string, hostConfig *containertypes.Hos
 		if hostConfig != nil {
 			return errdefs.InvalidParameter(errors.New("Supplying a hostconfig on start is not supported. It should be supplied on create"))
 		}
+		// 修改： Windows不支持精简镜像，在进入graphdriver前拒绝
+		if simplifyRequested(container, simpCfg) {
+			return errdefs.NotImplemented(simplify.ErrWindowsNotSupported)
+		}
+		// 修改
 	}
 
 	// check if hostConfig is in line with the current system settings.
@@ -95,15 +102,15 @@ func (daemon *Daemon) ContainerStart(name string, hostConfig *containertypes.Hos
 			return errdefs.InvalidParameter(err)
 		}
 	}
-	return daemon.containerStart(container, checkpoint, checkpointDir, true, simpString)
+	return daemon.containerStart(container, checkpoint, checkpointDir, true, simpCfg)
 }
 
 // containerStart prepares the container to run by setting up everything the
 // container needs, such as storage and networking, as well as links
 // between containers. The container is left waiting for a signal to
 // begin running.
-// 修改： 添加simpString参数
-func (daemon *Daemon) containerStart(container *container.Container, checkpoint string, checkpointDir string, resetRestartManager bool, simpString string) (err error) {
+// 修改： 添加simpCfg参数
+func (daemon *Daemon) containerStart(container *container.Container, checkpoint string, checkpointDir string, resetRestartManager bool, simpCfg backend.ContainerStartSimplifyConfig) (err error) {
 	// 修改
 	start := time.Now()
 	container.Lock()
@@ -117,6 +124,22 @@ func (daemon *Daemon) containerStart(container *container.Container, checkpoint
 		return errdefs.Conflict(errors.New("container is marked for removal and cannot be started"))
 	}
 
+	// 修改： 恢复的进程可能持有精简后rootfs中已删除文件的描述符，拒绝在精简模式下恢复检查点
+	simp := simplifyOnStart(container, simpCfg)
+	if simp && checkpoint != "" {
+		return errdefs.Conflict(errors.New("cannot restore a checkpoint in simplified mode: files the checkpointed process held open may have been pruned"))
+	}
+	// 首次启动且没有请求精简模式的容器，如kubelet创建的容器，按daemon的策略决定
+	byPolicy := !simp && simpCfg.SimplifyImage == nil && simpCfg.SimplifyAudit == "" && checkpoint == "" && container.State.StartedAt.IsZero() && daemon.simplifyByPolicy(container)
+	if byPolicy {
+		simp = true
+	}
+	// 审计profile需要完整的rootfs
+	if simp && simpCfg.SimplifyAudit != "" {
+		return errdefs.InvalidParameter(errors.New("conflicting options: a container auditing a simplify profile runs its full image and cannot start in simplified mode"))
+	}
+	// 修改
+
 	if checkpointDir != "" {
 		// TODO(mlaventure): how would we support that?
 		return errdefs.Forbidden(errors.New("custom checkpointdir is not supported"))
@@ -148,22 +171,78 @@ func (daemon *Daemon) containerStart(container *container.Container, checkpoint
 		}
 	}()
 
-	// 修改： 记录原container.MountLabel标志，并在后续还原
-	simp := false
-	if strings.Compare(simpString, "yes") == 0 {
-		simp = true
+	// 修改： 检查精简模式启动的条件
+	if simp {
+		if err := daemon.checkSimplifyOnStart(container); err != nil {
+			return err
+		}
+	}
+	container.SimplifyImage = simp
+	if simpCfg.SimplifyFetchTimeout != nil {
+		container.SimplifyFetchTimeout = *simpCfg.SimplifyFetchTimeout
+	}
+	if simpCfg.SimplifyMaxConcurrentFetches != nil {
+		container.SimplifyMaxConcurrentFetches = *simpCfg.SimplifyMaxConcurrentFetches
 	}
-	tmp := container.MountLabel
 	// 修改
 
-	// 修改： 添加simp参数
-	if err := daemon.conditionalMountOnStart(container, simp); err != nil {
+	// 修改： 精简镜像中缺失的文件按需从完整镜像拉取，离线模式下不拉取
+	offline := daemon.simplifyOffline(simpCfg)
+	var fetchDir string
+	if !offline {
+		if fetchDir, err = daemon.attachSimplifyFetch(container); err != nil {
+			return err
+		}
+	}
+	// 记录下来，使live-restore后的daemon能重新提供按需拉取
+	container.SimplifyFetch = fetchDir != ""
+	container.State.SimplifyDegraded = ""
+	container.State.SimplifyFetchError = ""
+	// 修改
+
+	// 修改： 添加simp参数，精简容器的镜像层使用共享的只读挂载
+	simpOpts := graphdriver.SimplifyOptions{Record: simp, FetchDir: fetchDir}
+	if !simpOpts.IsZero() {
+		simpOpts.Lower = daemon.acquireSimplifyLower(container)
+	}
+	if err := daemon.conditionalMountOnStart(container, simpOpts); err != nil {
 		// 修改
 		return err
 	}
 
-	// 修改： 消除对container.MountLabel的修改
-	container.MountLabel = tmp
+	// 修改： 离线启动时profile保留的文件必须都在rootfs中，不能等到运行时才找不到
+	if offline {
+		if err := daemon.checkSimplifyOffline(container); err != nil {
+			return err
+		}
+	}
+	// 修改
+
+	// 修改： 以克隆方式挂载精简镜像的驱动，拉取的文件插入rootfs，精简模式下记录打开的文件
+	if daemon.simplifiesByClone(container) {
+		if err := daemon.insertSimplifyFetches(container); err != nil {
+			return err
+		}
+		if simp {
+			daemon.startSimplifyOpened(container)
+		}
+	}
+	// 修改
+
+	// 修改： 在容器进程启动前开始记录访问的文件
+	if simpCfg.SimplifyRecord {
+		if err := daemon.startSimplifyRecord(container); err != nil {
+			return err
+		}
+	}
+	// 修改
+
+	// 修改： 在容器进程启动前开始审计profile
+	if simpCfg.SimplifyAudit != "" {
+		if err := daemon.startSimplifyAudit(container, simpCfg.SimplifyAudit); err != nil {
+			return err
+		}
+	}
 	// 修改
 
 	if err := daemon.initializeNetworking(container); err != nil {
@@ -217,6 +296,12 @@ func (daemon *Daemon) containerStart(container *container.Container, checkpoint
 	container.HasBeenStartedBefore = true
 	daemon.setStateCounter(container)
 
+	// 修改： 在后台预取精简镜像的剩余内容
+	if fetchDir != "" {
+		daemon.prefetchSimplified(container)
+	}
+	// 修改
+
 	daemon.initHealthMonitor(container)
 
 	if err := container.CheckpointTo(daemon.containersReplica); err != nil {
@@ -226,6 +311,17 @@ func (daemon *Daemon) containerStart(container *container.Container, checkpoint
 
 	daemon.LogContainerEvent(container, "start")
 	containerActions.WithValues("start").UpdateSince(start)
+	// 修改： 统计以精简模式启动的容器
+	if simp {
+		containerActions.WithValues("start_simplified").UpdateSince(start)
+	}
+	if byPolicy {
+		simplifyPolicyStarts.Inc()
+	}
+	if simpCfg.SimplifyAudit != "" {
+		simplifyAudits.Inc()
+	}
+	// 修改
 
 	return nil
 }
@@ -239,6 +335,15 @@ func (daemon *Daemon) Cleanup(container *container.Container) {
 		logrus.Warnf("%s cleanup: failed to unmount IPC: %s", container.ID, err)
 	}
 
+	// 修改： 停止记录访问的文件并保存记录
+	daemon.stopSimplifyRecord(container)
+	daemon.stopSimplifyOpened(container)
+	// 修改
+
+	// 修改： 停止审计profile，结果在计算完成后通过事件报告
+	daemon.stopSimplifyAudit(container)
+	// 修改
+
 	if err := daemon.conditionalUnmountOnCleanup(container); err != nil {
 		// FIXME: remove once reference counting for graphdrivers has been refactored
 		// Ensure that all the mounts are gone
@@ -247,6 +352,10 @@ func (daemon *Daemon) Cleanup(container *container.Container) {
 		}
 	}
 
+	// 修改： 释放精简模式启动时创建的共享挂载和按需拉取的缓存
+	daemon.cleanupSimplify(container)
+	// 修改
+
 	if err := container.UnmountSecrets(); err != nil {
 		logrus.Warnf("%s cleanup: failed to unmount secrets: %s", container.ID, err)
 	}
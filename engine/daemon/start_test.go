@@ -0,0 +1,37 @@
+package daemon // import "github.com/docker/docker/daemon"
+
+import (
+	"testing"
+
+	"github.com/docker/docker/api/types/backend"
+	"github.com/docker/docker/container"
+	"github.com/docker/docker/errdefs"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+func TestContainerStartCheckpointSimplified(t *testing.T) {
+	yes, no := true, false
+	d := &Daemon{}
+	for _, tc := range []struct {
+		name     string
+		recorded bool
+		simp     *bool
+		conflict bool
+	}{
+		{name: "requested", simp: &yes, conflict: true},
+		{name: "recorded", recorded: true, conflict: true},
+		{name: "overridden", recorded: true, simp: &no},
+	} {
+		c := container.NewBaseContainer("abc", "/var/lib/docker/containers/abc")
+		c.SimplifyImage = tc.recorded
+		// a custom checkpoint dir is only rejected once the simplified mode is checked
+		err := d.containerStart(c, "checkpoint", "/tmp/checkpoints", true, backend.ContainerStartSimplifyConfig{SimplifyImage: tc.simp})
+		if !tc.conflict {
+			assert.Check(t, errdefs.IsForbidden(err), tc.name)
+			continue
+		}
+		assert.Check(t, errdefs.IsConflict(err), tc.name)
+		assert.Check(t, is.ErrorContains(err, "cannot restore a checkpoint in simplified mode"), tc.name)
+	}
+}
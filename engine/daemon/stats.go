@@ -144,6 +144,10 @@ func (daemon *Daemon) GetContainerStats(container *container.Container) (*types.
 		return nil, err
 	}
 
+	// 修改： 精简模式下按需拉取的文件
+	stats.SimplifyStats = daemon.simplifyStats(container)
+	// 修改
+
 	// We already have the network stats on Windows directly from HCS.
 	if !container.Config.NetworkDisabled && runtime.GOOS != "windows" {
 		if stats.Networks, err = daemon.getNetworkStats(container); err != nil {
@@ -62,6 +62,18 @@ type ImagePullConfig struct {
 	Schema2Types []string
 	// Platform is the requested platform of the image being pulled
 	Platform *specs.Platform
+	// 修改： 记录拉取的精简镜像
+	// SimplifyAnnotations, if set, is called with the simplify annotations
+	// of the manifest of every image pulled that has some.
+	SimplifyAnnotations func(id digest.Digest, annotations map[string]string) error
+	// Simplify, if set, pulls only the files of images with seekable layers
+	// the image would keep once simplified.
+	Simplify *PullSimplify
+	// SimplifyVariants, if set, returns whether the images a and b are the
+	// full image and a simplified image pulled from it, so that a pull by
+	// digest of one moves the digest reference from the other.
+	SimplifyVariants func(a, b digest.Digest) bool
+	// 修改
 }
 
 // ImagePushConfig stores push configuration.
@@ -78,6 +90,16 @@ type ImagePushConfig struct {
 	TrustKey libtrust.PrivateKey
 	// UploadManager dispatches uploads.
 	UploadManager *xfer.LayerUploadManager
+	// 修改： 推送精简镜像
+	// Simplified, if set, returns what to push along with the image id, or
+	// nil if it is not a simplified image.
+	Simplified func(id digest.Digest) (*SimplifyPush, error)
+	// PushSimplifyProfile pushes the profile of simplified images as a blob.
+	PushSimplifyProfile bool
+	// PushSimplifyTOC pushes seekable layers, along with their tables of
+	// contents, so that their files can be pulled on their own.
+	PushSimplifyTOC bool
+	// 修改
 }
 
 // ImageConfigStore handles storing and getting image configurations
@@ -0,0 +1,575 @@
+package distribution // import "github.com/docker/docker/distribution"
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/docker/distribution/metadata"
+	"github.com/docker/docker/layer"
+	"github.com/docker/docker/pkg/ioutils"
+	"github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
+)
+
+// 修改： 兼容eStargz格式的可按文件下载的层
+
+const (
+	// estargzFooterSize is the size of the footer of eStargz layer blobs,
+	// and legacyStargzFooterSize the size of the footer of stargz ones.
+	estargzFooterSize      = 51
+	legacyStargzFooterSize = 47
+	// estargzTOCName is the name of the tar entry holding the table of
+	// contents of an eStargz layer.
+	estargzTOCName = "stargz.index.json"
+	// estargzTOCDigestAnnotation is the annotation of the descriptors of
+	// eStargz layers in the manifest recording the digest of the JSON of
+	// their table of contents.
+	estargzTOCDigestAnnotation = "containerd.io/snapshot/stargz/toc.digest"
+	// estargzMaxTOCSize bounds the size of the table of contents read.
+	estargzMaxTOCSize = 64 << 20
+	// estargzNamespace is the namespace of the metadata store the tables of
+	// contents of eStargz layer blobs are cached in.
+	estargzNamespace = "simplify-estargz"
+)
+
+// errNotEStargz is returned for layer blobs without an eStargz footer.
+var errNotEStargz = errors.New("not an eStargz layer")
+
+// estargzTOC is the table of contents of an eStargz layer blob, as found in
+// its stargz.index.json entry.
+type estargzTOC struct {
+	Version int             `json:"version"`
+	Entries []*estargzEntry `json:"entries"`
+
+	// tocOffset is where the table of contents starts in the blob.
+	tocOffset int64
+}
+
+// estargzEntry is an entry of the table of contents of an eStargz layer. The
+// content of large regular files is split across chunk entries following
+// them, each compressed as a gzip member of its own starting at Offset.
+type estargzEntry struct {
+	Name        string            `json:"name"`
+	Type        string            `json:"type"`
+	Size        int64             `json:"size,omitempty"`
+	ModTime3339 string            `json:"modtime,omitempty"`
+	LinkName    string            `json:"linkName,omitempty"`
+	Mode        int64             `json:"mode,omitempty"`
+	UID         int               `json:"uid,omitempty"`
+	GID         int               `json:"gid,omitempty"`
+	Uname       string            `json:"userName,omitempty"`
+	Gname       string            `json:"groupName,omitempty"`
+	Offset      int64             `json:"offset,omitempty"`
+	DevMajor    int               `json:"devMajor,omitempty"`
+	DevMinor    int               `json:"devMinor,omitempty"`
+	Xattrs      map[string][]byte `json:"xattrs,omitempty"`
+	Digest      string            `json:"digest,omitempty"`
+	ChunkOffset int64             `json:"chunkOffset,omitempty"`
+	ChunkSize   int64             `json:"chunkSize,omitempty"`
+	ChunkDigest string            `json:"chunkDigest,omitempty"`
+}
+
+var estargzTypes = map[string]byte{
+	"dir":      tar.TypeDir,
+	"reg":      tar.TypeReg,
+	"symlink":  tar.TypeSymlink,
+	"hardlink": tar.TypeLink,
+	"char":     tar.TypeChar,
+	"block":    tar.TypeBlock,
+	"fifo":     tar.TypeFifo,
+}
+
+// parseEStargzFooter returns the offset of the table of contents recorded in
+// the footer of an eStargz or a legacy stargz blob, p being the last
+// estargzFooterSize bytes of the blob.
+func parseEStargzFooter(p []byte) (int64, error) {
+	if len(p) != estargzFooterSize {
+		return 0, errNotEStargz
+	}
+	// eStargz的footer在gzip头的扩展字段中带有"SG"子字段
+	if extra, err := gzipExtra(p); err == nil && len(extra) == 4+22 && string(extra[:2]) == "SG" && binary.LittleEndian.Uint16(extra[2:4]) == 22 {
+		return parseStargzOffset(extra[4:])
+	}
+	if extra, err := gzipExtra(p[estargzFooterSize-legacyStargzFooterSize:]); err == nil && len(extra) == 22 {
+		return parseStargzOffset(extra)
+	}
+	return 0, errNotEStargz
+}
+
+func gzipExtra(p []byte) ([]byte, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(p))
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+	return gz.Header.Extra, nil
+}
+
+func parseStargzOffset(field []byte) (int64, error) {
+	if string(field[16:]) != "STARGZ" {
+		return 0, errNotEStargz
+	}
+	offset, err := strconv.ParseInt(string(field[:16]), 16, 64)
+	if err != nil || offset < 0 {
+		return 0, errNotEStargz
+	}
+	return offset, nil
+}
+
+// estargzTOCDigests returns the digests of the tables of contents of the
+// layers of m recorded in their estargzTOCDigestAnnotation annotation, with
+// "" for layers without one.
+func estargzTOCDigests(m *schema2.DeserializedManifest) []digest.Digest {
+	_, payload, err := m.Payload()
+	if err != nil {
+		return nil
+	}
+	var annotated struct {
+		Layers []struct {
+			Annotations map[string]string `json:"annotations,omitempty"`
+		} `json:"layers"`
+	}
+	if err := json.Unmarshal(payload, &annotated); err != nil {
+		return nil
+	}
+	var digests []digest.Digest
+	for _, l := range annotated.Layers {
+		digests = append(digests, digest.Digest(l.Annotations[estargzTOCDigestAnnotation]))
+	}
+	return digests
+}
+
+// readEStargzTOC reads the table of contents of the layer blob r of size
+// bytes and verifies its JSON against tocDigest, the digest recorded for it in
+// the manifest. It returns errNotEStargz if the blob is not in the eStargz
+// format.
+func readEStargzTOC(r io.ReadSeeker, size int64, tocDigest digest.Digest) (*estargzTOC, error) {
+	if size < estargzFooterSize {
+		return nil, errNotEStargz
+	}
+	if _, err := r.Seek(size-estargzFooterSize, io.SeekStart); err != nil {
+		return nil, err
+	}
+	footer := make([]byte, estargzFooterSize)
+	if _, err := io.ReadFull(r, footer); err != nil {
+		return nil, err
+	}
+	tocOffset, err := parseEStargzFooter(footer)
+	if err != nil {
+		return nil, err
+	}
+	if tocOffset >= size-legacyStargzFooterSize {
+		return nil, errors.Errorf("invalid eStargz table of contents offset %d", tocOffset)
+	}
+
+	if _, err := r.Seek(tocOffset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	gz, err := gzip.NewReader(io.LimitReader(r, size-tocOffset))
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+	hdr, err := tr.Next()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read eStargz table of contents")
+	}
+	if hdr.Name != estargzTOCName {
+		return nil, errors.Errorf("unexpected entry %s instead of the eStargz table of contents", hdr.Name)
+	}
+	// 目录中的文件摘要来自镜像仓库，必须先用manifest中记录的摘要校验目录
+	b, err := ioutil.ReadAll(io.LimitReader(tr, estargzMaxTOCSize))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read eStargz table of contents")
+	}
+	if digest.FromBytes(b) != tocDigest {
+		return nil, errors.Errorf("eStargz table of contents verification failed for digest %s", tocDigest)
+	}
+	var toc estargzTOC
+	if err := json.Unmarshal(b, &toc); err != nil {
+		return nil, errors.Wrap(err, "invalid eStargz table of contents")
+	}
+	toc.tocOffset = tocOffset
+	return &toc, nil
+}
+
+// tarName returns the name of the entry in the tar stream of the layer.
+func (e *estargzEntry) tarName() string {
+	name := strings.TrimPrefix(e.Name, "./")
+	if e.Type == "dir" && !strings.HasSuffix(name, "/") {
+		name += "/"
+	}
+	return name
+}
+
+// header returns the tar header of the entry.
+func (e *estargzEntry) header() *tar.Header {
+	hdr := &tar.Header{
+		Name:     e.tarName(),
+		Typeflag: estargzTypes[e.Type],
+		Linkname: e.LinkName,
+		Mode:     e.Mode,
+		Uid:      e.UID,
+		Gid:      e.GID,
+		Uname:    e.Uname,
+		Gname:    e.Gname,
+		Devmajor: int64(e.DevMajor),
+		Devminor: int64(e.DevMinor),
+	}
+	if e.Type == "reg" {
+		hdr.Size = e.Size
+	}
+	if t, err := time.Parse(time.RFC3339, e.ModTime3339); err == nil {
+		hdr.ModTime = t
+	}
+	for k, v := range e.Xattrs {
+		if hdr.PAXRecords == nil {
+			hdr.PAXRecords = make(map[string]string)
+		}
+		hdr.PAXRecords["SCHILY.xattr."+k] = string(v)
+	}
+	return hdr
+}
+
+// files returns the entries of the layer, leaving out the chunks of the
+// content of regular files.
+func (toc *estargzTOC) files() []*estargzEntry {
+	var files []*estargzEntry
+	for _, e := range toc.Entries {
+		if _, ok := estargzTypes[e.Type]; ok {
+			files = append(files, e)
+		}
+	}
+	return files
+}
+
+// layerTOC returns the table of contents of the uncompressed tar stream of
+// the layer. The offsets of its entries in the tar stream are not known.
+func (toc *estargzTOC) layerTOC() *layer.TOC {
+	lt := &layer.TOC{End: -1}
+	for _, e := range toc.files() {
+		te := layer.TOCEntry{Name: e.tarName(), Type: estargzTypes[e.Type], Offset: -1, Mode: e.Mode, UID: e.UID, GID: e.GID}
+		switch e.Type {
+		case "reg":
+			te.Size = e.Size
+			te.Digest = digest.Digest(e.Digest)
+			if te.Digest == "" && e.Size == 0 {
+				te.Digest = digest.Canonical.FromBytes(nil)
+			}
+		case "symlink", "hardlink":
+			te.Linkname = e.LinkName
+		case "char", "block":
+			te.Devmajor, te.Devminor = int64(e.DevMajor), int64(e.DevMinor)
+		}
+		if t, err := time.Parse(time.RFC3339, e.ModTime3339); err == nil {
+			te.ModTime = t
+		}
+		for k, v := range e.Xattrs {
+			if te.Xattrs == nil {
+				te.Xattrs = make(map[string]string)
+			}
+			te.Xattrs[k] = string(v)
+		}
+		lt.Entries = append(lt.Entries, te)
+	}
+	return lt
+}
+
+// contentEnd returns where the compressed content of the regular file e
+// ends in the blob: at the start of the next gzip member that is not one of
+// its chunks.
+func (toc *estargzTOC) contentEnd(e *estargzEntry) int64 {
+	end := toc.tocOffset
+	for _, o := range toc.Entries {
+		if o.Offset > e.Offset && o.Offset < end && o.Name != e.Name {
+			end = o.Offset
+		}
+	}
+	return end
+}
+
+// estargzPartial selects the files of an eStargz layer blob downloaded by a
+// partial pull.
+type estargzPartial struct {
+	toc      *estargzTOC
+	selected map[*estargzEntry]bool
+}
+
+// newEStargzPartial selects the files in keep, which are absolute paths,
+// along with the same entries as selectEntries does for seekable layers.
+func newEStargzPartial(toc *estargzTOC, keep map[string]struct{}) *estargzPartial {
+	ep := &estargzPartial{toc: toc, selected: make(map[*estargzEntry]bool)}
+	regular := make(map[string]*estargzEntry)
+	files := toc.files()
+	for _, e := range files {
+		name := path.Clean("/" + e.Name)
+		switch e.Type {
+		case "reg":
+			regular[name] = e
+			_, kept := keep[name]
+			ep.selected[e] = kept || e.Size == 0 || strings.HasPrefix(path.Base(name), ".wh.")
+		case "hardlink":
+		default:
+			ep.selected[e] = true
+		}
+	}
+	// 硬链接需要其目标文件
+	for _, e := range files {
+		if e.Type != "hardlink" {
+			continue
+		}
+		if _, kept := keep[path.Clean("/"+e.Name)]; !kept {
+			continue
+		}
+		if target := regular[path.Clean("/"+e.LinkName)]; target != nil {
+			ep.selected[e] = true
+			ep.selected[target] = true
+		}
+	}
+	return ep
+}
+
+func (ep *estargzPartial) layerTOC() *layer.TOC {
+	return ep.toc.layerTOC()
+}
+
+func (ep *estargzPartial) size() int64 {
+	var size int64
+	for e, selected := range ep.selected {
+		if selected && e.Type == "reg" && e.Size > 0 {
+			size += ep.toc.contentEnd(e) - e.Offset
+		}
+	}
+	return size
+}
+
+func (ep *estargzPartial) files(full bool) (selected, total int) {
+	for _, e := range ep.toc.files() {
+		if e.Type == "reg" && e.Size > 0 {
+			total++
+			if full || ep.selected[e] {
+				selected++
+			}
+		}
+	}
+	return selected, total
+}
+
+// fetch writes a tar stream made of the entries selected to w, reading the
+// content of regular files from their gzip members in the eStargz blob r, or
+// from ranges if they were downloaded before. Small gaps between them are
+// read through rather than sought over. It returns the number of bytes read
+// from r.
+func (ep *estargzPartial) fetch(ctx context.Context, w io.Writer, r io.ReadSeeker, ranges *blobRanges) (int64, error) {
+	var (
+		pos     int64 = -1
+		fetched int64
+	)
+	tw := tar.NewWriter(w)
+	for _, e := range ep.toc.files() {
+		if !ep.selected[e] {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return fetched, err
+		}
+		hdr := e.header()
+		if err := tw.WriteHeader(hdr); err != nil {
+			return fetched, err
+		}
+		if hdr.Size == 0 {
+			continue
+		}
+
+		// 之前下载并校验过的内容不再下载
+		if stored := ranges.open(e.Offset, func(r io.Reader) error {
+			return extractEStargzContent(ioutil.Discard, r, e)
+		}); stored != nil {
+			err := extractEStargzContent(tw, stored, e)
+			stored.Close()
+			if err != nil {
+				return fetched, err
+			}
+			continue
+		}
+
+		if gap := e.Offset - pos; pos < 0 || gap < 0 || gap > tocMaxGap {
+			if _, err := r.Seek(e.Offset, io.SeekStart); err != nil {
+				return fetched, err
+			}
+		} else if gap > 0 {
+			m, err := io.CopyN(ioutil.Discard, r, gap)
+			fetched += m
+			if err != nil {
+				return fetched, err
+			}
+		}
+		cr := &countingReader{r: r}
+		src, recorder := ranges.record(cr, e.Offset)
+		err := extractEStargzContent(tw, src, e)
+		recorder.done(err == nil)
+		fetched += cr.n
+		pos = e.Offset + cr.n
+		if err != nil {
+			return fetched, err
+		}
+	}
+	return fetched, tw.Close()
+}
+
+// extractEStargzContent writes the content of the regular file e to w,
+// decompressing it from r, which starts with its gzip members, and verifies
+// it.
+func extractEStargzContent(w io.Writer, r io.Reader, e *estargzEntry) error {
+	// 内容可能分成多个gzip成员，依次解压即可
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	verifier := digest.Digest(e.Digest).Verifier()
+	if _, err := io.CopyN(w, io.TeeReader(gz, verifier), e.Size); err != nil {
+		return err
+	}
+	if !verifier.Verified() {
+		return errors.Errorf("verification failed for %s in the layer", e.Name)
+	}
+	return nil
+}
+
+// estargzEntryStream returns a tar stream holding the regular file e only,
+// reading its content from r, the eStargz blob from the offset of e.
+func estargzEntryStream(r io.Reader, e *estargzEntry) io.ReadCloser {
+	hdr := e.header()
+	pr, pw := io.Pipe()
+	go func() {
+		tw := tar.NewWriter(pw)
+		err := tw.WriteHeader(hdr)
+		if err == nil && hdr.Size > 0 {
+			var gz *gzip.Reader
+			if gz, err = gzip.NewReader(r); err == nil {
+				_, err = io.CopyN(tw, gz, hdr.Size)
+			}
+		}
+		if err == nil {
+			err = tw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+	return pr
+}
+
+// estargzStore caches the tables of contents of eStargz layer blobs in the
+// distribution metadata store, by blob digest.
+type estargzStore struct {
+	store metadata.Store
+}
+
+func (s estargzStore) get(dgst digest.Digest) (*estargzTOC, error) {
+	b, err := s.store.Get(estargzNamespace, dgst.Hex())
+	if err != nil {
+		return nil, err
+	}
+	var toc estargzTOC
+	if err := json.Unmarshal(b, &toc); err != nil {
+		return nil, err
+	}
+	return &toc, nil
+}
+
+func (s estargzStore) set(dgst digest.Digest, toc *estargzTOC) error {
+	b, err := json.Marshal(toc)
+	if err != nil {
+		return err
+	}
+	return s.store.Set(estargzNamespace, dgst.Hex(), b)
+}
+
+// SeekableEntry locates an entry of a layer in its seekable or eStargz layer
+// blob.
+type SeekableEntry struct {
+	// Offset and Size locate the part of the blob the entry is read from.
+	Offset, Size int64
+
+	open func(r io.Reader) (io.ReadCloser, error)
+}
+
+// Open returns the tar stream of the layer from the start of the entry,
+// reading r, the blob from Offset. Only Size bytes of r are needed.
+func (se *SeekableEntry) Open(r io.Reader) (io.ReadCloser, error) {
+	return se.open(r)
+}
+
+// LocateSeekableEntry returns where the n-th entry e of the table of
+// contents of the layer is in the layer blob dgst, or nil if the blob is
+// neither seekable nor in the eStargz format.
+func LocateSeekableEntry(store metadata.Store, dgst digest.Digest, n int, e *layer.TOCEntry) *SeekableEntry {
+	// 优先使用eStargz自带的目录
+	if toc, err := (estargzStore{store: store}).get(dgst); err == nil {
+		for _, ee := range toc.files() {
+			if ee.tarName() != e.Name || ee.Type == "hardlink" {
+				continue
+			}
+			ee := ee
+			se := &SeekableEntry{Offset: ee.Offset, open: func(r io.Reader) (io.ReadCloser, error) {
+				return estargzEntryStream(r, ee), nil
+			}}
+			if ee.Type == "reg" && ee.Size > 0 {
+				se.Size = toc.contentEnd(ee) - ee.Offset
+			}
+			return se
+		}
+		return nil
+	}
+
+	toc := seekableTOC(store, dgst)
+	if toc == nil || n >= len(toc.Entries) || toc.Entries[n].Name != e.Name || toc.Entries[n].Offset != e.Offset {
+		return nil
+	}
+	// 每个条目都是单独的gzip成员，可以从任一成员开始解压
+	return &SeekableEntry{Offset: toc.Members[n].Offset, Size: toc.Members[n].Size, open: func(r io.Reader) (io.ReadCloser, error) {
+		return gzip.NewReader(r)
+	}}
+}
+
+// OpenSeekableEntry returns the tar stream of the layer blob dgst from the
+// start of the n-th entry e of the table of contents of the layer, reading
+// only the part of the blob holding it. ok is false, and the blob is not
+// opened, if the blob is neither seekable nor in the eStargz format.
+func OpenSeekableEntry(store metadata.Store, dgst digest.Digest, n int, e *layer.TOCEntry, open func() (distribution.ReadSeekCloser, error)) (rc io.ReadCloser, ok bool, err error) {
+	se := LocateSeekableEntry(store, dgst, n, e)
+	if se == nil {
+		return nil, false, nil
+	}
+	blob, err := open()
+	if err != nil {
+		return nil, true, err
+	}
+	if _, err := blob.Seek(se.Offset, io.SeekStart); err != nil {
+		blob.Close()
+		return nil, true, err
+	}
+	entry, err := se.Open(blob)
+	if err != nil {
+		blob.Close()
+		return nil, true, err
+	}
+	return ioutils.NewReadCloserWrapper(entry, func() error {
+		entry.Close()
+		return blob.Close()
+	}), true, nil
+}
+
+// 修改
@@ -0,0 +1,405 @@
+package distribution // import "github.com/docker/docker/distribution"
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/docker/distribution/metadata"
+	"github.com/docker/docker/pkg/progress"
+	"github.com/opencontainers/go-digest"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+type testEntry struct {
+	hdr     tar.Header
+	content string
+}
+
+// testEStargzBlob lays out entries the way ctr-remote optimizes layers: the
+// header of every entry is compressed along with what precedes it, and the
+// content of regular files is split into chunks of chunkSize bytes, each
+// starting a gzip member of its own. The table of contents is compressed
+// last, followed by the footer pointing to it. The digest of the table of
+// contents is returned along with the blob.
+func testEStargzBlob(t *testing.T, entries []testEntry, chunkSize int64, legacy bool) ([]byte, digest.Digest) {
+	var (
+		blob bytes.Buffer
+		gz   *gzip.Writer
+		toc  estargzTOC
+	)
+	openGz := func() {
+		if gz == nil {
+			gz = gzip.NewWriter(&blob)
+		}
+	}
+	closeGz := func() {
+		if gz != nil {
+			assert.NilError(t, gz.Close())
+			gz = nil
+		}
+	}
+	tw := tar.NewWriter(writerFunc(func(p []byte) (int, error) {
+		openGz()
+		return gz.Write(p)
+	}))
+
+	types := map[byte]string{tar.TypeDir: "dir", tar.TypeReg: "reg", tar.TypeSymlink: "symlink", tar.TypeLink: "hardlink"}
+	for _, e := range entries {
+		e.hdr.Size = int64(len(e.content))
+		assert.NilError(t, tw.WriteHeader(&e.hdr))
+		ent := &estargzEntry{
+			Name:        strings.TrimPrefix(path.Clean("/"+e.hdr.Name), "/"),
+			Type:        types[e.hdr.Typeflag],
+			Mode:        e.hdr.Mode,
+			ModTime3339: e.hdr.ModTime.UTC().Format(time.RFC3339),
+			LinkName:    e.hdr.Linkname,
+		}
+		if ent.Type != "reg" {
+			toc.Entries = append(toc.Entries, ent)
+			assert.NilError(t, tw.Flush())
+			continue
+		}
+		ent.Size = e.hdr.Size
+		ent.Digest = digest.FromString(e.content).String()
+		if ent.Size == 0 {
+			toc.Entries = append(toc.Entries, ent)
+		}
+		for size, written := ent.Size, int64(0); written < size; {
+			closeGz()
+			n := chunkSize
+			if remain := size - written; remain < n {
+				n = remain
+			} else {
+				ent.ChunkSize = n
+			}
+			ent.Offset = int64(blob.Len())
+			ent.ChunkOffset = written
+			chunk := e.content[written : written+n]
+			ent.ChunkDigest = digest.FromString(chunk).String()
+			_, err := tw.Write([]byte(chunk))
+			assert.NilError(t, err)
+			toc.Entries = append(toc.Entries, ent)
+			written += n
+			ent = &estargzEntry{Name: ent.Name, Type: "chunk"}
+		}
+		assert.NilError(t, tw.Flush())
+	}
+	closeGz()
+
+	tocOffset := blob.Len()
+	b, err := json.Marshal(&toc)
+	assert.NilError(t, err)
+	gz = gzip.NewWriter(&blob)
+	tw = tar.NewWriter(gz)
+	assert.NilError(t, tw.WriteHeader(&tar.Header{Name: estargzTOCName, Typeflag: tar.TypeReg, Mode: 0444, Size: int64(len(b))}))
+	_, err = tw.Write(b)
+	assert.NilError(t, err)
+	assert.NilError(t, tw.Close())
+	closeGz()
+
+	blob.Write(testEStargzFooter(int64(tocOffset), legacy))
+	return blob.Bytes(), digest.FromBytes(b)
+}
+
+// testEStargzFooter returns the footer pointing to the table of contents at
+// offset: an empty gzip member, with an empty stored block, whose header
+// records the offset in its extra field.
+func testEStargzFooter(offset int64, legacy bool) []byte {
+	extra := []byte(fmt.Sprintf("%016xSTARGZ", offset))
+	if !legacy {
+		extra = append([]byte{'S', 'G', byte(len(extra)), 0}, extra...)
+	}
+	footer := []byte{0x1f, 0x8b, 8, 4, 0, 0, 0, 0, 0, 0xff, 0, 0}
+	binary.LittleEndian.PutUint16(footer[10:12], uint16(len(extra)))
+	footer = append(footer, extra...)
+	footer = append(footer, 1, 0, 0, 0xff, 0xff)
+	return append(footer, make([]byte, 8)...)
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
+
+func testEStargzEntries() []testEntry {
+	// large enough not to be read through when skipped
+	ls := make([]byte, 2*tocMaxGap)
+	rand.New(rand.NewSource(1)).Read(ls)
+	return []testEntry{
+		{hdr: tar.Header{Name: "bin/", Typeflag: tar.TypeDir, Mode: 0755}},
+		{hdr: tar.Header{Name: "bin/sh", Typeflag: tar.TypeReg, Mode: 0755}, content: strings.Repeat("sh", 3000)},
+		{hdr: tar.Header{Name: "bin/dash", Typeflag: tar.TypeLink, Linkname: "bin/sh"}},
+		{hdr: tar.Header{Name: "bin/ls", Typeflag: tar.TypeReg, Mode: 0755}, content: string(ls)},
+		{hdr: tar.Header{Name: "etc/", Typeflag: tar.TypeDir, Mode: 0755}},
+		{hdr: tar.Header{Name: "etc/.wh.old", Typeflag: tar.TypeReg, Mode: 0644}},
+		{hdr: tar.Header{Name: "etc/app.conf", Typeflag: tar.TypeReg, Mode: 0644}, content: "debug = true\n"},
+		{hdr: tar.Header{Name: ".prefetch.landmark", Typeflag: tar.TypeReg, Mode: 0644}, content: "\xf1"},
+	}
+}
+
+func TestParseEStargzFooter(t *testing.T) {
+	// footers as written by ctr-remote, pointing to a table of contents at 0x1234
+	header := "1f8b08040000000000ff"
+	tail := "010000ffff0000000000000000"
+	for _, tc := range []struct {
+		name   string
+		legacy bool
+		footer string
+	}{
+		{name: "estargz", footer: header + "1a00" + "53471600" + hex.EncodeToString([]byte("0000000000001234STARGZ")) + tail},
+		{name: "legacy", legacy: true, footer: header + "1600" + hex.EncodeToString([]byte("0000000000001234STARGZ")) + tail},
+	} {
+		footer, err := hex.DecodeString(tc.footer)
+		assert.NilError(t, err)
+		assert.Check(t, bytes.Equal(testEStargzFooter(0x1234, tc.legacy), footer), tc.name)
+		p := make([]byte, estargzFooterSize-len(footer), estargzFooterSize)
+		offset, err := parseEStargzFooter(append(p, footer...))
+		assert.NilError(t, err, tc.name)
+		assert.Check(t, is.Equal(offset, int64(0x1234)), tc.name)
+	}
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, err := gz.Write(testLayerTar(t))
+	assert.NilError(t, err)
+	assert.NilError(t, gz.Close())
+	_, err = parseEStargzFooter(buf.Bytes()[buf.Len()-estargzFooterSize:])
+	assert.Check(t, is.Equal(err, errNotEStargz))
+}
+
+func TestReadEStargzTOC(t *testing.T) {
+	for _, legacy := range []bool{false, true} {
+		blob, tocDigest := testEStargzBlob(t, testEStargzEntries(), 1024, legacy)
+		toc, err := readEStargzTOC(bytes.NewReader(blob), int64(len(blob)), tocDigest)
+		assert.NilError(t, err)
+
+		var names []string
+		for _, e := range toc.layerTOC().Entries {
+			names = append(names, e.Name)
+			assert.Check(t, is.Equal(e.Offset, int64(-1)))
+		}
+		assert.Check(t, is.DeepEqual(names, []string{"bin/", "bin/sh", "bin/dash", "bin/ls", "etc/", "etc/.wh.old", "etc/app.conf", ".prefetch.landmark"}))
+		// bin/sh and bin/ls are split across chunks
+		assert.Check(t, is.Len(toc.Entries, 8+5+127))
+
+		_, err = readEStargzTOC(bytes.NewReader(blob), int64(len(blob)), digest.FromString("other"))
+		assert.Check(t, is.ErrorContains(err, "verification failed"))
+		_, err = readEStargzTOC(bytes.NewReader(blob), int64(len(blob)), "")
+		assert.Check(t, is.ErrorContains(err, "verification failed"))
+	}
+
+	layerTar := testLayerTar(t)
+	_, err := readEStargzTOC(bytes.NewReader(layerTar), int64(len(layerTar)), "")
+	assert.Check(t, is.Equal(err, errNotEStargz))
+}
+
+// estargzRepo serves layer blobs by digest.
+type estargzRepo struct {
+	distribution.Repository
+	blobs map[digest.Digest][]byte
+}
+
+func (r estargzRepo) Blobs(ctx context.Context) distribution.BlobStore {
+	return estargzBlobs{blobs: r.blobs}
+}
+
+type estargzBlobs struct {
+	distribution.BlobStore
+	blobs map[digest.Digest][]byte
+}
+
+func (b estargzBlobs) Get(ctx context.Context, dgst digest.Digest) ([]byte, error) {
+	if blob, ok := b.blobs[dgst]; ok {
+		return blob, nil
+	}
+	return nil, distribution.ErrBlobUnknown
+}
+
+func (b estargzBlobs) Open(ctx context.Context, dgst digest.Digest) (distribution.ReadSeekCloser, error) {
+	if blob, ok := b.blobs[dgst]; ok {
+		return readSeekNopCloser{bytes.NewReader(blob)}, nil
+	}
+	return nil, distribution.ErrBlobUnknown
+}
+
+// testEStargzManifest returns the manifest of an image made of the layer
+// blob, with tocDigest recorded in the annotations of the layer unless it is
+// empty.
+func testEStargzManifest(t *testing.T, blob []byte, tocDigest digest.Digest) *schema2.DeserializedManifest {
+	return testEStargzImageManifest(t, blob, tocDigest, []byte("app"))
+}
+
+// testEStargzImageManifest is testEStargzManifest for the image whose
+// configuration is config.
+func testEStargzImageManifest(t *testing.T, blob []byte, tocDigest digest.Digest, config []byte) *schema2.DeserializedManifest {
+	type annotatedLayer struct {
+		distribution.Descriptor
+		Annotations map[string]string `json:"annotations,omitempty"`
+	}
+	l := annotatedLayer{Descriptor: distribution.Descriptor{MediaType: schema2.MediaTypeLayer, Digest: digest.FromBytes(blob), Size: int64(len(blob))}}
+	if tocDigest != "" {
+		l.Annotations = map[string]string{estargzTOCDigestAnnotation: tocDigest.String()}
+	}
+	b, err := json.Marshal(struct {
+		SchemaVersion int                     `json:"schemaVersion"`
+		MediaType     string                  `json:"mediaType"`
+		Config        distribution.Descriptor `json:"config"`
+		Layers        []annotatedLayer        `json:"layers"`
+	}{
+		SchemaVersion: schema2.SchemaVersion.SchemaVersion,
+		MediaType:     schema2.MediaTypeManifest,
+		Config:        distribution.Descriptor{MediaType: schema2.MediaTypeImageConfig, Digest: digest.FromBytes(config), Size: int64(len(config))},
+		Layers:        []annotatedLayer{l},
+	})
+	assert.NilError(t, err)
+	var mfst schema2.DeserializedManifest
+	assert.NilError(t, mfst.UnmarshalJSON(b))
+	return &mfst
+}
+
+func TestPullEStargzTOCsVerifiesDigest(t *testing.T) {
+	blob, tocDigest := testEStargzBlob(t, testEStargzEntries(), 1024, false)
+	dgst := digest.FromBytes(blob)
+
+	for _, tc := range []struct {
+		name      string
+		tocDigest digest.Digest
+		partial   bool
+		messages  []string
+	}{
+		{name: "verified", tocDigest: tocDigest, partial: true},
+		{name: "unannotated"},
+		{
+			name:      "tampered",
+			tocDigest: digest.FromString("other"),
+			messages:  []string{"Warning: cannot read the eStargz table of contents of layer " + dgst.String() + ", pulling all the files of the image: eStargz table of contents verification failed for digest " + digest.FromString("other").String()},
+		},
+	} {
+		root, err := ioutil.TempDir("", "estargz")
+		assert.NilError(t, err)
+		defer os.RemoveAll(root)
+		store, err := metadata.NewFSMetadataStore(root)
+		assert.NilError(t, err)
+
+		progressChan := make(chan progress.Progress, 10)
+		p := &v2Puller{
+			repo: estargzRepo{blobs: map[digest.Digest][]byte{dgst: blob}},
+			config: &ImagePullConfig{
+				Config:   Config{ProgressOutput: progress.ChanOutput(progressChan), MetadataStore: store},
+				Simplify: &PullSimplify{},
+			},
+		}
+		layers, _, err := p.pullEStargzTOCs(context.Background(), testEStargzManifest(t, blob, tc.tocDigest), []string{"/bin/sh"})
+		assert.NilError(t, err, tc.name)
+		assert.Check(t, is.Equal(layers != nil, tc.partial), tc.name)
+		close(progressChan)
+		var messages []string
+		for p := range progressChan {
+			messages = append(messages, p.Message)
+		}
+		assert.Check(t, is.DeepEqual(messages, tc.messages), tc.name)
+		// only tables of contents verified are used to fetch files later on
+		_, err = estargzStore{store: store}.get(dgst)
+		assert.Check(t, is.Equal(err == nil, tc.partial), tc.name)
+	}
+}
+
+func TestEStargzPartialFetch(t *testing.T) {
+	blob, tocDigest := testEStargzBlob(t, testEStargzEntries(), 1024, false)
+	toc, err := readEStargzTOC(bytes.NewReader(blob), int64(len(blob)), tocDigest)
+	assert.NilError(t, err)
+
+	ep := newEStargzPartial(toc, map[string]struct{}{"/bin/dash": {}, "/etc/app.conf": {}})
+	var out bytes.Buffer
+	fetched, err := ep.fetch(context.Background(), &out, bytes.NewReader(blob), nil)
+	assert.NilError(t, err)
+	assert.Check(t, fetched < toc.tocOffset-tocMaxGap)
+	assert.Check(t, fetched >= ep.size())
+	assert.Check(t, is.DeepEqual(tarNames(t, out.Bytes()), []string{"bin/", "bin/sh", "bin/dash", "etc/", "etc/.wh.old", "etc/app.conf"}))
+	selected, total := ep.files(false)
+	assert.Check(t, is.Equal(selected, 2))
+	assert.Check(t, is.Equal(total, 4))
+
+	tr := tar.NewReader(&out)
+	for {
+		hdr, err := tr.Next()
+		assert.NilError(t, err)
+		if hdr.Name == "bin/sh" {
+			b, err := ioutil.ReadAll(tr)
+			assert.NilError(t, err)
+			assert.Check(t, is.Equal(string(b), strings.Repeat("sh", 3000)))
+			assert.Check(t, is.Equal(hdr.Mode, int64(0755)))
+			break
+		}
+	}
+
+	toc.files()[1].Digest = digest.FromString("other").String()
+	_, err = ep.fetch(context.Background(), ioutil.Discard, bytes.NewReader(blob), nil)
+	assert.Check(t, is.ErrorContains(err, "verification failed for bin/sh"))
+}
+
+type readSeekNopCloser struct {
+	*bytes.Reader
+}
+
+func (readSeekNopCloser) Close() error {
+	return nil
+}
+
+func TestOpenSeekableEntry(t *testing.T) {
+	root, err := ioutil.TempDir("", "estargz")
+	assert.NilError(t, err)
+	defer os.RemoveAll(root)
+	store, err := metadata.NewFSMetadataStore(root)
+	assert.NilError(t, err)
+
+	blob, tocDigest := testEStargzBlob(t, testEStargzEntries(), 1024, false)
+	toc, err := readEStargzTOC(bytes.NewReader(blob), int64(len(blob)), tocDigest)
+	assert.NilError(t, err)
+	dgst := digest.FromBytes(blob)
+	assert.NilError(t, estargzStore{store: store}.set(dgst, toc))
+
+	open := func() (distribution.ReadSeekCloser, error) {
+		return readSeekNopCloser{bytes.NewReader(blob)}, nil
+	}
+	lt := toc.layerTOC()
+	n := lt.Index("/bin/sh")
+	rc, ok, err := OpenSeekableEntry(store, dgst, n, &lt.Entries[n], open)
+	assert.NilError(t, err)
+	assert.Assert(t, ok)
+	defer rc.Close()
+	tr := tar.NewReader(rc)
+	hdr, err := tr.Next()
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(hdr.Name, "bin/sh"))
+	verifier := lt.Entries[n].Digest.Verifier()
+	_, err = io.Copy(verifier, tr)
+	assert.NilError(t, err)
+	assert.Check(t, verifier.Verified())
+
+	// blobs not known to be seekable are not opened
+	_, ok, err = OpenSeekableEntry(store, digest.FromString("other"), n, &lt.Entries[n], func() (distribution.ReadSeekCloser, error) {
+		t.Fatal("blob opened")
+		return nil, nil
+	})
+	assert.NilError(t, err)
+	assert.Check(t, !ok)
+}
@@ -62,6 +62,10 @@ type v2Puller struct {
 	// confirmedV2 is set to true if we confirm we're talking to a v2
 	// registry. This is used to limit fallbacks to the v1 protocol.
 	confirmedV2 bool
+	// 修改： 精简拉取时，层相同的镜像共用保留的文件，并记录各镜像节省的大小
+	simplifyKeeps map[digest.Digest]*simplifyKept
+	simplified    map[digest.Digest]simplifySavings
+	// 修改
 }
 
 func (p *v2Puller) Pull(ctx context.Context, ref reference.Named, platform *specs.Platform) (err error) {
@@ -107,6 +111,9 @@ func (p *v2Puller) pullV2Repository(ctx context.Context, ref reference.Named, pl
 		// error later on.
 		p.confirmedV2 = true
 
+		// 修改： 记录拉取的标签，报告各标签精简节省的大小
+		var tagRefs []reference.NamedTagged
+		// 修改
 		for _, tag := range tags {
 			tagRef, err := reference.WithTag(ref, tag)
 			if err != nil {
@@ -125,9 +132,23 @@ func (p *v2Puller) pullV2Repository(ctx context.Context, ref reference.Named, pl
 			// pulledNew is true if either new layers were downloaded OR if existing images were newly tagged
 			// TODO(tiborvass): should we change the name of `layersDownload`? What about message in WriteStatus?
 			layersDownloaded = layersDownloaded || pulledNew
+			// 修改
+			tagRefs = append(tagRefs, tagRef)
+			// 修改
 		}
+		// 修改
+		if p.config.Simplify != nil {
+			p.reportSimplified(tagRefs)
+		}
+		// 修改
 	}
 
+	// 修改： 精简拉取的状态标明是否精简了镜像
+	if p.config.Simplify != nil {
+		writeSimplifyStatus(reference.FamiliarString(ref), p.config.ProgressOutput, layersDownloaded, len(p.simplified) > 0)
+		return nil
+	}
+	// 修改
 	writeStatus(reference.FamiliarString(ref), p.config.ProgressOutput, layersDownloaded)
 
 	return nil
@@ -423,6 +444,13 @@ func (p *v2Puller) pullV2Tag(ctx context.Context, ref reference.Named, platform
 		}
 
 		if canonical, ok := ref.(reference.Canonical); ok {
+			// 修改： digest引用不能覆盖，按digest拉取另一个变体时指向最后拉取的变体
+			if err == nil && p.config.SimplifyVariants != nil && p.config.SimplifyVariants(oldTagID, id) {
+				if _, err = p.config.ReferenceStore.Delete(canonical); err != nil {
+					return false, err
+				}
+			}
+			// 修改
 			if err = p.config.ReferenceStore.AddDigest(canonical, id, true); err != nil {
 				return false, err
 			}
@@ -553,13 +581,41 @@ func (p *v2Puller) pullSchema2(ctx context.Context, ref reference.Named, mfst *s
 	if err != nil {
 		return "", "", err
 	}
+	// 修改： 记录拉取的精简镜像
+	defer func() {
+		if err == nil {
+			err = p.recordSimplified(id, mfst)
+		}
+	}()
+	// 修改
 
 	target := mfst.Target()
+	// 修改： 精简拉取时，下载前先确认有无profile
+	if p.config.Simplify != nil {
+		if _, _, err := p.simplifyKeep(ctx, mfst, platform); err != nil {
+			return "", "", err
+		}
+	}
+	// 修改
+	// 修改： 精简拉取时，完整镜像的层已在本地则直接从本地内容精简
+	if p.config.Simplify != nil && p.config.DownloadManager != nil {
+		if id, ok, err := p.simplifyLocal(ctx, mfst, platform); err != nil || ok {
+			return id, manifestDigest, err
+		}
+	}
+	// 修改
 	if _, err := p.config.ImageStore.Get(target.Digest); err == nil {
 		// If the image already exists locally, no need to pull
 		// anything.
 		return target.Digest, manifestDigest, nil
 	}
+	// 修改： 精简拉取时只下载需要的文件
+	if p.config.Simplify != nil && p.config.DownloadManager != nil {
+		if id, ok, err := p.pullSchema2Partial(ctx, mfst, platform); err != nil || ok {
+			return id, manifestDigest, err
+		}
+	}
+	// 修改
 
 	var descriptors []xfer.DownloadDescriptor
 
@@ -720,6 +776,26 @@ func (p *v2Puller) pullSchema2(ctx context.Context, ref reference.Named, mfst *s
 	return imageID, manifestDigest, nil
 }
 
+// 修改： 记录拉取的精简镜像
+
+// recordSimplified passes the simplify annotations of mfst, the manifest of
+// the image id, to the daemon, and warns if files are missing from the image.
+func (p *v2Puller) recordSimplified(id digest.Digest, mfst *schema2.DeserializedManifest) error {
+	annotations := simplifyAnnotations(mfst)
+	if annotations == nil {
+		return nil
+	}
+	if annotations[AnnotationSimplified] == "true" {
+		progress.Message(p.config.ProgressOutput, "", "Warning: this is a simplified image, files of its full image "+annotations[AnnotationSimplifyFullImage]+" are missing from it")
+	}
+	if p.config.SimplifyAnnotations == nil {
+		return nil
+	}
+	return p.config.SimplifyAnnotations(id, annotations)
+}
+
+// 修改
+
 func receiveConfig(s ImageConfigStore, configChan <-chan []byte, errChan <-chan error) ([]byte, *image.RootFS, *specs.Platform, error) {
 	select {
 	case configJSON := <-configChan:
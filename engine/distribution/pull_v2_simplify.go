@@ -0,0 +1,622 @@
+package distribution // import "github.com/docker/docker/distribution"
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/client/transport"
+	"github.com/docker/docker/distribution/metadata"
+	"github.com/docker/docker/distribution/xfer"
+	"github.com/docker/docker/errdefs"
+	"github.com/docker/docker/image"
+	"github.com/docker/docker/layer"
+	"github.com/docker/docker/pkg/ioutils"
+	"github.com/docker/docker/pkg/progress"
+	"github.com/docker/go-units"
+	"github.com/opencontainers/go-digest"
+	specs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// 修改： 精简拉取时只下载需要的文件
+
+// pullSchema2Partial pulls the files of the image of mfst it keeps once
+// simplified, using range requests on its seekable or eStargz layers. It
+// returns false if the image has to be pulled in full: when its layers are
+// not seekable, or when there is no profile to select the files kept with.
+func (p *v2Puller) pullSchema2Partial(ctx context.Context, mfst *schema2.DeserializedManifest, platform *specs.Platform) (digest.Digest, bool, error) {
+	if runtime.GOOS == "windows" {
+		return "", false, nil
+	}
+	annotations := simplifyAnnotations(mfst)
+	target := mfst.Target()
+
+	keep, profile, err := p.simplifyKeep(ctx, mfst, platform)
+	if err != nil || keep == nil {
+		return "", false, err
+	}
+
+	// eStargz层自带目录，优先使用
+	layers, followed, err := p.pullEStargzTOCs(ctx, mfst, keep)
+	if err != nil {
+		return "", false, err
+	}
+	if layers == nil && annotations[AnnotationSimplifyTOC] != "" {
+		if layers, followed, err = p.pullSeekableTOCs(ctx, mfst, digest.Digest(annotations[AnnotationSimplifyTOC]), keep); err != nil {
+			return "", false, err
+		}
+	}
+	if layers == nil {
+		return "", false, nil
+	}
+
+	configJSON, err := p.pullSchema2Config(ctx, target.Digest)
+	if err != nil {
+		return "", false, ImageConfigPullError{Err: err}
+	}
+	configRootFS, err := p.config.ImageStore.RootFSFromConfig(configJSON)
+	if err == nil && configRootFS == nil {
+		err = errRootFSInvalid
+	}
+	if err != nil {
+		return "", false, err
+	}
+	if len(configRootFS.DiffIDs) != len(mfst.Layers) {
+		return "", false, errRootFSMismatch
+	}
+	layerStoreOS := runtime.GOOS
+	if platform != nil {
+		layerStoreOS = platform.OS
+	}
+
+	selection := selectionDigest(followed)
+	var (
+		descriptors []xfer.DownloadDescriptor
+		partial     []*v2PartialLayerDescriptor
+		layerTOCs   []*layer.TOC
+	)
+	for n, d := range mfst.Layers {
+		layerTOCs = append(layerTOCs, layers[n].layerTOC())
+		ld := &v2PartialLayerDescriptor{
+			v2LayerDescriptor: &v2LayerDescriptor{
+				digest:            d.Digest,
+				repo:              p.repo,
+				repoInfo:          p.repoInfo,
+				V2MetadataService: p.V2MetadataService,
+				src:               d,
+			},
+			layer:     layers[n],
+			selection: selection,
+			ranges:    newBlobRanges(p.config.Simplify.RangeRoot, d.Digest),
+		}
+		descriptors = append(descriptors, ld)
+		partial = append(partial, ld)
+	}
+
+	rootFS, release, err := p.config.DownloadManager.Download(ctx, *image.NewRootFS(), layerStoreOS, descriptors, p.config.ProgressOutput)
+	if err != nil {
+		return "", false, err
+	}
+	defer release()
+
+	id, err := p.putSimplified(configJSON, rootFS, mfst, configRootFS.DiffIDs, layerTOCs, profile)
+	if err != nil {
+		return "", false, err
+	}
+
+	var (
+		total, fetched  int64
+		selected, files int
+	)
+	for n, ld := range partial {
+		total += mfst.Layers[n].Size
+		fetched += ld.fetched
+		s, f := ld.layer.files(ld.full)
+		selected += s
+		files += f
+	}
+	progress.Messagef(p.config.ProgressOutput, "", "Pulled %d of %d files: downloaded %s of %s, saved %s",
+		selected, files, units.HumanSize(float64(fetched)), units.HumanSize(float64(total)), units.HumanSize(float64(total-fetched)))
+	p.recordSavings(id, simplifySavings{selected: selected, files: files, saved: total - fetched})
+	return id, true, nil
+}
+
+// simplifyKept holds the files kept of the images with the same layers, and
+// the profile they were selected with if it was pulled.
+type simplifyKept struct {
+	keep    []string
+	profile []byte
+}
+
+// simplifySavings is what simplifying an image saved.
+type simplifySavings struct {
+	selected, files int
+	saved           int64
+}
+
+// simplifyKeep returns the files of the image of mfst kept once simplified,
+// or nil if there is no profile to select them with, along with the profile
+// pushed along with the image if it had to be pulled. Images with the same
+// layers hold the same files: the files kept are selected once for all of
+// them, as when pulling the tags of a repository. Images without a profile
+// for the platform pulled are pulled in full, or fail to pull if
+// PullSimplify.Required is set.
+func (p *v2Puller) simplifyKeep(ctx context.Context, mfst *schema2.DeserializedManifest, platform *specs.Platform) ([]string, []byte, error) {
+	key := layersDigest(mfst)
+	if kept, ok := p.simplifyKeeps[key]; ok {
+		return kept.keep, kept.profile, nil
+	}
+	pulled, err := p.simplifyPlatform(ctx, mfst, platform)
+	if err != nil {
+		return nil, nil, err
+	}
+	keep, profile, err := p.selectKeep(ctx, mfst, pulled)
+	perr, mismatch := err.(ProfilePlatformError)
+	if err != nil && !mismatch {
+		return nil, nil, err
+	}
+	if keep == nil {
+		switch {
+		case p.config.Simplify.Required && mismatch:
+			return nil, nil, errors.Errorf("no simplification profile found for image %s: %v", mfst.Target().Digest, perr)
+		case p.config.Simplify.Required:
+			return nil, nil, errors.Errorf("no simplification profile found for image %s", mfst.Target().Digest)
+		case mismatch:
+			// 其他平台的profile选出的文件不适用，完整拉取
+			progress.Messagef(p.config.ProgressOutput, "", "%v, pulling full image", perr)
+		default:
+			progress.Message(p.config.ProgressOutput, "", "no simplification profile found, pulling full image")
+		}
+	}
+	if p.simplifyKeeps == nil {
+		p.simplifyKeeps = make(map[digest.Digest]*simplifyKept)
+	}
+	p.simplifyKeeps[key] = &simplifyKept{keep: keep, profile: profile}
+	return keep, profile, nil
+}
+
+// simplifyPlatform returns the platform the image of mfst is pulled for:
+// the one of the manifest list entry it was resolved from, or the one
+// requested, or else the one of its config.
+func (p *v2Puller) simplifyPlatform(ctx context.Context, mfst *schema2.DeserializedManifest, platform *specs.Platform) (specs.Platform, error) {
+	if platform != nil {
+		return *platform, nil
+	}
+	target := mfst.Target()
+	configJSON, err := p.config.ImageStore.Get(target.Digest)
+	if err != nil {
+		if configJSON, err = p.pullSchema2Config(ctx, target.Digest); err != nil {
+			return specs.Platform{}, err
+		}
+	}
+	config, err := p.config.ImageStore.PlatformFromConfig(configJSON)
+	if err != nil {
+		return specs.Platform{}, err
+	}
+	return *config, nil
+}
+
+// selectKeep selects the files kept of the image of mfst with the profile
+// stored for it on platform, or else with the one pushed along with it.
+func (p *v2Puller) selectKeep(ctx context.Context, mfst *schema2.DeserializedManifest, platform specs.Platform) ([]string, []byte, error) {
+	target := mfst.Target()
+	keep, err := p.config.Simplify.Keep(target.Digest, platform, nil)
+	if keep != nil {
+		return keep, nil, err
+	}
+	if _, mismatch := err.(ProfilePlatformError); err != nil && !mismatch {
+		return nil, nil, err
+	}
+	// 本地没有该平台的profile时使用随镜像推送的profile
+	dgst := simplifyAnnotations(mfst)[AnnotationSimplifyProfile]
+	if dgst == "" {
+		return nil, nil, err
+	}
+	if err := p.checkSignedProfile(digest.Digest(dgst)); err != nil {
+		return nil, nil, err
+	}
+	if max := p.config.Simplify.MaxProfileSize; max > 0 {
+		// 不下载过大的profile
+		desc, perr := p.repo.Blobs(ctx).Stat(ctx, digest.Digest(dgst))
+		if perr == nil && desc.Size > max {
+			return nil, nil, errdefs.InvalidParameter(errors.Errorf("invalid simplify profile: %d bytes exceed the maximum of %d", desc.Size, max))
+		}
+	}
+	profile, perr := p.repo.Blobs(ctx).Get(ctx, digest.Digest(dgst))
+	if perr != nil {
+		// profile不一定随镜像推送
+		logrus.Debugf("simplify profile %s of %s not pulled: %v", dgst, target.Digest, perr)
+		return nil, nil, err
+	}
+	if digest.FromBytes(profile) != digest.Digest(dgst) {
+		return nil, nil, errors.Errorf("simplify profile %s pushed along with image %s failed verification", dgst, target.Digest)
+	}
+	keep, err = p.config.Simplify.Keep(target.Digest, platform, profile)
+	if keep != nil && !p.config.Simplify.Trusted {
+		progress.Messagef(p.config.ProgressOutput, "", "Warning: the simplify profile %s pushed along with the image is used without verifying its signature, enable content trust to verify it", dgst)
+	}
+	return keep, profile, err
+}
+
+// checkSignedProfile fails pulls requiring the profiles pushed along with
+// images to be signed if the profile dgst is not the one signed.
+func (p *v2Puller) checkSignedProfile(dgst digest.Digest) error {
+	switch signed := p.config.Simplify.SignedProfile; {
+	case !p.config.Simplify.Trusted || dgst == signed:
+		return nil
+	case signed == "":
+		return errdefs.Forbidden(errors.Errorf("simplify profile %s pushed along with the image is not signed", dgst))
+	default:
+		return errdefs.Forbidden(errors.Errorf("simplify profile %s pushed along with the image is not the signed profile %s", dgst, signed))
+	}
+}
+
+// writeSimplifyStatus writes the final status of a simplified pull, flagging
+// whether an image was simplified or every image was pulled in full.
+func writeSimplifyStatus(requestedTag string, out progress.Output, layersDownloaded, simplified bool) {
+	status := "Status: Image is up to date for "
+	if layersDownloaded {
+		status = "Status: Downloaded newer image for "
+	}
+	progress.Messagef(out, "", "%s%s (simplified: %t)", status, requestedTag, simplified)
+}
+
+// layersDigest identifies the layers of mfst.
+func layersDigest(mfst *schema2.DeserializedManifest) digest.Digest {
+	var layers []string
+	for _, d := range mfst.Layers {
+		layers = append(layers, d.Digest.String())
+	}
+	return digest.FromString(strings.Join(layers, "\n"))
+}
+
+// recordSavings records what simplifying the image id saved, for
+// reportSimplified.
+func (p *v2Puller) recordSavings(id digest.Digest, savings simplifySavings) {
+	if p.simplified == nil {
+		p.simplified = make(map[digest.Digest]simplifySavings)
+	}
+	p.simplified[id] = savings
+}
+
+// reportSimplified reports what simplifying the image of each of refs saved,
+// once the tags of a repository have been pulled.
+func (p *v2Puller) reportSimplified(refs []reference.NamedTagged) {
+	if p.config.ReferenceStore == nil {
+		return
+	}
+	for _, ref := range refs {
+		id, err := p.config.ReferenceStore.Get(ref)
+		if err != nil {
+			continue
+		}
+		savings, ok := p.simplified[id]
+		if !ok {
+			progress.Message(p.config.ProgressOutput, ref.Tag(), "Not simplified")
+			continue
+		}
+		progress.Messagef(p.config.ProgressOutput, ref.Tag(), "Kept %d of %d files, saved %s",
+			savings.selected, savings.files, units.HumanSize(float64(savings.saved)))
+	}
+}
+
+// keepPaths returns the set of the absolute paths of keep, which it sorts.
+func keepPaths(keep []string) map[string]struct{} {
+	sort.Strings(keep)
+	keepSet := make(map[string]struct{}, len(keep))
+	for _, p := range keep {
+		keepSet[path.Clean("/"+p)] = struct{}{}
+	}
+	return keepSet
+}
+
+// selectionDigest identifies the files kept in the keys of the layers made
+// of them. Their paths are cleaned and sorted, so that the same files kept in
+// any order are the same selection.
+func selectionDigest(keep []string) digest.Digest {
+	keepSet := keepPaths(keep)
+	paths := make([]string, 0, len(keepSet))
+	for p := range keepSet {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return digest.FromString(strings.Join(paths, "\n"))
+}
+
+// putSimplified stores the image made of the layers of rootFS, holding the
+// files kept of the image of mfst, whose configuration is configJSON and the
+// diff IDs of its layers diffIDs. Its configuration is the canonical form of
+// configJSON, created at the same time, so that every daemon pulling the
+// image with the same files kept stores it with the same ID.
+func (p *v2Puller) putSimplified(configJSON []byte, rootFS image.RootFS, mfst *schema2.DeserializedManifest, diffIDs []layer.DiffID, tocs []*layer.TOC, profile []byte) (digest.Digest, error) {
+	// 新的层只包含部分文件，需要新的镜像配置
+	configJSON, err := image.SimplifiedConfig(configJSON, &rootFS)
+	if err != nil {
+		return "", err
+	}
+	id, err := p.config.ImageStore.Put(configJSON)
+	if err != nil {
+		return "", err
+	}
+
+	// 缺少的文件可按需从registry下载
+	for n, d := range mfst.Layers {
+		if err := p.V2MetadataService.Add(diffIDs[n], metadata.V2Metadata{Digest: d.Digest, SourceRepository: p.repoInfo.Name.Name()}); err != nil {
+			return "", err
+		}
+	}
+	if err := p.config.Simplify.Pulled(id, mfst.Target().Digest, diffIDs, tocs, profile); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// pullSeekableTOCs returns the files of the seekable layers of mfst kept,
+// using the tables of contents of the image pushed as the blob dgst, along
+// with keep once the symlinks leading to its files are followed. It returns
+// nil if a layer is not seekable.
+func (p *v2Puller) pullSeekableTOCs(ctx context.Context, mfst *schema2.DeserializedManifest, dgst digest.Digest, keep []string) ([]partialLayer, []string, error) {
+	tocs, err := p.pullSimplifyTOC(ctx, dgst)
+	if err != nil {
+		progress.Messagef(p.config.ProgressOutput, "", "Warning: cannot pull the table of contents of the image, pulling all its files: %v", err)
+		return nil, nil, nil
+	}
+	var layerTOCs []*layer.TOC
+	for _, d := range mfst.Layers {
+		toc := tocs.Layers[d.Digest]
+		if toc == nil || !toc.valid() {
+			progress.Messagef(p.config.ProgressOutput, "", "Warning: layer %s is not seekable, pulling all the files of the image", d.Digest)
+			return nil, nil, nil
+		}
+		layerTOCs = append(layerTOCs, &toc.TOC)
+	}
+	if err := checkKeep(keep, layerTOCs); err != nil {
+		return nil, nil, err
+	}
+	keep = followLinks(keep, layerTOCs)
+	keepSet := keepPaths(keep)
+	store := tocStore{store: p.config.MetadataStore}
+	var layers []partialLayer
+	for _, d := range mfst.Layers {
+		toc := tocs.Layers[d.Digest]
+		if err := store.set(d.Digest, toc); err != nil {
+			return nil, nil, err
+		}
+		layers = append(layers, &seekablePartial{toc: toc, selected: toc.selectEntries(keepSet)})
+	}
+	return layers, keep, nil
+}
+
+// pullEStargzTOCs returns the files of the eStargz layers of mfst kept,
+// reading the table of contents at the end of each layer blob, along with
+// keep once the symlinks leading to its files are followed. It returns nil
+// if a layer is not in the eStargz format, or if the digest of its table of
+// contents is not recorded in the manifest or does not match.
+func (p *v2Puller) pullEStargzTOCs(ctx context.Context, mfst *schema2.DeserializedManifest, keep []string) ([]partialLayer, []string, error) {
+	store := estargzStore{store: p.config.MetadataStore}
+	tocDigests := estargzTOCDigests(mfst)
+	if len(tocDigests) != len(mfst.Layers) {
+		return nil, nil, nil
+	}
+	var tocs []*estargzTOC
+	for n, d := range mfst.Layers {
+		// 没有记录目录摘要的层无法校验其目录，整层拉取
+		if tocDigests[n] == "" {
+			logrus.Debugf("layer %s has no %s annotation, not reading its eStargz table of contents", d.Digest, estargzTOCDigestAnnotation)
+			return nil, nil, nil
+		}
+		toc, err := p.pullEStargzTOC(ctx, d.Digest, d.Size, tocDigests[n])
+		if err != nil {
+			if err != errNotEStargz {
+				progress.Messagef(p.config.ProgressOutput, "", "Warning: cannot read the eStargz table of contents of layer %s, pulling all the files of the image: %v", d.Digest, err)
+			}
+			return nil, nil, nil
+		}
+		tocs = append(tocs, toc)
+	}
+	var layerTOCs []*layer.TOC
+	for _, toc := range tocs {
+		layerTOCs = append(layerTOCs, toc.layerTOC())
+	}
+	if err := checkKeep(keep, layerTOCs); err != nil {
+		return nil, nil, err
+	}
+	keep = followLinks(keep, layerTOCs)
+	keepSet := keepPaths(keep)
+	var layers []partialLayer
+	for n, d := range mfst.Layers {
+		if err := store.set(d.Digest, tocs[n]); err != nil {
+			return nil, nil, err
+		}
+		layers = append(layers, newEStargzPartial(tocs[n], keepSet))
+	}
+	return layers, keep, nil
+}
+
+func (p *v2Puller) pullEStargzTOC(ctx context.Context, dgst digest.Digest, size int64, tocDigest digest.Digest) (*estargzTOC, error) {
+	blob, err := p.repo.Blobs(ctx).Open(ctx, dgst)
+	if err != nil {
+		return nil, err
+	}
+	defer blob.Close()
+	return readEStargzTOC(blob, size, tocDigest)
+}
+
+// pullSimplifyTOC pulls the tables of contents of the layers of an image.
+func (p *v2Puller) pullSimplifyTOC(ctx context.Context, dgst digest.Digest) (*ImageTOC, error) {
+	b, err := p.repo.Blobs(ctx).Get(ctx, dgst)
+	if err != nil {
+		return nil, err
+	}
+	if digest.FromBytes(b) != dgst {
+		return nil, errors.Errorf("table of contents verification failed for digest %s", dgst)
+	}
+	var tocs ImageTOC
+	if err := json.Unmarshal(b, &tocs); err != nil {
+		return nil, err
+	}
+	return &tocs, nil
+}
+
+// partialLayer selects the files of a layer blob downloaded by a partial
+// pull.
+type partialLayer interface {
+	// layerTOC returns the table of contents of the tar stream of the whole
+	// layer.
+	layerTOC() *layer.TOC
+	// size returns the number of bytes of the blob holding the files
+	// selected.
+	size() int64
+	// files returns the number of files selected, all of them if full is set,
+	// and the number of files of the layer.
+	files(full bool) (selected, total int)
+	// fetch writes the tar stream of the entries selected to w, reading them
+	// from the blob r, or from ranges if they were downloaded before. It
+	// returns the number of bytes read from r.
+	fetch(ctx context.Context, w io.Writer, r io.ReadSeeker, ranges *blobRanges) (int64, error)
+}
+
+// seekablePartial selects the members of a seekable layer blob.
+type seekablePartial struct {
+	toc      *TOC
+	selected []bool
+}
+
+func (sp *seekablePartial) layerTOC() *layer.TOC {
+	return &sp.toc.TOC
+}
+
+func (sp *seekablePartial) size() int64 {
+	return sp.toc.selectedSize(sp.selected)
+}
+
+func (sp *seekablePartial) files(full bool) (selected, total int) {
+	for n, e := range sp.toc.Entries {
+		if e.Size > 0 {
+			total++
+			if full || sp.selected[n] {
+				selected++
+			}
+		}
+	}
+	return selected, total
+}
+
+func (sp *seekablePartial) fetch(ctx context.Context, w io.Writer, r io.ReadSeeker, ranges *blobRanges) (int64, error) {
+	return fetchEntries(ctx, w, r, sp.toc, sp.selected, ranges)
+}
+
+// v2PartialLayerDescriptor downloads the files of a layer blob selected,
+// falling back to downloading the whole blob if the registry does not
+// support range requests.
+type v2PartialLayerDescriptor struct {
+	*v2LayerDescriptor
+	layer     partialLayer
+	selection digest.Digest
+	// ranges are the ranges of the blob downloaded by earlier attempts.
+	ranges *blobRanges
+	// fetched is the number of bytes of the blob downloaded, and full is set
+	// once the download falls back to the whole blob.
+	fetched int64
+	full    bool
+}
+
+func (ld *v2PartialLayerDescriptor) Key() string {
+	return "v2partial:" + ld.digest.String() + " " + ld.selection.String()
+}
+
+func (ld *v2PartialLayerDescriptor) DiffID() (layer.DiffID, error) {
+	if ld.full {
+		return ld.v2LayerDescriptor.DiffID()
+	}
+	// 部分层的diff ID在下载前未知
+	return "", errors.New("diff ID of a partial layer is unknown")
+}
+
+func (ld *v2PartialLayerDescriptor) Download(ctx context.Context, progressOutput progress.Output) (io.ReadCloser, int64, error) {
+	if ld.full {
+		return ld.downloadFull(ctx, progressOutput)
+	}
+	logrus.Debugf("pulling entries of blob %q", ld.digest)
+
+	tmpFile, err := createDownloadFile()
+	if err != nil {
+		return nil, 0, xfer.DoNotRetry{Err: err}
+	}
+	removeTmpFile := func() {
+		tmpFile.Close()
+		if err := os.RemoveAll(tmpFile.Name()); err != nil {
+			logrus.Errorf("Failed to remove temp file: %s", tmpFile.Name())
+		}
+	}
+
+	layerDownload, err := ld.open(ctx)
+	if err != nil {
+		removeTmpFile()
+		logrus.Errorf("Error initiating layer download: %v", err)
+		return nil, 0, retryOnError(err)
+	}
+	if stored := ld.ranges.size(); stored > 0 {
+		progress.Updatef(progressOutput, ld.ID(), "Resuming download, %s downloaded before", units.HumanSize(float64(stored)))
+	}
+	reader := progress.NewProgressReader(layerDownload, progressOutput, ld.layer.size(), ld.ID(), "Downloading")
+	fetched, err := ld.layer.fetch(ctx, tmpFile, struct {
+		io.Reader
+		io.Seeker
+	}{reader, layerDownload}, ld.ranges)
+	reader.Close()
+	if err != nil {
+		removeTmpFile()
+		if errors.Cause(err) == transport.ErrWrongCodeForByteRange {
+			progress.Update(progressOutput, ld.ID(), "Range requests not supported, downloading the whole layer")
+			ld.full = true
+			ld.ranges.remove()
+			return ld.downloadFull(ctx, progressOutput)
+		}
+		return nil, 0, retryOnError(err)
+	}
+	ld.fetched = fetched
+
+	progress.Update(progressOutput, ld.ID(), "Download complete")
+
+	size, err := tmpFile.Seek(0, io.SeekCurrent)
+	if err == nil {
+		_, err = tmpFile.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		removeTmpFile()
+		return nil, 0, xfer.DoNotRetry{Err: err}
+	}
+	return ioutils.NewReadCloserWrapper(tmpFile, func() error {
+		removeTmpFile()
+		return nil
+	}), size, nil
+}
+
+func (ld *v2PartialLayerDescriptor) downloadFull(ctx context.Context, progressOutput progress.Output) (io.ReadCloser, int64, error) {
+	rc, size, err := ld.v2LayerDescriptor.Download(ctx, progressOutput)
+	if err == nil {
+		ld.fetched = size
+	}
+	return rc, size, err
+}
+
+func (ld *v2PartialLayerDescriptor) Registered(diffID layer.DiffID) {
+	if ld.full {
+		ld.v2LayerDescriptor.Registered(diffID)
+		return
+	}
+	// 层已注册，不再需要续传
+	ld.ranges.remove()
+}
+
+// 修改
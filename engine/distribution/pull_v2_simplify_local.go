@@ -0,0 +1,261 @@
+package distribution // import "github.com/docker/docker/distribution"
+
+import (
+	"archive/tar"
+	"context"
+	"io"
+	"io/ioutil"
+	"runtime"
+
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/docker/distribution/xfer"
+	"github.com/docker/docker/image"
+	"github.com/docker/docker/layer"
+	"github.com/docker/docker/pkg/progress"
+	"github.com/docker/docker/pkg/stringid"
+	"github.com/docker/go-units"
+	"github.com/opencontainers/go-digest"
+	specs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// 修改： 完整镜像的层已在本地时，不再下载，直接从本地内容精简
+
+// simplifyLocal creates the image of mfst made of the files it keeps once
+// simplified from the layers of its full image found locally, only pulling
+// its configuration if it is not local either. It returns false if a layer
+// is not local, or if there is no profile to select the files kept with.
+func (p *v2Puller) simplifyLocal(ctx context.Context, mfst *schema2.DeserializedManifest, platform *specs.Platform) (digest.Digest, bool, error) {
+	if runtime.GOOS == "windows" || p.config.Simplify.OpenLayer == nil {
+		return "", false, nil
+	}
+	target := mfst.Target()
+	layerStoreOS := runtime.GOOS
+	if platform != nil {
+		layerStoreOS = platform.OS
+	}
+
+	// 完整镜像已在本地时使用其配置，否则根据层的blob查找本地的层
+	var diffIDs []layer.DiffID
+	configJSON, err := p.config.ImageStore.Get(target.Digest)
+	if err == nil {
+		rootFS, err := p.config.ImageStore.RootFSFromConfig(configJSON)
+		if err != nil || rootFS == nil || len(rootFS.DiffIDs) != len(mfst.Layers) {
+			return "", false, err
+		}
+		diffIDs = rootFS.DiffIDs
+	} else {
+		configJSON = nil
+		for _, d := range mfst.Layers {
+			diffID, err := p.V2MetadataService.GetDiffID(d.Digest)
+			if err != nil {
+				return "", false, nil
+			}
+			diffIDs = append(diffIDs, diffID)
+		}
+	}
+	for n := range diffIDs {
+		rc, err := p.config.Simplify.OpenLayer(layerStoreOS, diffIDs[:n+1])
+		if err != nil {
+			logrus.Debugf("layer %s of %s is not local: %v", diffIDs[n], target.Digest, err)
+			return "", false, nil
+		}
+		rc.Close()
+	}
+
+	keep, profile, err := p.simplifyKeep(ctx, mfst, platform)
+	if err != nil || keep == nil {
+		return "", false, err
+	}
+	progress.Message(p.config.ProgressOutput, "", "Simplifying from local content")
+
+	var (
+		descriptors []xfer.DownloadDescriptor
+		locals      []*localLayerDescriptor
+		layerTOCs   []*layer.TOC
+	)
+	for n := range diffIDs {
+		ld := &localLayerDescriptor{
+			open: func(chain []layer.DiffID) func() (io.ReadCloser, error) {
+				return func() (io.ReadCloser, error) {
+					return p.config.Simplify.OpenLayer(layerStoreOS, chain)
+				}
+			}(diffIDs[:n+1]),
+			diffID: diffIDs[n],
+		}
+		if err := ld.index(); err != nil {
+			return "", false, err
+		}
+		layerTOCs = append(layerTOCs, ld.toc)
+		descriptors = append(descriptors, ld)
+		locals = append(locals, ld)
+	}
+	if err := checkKeep(keep, layerTOCs); err != nil {
+		return "", false, err
+	}
+	// 符号链接可能指向其它层中的文件
+	keep = followLinks(keep, layerTOCs)
+	keepSet := keepPaths(keep)
+	for _, ld := range locals {
+		ld.selection = selectionDigest(keep)
+		ld.selectEntries(keepSet)
+	}
+
+	if configJSON == nil {
+		if configJSON, err = p.pullSchema2Config(ctx, target.Digest); err != nil {
+			return "", false, ImageConfigPullError{Err: err}
+		}
+		configRootFS, err := p.config.ImageStore.RootFSFromConfig(configJSON)
+		if err == nil && configRootFS == nil {
+			err = errRootFSInvalid
+		}
+		if err != nil {
+			return "", false, err
+		}
+		if len(configRootFS.DiffIDs) != len(diffIDs) {
+			return "", false, errRootFSMismatch
+		}
+		for n := range diffIDs {
+			if configRootFS.DiffIDs[n] != diffIDs[n] {
+				return "", false, errRootFSMismatch
+			}
+		}
+	}
+
+	rootFS, release, err := p.config.DownloadManager.Download(ctx, *image.NewRootFS(), layerStoreOS, descriptors, p.config.ProgressOutput)
+	if err != nil {
+		return "", false, err
+	}
+	defer release()
+	id, err := p.putSimplified(configJSON, rootFS, mfst, diffIDs, layerTOCs, profile)
+	if err != nil {
+		return "", false, err
+	}
+
+	var (
+		saved           int64
+		selected, files int
+	)
+	for _, ld := range locals {
+		for n, e := range ld.toc.Entries {
+			if e.Size == 0 {
+				continue
+			}
+			files++
+			if ld.selected[n] {
+				selected++
+			} else {
+				saved += e.Size
+			}
+		}
+	}
+	progress.Messagef(p.config.ProgressOutput, "", "Simplified from local content: kept %d of %d files, saved %s",
+		selected, files, units.HumanSize(float64(saved)))
+	p.recordSavings(id, simplifySavings{selected: selected, files: files, saved: saved})
+	return id, true, nil
+}
+
+// localLayerDescriptor "downloads" the files selected of a layer from the
+// local layer store.
+type localLayerDescriptor struct {
+	open      func() (io.ReadCloser, error)
+	diffID    layer.DiffID
+	selection digest.Digest
+	toc       *layer.TOC
+	selected  []bool
+	// size is the size of the records of the entries selected.
+	size int64
+}
+
+// index builds the table of contents of the layer.
+func (ld *localLayerDescriptor) index() error {
+	rc, err := ld.open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	ld.toc, err = layer.BuildTOC(rc, nil)
+	return err
+}
+
+// selectEntries selects the entries of the layer needed to extract the files
+// in keep, once indexed.
+func (ld *localLayerDescriptor) selectEntries(keep map[string]struct{}) {
+	ld.selected = selectLayerEntries(ld.toc.Entries, keep)
+	for n, e := range ld.toc.Entries {
+		if !ld.selected[n] {
+			continue
+		}
+		end := ld.toc.End
+		if n+1 < len(ld.toc.Entries) {
+			end = ld.toc.Entries[n+1].Offset
+		}
+		ld.size += end - e.Offset
+	}
+}
+
+func (ld *localLayerDescriptor) Key() string {
+	return "local:" + ld.diffID.String() + " " + ld.selection.String()
+}
+
+func (ld *localLayerDescriptor) ID() string {
+	return stringid.TruncateID(ld.diffID.String())
+}
+
+func (ld *localLayerDescriptor) DiffID() (layer.DiffID, error) {
+	// 新层的diff ID在生成前未知
+	return "", errors.New("diff ID of a simplified layer is unknown")
+}
+
+func (ld *localLayerDescriptor) Download(ctx context.Context, progressOutput progress.Output) (io.ReadCloser, int64, error) {
+	rc, err := ld.open()
+	if err != nil {
+		return nil, 0, xfer.DoNotRetry{Err: err}
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		defer rc.Close()
+		pw.CloseWithError(filterEntries(ctx, pw, rc, ld.toc, ld.selected))
+	}()
+	return pr, ld.size, nil
+}
+
+func (ld *localLayerDescriptor) Close() {
+}
+
+// filterEntries writes the entries of the tar stream r selected to w. The
+// entries of r must be those of toc. The records of the entries are copied
+// as they are, so that those tar.Writer cannot encode, such as sparse files,
+// are kept as well.
+func filterEntries(ctx context.Context, w io.Writer, r io.Reader, toc *layer.TOC, selected []bool) error {
+	for n, e := range toc.Entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		end := toc.End
+		if n+1 < len(toc.Entries) {
+			end = toc.Entries[n+1].Offset
+		}
+		out := ioutil.Discard
+		if selected[n] {
+			out = w
+		}
+		records := io.LimitReader(r, end-e.Offset)
+		hdr, err := tar.NewReader(io.TeeReader(records, out)).Next()
+		if err == io.EOF || err == nil && hdr.Name != e.Name {
+			return errors.New("layer changed while being simplified")
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(out, records); err != nil {
+			return err
+		}
+	}
+	// 归档结尾的两个空块
+	_, err := w.Write(make([]byte, 1024))
+	return err
+}
+
+// 修改
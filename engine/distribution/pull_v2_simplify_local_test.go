@@ -0,0 +1,95 @@
+package distribution // import "github.com/docker/docker/distribution"
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/docker/docker/internal/testutil"
+	"github.com/docker/docker/layer"
+	"github.com/docker/docker/pkg/progress"
+	"github.com/opencontainers/go-digest"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+func TestLocalLayerDescriptor(t *testing.T) {
+	layerTar := testLayerTar(t)
+	ld := &localLayerDescriptor{
+		open: func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(layerTar)), nil
+		},
+		diffID:    layer.DiffID(digest.FromBytes(layerTar)),
+		selection: selectionDigest([]string{"/bin/dir"}),
+	}
+	assert.NilError(t, ld.index())
+	ld.selectEntries(keepPaths([]string{"/bin/dir"}))
+	assert.Check(t, is.Len(ld.toc.Entries, 9))
+	assert.Check(t, ld.size < int64(len(layerTar)))
+
+	rc, size, err := ld.Download(context.Background(), progress.DiscardOutput())
+	assert.NilError(t, err)
+	defer rc.Close()
+	b, err := ioutil.ReadAll(rc)
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(size, ld.size))
+	// the target of a kept hard link is kept along with it
+	assert.Check(t, is.DeepEqual(tarNames(t, b), []string{"bin/", "bin/ls", "bin/dir", "bin/bash", "etc/empty", "etc/.wh.old"}))
+}
+
+func TestLocalLayerDescriptorChanged(t *testing.T) {
+	layerTar := testLayerTar(t)
+	ld := &localLayerDescriptor{
+		open: func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(layerTar)), nil
+		},
+	}
+	assert.NilError(t, ld.index())
+	ld.selectEntries(keepPaths(nil))
+	ld.toc.Entries[1].Name = "bin/other"
+
+	rc, _, err := ld.Download(context.Background(), progress.DiscardOutput())
+	assert.NilError(t, err)
+	defer rc.Close()
+	_, err = ioutil.ReadAll(rc)
+	assert.Check(t, is.ErrorContains(err, "layer changed"))
+}
+
+func TestLocalLayerDescriptorSparse(t *testing.T) {
+	data := testutil.SparseData{Offset: 1 << 20, Data: bytes.Repeat([]byte("x"), 4096)}
+	var buf bytes.Buffer
+	buf.Write(testutil.GNUSparseEntry("var/lib/db", 1<<30, data))
+	tw := tar.NewWriter(&buf)
+	assert.NilError(t, tw.WriteHeader(&tar.Header{Name: "etc/db.conf", Typeflag: tar.TypeReg, Mode: 0644, Size: 4}))
+	_, err := tw.Write([]byte("conf"))
+	assert.NilError(t, err)
+	assert.NilError(t, tw.Close())
+	layerTar := buf.Bytes()
+
+	ld := &localLayerDescriptor{
+		open: func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(layerTar)), nil
+		},
+	}
+	assert.NilError(t, ld.index())
+	ld.selectEntries(keepPaths([]string{"/var/lib/db"}))
+
+	rc, _, err := ld.Download(context.Background(), progress.DiscardOutput())
+	assert.NilError(t, err)
+	defer rc.Close()
+	b, err := ioutil.ReadAll(rc)
+	assert.NilError(t, err)
+	// the sparse file is kept as such, without its holes
+	assert.Check(t, len(b) < 1<<20)
+	tr := tar.NewReader(bytes.NewReader(b))
+	hdr, err := tr.Next()
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(hdr.Name, "var/lib/db"))
+	assert.Check(t, is.Equal(hdr.Typeflag, byte(tar.TypeGNUSparse)))
+	assert.Check(t, is.Equal(hdr.Size, int64(1<<30)))
+	_, err = tr.Next()
+	assert.Check(t, is.Equal(err, io.EOF))
+}
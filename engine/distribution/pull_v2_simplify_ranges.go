@@ -0,0 +1,174 @@
+package distribution // import "github.com/docker/docker/distribution"
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+)
+
+// 修改： 部分层下载的断点续传
+
+// blobRanges are the ranges of a layer blob a partial pull downloaded and
+// verified, each stored in a file named after its offset in the blob. They
+// are kept until the layer is registered, so that a pull interrupted, even
+// by a daemon restart, resumes without downloading them again. A nil
+// *blobRanges stores nothing.
+type blobRanges struct {
+	dir string
+}
+
+// newBlobRanges returns the ranges of the layer blob dgst stored under
+// root, or nil if root is empty.
+func newBlobRanges(root string, dgst digest.Digest) *blobRanges {
+	if root == "" {
+		return nil
+	}
+	return &blobRanges{dir: filepath.Join(root, dgst.Algorithm().String(), dgst.Hex())}
+}
+
+func (br *blobRanges) path(offset int64) string {
+	return filepath.Join(br.dir, strconv.FormatInt(offset, 10))
+}
+
+// size returns the number of bytes of the ranges stored.
+func (br *blobRanges) size() int64 {
+	if br == nil {
+		return 0
+	}
+	files, err := ioutil.ReadDir(br.dir)
+	if err != nil {
+		return 0
+	}
+	var size int64
+	for _, fi := range files {
+		if _, err := strconv.ParseInt(fi.Name(), 10, 64); err == nil {
+			size += fi.Size()
+		}
+	}
+	return size
+}
+
+// open returns the range at offset stored, or nil if there is none or verify
+// rejects it, in which case it is removed. The range is read from the start.
+func (br *blobRanges) open(offset int64, verify func(io.Reader) error) *os.File {
+	if br == nil {
+		return nil
+	}
+	f, err := os.Open(br.path(offset))
+	if err != nil {
+		return nil
+	}
+	err = verify(f)
+	if err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		// 可能是守护进程退出前未写完整，重新下载
+		logrus.Debugf("discarding range %d of %s: %v", offset, br.dir, err)
+		f.Close()
+		os.Remove(f.Name())
+		return nil
+	}
+	return f
+}
+
+// record returns a reader of r storing what is read as the range at offset,
+// once done is called with the range verified.
+func (br *blobRanges) record(r io.Reader, offset int64) (io.Reader, *rangeWriter) {
+	if br == nil {
+		return r, nil
+	}
+	if err := os.MkdirAll(br.dir, 0700); err != nil {
+		logrus.Debugf("cannot store ranges in %s: %v", br.dir, err)
+		return r, nil
+	}
+	f, err := ioutil.TempFile(br.dir, ".tmp-")
+	if err != nil {
+		logrus.Debugf("cannot store ranges in %s: %v", br.dir, err)
+		return r, nil
+	}
+	rw := &rangeWriter{f: f, path: br.path(offset)}
+	return io.TeeReader(r, rw), rw
+}
+
+// remove removes the ranges stored, once the layer is registered or
+// downloaded in full.
+func (br *blobRanges) remove() {
+	if br == nil {
+		return
+	}
+	if err := os.RemoveAll(br.dir); err != nil {
+		logrus.Warnf("failed to remove the ranges downloaded in %s: %v", br.dir, err)
+	}
+}
+
+// rangeWriter writes a range to a temporary file, renamed once the range is
+// verified. Failing to store it does not fail the download: the range is
+// only downloaded again if the pull is interrupted.
+type rangeWriter struct {
+	f    *os.File
+	path string
+	err  error
+}
+
+func (rw *rangeWriter) Write(p []byte) (int, error) {
+	if rw.err == nil {
+		_, rw.err = rw.f.Write(p)
+	}
+	return len(p), nil
+}
+
+// done stores the range if verified is set, and discards it otherwise.
+func (rw *rangeWriter) done(verified bool) {
+	if rw == nil {
+		return
+	}
+	err := rw.f.Close()
+	if rw.err == nil && err == nil && verified {
+		if err = os.Rename(rw.f.Name(), rw.path); err == nil {
+			return
+		}
+	}
+	os.Remove(rw.f.Name())
+}
+
+// RemoveStaleRanges removes the ranges stored under root of the layer blobs
+// whose partial pull has not resumed since before, and returns the number of
+// bytes freed.
+func RemoveStaleRanges(root string, before time.Time) (int64, error) {
+	algs, err := ioutil.ReadDir(root)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	var freed int64
+	for _, alg := range algs {
+		blobs, err := ioutil.ReadDir(filepath.Join(root, alg.Name()))
+		if err != nil {
+			return freed, err
+		}
+		for _, blob := range blobs {
+			br := &blobRanges{dir: filepath.Join(root, alg.Name(), blob.Name())}
+			// 每存下一段，目录的修改时间都会更新
+			if !blob.ModTime().Before(before) {
+				continue
+			}
+			size := br.size()
+			if err := os.RemoveAll(br.dir); err != nil {
+				return freed, err
+			}
+			freed += size
+		}
+	}
+	return freed, nil
+}
+
+// 修改
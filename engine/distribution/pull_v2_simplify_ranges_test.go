@@ -0,0 +1,107 @@
+package distribution // import "github.com/docker/docker/distribution"
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+func TestFetchEntriesResumes(t *testing.T) {
+	root, err := ioutil.TempDir("", "ranges")
+	assert.NilError(t, err)
+	defer os.RemoveAll(root)
+
+	compressed, compressionDone, toc := compressSeekable(bytes.NewReader(testLayerTar(t)))
+	blob, err := ioutil.ReadAll(compressed)
+	assert.NilError(t, err)
+	<-compressionDone
+	ranges := newBlobRanges(root, digest.FromBytes(blob))
+
+	selected := make([]bool, len(toc.Members))
+	for n := range selected {
+		selected[n] = true
+	}
+	var expected bytes.Buffer
+	_, err = fetchEntries(context.Background(), &expected, bytes.NewReader(blob), toc, selected, nil)
+	assert.NilError(t, err)
+
+	// the download is interrupted in the middle of the member after bin/ls
+	interrupted := blob[:toc.Members[3].Offset+1]
+	_, err = fetchEntries(context.Background(), ioutil.Discard, bytes.NewReader(interrupted), toc, selected, ranges)
+	assert.Check(t, err != nil)
+	stored := toc.Members[0].Size + toc.Members[1].Size + toc.Members[2].Size
+	assert.Check(t, is.Equal(ranges.size(), stored))
+
+	var out bytes.Buffer
+	fetched, err := fetchEntries(context.Background(), &out, bytes.NewReader(blob), toc, selected, ranges)
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(fetched, toc.selectedSize(selected)-stored))
+	assert.Check(t, bytes.Equal(out.Bytes(), expected.Bytes()))
+
+	// a range that does not match its digest is downloaded again
+	assert.NilError(t, ioutil.WriteFile(ranges.path(toc.Members[2].Offset), []byte("corrupted"), 0600))
+	out.Reset()
+	fetched, err = fetchEntries(context.Background(), &out, bytes.NewReader(blob), toc, selected, ranges)
+	assert.NilError(t, err)
+	assert.Check(t, fetched >= toc.Members[2].Size)
+	assert.Check(t, bytes.Equal(out.Bytes(), expected.Bytes()))
+
+	ranges.remove()
+	assert.Check(t, is.Equal(ranges.size(), int64(0)))
+}
+
+func TestEStargzPartialFetchResumes(t *testing.T) {
+	root, err := ioutil.TempDir("", "ranges")
+	assert.NilError(t, err)
+	defer os.RemoveAll(root)
+
+	blob, tocDigest := testEStargzBlob(t, testEStargzEntries(), 1024, false)
+	toc, err := readEStargzTOC(bytes.NewReader(blob), int64(len(blob)), tocDigest)
+	assert.NilError(t, err)
+	ranges := newBlobRanges(root, digest.FromBytes(blob))
+
+	ep := newEStargzPartial(toc, map[string]struct{}{"/bin/ls": {}, "/etc/app.conf": {}})
+	var expected bytes.Buffer
+	fetched, err := ep.fetch(context.Background(), &expected, bytes.NewReader(blob), ranges)
+	assert.NilError(t, err)
+	assert.Check(t, fetched >= ep.size())
+
+	var out bytes.Buffer
+	fetched, err = ep.fetch(context.Background(), &out, bytes.NewReader(blob), ranges)
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(fetched, int64(0)))
+	assert.Check(t, bytes.Equal(out.Bytes(), expected.Bytes()))
+}
+
+func TestRemoveStaleRanges(t *testing.T) {
+	root, err := ioutil.TempDir("", "ranges")
+	assert.NilError(t, err)
+	defer os.RemoveAll(root)
+
+	stale := newBlobRanges(root, digest.FromString("stale"))
+	recent := newBlobRanges(root, digest.FromString("recent"))
+	for _, br := range []*blobRanges{stale, recent} {
+		r, recorder := br.record(bytes.NewReader([]byte("range")), 0)
+		_, err := ioutil.ReadAll(r)
+		assert.NilError(t, err)
+		recorder.done(true)
+	}
+	old := time.Now().Add(-48 * time.Hour)
+	assert.NilError(t, os.Chtimes(stale.dir, old, old))
+
+	freed, err := RemoveStaleRanges(root, time.Now().Add(-24*time.Hour))
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(freed, int64(len("range"))))
+	_, err = os.Stat(stale.dir)
+	assert.Check(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(recent.dir, "0"))
+	assert.Check(t, err)
+}
@@ -0,0 +1,477 @@
+package distribution // import "github.com/docker/docker/distribution"
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/docker/distribution/metadata"
+	"github.com/docker/docker/distribution/xfer"
+	"github.com/docker/docker/errdefs"
+	"github.com/docker/docker/image"
+	"github.com/docker/docker/layer"
+	"github.com/docker/docker/pkg/archive"
+	"github.com/docker/docker/pkg/progress"
+	refstore "github.com/docker/docker/reference"
+	"github.com/docker/docker/registry"
+	"github.com/opencontainers/go-digest"
+	specs "github.com/opencontainers/image-spec/specs-go/v1"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+type progressRecorder struct {
+	messages []string
+}
+
+func (r *progressRecorder) WriteProgress(p progress.Progress) error {
+	if p.ID != "" {
+		r.messages = append(r.messages, p.ID+": "+p.Message)
+	} else {
+		r.messages = append(r.messages, p.Message)
+	}
+	return nil
+}
+
+var linuxAMD64 = specs.Platform{OS: "linux", Architecture: "amd64"}
+
+func testManifest(t *testing.T, config string, layers ...string) *schema2.DeserializedManifest {
+	m := schema2.Manifest{
+		Versioned: schema2.SchemaVersion,
+		Config:    distribution.Descriptor{MediaType: schema2.MediaTypeImageConfig, Digest: digest.FromString(config), Size: int64(len(config))},
+	}
+	for _, l := range layers {
+		m.Layers = append(m.Layers, distribution.Descriptor{MediaType: schema2.MediaTypeLayer, Digest: digest.FromString(l), Size: int64(len(l))})
+	}
+	mfst, err := schema2.FromStruct(m)
+	assert.NilError(t, err)
+	return mfst
+}
+
+func TestSimplifyKeepShared(t *testing.T) {
+	var selected []digest.Digest
+	out := &progressRecorder{}
+	p := &v2Puller{config: &ImagePullConfig{
+		Config: Config{ProgressOutput: out},
+		Simplify: &PullSimplify{
+			Keep: func(id digest.Digest, platform specs.Platform, profile []byte) ([]string, error) {
+				selected = append(selected, id)
+				if id == digest.FromString("bare") {
+					return nil, nil
+				}
+				return []string{"/bin/sh"}, nil
+			},
+		},
+	}}
+
+	// adjacent versions built from the same layers share the files kept
+	for _, config := range []string{"1.0", "1.1"} {
+		keep, _, err := p.simplifyKeep(context.Background(), testManifest(t, config, "base", "app"), &linuxAMD64)
+		assert.NilError(t, err)
+		assert.Check(t, is.DeepEqual(keep, []string{"/bin/sh"}))
+	}
+	assert.Check(t, is.DeepEqual(selected, []digest.Digest{digest.FromString("1.0")}))
+
+	// images without a profile are pulled in full, with a warning
+	keep, _, err := p.simplifyKeep(context.Background(), testManifest(t, "bare", "base"), &linuxAMD64)
+	assert.NilError(t, err)
+	assert.Check(t, is.Nil(keep))
+	_, _, err = p.simplifyKeep(context.Background(), testManifest(t, "bare", "base"), &linuxAMD64)
+	assert.NilError(t, err)
+	assert.Check(t, is.DeepEqual(out.messages, []string{"no simplification profile found, pulling full image"}))
+}
+
+func TestSimplifyKeepRequired(t *testing.T) {
+	out := &progressRecorder{}
+	p := &v2Puller{config: &ImagePullConfig{
+		Config: Config{ProgressOutput: out},
+		Simplify: &PullSimplify{
+			Keep: func(id digest.Digest, platform specs.Platform, profile []byte) ([]string, error) {
+				return nil, nil
+			},
+			Required: true,
+		},
+	}}
+	_, _, err := p.simplifyKeep(context.Background(), testManifest(t, "bare", "base"), &linuxAMD64)
+	assert.Check(t, is.Error(err, "no simplification profile found for image "+digest.FromString("bare").String()))
+	assert.Check(t, is.Len(out.messages, 0))
+}
+
+func TestSimplifyKeepPlatform(t *testing.T) {
+	for _, required := range []bool{false, true} {
+		out := &progressRecorder{}
+		p := &v2Puller{config: &ImagePullConfig{
+			Config: Config{ProgressOutput: out},
+			Simplify: &PullSimplify{
+				Keep: func(id digest.Digest, platform specs.Platform, profile []byte) ([]string, error) {
+					if platform.Architecture == "amd64" {
+						return []string{"/lib/x86_64-linux-gnu/libc.so.6"}, nil
+					}
+					return nil, ProfilePlatformError{Platform: "linux/arm64", Recorded: []string{"linux/amd64"}}
+				},
+				Required: required,
+			},
+		}}
+		keep, _, err := p.simplifyKeep(context.Background(), testManifest(t, "arm64", "base"), &specs.Platform{OS: "linux", Architecture: "arm64"})
+		assert.Check(t, is.Nil(keep))
+		if required {
+			assert.Check(t, is.ErrorContains(err, "simplification profile recorded on linux/amd64, not linux/arm64"))
+			assert.Check(t, is.Len(out.messages, 0))
+			continue
+		}
+		assert.NilError(t, err)
+		assert.Check(t, is.DeepEqual(out.messages, []string{"simplification profile recorded on linux/amd64, not linux/arm64, pulling full image"}))
+	}
+}
+
+// profileRepo serves the profile blobs pushed along with images.
+type profileRepo struct {
+	distribution.Repository
+	blobs map[digest.Digest][]byte
+}
+
+func (r profileRepo) Blobs(ctx context.Context) distribution.BlobStore {
+	return profileBlobs{blobs: r.blobs}
+}
+
+type profileBlobs struct {
+	distribution.BlobStore
+	blobs map[digest.Digest][]byte
+}
+
+func (b profileBlobs) Stat(ctx context.Context, dgst digest.Digest) (distribution.Descriptor, error) {
+	if blob, ok := b.blobs[dgst]; ok {
+		return distribution.Descriptor{Digest: dgst, Size: int64(len(blob))}, nil
+	}
+	return distribution.Descriptor{}, distribution.ErrBlobUnknown
+}
+
+func (b profileBlobs) Get(ctx context.Context, dgst digest.Digest) ([]byte, error) {
+	if blob, ok := b.blobs[dgst]; ok {
+		return blob, nil
+	}
+	return nil, distribution.ErrBlobUnknown
+}
+
+func TestSimplifyKeepSignedProfile(t *testing.T) {
+	profile := []byte(`{"paths":["/bin/sh"]}`)
+	dgst := digest.FromBytes(profile)
+	mfst, err := annotateManifest(testManifest(t, "app", "base"), map[string]string{AnnotationSimplifyProfile: dgst.String()})
+	assert.NilError(t, err)
+	keepPushed := func(id digest.Digest, platform specs.Platform, profile []byte) ([]string, error) {
+		if profile == nil {
+			return nil, nil
+		}
+		return []string{"/bin/sh"}, nil
+	}
+	for _, tc := range []struct {
+		name     string
+		trusted  bool
+		signed   digest.Digest
+		blob     []byte
+		err      string
+		messages []string
+	}{
+		{
+			name:     "untrusted",
+			blob:     profile,
+			messages: []string{"Warning: the simplify profile " + dgst.String() + " pushed along with the image is used without verifying its signature, enable content trust to verify it"},
+		},
+		{name: "signed", trusted: true, signed: dgst, blob: profile},
+		{name: "unsigned", trusted: true, blob: profile, err: "simplify profile " + dgst.String() + " pushed along with the image is not signed"},
+		{name: "other signed", trusted: true, signed: digest.FromString("other"), blob: profile, err: "is not the signed profile " + digest.FromString("other").String()},
+		{name: "tampered", trusted: true, signed: dgst, blob: []byte(`{"paths":["/"]}`), err: "failed verification"},
+	} {
+		out := &progressRecorder{}
+		p := &v2Puller{
+			config: &ImagePullConfig{
+				Config:   Config{ProgressOutput: out},
+				Simplify: &PullSimplify{Keep: keepPushed, Trusted: tc.trusted, SignedProfile: tc.signed},
+			},
+			repo: profileRepo{blobs: map[digest.Digest][]byte{dgst: tc.blob}},
+		}
+		keep, _, err := p.simplifyKeep(context.Background(), mfst, &linuxAMD64)
+		if tc.err != "" {
+			assert.Check(t, is.ErrorContains(err, tc.err), tc.name)
+			if tc.signed != dgst {
+				assert.Check(t, errdefs.IsForbidden(err), tc.name)
+			}
+			continue
+		}
+		assert.NilError(t, err, tc.name)
+		assert.Check(t, is.DeepEqual(keep, []string{"/bin/sh"}), tc.name)
+		assert.Check(t, is.DeepEqual(out.messages, tc.messages), tc.name)
+	}
+}
+
+func TestPullSchema2SimplifyVerifiesDigest(t *testing.T) {
+	mfst := testManifest(t, "app", "base")
+	named, err := reference.ParseNormalizedNamed("busybox")
+	assert.NilError(t, err)
+	// the digest signed for the image is not the one of the manifest served
+	ref, err := reference.WithDigest(named, digest.FromString("signed manifest"))
+	assert.NilError(t, err)
+	p := &v2Puller{
+		config: &ImagePullConfig{
+			Config: Config{ProgressOutput: &progressRecorder{}},
+			Simplify: &PullSimplify{
+				Keep: func(digest.Digest, specs.Platform, []byte) ([]string, error) {
+					t.Fatal("files selected before verifying the manifest")
+					return nil, nil
+				},
+				Trusted: true,
+			},
+		},
+	}
+	_, _, err = p.pullSchema2(context.Background(), ref, mfst, &linuxAMD64)
+	assert.Check(t, is.ErrorContains(err, "manifest verification failed for digest "+ref.Digest().String()))
+}
+
+func TestWriteSimplifyStatus(t *testing.T) {
+	out := &progressRecorder{}
+	writeSimplifyStatus("app:1.0", out, true, true)
+	writeSimplifyStatus("app:1.0", out, false, false)
+	assert.Check(t, is.DeepEqual(out.messages, []string{
+		"Status: Downloaded newer image for app:1.0 (simplified: true)",
+		"Status: Image is up to date for app:1.0 (simplified: false)",
+	}))
+}
+
+func TestReportSimplified(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "pull-simplify")
+	assert.NilError(t, err)
+	defer os.RemoveAll(tmpDir)
+	store, err := refstore.NewReferenceStore(filepath.Join(tmpDir, "repositories.json"))
+	assert.NilError(t, err)
+
+	out := &progressRecorder{}
+	p := &v2Puller{config: &ImagePullConfig{
+		Config:   Config{ProgressOutput: out, ReferenceStore: store},
+		Simplify: &PullSimplify{},
+	}}
+	repo, err := reference.ParseNormalizedNamed("app")
+	assert.NilError(t, err)
+	var refs []reference.NamedTagged
+	for _, tc := range []struct{ tag, id string }{{"1.0", "simplified"}, {"1.1", "full"}} {
+		ref, err := reference.WithTag(repo, tc.tag)
+		assert.NilError(t, err)
+		assert.NilError(t, store.AddTag(ref, digest.FromString(tc.id), false))
+		refs = append(refs, ref)
+	}
+	p.recordSavings(digest.FromString("simplified"), simplifySavings{selected: 2, files: 10, saved: 2048})
+
+	p.reportSimplified(refs)
+	assert.Check(t, is.DeepEqual(out.messages, []string{"1.0: Kept 2 of 10 files, saved 2.048kB", "1.1: Not simplified"}))
+}
+
+// imageConfigs stores image configurations in memory.
+type imageConfigs map[digest.Digest][]byte
+
+func (c imageConfigs) Put(config []byte) (digest.Digest, error) {
+	dgst := digest.FromBytes(config)
+	c[dgst] = config
+	return dgst, nil
+}
+
+func (c imageConfigs) Get(dgst digest.Digest) ([]byte, error) {
+	if config, ok := c[dgst]; ok {
+		return config, nil
+	}
+	return nil, errors.New("image config not found")
+}
+
+func (c imageConfigs) RootFSFromConfig(config []byte) (*image.RootFS, error) {
+	var unmarshalled struct {
+		RootFS *image.RootFS `json:"rootfs"`
+	}
+	err := json.Unmarshal(config, &unmarshalled)
+	return unmarshalled.RootFS, err
+}
+
+func (c imageConfigs) PlatformFromConfig(config []byte) (*specs.Platform, error) {
+	return &linuxAMD64, nil
+}
+
+// registeringDownloads downloads layers one after the other, registering
+// them by the digest of their uncompressed content as the layer store does.
+type registeringDownloads struct{}
+
+func (registeringDownloads) Download(ctx context.Context, initialRootFS image.RootFS, os string, layers []xfer.DownloadDescriptor, progressOutput progress.Output) (image.RootFS, func(), error) {
+	rootFS := initialRootFS
+	for _, d := range layers {
+		rc, _, err := d.Download(ctx, progressOutput)
+		if err != nil {
+			return image.RootFS{}, nil, err
+		}
+		r, err := archive.DecompressStream(rc)
+		if err != nil {
+			rc.Close()
+			return image.RootFS{}, nil, err
+		}
+		digester := digest.Canonical.Digester()
+		_, err = io.Copy(digester.Hash(), r)
+		r.Close()
+		rc.Close()
+		if err != nil {
+			return image.RootFS{}, nil, err
+		}
+		diffID := layer.DiffID(digester.Digest())
+		if withRegistered, ok := d.(xfer.DownloadDescriptorWithRegistered); ok {
+			withRegistered.Registered(diffID)
+		}
+		rootFS.Append(diffID)
+	}
+	return rootFS, func() {}, nil
+}
+
+func TestPullSchema2PartialDeterministic(t *testing.T) {
+	blob, tocDigest := testEStargzBlob(t, testEStargzEntries(), 1024, false)
+	gz, err := gzip.NewReader(bytes.NewReader(blob))
+	assert.NilError(t, err)
+	full, err := digest.Canonical.FromReader(gz)
+	assert.NilError(t, err)
+	// the configuration as served by a registry, indented
+	config := []byte(`{
+  "architecture": "amd64",
+  "os": "linux",
+  "created": "2023-04-12T08:24:31.123456789Z",
+  "config": {"Cmd": ["sh"]},
+  "rootfs": {"type": "layers", "diff_ids": ["` + full.String() + `"]}
+}`)
+	mfst := testEStargzImageManifest(t, blob, tocDigest, config)
+	named, err := reference.ParseNormalizedNamed("app")
+	assert.NilError(t, err)
+
+	// pull pulls the image with an empty store, keeping the files keep
+	pull := func(keep []string) (digest.Digest, []byte) {
+		root, err := ioutil.TempDir("", "simplify-pull")
+		assert.NilError(t, err)
+		defer os.RemoveAll(root)
+		store, err := metadata.NewFSMetadataStore(root)
+		assert.NilError(t, err)
+		configs := imageConfigs{}
+		p := &v2Puller{
+			V2MetadataService: metadata.NewV2MetadataService(store),
+			repo:              estargzRepo{blobs: map[digest.Digest][]byte{digest.FromBytes(blob): blob, digest.FromBytes(config): config}},
+			repoInfo:          &registry.RepositoryInfo{Name: named},
+			config: &ImagePullConfig{
+				Config:          Config{ProgressOutput: progress.DiscardOutput(), MetadataStore: store, ImageStore: configs},
+				DownloadManager: registeringDownloads{},
+				Simplify: &PullSimplify{
+					Keep: func(digest.Digest, specs.Platform, []byte) ([]string, error) {
+						return keep, nil
+					},
+					Pulled: func(id, full digest.Digest, layers []layer.DiffID, tocs []*layer.TOC, profile []byte) error {
+						return nil
+					},
+				},
+			},
+		}
+		id, ok, err := p.pullSchema2Partial(context.Background(), mfst, &linuxAMD64)
+		assert.NilError(t, err)
+		assert.Assert(t, ok)
+		return id, configs[id]
+	}
+
+	id, simplified := pull([]string{"/etc/app.conf", "/bin/dash"})
+	// the same files kept in another order give the same image
+	other, _ := pull([]string{"/bin/dash", "/etc/app.conf"})
+	assert.Check(t, is.Equal(other, id))
+
+	// the configuration is the original one, canonical, made of the layer
+	// holding the files kept
+	var fields map[string]json.RawMessage
+	assert.NilError(t, json.Unmarshal(simplified, &fields))
+	assert.Check(t, is.Equal(string(fields["created"]), `"2023-04-12T08:24:31.123456789Z"`))
+	assert.Check(t, is.Equal(string(fields["config"]), `{"Cmd":["sh"]}`))
+	assert.Check(t, !strings.Contains(string(fields["rootfs"]), full.String()))
+	rootFS, err := imageConfigs{}.RootFSFromConfig(simplified)
+	assert.NilError(t, err)
+	canonical, err := image.SimplifiedConfig(simplified, rootFS)
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(string(canonical), string(simplified)))
+
+	// other files kept give another image
+	other, _ = pull([]string{"/bin/dash"})
+	assert.Check(t, other != id)
+}
+
+// manifestRepo serves the manifest mfst, whatever the tag or digest.
+type manifestRepo struct {
+	estargzRepo
+	named reference.Named
+	mfst  distribution.Manifest
+}
+
+func (r manifestRepo) Named() reference.Named {
+	return r.named
+}
+
+func (r manifestRepo) Manifests(ctx context.Context, options ...distribution.ManifestServiceOption) (distribution.ManifestService, error) {
+	return manifestService{mfst: r.mfst}, nil
+}
+
+type manifestService struct {
+	distribution.ManifestService
+	mfst distribution.Manifest
+}
+
+func (s manifestService) Get(ctx context.Context, dgst digest.Digest, options ...distribution.ManifestServiceOption) (distribution.Manifest, error) {
+	return s.mfst, nil
+}
+
+func TestPullV2TagSimplifyVariants(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "pull-simplify")
+	assert.NilError(t, err)
+	defer os.RemoveAll(tmpDir)
+	store, err := refstore.NewReferenceStore(filepath.Join(tmpDir, "repositories.json"))
+	assert.NilError(t, err)
+
+	config := []byte(`{"architecture":"amd64","os":"linux","rootfs":{"type":"layers"}}`)
+	blob, _ := testEStargzBlob(t, testEStargzEntries(), 1024, false)
+	mfst := testEStargzImageManifest(t, blob, "", config)
+	_, payload, err := mfst.Payload()
+	assert.NilError(t, err)
+	named, err := reference.ParseNormalizedNamed("app")
+	assert.NilError(t, err)
+	canonical, err := reference.WithDigest(named, digest.FromBytes(payload))
+	assert.NilError(t, err)
+
+	// the digest was last pulled as a simplified image of the full image,
+	// which is local
+	full, simplified := digest.FromBytes(config), digest.FromString("simplified")
+	assert.NilError(t, store.AddDigest(canonical, simplified, false))
+	p := &v2Puller{
+		repo: manifestRepo{named: named, mfst: mfst},
+		config: &ImagePullConfig{
+			Config:       Config{ProgressOutput: progress.DiscardOutput(), ReferenceStore: store, ImageStore: imageConfigs{full: config}},
+			Schema2Types: ImageTypes,
+		},
+	}
+
+	// digest references are never overwritten
+	_, err = p.pullV2Tag(context.Background(), canonical, nil)
+	assert.Check(t, is.ErrorContains(err, "Cannot overwrite digest"))
+
+	// unless they move between the variants of an image
+	p.config.SimplifyVariants = func(a, b digest.Digest) bool {
+		return (a == full && b == simplified) || (a == simplified && b == full)
+	}
+	updated, err := p.pullV2Tag(context.Background(), canonical, nil)
+	assert.NilError(t, err)
+	assert.Check(t, updated)
+	id, err := store.Get(canonical)
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(id, full))
+}
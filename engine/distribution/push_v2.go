@@ -2,6 +2,7 @@ package distribution // import "github.com/docker/docker/distribution"
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -43,6 +44,10 @@ type v2Pusher struct {
 
 	// pushState is state built by the Upload functions.
 	pushState pushState
+
+	// 修改： 推送的profile，签名推送时一并签名
+	profile distribution.Descriptor
+	// 修改
 }
 
 type pushState struct {
@@ -151,6 +156,10 @@ func (p *v2Pusher) pushV2Tag(ctx context.Context, ref reference.NamedTagged, id
 		endpoint:          p.endpoint,
 		repo:              p.repo,
 		pushState:         &p.pushState,
+		// 修改： 推送可按文件下载的层
+		seekable: p.config.PushSimplifyTOC,
+		tocs:     tocStore{store: p.config.MetadataStore},
+		// 修改
 	}
 
 	// Loop bounds condition is to avoid pushing the base layer on Windows.
@@ -173,6 +182,15 @@ func (p *v2Pusher) pushV2Tag(ctx context.Context, ref reference.NamedTagged, id
 	if err != nil {
 		return err
 	}
+	// 修改： 精简镜像的manifest带有注解
+	annotations, err := p.manifestAnnotations(ctx, id, descriptors)
+	if err != nil {
+		return err
+	}
+	if manifest, err = annotateManifest(manifest.(*schema2.DeserializedManifest), annotations); err != nil {
+		return err
+	}
+	// 修改
 
 	manSvc, err := p.repo.Manifests(ctx)
 	if err != nil {
@@ -187,6 +205,11 @@ func (p *v2Pusher) pushV2Tag(ctx context.Context, ref reference.NamedTagged, id
 		}
 
 		logrus.Warnf("failed to upload schema2 manifest: %v - falling back to schema1", err)
+		// 修改
+		if len(annotations) > 0 {
+			logrus.Warnf("schema1 manifests have no annotations, %s is pushed without its simplify annotations", reference.FamiliarString(ref))
+		}
+		// 修改
 
 		manifestRef, err := reference.WithTag(p.repo.Named(), ref.Tag())
 		if err != nil {
@@ -224,11 +247,97 @@ func (p *v2Pusher) pushV2Tag(ctx context.Context, ref reference.NamedTagged, id
 
 	// Signal digest to the trust client so it can sign the
 	// push, if appropriate.
-	progress.Aux(p.config.ProgressOutput, apitypes.PushResult{Tag: ref.Tag(), Digest: manifestDigest.String(), Size: len(canonicalManifest)})
+	// 修改： 随镜像推送的profile也由客户端签名
+	result := apitypes.PushResult{Tag: ref.Tag(), Digest: manifestDigest.String(), Size: len(canonicalManifest)}
+	if _, ok := manifest.(*schema2.DeserializedManifest); ok && p.profile.Digest != "" {
+		result.SimplifyProfile = p.profile.Digest.String()
+		result.SimplifyProfileSize = p.profile.Size
+	}
+	progress.Aux(p.config.ProgressOutput, result)
+	// 修改
 
 	return nil
 }
 
+// 修改： 推送精简镜像的profile和层目录
+
+// manifestAnnotations returns the annotations of the manifest of the image
+// id, pushing the blobs they refer to.
+func (p *v2Pusher) manifestAnnotations(ctx context.Context, id digest.Digest, descriptors []xfer.UploadDescriptor) (map[string]string, error) {
+	annotations := make(map[string]string)
+	simplified, err := p.pushSimplify(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if simplified != nil {
+		for k, v := range simplified.Annotations {
+			annotations[k] = v
+		}
+	}
+	if p.config.PushSimplifyTOC {
+		dgst, err := p.pushSimplifyTOC(ctx, descriptors)
+		if err != nil {
+			return nil, err
+		}
+		if dgst != "" {
+			annotations[AnnotationSimplifyTOC] = dgst.String()
+		}
+	}
+	return annotations, nil
+}
+
+// pushSimplifyTOC pushes the tables of contents of the layers of descriptors
+// and returns the digest of the blob, or "" if some layer is not seekable.
+func (p *v2Pusher) pushSimplifyTOC(ctx context.Context, descriptors []xfer.UploadDescriptor) (digest.Digest, error) {
+	tocs := ImageTOC{Layers: make(map[digest.Digest]*TOC)}
+	store := tocStore{store: p.config.MetadataStore}
+	for _, d := range descriptors {
+		desc := d.(*v2PushDescriptor).Descriptor()
+		toc, err := store.get(desc.Digest)
+		if err != nil {
+			// 外部层或已压缩的层无法按文件下载
+			progress.Messagef(p.config.ProgressOutput, "", "Warning: layer %s is not seekable, no table of contents is pushed", desc.Digest)
+			return "", nil
+		}
+		tocs.Layers[desc.Digest] = toc
+	}
+	b, err := json.Marshal(&tocs)
+	if err != nil {
+		return "", err
+	}
+	desc, err := p.repo.Blobs(ctx).Put(ctx, MediaTypeSimplifyTOC, b)
+	if err != nil {
+		return "", fmt.Errorf("failed to push simplify table of contents: %v", err)
+	}
+	progress.Messagef(p.config.ProgressOutput, "", "Pushed simplify table of contents %s", desc.Digest)
+	return desc.Digest, nil
+}
+
+// pushSimplify returns what to push along with the image id, or nil if it is
+// not a simplified image. The profile of the image is pushed as a blob if
+// requested.
+func (p *v2Pusher) pushSimplify(ctx context.Context, id digest.Digest) (*SimplifyPush, error) {
+	p.profile = distribution.Descriptor{}
+	if p.config.Simplified == nil {
+		return nil, nil
+	}
+	simplified, err := p.config.Simplified(id)
+	if err != nil || simplified == nil {
+		return nil, err
+	}
+	if p.config.PushSimplifyProfile && simplified.Profile != nil {
+		desc, err := p.repo.Blobs(ctx).Put(ctx, MediaTypeSimplifyProfile, simplified.Profile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to push simplify profile: %v", err)
+		}
+		progress.Messagef(p.config.ProgressOutput, "", "Pushed simplify profile %s", desc.Digest)
+		p.profile = desc
+	}
+	return simplified, nil
+}
+
+// 修改
+
 func manifestFromBuilder(ctx context.Context, builder distribution.ManifestBuilder, descriptors []xfer.UploadDescriptor) (distribution.Manifest, error) {
 	// descriptors is in reverse order; iterate backwards to get references
 	// appended in the right order.
@@ -253,6 +362,10 @@ type v2PushDescriptor struct {
 	remoteDescriptor  distribution.Descriptor
 	// a set of digests whose presence has been checked in a target repository
 	checkedDigests map[digest.Digest]struct{}
+	// 修改： 推送可按文件下载的层
+	seekable bool
+	tocs     tocStore
+	// 修改
 }
 
 func (pd *v2PushDescriptor) Key() string {
@@ -290,6 +403,12 @@ func (pd *v2PushDescriptor) Upload(ctx context.Context, progressOutput progress.
 	}
 	pd.pushState.Unlock()
 
+	// 修改： 推送可按文件下载的层
+	if pd.seekable && pd.layer.MediaType() == schema2.MediaTypeUncompressedLayer {
+		return pd.uploadSeekable(ctx, progressOutput, diffID)
+	}
+	// 修改
+
 	maxMountAttempts, maxExistenceChecks, checkOtherRepositories := getMaxMountAndExistenceCheckAttempts(pd.layer)
 
 	// Do we have any metadata associated with this layer's DiffID?
@@ -420,6 +539,37 @@ func (pd *v2PushDescriptor) Upload(ctx context.Context, progressOutput progress.
 	return pd.uploadUsingSession(ctx, progressOutput, diffID, layerUpload)
 }
 
+// 修改： 推送可按文件下载的层
+
+// uploadSeekable pushes the layer as a seekable blob, unless the registry
+// already has one of it. Blobs of the layer without a table of contents are
+// not reused, nor mounted from other repositories.
+func (pd *v2PushDescriptor) uploadSeekable(ctx context.Context, progressOutput progress.Output, diffID layer.DiffID) (distribution.Descriptor, error) {
+	v2Metadata, _ := pd.v2MetadataService.GetMetadata(diffID)
+	var seekable []metadata.V2Metadata
+	for _, meta := range v2Metadata {
+		if _, err := pd.tocs.get(meta.Digest); err == nil {
+			seekable = append(seekable, meta)
+		}
+	}
+	if len(seekable) > 0 {
+		descriptor, exists, err := pd.layerAlreadyExists(ctx, progressOutput, diffID, false, len(seekable), seekable)
+		if exists || err != nil {
+			return descriptor, err
+		}
+	}
+
+	logrus.Debugf("Pushing seekable layer: %s", diffID)
+	layerUpload, err := pd.repo.Blobs(ctx).Create(ctx)
+	if err != nil {
+		return distribution.Descriptor{}, retryOnError(err)
+	}
+	defer layerUpload.Close()
+	return pd.uploadUsingSession(ctx, progressOutput, diffID, layerUpload)
+}
+
+// 修改
+
 func (pd *v2PushDescriptor) SetRemoteDescriptor(descriptor distribution.Descriptor) {
 	pd.remoteDescriptor = descriptor
 }
@@ -445,9 +595,22 @@ func (pd *v2PushDescriptor) uploadUsingSession(
 
 	reader = progress.NewProgressReader(ioutils.NewCancelReadCloser(ctx, contentReader), progressOutput, size, pd.ID(), "Pushing")
 
+	// 修改： 可按文件下载的层逐个条目压缩
+	var toc *TOC
+	// 修改
 	switch m := pd.layer.MediaType(); m {
 	case schema2.MediaTypeUncompressedLayer:
-		compressedReader, compressionDone := compress(reader)
+		// 修改
+		var (
+			compressedReader io.ReadCloser
+			compressionDone  chan struct{}
+		)
+		if pd.seekable {
+			compressedReader, compressionDone, toc = compressSeekable(reader)
+		} else {
+			compressedReader, compressionDone = compress(reader)
+		}
+		// 修改
 		defer func(closer io.Closer) {
 			closer.Close()
 			<-compressionDone
@@ -473,6 +636,14 @@ func (pd *v2PushDescriptor) uploadUsingSession(
 		return distribution.Descriptor{}, retryOnError(err)
 	}
 
+	// 修改： 缓存层的目录
+	if toc != nil {
+		if err := pd.tocs.set(pushDigest, toc); err != nil {
+			return distribution.Descriptor{}, xfer.DoNotRetry{Err: err}
+		}
+	}
+	// 修改
+
 	logrus.Debugf("uploaded layer %s (%s), %d bytes", diffID, pushDigest, nn)
 	progress.Update(progressOutput, pd.ID(), "Pushed")
 
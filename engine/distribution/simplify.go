@@ -0,0 +1,142 @@
+package distribution // import "github.com/docker/docker/distribution"
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/docker/layer"
+	"github.com/opencontainers/go-digest"
+	specs "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// 修改： 精简镜像的manifest注解
+
+// Annotations added to the manifest of a simplified image when it is pushed.
+const (
+	// AnnotationSimplified is "true" for images missing files of the full
+	// image they were derived from.
+	AnnotationSimplified = "io.simplify.image.simplified"
+	// AnnotationSimplifyFullImage is the ID of the full image.
+	AnnotationSimplifyFullImage = "io.simplify.image.full"
+	// AnnotationSimplifyFullManifest is a canonical reference to the
+	// manifest of the full image, if it was pulled by one.
+	AnnotationSimplifyFullManifest = "io.simplify.image.full.manifest"
+	// AnnotationSimplifyProfile is the digest of the profile the image was
+	// simplified with.
+	AnnotationSimplifyProfile = "io.simplify.image.profile"
+	// AnnotationSimplifyTOC is the digest of the tables of contents of the
+	// seekable layers of the image.
+	AnnotationSimplifyTOC = "io.simplify.image.toc"
+)
+
+// MediaTypeSimplifyProfile is the media type of the profile blob pushed along
+// with a simplified image.
+const MediaTypeSimplifyProfile = "application/vnd.simplify.profile.v1+json"
+
+// SimplifyPush holds what is pushed along with a simplified image.
+type SimplifyPush struct {
+	// Annotations are added to the manifest of the image.
+	Annotations map[string]string
+	// Profile is the profile the image was simplified with, pushed as a
+	// blob if ImagePushConfig.PushSimplifyProfile is set.
+	Profile []byte
+}
+
+// PullSimplify selects the files pulled from images with seekable layers.
+type PullSimplify struct {
+	// Keep returns the absolute paths of the files to pull of the image id
+	// for platform, or nil to pull the whole image. profile is the profile
+	// pushed along with the image, if any. It returns a ProfilePlatformError
+	// if the image only has profiles recorded on other platforms.
+	Keep func(id digest.Digest, platform specs.Platform, profile []byte) ([]string, error)
+	// Pulled is called once the files of the image full have been pulled as
+	// the image id. layers are the diff IDs of full and tocs the tables of
+	// contents of its layers.
+	Pulled func(id, full digest.Digest, layers []layer.DiffID, tocs []*layer.TOC, profile []byte) error
+	// OpenLayer returns the uncompressed tar stream of the topmost layer of
+	// the chain diffIDs if the layer store for os has it, so that images
+	// whose layers are all local are simplified without pulling them.
+	OpenLayer func(os string, diffIDs []layer.DiffID) (io.ReadCloser, error)
+	// Required fails the pull of images without a profile instead of
+	// pulling them in full.
+	Required bool
+	// Trusted only uses a profile pushed along with an image if its digest is
+	// SignedProfile, the profile signed with content trust, failing the pull
+	// otherwise. Profiles pushed along with images are used with a warning
+	// if it is not set.
+	Trusted       bool
+	SignedProfile digest.Digest
+	// MaxProfileSize is the size, in bytes, above which a profile pushed
+	// along with an image is rejected instead of pulled. 0 means unlimited.
+	MaxProfileSize int64
+	// RangeRoot is the directory the ranges of layer blobs downloaded are
+	// kept in until the layers are registered, so that a pull interrupted,
+	// even by a daemon restart, resumes where it left off. They are not kept
+	// if it is empty.
+	RangeRoot string
+}
+
+// ProfilePlatformError is returned by PullSimplify.Keep when the profiles of
+// an image were all recorded on other platforms than the one pulled.
+type ProfilePlatformError struct {
+	// Platform is the platform pulled.
+	Platform string
+	// Recorded are the platforms the profiles were recorded on.
+	Recorded []string
+}
+
+func (e ProfilePlatformError) Error() string {
+	return fmt.Sprintf("simplification profile recorded on %s, not %s", strings.Join(e.Recorded, ", "), e.Platform)
+}
+
+// annotatedManifest is a schema2 manifest with OCI-style annotations, which
+// registries store as is.
+type annotatedManifest struct {
+	schema2.Manifest
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// annotateManifest returns m with annotations added.
+func annotateManifest(m *schema2.DeserializedManifest, annotations map[string]string) (*schema2.DeserializedManifest, error) {
+	if len(annotations) == 0 {
+		return m, nil
+	}
+	b, err := json.MarshalIndent(&annotatedManifest{Manifest: m.Manifest, Annotations: annotations}, "", "   ")
+	if err != nil {
+		return nil, err
+	}
+	var annotated schema2.DeserializedManifest
+	if err := annotated.UnmarshalJSON(b); err != nil {
+		return nil, err
+	}
+	return &annotated, nil
+}
+
+// simplifyAnnotations returns the simplify annotations of m, or nil if it
+// has none.
+func simplifyAnnotations(m *schema2.DeserializedManifest) map[string]string {
+	_, payload, err := m.Payload()
+	if err != nil {
+		return nil
+	}
+	var annotated annotatedManifest
+	if err := json.Unmarshal(payload, &annotated); err != nil {
+		return nil
+	}
+	var annotations map[string]string
+	for k, v := range annotated.Annotations {
+		if !strings.HasPrefix(k, "io.simplify.image.") {
+			continue
+		}
+		if annotations == nil {
+			annotations = make(map[string]string)
+		}
+		annotations[k] = v
+	}
+	return annotations
+}
+
+// 修改
@@ -0,0 +1,48 @@
+package distribution // import "github.com/docker/docker/distribution"
+
+import (
+	"testing"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/opencontainers/go-digest"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+func TestAnnotateManifest(t *testing.T) {
+	m, err := schema2.FromStruct(schema2.Manifest{
+		Versioned: schema2.SchemaVersion,
+		Config:    distribution.Descriptor{MediaType: schema2.MediaTypeImageConfig, Digest: digest.FromString("config"), Size: 6},
+		Layers:    []distribution.Descriptor{{MediaType: schema2.MediaTypeLayer, Digest: digest.FromString("layer"), Size: 5}},
+	})
+	assert.NilError(t, err)
+	assert.Check(t, is.Nil(simplifyAnnotations(m)))
+
+	annotations := map[string]string{
+		AnnotationSimplified:        "true",
+		AnnotationSimplifyFullImage: digest.FromString("full").String(),
+	}
+	annotated, err := annotateManifest(m, annotations)
+	assert.NilError(t, err)
+	assert.Check(t, is.DeepEqual(annotated.Manifest, m.Manifest))
+	assert.Check(t, is.DeepEqual(simplifyAnnotations(annotated), annotations))
+
+	// the annotations are part of the payload, and so of the digest
+	mediaType, payload, err := annotated.Payload()
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(mediaType, schema2.MediaTypeManifest))
+	u, _, err := distribution.UnmarshalManifest(schema2.MediaTypeManifest, payload)
+	assert.NilError(t, err)
+	assert.Check(t, is.DeepEqual(simplifyAnnotations(u.(*schema2.DeserializedManifest)), annotations))
+}
+
+func TestSimplifyAnnotationsIgnoresOthers(t *testing.T) {
+	var m schema2.DeserializedManifest
+	assert.NilError(t, m.UnmarshalJSON([]byte(`{
+		"schemaVersion": 2,
+		"mediaType": "application/vnd.docker.distribution.manifest.v2+json",
+		"annotations": {"org.opencontainers.image.created": "2019-01-01T00:00:00Z", "io.simplify.image.profile": "sha256:0123"}
+	}`)))
+	assert.Check(t, is.DeepEqual(simplifyAnnotations(&m), map[string]string{AnnotationSimplifyProfile: "sha256:0123"}))
+}
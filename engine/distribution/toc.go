@@ -0,0 +1,509 @@
+package distribution // import "github.com/docker/docker/distribution"
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/docker/docker/distribution/metadata"
+	"github.com/docker/docker/errdefs"
+	"github.com/docker/docker/layer"
+	"github.com/docker/docker/pkg/archive"
+	"github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
+)
+
+// 修改： 可按文件下载的层
+
+// MediaTypeSimplifyTOC is the media type of the blob holding the tables of
+// contents of the layers of an image.
+const MediaTypeSimplifyTOC = "application/vnd.simplify.toc.v1+json"
+
+// tocNamespace is the namespace of the metadata store the tables of contents
+// of seekable layer blobs are cached in.
+const tocNamespace = "simplify-toc"
+
+// maxKeepSymlinks bounds the symlinks followed while resolving a file kept,
+// as the kernel bounds those followed while resolving a path.
+const maxKeepSymlinks = 40
+
+// tocMaxGap is the largest gap between two entries read by skipping over it
+// rather than with a new range request.
+const tocMaxGap = 64 * 1024
+
+// TOC is the table of contents of a seekable layer blob, where each entry of
+// the layer tar stream is compressed as a gzip member of its own.
+type TOC struct {
+	layer.TOC
+	// Members locate the gzip members of the entries in the blob, followed
+	// by the member of the end of the archive.
+	Members []TOCMember `json:"members"`
+}
+
+// TOCMember locates a gzip member in a seekable layer blob.
+type TOCMember struct {
+	Offset int64         `json:"offset"`
+	Size   int64         `json:"size"`
+	Digest digest.Digest `json:"digest"`
+}
+
+// ImageTOC is the blob pushed along with an image whose layers are seekable.
+type ImageTOC struct {
+	// Layers maps the digests of the layer blobs to their table of contents.
+	Layers map[digest.Digest]*TOC
+}
+
+// valid returns true if toc has a member for each of its entries.
+func (toc *TOC) valid() bool {
+	return len(toc.Members) == len(toc.Entries)+1
+}
+
+// selectEntries returns which members of toc are needed to extract the files
+// in keep, as selected by selectLayerEntries, along with the end of the
+// archive.
+func (toc *TOC) selectEntries(keep map[string]struct{}) []bool {
+	return append(selectLayerEntries(toc.Entries, keep), true)
+}
+
+// selectLayerEntries returns which entries of a layer are needed to extract
+// the files in keep, which are absolute paths: the kept regular files, empty
+// files, whiteouts and every entry that is not a regular file. Hard links are
+// only kept along with their target.
+func selectLayerEntries(entries []layer.TOCEntry, keep map[string]struct{}) []bool {
+	selected := make([]bool, len(entries))
+	regular := make(map[string]int)
+	for n, e := range entries {
+		name := path.Clean("/" + e.Name)
+		switch {
+		case e.Type == tar.TypeReg || e.Type == tar.TypeRegA:
+			regular[name] = n
+			_, kept := keep[name]
+			selected[n] = kept || e.Size == 0 || e.IsWhiteout()
+		case e.Type != tar.TypeLink:
+			selected[n] = true
+		}
+	}
+	// 硬链接需要其目标文件
+	for _, e := range entries {
+		if e.Type != tar.TypeLink {
+			continue
+		}
+		if _, kept := keep[path.Clean("/"+e.Name)]; !kept {
+			continue
+		}
+		if target, ok := regular[path.Clean("/"+e.Linkname)]; ok {
+			selected[target] = true
+		}
+	}
+	for n, e := range entries {
+		if e.Type != tar.TypeLink {
+			continue
+		}
+		target, ok := regular[path.Clean("/"+e.Linkname)]
+		selected[n] = ok && selected[target]
+	}
+	return selected
+}
+
+// checkKeep rejects the paths of keep, the files kept of the image made of
+// the layers of tocs, bottom first, which cannot be in the image: those under
+// a top-level directory no layer has, or under a file other than a directory
+// or a symlink. The files the containers a profile was recorded in created
+// are not in the layers, so only the top-level directory of a path must be.
+func checkKeep(keep []string, tocs []*layer.TOC) error {
+	top := make(map[string]bool)
+	files := make(map[string]bool)
+	for _, toc := range tocs {
+		for _, e := range toc.Entries {
+			name := path.Clean("/" + e.Name)
+			if name == "/" {
+				continue
+			}
+			base := path.Base(name)
+			if strings.HasPrefix(base, archive.WhiteoutPrefix) {
+				delete(files, path.Join(path.Dir(name), strings.TrimPrefix(base, archive.WhiteoutPrefix)))
+				continue
+			}
+			top[strings.SplitN(name[1:], "/", 2)[0]] = true
+			files[name] = e.Type != tar.TypeDir && e.Type != tar.TypeSymlink
+		}
+	}
+	for _, p := range keep {
+		clean := path.Clean("/" + p)
+		if clean == "/" {
+			continue
+		}
+		if !top[strings.SplitN(clean[1:], "/", 2)[0]] {
+			return errdefs.InvalidParameter(errors.Errorf("invalid simplify profile entry %q: not in the image", p))
+		}
+		for dir := path.Dir(clean); dir != "/"; dir = path.Dir(dir) {
+			if files[dir] {
+				return errdefs.InvalidParameter(errors.Errorf("invalid simplify profile entry %q: %s is not a directory", p, dir))
+			}
+		}
+	}
+	return nil
+}
+
+// followLinks returns keep, the files kept of the image made of the layers
+// of tocs, bottom first, along with the symlinks they are reached through
+// and the files these point to, following chains of symlinks across the
+// layers. The paths added are absolute, and the result sorted. keep is
+// returned as is if no symlink leads to its files.
+func followLinks(keep []string, tocs []*layer.TOC) []string {
+	symlinks := visibleSymlinks(tocs)
+	if len(symlinks) == 0 {
+		return keep
+	}
+	keepSet := keepPaths(keep)
+	for _, p := range keep {
+		resolveKeep(symlinks, p, keepSet)
+	}
+	if len(keepSet) == len(keep) {
+		return keep
+	}
+	followed := make([]string, 0, len(keepSet))
+	for p := range keepSet {
+		followed = append(followed, p)
+	}
+	sort.Strings(followed)
+	return followed
+}
+
+// visibleSymlinks returns the targets of the symlinks of the image made of
+// the layers of tocs, bottom first, by absolute path, but those deleted or
+// replaced in upper layers.
+func visibleSymlinks(tocs []*layer.TOC) map[string]string {
+	symlinks := make(map[string]string)
+	for _, toc := range tocs {
+		// whiteout只遮住更下面的层，本层的条目最后再加入
+		added := make(map[string]string)
+		var removed []string
+		for _, e := range toc.Entries {
+			name := path.Clean("/" + e.Name)
+			base := path.Base(name)
+			switch {
+			case base == archive.WhiteoutOpaqueDir:
+				removed = append(removed, path.Dir(name)+"/")
+			case strings.HasPrefix(base, archive.WhiteoutPrefix):
+				p := path.Join(path.Dir(name), strings.TrimPrefix(base, archive.WhiteoutPrefix))
+				delete(symlinks, p)
+				removed = append(removed, p+"/")
+			case e.Type == tar.TypeSymlink:
+				added[name] = e.Linkname
+			default:
+				// 替换符号链接的文件或目录
+				delete(symlinks, name)
+			}
+		}
+		for _, dir := range removed {
+			for name := range symlinks {
+				if strings.HasPrefix(name, dir) {
+					delete(symlinks, name)
+				}
+			}
+		}
+		for name, target := range added {
+			symlinks[name] = target
+		}
+	}
+	return symlinks
+}
+
+// resolveKeep adds the symlinks p is reached through, and the path it
+// resolves to, to keep.
+func resolveKeep(symlinks map[string]string, p string, keep map[string]struct{}) {
+	for n := 0; n <= maxKeepSymlinks; n++ {
+		parts := strings.Split(strings.TrimPrefix(path.Clean("/"+p), "/"), "/")
+		resolved := "/"
+		followed := false
+		for i, part := range parts {
+			cur := path.Join(resolved, part)
+			target, ok := symlinks[cur]
+			if !ok {
+				resolved = cur
+				continue
+			}
+			keep[cur] = struct{}{}
+			if !path.IsAbs(target) {
+				target = path.Join(resolved, target)
+			}
+			p = path.Join(append([]string{target}, parts[i+1:]...)...)
+			followed = true
+			break
+		}
+		if !followed {
+			keep[resolved] = struct{}{}
+			return
+		}
+	}
+}
+
+// selectedSize returns the number of bytes of the blob holding the members
+// selected.
+func (toc *TOC) selectedSize(selected []bool) int64 {
+	var size int64
+	for n, e := range toc.Members {
+		if selected[n] {
+			size += e.Size
+		}
+	}
+	return size
+}
+
+// fetchEntries writes the tar stream made of the members of toc selected to
+// w, reading their gzip members from the seekable layer blob r, or from
+// ranges if they were downloaded before. Small gaps between them are read
+// through rather than sought over. It returns the number of bytes read from
+// r.
+func fetchEntries(ctx context.Context, w io.Writer, r io.ReadSeeker, toc *TOC, selected []bool, ranges *blobRanges) (int64, error) {
+	var (
+		pos     int64
+		fetched int64
+		gz      *gzip.Reader
+	)
+	for n, e := range toc.Members {
+		if !selected[n] {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return fetched, err
+		}
+
+		// 之前下载并校验过的成员不再下载
+		var (
+			src      io.Reader
+			recorder *rangeWriter
+		)
+		stored := ranges.open(e.Offset, func(r io.Reader) error {
+			return verifyMember(r, e)
+		})
+		if stored != nil {
+			src = io.LimitReader(stored, e.Size)
+		} else {
+			if gap := e.Offset - pos; gap < 0 || gap > tocMaxGap {
+				if _, err := r.Seek(e.Offset, io.SeekStart); err != nil {
+					return fetched, err
+				}
+			} else if gap > 0 {
+				m, err := io.CopyN(ioutil.Discard, r, gap)
+				fetched += m
+				if err != nil {
+					return fetched, err
+				}
+			}
+			pos = e.Offset + e.Size
+			src, recorder = ranges.record(io.LimitReader(r, e.Size), e.Offset)
+		}
+
+		verifier := e.Digest.Verifier()
+		member := &countingReader{r: io.TeeReader(src, verifier)}
+		var err error
+		if gz == nil {
+			gz, err = gzip.NewReader(member)
+		} else {
+			err = gz.Reset(member)
+		}
+		if err == nil {
+			gz.Multistream(false)
+			_, err = io.Copy(w, gz)
+		}
+		if err == nil {
+			_, err = io.Copy(ioutil.Discard, member)
+		}
+		if stored != nil {
+			stored.Close()
+		} else {
+			fetched += member.n
+		}
+		recorder.done(err == nil && verifier.Verified())
+		if err != nil {
+			return fetched, err
+		}
+		if !verifier.Verified() {
+			return fetched, errors.Errorf("verification failed for member %d of the layer", n)
+		}
+	}
+	return fetched, nil
+}
+
+// verifyMember checks that r holds the gzip member e.
+func verifyMember(r io.Reader, e TOCMember) error {
+	verifier := e.Digest.Verifier()
+	if n, err := io.Copy(verifier, r); err != nil {
+		return err
+	} else if n != e.Size || !verifier.Verified() {
+		return errors.New("range does not match its digest")
+	}
+	return nil
+}
+
+// compressSeekable is like compress, compressing every entry of the tar
+// stream in as a gzip member of its own. The result decompresses to in, and
+// toc locates the entries in it once compressionDone is closed.
+func compressSeekable(in io.Reader) (compressed io.ReadCloser, compressionDone chan struct{}, toc *TOC) {
+	compressionDone = make(chan struct{})
+	toc = &TOC{}
+
+	pipeReader, pipeWriter := io.Pipe()
+	bufWriter := bufio.NewWriterSize(pipeWriter, compressionBufSize)
+
+	go func() {
+		err := writeSeekable(bufWriter, in, toc)
+		if err == nil {
+			err = bufWriter.Flush()
+		}
+		if err != nil {
+			pipeWriter.CloseWithError(err)
+		} else {
+			pipeWriter.Close()
+		}
+		close(compressionDone)
+	}()
+
+	return pipeReader, compressionDone, toc
+}
+
+// writeSeekable writes the tar stream in to w with every entry compressed as
+// a gzip member of its own, recording them in toc.
+func writeSeekable(w io.Writer, in io.Reader, toc *TOC) error {
+	tw := &tocWriter{out: &countingWriter{w: w}, toc: toc, end: -1, digester: digest.Canonical.Digester()}
+	tw.gz = gzip.NewWriter(io.MultiWriter(tw.out, tw.digester.Hash()))
+	layerTOC, err := layer.BuildTOC(io.TeeReader(in, tw), func(_ *layer.TOCEntry, end int64) error {
+		return tw.setEnd(end)
+	})
+	if err != nil {
+		return err
+	}
+	if err := tw.endMember(); err != nil {
+		return err
+	}
+	toc.TOC = *layerTOC
+	return nil
+}
+
+// tocWriter compresses the tar stream written to it, starting a new gzip
+// member at the end of every entry.
+type tocWriter struct {
+	out      *countingWriter
+	gz       *gzip.Writer
+	digester digest.Digester
+	toc      *TOC
+	// pos is the number of bytes of the tar stream written, start the
+	// position of the current member in out, and end the position of the end
+	// of the current entry in the tar stream, or -1 if it is not known yet.
+	pos, start, end int64
+}
+
+func (w *tocWriter) Write(p []byte) (int, error) {
+	n := 0
+	for len(p) > 0 {
+		chunk := p
+		if w.end >= 0 && w.pos+int64(len(chunk)) > w.end {
+			chunk = p[:w.end-w.pos]
+		}
+		if _, err := w.gz.Write(chunk); err != nil {
+			return n, err
+		}
+		w.pos += int64(len(chunk))
+		n += len(chunk)
+		p = p[len(chunk):]
+		if w.pos == w.end {
+			if err := w.endMember(); err != nil {
+				return n, err
+			}
+		}
+	}
+	return n, nil
+}
+
+// setEnd is called once the header of an entry has been written with the
+// position of the end of the entry.
+func (w *tocWriter) setEnd(end int64) error {
+	w.end = end
+	if w.pos == w.end {
+		return w.endMember()
+	}
+	return nil
+}
+
+// endMember ends the current gzip member.
+func (w *tocWriter) endMember() error {
+	if err := w.gz.Close(); err != nil {
+		return err
+	}
+	w.toc.Members = append(w.toc.Members, TOCMember{Offset: w.start, Size: w.out.n - w.start, Digest: w.digester.Digest()})
+
+	w.start = w.out.n
+	w.end = -1
+	w.digester = digest.Canonical.Digester()
+	w.gz.Reset(io.MultiWriter(w.out, w.digester.Hash()))
+	return nil
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+// seekableTOC returns the table of contents of the layer blob dgst cached in
+// store, or nil if the blob is not known to be seekable.
+func seekableTOC(store metadata.Store, dgst digest.Digest) *TOC {
+	toc, err := tocStore{store: store}.get(dgst)
+	if err != nil || !toc.valid() {
+		return nil
+	}
+	return toc
+}
+
+// tocStore caches the tables of contents of seekable layer blobs in the
+// distribution metadata store, by blob digest.
+type tocStore struct {
+	store metadata.Store
+}
+
+func (s tocStore) get(dgst digest.Digest) (*TOC, error) {
+	b, err := s.store.Get(tocNamespace, dgst.Hex())
+	if err != nil {
+		return nil, err
+	}
+	var toc TOC
+	if err := json.Unmarshal(b, &toc); err != nil {
+		return nil, err
+	}
+	return &toc, nil
+}
+
+func (s tocStore) set(dgst digest.Digest, toc *TOC) error {
+	b, err := json.Marshal(toc)
+	if err != nil {
+		return err
+	}
+	return s.store.Set(tocNamespace, dgst.Hex(), b)
+}
+
+// 修改
@@ -0,0 +1,220 @@
+package distribution // import "github.com/docker/docker/distribution"
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/errdefs"
+	"github.com/docker/docker/layer"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+func testLayerTar(t *testing.T) []byte {
+	// large enough not to be read through when skipped
+	ls := make([]byte, 2*tocMaxGap)
+	rand.New(rand.NewSource(1)).Read(ls)
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, e := range []struct {
+		hdr     tar.Header
+		content string
+	}{
+		{hdr: tar.Header{Name: "bin/", Typeflag: tar.TypeDir, Mode: 0755}},
+		{hdr: tar.Header{Name: "bin/sh", Typeflag: tar.TypeReg, Mode: 0755}, content: strings.Repeat("sh", 1000)},
+		{hdr: tar.Header{Name: "bin/ls", Typeflag: tar.TypeReg, Mode: 0755}, content: string(ls)},
+		{hdr: tar.Header{Name: "bin/dash", Typeflag: tar.TypeLink, Linkname: "bin/sh"}},
+		{hdr: tar.Header{Name: "bin/dir", Typeflag: tar.TypeLink, Linkname: "bin/ls"}},
+		{hdr: tar.Header{Name: "bin/bash", Typeflag: tar.TypeSymlink, Linkname: "sh"}},
+		{hdr: tar.Header{Name: "etc/empty", Typeflag: tar.TypeReg, Mode: 0644}},
+		{hdr: tar.Header{Name: "etc/.wh.old", Typeflag: tar.TypeReg, Mode: 0644}},
+		{hdr: tar.Header{Name: "etc/app.conf", Typeflag: tar.TypeReg, Mode: 0644}, content: "debug = true\n"},
+	} {
+		e.hdr.Size = int64(len(e.content))
+		assert.NilError(t, tw.WriteHeader(&e.hdr))
+		_, err := tw.Write([]byte(e.content))
+		assert.NilError(t, err)
+	}
+	assert.NilError(t, tw.Close())
+	return buf.Bytes()
+}
+
+func tarNames(t *testing.T, b []byte) []string {
+	var names []string
+	tr := tar.NewReader(bytes.NewReader(b))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return names
+		}
+		assert.NilError(t, err)
+		names = append(names, hdr.Name)
+	}
+}
+
+func TestCompressSeekable(t *testing.T) {
+	layer := testLayerTar(t)
+	compressed, compressionDone, toc := compressSeekable(bytes.NewReader(layer))
+	blob, err := ioutil.ReadAll(compressed)
+	assert.NilError(t, err)
+	<-compressionDone
+
+	// the blob decompresses to the same tar stream, so the diff ID is kept
+	gz, err := gzip.NewReader(bytes.NewReader(blob))
+	assert.NilError(t, err)
+	decompressed, err := ioutil.ReadAll(gz)
+	assert.NilError(t, err)
+	assert.Check(t, bytes.Equal(decompressed, layer))
+
+	var names []string
+	for _, e := range toc.Entries {
+		names = append(names, e.Name)
+	}
+	assert.Check(t, is.DeepEqual(names, []string{"bin/", "bin/sh", "bin/ls", "bin/dash", "bin/dir", "bin/bash", "etc/empty", "etc/.wh.old", "etc/app.conf"}))
+	assert.Check(t, is.Equal(toc.FileSize(), int64(2000+2*tocMaxGap+13)))
+	assert.Assert(t, toc.valid())
+
+	// every member decompresses to its entry
+	var offset int64
+	for n, m := range toc.Members {
+		assert.Check(t, is.Equal(m.Offset, offset))
+		offset += m.Size
+		gz, err := gzip.NewReader(bytes.NewReader(blob[m.Offset : m.Offset+m.Size]))
+		assert.NilError(t, err)
+		b, err := ioutil.ReadAll(gz)
+		assert.NilError(t, err)
+		end := toc.End
+		if n < len(toc.Entries) {
+			if n+1 < len(toc.Entries) {
+				end = toc.Entries[n+1].Offset
+			}
+			assert.Check(t, bytes.Equal(b, layer[toc.Entries[n].Offset:end]))
+		} else {
+			assert.Check(t, bytes.Equal(b, layer[toc.End:]))
+		}
+	}
+	assert.Check(t, is.Equal(offset, int64(len(blob))))
+}
+
+func TestFetchEntries(t *testing.T) {
+	compressed, compressionDone, toc := compressSeekable(bytes.NewReader(testLayerTar(t)))
+	blob, err := ioutil.ReadAll(compressed)
+	assert.NilError(t, err)
+	<-compressionDone
+
+	for _, tc := range []struct {
+		keep     []string
+		expected []string
+	}{
+		{
+			keep:     nil,
+			expected: []string{"bin/", "bin/bash", "etc/empty", "etc/.wh.old"},
+		},
+		{
+			keep:     []string{"/etc/app.conf", "/bin/sh"},
+			expected: []string{"bin/", "bin/sh", "bin/dash", "bin/bash", "etc/empty", "etc/.wh.old", "etc/app.conf"},
+		},
+		{
+			// the target of a kept hard link is kept along with it
+			keep:     []string{"/bin/dir"},
+			expected: []string{"bin/", "bin/ls", "bin/dir", "bin/bash", "etc/empty", "etc/.wh.old"},
+		},
+	} {
+		keep := make(map[string]struct{})
+		for _, p := range tc.keep {
+			keep[p] = struct{}{}
+		}
+		selected := toc.selectEntries(keep)
+		var out bytes.Buffer
+		fetched, err := fetchEntries(context.Background(), &out, bytes.NewReader(blob), toc, selected, nil)
+		assert.NilError(t, err)
+		assert.Check(t, fetched >= toc.selectedSize(selected))
+		if !selected[2] {
+			assert.Check(t, fetched <= int64(len(blob))-toc.Members[2].Size)
+		}
+		assert.Check(t, is.DeepEqual(tarNames(t, out.Bytes()), tc.expected))
+	}
+}
+
+func TestFetchEntriesVerifies(t *testing.T) {
+	compressed, compressionDone, toc := compressSeekable(bytes.NewReader(testLayerTar(t)))
+	blob, err := ioutil.ReadAll(compressed)
+	assert.NilError(t, err)
+	<-compressionDone
+
+	toc.Members[1].Digest = toc.Members[2].Digest
+	selected := toc.selectEntries(map[string]struct{}{"/bin/sh": {}})
+	_, err = fetchEntries(context.Background(), ioutil.Discard, bytes.NewReader(blob), toc, selected, nil)
+	assert.Check(t, is.ErrorContains(err, "verification failed for member 1"))
+}
+
+func TestFollowLinks(t *testing.T) {
+	tocs := []*layer.TOC{
+		// bottom
+		{Entries: []layer.TOCEntry{
+			{Name: "usr/", Type: tar.TypeDir},
+			{Name: "usr/bin/", Type: tar.TypeDir},
+			{Name: "usr/bin/python3.8", Type: tar.TypeReg},
+			{Name: "usr/bin/python3", Type: tar.TypeSymlink, Linkname: "python3.8"},
+			{Name: "usr/lib/", Type: tar.TypeDir},
+			{Name: "usr/lib/libz.so", Type: tar.TypeReg},
+			{Name: "lib", Type: tar.TypeSymlink, Linkname: "usr/lib"},
+			{Name: "etc/", Type: tar.TypeDir},
+			{Name: "etc/old", Type: tar.TypeSymlink, Linkname: "/usr/lib/libz.so"},
+			{Name: "etc/replaced", Type: tar.TypeSymlink, Linkname: "/usr/lib/libz.so"},
+		}},
+		// top: links python across layers, deletes old and replaces
+		// replaced with a file
+		{Entries: []layer.TOCEntry{
+			{Name: "bin/", Type: tar.TypeDir},
+			{Name: "bin/py", Type: tar.TypeSymlink, Linkname: "/usr/bin/python3"},
+			{Name: "bin/loop", Type: tar.TypeSymlink, Linkname: "loop"},
+			{Name: "etc/", Type: tar.TypeDir},
+			{Name: "etc/.wh.old", Type: tar.TypeReg},
+			{Name: "etc/replaced", Type: tar.TypeReg},
+		}},
+	}
+	followed := followLinks([]string{"/bin/py", "/lib/libz.so", "/etc/old", "/etc/replaced", "/bin/loop"}, tocs)
+	assert.Check(t, is.DeepEqual(followed, []string{
+		"/bin/loop", "/bin/py", "/etc/old", "/etc/replaced", "/lib", "/lib/libz.so",
+		"/usr/bin/python3", "/usr/bin/python3.8", "/usr/lib/libz.so",
+	}))
+
+	// keep is returned as is without symlinks to follow
+	keep := []string{"usr/lib/libz.so"}
+	assert.Check(t, is.DeepEqual(followLinks(keep, tocs[:1]), keep))
+}
+
+func TestCheckKeep(t *testing.T) {
+	tocs := []*layer.TOC{
+		{Entries: []layer.TOCEntry{
+			{Name: "etc/", Type: tar.TypeDir},
+			{Name: "etc/passwd", Type: tar.TypeReg},
+			{Name: "etc/conf", Type: tar.TypeReg},
+			{Name: "lib", Type: tar.TypeSymlink, Linkname: "usr/lib"},
+			{Name: "tmp/", Type: tar.TypeDir},
+		}},
+		// conf replaced with a directory
+		{Entries: []layer.TOCEntry{
+			{Name: "etc/.wh.conf", Type: tar.TypeReg},
+			{Name: "etc/conf/", Type: tar.TypeDir},
+		}},
+	}
+	// 容器运行时创建的文件不在层中
+	assert.Check(t, checkKeep([]string{"/", "/etc/passwd", "/etc/conf/app.conf", "/lib/libz.so", "/tmp/created"}, tocs))
+
+	err := checkKeep([]string{"/etc/passwd", "/opt/app"}, tocs)
+	assert.Check(t, errdefs.IsInvalidParameter(err))
+	assert.Check(t, is.Error(err, `invalid simplify profile entry "/opt/app": not in the image`))
+	err = checkKeep([]string{"/etc/passwd/x"}, tocs)
+	assert.Check(t, errdefs.IsInvalidParameter(err))
+	assert.Check(t, is.Error(err, `invalid simplify profile entry "/etc/passwd/x": /etc/passwd is not a directory`))
+}
@@ -0,0 +1,95 @@
+package image // import "github.com/docker/docker/image"
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+
+	"github.com/docker/docker/layer"
+	"github.com/opencontainers/go-digest"
+)
+
+// 修改： 添加精简镜像信息，记录镜像是否带有精简数据
+
+// Sources of the simplification data recorded for an image.
+const (
+	SimplifySourcePull   = "pull"
+	SimplifySourceCommit = "commit"
+	SimplifySourceImage  = "image"
+	// SimplifySourceRegistry marks images pulled by a manifest annotated as
+	// simplified, whose full image is not known locally.
+	SimplifySourceRegistry = "registry"
+)
+
+// SimplifyInfo holds the simplification data recorded for an image.
+type SimplifyInfo struct {
+	// Source is the operation that produced the simplification data.
+	Source string `json:"source"`
+	// Parent is the ID of the full image a committed simplified image was
+	// derived from.
+	Parent ID `json:"parent,omitempty"`
+	// Full is the ID of the full image a pulled simplified image was derived
+	// from. Unlike Parent, the full image need not be local.
+	Full ID `json:"full,omitempty"`
+	// Reference is the canonical reference of the full image a pulled
+	// simplified image was derived from, kept while the digest reference
+	// points at the other variant.
+	Reference string `json:"reference,omitempty"`
+	// Layers are the diff IDs of the full image, bottom-most first. Files
+	// pruned from the simplified image are fetched from them on demand.
+	Layers []layer.DiffID `json:"layers,omitempty"`
+	// FullSize is the size of the full image.
+	FullSize int64 `json:"full_size,omitempty"`
+	// Profile identifies the profile the image was simplified with.
+	Profile string `json:"profile,omitempty"`
+	// Threshold is the percentage of the recorded runs of the profile a file
+	// had to be opened in to be kept. For pulled images, it is the default
+	// for simplified commits of their containers.
+	Threshold int `json:"threshold,omitempty"`
+	// Annotations are the simplify annotations of the manifest the image
+	// was pulled by.
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// Signed is the digest of the full image the image was pulled by, as
+	// verified by the client against its content trust signature.
+	Signed digest.Digest `json:"signed,omitempty"`
+}
+
+// SimplifiedConfig returns the configuration of the image simplified from
+// the image of the configuration config, made of the layers of rootFS. It is
+// canonical JSON: compact, with the keys of objects sorted and numbers kept
+// as they were, so that the same image simplified to the same layers has the
+// same ID on every daemon.
+func SimplifiedConfig(config []byte, rootFS *RootFS) ([]byte, error) {
+	var fields map[string]interface{}
+	if err := decodeJSON(config, &fields); err != nil {
+		return nil, err
+	}
+	if fields == nil {
+		return nil, errors.New("invalid image config")
+	}
+	rawRootFS, err := json.Marshal(rootFS)
+	if err != nil {
+		return nil, err
+	}
+	// 结构体按字段顺序编码，转为map后按键排序
+	var rootFSFields map[string]interface{}
+	if err := decodeJSON(rawRootFS, &rootFSFields); err != nil {
+		return nil, err
+	}
+	fields["rootfs"] = rootFSFields
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(fields); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// decodeJSON decodes b into v, keeping numbers as they are written.
+func decodeJSON(b []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
@@ -0,0 +1,41 @@
+package image // import "github.com/docker/docker/image"
+
+import (
+	"testing"
+
+	"github.com/docker/docker/layer"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+func TestSimplifiedConfig(t *testing.T) {
+	config := `{
+	"os": "linux",
+	"created": "2023-04-12T08:24:31.123456789Z",
+	"config": {
+		"Env": ["PATH=/usr/bin"],
+		"Cmd": ["sh", "-c", "a && b > /dev/null"],
+		"StopTimeout": 18446744073709551615
+	},
+	"architecture": "amd64",
+	"rootfs": {
+		"type": "layers",
+		"diff_ids": ["sha256:full"]
+	}
+}`
+	rootFS := &RootFS{Type: "layers", DiffIDs: []layer.DiffID{"sha256:simplified"}}
+	b, err := SimplifiedConfig([]byte(config), rootFS)
+	assert.NilError(t, err)
+	// compact, with sorted keys, and numbers and times as they were
+	assert.Check(t, is.Equal(string(b), `{"architecture":"amd64","config":{"Cmd":["sh","-c","a && b > /dev/null"],"Env":["PATH=/usr/bin"],"StopTimeout":18446744073709551615},"created":"2023-04-12T08:24:31.123456789Z","os":"linux","rootfs":{"diff_ids":["sha256:simplified"],"type":"layers"}}`))
+
+	// the same config in another form gives the same bytes
+	other, err := SimplifiedConfig([]byte(`{"architecture":"amd64","rootfs":{"type":"layers"},"os":"linux","created":"2023-04-12T08:24:31.123456789Z","config":{"StopTimeout":18446744073709551615,"Cmd":["sh","-c","a && b > /dev/null"],"Env":["PATH=/usr/bin"]}}`), rootFS)
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(string(other), string(b)))
+
+	_, err = SimplifiedConfig([]byte("null"), rootFS)
+	assert.Check(t, is.Error(err, "invalid image config"))
+	_, err = SimplifiedConfig([]byte("{"), rootFS)
+	assert.Check(t, err != nil)
+}
@@ -3,6 +3,7 @@ package image // import "github.com/docker/docker/image"
 import (
 	"encoding/json"
 	"fmt"
+	"os"
 	"sync"
 	"time"
 
@@ -24,6 +25,10 @@ type Store interface {
 	GetParent(id ID) (ID, error)
 	SetLastUpdated(id ID) error
 	GetLastUpdated(id ID) (time.Time, error)
+	// 修改： 添加精简镜像信息的读写
+	SetSimplifyInfo(id ID, info *SimplifyInfo) error
+	GetSimplifyInfo(id ID) (*SimplifyInfo, error)
+	// 修改
 	Children(id ID) []ID
 	Map() map[ID]*Image
 	Heads() map[ID]*Image
@@ -294,6 +299,40 @@ func (is *store) GetLastUpdated(id ID) (time.Time, error) {
 	return time.Parse(time.RFC3339Nano, string(bytes))
 }
 
+// 修改： 添加精简镜像信息的读写
+
+// SetSimplifyInfo records the simplification data for the image ID
+func (is *store) SetSimplifyInfo(id ID, info *SimplifyInfo) error {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	return is.fs.SetMetadata(id.Digest(), "simplify", data)
+}
+
+// GetSimplifyInfo returns the simplification data for the image ID, or nil if
+// the image has none
+func (is *store) GetSimplifyInfo(id ID) (*SimplifyInfo, error) {
+	data, err := is.fs.GetMetadata(id.Digest(), "simplify")
+	if err != nil {
+		if os.IsNotExist(errors.Cause(err)) {
+			// No simplification data
+			return nil, nil
+		}
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, nil
+	}
+	var info SimplifyInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// 修改
+
 func (is *store) Children(id ID) []ID {
 	is.RLock()
 	defer is.RUnlock()
@@ -2,6 +2,8 @@ package image // import "github.com/docker/docker/image"
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 	"runtime"
 	"testing"
 
@@ -172,6 +174,41 @@ func TestGetAndSetLastUpdated(t *testing.T) {
 	assert.Check(t, cmp.Equal(updated.IsZero(), false))
 }
 
+func TestGetAndSetSimplifyInfo(t *testing.T) {
+	store, cleanup := defaultImageStore(t)
+	defer cleanup()
+
+	id, err := store.Create([]byte(`{"comment": "abc1", "rootfs": {"type": "layers"}}`))
+	assert.NilError(t, err)
+
+	info, err := store.GetSimplifyInfo(id)
+	assert.NilError(t, err)
+	assert.Check(t, info == nil)
+
+	assert.Check(t, store.SetSimplifyInfo(id, &SimplifyInfo{Source: SimplifySourcePull}))
+
+	info, err = store.GetSimplifyInfo(id)
+	assert.NilError(t, err)
+	assert.Check(t, cmp.DeepEqual(&SimplifyInfo{Source: SimplifySourcePull}, info))
+}
+
+func TestGetSimplifyInfoError(t *testing.T) {
+	fsBackend, cleanup := defaultFSStoreBackend(t)
+	defer cleanup()
+	store, err := NewImageStore(fsBackend, map[string]LayerGetReleaser{runtime.GOOS: &mockLayerGetReleaser{}})
+	assert.NilError(t, err)
+
+	id, err := store.Create([]byte(`{"comment": "abc1", "rootfs": {"type": "layers"}}`))
+	assert.NilError(t, err)
+
+	// errors other than missing data are not taken for an image that is not
+	// simplified
+	metadata := fsBackend.(*fs).metadataDir(id.Digest())
+	assert.NilError(t, os.MkdirAll(filepath.Join(metadata, "simplify"), 0700))
+	_, err = store.GetSimplifyInfo(id)
+	assert.Check(t, err != nil)
+}
+
 func TestStoreLen(t *testing.T) {
 	store, cleanup := defaultImageStore(t)
 	defer cleanup()
@@ -63,6 +63,12 @@ func (l *tarexporter) Load(inTar io.ReadCloser, outStream io.Writer, quiet bool)
 		return err
 	}
 
+	// 修改： 加载任何镜像之前，检查精简镜像能否加载
+	if err := l.checkSimplified(tmpDir, manifest); err != nil {
+		return err
+	}
+	// 修改
+
 	var parentLinks []parentLink
 	var imageIDsStr string
 	var imageRefCount int
@@ -86,10 +92,6 @@ func (l *tarexporter) Load(inTar io.ReadCloser, outStream io.Writer, quiet bool)
 		rootFS := *img.RootFS
 		rootFS.DiffIDs = nil
 
-		if expected, actual := len(m.Layers), len(img.RootFS.DiffIDs); expected != actual {
-			return fmt.Errorf("invalid manifest, layers length mismatch: expected %d, got %d", expected, actual)
-		}
-
 		// On Windows, validate the platform, defaulting to windows if not present.
 		os := img.OS
 		if os == "" {
@@ -101,8 +103,24 @@ func (l *tarexporter) Load(inTar io.ReadCloser, outStream io.Writer, quiet bool)
 			}
 		}
 
+		// 修改： 精简镜像的层只包含部分文件
+		layerPaths := m.Layers
+		if m.Simplified != nil {
+			if len(m.Layers) > 0 {
+				return fmt.Errorf("invalid manifest, simplified image %s has both layers and simplified layers", m.Config)
+			}
+			layerPaths = m.SimplifiedLayers
+		}
+
+		if expected, actual := len(layerPaths), len(img.RootFS.DiffIDs); expected != actual {
+			return fmt.Errorf("invalid manifest, layers length mismatch: expected %d, got %d", expected, actual)
+		}
+		// 修改
+
 		for i, diffID := range img.RootFS.DiffIDs {
-			layerPath, err := safePath(tmpDir, m.Layers[i])
+			// 修改： 精简镜像的层
+			layerPath, err := safePath(tmpDir, layerPaths[i])
+			// 修改
 			if err != nil {
 				return err
 			}
@@ -128,6 +146,14 @@ func (l *tarexporter) Load(inTar io.ReadCloser, outStream io.Writer, quiet bool)
 		}
 		imageIDsStr += fmt.Sprintf("Loaded image ID: %s\n", imgID)
 
+		// 修改： 记录精简镜像的精简数据
+		if m.Simplified != nil {
+			if err := l.simplify.LoadSimplified(imgID, m.Simplified); err != nil {
+				return err
+			}
+		}
+		// 修改
+
 		imageRefCount = 0
 		for _, repoTag := range m.RepoTags {
 			named, err := reference.ParseNormalizedNamed(repoTag)
@@ -27,8 +27,25 @@ type imageDescriptor struct {
 	layers   []string
 	image    *image.Image
 	layerRef layer.Layer
+	// 修改： 精简镜像保存为恢复的完整镜像，或与精简数据一起保存
+	restored   bool
+	release    func()
+	simplified *SimplifiedImage
+	// 修改
 }
 
+// 修改： 恢复的完整镜像的ID与原镜像不同
+
+// configID returns the ID of the image saved for the image id.
+func (d *imageDescriptor) configID(id image.ID) image.ID {
+	if d.restored {
+		return image.IDFromDigest(digest.FromBytes(d.image.RawJSON()))
+	}
+	return id
+}
+
+// 修改
+
 type saveSession struct {
 	*tarexporter
 	outDir      string
@@ -151,6 +168,24 @@ func (l *tarexporter) takeLayerReference(id image.ID, imgDescr *imageDescriptor)
 		return err
 	}
 	imgDescr.image = img
+	// 修改： 精简镜像缺少完整镜像的文件
+	if l.simplify != nil {
+		if l.simplified {
+			if imgDescr.simplified, err = l.simplify.SaveSimplified(id); err != nil {
+				return err
+			}
+		} else {
+			restored, release, err := l.simplify.RestoreSimplified(id)
+			if err != nil {
+				return err
+			}
+			if restored != nil {
+				img = restored
+				imgDescr.image, imgDescr.restored, imgDescr.release = restored, true, release
+			}
+		}
+	}
+	// 修改
 	topLayerID := img.RootFS.ChainID()
 	if topLayerID == "" {
 		return nil
@@ -180,6 +215,11 @@ func (l *tarexporter) releaseLayerReferences(imgDescr map[image.ID]*imageDescrip
 			}
 			l.lss[os].Release(descr.layerRef)
 		}
+		// 修改： 释放恢复的完整镜像的层
+		if descr.release != nil {
+			descr.release()
+		}
+		// 修改
 	}
 	return nil
 }
@@ -227,14 +267,24 @@ func (s *saveSession) save(outStream io.Writer) error {
 			layers = append(layers, path.Join(l, legacyLayerFileName))
 		}
 
-		manifest = append(manifest, manifestItem{
-			Config:       id.Digest().Hex() + ".json",
+		// 修改： 精简镜像的层放在SimplifiedLayers中
+		item := manifestItem{
+			Config:       imageDescr.configID(id).Digest().Hex() + ".json",
 			RepoTags:     repoTags,
 			Layers:       layers,
 			LayerSources: foreignSrcs,
-		})
+		}
+		if imageDescr.simplified != nil {
+			item.Layers, item.SimplifiedLayers, item.Simplified = nil, layers, imageDescr.simplified
+		}
+		manifest = append(manifest, item)
 
 		parentID, _ := s.is.GetParent(id)
+		if imageDescr.simplified != nil {
+			// 精简镜像的历史不包含完整镜像的历史，完整镜像记录在精简数据中
+			parentID = ""
+		}
+		// 修改
 		parentLinks = append(parentLinks, parentLink{id, parentID})
 		s.tarexporter.loggerImgEvent.LogImageEvent(id.String(), id.String(), "save")
 	}
@@ -336,7 +386,9 @@ func (s *saveSession) saveImage(id image.ID) (map[layer.DiffID]distribution.Desc
 		}
 	}
 
-	configFile := filepath.Join(s.outDir, id.Digest().Hex()+".json")
+	// 修改： 恢复的完整镜像的ID与原镜像不同
+	configFile := filepath.Join(s.outDir, s.images[id].configID(id).Digest().Hex()+".json")
+	// 修改
 	if err := ioutil.WriteFile(configFile, img.RawJSON(), 0644); err != nil {
 		return nil, err
 	}
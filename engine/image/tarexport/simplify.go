@@ -0,0 +1,108 @@
+package tarexport // import "github.com/docker/docker/image/tarexport"
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"runtime"
+
+	"github.com/docker/docker/image"
+	"github.com/docker/docker/layer"
+	refstore "github.com/docker/docker/reference"
+	"github.com/opencontainers/go-digest"
+)
+
+// 修改： 精简镜像的保存与加载
+
+// SimplifyBackend saves and loads simplified images, which lack files of
+// the full image they were derived from.
+type SimplifyBackend interface {
+	// RestoreSimplified returns the full image restored from the simplified
+	// image id, to be saved in its place, and a function releasing its
+	// layers, which are held in the layer store until then. It returns a
+	// nil image if id holds every file of its full image.
+	RestoreSimplified(id image.ID) (*image.Image, func(), error)
+	// SaveSimplified returns the simplification data to save along with
+	// the simplified image id in a simplified archive, or nil if id holds
+	// every file of its full image.
+	SaveSimplified(id image.ID) (*SimplifiedImage, error)
+	// CheckSimplified returns an error if the simplified image s cannot be
+	// run once it is loaded for os: if the storage driver does not support
+	// simplified images, or if its missing files cannot be fetched.
+	CheckSimplified(s *SimplifiedImage, os string) error
+	// LoadSimplified records the simplification data of the loaded image id.
+	LoadSimplified(id image.ID, s *SimplifiedImage) error
+}
+
+// SimplifiedImage is the simplification data saved along with a simplified
+// image in a simplified archive.
+type SimplifiedImage struct {
+	// Info is the simplification data recorded for the image. The diff IDs
+	// of the layers of its full image are always set.
+	Info image.SimplifyInfo
+	// Sources are the registry blobs the layers of the full image can be
+	// fetched from, by diff ID.
+	Sources map[layer.DiffID][]LayerSource `json:",omitempty"`
+	// Profile is the profile the image was simplified with.
+	Profile json.RawMessage `json:",omitempty"`
+	// TOCs are the tables of contents of the layers of the full image, by
+	// diff ID, used to fetch single files out of them.
+	TOCs map[layer.DiffID]*layer.TOC `json:",omitempty"`
+}
+
+// LayerSource is a registry blob a layer can be fetched from.
+type LayerSource struct {
+	Digest     digest.Digest
+	Repository string
+}
+
+// NewSimplifyTarExporter returns a new Exporter for tar packages handling
+// simplified images with simplify. If simplified is set, simplified images
+// are saved as they are in a simplified archive, which only daemons
+// supporting simplified images load. Otherwise their full images are
+// restored and saved in their place.
+func NewSimplifyTarExporter(is image.Store, lss map[string]layer.Store, rs refstore.Store, loggerImgEvent LogImageEvent, simplify SimplifyBackend, simplified bool) image.Exporter {
+	return &tarexporter{
+		is:             is,
+		lss:            lss,
+		rs:             rs,
+		loggerImgEvent: loggerImgEvent,
+		simplify:       simplify,
+		simplified:     simplified,
+	}
+}
+
+// checkSimplified checks, before any image of the archive extracted to
+// tmpDir is loaded, that the simplified images of manifest can be loaded.
+func (l *tarexporter) checkSimplified(tmpDir string, manifest []manifestItem) error {
+	for _, m := range manifest {
+		if m.Simplified == nil {
+			continue
+		}
+		if l.simplify == nil {
+			return fmt.Errorf("cannot load simplified image %s: this daemon does not support simplified images", m.Config)
+		}
+		configPath, err := safePath(tmpDir, m.Config)
+		if err != nil {
+			return err
+		}
+		config, err := ioutil.ReadFile(configPath)
+		if err != nil {
+			return err
+		}
+		img, err := image.NewFromJSON(config)
+		if err != nil {
+			return err
+		}
+		os := img.OS
+		if os == "" {
+			os = runtime.GOOS
+		}
+		if err := l.simplify.CheckSimplified(m.Simplified, os); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 修改
@@ -21,6 +21,10 @@ type manifestItem struct {
 	Layers       []string
 	Parent       image.ID                                 `json:",omitempty"`
 	LayerSources map[layer.DiffID]distribution.Descriptor `json:",omitempty"`
+	// 修改： 精简镜像的层只包含部分文件，放在SimplifiedLayers中，使不支持精简镜像的daemon拒绝加载
+	SimplifiedLayers []string         `json:",omitempty"`
+	Simplified       *SimplifiedImage `json:",omitempty"`
+	// 修改
 }
 
 type tarexporter struct {
@@ -28,6 +32,10 @@ type tarexporter struct {
 	lss            map[string]layer.Store
 	rs             refstore.Store
 	loggerImgEvent LogImageEvent
+	// 修改： 精简镜像的保存与加载
+	simplify   SimplifyBackend
+	simplified bool
+	// 修改
 }
 
 // LogImageEvent defines interface for event generation related to image tar(load and save) operations
@@ -0,0 +1,118 @@
+package build
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	dclient "github.com/docker/docker/client"
+	"github.com/docker/docker/integration/internal/container"
+	"github.com/docker/docker/integration/internal/requirement"
+	"github.com/docker/docker/internal/test/fakecontext"
+	"github.com/docker/docker/pkg/jsonmessage"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+	"gotest.tools/skip"
+)
+
+func TestBuildFromSimplifiedImage(t *testing.T) {
+	skip.If(t, testEnv.DaemonInfo.OSType != "linux")
+	skip.If(t, testEnv.DaemonInfo.Driver != "overlay2")
+	_, err := os.Stat("/sys/module/overlay/parameters/fetch_helper")
+	skip.If(t, err != nil, "overlay module has no fetch helper support")
+	skip.If(t, !requirement.HasHubConnectivity(t))
+	defer setupTest(t)()
+	client := testEnv.APIClient()
+	ctx := context.Background()
+	simplified := simplifyAlpine(ctx, t, client)
+
+	// apk is fetched by the first RUN step, and the files of the full image
+	// the second one needs are fetched on top of the image the first built
+	dockerfile := `
+		FROM ` + simplified + `
+		RUN apk --version > /apk-version
+		RUN test -s /apk-version && ls /etc/apk/keys > /apk-keys
+		`
+	source := fakecontext.New(t, "", fakecontext.WithDockerfile(dockerfile))
+	defer source.Close()
+
+	resp, err := client.ImageBuild(ctx, source.AsTarReader(t), types.ImageBuildOptions{
+		Remove:      true,
+		ForceRemove: true,
+		Tags:        []string{"build-from-simplified"},
+	})
+	assert.NilError(t, err)
+	out := bytes.NewBuffer(nil)
+	err = jsonmessage.DisplayJSONMessagesStream(resp.Body, out, 0, false, nil)
+	resp.Body.Close()
+	assert.NilError(t, err, out.String())
+
+	// the fetched files are part of the built image
+	cID := container.Run(t, ctx, client, container.WithImage("build-from-simplified"))
+	res, err := container.Exec(ctx, client, cID, []string{"sh", "-c", "apk --version && test -s /apk-keys"})
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(res.ExitCode, 0), res.Combined())
+}
+
+func TestBuildCopyFromSimplifiedImage(t *testing.T) {
+	skip.If(t, testEnv.DaemonInfo.OSType != "linux")
+	skip.If(t, testEnv.DaemonInfo.Driver != "overlay2")
+	_, err := os.Stat("/sys/module/overlay/parameters/fetch_helper")
+	skip.If(t, err != nil, "overlay module has no fetch helper support")
+	skip.If(t, !requirement.HasHubConnectivity(t))
+	defer setupTest(t)()
+	client := testEnv.APIClient()
+	ctx := context.Background()
+	simplified := simplifyAlpine(ctx, t, client)
+
+	// /etc/apk was pruned from the simplified stage, the whole directory is
+	// fetched before it is copied
+	dockerfile := `
+		FROM ` + simplified + ` AS base
+		FROM busybox
+		COPY --from=base /etc/apk /apk
+		COPY --from=base /sbin/apk* /bin/
+		`
+	source := fakecontext.New(t, "", fakecontext.WithDockerfile(dockerfile))
+	defer source.Close()
+
+	resp, err := client.ImageBuild(ctx, source.AsTarReader(t), types.ImageBuildOptions{
+		Remove:      true,
+		ForceRemove: true,
+		Tags:        []string{"copy-from-simplified"},
+	})
+	assert.NilError(t, err)
+	out := bytes.NewBuffer(nil)
+	err = jsonmessage.DisplayJSONMessagesStream(resp.Body, out, 0, false, nil)
+	resp.Body.Close()
+	assert.NilError(t, err, out.String())
+
+	cID := container.Run(t, ctx, client, container.WithImage("copy-from-simplified"))
+	res, err := container.Exec(ctx, client, cID, []string{"sh", "-c", "ls /apk/keys | grep -q rsa.pub && test -x /bin/apk"})
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(res.ExitCode, 0), res.Combined())
+}
+
+// simplifyAlpine pulls alpine and simplifies it to the files it needs to run
+// a shell, leaving apk out, returning the ID of the simplified image.
+func simplifyAlpine(ctx context.Context, t *testing.T, client dclient.APIClient) string {
+	rc, err := client.ImagePull(ctx, "alpine:3.8", types.ImagePullOptions{Simplify: true})
+	assert.NilError(t, err)
+	_, err = io.Copy(ioutil.Discard, rc)
+	rc.Close()
+	assert.NilError(t, err)
+
+	cID := container.Create(t, ctx, client, container.WithImage("alpine:3.8"))
+	simp := true
+	assert.NilError(t, client.ContainerStart(ctx, cID, types.ContainerStartOptions{Simp: &simp}))
+	res, err := container.Exec(ctx, client, cID, []string{"sh", "-c", "true"})
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(res.ExitCode, 0))
+	simplified, err := client.ContainerCommit(ctx, cID, types.ContainerCommitOptions{Simp: true})
+	assert.NilError(t, err)
+	return simplified.ID
+}
@@ -0,0 +1,635 @@
+package container // import "github.com/docker/docker/integration/container"
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	containertypes "github.com/docker/docker/api/types/container"
+	apiclient "github.com/docker/docker/client"
+	"github.com/docker/docker/integration/internal/container"
+	"github.com/docker/docker/integration/internal/requirement"
+	"github.com/docker/docker/internal/test/daemon"
+	"github.com/docker/docker/internal/test/registry"
+	"github.com/docker/docker/internal/test/request"
+	"github.com/docker/docker/internal/testutil"
+	"github.com/opencontainers/go-digest"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+	"gotest.tools/poll"
+	"gotest.tools/skip"
+)
+
+func TestStartWithInvalidSimplifyImage(t *testing.T) {
+	defer setupTest(t)()
+	client := request.NewAPIClient(t)
+	ctx := context.Background()
+
+	cID := container.Create(t, ctx, client)
+
+	for _, value := range []string{"1", "maybe", "YESS"} {
+		res, _, err := request.Post("/containers/" + cID + "/start?simplify-image=" + value)
+		assert.NilError(t, err)
+		assert.Check(t, is.DeepEqual(http.StatusBadRequest, res.StatusCode), "simplify-image=%s", value)
+	}
+}
+
+func TestStartSimplifiedWithoutSimplificationData(t *testing.T) {
+	defer setupTest(t)()
+	client := request.NewAPIClient(t)
+	ctx := context.Background()
+
+	cID := container.Create(t, ctx, client)
+
+	res, body, err := request.Post("/containers/" + cID + "/start?simplify-image=yes")
+	assert.NilError(t, err)
+	assert.Check(t, is.DeepEqual(http.StatusBadRequest, res.StatusCode))
+	b, err := request.ReadBody(body)
+	assert.NilError(t, err)
+	assert.Check(t, is.Contains(string(b), "has no simplification data"))
+	var resp types.ErrorResponse
+	assert.NilError(t, json.Unmarshal(b, &resp))
+	assert.Check(t, is.Equal(resp.Code, types.ErrorCodeImageNotSimplified))
+
+	inspect, err := client.ContainerInspect(ctx, cID)
+	assert.NilError(t, err)
+	assert.Check(t, !inspect.State.Running)
+}
+
+func TestCommitSimplifiedMergesFetchedFiles(t *testing.T) {
+	skip.If(t, testEnv.DaemonInfo.OSType != "linux")
+	skip.If(t, testEnv.IsRemoteDaemon(), "cannot remove the fetch cache of a remote daemon")
+	skip.If(t, testEnv.DaemonInfo.Driver != "overlay2")
+	_, err := os.Stat("/sys/module/overlay/parameters/fetch_helper")
+	skip.If(t, err != nil, "overlay module has no fetch helper support")
+	skip.If(t, !requirement.HasHubConnectivity(t))
+	defer setupTest(t)()
+	client := request.NewAPIClient(t)
+	ctx := context.Background()
+
+	// record which files alpine needs to run top and a shell
+	rc, err := client.ImagePull(ctx, "alpine:3.8", types.ImagePullOptions{Simplify: true})
+	assert.NilError(t, err)
+	_, err = io.Copy(ioutil.Discard, rc)
+	rc.Close()
+	assert.NilError(t, err)
+
+	cID := container.Create(t, ctx, client, container.WithImage("alpine:3.8"))
+	assert.NilError(t, client.ContainerStart(ctx, cID, simplifiedStartOptions()))
+	res, err := container.Exec(ctx, client, cID, []string{"sh", "-c", "true"})
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(res.ExitCode, 0))
+
+	simplified := commit(t, cID, "simplify-image=yes")
+
+	// /etc/group was pruned and is fetched on demand
+	cID = container.Run(t, ctx, client, container.WithImage(simplified))
+	res, err = container.Exec(ctx, client, cID, []string{"sh", "-c", `read l < /etc/group && echo "$l"`})
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(res.ExitCode, 0), res.Combined())
+
+	committed := commit(t, cID)
+	assert.NilError(t, client.ContainerRemove(ctx, cID, types.ContainerRemoveOptions{Force: true}))
+	assert.NilError(t, os.RemoveAll(filepath.Join(testEnv.DaemonInfo.DockerRootDir, "simplify", "fetch")))
+
+	cID = container.Run(t, ctx, client, container.WithImage(committed))
+	poll.WaitOn(t, container.IsInState(ctx, client, cID, "running"), poll.WithDelay(100*time.Millisecond))
+	res, err = container.Exec(ctx, client, cID, []string{"sh", "-c", `read l < /etc/group && echo "$l"`})
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(res.ExitCode, 0), res.Combined())
+	assert.Check(t, is.Equal(res.Stdout(), "root:x:0:root\n"))
+}
+
+func TestSimplifiedCloneOnZfs(t *testing.T) {
+	skip.If(t, testEnv.DaemonInfo.OSType != "linux")
+	skip.If(t, testEnv.DaemonInfo.Driver != "zfs")
+	skip.If(t, !requirement.HasHubConnectivity(t))
+	defer setupTest(t)()
+	client := request.NewAPIClient(t)
+	ctx := context.Background()
+
+	rc, err := client.ImagePull(ctx, "alpine:3.8", types.ImagePullOptions{Simplify: true})
+	assert.NilError(t, err)
+	_, err = io.Copy(ioutil.Discard, rc)
+	rc.Close()
+	assert.NilError(t, err)
+
+	// zfs does not copy up the files read: those the container opens are
+	// recorded and kept by the commit
+	cID := container.Create(t, ctx, client, container.WithImage("alpine:3.8"))
+	assert.NilError(t, client.ContainerStart(ctx, cID, simplifiedStartOptions()))
+	res, err := container.Exec(ctx, client, cID, []string{"sh", "-c", "cat /etc/alpine-release > /dev/null"})
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(res.ExitCode, 0), res.Combined())
+	simplified := commit(t, cID, "simplify-image=yes")
+
+	cID = container.Run(t, ctx, client, container.WithImage(simplified))
+	poll.WaitOn(t, container.IsInState(ctx, client, cID, "running"), poll.WithDelay(100*time.Millisecond))
+	res, err = container.Exec(ctx, client, cID, []string{"sh", "-c", "test -f /etc/alpine-release && test ! -e /sbin/apk"})
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(res.ExitCode, 0), res.Combined())
+
+	// files fetched for the image are inserted into the rootfs of its
+	// running containers
+	rc, err = client.ImagePrefetch(ctx, simplified, types.ImagePrefetchOptions{Paths: []string{"/sbin/apk"}})
+	assert.NilError(t, err)
+	_, err = io.Copy(ioutil.Discard, rc)
+	rc.Close()
+	assert.NilError(t, err)
+	res, err = container.Exec(ctx, client, cID, []string{"test", "-x", "/sbin/apk"})
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(res.ExitCode, 0), res.Combined())
+}
+
+func TestHealthcheckOfSimplifiedContainer(t *testing.T) {
+	skip.If(t, testEnv.DaemonInfo.OSType != "linux")
+	skip.If(t, testEnv.DaemonInfo.Driver != "overlay2")
+	_, err := os.Stat("/sys/module/overlay/parameters/fetch_helper")
+	skip.If(t, err != nil, "overlay module has no fetch helper support")
+	skip.If(t, !requirement.HasHubConnectivity(t))
+	defer setupTest(t)()
+	client := request.NewAPIClient(t)
+	ctx := context.Background()
+
+	// record which files alpine needs to run a shell, leaving apk out
+	rc, err := client.ImagePull(ctx, "alpine:3.8", types.ImagePullOptions{Simplify: true})
+	assert.NilError(t, err)
+	_, err = io.Copy(ioutil.Discard, rc)
+	rc.Close()
+	assert.NilError(t, err)
+
+	cID := container.Create(t, ctx, client, container.WithImage("alpine:3.8"))
+	assert.NilError(t, client.ContainerStart(ctx, cID, simplifiedStartOptions()))
+	res, err := container.Exec(ctx, client, cID, []string{"sh", "-c", "true"})
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(res.ExitCode, 0))
+
+	simplified := commit(t, cID, "simplify-image=yes")
+
+	// apk and the libraries it loads are fetched before the first probe
+	cID = container.Run(t, ctx, client, container.WithImage(simplified), func(c *container.TestContainerConfig) {
+		c.Config.Healthcheck = &containertypes.HealthConfig{
+			Test:     []string{"CMD", "/sbin/apk", "--version"},
+			Interval: 50 * time.Millisecond,
+			Retries:  1,
+		}
+	})
+	poll.WaitOn(t, pollForHealthStatus(ctx, client, cID, types.Healthy), poll.WithDelay(100*time.Millisecond))
+	inspect, err := client.ContainerInspect(ctx, cID)
+	assert.NilError(t, err)
+	for _, probe := range inspect.State.Health.Log {
+		assert.Check(t, is.Equal(probe.ExitCode, 0), probe.Output)
+	}
+}
+
+func TestVolumeOverPrunedDirectory(t *testing.T) {
+	skip.If(t, testEnv.DaemonInfo.OSType != "linux")
+	skip.If(t, testEnv.DaemonInfo.Driver != "overlay2")
+	_, err := os.Stat("/sys/module/overlay/parameters/fetch_helper")
+	skip.If(t, err != nil, "overlay module has no fetch helper support")
+	skip.If(t, !requirement.HasHubConnectivity(t))
+	defer setupTest(t)()
+	client := request.NewAPIClient(t)
+	ctx := context.Background()
+
+	// record which files alpine needs to run a shell, leaving /etc/apk out
+	rc, err := client.ImagePull(ctx, "alpine:3.8", types.ImagePullOptions{Simplify: true})
+	assert.NilError(t, err)
+	_, err = io.Copy(ioutil.Discard, rc)
+	rc.Close()
+	assert.NilError(t, err)
+
+	cID := container.Create(t, ctx, client, container.WithImage("alpine:3.8"))
+	assert.NilError(t, client.ContainerStart(ctx, cID, simplifiedStartOptions()))
+	res, err := container.Exec(ctx, client, cID, []string{"sh", "-c", "true"})
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(res.ExitCode, 0))
+
+	simplified := commit(t, cID, "simplify-image=yes")
+
+	// the anonymous volume is seeded with the files of the full image
+	cID = container.Run(t, ctx, client, container.WithImage(simplified), func(c *container.TestContainerConfig) {
+		c.Config.Volumes = map[string]struct{}{"/etc/apk": {}}
+	})
+	res, err = container.Exec(ctx, client, cID, []string{"sh", "-c", "test -s /etc/apk/world && ls /etc/apk/keys | wc -l"})
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(res.ExitCode, 0), res.Combined())
+	assert.Check(t, res.Stdout() != "0\n", res.Combined())
+}
+
+func TestReadonlyRootfsSimplified(t *testing.T) {
+	skip.If(t, testEnv.DaemonInfo.OSType != "linux")
+	skip.If(t, testEnv.DaemonInfo.Driver != "overlay2")
+	_, err := os.Stat("/sys/module/overlay/parameters/fetch_helper")
+	skip.If(t, err != nil, "overlay module has no fetch helper support")
+	skip.If(t, !requirement.HasHubConnectivity(t))
+	defer setupTest(t)()
+	client := request.NewAPIClient(t)
+	ctx := context.Background()
+
+	rc, err := client.ImagePull(ctx, "alpine:3.8", types.ImagePullOptions{Simplify: true})
+	assert.NilError(t, err)
+	_, err = io.Copy(ioutil.Discard, rc)
+	rc.Close()
+	assert.NilError(t, err)
+
+	cID := container.Create(t, ctx, client, container.WithImage("alpine:3.8"))
+	assert.NilError(t, client.ContainerStart(ctx, cID, simplifiedStartOptions()))
+	res, err := container.Exec(ctx, client, cID, []string{"sh", "-c", "true"})
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(res.ExitCode, 0))
+
+	simplified := commit(t, cID, "simplify-image=yes")
+
+	readonly := func(c *container.TestContainerConfig) {
+		c.HostConfig.ReadonlyRootfs = true
+	}
+	// /etc/group was pruned and is fetched below the read-only rootfs
+	var cIDs []string
+	for i := 0; i < 2; i++ {
+		cID = container.Run(t, ctx, client, container.WithImage(simplified), readonly)
+		res, err = container.Exec(ctx, client, cID, []string{"sh", "-c", `read l < /etc/group && echo "$l"`})
+		assert.NilError(t, err)
+		assert.Check(t, is.Equal(res.ExitCode, 0), res.Combined())
+		assert.Check(t, is.Equal(res.Stdout(), "root:x:0:root\n"))
+
+		res, err = container.Exec(ctx, client, cID, []string{"sh", "-c", "echo >> /etc/group"})
+		assert.NilError(t, err)
+		assert.Check(t, res.ExitCode != 0)
+		assert.Check(t, is.Contains(res.Stderr(), "Read-only file system"))
+		cIDs = append(cIDs, cID)
+	}
+
+	// the second container found the file fetched for the first one
+	resp, err := client.ContainerStats(ctx, cIDs[1], false)
+	assert.NilError(t, err)
+	defer resp.Body.Close()
+	var v *types.Stats
+	assert.NilError(t, json.NewDecoder(resp.Body).Decode(&v))
+	assert.Assert(t, v.SimplifyStats != nil)
+	assert.Check(t, v.SimplifyStats.CacheHits > 0)
+}
+
+func TestSimplifiedOwnershipWithUsernsRemap(t *testing.T) {
+	skip.If(t, testEnv.DaemonInfo.OSType != "linux")
+	skip.If(t, testEnv.IsRemoteDaemon(), "cannot start a remapped daemon")
+	_, err := os.Stat("/proc/self/uid_map")
+	skip.If(t, err != nil, "kernel has no user namespace support")
+	_, err = os.Stat("/sys/module/overlay/parameters/fetch_helper")
+	skip.If(t, err != nil, "overlay module has no fetch helper support")
+	skip.If(t, !requirement.HasHubConnectivity(t))
+
+	d := daemon.New(t)
+	d.Start(t, "--userns-remap=default", "--storage-driver=overlay2")
+	defer d.Stop(t)
+	client, err := d.NewClient()
+	assert.NilError(t, err)
+	defer client.Close()
+	ctx := context.Background()
+
+	rc, err := client.ImagePull(ctx, "alpine:3.8", types.ImagePullOptions{Simplify: true})
+	assert.NilError(t, err)
+	_, err = io.Copy(ioutil.Discard, rc)
+	rc.Close()
+	assert.NilError(t, err)
+
+	cID := container.Create(t, ctx, client, container.WithImage("alpine:3.8"))
+	assert.NilError(t, client.ContainerStart(ctx, cID, simplifiedStartOptions()))
+	res, err := container.Exec(ctx, client, cID, []string{"sh", "-c", "true"})
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(res.ExitCode, 0))
+	simplified, err := client.ContainerCommit(ctx, cID, types.ContainerCommitOptions{Simp: true})
+	assert.NilError(t, err)
+
+	// kept and fetched files, including the setuid bbsuid, have the owners
+	// and modes of the full image
+	stat := []string{"stat", "-c", "%u:%g %a %n", "/bin/busybox", "/bin/bbsuid", "/etc/group", "/etc/shadow", "/etc/apk/world"}
+	full := container.Run(t, ctx, client, container.WithImage("alpine:3.8"))
+	expected, err := container.Exec(ctx, client, full, stat)
+	assert.NilError(t, err)
+	assert.Assert(t, is.Equal(expected.ExitCode, 0), expected.Combined())
+	assert.Check(t, is.Contains(expected.Stdout(), "0:0 4111 /bin/bbsuid"))
+
+	cID = container.Run(t, ctx, client, container.WithImage(simplified.ID))
+	res, err = container.Exec(ctx, client, cID, stat)
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(res.ExitCode, 0), res.Combined())
+	assert.Check(t, is.Equal(res.Stdout(), expected.Stdout()))
+}
+
+func TestSimplifiedFaultedRootfsMatchesFull(t *testing.T) {
+	skip.If(t, testEnv.DaemonInfo.OSType != "linux")
+	skip.If(t, testEnv.IsRemoteDaemon(), "cannot start a daemon with another storage configuration")
+	_, err := os.Stat("/sys/module/overlay/parameters/fetch_helper")
+	skip.If(t, err != nil, "overlay module has no fetch helper support")
+	skip.If(t, !requirement.HasHubConnectivity(t))
+
+	// every file but those the daemon sets up, and the modification time of
+	// all but directories, which the container's writable layer changes
+	stat := []string{"sh", "-c", `find / -xdev -mindepth 1 ! -path '/etc/host*' ! -path /etc/resolv.conf ! -path /.dockerenv -exec stat -c '%u:%g %a %F %t:%T %s %n' {} + | sort; ` +
+		`find / -xdev -mindepth 1 ! -type d ! -path '/etc/host*' ! -path /etc/resolv.conf ! -path /.dockerenv -exec stat -c '%Y %n' {} + | sort`}
+	for _, args := range [][]string{
+		{"--storage-driver=overlay2"},
+		{"--storage-driver=overlay2", "--userns-remap=default"},
+	} {
+		t.Run(strings.Join(args, " "), func(t *testing.T) {
+			d := daemon.New(t)
+			d.Start(t, args...)
+			defer d.Stop(t)
+			client, err := d.NewClient()
+			assert.NilError(t, err)
+			defer client.Close()
+			ctx := context.Background()
+
+			rc, err := client.ImagePull(ctx, "postgres:10-alpine", types.ImagePullOptions{Simplify: true})
+			assert.NilError(t, err)
+			_, err = io.Copy(ioutil.Discard, rc)
+			rc.Close()
+			assert.NilError(t, err)
+
+			full := container.Run(t, ctx, client, container.WithImage("postgres:10-alpine"), container.WithCmd("sleep", "300"))
+			expected, err := container.Exec(ctx, client, full, stat)
+			assert.NilError(t, err)
+			assert.Assert(t, is.Equal(expected.ExitCode, 0), expected.Combined())
+
+			cID := container.Create(t, ctx, client, container.WithImage("postgres:10-alpine"), container.WithCmd("sleep", "300"))
+			assert.NilError(t, client.ContainerStart(ctx, cID, simplifiedStartOptions()))
+			// read every file, so that all of those pruned are fetched
+			res, err := container.Exec(ctx, client, cID, []string{"sh", "-c", "find / -xdev -type f -exec cat {} + > /dev/null"})
+			assert.NilError(t, err)
+			assert.Assert(t, is.Equal(res.ExitCode, 0), res.Combined())
+			res, err = container.Exec(ctx, client, cID, stat)
+			assert.NilError(t, err)
+			assert.Assert(t, is.Equal(res.ExitCode, 0), res.Combined())
+			assert.Check(t, is.Equal(res.Stdout(), expected.Stdout()))
+		})
+	}
+}
+
+func TestSimplifiedFetchThroughRegistryMirror(t *testing.T) {
+	skip.If(t, testEnv.DaemonInfo.OSType != "linux")
+	skip.If(t, testEnv.IsRemoteDaemon(), "cannot start a daemon with a registry mirror")
+	_, err := os.Stat("/sys/module/overlay/parameters/fetch_helper")
+	skip.If(t, err != nil, "overlay module has no fetch helper support")
+
+	reg := registry.NewV2(t)
+	defer reg.Close()
+
+	d := daemon.New(t)
+	d.StartWithBusybox(t, "--storage-driver=overlay2", "--registry-mirror=http://"+registry.DefaultURL)
+	defer d.Stop(t)
+	client := d.NewClientT(t)
+	defer client.Close()
+	ctx := context.Background()
+
+	// the mirror serves busybox as library/busybox of Docker Hub
+	mirrored := path.Join(registry.DefaultURL, "library", "busybox:latest")
+	assert.NilError(t, client.ImageTag(ctx, "busybox:latest", mirrored))
+	rc, err := client.ImagePush(ctx, mirrored, types.ImagePushOptions{})
+	assert.NilError(t, err)
+	_, err = io.Copy(ioutil.Discard, rc)
+	rc.Close()
+	assert.NilError(t, err)
+	for _, ref := range []string{"busybox:latest", mirrored} {
+		_, err = client.ImageRemove(ctx, ref, types.ImageRemoveOptions{Force: true})
+		assert.NilError(t, err)
+	}
+
+	// only the shell is pulled, the other files are fetched from the mirror
+	rc, err = client.ImagePull(ctx, "busybox:latest", types.ImagePullOptions{
+		Simplify:           true,
+		SimplifyUseProfile: &types.ImageProfile{Paths: []string{"/bin/sh"}},
+		SimplifyForce:      true,
+	})
+	assert.NilError(t, err)
+	_, err = io.Copy(ioutil.Discard, rc)
+	rc.Close()
+	assert.NilError(t, err)
+
+	cID := container.Run(t, ctx, client, container.WithImage("busybox:latest"))
+	res, err := container.Exec(ctx, client, cID, []string{"sh", "-c", `read l < /etc/passwd && echo "$l"`})
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(res.ExitCode, 0), res.Combined())
+	assert.Check(t, is.Equal(res.Stdout(), "root:x:0:0:root:/root:/bin/sh\n"))
+}
+
+func TestSimplifiedSparseFile(t *testing.T) {
+	skip.If(t, testEnv.DaemonInfo.OSType != "linux")
+	skip.If(t, testEnv.IsRemoteDaemon(), "cannot start a daemon with a registry")
+	_, err := os.Stat("/sys/module/overlay/parameters/fetch_helper")
+	skip.If(t, err != nil, "overlay module has no fetch helper support")
+
+	reg := registry.NewV2(t)
+	defer reg.Close()
+
+	d := daemon.New(t)
+	d.StartWithBusybox(t, "--storage-driver=overlay2")
+	defer d.Stop(t)
+	client := d.NewClientT(t)
+	defer client.Close()
+	ctx := context.Background()
+
+	// a 1GB sparse file holding 1MB of data, on top of busybox
+	data := testutil.SparseData{Offset: 512 << 20, Data: bytes.Repeat([]byte("x"), 1<<20)}
+	layer := append(testutil.GNUSparseEntry("db.img", 1<<30, data), make([]byte, 1024)...)
+	ref := path.Join(registry.DefaultURL, "sparse:latest")
+	loadWithLayer(t, client, "busybox:latest", ref, layer)
+	rc, err := client.ImagePush(ctx, ref, types.ImagePushOptions{})
+	assert.NilError(t, err)
+	_, err = io.Copy(ioutil.Discard, rc)
+	rc.Close()
+	assert.NilError(t, err)
+
+	// the file is kept, then pruned and fetched on demand
+	for _, paths := range [][]string{{"/bin/sh", "/db.img"}, {"/bin/sh"}} {
+		_, err = client.ImageRemove(ctx, ref, types.ImageRemoveOptions{Force: true})
+		assert.NilError(t, err)
+		rc, err = client.ImagePull(ctx, ref, types.ImagePullOptions{
+			Simplify:           true,
+			SimplifyUseProfile: &types.ImageProfile{Paths: paths},
+			SimplifyForce:      true,
+		})
+		assert.NilError(t, err)
+		_, err = io.Copy(ioutil.Discard, rc)
+		rc.Close()
+		assert.NilError(t, err)
+
+		cID := container.Create(t, ctx, client, container.WithImage(ref), container.WithCmd("sleep", "300"))
+		assert.NilError(t, client.ContainerStart(ctx, cID, simplifiedStartOptions()))
+		res, err := container.Exec(ctx, client, cID, []string{"sh", "-c", "stat -c %s /db.img && du -k /db.img | cut -f1 && dd if=/db.img bs=1M skip=512 count=1 2>/dev/null | md5sum"})
+		assert.NilError(t, err)
+		assert.Assert(t, is.Equal(res.ExitCode, 0), res.Combined())
+		lines := strings.Split(strings.TrimSpace(res.Stdout()), "\n")
+		assert.Assert(t, is.Len(lines, 3), res.Stdout())
+		assert.Check(t, is.Equal(lines[0], "1073741824"), paths)
+		// only the data takes space
+		kb, err := strconv.Atoi(lines[1])
+		assert.NilError(t, err)
+		assert.Check(t, kb < 4096, "%v: %d KB used", paths, kb)
+		assert.Check(t, is.Equal(strings.Fields(lines[2])[0], fmt.Sprintf("%x", md5.Sum(data.Data))), paths)
+		assert.NilError(t, client.ContainerRemove(ctx, cID, types.ContainerRemoveOptions{Force: true}))
+	}
+}
+
+func TestSimplifiedPlaceholders(t *testing.T) {
+	skip.If(t, testEnv.DaemonInfo.OSType != "linux")
+	skip.If(t, testEnv.IsRemoteDaemon(), "cannot start a daemon with simplify placeholders")
+	_, err := os.Stat("/sys/module/overlay/parameters/fetch_helper")
+	skip.If(t, err != nil, "overlay module has no fetch helper support")
+	skip.If(t, !requirement.HasHubConnectivity(t))
+
+	d := daemon.New(t)
+	d.Start(t, "--storage-driver=overlay2", "--simplify-placeholders")
+	defer d.Stop(t)
+	client := d.NewClientT(t)
+	defer client.Close()
+	ctx := context.Background()
+
+	rc, err := client.ImagePull(ctx, "alpine:3.8", types.ImagePullOptions{Simplify: true})
+	assert.NilError(t, err)
+	_, err = io.Copy(ioutil.Discard, rc)
+	rc.Close()
+	assert.NilError(t, err)
+
+	cID := container.Create(t, ctx, client, container.WithImage("alpine:3.8"))
+	assert.NilError(t, client.ContainerStart(ctx, cID, simplifiedStartOptions()))
+	res, err := container.Exec(ctx, client, cID, []string{"sh", "-c", "true"})
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(res.ExitCode, 0))
+	simplified, err := client.ContainerCommit(ctx, cID, types.ContainerCommitOptions{Simp: true})
+	assert.NilError(t, err)
+
+	// stat() does not open the files, so the placeholders are listed with
+	// the metadata of the full image without being fetched
+	stat := []string{"sh", "-c", "find /etc /lib /usr -xdev ! -type d -exec stat -c '%u:%g %a %s %Y %n' {} + | sort"}
+	full := container.Run(t, ctx, client, container.WithImage("alpine:3.8"))
+	expected, err := container.Exec(ctx, client, full, stat)
+	assert.NilError(t, err)
+	assert.Assert(t, is.Equal(expected.ExitCode, 0), expected.Combined())
+
+	cID = container.Run(t, ctx, client, container.WithImage(simplified.ID))
+	res, err = container.Exec(ctx, client, cID, stat)
+	assert.NilError(t, err)
+	assert.Assert(t, is.Equal(res.ExitCode, 0), res.Combined())
+	assert.Check(t, is.Equal(res.Stdout(), expected.Stdout()))
+
+	// /etc/group was pruned, and opening its placeholder fetches it
+	res, err = container.Exec(ctx, client, cID, []string{"sh", "-c", `read l < /etc/group && echo "$l"`})
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(res.ExitCode, 0), res.Combined())
+	assert.Check(t, is.Equal(res.Stdout(), "root:x:0:root\n"))
+
+	// truncating a placeholder does not fetch it, and leaves a regular file
+	res, err = container.Exec(ctx, client, cID, []string{"sh", "-c", "echo new > /etc/shells && cat /etc/shells"})
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(res.ExitCode, 0), res.Combined())
+	assert.Check(t, is.Equal(res.Stdout(), "new\n"))
+}
+
+// loadWithLayer loads the image base with the layer added on top of it, a
+// tar stream written as is, tagged ref.
+func loadWithLayer(t *testing.T, client apiclient.APIClient, base, ref string, layer []byte) {
+	t.Helper()
+	ctx := context.Background()
+	rc, err := client.ImageSave(ctx, []string{base})
+	assert.NilError(t, err)
+	defer rc.Close()
+
+	files := make(map[string][]byte)
+	var names []string
+	tr := tar.NewReader(rc)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.NilError(t, err)
+		b, err := ioutil.ReadAll(tr)
+		assert.NilError(t, err)
+		if hdr.Typeflag == tar.TypeReg {
+			files[hdr.Name] = b
+			names = append(names, hdr.Name)
+		}
+	}
+
+	var manifest []struct {
+		Config   string
+		RepoTags []string
+		Layers   []string
+	}
+	assert.NilError(t, json.Unmarshal(files["manifest.json"], &manifest))
+	assert.Assert(t, is.Len(manifest, 1))
+	var config map[string]interface{}
+	assert.NilError(t, json.Unmarshal(files[manifest[0].Config], &config))
+	rootfs := config["rootfs"].(map[string]interface{})
+	rootfs["diff_ids"] = append(rootfs["diff_ids"].([]interface{}), digest.FromBytes(layer).String())
+	config["history"] = append(config["history"].([]interface{}), map[string]string{"created_by": "sparse layer"})
+	b, err := json.Marshal(config)
+	assert.NilError(t, err)
+	configName := digest.FromBytes(b).Hex() + ".json"
+	files[configName] = b
+	layerName := digest.FromBytes(layer).Hex() + "/layer.tar"
+	files[layerName] = layer
+	manifest[0].Config = configName
+	manifest[0].RepoTags = []string{ref}
+	manifest[0].Layers = append(manifest[0].Layers, layerName)
+	b, err = json.Marshal(manifest)
+	assert.NilError(t, err)
+	files["manifest.json"] = b
+	names = append(names, configName, layerName)
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, name := range names {
+		if name == "repositories" {
+			continue
+		}
+		assert.NilError(t, tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(files[name]))}))
+		_, err := tw.Write(files[name])
+		assert.NilError(t, err)
+	}
+	assert.NilError(t, tw.Close())
+	res, err := client.ImageLoad(ctx, &buf, true)
+	assert.NilError(t, err)
+	defer res.Body.Close()
+	_, err = io.Copy(ioutil.Discard, res.Body)
+	assert.NilError(t, err)
+}
+
+// commit commits the container and returns the ID of the new image.
+func commit(t *testing.T, cID string, query ...string) string {
+	t.Helper()
+	path := "/commit?container=" + cID
+	for _, q := range query {
+		path += "&" + q
+	}
+	res, body, err := request.Post(path)
+	assert.NilError(t, err)
+	b, err := request.ReadBody(body)
+	assert.NilError(t, err)
+	assert.Assert(t, is.Equal(res.StatusCode, http.StatusCreated), string(b))
+
+	var id types.IDResponse
+	assert.NilError(t, json.Unmarshal(b, &id))
+	return id.ID
+}
+
+// simplifiedStartOptions starts a container on its simplified image.
+func simplifiedStartOptions() types.ContainerStartOptions {
+	simp := true
+	return types.ContainerStartOptions{Simp: &simp}
+}
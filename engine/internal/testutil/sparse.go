@@ -0,0 +1,54 @@
+package testutil // import "github.com/docker/docker/internal/testutil"
+
+import (
+	"fmt"
+)
+
+// SparseData is a data segment of a sparse file.
+type SparseData struct {
+	Offset int64
+	Data   []byte
+}
+
+// GNUSparseEntry returns the records of a regular file named name and size
+// bytes long in the old GNU sparse format, as written by GNU tar --sparse.
+// The file holds the data segments, which must be in order, and holes
+// elsewhere. At most 4 segments fit in the header.
+func GNUSparseEntry(name string, size int64, segments ...SparseData) []byte {
+	if len(segments) > 4 {
+		panic("too many sparse segments")
+	}
+	var (
+		blk  [512]byte
+		data []byte
+	)
+	octal := func(b []byte, v int64) {
+		copy(b, fmt.Sprintf("%0*o", len(b)-1, v))
+	}
+	copy(blk[0:100], name)
+	octal(blk[100:108], 0644)
+	octal(blk[108:116], 0)
+	octal(blk[116:124], 0)
+	octal(blk[136:148], 0)
+	blk[156] = 'S'
+	copy(blk[257:265], "ustar  \x00")
+	for i, s := range segments {
+		octal(blk[386+i*24:398+i*24], s.Offset)
+		octal(blk[398+i*24:410+i*24], int64(len(s.Data)))
+		data = append(data, s.Data...)
+	}
+	octal(blk[124:136], int64(len(data)))
+	octal(blk[483:495], size)
+
+	copy(blk[148:156], "        ")
+	var chksum int64
+	for _, c := range blk {
+		chksum += int64(c)
+	}
+	copy(blk[148:156], fmt.Sprintf("%06o\x00 ", chksum))
+
+	if pad := len(data) % 512; pad > 0 {
+		data = append(data, make([]byte, 512-pad)...)
+	}
+	return append(blk[:], data...)
+}
@@ -14,6 +14,7 @@ import (
 	"io"
 
 	"github.com/docker/distribution"
+	"github.com/docker/docker/daemon/graphdriver"
 	"github.com/docker/docker/pkg/archive"
 	"github.com/docker/docker/pkg/containerfs"
 	"github.com/opencontainers/go-digest"
@@ -129,6 +130,13 @@ type RWLayer interface {
 	// the to the writable layer.
 	Mount(mountLabel string) (containerfs.ContainerFS, error)
 
+	// 修改： 精简容器的挂载带有simp参数
+	// MountWithOpts is Mount with the options of the mount. Mounting in
+	// simplified mode fails, caused by graphdriver.ErrSimplifyNotSupported,
+	// if the driver cannot.
+	MountWithOpts(opts graphdriver.MountOpts) (containerfs.ContainerFS, error)
+	// 修改
+
 	// Unmount unmounts the RWLayer. This should be called
 	// for every mount. If there are multiple mount calls
 	// this operation will only decrement the internal mount counter.
@@ -201,6 +209,16 @@ type DescribableStore interface {
 	RegisterWithDescriptor(io.Reader, ChainID, distribution.Descriptor) (Layer, error)
 }
 
+// SimplifyStore represents a layer store capable of building the
+// layers of simplified images from the layers of their full image.
+type SimplifyStore interface {
+	// RegisterSimplified registers the tar stream of a layer without a
+	// parent whose files are all from the layer chain full, or added over
+	// it. Drivers able to are left to build the layer from a clone of
+	// full.
+	RegisterSimplified(io.Reader, ChainID) (Layer, error)
+}
+
 // CreateChainID returns ID for a layerDigest slice
 func CreateChainID(dgsts []DiffID) ChainID {
 	return createChainIDFromParent("", dgsts...)
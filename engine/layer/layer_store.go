@@ -231,7 +231,9 @@ func (ls *layerStore) loadMount(mount string) error {
 	return nil
 }
 
-func (ls *layerStore) applyTar(tx *fileMetadataTransaction, ts io.Reader, parent string, layer *roLayer) error {
+// 修改： 添加source参数，非空时由驱动从该层的克隆构建精简层
+func (ls *layerStore) applyTar(tx *fileMetadataTransaction, ts io.Reader, parent, source string, layer *roLayer) error {
+	// 修改
 	digester := digest.Canonical.Digester()
 	tr := io.TeeReader(ts, digester.Hash())
 
@@ -252,7 +254,15 @@ func (ls *layerStore) applyTar(tx *fileMetadataTransaction, ts io.Reader, parent
 		}
 	}
 
-	applySize, err := ls.driver.ApplyDiff(layer.cacheID, parent, rdr)
+	// 修改： 精简层由驱动从完整镜像层的克隆构建
+	var applySize int64
+	var err error
+	if source != "" {
+		applySize, err = ls.driver.(graphdriver.SimplifyApplyDriver).ApplySimplifiedDiff(layer.cacheID, source, rdr)
+	} else {
+		applySize, err = ls.driver.ApplyDiff(layer.cacheID, parent, rdr)
+	}
+	// 修改
 	if err != nil {
 		return err
 	}
@@ -273,6 +283,24 @@ func (ls *layerStore) Register(ts io.Reader, parent ChainID) (Layer, error) {
 }
 
 func (ls *layerStore) registerWithDescriptor(ts io.Reader, parent ChainID, descriptor distribution.Descriptor) (Layer, error) {
+	return ls.register(ts, parent, descriptor, "")
+}
+
+// 修改： 精简镜像的层由驱动从完整镜像层的克隆构建
+
+// RegisterSimplified registers ts, the tar stream of a layer without a
+// parent made of files of the layer chain full, or added over it. If the
+// driver implements graphdriver.SimplifyApplyDriver, it builds the layer
+// from a clone of full rather than extracting ts.
+func (ls *layerStore) RegisterSimplified(ts io.Reader, full ChainID) (Layer, error) {
+	return ls.register(ts, "", distribution.Descriptor{}, full)
+}
+
+// 修改
+
+// register registers ts on parent. If full is set, the layer has no parent
+// and is built from a clone of full if the driver can.
+func (ls *layerStore) register(ts io.Reader, parent ChainID, descriptor distribution.Descriptor, full ChainID) (Layer, error) {
 	// err is used to hold the error which will always trigger
 	// cleanup of creates sources but may not be an error returned
 	// to the caller (already exists).
@@ -310,9 +338,23 @@ func (ls *layerStore) registerWithDescriptor(ts io.Reader, parent ChainID, descr
 		descriptor:     descriptor,
 	}
 
-	if err = ls.driver.Create(layer.cacheID, pid, nil); err != nil {
+	// 修改： 驱动支持时从完整镜像层克隆，克隆完成后不再依赖该层的引用
+	var source string
+	if _, ok := ls.driver.(graphdriver.SimplifyApplyDriver); ok && full != "" {
+		f := ls.get(full)
+		if f == nil {
+			return nil, ErrLayerDoesNotExist
+		}
+		defer func() {
+			ls.layerL.Lock()
+			ls.releaseLayer(f)
+			ls.layerL.Unlock()
+		}()
+		source = f.cacheID
+	} else if err = ls.driver.Create(layer.cacheID, pid, nil); err != nil {
 		return nil, err
 	}
+	// 修改
 
 	tx, err := ls.store.StartTransaction()
 	if err != nil {
@@ -331,7 +373,7 @@ func (ls *layerStore) registerWithDescriptor(ts io.Reader, parent ChainID, descr
 		}
 	}()
 
-	if err = ls.applyTar(tx, ts, pid, layer); err != nil {
+	if err = ls.applyTar(tx, ts, pid, source, layer); err != nil {
 		return nil, err
 	}
 
@@ -766,3 +766,71 @@ func TestTarStreamVerification(t *testing.T) {
 		t.Fatalf("wrong error returned from tarstream: %q", err)
 	}
 }
+
+// simplifyApplyDriver builds the layers of simplified images as it does
+// other layers, recording the source it was given.
+type simplifyApplyDriver struct {
+	graphdriver.Driver
+	source string
+}
+
+func (d *simplifyApplyDriver) ApplySimplifiedDiff(id, source string, diff io.Reader) (int64, error) {
+	d.source = source
+	if err := d.Create(id, "", nil); err != nil {
+		return 0, err
+	}
+	return d.ApplyDiff(id, "", diff)
+}
+
+func TestRegisterSimplified(t *testing.T) {
+	fullFiles := []FileApplier{
+		newTestFile("/etc/profile", []byte("# Base configuration"), 0644),
+		newTestFile("/bin/sh", []byte("#!/bin/sh"), 0755),
+	}
+	simplifiedFiles := []FileApplier{
+		newTestFile("/bin/sh", []byte("#!/bin/sh"), 0755),
+	}
+	tar1, err := tarFromFiles(simplifiedFiles...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, clone := range []bool{false, true} {
+		td, err := ioutil.TempDir("", "layerstore-")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(td)
+		graph, graphcleanup := newTestGraphDriver(t)
+		defer graphcleanup()
+		driver := &simplifyApplyDriver{Driver: graph}
+		if clone {
+			graph = driver
+		}
+		ls, err := newStoreFromGraphDriver(td, graph, runtime.GOOS)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		full, err := createLayer(ls, "", initWithFiles(fullFiles...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		simplified, err := ls.(SimplifyStore).RegisterSimplified(bytes.NewReader(tar1), full.ChainID())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if simplified.Parent() != nil {
+			t.Fatalf("Simplified layer has parent %s, expecting none", simplified.Parent().ChainID())
+		}
+		if expected := DiffID(digest.FromBytes(tar1)); simplified.DiffID() != expected {
+			t.Fatalf("Unexpected diff ID %s, expecting %s", simplified.DiffID(), expected)
+		}
+		assertLayerDiff(t, tar1, simplified)
+		if clone && driver.source != cacheID(full) {
+			t.Fatalf("Simplified layer built from %q, expecting %q", driver.source, cacheID(full))
+		}
+		// the reference taken on the full layer while cloning it is released
+		assertReferences(t, full)
+	}
+}
@@ -7,8 +7,10 @@ import (
 	"testing"
 
 	"github.com/containerd/continuity/driver"
+	"github.com/docker/docker/daemon/graphdriver"
 	"github.com/docker/docker/pkg/archive"
 	"github.com/docker/docker/pkg/containerfs"
+	"github.com/pkg/errors"
 )
 
 func TestMountInit(t *testing.T) {
@@ -237,3 +239,40 @@ func (cs *changeSorter) Swap(i, j int) {
 func (cs *changeSorter) Less(i, j int) bool {
 	return cs.changes[i].Path < cs.changes[j].Path
 }
+
+func TestMountWithOptsSimplifyNotSupported(t *testing.T) {
+	// TODO Windows: Figure out why this is failing
+	if runtime.GOOS == "windows" {
+		t.Skip("Failing on Windows")
+	}
+	ls, _, cleanup := newTestStore(t)
+	defer cleanup()
+
+	layer, err := createLayer(ls, "", initWithFiles(newTestFile("testfile.txt", []byte("base data!"), 0644)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := ls.CreateRWLayer("simplify-mount", layer.ChainID(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The test store's driver cannot mount layers in simplified mode.
+	_, err = m.MountWithOpts(graphdriver.MountOpts{Simplify: graphdriver.SimplifyOptions{Record: true}})
+	if errors.Cause(err) != graphdriver.ErrSimplifyNotSupported {
+		t.Fatalf("Unexpected error %v, expected %v", err, graphdriver.ErrSimplifyNotSupported)
+	}
+
+	// Without simplify options it is mounted as by Mount.
+	pathFS, err := m.MountWithOpts(graphdriver.MountOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pathFS.Stat(pathFS.Join(pathFS.Path(), "testfile.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Unmount(); err != nil {
+		t.Fatal(err)
+	}
+}
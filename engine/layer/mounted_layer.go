@@ -3,8 +3,10 @@ package layer // import "github.com/docker/docker/layer"
 import (
 	"io"
 
+	"github.com/docker/docker/daemon/graphdriver"
 	"github.com/docker/docker/pkg/archive"
 	"github.com/docker/docker/pkg/containerfs"
+	"github.com/pkg/errors"
 )
 
 type mountedLayer struct {
@@ -93,6 +95,20 @@ func (rl *referencedRWLayer) Mount(mountLabel string) (containerfs.ContainerFS,
 	return rl.layerStore.driver.Get(rl.mountedLayer.mountID, mountLabel)
 }
 
+// 修改： 以simp参数挂载
+func (rl *referencedRWLayer) MountWithOpts(opts graphdriver.MountOpts) (containerfs.ContainerFS, error) {
+	if opts.Simplify.IsZero() {
+		return rl.Mount(opts.MountLabel)
+	}
+	driver, ok := rl.layerStore.driver.(graphdriver.SimplifyMountDriver)
+	if !ok {
+		return nil, errors.Wrapf(graphdriver.ErrSimplifyNotSupported, "storage driver %s cannot mount simplified layers", rl.layerStore.driver)
+	}
+	return driver.GetSimplified(rl.mountedLayer.mountID, opts)
+}
+
+// 修改
+
 // Unmount decrements the activity count and unmounts the underlying layer
 // Callers should only call `Unmount` once per call to `Mount`, even on error.
 func (rl *referencedRWLayer) Unmount() error {
@@ -0,0 +1,200 @@
+package layer // import "github.com/docker/docker/layer"
+
+import (
+	"archive/tar"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/pkg/archive"
+	"github.com/opencontainers/go-digest"
+)
+
+// 修改： 层的tar目录
+
+// TOCEntry locates an entry in the uncompressed tar stream of a layer.
+type TOCEntry struct {
+	// Name is the name of the entry, as found in the tar stream.
+	Name string `json:"name"`
+	// Type is the tar type flag of the entry.
+	Type byte `json:"type"`
+	// Linkname is the target of links.
+	Linkname string `json:"linkname,omitempty"`
+	// Offset is where the records of the entry start, extended headers
+	// included, so that a tar reader started there reads the whole entry.
+	// It is -1 for entries indexed from another format, such as eStargz.
+	Offset int64 `json:"offset"`
+	// Size is the size of the content of regular files.
+	Size int64 `json:"size,omitempty"`
+	// Sparse is set for regular files stored in one of the GNU sparse
+	// formats: only their data is in the tar stream, not their holes.
+	Sparse bool `json:"sparse,omitempty"`
+	// Digest is the digest of the content of regular files.
+	Digest digest.Digest `json:"digest,omitempty"`
+	// Mode, UID and GID are those of the header of the entry. Mode is 0 if
+	// not known, as in tables of contents built before they were recorded.
+	Mode int64 `json:"mode,omitempty"`
+	UID  int   `json:"uid,omitempty"`
+	GID  int   `json:"gid,omitempty"`
+	// ModTime is the modification time of the entry, or the zero time if
+	// not known.
+	ModTime time.Time `json:"modtime,omitempty"`
+	// Devmajor and Devminor are the device numbers of character and block
+	// devices.
+	Devmajor int64 `json:"devmajor,omitempty"`
+	Devminor int64 `json:"devminor,omitempty"`
+	// Xattrs are the extended attributes of the entry, such as the file
+	// capabilities of binaries.
+	Xattrs map[string]string `json:"xattrs,omitempty"`
+}
+
+// TOC is the table of contents of the tar stream of a layer.
+type TOC struct {
+	// Entries are in the order of the tar stream.
+	Entries []TOCEntry `json:"entries"`
+	// End is where the end of the archive starts, or -1 if it is not known.
+	End int64 `json:"end"`
+}
+
+// BuildTOC reads the tar stream r to its end and returns its table of
+// contents. If fn is set, it is called with every entry once its content has
+// been read, along with the offset the records of the entry end at. Sparse
+// files are recorded as regular files.
+func BuildTOC(r io.Reader, fn func(e *TOCEntry, end int64) error) (*TOC, error) {
+	cr := &countingReader{r: r}
+	tr := tar.NewReader(cr)
+	toc := &TOC{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		e := TOCEntry{Name: hdr.Name, Type: hdr.Typeflag, Offset: toc.End, Mode: hdr.Mode, UID: hdr.Uid, GID: hdr.Gid, ModTime: hdr.ModTime, Xattrs: hdr.Xattrs}
+		switch hdr.Typeflag {
+		case tar.TypeLink, tar.TypeSymlink:
+			e.Linkname = hdr.Linkname
+		case tar.TypeChar, tar.TypeBlock:
+			e.Devmajor, e.Devminor = hdr.Devmajor, hdr.Devminor
+		case tar.TypeGNUSparse:
+			e.Type = tar.TypeReg
+		}
+		if e.Type == tar.TypeReg || e.Type == tar.TypeRegA {
+			e.Size = hdr.Size
+			e.Sparse = archive.IsSparse(hdr)
+			digester := digest.Canonical.Digester()
+			if _, err := io.Copy(digester.Hash(), tr); err != nil {
+				return nil, err
+			}
+			e.Digest = digester.Digest()
+		} else if _, err := io.Copy(ioutil.Discard, tr); err != nil {
+			return nil, err
+		}
+		// tar.Reader不会预读，读完内容后位于其末尾；稀疏文件的空洞不在流中，
+		// 因此以读取的位置而不是文件大小计算。内容按512字节的块对齐
+		toc.End = (cr.n + 511) / 512 * 512
+		if fn != nil {
+			if err := fn(&e, toc.End); err != nil {
+				return nil, err
+			}
+		}
+		toc.Entries = append(toc.Entries, e)
+	}
+	// tar.Reader不会读取归档结尾之后的填充
+	if _, err := io.Copy(ioutil.Discard, cr); err != nil {
+		return nil, err
+	}
+	return toc, nil
+}
+
+// Index returns the index of the entry named p, an absolute path, or -1.
+func (toc *TOC) Index(p string) int {
+	p = path.Clean("/" + p)
+	for n, e := range toc.Entries {
+		if path.Clean("/"+e.Name) == p {
+			return n
+		}
+	}
+	return -1
+}
+
+// Lookup returns the index of the entry of the layer for p, an absolute
+// path, or -1 if the layer does not have it. hidden is true if the layer
+// hides p in the layers beneath it, with a whiteout or an opaque directory.
+func (toc *TOC) Lookup(p string) (n int, hidden bool) {
+	p = path.Clean("/" + p)
+	whiteouts := make(map[string]bool)
+	opaques := make(map[string]bool)
+	for a := p; a != "/"; a = path.Dir(a) {
+		whiteouts[path.Join(path.Dir(a), archive.WhiteoutPrefix+path.Base(a))] = true
+		opaques[path.Join(path.Dir(a), archive.WhiteoutOpaqueDir)] = true
+	}
+	n = -1
+	for i, e := range toc.Entries {
+		name := path.Clean("/" + e.Name)
+		switch {
+		case name == p:
+			n = i
+		case whiteouts[name], opaques[name]:
+			hidden = true
+		}
+	}
+	if n >= 0 {
+		return n, true
+	}
+	return -1, hidden
+}
+
+// LinkGroup returns the indexes of the entries sharing the content of the
+// n-th entry, in the order of the tar stream: the regular file holding it,
+// then the hard links to it. It returns nil if no hard link shares it.
+func (toc *TOC) LinkGroup(n int) []int {
+	primary := n
+	if e := toc.Entries[n]; e.Type == tar.TypeLink {
+		if primary = toc.Index(e.Linkname); primary < 0 {
+			return nil
+		}
+	}
+	name := path.Clean("/" + toc.Entries[primary].Name)
+	group := []int{primary}
+	for i, e := range toc.Entries {
+		if e.Type == tar.TypeLink && path.Clean("/"+e.Linkname) == name {
+			group = append(group, i)
+		}
+	}
+	if len(group) == 1 {
+		return nil
+	}
+	return group
+}
+
+// FileSize returns the total size of the regular files of the layer.
+func (toc *TOC) FileSize() int64 {
+	var size int64
+	for _, e := range toc.Entries {
+		size += e.Size
+	}
+	return size
+}
+
+// IsWhiteout returns true if the entry marks files of lower layers deleted.
+func (e *TOCEntry) IsWhiteout() bool {
+	return strings.HasPrefix(path.Base(e.Name), archive.WhiteoutPrefix)
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+// 修改
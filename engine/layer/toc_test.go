@@ -0,0 +1,161 @@
+package layer // import "github.com/docker/docker/layer"
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/internal/testutil"
+	"github.com/opencontainers/go-digest"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+func TestBuildTOC(t *testing.T) {
+	mtime := time.Unix(1500000000, 0)
+	longName := "usr/share/" + strings.Repeat("long/", 30) + "file"
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, e := range []struct {
+		hdr     tar.Header
+		content string
+	}{
+		{hdr: tar.Header{Name: "bin/", Typeflag: tar.TypeDir, Mode: 0755}},
+		{hdr: tar.Header{Name: "bin/sh", Typeflag: tar.TypeReg, Mode: 0755, Uid: 1, Gid: 2, ModTime: mtime}, content: "#!sh"},
+		{hdr: tar.Header{Name: "bin/dash", Typeflag: tar.TypeLink, Linkname: "bin/sh"}},
+		// names too long for the ustar header are split across extended headers
+		{hdr: tar.Header{Name: longName, Typeflag: tar.TypeReg, Mode: 0644, Format: tar.FormatPAX}, content: strings.Repeat("x", 1000)},
+		{hdr: tar.Header{Name: "usr/gnu-" + strings.Repeat("g", 120), Typeflag: tar.TypeReg, Mode: 0644, Format: tar.FormatGNU}, content: "gnu"},
+		{hdr: tar.Header{Name: "etc/xattr", Typeflag: tar.TypeReg, Mode: 0644, PAXRecords: map[string]string{"SCHILY.xattr.user.key": "value"}}, content: "attr"},
+		{hdr: tar.Header{Name: "dev/null", Typeflag: tar.TypeChar, Mode: 0666, Devmajor: 1, Devminor: 3}},
+	} {
+		e.hdr.Size = int64(len(e.content))
+		assert.NilError(t, tw.WriteHeader(&e.hdr))
+		_, err := tw.Write([]byte(e.content))
+		assert.NilError(t, err)
+	}
+	assert.NilError(t, tw.Close())
+	layer := buf.Bytes()
+
+	var ends []int64
+	toc, err := BuildTOC(bytes.NewReader(layer), func(e *TOCEntry, end int64) error {
+		ends = append(ends, end)
+		return nil
+	})
+	assert.NilError(t, err)
+	assert.Assert(t, is.Len(toc.Entries, 7))
+	assert.Check(t, is.Equal(toc.Entries[0].Offset, int64(0)))
+	assert.Check(t, is.Equal(toc.Entries[2].Linkname, "bin/sh"))
+	assert.Check(t, is.Equal(toc.Entries[1].Digest, digest.FromString("#!sh")))
+	assert.Check(t, is.Equal(toc.Entries[1].Mode, int64(0755)))
+	assert.Check(t, is.Equal(toc.Entries[1].UID, 1))
+	assert.Check(t, is.Equal(toc.Entries[1].GID, 2))
+	assert.Check(t, toc.Entries[1].ModTime.Equal(mtime))
+	assert.Check(t, is.DeepEqual(toc.Entries[5].Xattrs, map[string]string{"user.key": "value"}))
+	assert.Check(t, is.Equal(toc.Entries[6].Devmajor, int64(1)))
+	assert.Check(t, is.Equal(toc.Entries[6].Devminor, int64(3)))
+	assert.Check(t, is.Equal(toc.FileSize(), int64(4+1000+3+4)))
+
+	// a tar reader started at the offset of an entry reads all of it
+	for n, e := range toc.Entries {
+		if n+1 < len(toc.Entries) {
+			assert.Check(t, is.Equal(ends[n], toc.Entries[n+1].Offset))
+		}
+		tr := tar.NewReader(bytes.NewReader(layer[e.Offset:]))
+		hdr, err := tr.Next()
+		assert.NilError(t, err)
+		assert.Check(t, is.Equal(hdr.Name, e.Name))
+		if e.Digest != "" {
+			b, err := ioutil.ReadAll(tr)
+			assert.NilError(t, err)
+			assert.Check(t, is.Equal(digest.FromBytes(b), e.Digest))
+		}
+	}
+	assert.Check(t, is.Equal(toc.Entries[3].Name, longName))
+	assert.Check(t, is.Equal(toc.End, ends[len(ends)-1]))
+	assert.Check(t, bytes.Equal(layer[toc.End:], make([]byte, len(layer)-int(toc.End))))
+}
+
+func TestBuildTOCSparse(t *testing.T) {
+	size := int64(1 << 30)
+	data := testutil.SparseData{Offset: 1 << 20, Data: bytes.Repeat([]byte("x"), 1<<20)}
+	var buf bytes.Buffer
+	buf.Write(testutil.GNUSparseEntry("var/lib/db", size, data))
+	tw := tar.NewWriter(&buf)
+	assert.NilError(t, tw.WriteHeader(&tar.Header{Name: "etc/db.conf", Typeflag: tar.TypeReg, Mode: 0644, Size: 4}))
+	_, err := tw.Write([]byte("conf"))
+	assert.NilError(t, err)
+	assert.NilError(t, tw.Close())
+	layer := buf.Bytes()
+
+	toc, err := BuildTOC(bytes.NewReader(layer), nil)
+	assert.NilError(t, err)
+	assert.Assert(t, is.Len(toc.Entries, 2))
+	e := toc.Entries[0]
+	assert.Check(t, is.Equal(e.Type, byte(tar.TypeReg)))
+	assert.Check(t, e.Sparse)
+	assert.Check(t, is.Equal(e.Size, size))
+	digester := digest.Canonical.Digester()
+	io.CopyN(digester.Hash(), testutil.DevZero, data.Offset)
+	digester.Hash().Write(data.Data)
+	io.CopyN(digester.Hash(), testutil.DevZero, size-data.Offset-int64(len(data.Data)))
+	assert.Check(t, is.Equal(e.Digest, digester.Digest()))
+
+	// only the data of the sparse file is in the tar stream
+	assert.Check(t, is.Equal(toc.Entries[1].Offset, int64(512+1<<20)))
+	assert.Check(t, !toc.Entries[1].Sparse)
+	hdr, err := tar.NewReader(bytes.NewReader(layer[toc.Entries[1].Offset:])).Next()
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(hdr.Name, "etc/db.conf"))
+	assert.Check(t, is.Equal(toc.End, int64(512+1<<20+1024)))
+}
+
+func TestTOCLookup(t *testing.T) {
+	toc := &TOC{Entries: []TOCEntry{
+		{Name: "etc/", Type: tar.TypeDir},
+		{Name: "etc/app.conf", Type: tar.TypeReg},
+		{Name: "etc/.wh.old.conf", Type: tar.TypeReg},
+		{Name: "var/cache/.wh..wh..opq", Type: tar.TypeReg},
+		{Name: "var/cache/new", Type: tar.TypeReg},
+		{Name: "opt/.wh.app", Type: tar.TypeReg},
+	}}
+	for _, tc := range []struct {
+		path   string
+		index  int
+		hidden bool
+	}{
+		{path: "/etc/app.conf", index: 1, hidden: true},
+		{path: "etc/app.conf", index: 1, hidden: true},
+		{path: "/etc/other.conf", index: -1},
+		{path: "/etc/old.conf", index: -1, hidden: true},
+		{path: "/var/cache/old", index: -1, hidden: true},
+		{path: "/var/cache/new", index: 4, hidden: true},
+		{path: "/opt/app/bin/app", index: -1, hidden: true},
+		{path: "/opt/other", index: -1},
+	} {
+		index, hidden := toc.Lookup(tc.path)
+		assert.Check(t, is.Equal(index, tc.index), tc.path)
+		assert.Check(t, is.Equal(hidden, tc.hidden), tc.path)
+	}
+	assert.Check(t, is.Equal(toc.Index("/etc/app.conf"), 1))
+	assert.Check(t, is.Equal(toc.Index("/etc/missing"), -1))
+}
+
+func TestTOCLinkGroup(t *testing.T) {
+	toc := &TOC{Entries: []TOCEntry{
+		{Name: "bin/", Type: tar.TypeDir},
+		{Name: "bin/busybox", Type: tar.TypeReg},
+		{Name: "bin/ls", Type: tar.TypeLink, Linkname: "bin/busybox"},
+		{Name: "bin/sh", Type: tar.TypeLink, Linkname: "/bin/busybox"},
+		{Name: "bin/env", Type: tar.TypeReg},
+		{Name: "bin/cat", Type: tar.TypeLink, Linkname: "bin/missing"},
+	}}
+	assert.Check(t, is.DeepEqual(toc.LinkGroup(1), []int{1, 2, 3}))
+	assert.Check(t, is.DeepEqual(toc.LinkGroup(3), []int{1, 2, 3}))
+	assert.Check(t, is.Len(toc.LinkGroup(4), 0))
+	assert.Check(t, is.Len(toc.LinkGroup(5), 0))
+}
@@ -595,7 +595,8 @@ func createTarFile(path, extractDir string, hdr *tar.Header, reader io.Reader, L
 			}
 		}
 
-	case tar.TypeReg, tar.TypeRegA:
+	// 修改： 稀疏文件按普通文件解压，并保留其中的空洞；占位文件截断为原文件的大小，不占用空间
+	case tar.TypeReg, tar.TypeRegA, tar.TypeGNUSparse:
 		// Source is regular file. We use system.OpenFileSequential to use sequential
 		// file access to avoid depleting the standby list on Windows.
 		// On Linux, this equates to a regular os.OpenFile
@@ -603,11 +604,20 @@ func createTarFile(path, extractDir string, hdr *tar.Header, reader io.Reader, L
 		if err != nil {
 			return err
 		}
-		if _, err := io.Copy(file, reader); err != nil {
+		if IsSparse(hdr) {
+			_, err = CopySparse(file, reader)
+		} else {
+			_, err = io.Copy(file, reader)
+		}
+		if size, ok := PlaceholderSize(hdr); ok && err == nil {
+			err = file.Truncate(size)
+		}
+		if err != nil {
 			file.Close()
 			return err
 		}
 		file.Close()
+	// 修改
 
 	case tar.TypeBlock, tar.TypeChar:
 		if inUserns { // cannot create devices in a userns
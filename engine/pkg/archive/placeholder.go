@@ -0,0 +1,31 @@
+package archive // import "github.com/docker/docker/pkg/archive"
+
+import (
+	"archive/tar"
+	"strconv"
+)
+
+// 修改： 精简镜像中的占位文件
+
+// PlaceholderXattr marks the placeholder of a file pruned from a simplified
+// image. Its value is the size of the file, in decimal. A placeholder is a
+// regular file without content that has the name, mode, owner and times of
+// the file, so that listing and stat()ing it look as on the full image. The
+// overlay module fetches the file when the placeholder is opened.
+const PlaceholderXattr = "trusted.simplify.placeholder"
+
+// PlaceholderSize returns the size of the file hdr is the placeholder of, and
+// whether it is one.
+func PlaceholderSize(hdr *tar.Header) (int64, bool) {
+	value, ok := hdr.Xattrs[PlaceholderXattr]
+	if !ok {
+		return 0, false
+	}
+	size, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || size < 0 {
+		return 0, false
+	}
+	return size, true
+}
+
+// 修改
@@ -0,0 +1,61 @@
+// +build !windows
+
+package archive // import "github.com/docker/docker/pkg/archive"
+
+import (
+	"archive/tar"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/pkg/system"
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+	"gotest.tools/skip"
+)
+
+func TestPlaceholderSize(t *testing.T) {
+	size, ok := PlaceholderSize(&tar.Header{Xattrs: map[string]string{PlaceholderXattr: "1048576"}})
+	assert.Check(t, ok)
+	assert.Check(t, is.Equal(size, int64(1048576)))
+	_, ok = PlaceholderSize(&tar.Header{Xattrs: map[string]string{"user.key": "value"}})
+	assert.Check(t, !ok)
+	_, ok = PlaceholderSize(&tar.Header{Xattrs: map[string]string{PlaceholderXattr: "-1"}})
+	assert.Check(t, !ok)
+}
+
+func TestCreateTarFilePlaceholder(t *testing.T) {
+	skip.If(t, os.Getuid() != 0, "skipping test that requires root")
+	tmpDir, err := ioutil.TempDir("", "docker-test-placeholder")
+	assert.NilError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	mtime := time.Unix(1500000000, 0)
+	hdr := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     "lib.so",
+		Mode:     0755,
+		ModTime:  mtime,
+		Xattrs:   map[string]string{PlaceholderXattr: "67108864"},
+	}
+	path := filepath.Join(tmpDir, "lib.so")
+	err = createTarFile(path, tmpDir, hdr, strings.NewReader(""), true, nil, false)
+	if err == syscall.ENOTSUP {
+		t.Skip("filesystem does not support trusted xattrs")
+	}
+	assert.NilError(t, err)
+
+	fi, err := os.Lstat(path)
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(fi.Size(), int64(64<<20)))
+	assert.Check(t, is.Equal(fi.Mode(), os.FileMode(0755)))
+	assert.Check(t, fi.ModTime().Equal(mtime))
+	assert.Check(t, fi.Sys().(*syscall.Stat_t).Blocks*512 < fi.Size())
+	value, err := system.Lgetxattr(path, PlaceholderXattr)
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(string(value), "67108864"))
+}
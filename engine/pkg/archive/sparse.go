@@ -0,0 +1,74 @@
+package archive // import "github.com/docker/docker/pkg/archive"
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"os"
+	"strings"
+)
+
+// 修改： 稀疏文件
+
+// sparseBlockSize is the size of the blocks of zeros CopySparse leaves as
+// holes.
+const sparseBlockSize = 4096
+
+// IsSparse returns true if hdr is the header of a regular file stored in one
+// of the GNU sparse formats, whose holes are not in the tar stream.
+func IsSparse(hdr *tar.Header) bool {
+	if hdr.Typeflag == tar.TypeGNUSparse {
+		return true
+	}
+	for k := range hdr.PAXRecords {
+		if strings.HasPrefix(k, "GNU.sparse.") {
+			return true
+		}
+	}
+	return false
+}
+
+// CopySparse copies r to f, seeking over the blocks of zeros rather than
+// writing them, so that they are left as holes where the filesystem of f
+// supports them. It returns the number of bytes copied, which is the size
+// of f if it was empty.
+func CopySparse(f *os.File, r io.Reader) (int64, error) {
+	var (
+		buf  = make([]byte, sparseBlockSize)
+		zero = make([]byte, sparseBlockSize)
+		n    int64
+		hole bool
+	)
+	for {
+		m, err := io.ReadFull(r, buf)
+		if m > 0 {
+			if bytes.Equal(buf[:m], zero[:m]) {
+				if _, err := f.Seek(int64(m), io.SeekCurrent); err != nil {
+					return n, err
+				}
+				hole = true
+			} else {
+				if _, err := f.Write(buf[:m]); err != nil {
+					return n, err
+				}
+				hole = false
+			}
+			n += int64(m)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return n, err
+		}
+	}
+	if hole {
+		// 文件以空洞结尾时，只有截断才能设置其大小
+		if err := f.Truncate(n); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// 修改
@@ -0,0 +1,59 @@
+// +build !windows
+
+package archive // import "github.com/docker/docker/pkg/archive"
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+func TestIsSparse(t *testing.T) {
+	assert.Check(t, IsSparse(&tar.Header{Typeflag: tar.TypeGNUSparse}))
+	assert.Check(t, IsSparse(&tar.Header{Typeflag: tar.TypeReg, PAXRecords: map[string]string{"GNU.sparse.realsize": "1048576"}}))
+	assert.Check(t, !IsSparse(&tar.Header{Typeflag: tar.TypeReg, PAXRecords: map[string]string{"SCHILY.xattr.user.key": "value"}}))
+}
+
+func TestCopySparse(t *testing.T) {
+	f, err := ioutil.TempFile("", "sparse")
+	assert.NilError(t, err)
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	data := strings.Repeat("x", 2*sparseBlockSize)
+	content := io.MultiReader(
+		strings.NewReader(data),
+		bytes.NewReader(make([]byte, 64<<20)),
+		strings.NewReader(data),
+		// a trailing hole
+		bytes.NewReader(make([]byte, 64<<20)),
+	)
+	n, err := CopySparse(f, content)
+	assert.NilError(t, err)
+	size := int64(2*len(data) + 128<<20)
+	assert.Check(t, is.Equal(n, size))
+
+	fi, err := f.Stat()
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(fi.Size(), size))
+	// only the data takes space, where the filesystem supports holes
+	if blocks := fi.Sys().(*syscall.Stat_t).Blocks * 512; blocks >= size {
+		t.Skip("filesystem does not support holes")
+	}
+
+	b := make([]byte, len(data))
+	_, err = f.ReadAt(b, 64<<20+int64(len(data)))
+	assert.NilError(t, err)
+	assert.Check(t, is.Equal(string(b), data))
+	_, err = f.ReadAt(b, int64(len(data)))
+	assert.NilError(t, err)
+	assert.Check(t, bytes.Equal(b, make([]byte, len(b))))
+}
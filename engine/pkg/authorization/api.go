@@ -65,6 +65,12 @@ type Request struct {
 	// RequestPeerCertificates stores the request's TLS peer certificates in PEM format
 	RequestPeerCertificates []*PeerCertificate `json:"RequestPeerCertificates,omitempty"`
 
+	// 修改： 请求的精简参数，供插件按镜像允许或拒绝精简
+	// Simplify describes the image simplification the request asks for, if
+	// any
+	Simplify *Simplify `json:"Simplify,omitempty"`
+	// 修改
+
 	// ResponseStatusCode stores the status code returned from docker daemon
 	ResponseStatusCode int `json:"ResponseStatusCode,omitempty"`
 
@@ -75,6 +75,9 @@ func (ctx *Ctx) AuthZRequest(w http.ResponseWriter, r *http.Request) error {
 		RequestURI:      ctx.requestURI,
 		RequestBody:     body,
 		RequestHeaders:  headers(r.Header),
+		// 修改： 解析精简参数
+		Simplify: simplifyRequest(ctx.requestURI, body),
+		// 修改
 	}
 
 	if r.TLS != nil {
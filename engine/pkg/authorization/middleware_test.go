@@ -1,6 +1,7 @@
 package authorization // import "github.com/docker/docker/pkg/authorization"
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -8,6 +9,7 @@ import (
 
 	"github.com/docker/docker/pkg/plugingetter"
 	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
 )
 
 func TestMiddleware(t *testing.T) {
@@ -46,6 +48,60 @@ func TestNewResponseModifier(t *testing.T) {
 
 }
 
+// denySimplifyPlugin denies simplified pulls of the images of a repository.
+type denySimplifyPlugin struct {
+	repository string
+}
+
+func (p *denySimplifyPlugin) Name() string { return "deny-simplify" }
+
+func (p *denySimplifyPlugin) AuthZRequest(req *Request) (*Response, error) {
+	s := req.Simplify
+	if s != nil && len(s.Parameters["simplify-image"]) > 0 && s.Parameters["simplify-image"][0] == "yes" && strings.HasPrefix(s.Image, p.repository+":") {
+		return &Response{Allow: false, Msg: "simplified images of " + p.repository + " are not allowed"}, nil
+	}
+	return &Response{Allow: true}, nil
+}
+
+func (p *denySimplifyPlugin) AuthZResponse(req *Request) (*Response, error) {
+	return &Response{Allow: true}, nil
+}
+
+func TestMiddlewareDenySimplifiedPull(t *testing.T) {
+	var pluginGetter plugingetter.PluginGetter
+	m := NewMiddleware(nil, pluginGetter)
+	setAuthzPlugins(m, []Plugin{&denySimplifyPlugin{repository: "registry.example.com/secure"}})
+	var called bool
+	handler := m.WrapHandler(func(ctx context.Context, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+		called = true
+		return nil
+	})
+
+	for _, tc := range []struct {
+		uri           string
+		expectedError string
+	}{
+		{
+			uri:           "/v1.39/images/create?fromImage=registry.example.com%2Fsecure&tag=1.0&simplify-image=yes",
+			expectedError: "authorization denied by plugin deny-simplify: simplified images of registry.example.com/secure are not allowed",
+		},
+		{uri: "/v1.39/images/create?fromImage=registry.example.com%2Fsecure&tag=1.0"},
+		{uri: "/v1.39/images/create?fromImage=registry.example.com%2Fsecure&tag=1.0&simplify-image=no"},
+		{uri: "/v1.39/images/create?fromImage=registry.example.com%2Fpublic&tag=1.0&simplify-image=yes"},
+	} {
+		called = false
+		req := httptest.NewRequest("POST", tc.uri, nil)
+		err := handler(context.Background(), httptest.NewRecorder(), req, map[string]string{})
+		if tc.expectedError != "" {
+			assert.Check(t, is.Error(err, tc.expectedError), tc.uri)
+			assert.Check(t, !called, tc.uri)
+			continue
+		}
+		assert.Check(t, err, tc.uri)
+		assert.Check(t, called, tc.uri)
+	}
+}
+
 func setAuthzPlugins(m *Middleware, plugins []Plugin) {
 	m.mu.Lock()
 	m.plugins = plugins
@@ -0,0 +1,146 @@
+package authorization // import "github.com/docker/docker/pkg/authorization"
+
+import (
+	"encoding/json"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Simplify describes the image simplification a request asks for, so that
+// plugins can allow or deny it without parsing the query and body of each
+// endpoint.
+type Simplify struct {
+	// Parameters holds the simplify-* query parameters of the request, such
+	// as simplify-image=yes.
+	Parameters map[string][]string `json:"Parameters,omitempty"`
+
+	// Image is the image simplified: the image pulled by POST /images/create,
+	// or the source image of POST /images/{name}/simplify. It is empty for
+	// POST /containers/{id}/start, whose image is only known to the daemon.
+	Image string `json:"Image,omitempty"`
+
+	// Container is the container committed or started.
+	Container string `json:"Container,omitempty"`
+
+	// Target is the repository:tag the simplified image is tagged with by
+	// POST /commit or POST /images/{name}/simplify.
+	Target string `json:"Target,omitempty"`
+
+	// Profile references the profile the image is simplified with: the image
+	// whose stored profile POST /images/create or POST /images/{name}/simplify
+	// uses, or the image a profile sent in the body was recorded for. It is empty when the profile
+	// stored for the image itself is used.
+	Profile string `json:"Profile,omitempty"`
+
+	// Keep and Prune are the patterns POST /images/{name}/simplify keeps and
+	// prunes files with. Those of POST /commit are in Parameters.
+	Keep  []string `json:"Keep,omitempty"`
+	Prune []string `json:"Prune,omitempty"`
+}
+
+var (
+	versionPrefix = regexp.MustCompile(`^/v[0-9.]+`)
+	startPath     = regexp.MustCompile(`^/containers/([^/]+)/start$`)
+	simplifyPath  = regexp.MustCompile(`^/images/(.+)/simplify$`)
+)
+
+// bodyProfile is the part of the profiles sent in request bodies that
+// references the image they were recorded for.
+type bodyProfile struct {
+	Image     string
+	Reference string
+}
+
+func (p *bodyProfile) ref() string {
+	if p == nil {
+		return ""
+	}
+	if p.Reference != "" {
+		return p.Reference
+	}
+	return p.Image
+}
+
+// simplifyRequest returns the simplification asked for by a request to
+// requestURI with body, or nil if it asks for none. body is nil if it was
+// not sent to the plugins.
+func simplifyRequest(requestURI string, body []byte) *Simplify {
+	u, err := url.ParseRequestURI(requestURI)
+	if err != nil {
+		return nil
+	}
+	p := versionPrefix.ReplaceAllString(u.Path, "")
+	query := u.Query()
+
+	s := &Simplify{}
+	for k, v := range query {
+		if strings.HasPrefix(k, "simplify-") {
+			if s.Parameters == nil {
+				s.Parameters = make(map[string][]string)
+			}
+			s.Parameters[k] = v
+		}
+	}
+
+	switch {
+	case p == "/images/create":
+		if s.Parameters == nil {
+			return nil
+		}
+		s.Image = query.Get("fromImage")
+		if tag := query.Get("tag"); tag != "" && s.Image != "" {
+			s.Image += ":" + tag
+		}
+		s.Profile = query.Get("simplify-profile")
+		var profile bodyProfile
+		if s.Profile == "" && len(body) != 0 && json.Unmarshal(body, &profile) == nil {
+			s.Profile = profile.ref()
+		}
+	case p == "/commit":
+		if s.Parameters == nil {
+			return nil
+		}
+		s.Container = query.Get("container")
+		s.Target = target(query.Get("repo"), query.Get("tag"))
+		var config struct {
+			SimplifyProfile *bodyProfile
+		}
+		if len(body) != 0 && json.Unmarshal(body, &config) == nil {
+			s.Profile = config.SimplifyProfile.ref()
+		}
+	case startPath.MatchString(p):
+		if s.Parameters == nil {
+			return nil
+		}
+		s.Container = startPath.FindStringSubmatch(p)[1]
+	case simplifyPath.MatchString(p):
+		s.Image = simplifyPath.FindStringSubmatch(p)[1]
+		var options struct {
+			Target      string
+			Profile     *bodyProfile
+			ProfileFrom string
+			Keep        []string
+			Prune       []string
+		}
+		if len(body) != 0 && json.Unmarshal(body, &options) == nil {
+			s.Target = options.Target
+			s.Profile = options.ProfileFrom
+			if s.Profile == "" {
+				s.Profile = options.Profile.ref()
+			}
+			s.Keep = options.Keep
+			s.Prune = options.Prune
+		}
+	default:
+		return nil
+	}
+	return s
+}
+
+func target(repo, tag string) string {
+	if repo == "" || tag == "" {
+		return repo
+	}
+	return repo + ":" + tag
+}
@@ -0,0 +1,78 @@
+package authorization // import "github.com/docker/docker/pkg/authorization"
+
+import (
+	"testing"
+
+	"gotest.tools/assert"
+	is "gotest.tools/assert/cmp"
+)
+
+func TestSimplifyRequest(t *testing.T) {
+	for _, tc := range []struct {
+		uri      string
+		body     string
+		expected *Simplify
+	}{
+		{uri: "/v1.39/images/create?fromImage=alpine&tag=3.8"},
+		{uri: "/v1.39/containers/web/start"},
+		{uri: "/v1.39/commit?container=web&repo=app"},
+		{uri: "www.example.com/auth"},
+		{
+			uri:  "/v1.39/images/create?fromImage=alpine&tag=3.8&simplify-image=yes&simplify-threshold=50",
+			body: `{"Image":"sha256:0123","Reference":"alpine:3.7","Paths":["/bin/sh"]}`,
+			expected: &Simplify{
+				Parameters: map[string][]string{"simplify-image": {"yes"}, "simplify-threshold": {"50"}},
+				Image:      "alpine:3.8",
+				Profile:    "alpine:3.7",
+			},
+		},
+		{
+			uri: "/v1.39/images/create?fromImage=alpine&tag=3.8&simplify-image=yes&simplify-profile=alpine%3A3.7",
+			expected: &Simplify{
+				Parameters: map[string][]string{"simplify-image": {"yes"}, "simplify-profile": {"alpine:3.7"}},
+				Image:      "alpine:3.8",
+				Profile:    "alpine:3.7",
+			},
+		},
+		{
+			uri: "/containers/web/start?simplify-image=1",
+			expected: &Simplify{
+				Parameters: map[string][]string{"simplify-image": {"1"}},
+				Container:  "web",
+			},
+		},
+		{
+			uri:  "/v1.39/commit?container=web&repo=app&tag=slim&simplify-image=yes&simplify-keep=%2Fetc%2F**&simplify-keep=*.conf",
+			body: `{"Cmd":["sh"],"SimplifyProfile":{"Image":"sha256:0123","Paths":["/bin/sh"]}}`,
+			expected: &Simplify{
+				Parameters: map[string][]string{"simplify-image": {"yes"}, "simplify-keep": {"/etc/**", "*.conf"}},
+				Container:  "web",
+				Target:     "app:slim",
+				Profile:    "sha256:0123",
+			},
+		},
+		{
+			uri: "/v1.39/images/registry.example.com/app:2.0/simplify",
+			expected: &Simplify{
+				Image: "registry.example.com/app:2.0",
+			},
+		},
+		{
+			uri:  "/v1.39/images/app:2.0/simplify",
+			body: `{"Target":"app:slim","ProfileFrom":"app:1.0","Keep":["/etc/ssl/**"],"Prune":["/usr/share/doc/**"]}`,
+			expected: &Simplify{
+				Image:   "app:2.0",
+				Target:  "app:slim",
+				Profile: "app:1.0",
+				Keep:    []string{"/etc/ssl/**"},
+				Prune:   []string{"/usr/share/doc/**"},
+			},
+		},
+	} {
+		var body []byte
+		if tc.body != "" {
+			body = []byte(tc.body)
+		}
+		assert.Check(t, is.DeepEqual(simplifyRequest(tc.uri, body), tc.expected), tc.uri)
+	}
+}
@@ -94,6 +94,10 @@ int ovl_copy_xattr(struct dentry *old, struct dentry *new)
 
 		if (ovl_is_private_xattr(name))
 			continue;
+		// 修改： 复制到上层的文件不再是占位文件
+		if (!strcmp(name, OVL_XATTR_PLACEHOLDER))
+			continue;
+		// 修改
 retry:
 		size = vfs_getxattr(old, name, value, value_size);
 		if (size == -ERANGE)
@@ -713,6 +717,14 @@ static int ovl_copy_up_one(struct dentry *parent, struct dentry *dentry,
 	//若workdir不存在，报错
 	if (WARN_ON(!ctx.workdir))
 		return -EROFS;
+
+	// 修改： 占位文件没有内容，除非复制时截断，先拉取完整文件再从它复制
+	if (!(flags & O_TRUNC)) {
+		err = ovl_fetch_placeholder(dentry);
+		if (err)
+			return err;
+	}
+	// 修改
 	
 	//获取dentry的lowerdir挂载点和lowerdirdentry
 	ovl_path_lower(dentry, &ctx.lowerpath);
@@ -15,6 +15,8 @@
 #include <linux/ratelimit.h>
 #include <linux/mount.h>
 #include <linux/exportfs.h>
+#include <linux/moduleparam.h>
+#include <linux/umh.h>
 #include "overlayfs.h"
 
 struct ovl_lookup_data {
@@ -815,6 +817,155 @@ static int ovl_fix_origin(struct dentry *dentry, struct dentry *lower,
 	return err;
 }
 
+/*
+ * 修改： lazy挂载时，所有层都找不到的文件交给辅助程序拉取到最上面的下层目录
+ * 辅助程序以upperdir和文件在挂载点中的路径为参数，成功返回0，失败时以errno
+ * 作为退出码，返回-errno；文件不存在时返回-ENOENT
+ */
+static int ovl_fetch_missing(struct ovl_fs *ofs, struct dentry *dentry)
+{
+	char *buf, *path;
+	char *helper = NULL, *sock = NULL;
+	char *argv[4];
+	char *envp[3];
+	int err;
+
+	buf = kmalloc(PATH_MAX, GFP_KERNEL);
+	if (!buf)
+		return -ENOMEM;
+
+	path = dentry_path_raw(dentry, buf, PATH_MAX);
+	if (IS_ERR(path)) {
+		err = PTR_ERR(path);
+		goto out;
+	}
+
+	kernel_param_lock(THIS_MODULE);
+	if (ovl_fetch_helper && ovl_fetch_helper[0])
+		helper = kstrdup(ovl_fetch_helper, GFP_KERNEL);
+	sock = kasprintf(GFP_KERNEL, "DOCKER_SIMPLIFY_FETCH_SOCK=%s",
+			 ovl_fetch_socket ? ovl_fetch_socket : "");
+	kernel_param_unlock(THIS_MODULE);
+
+	err = -ENOENT;
+	if (!helper || !sock)
+		goto out;
+
+	argv[0] = (char *) kbasename(helper);
+	argv[1] = ofs->config.upperdir;
+	argv[2] = path;
+	argv[3] = NULL;
+	envp[0] = "PATH=/sbin:/bin:/usr/sbin:/usr/bin";
+	envp[1] = sock;
+	envp[2] = NULL;
+
+	err = call_usermodehelper(helper, argv, envp, UMH_WAIT_PROC);
+	// 返回值是辅助程序的wait状态，被信号终止时没有退出码
+	if (err > 0) {
+		if (err & 0x7f)
+			err = -EIO;
+		else
+			err = -((err >> 8) & 0xff);
+	}
+out:
+	kfree(sock);
+	kfree(helper);
+	kfree(buf);
+	return err;
+}
+
+/*
+ * 修改： 占位文件只有完整镜像中文件的元数据，内容被精简掉了。lazy挂载时，
+ * 打开占位文件前交给辅助程序把完整文件拉取到最上面的下层目录，再用拉取到的
+ * 文件替换dentry的下层，之后的读、执行、mmap和复制都使用完整文件。
+ * 不是占位文件时返回0；无法拉取时返回-EIO，不会打开只有元数据的文件
+ */
+static bool ovl_is_placeholder(struct dentry *real)
+{
+	return vfs_getxattr(real, OVL_XATTR_PLACEHOLDER, NULL, 0) >= 0;
+}
+
+int ovl_fetch_placeholder(struct dentry *dentry)
+{
+	struct ovl_fs *ofs = dentry->d_sb->s_fs_info;
+	struct ovl_entry *oe = dentry->d_fsdata;
+	struct inode *inode = d_inode(dentry);
+	struct dentry *parent, *lower, *real;
+	struct ovl_entry *poe;
+	const struct cred *old_cred;
+	bool placeholder;
+	int err;
+
+	if (!d_is_reg(dentry) || !oe->numlower || ovl_dentry_upper(dentry))
+		return 0;
+
+	// 读取trusted扩展属性和拉取都需要挂载者的权限
+	old_cred = ovl_override_creds(dentry->d_sb);
+	placeholder = ovl_is_placeholder(oe->lowerstack[0].dentry);
+	revert_creds(old_cred);
+	if (!placeholder)
+		return 0;
+	// 不是lazy挂载时无法拉取，不能把占位文件当作空文件打开
+	if (!ofs->config.lazy) {
+		err = -EIO;
+		goto warn;
+	}
+
+	err = mutex_lock_interruptible(&OVL_I(inode)->lock);
+	if (err)
+		return err;
+
+	old_cred = ovl_override_creds(dentry->d_sb);
+	// 同时打开的进程可能已经完成拉取
+	if (!ovl_is_placeholder(oe->lowerstack[0].dentry))
+		goto out;
+
+	// 拉取的文件在最上面的下层目录中，辅助程序准备缓存时已经创建了所有目录
+	err = -EIO;
+	parent = dget_parent(dentry);
+	poe = parent->d_fsdata;
+	if (!poe->numlower || poe->lowerstack[0].layer != &ofs->lower_layers[0] ||
+	    oe->lowerstack[0].layer == poe->lowerstack[0].layer)
+		goto out_parent;
+	if (ovl_fetch_missing(ofs, dentry))
+		goto out_parent;
+
+	real = lookup_one_len_unlocked(dentry->d_name.name,
+				       poe->lowerstack[0].dentry,
+				       dentry->d_name.len);
+	if (IS_ERR(real)) {
+		err = PTR_ERR(real);
+		goto out_parent;
+	}
+	if (!d_is_reg(real) || ovl_is_placeholder(real)) {
+		dput(real);
+		goto out_parent;
+	}
+
+	spin_lock(&dentry->d_lock);
+	lower = oe->lowerstack[0].dentry;
+	oe->lowerstack[0].dentry = real;
+	oe->lowerstack[0].layer = poe->lowerstack[0].layer;
+	spin_unlock(&dentry->d_lock);
+	dput(lower);
+
+	iput(OVL_I(inode)->lower);
+	OVL_I(inode)->lower = igrab(d_inode(real));
+	ovl_copyattr(d_inode(real), inode);
+	err = 0;
+out_parent:
+	dput(parent);
+out:
+	revert_creds(old_cred);
+	mutex_unlock(&OVL_I(inode)->lock);
+warn:
+	if (err)
+		pr_warn_ratelimited("overlayfs: failed to fetch placeholder %pd2 (%i)\n",
+				    dentry, err);
+	return err;
+}
+// 修改
+
 struct dentry *ovl_lookup(struct inode *dir, struct dentry *dentry,
 			  unsigned int flags)
 {
@@ -834,6 +985,9 @@ struct dentry *ovl_lookup(struct inode *dir, struct dentry *dentry,
 	struct dentry *this;
 	unsigned int i;
 	int err;
+	// 修改： 记录是否已经调用过辅助程序
+	bool fetched = false;
+	// 修改
 	struct ovl_lookup_data d = {
 		.name = dentry->d_name,
 		.is_dir = false,
@@ -894,6 +1048,9 @@ struct dentry *ovl_lookup(struct inode *dir, struct dentry *dentry,
 			goto out_put_upper;
 	}
 
+	// 修改： 拉取完成后从这里重新查找下层
+lookup_lower:
+	// 修改
 	for (i = 0; !d.stop && i < poe->numlower; i++) {
 		struct ovl_path lower = poe->lowerstack[i];
 
@@ -968,6 +1125,19 @@ struct dentry *ovl_lookup(struct inode *dir, struct dentry *dentry,
 		}
 	}
 
+	// 修改： lazy挂载时，各层都没有且没有被whiteout的文件，调用辅助程序拉取后重新查找
+	if (ofs->config.lazy && !fetched && !upperdentry && !ctr && !d.stop &&
+	    poe->numlower && ofs->config.upperdir) {
+		fetched = true;
+		err = ovl_fetch_missing(ofs, dentry);
+		if (!err)
+			goto lookup_lower;
+		// 校验失败、超时等错误要让open()失败，只有不存在的文件才是负dentry
+		if (err != -ENOENT)
+			goto out_put;
+	}
+	// 修改
+
 	/*
 	 * Lookup index by lower inode and verify it matches upper inode.
 	 * We only trust dir index if we verified that lower dir matches
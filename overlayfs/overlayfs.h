@@ -28,6 +28,9 @@ enum ovl_path_type {
 #define OVL_XATTR_IMPURE OVL_XATTR_PREFIX "impure"
 #define OVL_XATTR_NLINK OVL_XATTR_PREFIX "nlink"
 #define OVL_XATTR_UPPER OVL_XATTR_PREFIX "upper"
+// 修改： 精简镜像中只有元数据的占位文件，值为文件的原始大小
+#define OVL_XATTR_PLACEHOLDER XATTR_TRUSTED_PREFIX "simplify.placeholder"
+// 修改
 
 enum ovl_inode_flag {
 	/* Pure upper dir that may contain non pure upper entries */
@@ -284,6 +287,9 @@ int ovl_path_next(int idx, struct dentry *dentry, struct path *path);
 struct dentry *ovl_lookup(struct inode *dir, struct dentry *dentry,
 			  unsigned int flags);
 bool ovl_lower_positive(struct dentry *dentry);
+// 修改： 打开占位文件前拉取完整文件
+int ovl_fetch_placeholder(struct dentry *dentry);
+// 修改
 
 static inline int ovl_verify_origin(struct dentry *upper,
 				    struct dentry *origin, bool set)
@@ -379,3 +385,9 @@ int ovl_set_origin(struct dentry *dentry, struct dentry *lower,
 
 /* export.c */
 extern const struct export_operations ovl_export_operations;
+
+/* super.c */
+// 修改： 按需拉取辅助程序的模块参数
+extern char *ovl_fetch_helper;
+extern char *ovl_fetch_socket;
+// 修改
@@ -22,6 +22,9 @@ struct ovl_config {
 	// 修改： 添加simp选项
 	bool simp;
 	// 修改
+	// 修改： 添加lazy选项，下层找不到的文件调用辅助程序按需拉取
+	bool lazy;
+	// 修改
 };
 
 struct ovl_sb {
@@ -56,6 +56,18 @@ module_param_named(xino_auto, ovl_xino_auto_def, bool, 0644);
 MODULE_PARM_DESC(ovl_xino_auto_def,
 		 "Auto enable xino feature");
 
+// 修改： lazy挂载时用于拉取缺失文件的辅助程序及其通信的socket
+char *ovl_fetch_helper;
+module_param_named(fetch_helper, ovl_fetch_helper, charp, 0644);
+MODULE_PARM_DESC(ovl_fetch_helper,
+		 "Helper run to fetch files missing from a lazy mount");
+
+char *ovl_fetch_socket;
+module_param_named(fetch_socket, ovl_fetch_socket, charp, 0644);
+MODULE_PARM_DESC(ovl_fetch_socket,
+		 "Socket passed to the fetch helper");
+// 修改
+
 static void ovl_entry_stack_free(struct ovl_entry *oe)
 {
 	unsigned int i;
@@ -125,6 +137,14 @@ static struct dentry *ovl_d_real(struct dentry *dentry,
 	}
 
 	// 该dentry是普通文件
+
+	// 修改： 打开占位文件前拉取完整文件，只写截断时不需要原来的内容
+	if (!inode && !((open_flags & O_TRUNC) && (open_flags & O_ACCMODE))) {
+		err = ovl_fetch_placeholder(dentry);
+		if (err)
+			return ERR_PTR(err);
+	}
+	// 修改
 	//if (open_flags) {
 copy:
 	// 读写软链接和普通文件都会到达这里
@@ -426,6 +446,10 @@ static int ovl_show_options(struct seq_file *m, struct dentry *dentry)
 						"on" : "off");
 	if (ofs->config.xino != ovl_xino_def())
 		seq_printf(m, ",xino=%s", ovl_xino_str[ofs->config.xino]);
+	// 修改： 输出lazy选项
+	if (ofs->config.lazy)
+		seq_puts(m, ",lazy=on");
+	// 修改
 	return 0;
 }
 
@@ -468,6 +492,10 @@ enum {
 	OPT_SIMP_ON,
 	OPT_SIMP_OFF,
 	// 修改
+	// 修改： 添加按需拉取的选项
+	OPT_LAZY_ON,
+	OPT_LAZY_OFF,
+	// 修改
 	OPT_ERR,
 };
 
@@ -488,6 +516,10 @@ static const match_table_t ovl_tokens = {
 	{OPT_SIMP_ON,           "simp=on"},
 	{OPT_SIMP_OFF,          "simp=off"},
 	// 修改
+	// 修改： 添加按需拉取的选项，识别的字符串设置为“lazy=on”
+	{OPT_LAZY_ON,           "lazy=on"},
+	{OPT_LAZY_OFF,          "lazy=off"},
+	// 修改
 	{OPT_ERR,			NULL},
 };
 
@@ -631,6 +663,16 @@ static int ovl_parse_opt(char *opt, struct ovl_config *config)
 			break;
 		// 修改
 
+		// 修改： 添加lazy选项
+		case OPT_LAZY_ON:
+			config->lazy = true;
+			break;
+
+		case OPT_LAZY_OFF:
+			config->lazy = false;
+			break;
+		// 修改
+
 		default:
 			pr_err("overlayfs: unrecognized mount option \"%s\" or missing value\n", p);
 			return -EINVAL;
@@ -1458,6 +1500,9 @@ static int ovl_fill_super(struct super_block *sb, void *data, int silent)
 	// 修改： 默认ofs->config.simp为false
 	ofs->config.simp = false;
 	// 修改
+	// 修改： 默认ofs->config.lazy为false
+	ofs->config.lazy = false;
+	// 修改
 
 	/* 对挂载命令进行解析，得到upper，lower和work目录字符串，存入ofs的config字段
 	 * 添加命令选项，增加ofs的config字段，实现启用选项后，对overlay的所有增删改查操作都是对upper目录的操作